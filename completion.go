@@ -0,0 +1,269 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"yashubustudio/csv-search/pkg/csvsearch"
+)
+
+// datasetFlags complete to the dataset names from the configuration.
+var datasetFlags = []string{"table", "dataset"}
+
+// flagValues lists the fixed values offered after a flag.
+var flagValues = map[string][]string{
+	"format":              {csvsearch.ExportJSONL, csvsearch.ExportCSV},
+	"truncation":          {"head", "tail", "middle"},
+	"access-log":          {"common", "json"},
+	"log-level":           {"debug", "info", "warn", "error"},
+	"score-normalization": {"raw", "minmax", "softmax"},
+}
+
+// globalCompletionFlags are accepted by every command (see parseGlobalFlags).
+var globalCompletionFlags = []string{"--json-errors", "--log-level", "--quiet", "--verbose"}
+
+func runCompletion(args []string) error {
+	fs := flag.NewFlagSet("completion", flag.ExitOnError)
+	configFlag := fs.String("config", "", "configuration file whose dataset names are completed (default: csv-search_config.json if present)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s completion [--config path] bash|zsh|fish|powershell\n", programName())
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return usageErrorf("a shell name is required")
+	}
+
+	datasets, err := csvsearch.ConfiguredDatasets(csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")})
+	if err != nil {
+		return err
+	}
+
+	switch shell := fs.Arg(0); shell {
+	case "bash":
+		writeBashCompletion(os.Stdout, programName(), datasets)
+	case "zsh":
+		writeZshCompletion(os.Stdout, programName(), datasets)
+	case "fish":
+		writeFishCompletion(os.Stdout, programName(), datasets)
+	case "powershell":
+		writePowerShellCompletion(os.Stdout, programName(), datasets)
+	default:
+		return usageErrorf("unsupported shell %q (want bash, zsh, fish or powershell)", shell)
+	}
+	return nil
+}
+
+// programName is the name the completion scripts register for.
+func programName() string {
+	name := os.Args[0]
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(name, ".exe")
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands)+1)
+	for _, c := range commands {
+		names = append(names, c.name)
+	}
+	return append(names, "help")
+}
+
+// longFlags returns the flags of c with their "--" prefix, sorted.
+func longFlags(c command) []string {
+	out := make([]string, 0, len(c.flags)+len(c.switches))
+	for _, f := range append(append([]string{}, c.flags...), c.switches...) {
+		out = append(out, "--"+f)
+	}
+	out = append(out, globalCompletionFlags...)
+	sort.Strings(out)
+	return out
+}
+
+// shellFunc turns the program name into a shell function identifier.
+func shellFunc(prog string) string {
+	return "_" + strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return '_'
+		}
+		return r
+	}, prog)
+}
+
+func writeBashCompletion(w io.Writer, prog string, datasets []string) {
+	fn := shellFunc(prog)
+	fmt.Fprintf(w, "# bash completion for %s\n", prog)
+	fmt.Fprintf(w, "%s() {\n", fn)
+	fmt.Fprintln(w, `    local cur prev
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+    if [[ $COMP_CWORD -eq 1 ]]; then`)
+	fmt.Fprintf(w, "        COMPREPLY=( $(compgen -W %q -- \"$cur\") )\n", strings.Join(commandNames(), " "))
+	fmt.Fprintln(w, `        return
+    fi
+    case "$prev" in`)
+	fmt.Fprintf(w, "        %s)\n", bashPatterns(datasetFlags))
+	fmt.Fprintf(w, "            COMPREPLY=( $(compgen -W %q -- \"$cur\") )\n", strings.Join(datasets, " "))
+	fmt.Fprintln(w, "            return ;;")
+	for _, name := range sortedKeys(flagValues) {
+		fmt.Fprintf(w, "        %s)\n", bashPatterns([]string{name}))
+		fmt.Fprintf(w, "            COMPREPLY=( $(compgen -W %q -- \"$cur\") )\n", strings.Join(flagValues[name], " "))
+		fmt.Fprintln(w, "            return ;;")
+	}
+	fmt.Fprintln(w, `    esac
+    [[ "$cur" == -* ]] || return
+    case "${COMP_WORDS[1]}" in`)
+	for _, c := range commands {
+		fmt.Fprintf(w, "        %s) COMPREPLY=( $(compgen -W %q -- \"$cur\") ) ;;\n", c.name, strings.Join(longFlags(c), " "))
+	}
+	fmt.Fprintln(w, "    esac\n}")
+	fmt.Fprintf(w, "complete -o default -F %s %s\n", fn, prog)
+}
+
+func bashPatterns(flags []string) string {
+	patterns := make([]string, 0, 2*len(flags))
+	for _, f := range flags {
+		patterns = append(patterns, "-"+f, "--"+f)
+	}
+	return strings.Join(patterns, "|")
+}
+
+func writeZshCompletion(w io.Writer, prog string, datasets []string) {
+	fn := shellFunc(prog)
+	fmt.Fprintf(w, "#compdef %s\n\n", prog)
+	fmt.Fprintf(w, "%s() {\n", fn)
+	fmt.Fprintln(w, "    local -a commands datasets")
+	fmt.Fprintln(w, "    commands=(")
+	for _, c := range commands {
+		fmt.Fprintf(w, "        %s\n", zshQuote(c.name+":"+c.summary))
+	}
+	fmt.Fprintln(w, "    )")
+	fmt.Fprintf(w, "    datasets=(%s)\n", zshWords(datasets))
+	fmt.Fprintln(w, `    if (( CURRENT == 2 )); then
+        _describe 'command' commands
+        return
+    fi
+    case ${words[CURRENT-1]} in`)
+	fmt.Fprintf(w, "        %s) compadd -a datasets; return ;;\n", bashPatterns(datasetFlags))
+	for _, name := range sortedKeys(flagValues) {
+		fmt.Fprintf(w, "        %s) compadd -- %s; return ;;\n", bashPatterns([]string{name}), zshWords(flagValues[name]))
+	}
+	fmt.Fprintln(w, `    esac
+    if [[ ${words[CURRENT]} != -* ]]; then
+        _files
+        return
+    fi
+    case ${words[2]} in`)
+	for _, c := range commands {
+		fmt.Fprintf(w, "        %s) compadd -- %s ;;\n", c.name, strings.Join(longFlags(c), " "))
+	}
+	fmt.Fprintln(w, "    esac\n}")
+	fmt.Fprintf(w, "\ncompdef %s %s\n", fn, prog)
+}
+
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func zshWords(words []string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = zshQuote(word)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func writeFishCompletion(w io.Writer, prog string, datasets []string) {
+	fmt.Fprintf(w, "# fish completion for %s\n", prog)
+	fmt.Fprintf(w, "complete -c %s -f\n", prog)
+	fmt.Fprintf(w, "complete -c %s -l log-level -x -a %s\n", prog, zshQuote(strings.Join(flagValues["log-level"], " ")))
+	fmt.Fprintf(w, "complete -c %s -l json-errors\n", prog)
+	fmt.Fprintf(w, "complete -c %s -l quiet\n", prog)
+	fmt.Fprintf(w, "complete -c %s -l verbose\n", prog)
+	for _, c := range commands {
+		fmt.Fprintf(w, "complete -c %s -n __fish_use_subcommand -a %s -d %s\n", prog, c.name, zshQuote(c.summary))
+	}
+	isDataset := make(map[string]bool, len(datasetFlags))
+	for _, f := range datasetFlags {
+		isDataset[f] = true
+	}
+	for _, c := range commands {
+		cond := "'__fish_seen_subcommand_from " + c.name + "'"
+		for _, f := range c.flags {
+			switch {
+			case isDataset[f]:
+				fmt.Fprintf(w, "complete -c %s -n %s -l %s -x -a %s\n", prog, cond, f, zshQuote(strings.Join(datasets, " ")))
+			case flagValues[f] != nil:
+				fmt.Fprintf(w, "complete -c %s -n %s -l %s -x -a %s\n", prog, cond, f, zshQuote(strings.Join(flagValues[f], " ")))
+			default:
+				fmt.Fprintf(w, "complete -c %s -n %s -l %s -r -F\n", prog, cond, f)
+			}
+		}
+		for _, f := range c.switches {
+			fmt.Fprintf(w, "complete -c %s -n %s -l %s\n", prog, cond, f)
+		}
+	}
+}
+
+func writePowerShellCompletion(w io.Writer, prog string, datasets []string) {
+	fmt.Fprintf(w, "# PowerShell completion for %s\n", prog)
+	fmt.Fprintf(w, "Register-ArgumentCompleter -Native -CommandName '%s', '%s.exe' -ScriptBlock {\n", prog, prog)
+	fmt.Fprintln(w, "    param($wordToComplete, $commandAst, $cursorPosition)")
+	fmt.Fprintln(w, "    $commands = [ordered]@{")
+	for _, c := range commands {
+		fmt.Fprintf(w, "        '%s' = @(%s)\n", c.name, psList(longFlags(c)))
+	}
+	fmt.Fprintln(w, "    }")
+	fmt.Fprintln(w, "    $values = @{")
+	for _, f := range datasetFlags {
+		fmt.Fprintf(w, "        '--%s' = @(%s)\n", f, psList(datasets))
+	}
+	for _, name := range sortedKeys(flagValues) {
+		fmt.Fprintf(w, "        '--%s' = @(%s)\n", name, psList(flagValues[name]))
+	}
+	fmt.Fprintln(w, `    }
+    $words = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })
+    if ($wordToComplete -ne '') { $words = $words[0..($words.Count - 2)] }
+    if ($words.Count -le 1) {
+        $candidates = $commands.Keys
+    } else {
+        $prev = $words[-1] -replace '^-+', '--'
+        if ($values.Contains($prev)) {
+            $candidates = $values[$prev]
+        } elseif ($wordToComplete -like '-*' -and $commands.Contains($words[1])) {
+            $candidates = $commands[$words[1]]
+        } else {
+            return
+        }
+    }
+    $candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}`)
+}
+
+func psList(words []string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = "'" + strings.ReplaceAll(word, "'", "''") + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,122 @@
+package emb
+
+import (
+	"errors"
+	"fmt"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// Dimension: 出力ベクトルの次元（hidden）
+func (e *Encoder) Dimension() int {
+	if e == nil {
+		return 0
+	}
+	return e.hidden
+}
+
+// EncodeBatch: 複数テキストを 1 回の推論でまとめてエンコード
+// 最長の系列に合わせて <pad> で埋め、attention_mask で除外する。
+// attention_mask を持たないモデルでは 1 件ずつ Encode する。
+func (e *Encoder) EncodeBatch(texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	if e.sess == nil || e.tok == nil {
+		return nil, errors.New("encoder is not initialized")
+	}
+	if !e.hasMask || len(texts) == 1 {
+		out := make([][]float32, len(texts))
+		for i, text := range texts {
+			vec, err := e.Encode(text)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = vec
+		}
+		return out, nil
+	}
+
+	// ===== トークナイズ =====
+	tokenIDs := make([][]int64, len(texts))
+	masks := make([][]int64, len(texts))
+	maxSeq := 0
+	for i, text := range texts {
+		ids, mask, _, err := e.tokenize(text)
+		if err != nil {
+			return nil, fmt.Errorf("batch item %d: %w", i, err)
+		}
+		tokenIDs[i], masks[i] = ids, mask
+		if len(ids) > maxSeq {
+			maxSeq = len(ids)
+		}
+	}
+
+	// ===== パディング（XLM-R 系は位置 ID を pad から計算するので pad id を使う）=====
+	padID := int64(e.padID())
+	batch := len(texts)
+	ids := make([]int64, batch*maxSeq)
+	mask := make([]int64, batch*maxSeq)
+	for i := range tokenIDs {
+		base := i * maxSeq
+		for t := 0; t < maxSeq; t++ {
+			if t < len(tokenIDs[i]) {
+				ids[base+t] = tokenIDs[i][t]
+				mask[base+t] = masks[i][t]
+			} else {
+				ids[base+t] = padID
+			}
+		}
+	}
+
+	// ===== 入出力テンソル =====
+	inputs, release, err := e.newInputs(int64(batch), int64(maxSeq), ids, mask)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	tOut, err := ort.NewEmptyTensor[float32](e.outputShape(int64(batch), int64(maxSeq)))
+	if err != nil {
+		return nil, err
+	}
+	defer tOut.Destroy()
+
+	e.mu.Lock()
+	err = e.sess.Run(inputs, []ort.Value{tOut})
+	e.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	raw := tOut.GetData()
+	out := make([][]float32, batch)
+	if e.pooled {
+		if len(raw) != batch*e.hidden {
+			return nil, fmt.Errorf("unexpected output length: %d", len(raw))
+		}
+		for i := 0; i < batch; i++ {
+			out[i] = meanPoolAndL2(raw[i*e.hidden:(i+1)*e.hidden], 1, e.hidden, nil)
+		}
+		return out, nil
+	}
+	if len(raw) != batch*maxSeq*e.hidden {
+		return nil, fmt.Errorf("unexpected output length: %d", len(raw))
+	}
+	stride := maxSeq * e.hidden
+	for i := 0; i < batch; i++ {
+		out[i] = meanPoolAndL2(raw[i*stride:(i+1)*stride], maxSeq, e.hidden, mask[i*maxSeq:(i+1)*maxSeq])
+	}
+	return out, nil
+}
+
+// padID: トークナイザの <pad> の id（bge-m3 / XLM-R は 1）
+func (e *Encoder) padID() int {
+	if p := e.tok.GetPadding(); p != nil {
+		return p.PadId
+	}
+	if id, ok := e.tok.TokenToId("<pad>"); ok {
+		return id
+	}
+	return 0
+}
@@ -0,0 +1,53 @@
+package emb
+
+import (
+	"math/rand"
+	"os"
+	"testing"
+)
+
+// BenchmarkEncode は実モデルでのエンコード時間を測る。モデル一式は serve と同じ
+// 環境変数（CSVSEARCH_ORT_LIB / CSVSEARCH_MODEL / CSVSEARCH_TOKENIZER）で指定し、
+// 未設定ならスキップする。
+func BenchmarkEncode(b *testing.B) {
+	cfg := Config{
+		OrtDLL:        os.Getenv("CSVSEARCH_ORT_LIB"),
+		ModelPath:     os.Getenv("CSVSEARCH_MODEL"),
+		TokenizerPath: os.Getenv("CSVSEARCH_TOKENIZER"),
+		MaxSeqLen:     512,
+	}
+	if cfg.OrtDLL == "" || cfg.ModelPath == "" || cfg.TokenizerPath == "" {
+		b.Skip("CSVSEARCH_ORT_LIB, CSVSEARCH_MODEL and CSVSEARCH_TOKENIZER are required")
+	}
+	var enc Encoder
+	if err := enc.Init(cfg); err != nil {
+		b.Fatalf("Init: %v", err)
+	}
+	defer enc.Close()
+
+	const text = "渋谷駅から徒歩5分の静かなカフェ。電源とWi-Fiがあり、作業にも向いています。"
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := enc.Encode(text); err != nil {
+			b.Fatalf("Encode: %v", err)
+		}
+	}
+}
+
+// BenchmarkMeanPoolAndL2 はモデル出力のプーリング部分だけを測る（モデル不要）。
+func BenchmarkMeanPoolAndL2(b *testing.B) {
+	const seqLen, hidden = 128, 1024
+	rng := rand.New(rand.NewSource(1))
+	lastHidden := make([]float32, seqLen*hidden)
+	for i := range lastHidden {
+		lastHidden[i] = rng.Float32()
+	}
+	attn := make([]int64, seqLen)
+	for i := range attn[:100] {
+		attn[i] = 1
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		meanPoolAndL2(lastHidden, seqLen, hidden, attn)
+	}
+}
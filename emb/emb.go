@@ -20,10 +20,17 @@ type Encoder struct {
 	opts       *ort.SessionOptions
 	tok        *tokenizer.Tokenizer
 	inputNames []string
-	outputName string // "last_hidden_state" を想定
+	outputName string // "last_hidden_state" を想定（量子化モデル等ではプーリング済み出力も可）
 	hidden     int    // 例: 1024
+	hasMask    bool   // attention_mask 入力の有無
+	int32IDs   bool   // 入力が int32 のモデル（一部の量子化エクスポート）
+	pooled     bool   // 出力が [batch, hidden]（モデル内でプーリング済み）
 	maxLen     int
+	truncation string     // "" / "head" / "tail" / "middle"
 	mu         sync.Mutex // ORTセッションは基本スレッドセーフだが、簡易に直列化
+
+	sparse  *sparseHead // bge-m3 の sparse_linear（未設定なら nil）
+	envHeld bool        // ORT 環境の参照を保持しているか
 }
 
 type Config struct {
@@ -32,6 +39,14 @@ type Config struct {
 	ModelPath     string // 例: D:\Ollama\projects\csv-search\models\bge-m3\model.onnx  (必要なら _data も同階層)
 	TokenizerPath string // 例: D:\Ollama\projects\csv-search\models\bge-m3\tokenizer.json
 	MaxSeqLen     int    // 例: 512
+
+	// 任意: bge-m3 の sparse_linear 重み（JSON: {"weight":[...], "bias":0}）
+	// 指定すると EncodeHybrid で語彙重み（sparse）も得られる
+	SparseHeadPath string
+
+	// 任意: 最大長を超える入力の切り詰め方
+	// ""（従来通り先頭から MaxSeqLen トークン）/ "head" / "tail" / "middle"
+	Truncation string
 }
 
 // Init: ORT/DLL読み込み→環境初期化→モデル/トークナイザ読み込み→セッション生成
@@ -49,10 +64,13 @@ func (e *Encoder) Init(cfg Config) error {
 		return fmt.Errorf("tokenizer.json が見つかりません: %s", cfg.TokenizerPath)
 	}
 
-	// ORT DLL を明示ロード → 環境初期化
-	ort.SetSharedLibraryPath(cfg.OrtDLL)
-	if err := ort.InitializeEnvironment(ort.WithLogLevelWarning()); err != nil {
-		return err
+	// ORT DLL を明示ロード → 環境初期化（複数 Encoder で共有するため参照カウント）
+	// Init が途中で失敗した場合も Close で解放すること
+	if !e.envHeld {
+		if err := acquireEnvironment(cfg.OrtDLL); err != nil {
+			return err
+		}
+		e.envHeld = true
 	}
 
 	// モデルIOを確認
@@ -60,31 +78,35 @@ func (e *Encoder) Init(cfg Config) error {
 	if err != nil {
 		return err
 	}
-	// 入力名（input_ids / attention_mask を想定）
+	// 入力名（input_ids / attention_mask / token_type_ids を想定）
 	e.inputNames = nil
-	hasInputIDs, hasMask := false, false
+	e.hasMask, e.int32IDs = false, false
+	hasInputIDs := false
 	for _, ii := range inInfos {
 		switch ii.Name {
 		case "input_ids":
 			hasInputIDs = true
+			e.int32IDs = ii.DataType == ort.TensorElementDataTypeInt32
 			e.inputNames = append(e.inputNames, ii.Name)
 		case "attention_mask":
-			hasMask = true
+			// attention_mask が無いモデルも存在するが、bge-m3 は通常あり
+			e.hasMask = true
+			e.inputNames = append(e.inputNames, ii.Name)
+		case "token_type_ids":
+			// XLM-R 系では未使用だが、エクスポートによっては入力に残る（全 0 を渡す）
 			e.inputNames = append(e.inputNames, ii.Name)
 		}
 	}
 	if !hasInputIDs {
 		return fmt.Errorf("モデルに input_ids がありません（実IO: %+v）", inInfos)
 	}
-	if !hasMask {
-		// attention_mask が無いモデルも存在するが、bge-m3 は通常あり
-		// ここはエラーにせず自動生成も可。今回は警告扱いで対応。
-		e.inputNames = []string{"input_ids"} // 最低限
-	}
 
-	// 出力名と hidden 次元を推定（"last_hidden_state": [-1 -1 hidden] を期待）
+	// 出力名と hidden 次元を推定
+	// "last_hidden_state": [-1 -1 hidden] を優先し、無ければプーリング済みの
+	// [-1 hidden] 出力（量子化・最適化済みエクスポートで多い）を使う
 	e.outputName = ""
 	e.hidden = 0
+	e.pooled = false
 	for _, oi := range outInfos {
 		if oi.Name == "last_hidden_state" {
 			e.outputName = oi.Name
@@ -99,7 +121,16 @@ func (e *Encoder) Init(cfg Config) error {
 		}
 	}
 	if e.outputName == "" {
-		return fmt.Errorf("last_hidden_state が出力に見つかりません（実IO: %+v）", outInfos)
+		if oi, ok := findPooledOutput(outInfos); ok {
+			e.outputName = oi.Name
+			e.pooled = true
+			if dims, err := parseDimsFromShapeString(oi.String()); err == nil && len(dims) == 2 && dims[1] > 0 {
+				e.hidden = int(dims[1])
+			}
+		}
+	}
+	if e.outputName == "" {
+		return fmt.Errorf("last_hidden_state またはプーリング済みの出力が見つかりません（実IO: %+v）", outInfos)
 	}
 	if e.hidden == 0 {
 		// 取得に失敗した場合は既定値（bge-m3は1024）
@@ -127,6 +158,23 @@ func (e *Encoder) Init(cfg Config) error {
 		cfg.MaxSeqLen = 512
 	}
 	e.maxLen = cfg.MaxSeqLen
+	if err := validateTruncation(cfg.Truncation); err != nil {
+		return err
+	}
+	e.truncation = cfg.Truncation
+
+	// sparse ヘッド（任意）
+	e.sparse = nil
+	if cfg.SparseHeadPath != "" {
+		if e.pooled {
+			return fmt.Errorf("sparse head には last_hidden_state 出力が必要です（出力: %s）", e.outputName)
+		}
+		head, err := loadSparseHead(cfg.SparseHeadPath, e.hidden)
+		if err != nil {
+			return err
+		}
+		e.sparse = head
+	}
 	return nil
 }
 
@@ -140,64 +188,76 @@ func (e *Encoder) Close() {
 		e.opts.Destroy()
 		e.opts = nil
 	}
-	// ORT環境終了
-	_ = ort.DestroyEnvironment()
+	// ORT環境終了（最後の Encoder が閉じられたときだけ破棄）
+	if e.envHeld {
+		releaseEnvironment()
+		e.envHeld = false
+	}
 }
 
 // Encode: 日本語テキスト → 句ベクトル（L2正規化済み）
 // 返り値は長さ e.hidden の []float32
 func (e *Encoder) Encode(text string) ([]float32, error) {
+	out, err := e.forward(text)
+	if err != nil {
+		return nil, err
+	}
+	if e.pooled {
+		// プーリング済み出力は L2 正規化のみ
+		return meanPoolAndL2(out.hidden, 1, e.hidden, nil), nil
+	}
+	vec := meanPoolAndL2(out.hidden, out.seqLen, e.hidden, out.mask)
+	return vec, nil
+}
+
+// CountsTokens: トークナイザが読み込まれていれば true
+func (e *Encoder) CountsTokens() bool {
+	return e != nil && e.tok != nil
+}
+
+// CountTokens: Encode がモデルに入力するトークン数（特殊トークンを含み、
+// 最大長での切り詰め後）
+func (e *Encoder) CountTokens(text string) (int, error) {
+	if e.tok == nil {
+		return 0, errors.New("encoder is not initialized")
+	}
+	ids, _, _, err := e.tokenize(text)
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// forwardOutput: 1 文ぶんのトークン列と last_hidden_state
+type forwardOutput struct {
+	ids     []int64
+	mask    []int64
+	special []int64   // 1 = 特殊トークン（<s>, </s> など）
+	hidden  []float32 // len = seqLen * e.hidden（pooled の場合は e.hidden）
+	seqLen  int
+}
+
+// forward: トークナイズ → ORT 実行まで（プーリング前の出力を返す）
+func (e *Encoder) forward(text string) (*forwardOutput, error) {
 	if e.sess == nil || e.tok == nil {
 		return nil, errors.New("encoder is not initialized")
 	}
 
-	// ===== トークナイズ（最大長でトリム、attentionを自動生成）=====
-	if runtime.GOOS == "windows" {
-		text = strings.TrimSpace(text)
-	}
-	enc, err := e.tok.EncodeSingle(text)
+	ids, mask, special, err := e.tokenize(text)
 	if err != nil {
 		return nil, err
 	}
-	ids := make([]int64, 0, len(enc.Ids))
-	mask := make([]int64, 0, len(enc.Ids))
-	for i, v := range enc.Ids {
-		if len(ids) >= e.maxLen {
-			break
-		}
-		ids = append(ids, int64(v))
-		if len(enc.AttentionMask) > i {
-			mask = append(mask, int64(enc.AttentionMask[i]))
-		} else {
-			mask = append(mask, 1)
-		}
-	}
 	seqLen := int64(len(ids))
-	if seqLen == 0 {
-		return nil, errors.New("empty tokenized input")
-	}
 
 	// ===== 入力テンソル =====
-	shape := ort.NewShape(1, seqLen)
-	tIDs, err := ort.NewTensor[int64](shape, ids)
+	inputs, release, err := e.newInputs(1, seqLen, ids, mask)
 	if err != nil {
 		return nil, err
 	}
-	defer tIDs.Destroy()
+	defer release()
 
-	inputs := []ort.Value{tIDs}
-	if len(e.inputNames) == 2 { // attention_mask がある場合のみ
-		tMask, err := ort.NewTensor[int64](shape, mask)
-		if err != nil {
-			return nil, err
-		}
-		defer tMask.Destroy()
-		inputs = append(inputs, tMask)
-	}
-
-	// ===== 出力テンソル（[1, seqLen, hidden]）=====
-	outShape := ort.NewShape(1, seqLen, int64(e.hidden))
-	tOut, err := ort.NewEmptyTensor[float32](outShape)
+	// ===== 出力テンソル（[1, seqLen, hidden] / pooled は [1, hidden]）=====
+	tOut, err := ort.NewEmptyTensor[float32](e.outputShape(1, seqLen))
 	if err != nil {
 		return nil, err
 	}
@@ -211,17 +271,59 @@ func (e *Encoder) Encode(text string) ([]float32, error) {
 		return nil, err
 	}
 
-	// ===== Mean Pooling + L2 =====
 	raw := tOut.GetData() // len = seqLen * hidden
-	if len(raw) != int(seqLen)*e.hidden {
+	if e.pooled {
+		if len(raw) != e.hidden {
+			return nil, fmt.Errorf("unexpected output length: %d", len(raw))
+		}
+	} else if len(raw) != int(seqLen)*e.hidden {
 		// モデル側でpad/切詰めされた可能性を考慮（保険）
 		if len(raw)%e.hidden != 0 {
 			return nil, fmt.Errorf("unexpected output length: %d", len(raw))
 		}
 		seqLen = int64(len(raw) / e.hidden)
 	}
-	vec := meanPoolAndL2(raw, int(seqLen), e.hidden, mask)
-	return vec, nil
+	// tOut は defer で破棄されるのでコピーして返す
+	hidden := make([]float32, len(raw))
+	copy(hidden, raw)
+	return &forwardOutput{ids: ids, mask: mask, special: special, hidden: hidden, seqLen: int(seqLen)}, nil
+}
+
+// tokenize: トークナイズ（最大長でトリム、attentionを自動生成）
+func (e *Encoder) tokenize(text string) (ids, mask, special []int64, err error) {
+	if runtime.GOOS == "windows" {
+		text = strings.TrimSpace(text)
+	}
+	enc, err := e.tok.EncodeSingle(text)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ids = make([]int64, 0, len(enc.Ids))
+	mask = make([]int64, 0, len(enc.Ids))
+	special = make([]int64, 0, len(enc.Ids))
+	for i, v := range enc.Ids {
+		if e.truncation == "" && len(ids) >= e.maxLen {
+			break
+		}
+		ids = append(ids, int64(v))
+		if len(enc.AttentionMask) > i {
+			mask = append(mask, int64(enc.AttentionMask[i]))
+		} else {
+			mask = append(mask, 1)
+		}
+		if len(enc.SpecialTokenMask) > i {
+			special = append(special, int64(enc.SpecialTokenMask[i]))
+		} else {
+			special = append(special, 0)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil, nil, errors.New("empty tokenized input")
+	}
+	if e.truncation != "" {
+		ids, mask, special = truncateTokens(ids, mask, special, e.maxLen, e.truncation)
+	}
+	return ids, mask, special, nil
 }
 
 // ===== ヘルパ =====
@@ -0,0 +1,60 @@
+package emb
+
+import (
+	"fmt"
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// ORT 環境はプロセスで 1 つ。モデルのホットリロード時は新旧 2 つの Encoder が
+// 同時に存在するため、参照カウントで初期化・破棄を管理する。
+var (
+	envMu   sync.Mutex
+	envRefs int
+)
+
+func acquireEnvironment(dll string) error {
+	envMu.Lock()
+	defer envMu.Unlock()
+	if envRefs == 0 && !ort.IsInitialized() {
+		ort.SetSharedLibraryPath(dll)
+		if err := ort.InitializeEnvironment(ort.WithLogLevelWarning()); err != nil {
+			return err
+		}
+	}
+	envRefs++
+	return nil
+}
+
+func releaseEnvironment() {
+	envMu.Lock()
+	defer envMu.Unlock()
+	if envRefs == 0 {
+		return
+	}
+	envRefs--
+	if envRefs == 0 {
+		_ = ort.DestroyEnvironment()
+	}
+}
+
+// RuntimeVersion は ONNX Runtime のバージョンを返す。環境が未初期化なら dll を
+// 一時的に読み込んで問い合わせる（稼働中の Encoder には影響しない）。
+func RuntimeVersion(dll string) (string, error) {
+	envMu.Lock()
+	defer envMu.Unlock()
+	if ort.IsInitialized() {
+		return ort.GetVersion(), nil
+	}
+	if dll == "" {
+		return "", fmt.Errorf("onnx runtime library is not configured")
+	}
+	ort.SetSharedLibraryPath(dll)
+	if err := ort.InitializeEnvironment(ort.WithLogLevelWarning()); err != nil {
+		return "", err
+	}
+	version := ort.GetVersion()
+	_ = ort.DestroyEnvironment()
+	return version, nil
+}
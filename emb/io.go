@@ -0,0 +1,68 @@
+package emb
+
+import (
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// プーリング済み（[batch, hidden]）出力として扱う名前（優先順）
+var pooledOutputNames = []string{"sentence_embedding", "dense_vecs", "sentence_embeddings", "embeddings", "pooler_output"}
+
+func findPooledOutput(outInfos []ort.InputOutputInfo) (ort.InputOutputInfo, bool) {
+	for _, name := range pooledOutputNames {
+		for _, oi := range outInfos {
+			if oi.Name == name {
+				return oi, true
+			}
+		}
+	}
+	return ort.InputOutputInfo{}, false
+}
+
+// newInputs: e.inputNames の順に入力テンソルを作る（[batch, seq]）
+// release で全テンソルを破棄する
+func (e *Encoder) newInputs(batch, seq int64, ids, mask []int64) ([]ort.Value, func(), error) {
+	shape := ort.NewShape(batch, seq)
+	var values []ort.Value
+	release := func() {
+		for _, v := range values {
+			v.Destroy()
+		}
+	}
+	for _, name := range e.inputNames {
+		var data []int64
+		switch name {
+		case "input_ids":
+			data = ids
+		case "attention_mask":
+			data = mask
+		default: // token_type_ids
+			data = make([]int64, len(ids))
+		}
+		v, err := e.newIDTensor(shape, data)
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		values = append(values, v)
+	}
+	return values, release, nil
+}
+
+func (e *Encoder) newIDTensor(shape ort.Shape, data []int64) (ort.Value, error) {
+	if !e.int32IDs {
+		return ort.NewTensor[int64](shape, data)
+	}
+	narrowed := make([]int32, len(data))
+	for i, v := range data {
+		narrowed[i] = int32(v)
+	}
+	return ort.NewTensor[int32](shape, narrowed)
+}
+
+// outputShape: 出力テンソルの形
+func (e *Encoder) outputShape(batch, seq int64) ort.Shape {
+	if e.pooled {
+		return ort.NewShape(batch, int64(e.hidden))
+	}
+	return ort.NewShape(batch, seq, int64(e.hidden))
+}
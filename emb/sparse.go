@@ -0,0 +1,76 @@
+package emb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// sparseHead: bge-m3 の sparse_linear（hidden → 1 の線形層）
+type sparseHead struct {
+	weight []float32
+	bias   float32
+}
+
+// loadSparseHead: JSON {"weight": [hidden 個], "bias": b} を読み込む
+// （FlagEmbedding の sparse_linear.pt を書き出したもの）
+func loadSparseHead(path string, hidden int) (*sparseHead, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("sparse head が読み込めません: %w", err)
+	}
+	var payload struct {
+		Weight []float32 `json:"weight"`
+		Bias   float32   `json:"bias"`
+	}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, fmt.Errorf("sparse head の形式が不正です: %w", err)
+	}
+	if len(payload.Weight) != hidden {
+		return nil, fmt.Errorf("sparse head の次元 %d がモデルの hidden %d と一致しません", len(payload.Weight), hidden)
+	}
+	return &sparseHead{weight: payload.Weight, bias: payload.Bias}, nil
+}
+
+// HasSparse: sparse ヘッドが読み込まれていれば true
+func (e *Encoder) HasSparse() bool {
+	return e != nil && e.sparse != nil
+}
+
+// EncodeHybrid: 1 回の推論で dense ベクトル（Encode と同じ）と
+// 語彙重み（token id → weight、特殊トークンを除き同一 id は最大値）を返す
+func (e *Encoder) EncodeHybrid(text string) ([]float32, map[int32]float32, error) {
+	if e.sparse == nil {
+		return nil, nil, errors.New("sparse head is not configured")
+	}
+	out, err := e.forward(text)
+	if err != nil {
+		return nil, nil, err
+	}
+	dense := meanPoolAndL2(out.hidden, out.seqLen, e.hidden, out.mask)
+	return dense, e.sparse.weights(out, e.hidden), nil
+}
+
+// weights: relu(h·W + b) をトークンごとに計算
+func (h *sparseHead) weights(out *forwardOutput, hidden int) map[int32]float32 {
+	result := make(map[int32]float32)
+	for t := 0; t < out.seqLen && t < len(out.ids); t++ {
+		if out.mask[t] == 0 || out.special[t] != 0 {
+			continue
+		}
+		base := t * hidden
+		w := h.bias
+		for i := 0; i < hidden; i++ {
+			w += out.hidden[base+i] * h.weight[i]
+		}
+		if w <= 0 {
+			continue
+		}
+		id := int32(out.ids[t])
+		if w > result[id] {
+			result[id] = w
+		}
+	}
+	return result
+}
@@ -0,0 +1,73 @@
+package emb
+
+import "fmt"
+
+// 切り詰め方
+//
+//	head:   本文の先頭を残す
+//	tail:   本文の末尾を残す（結論が末尾にあるデータ向け）
+//	middle: 本文の先頭と末尾を半分ずつ残し、中央を落とす
+//
+// いずれも先頭・末尾の特殊トークン（<s>, </s>）は保持する。
+const (
+	TruncateHead   = "head"
+	TruncateTail   = "tail"
+	TruncateMiddle = "middle"
+)
+
+func validateTruncation(strategy string) error {
+	switch strategy {
+	case "", TruncateHead, TruncateTail, TruncateMiddle:
+		return nil
+	}
+	return fmt.Errorf("未対応の truncation です: %q（head / tail / middle）", strategy)
+}
+
+// truncateTokens: maxLen を超える系列を strategy に従って切り詰める
+func truncateTokens(ids, mask, special []int64, maxLen int, strategy string) ([]int64, []int64, []int64) {
+	if len(ids) <= maxLen || maxLen <= 0 {
+		return ids, mask, special
+	}
+
+	// 先頭・末尾の特殊トークンの範囲
+	start := 0
+	for start < len(ids) && special[start] != 0 {
+		start++
+	}
+	end := len(ids)
+	for end > start && special[end-1] != 0 {
+		end--
+	}
+	budget := maxLen - start - (len(ids) - end)
+	if budget <= 0 {
+		// 特殊トークンだけで溢れる異常系は単純に先頭から切る
+		return ids[:maxLen], mask[:maxLen], special[:maxLen]
+	}
+
+	var keep [][2]int // 残す本文の範囲 [from, to)
+	switch strategy {
+	case TruncateTail:
+		keep = [][2]int{{end - budget, end}}
+	case TruncateMiddle:
+		headLen := (budget + 1) / 2
+		tailLen := budget - headLen
+		keep = [][2]int{{start, start + headLen}, {end - tailLen, end}}
+	default: // head
+		keep = [][2]int{{start, start + budget}}
+	}
+
+	outIDs := make([]int64, 0, maxLen)
+	outMask := make([]int64, 0, maxLen)
+	outSpecial := make([]int64, 0, maxLen)
+	appendRange := func(from, to int) {
+		outIDs = append(outIDs, ids[from:to]...)
+		outMask = append(outMask, mask[from:to]...)
+		outSpecial = append(outSpecial, special[from:to]...)
+	}
+	appendRange(0, start)
+	for _, r := range keep {
+		appendRange(r[0], r[1])
+	}
+	appendRange(end, len(ids))
+	return outIDs, outMask, outSpecial
+}
@@ -0,0 +1,36 @@
+package emb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTruncateTokens(t *testing.T) {
+	// <s> 10 11 12 13 14 15 </s>
+	ids := []int64{0, 10, 11, 12, 13, 14, 15, 2}
+	mask := []int64{1, 1, 1, 1, 1, 1, 1, 1}
+	special := []int64{1, 0, 0, 0, 0, 0, 0, 1}
+
+	cases := []struct {
+		strategy string
+		want     []int64
+	}{
+		{TruncateHead, []int64{0, 10, 11, 12, 2}},
+		{TruncateTail, []int64{0, 13, 14, 15, 2}},
+		{TruncateMiddle, []int64{0, 10, 11, 15, 2}},
+	}
+	for _, tc := range cases {
+		got, gotMask, gotSpecial := truncateTokens(ids, mask, special, 5, tc.strategy)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%s: got %v, want %v", tc.strategy, got, tc.want)
+		}
+		if len(gotMask) != 5 || gotSpecial[0] != 1 || gotSpecial[4] != 1 {
+			t.Fatalf("%s: special tokens not preserved: mask=%v special=%v", tc.strategy, gotMask, gotSpecial)
+		}
+	}
+
+	short, _, _ := truncateTokens(ids, mask, special, 16, TruncateTail)
+	if !reflect.DeepEqual(short, ids) {
+		t.Fatalf("short input should be untouched, got %v", short)
+	}
+}
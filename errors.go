@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+
+	"modernc.org/sqlite"
+
+	"yashubustudio/csv-search/pkg/csvsearch"
+)
+
+// Error codes printed with --json-errors. Each maps to its own exit status
+// (see exitStatus).
+const (
+	codeUsage       = "usage"
+	codeConfig      = "config"
+	codeDatabase    = "database"
+	codeEncoder     = "encoder"
+	codeNotFound    = "not_found"
+	codeFile        = "file"
+	codeTimeout     = "timeout"
+	codeCanceled    = "canceled"
+	codeAborted     = "aborted"
+	codeCheckFailed = "check_failed"
+	codeError       = "error"
+)
+
+// exitStatus is the process exit status of each error code, so that scripts
+// can tell failure classes apart without --json-errors.
+var exitStatus = map[string]int{
+	codeError:       1,
+	codeUsage:       2,
+	codeConfig:      3,
+	codeDatabase:    4,
+	codeEncoder:     5,
+	codeNotFound:    6,
+	codeTimeout:     7,
+	codeFile:        8,
+	codeCheckFailed: 9,
+	codeAborted:     10,
+	codeCanceled:    130,
+}
+
+// jsonErrors prints failures as {"error": message, "code": code} on stderr
+// (see parseGlobalFlags).
+var jsonErrors bool
+
+// codedError assigns an error code to a failure detected by the CLI itself.
+type codedError struct {
+	code string
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+func withCode(code string, err error) error {
+	return &codedError{code: code, err: err}
+}
+
+// usageErrorf reports invalid or missing arguments.
+func usageErrorf(format string, args ...any) error {
+	return withCode(codeUsage, fmt.Errorf(format, args...))
+}
+
+var errAborted = withCode(codeAborted, errors.New("aborted"))
+
+// errorCode classifies err for --json-errors and the exit status.
+func errorCode(err error) string {
+	var coded *codedError
+	switch {
+	case errors.As(err, &coded):
+		return coded.code
+	case errors.Is(err, csvsearch.ErrNotFound):
+		return codeNotFound
+	case errors.Is(err, csvsearch.ErrUnknownField), errors.Is(err, csvsearch.ErrUnknownModel), errors.Is(err, csvsearch.ErrModelMismatch):
+		return codeUsage
+	case errors.Is(err, csvsearch.ErrConfig):
+		return codeConfig
+	case errors.Is(err, csvsearch.ErrDatabase):
+		return codeDatabase
+	case errors.Is(err, csvsearch.ErrEncoder):
+		return codeEncoder
+	case errors.Is(err, context.DeadlineExceeded), isNetTimeout(err):
+		return codeTimeout
+	case errors.Is(err, context.Canceled):
+		return codeCanceled
+	case isSQLiteError(err):
+		return codeDatabase
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrPermission):
+		return codeFile
+	}
+	return codeError
+}
+
+func isNetTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func isSQLiteError(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr)
+}
+
+// exitWithError reports err and exits with the status of its error code.
+func exitWithError(err error) {
+	code := errorCode(err)
+	if jsonErrors {
+		_ = json.NewEncoder(os.Stderr).Encode(map[string]any{"error": err.Error(), "code": code, "exit_code": exitStatus[code]})
+	} else {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	}
+	os.Exit(exitStatus[code])
+}
@@ -0,0 +1,235 @@
+// Package answer has a language model answer questions from search results,
+// citing the records it used by id.
+package answer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"yashubustudio/csv-search/internal/search"
+)
+
+// Providers accepted by Options.Provider.
+const (
+	ProviderOpenAI = "openai"
+	ProviderOllama = "ollama"
+)
+
+// Default settings of Options.
+const (
+	DefaultOpenAIURL       = "https://api.openai.com/v1"
+	DefaultOllamaURL       = "http://localhost:11434"
+	DefaultMaxContextChars = 8000
+	DefaultTimeout         = 60 * time.Second
+)
+
+// Options configure a Synthesizer.
+type Options struct {
+	// Provider is ProviderOpenAI (any OpenAI compatible chat completions
+	// API) or ProviderOllama.
+	Provider string
+	// URL is the base URL of the API (DefaultOpenAIURL or DefaultOllamaURL
+	// when empty).
+	URL   string
+	Model string
+	// APIKey is sent as a bearer token when set.
+	APIKey string
+	// MaxContextChars bounds the characters of record text put in the prompt
+	// (DefaultMaxContextChars when zero). Lower ranked records that do not
+	// fit are left out.
+	MaxContextChars int
+	// Timeout bounds a call to the model (DefaultTimeout when zero).
+	Timeout time.Duration
+	// Client sends the requests (http.DefaultClient when nil).
+	Client *http.Client
+}
+
+// ValidateProvider reports whether provider is accepted by Options.Provider.
+func ValidateProvider(provider string) error {
+	switch strings.ToLower(strings.TrimSpace(provider)) {
+	case ProviderOpenAI, ProviderOllama:
+		return nil
+	}
+	return fmt.Errorf("unknown answer provider %q (want openai or ollama)", provider)
+}
+
+// Message is one message of a chat with the model.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// provider completes a chat with a language model.
+type provider interface {
+	complete(ctx context.Context, messages []Message) (string, error)
+}
+
+// Answer is a grounded answer to a question.
+type Answer struct {
+	Text string
+	// Citations are the ids of the records the answer cites, in the order
+	// they are first cited.
+	Citations []string
+	Model     string
+}
+
+// Synthesizer answers questions from search results with a language model.
+// It is safe for concurrent use.
+type Synthesizer struct {
+	provider   provider
+	model      string
+	maxContext int
+	timeout    time.Duration
+}
+
+// New returns a Synthesizer calling the model described by opts.
+func New(opts Options) (*Synthesizer, error) {
+	provider := strings.ToLower(strings.TrimSpace(opts.Provider))
+	if err := ValidateProvider(provider); err != nil {
+		return nil, err
+	}
+	model := strings.TrimSpace(opts.Model)
+	if model == "" {
+		return nil, fmt.Errorf("answer model is required")
+	}
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	url := strings.TrimRight(strings.TrimSpace(opts.URL), "/")
+	s := &Synthesizer{model: model, maxContext: opts.MaxContextChars, timeout: opts.Timeout}
+	if s.maxContext <= 0 {
+		s.maxContext = DefaultMaxContextChars
+	}
+	if s.timeout <= 0 {
+		s.timeout = DefaultTimeout
+	}
+	switch provider {
+	case ProviderOpenAI:
+		if url == "" {
+			url = DefaultOpenAIURL
+		}
+		s.provider = &openAI{client: client, url: url, model: model, apiKey: opts.APIKey}
+	case ProviderOllama:
+		if url == "" {
+			url = DefaultOllamaURL
+		}
+		s.provider = &ollama{client: client, url: url, model: model, apiKey: opts.APIKey}
+	}
+	return s, nil
+}
+
+// Model returns the name of the model answering the questions.
+func (s *Synthesizer) Model() string { return s.model }
+
+// Answer asks the model to answer question from results, which should be
+// ranked best first. An empty result set is answered without calling the
+// model.
+func (s *Synthesizer) Answer(ctx context.Context, question string, results []search.Result) (Answer, error) {
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return Answer{}, fmt.Errorf("question must not be empty")
+	}
+	if len(results) == 0 {
+		return Answer{Text: noSourcesAnswer, Citations: []string{}, Model: s.model}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	text, err := s.provider.complete(ctx, Prompt(question, results, s.maxContext))
+	if err != nil {
+		return Answer{}, err
+	}
+	text = strings.TrimSpace(text)
+	return Answer{Text: text, Citations: Citations(text, results), Model: s.model}, nil
+}
+
+// noSourcesAnswer is the answer when the search found nothing.
+const noSourcesAnswer = "No matching records were found to answer the question."
+
+const systemPrompt = `You answer questions using only the records provided by the user. ` +
+	`Each record starts with its id in square brackets. ` +
+	`Cite the records supporting each statement by putting their ids in square brackets, e.g. [42]. ` +
+	`If the records do not contain the answer, say so instead of guessing. ` +
+	`Answer in the language of the question.`
+
+// Prompt returns the messages asking the model to answer question from
+// results. Records are listed best first with their fields sorted by name
+// until maxChars characters of record text are used; the first record is
+// always included, truncated if need be.
+func Prompt(question string, results []search.Result, maxChars int) []Message {
+	var b strings.Builder
+	b.WriteString("Records:\n")
+	used := 0
+	for i, r := range results {
+		record := formatRecord(r)
+		n := len([]rune(record))
+		if used+n > maxChars {
+			if i > 0 {
+				break
+			}
+			record = string([]rune(record)[:maxChars])
+			n = maxChars
+		}
+		used += n
+		b.WriteString(record)
+		b.WriteString("\n")
+	}
+	b.WriteString("\nQuestion: ")
+	b.WriteString(question)
+	return []Message{
+		{Role: "system", Content: systemPrompt},
+		{Role: "user", Content: b.String()},
+	}
+}
+
+// formatRecord renders a record as "[id] field: value; field: value".
+func formatRecord(r search.Result) string {
+	names := make([]string, 0, len(r.Fields))
+	for name := range r.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		value := strings.Join(strings.Fields(r.Fields[name]), " ")
+		if value != "" {
+			parts = append(parts, name+": "+value)
+		}
+	}
+	return "[" + r.ID + "] " + strings.Join(parts, "; ")
+}
+
+// citationPattern matches a bracketed citation, which may list several ids
+// separated by commas.
+var citationPattern = regexp.MustCompile(`\[([^\[\]]+)\]`)
+
+// Citations returns the ids of results cited in text as [id] (or [id, id]),
+// in the order they are first cited. Bracketed text that is not the id of a
+// result is ignored.
+func Citations(text string, results []search.Result) []string {
+	known := make(map[string]bool, len(results))
+	for _, r := range results {
+		known[r.ID] = true
+	}
+	cited := []string{}
+	seen := make(map[string]bool)
+	for _, match := range citationPattern.FindAllStringSubmatch(text, -1) {
+		ids := []string{match[1]}
+		if !known[strings.TrimSpace(match[1])] {
+			ids = strings.Split(match[1], ",")
+		}
+		for _, id := range ids {
+			id = strings.TrimSpace(id)
+			if known[id] && !seen[id] {
+				seen[id] = true
+				cited = append(cited, id)
+			}
+		}
+	}
+	return cited
+}
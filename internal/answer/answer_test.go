@@ -0,0 +1,114 @@
+package answer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"yashubustudio/csv-search/internal/search"
+)
+
+var testResults = []search.Result{
+	{ID: "a", Fields: map[string]string{"name": "Tokyo Tower", "city": "Tokyo"}},
+	{ID: "b", Fields: map[string]string{"name": "Osaka Castle", "city": "Osaka"}},
+}
+
+func TestSynthesizerProviders(t *testing.T) {
+	cases := []struct {
+		provider string
+		path     string
+		reply    string
+	}{
+		{ProviderOpenAI, "/v1/chat/completions", `{"choices":[{"message":{"role":"assistant","content":" It is in Tokyo [a][zzz]. Not [b, a] in Osaka. "}}]}`},
+		{ProviderOllama, "/api/chat", `{"message":{"role":"assistant","content":" It is in Tokyo [a][zzz]. Not [b, a] in Osaka. "}}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.provider, func(t *testing.T) {
+			var body struct {
+				Model    string    `json:"model"`
+				Messages []Message `json:"messages"`
+				Stream   *bool     `json:"stream"`
+			}
+			var auth string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tc.path {
+					http.NotFound(w, r)
+					return
+				}
+				auth = r.Header.Get("Authorization")
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("decode request: %v", err)
+				}
+				_, _ = w.Write([]byte(tc.reply))
+			}))
+			defer srv.Close()
+
+			url := srv.URL
+			if tc.provider == ProviderOpenAI {
+				url += "/v1/"
+			}
+			synth, err := New(Options{Provider: tc.provider, URL: url, Model: "m", APIKey: "secret"})
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			got, err := synth.Answer(context.Background(), "Where is Tokyo Tower?", testResults)
+			if err != nil {
+				t.Fatalf("Answer: %v", err)
+			}
+			if got.Text != "It is in Tokyo [a][zzz]. Not [b, a] in Osaka." || strings.Join(got.Citations, ",") != "a,b" || got.Model != "m" {
+				t.Fatalf("unexpected answer %+v", got)
+			}
+			if auth != "Bearer secret" || body.Model != "m" || len(body.Messages) != 2 {
+				t.Fatalf("unexpected request: auth %q body %+v", auth, body)
+			}
+			if (tc.provider == ProviderOllama) != (body.Stream != nil && !*body.Stream) {
+				t.Fatalf("expected only ollama requests to disable streaming, got %v", body.Stream)
+			}
+			user := body.Messages[1].Content
+			if !strings.Contains(user, "[a] city: Tokyo; name: Tokyo Tower\n[b] city: Osaka; name: Osaka Castle\n") ||
+				!strings.HasSuffix(user, "Question: Where is Tokyo Tower?") {
+				t.Fatalf("unexpected prompt %q", user)
+			}
+		})
+	}
+}
+
+func TestSynthesizerErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid api key"}`, http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+	synth, err := New(Options{Provider: "OpenAI", URL: srv.URL, Model: "m"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := synth.Answer(context.Background(), "q", testResults); err == nil || !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "invalid api key") {
+		t.Fatalf("expected the status and body in the error, got %v", err)
+	}
+	// Nothing to answer from: the model is not called.
+	got, err := synth.Answer(context.Background(), "q", nil)
+	if err != nil || got.Text == "" || len(got.Citations) != 0 {
+		t.Fatalf("expected a canned answer without results, got %+v (%v)", got, err)
+	}
+
+	if _, err := New(Options{Provider: "claude", Model: "m"}); err == nil {
+		t.Fatal("expected an unknown provider to be rejected")
+	}
+	if _, err := New(Options{Provider: ProviderOllama}); err == nil {
+		t.Fatal("expected a missing model to be rejected")
+	}
+}
+
+func TestPromptBudget(t *testing.T) {
+	user := Prompt("q", testResults, 30)[1].Content
+	if !strings.Contains(user, "[a]") || strings.Contains(user, "[b]") {
+		t.Fatalf("expected only the first record within the budget, got %q", user)
+	}
+	user = Prompt("q", testResults, 5)[1].Content
+	if !strings.Contains(user, "Records:\n[a] c\n") {
+		t.Fatalf("expected the first record truncated to the budget, got %q", user)
+	}
+}
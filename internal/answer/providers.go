@@ -0,0 +1,96 @@
+package answer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxErrorBody bounds how much of an error response is quoted in errors.
+const maxErrorBody = 512
+
+// openAI calls an OpenAI compatible chat completions API.
+type openAI struct {
+	client *http.Client
+	url    string
+	model  string
+	apiKey string
+}
+
+func (p *openAI) complete(ctx context.Context, messages []Message) (string, error) {
+	var resp struct {
+		Choices []struct {
+			Message Message `json:"message"`
+		} `json:"choices"`
+	}
+	err := postJSON(ctx, p.client, p.url+"/chat/completions", p.apiKey, map[string]any{
+		"model":       p.model,
+		"messages":    messages,
+		"temperature": 0,
+	}, &resp)
+	if err != nil {
+		return "", fmt.Errorf("openai: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("openai: response has no choices")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// ollama calls the chat API of an Ollama server.
+type ollama struct {
+	client *http.Client
+	url    string
+	model  string
+	apiKey string
+}
+
+func (p *ollama) complete(ctx context.Context, messages []Message) (string, error) {
+	var resp struct {
+		Message Message `json:"message"`
+	}
+	err := postJSON(ctx, p.client, p.url+"/api/chat", p.apiKey, map[string]any{
+		"model":    p.model,
+		"messages": messages,
+		"stream":   false,
+		"options":  map[string]any{"temperature": 0},
+	}, &resp)
+	if err != nil {
+		return "", fmt.Errorf("ollama: %w", err)
+	}
+	return resp.Message.Content, nil
+}
+
+// postJSON posts body as JSON to url and decodes the response into out.
+// Responses other than 2xx are returned as errors quoting their body.
+func postJSON(ctx context.Context, client *http.Client, url, apiKey string, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
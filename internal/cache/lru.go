@@ -0,0 +1,115 @@
+// Package cache provides the in-process caches of search results.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// DefaultSize bounds an LRU created with a non-positive size.
+const DefaultSize = 1024
+
+// LRU is a size-bounded least-recently-used cache whose entries expire a
+// fixed TTL after they were stored. A nil *LRU stores nothing, so callers
+// can leave caching disabled without checks. It is safe for concurrent use.
+type LRU[V any] struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+type entry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+// New returns an LRU holding at most size entries (DefaultSize when not
+// positive) for ttl each. It returns nil, a disabled cache, when ttl is not
+// positive.
+func New[V any](ttl time.Duration, size int) *LRU[V] {
+	if ttl <= 0 {
+		return nil
+	}
+	if size <= 0 {
+		size = DefaultSize
+	}
+	return &LRU[V]{ttl: ttl, size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// TTL returns how long entries are kept (zero for a disabled cache).
+func (c *LRU[V]) TTL() time.Duration {
+	if c == nil {
+		return 0
+	}
+	return c.ttl
+}
+
+// Get returns the live entry stored under key and marks it recently used.
+func (c *LRU[V]) Get(key string) (V, bool) {
+	var zero V
+	if c == nil {
+		return zero, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return zero, false
+	}
+	e := elem.Value.(*entry[V])
+	if time.Now().After(e.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return zero, false
+	}
+	c.order.MoveToFront(elem)
+	return e.value, true
+}
+
+// Put stores value under key, evicting the least recently used entries
+// beyond the size bound.
+func (c *LRU[V]) Put(key string, value V) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := &entry[V]{key: key, value: value, expires: time.Now().Add(c.ttl)}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = e
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(e)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry[V]).key)
+	}
+}
+
+// Len returns the number of stored entries, including expired ones not yet
+// dropped.
+func (c *LRU[V]) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Purge drops every entry.
+func (c *LRU[V]) Purge() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+}
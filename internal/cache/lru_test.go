@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	c := New[int](time.Hour, 2)
+	c.Put("a", 1)
+	c.Put("b", 2)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get(a) = %d, %v", v, ok)
+	}
+	// "b" is now the least recently used entry.
+	c.Put("c", 3)
+	if _, ok := c.Get("b"); ok {
+		t.Fatalf("expected b to be evicted")
+	}
+	if v, ok := c.Get("c"); !ok || v != 3 {
+		t.Fatalf("Get(c) = %d, %v", v, ok)
+	}
+	c.Put("a", 4)
+	if v, _ := c.Get("a"); v != 4 || c.Len() != 2 {
+		t.Fatalf("expected a to be replaced in place, got %d with %d entries", v, c.Len())
+	}
+	c.Purge()
+	if _, ok := c.Get("a"); ok || c.Len() != 0 {
+		t.Fatalf("expected an empty cache after Purge")
+	}
+}
+
+func TestLRUExpiry(t *testing.T) {
+	c := New[string](time.Millisecond, 0)
+	c.Put("k", "v")
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := c.Get("k"); ok {
+		t.Fatalf("expected the entry to expire")
+	}
+	if c.Len() != 0 {
+		t.Fatalf("expected the expired entry to be dropped")
+	}
+}
+
+func TestDisabledLRU(t *testing.T) {
+	c := New[int](0, 10)
+	if c != nil {
+		t.Fatalf("expected a nil cache without a TTL")
+	}
+	c.Put("a", 1)
+	if _, ok := c.Get("a"); ok || c.TTL() != 0 || c.Len() != 0 {
+		t.Fatalf("a disabled cache must not store anything")
+	}
+	c.Purge()
+}
@@ -1,11 +1,16 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+
+	"yashubustudio/csv-search/internal/search"
 )
 
 // Config represents application level settings loaded from a JSON file.
@@ -15,8 +20,24 @@ type Config struct {
 	DefaultDataset string                   `json:"default_dataset"`
 	Datasets       map[string]DatasetConfig `json:"datasets"`
 	Search         SearchConfig             `json:"search"`
+	QueryLog       QueryLogConfig           `json:"query_log"`
+	Answer         AnswerConfig             `json:"answer"`
+	// Tenants host several customers in one serve process (see
+	// TenantConfig). When set, every search request must identify its
+	// tenant.
+	Tenants map[string]TenantConfig `json:"tenants"`
+	// Webhooks are notified of the records inserted, updated and deleted
+	// (see WebhookConfig).
+	Webhooks []WebhookConfig `json:"webhooks"`
 
 	baseDir string
+	files   []string
+	// secrets are the field paths of values read from secret references
+	// (see Redacted).
+	secrets []string
+	// dictionaries are the stopword and term boost files of the datasets,
+	// read by Load.
+	dictionaries map[string]Dictionaries
 }
 
 // DatabaseConfig controls the SQLite database target.
@@ -30,11 +51,41 @@ type EmbeddingConfig struct {
 	Model     string `json:"model"`
 	Tokenizer string `json:"tokenizer"`
 	MaxSeqLen int    `json:"max_seq_len"`
+	// SparseHead points to the bge-m3 sparse_linear weights exported as JSON.
+	SparseHead string `json:"sparse_head"`
+	// Truncation selects how over-length inputs are cut: "head", "tail" or
+	// "middle". Empty keeps the first max_seq_len tokens.
+	Truncation string `json:"truncation"`
+	// Normalize lists text normalization steps ("nfkc", "width", "space")
+	// applied before both ingest-time and query-time encoding.
+	Normalize []string `json:"normalize"`
+	// ModelVersion is stored with every embedding (default: the model file
+	// name) so that re-embedding can skip vectors from the current model.
+	ModelVersion string `json:"model_version"`
+	// Models registers further encoders by name, which searches can encode
+	// their query with instead of the one above, e.g. to compare a new model
+	// on a dataset embedded with it before switching over.
+	Models map[string]ModelConfig `json:"models"`
+}
+
+// ModelConfig describes a named encoder of EmbeddingConfig.Models. Empty
+// fields inherit the embedding settings, except that a model of its own
+// defaults its model_version to its file name.
+type ModelConfig struct {
+	Model        string   `json:"model"`
+	Tokenizer    string   `json:"tokenizer"`
+	MaxSeqLen    int      `json:"max_seq_len"`
+	SparseHead   string   `json:"sparse_head"`
+	Truncation   string   `json:"truncation"`
+	Normalize    []string `json:"normalize"`
+	ModelVersion string   `json:"model_version"`
 }
 
 // DatasetConfig configures ingestion defaults for a named dataset/table.
 type DatasetConfig struct {
-	Table       string   `json:"table"`
+	Table string `json:"table"`
+	// CSV is the file ingested for the dataset, or an http(s) URL it is
+	// downloaded from.
 	CSV         string   `json:"csv"`
 	BatchSize   int      `json:"batch_size"`
 	IDColumn    string   `json:"id_column"`
@@ -42,41 +93,297 @@ type DatasetConfig struct {
 	MetaColumns []string `json:"meta_columns"`
 	LatColumn   string   `json:"lat_column"`
 	LngColumn   string   `json:"lng_column"`
+	Sparse      bool     `json:"sparse"`
+	// Duplicates is the policy for IDs repeated within the CSV: "last"
+	// (default), "first" or "error".
+	Duplicates string `json:"duplicates"`
+	// IndexFields lists metadata fields that get an SQLite expression index
+	// so that filters on them do not scan the whole dataset.
+	IndexFields []string `json:"index_fields"`
+	// Search overrides the global search settings for this dataset; unset
+	// (zero) fields inherit them.
+	Search SearchConfig `json:"search"`
+	// Stopwords is a file of words dropped from keyword queries before
+	// full-text matching (see search.ParseStopwords).
+	Stopwords string `json:"stopwords"`
+	// TermBoosts is a file of terms and factors that multiply the scores of
+	// vector and hybrid searches whose query and record both contain the term
+	// (see search.ParseTermBoosts).
+	TermBoosts string `json:"term_boosts"`
+	// Languages tune the searches of the queries detected as Japanese ("ja")
+	// or English ("en"), for datasets that mix both: a query prefix for the
+	// encoder, a sparse weight and the FTS tokenizer of keyword searches.
+	Languages map[string]search.Language `json:"languages"`
+	// Schedule re-ingests CSV while the server runs, as a cron expression
+	// (see schedule.Parse), e.g. "0 3 * * *" or "@every 30m".
+	Schedule string `json:"schedule"`
+	// Cache gives the dataset a search response cache of its own in the
+	// HTTP server instead of the global one (serve --cache-ttl).
+	Cache *CacheConfig `json:"cache"`
+}
+
+// CacheConfig configures the response cache of a dataset. It is purged
+// whenever records of the dataset are written by the serving process.
+type CacheConfig struct {
+	// TTLSeconds is how long responses are kept; zero keeps the dataset out
+	// of every cache, for datasets that change too often.
+	TTLSeconds int `json:"ttl_seconds"`
+	// MaxEntries bounds the cached responses (1024 when zero).
+	MaxEntries int `json:"max_entries"`
+	// BypassHeader names a request header that, when present, makes the
+	// search skip the cached response and store a fresh one.
+	BypassHeader string `json:"bypass_header"`
+}
+
+// Dictionaries are the parsed stopword and term boost files of a dataset,
+// with lower case keys.
+type Dictionaries struct {
+	Stopwords  map[string]bool
+	TermBoosts map[string]float64
 }
 
 // SearchConfig covers defaults for query behaviour.
 type SearchConfig struct {
 	DefaultTopK int `json:"default_topk"`
+	// SparseWeight is the hybrid alpha: the weight of the bge-m3 lexical
+	// score added to the dense similarity. Negative disables hybrid scoring.
+	SparseWeight float64 `json:"sparse_weight"`
+	// Metric is "cosine" (default), "dot" or "euclidean".
+	Metric string `json:"metric"`
+	// MinScore drops results scoring below it; zero keeps every result.
+	MinScore float64 `json:"min_score"`
+	// ScorePrecision rounds reported scores to that many decimal places;
+	// zero leaves them unrounded.
+	ScorePrecision int `json:"score_precision"`
+	// ScoreNormalization rescales the scores of every result set: "raw"
+	// (default), "minmax" or "softmax".
+	ScoreNormalization string `json:"score_normalization"`
+	// StrictFilters rejects filters on fields that no record of the dataset
+	// has, listing the valid ones, instead of returning no results. A
+	// dataset can turn it on but not off.
+	StrictFilters bool `json:"strict_filters"`
+	// FieldBoosts add weight times the share of the query terms found in a
+	// field to the score of vector searches, e.g. as fitted from feedback by
+	// the tune command. A dataset's boosts replace the global ones.
+	FieldBoosts map[string]float64 `json:"field_boosts"`
+}
+
+// Override returns s with the set (non-zero) fields of o applied.
+func (s SearchConfig) Override(o SearchConfig) SearchConfig {
+	if o.DefaultTopK > 0 {
+		s.DefaultTopK = o.DefaultTopK
+	}
+	if o.SparseWeight != 0 {
+		s.SparseWeight = o.SparseWeight
+	}
+	if o.Metric != "" {
+		s.Metric = o.Metric
+	}
+	if o.MinScore != 0 {
+		s.MinScore = o.MinScore
+	}
+	if o.ScorePrecision != 0 {
+		s.ScorePrecision = o.ScorePrecision
+	}
+	if o.ScoreNormalization != "" {
+		s.ScoreNormalization = o.ScoreNormalization
+	}
+	if o.StrictFilters {
+		s.StrictFilters = true
+	}
+	if len(o.FieldBoosts) > 0 {
+		s.FieldBoosts = o.FieldBoosts
+	}
+	return s
 }
 
-// Load reads a JSON configuration file from disk and validates its structure.
+// SearchFor returns the search settings of a dataset: the global settings
+// overridden by the dataset's own.
+func (cfg *Config) SearchFor(dataset DatasetConfig) SearchConfig {
+	if cfg == nil {
+		return dataset.Search
+	}
+	return cfg.Search.Override(dataset.Search)
+}
+
+// QueryLogConfig enables recording searches in the query_log table.
+type QueryLogConfig struct {
+	Enabled bool `json:"enabled"`
+	// RetentionDays prunes older entries; zero keeps them forever.
+	RetentionDays int `json:"retention_days"`
+}
+
+// AnswerConfig enables the /answer endpoint, which has a language model
+// answer questions from the top search results.
+type AnswerConfig struct {
+	// Provider is "openai" (any OpenAI compatible API) or "ollama"; empty
+	// disables answering.
+	Provider string `json:"provider"`
+	// URL is the base URL of the API (the provider's default when empty).
+	URL   string `json:"url"`
+	Model string `json:"model"`
+	// APIKey is sent as a bearer token; prefer an env: or file: reference.
+	APIKey string `json:"api_key"`
+	// TopK is the number of search results given to the model (default 5).
+	TopK int `json:"topk"`
+	// MaxContextChars bounds the record text in the prompt (default 8000).
+	MaxContextChars int `json:"max_context_chars"`
+	// TimeoutSeconds bounds a call to the model (default 60).
+	TimeoutSeconds int `json:"timeout_seconds"`
+}
+
+// TenantConfig confines the requests of one customer to its own datasets.
+// A request is attributed to the tenant whose APIKeys contains its X-API-Key
+// header or bearer token; tenants without keys are selected by the X-Tenant
+// header, for servers behind a gateway that authenticates the customers.
+type TenantConfig struct {
+	// APIKeys identify the tenant; prefer env: or file: references.
+	APIKeys []string `json:"api_keys"`
+	// Datasets are the configured datasets the tenant may search.
+	Datasets []string `json:"datasets"`
+	// DefaultDataset is searched when a request names none (the first of
+	// Datasets when empty).
+	DefaultDataset string `json:"default_dataset"`
+	// DefaultTopK replaces the dataset's default topK; MaxTopK caps the topK
+	// of every request (unlimited when zero).
+	DefaultTopK int `json:"default_topk"`
+	MaxTopK     int `json:"max_topk"`
+	// RequestsPerSecond and Burst are the tenant's request quota (unlimited
+	// when zero), shared by all of its keys.
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	Burst             int     `json:"burst"`
+}
+
+// WebhookConfig posts every change to the records of the datasets to URL as
+// JSON, so that downstream caches and indexes can follow incrementally.
+type WebhookConfig struct {
+	URL string `json:"url"`
+	// Datasets limits the notifications to these datasets (all when empty).
+	Datasets []string `json:"datasets"`
+	// Types limits the notifications to these change types: "inserted",
+	// "updated", "deleted" and "reset" (all when empty).
+	Types []string `json:"types"`
+	// Secret signs the body with HMAC-SHA256 in the X-CSV-Search-Signature
+	// header; prefer an env: or file: reference.
+	Secret string `json:"secret"`
+	// TimeoutSeconds bounds a delivery attempt (default 10).
+	TimeoutSeconds int `json:"timeout_seconds"`
+}
+
+// Load reads a JSON configuration file from disk and validates its structure
+// and values (see Validate).
+// ${VAR} and ${VAR:-default} inside string values are replaced with
+// environment variables, and values of the form "env:NAME" or "file:path" are
+// resolved to the secret they reference, before decoding. A top-level
+// "include" (a path or a list of paths) merges other files underneath this
+// one (see loadDocument); relative paths in all of them resolve against the
+// directory of path.
 func Load(path string) (*Config, error) {
-	file, err := os.Open(path)
+	var state loadState
+	doc, err := loadDocument(path, nil, &state)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(doc)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	decoder := json.NewDecoder(file)
+	decoder := json.NewDecoder(bytes.NewReader(data))
 	decoder.DisallowUnknownFields()
 
 	var cfg Config
 	if err := decoder.Decode(&cfg); err != nil {
-		if err == io.EOF {
-			return &cfg, nil
-		}
 		return nil, fmt.Errorf("decode config: %w", err)
 	}
 
-	// Ensure there is no trailing data in the config file.
-	if err := ensureEOF(decoder); err != nil {
+	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
 
 	cfg.baseDir = filepath.Dir(path)
+	cfg.files = state.files
+	cfg.secrets = state.secrets
+	if err := cfg.loadDictionaries(); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
 
+// loadDictionaries reads the stopword and term boost files of the datasets.
+func (cfg *Config) loadDictionaries() error {
+	for name, ds := range cfg.Datasets {
+		var dicts Dictionaries
+		if path := strings.TrimSpace(ds.Stopwords); path != "" {
+			words, err := readDictionary(cfg.ResolvePath(path), search.ParseStopwords)
+			if err != nil {
+				return fmt.Errorf("datasets.%s.stopwords: %w", name, err)
+			}
+			dicts.Stopwords = words
+		}
+		if path := strings.TrimSpace(ds.TermBoosts); path != "" {
+			boosts, err := readDictionary(cfg.ResolvePath(path), search.ParseTermBoosts)
+			if err != nil {
+				return fmt.Errorf("datasets.%s.term_boosts: %w", name, err)
+			}
+			dicts.TermBoosts = boosts
+		}
+		if dicts.Stopwords == nil && dicts.TermBoosts == nil {
+			continue
+		}
+		if cfg.dictionaries == nil {
+			cfg.dictionaries = make(map[string]Dictionaries)
+		}
+		cfg.dictionaries[name] = dicts
+	}
+	return nil
+}
+
+func readDictionary[T any](path string, parse func(io.Reader) (T, error)) (T, error) {
+	var zero T
+	file, err := os.Open(path)
+	if err != nil {
+		return zero, err
+	}
+	defer file.Close()
+	dict, err := parse(file)
+	if err != nil {
+		return zero, fmt.Errorf("%s: %w", path, err)
+	}
+	return dict, nil
+}
+
+// DictionariesFor returns the stopwords and term boosts of the named dataset.
+func (cfg *Config) DictionariesFor(name string) Dictionaries {
+	if cfg == nil {
+		return Dictionaries{}
+	}
+	return cfg.dictionaries[name]
+}
+
+// DictionaryFiles lists the stopword and term boost files of the datasets,
+// e.g. for watching them for changes.
+func (cfg *Config) DictionaryFiles() []string {
+	if cfg == nil {
+		return nil
+	}
+	names := make([]string, 0, len(cfg.Datasets))
+	for name := range cfg.Datasets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var files []string
+	for _, name := range names {
+		ds := cfg.Datasets[name]
+		for _, path := range []string{ds.Stopwords, ds.TermBoosts} {
+			if path = strings.TrimSpace(path); path != "" {
+				files = append(files, cfg.ResolvePath(path))
+			}
+		}
+	}
+	return files
+}
+
 // Dataset retrieves the dataset configuration by name.
 func (cfg *Config) Dataset(name string) (DatasetConfig, bool) {
 	if cfg == nil {
@@ -86,6 +393,15 @@ func (cfg *Config) Dataset(name string) (DatasetConfig, bool) {
 	return ds, ok
 }
 
+// Files lists the configuration file and the files it includes, in the order
+// they were read.
+func (cfg *Config) Files() []string {
+	if cfg == nil {
+		return nil
+	}
+	return cfg.files
+}
+
 // ResolvePath converts a potentially relative path into an absolute one using
 // the config file's directory as the base.
 func (cfg *Config) ResolvePath(value string) string {
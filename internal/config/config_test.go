@@ -0,0 +1,302 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLoadExpandsEnv(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "csv-search_config.json")
+	body := `{
+  "database": {"path": "${CSVSEARCH_TEST_DATA}/app.db"},
+  "embedding": {"model": "${CSVSEARCH_TEST_MODELS:-models}/model.onnx", "tokenizer": "$${literal}", "max_seq_len": 512},
+  "datasets": {"docs": {"table": "docs", "text_columns": ["${CSVSEARCH_TEST_COLUMN}"]}}
+}`
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	t.Setenv("CSVSEARCH_TEST_DATA", `C:\data "shared"`)
+	t.Setenv("CSVSEARCH_TEST_COLUMN", "title")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Database.Path != `C:\data "shared"/app.db` {
+		t.Fatalf("database.path = %q", cfg.Database.Path)
+	}
+	if cfg.Embedding.Model != "models/model.onnx" || cfg.Embedding.Tokenizer != "${literal}" || cfg.Embedding.MaxSeqLen != 512 {
+		t.Fatalf("unexpected embedding config: %+v", cfg.Embedding)
+	}
+	if cols := cfg.Datasets["docs"].TextColumns; len(cols) != 1 || cols[0] != "title" {
+		t.Fatalf("text_columns = %v", cols)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"database": {"path": "${CSVSEARCH_TEST_UNSET}"}}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "database.path") || !strings.Contains(err.Error(), "CSVSEARCH_TEST_UNSET") {
+		t.Fatalf("expected an unset variable error naming the setting, got %v", err)
+	}
+}
+
+func TestLoadResolvesSecretReferences(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "model_path"), []byte("/opt/models/model.onnx\n"), 0o600); err != nil {
+		t.Fatalf("write secret: %v", err)
+	}
+	path := filepath.Join(dir, "csv-search_config.json")
+	body := `{"database": {"path": "env:CSVSEARCH_TEST_DB"}, "embedding": {"model": "file:model_path", "tokenizer": "models/env:tokenizer.json"}}`
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	t.Setenv("CSVSEARCH_TEST_DB", "/var/lib/csv-search/app.db")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Database.Path != "/var/lib/csv-search/app.db" || cfg.Embedding.Model != "/opt/models/model.onnx" {
+		t.Fatalf("secrets not resolved: %+v %+v", cfg.Database, cfg.Embedding)
+	}
+	// Only whole values are references.
+	if cfg.Embedding.Tokenizer != "models/env:tokenizer.json" {
+		t.Fatalf("tokenizer = %q", cfg.Embedding.Tokenizer)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"embedding": {"model": "file:missing"}}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "embedding.model") {
+		t.Fatalf("expected a missing secret file error naming the setting, got %v", err)
+	}
+}
+
+func TestRedactedHidesSecrets(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "csv-search_config.json")
+	body := `{
+  "database": {"path": "env:CSVSEARCH_TEST_DB"},
+  "datasets": {"docs": {"table": "docs", "text_columns": ["title"]}},
+  "answer": {"provider": "openai", "model": "gpt", "api_key": "sk-literal"},
+  "tenants": {"acme": {"api_keys": ["key-1", "${CSVSEARCH_TEST_KEY}"], "datasets": ["docs"]}},
+  "webhooks": [{"url": "https://hooks.example.com/${CSVSEARCH_TEST_HOOK}", "secret": "whsec"}]
+}`
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	t.Setenv("CSVSEARCH_TEST_DB", "/var/lib/csv-search/app.db")
+	t.Setenv("CSVSEARCH_TEST_KEY", "key-2")
+	t.Setenv("CSVSEARCH_TEST_HOOK", "docs")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	doc, err := cfg.Redacted()
+	if err != nil {
+		t.Fatalf("Redacted: %v", err)
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	for _, secret := range []string{"sk-literal", "key-1", "key-2", "whsec", "/var/lib"} {
+		if strings.Contains(string(data), secret) {
+			t.Fatalf("Redacted leaks %q: %s", secret, data)
+		}
+	}
+	// Settings that are not secrets keep their expanded values.
+	if !strings.Contains(string(data), "https://hooks.example.com/docs") {
+		t.Fatalf("expected the webhook URL to stay visible: %s", data)
+	}
+	keys := doc["tenants"].(map[string]any)["acme"].(map[string]any)["api_keys"].([]any)
+	if len(keys) != 2 || keys[0] != RedactedValue || keys[1] != RedactedValue {
+		t.Fatalf("api_keys = %v", keys)
+	}
+	sort.Strings(cfg.secrets)
+	if want := []string{"database.path", "tenants.acme.api_keys[1]"}; strings.Join(cfg.secrets, ",") != strings.Join(want, ",") {
+		t.Fatalf("secrets = %v, want %v", cfg.secrets, want)
+	}
+}
+
+func TestLoadMergesIncludes(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return path
+	}
+	write("shared/embedding.json", `{
+  "embedding": {"model": "models/model.onnx", "tokenizer": "models/tokenizer.json", "max_seq_len": 512, "normalize": ["nfkc", "space"]},
+  "search": {"default_topk": 5}
+}`)
+	write("datasets.prod.json", `{"datasets": {"docs": {"csv": "csv/docs.csv", "text_columns": ["title", "body"]}}}`)
+	path := write("csv-search_config.json", `{
+  "include": ["shared/embedding.json", "datasets.${CSVSEARCH_TEST_ENV}.json"],
+  "embedding": {"max_seq_len": 1024, "normalize": ["width"]},
+  "datasets": {"docs": {"text_columns": ["title"]}}
+}`)
+	t.Setenv("CSVSEARCH_TEST_ENV", "prod")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	// Objects merge key by key; values and arrays of the including file win.
+	if cfg.Embedding.Model != "models/model.onnx" || cfg.Embedding.MaxSeqLen != 1024 || len(cfg.Embedding.Normalize) != 1 || cfg.Embedding.Normalize[0] != "width" {
+		t.Fatalf("unexpected embedding: %+v", cfg.Embedding)
+	}
+	docs := cfg.Datasets["docs"]
+	if docs.CSV != "csv/docs.csv" || len(docs.TextColumns) != 1 || cfg.Search.DefaultTopK != 5 {
+		t.Fatalf("unexpected datasets/search: %+v %+v", cfg.Datasets, cfg.Search)
+	}
+	// Relative paths resolve against the including file.
+	if got := cfg.ResolvePath(cfg.Embedding.Model); got != filepath.Join(dir, "models", "model.onnx") {
+		t.Fatalf("ResolvePath = %q", got)
+	}
+	if files := cfg.Files(); len(files) != 3 || files[0] != path {
+		t.Fatalf("Files = %v", files)
+	}
+
+	write("a.json", `{"include": "b.json"}`)
+	write("b.json", `{"include": ["a.json"]}`)
+	if _, err := Load(filepath.Join(dir, "a.json")); err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Fatalf("expected an include cycle error, got %v", err)
+	}
+	write("missing.json", `{"include": "nope.json"}`)
+	if _, err := Load(filepath.Join(dir, "missing.json")); err == nil || os.IsNotExist(err) {
+		t.Fatalf("a missing include must not look like a missing config file, got %v", err)
+	}
+}
+
+func TestLoadValidatesStructure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "csv-search_config.json")
+	body := `{
+  "default_dataset": "missing",
+  "embedding": {"truncation": "left", "models": {"next": {"tokenizer": "next/tokenizer.json", "max_seq_len": -1}}},
+  "datasets": {
+    "docs": {"batch_size": -1, "text_columns": ["title", " "], "lat_column": "lat", "csv": "docs.csv", "schedule": "0 25 * * *", "search": {"metric": "manhattan"}, "cache": {"ttl_seconds": -5, "bypass_header": "X No Cache"}},
+    "faq": {"table": "faq", "schedule": "@daily", "languages": {"fr": {}, "ja": {"fts_tokenizer": "mecab"}}}
+  },
+  "search": {"default_topk": -3, "score_normalization": "zscore"},
+  "answer": {"provider": "gpt", "topk": -1},
+  "tenants": {
+    "acme": {"api_keys": ["k1"], "datasets": ["docs"], "default_dataset": "faq", "max_topk": 5, "default_topk": 10},
+    "globex": {"api_keys": ["k1", " "], "datasets": ["wiki"], "requests_per_second": -1}
+  },
+  "webhooks": [
+    {"url": "https://hooks.example.com/csv", "datasets": ["docs"], "types": ["deleted"]},
+    {"url": "hooks.example.com", "datasets": ["wiki"], "types": ["created"], "timeout_seconds": -1}
+  ]
+}`
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	_, err := Load(path)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Load error = %v, want *ValidationError", err)
+	}
+	want := []string{
+		"embedding.truncation:",
+		"embedding.models.next.model: required",
+		"embedding.models.next.max_seq_len: must not be negative",
+		"default_dataset: unknown dataset \"missing\" (configured: docs, faq)",
+		"datasets.docs.batch_size: must not be negative",
+		"datasets.docs.text_columns[1]:",
+		"datasets.docs.lng_column: required when lat_column is set",
+		"datasets.docs.schedule: parse \"0 25 * * *\": hour:",
+		"datasets.docs.search.metric:",
+		"datasets.docs.cache.ttl_seconds: must not be negative",
+		"datasets.docs.cache.bypass_header: invalid header name \"X No Cache\"",
+		"datasets.faq.csv: required when schedule is set",
+		"datasets.faq.languages.fr: unknown language",
+		"datasets.faq.languages.ja.fts_tokenizer: unknown FTS tokenizer",
+		"search.default_topk: must not be negative",
+		"search.score_normalization: unknown score normalization \"zscore\"",
+		"answer.provider: unknown answer provider \"gpt\"",
+		"answer.model: required when answer.provider is set",
+		"answer.topk: must not be negative",
+		"tenants.acme.default_dataset: \"faq\" is not one of the tenant's datasets",
+		"tenants.acme.default_topk: exceeds max_topk 5",
+		"tenants.globex.api_keys[0]: key is also used by tenant \"acme\"",
+		"tenants.globex.api_keys[1]: must not be empty",
+		"tenants.globex.datasets[0]: unknown dataset \"wiki\"",
+		"tenants.globex.requests_per_second: must not be negative",
+		"webhooks[1].url: must be an http(s) URL",
+		"webhooks[1].datasets[0]: unknown dataset \"wiki\"",
+		"webhooks[1].types[0]: unknown change type \"created\"",
+		"webhooks[1].timeout_seconds: must not be negative",
+	}
+	if len(verr.Problems) != len(want) {
+		t.Fatalf("problems = %q", verr.Problems)
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(verr.Problems[i], prefix) {
+			t.Fatalf("problem %d = %q, want prefix %q", i, verr.Problems[i], prefix)
+		}
+	}
+}
+
+func TestLoadDictionaries(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "dict"), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "dict", "stop.txt"), []byte("\ufeff# articles\nThe\n\nof a\n"), 0o600); err != nil {
+		t.Fatalf("write stopwords: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "dict", "boost.txt"), []byte("Organic 1.5\n"), 0o600); err != nil {
+		t.Fatalf("write term boosts: %v", err)
+	}
+	path := filepath.Join(dir, "csv-search_config.json")
+	if err := os.WriteFile(path, []byte(`{"datasets": {
+  "docs": {"stopwords": "dict/stop.txt", "term_boosts": "dict/boost.txt"},
+  "faq": {}
+}}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	docs := cfg.DictionariesFor("docs")
+	if len(docs.Stopwords) != 3 || !docs.Stopwords["the"] || !docs.Stopwords["of"] || !docs.Stopwords["a"] {
+		t.Fatalf("unexpected stopwords %v", docs.Stopwords)
+	}
+	if len(docs.TermBoosts) != 1 || docs.TermBoosts["organic"] != 1.5 {
+		t.Fatalf("unexpected term boosts %v", docs.TermBoosts)
+	}
+	if faq := cfg.DictionariesFor("faq"); faq.Stopwords != nil || faq.TermBoosts != nil {
+		t.Fatalf("expected no dictionaries for faq, got %+v", faq)
+	}
+	if files := cfg.DictionaryFiles(); len(files) != 2 || files[0] != filepath.Join(dir, "dict", "stop.txt") {
+		t.Fatalf("unexpected dictionary files %v", files)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "dict", "boost.txt"), []byte("organic\n"), 0o600); err != nil {
+		t.Fatalf("write term boosts: %v", err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "datasets.docs.term_boosts") || !strings.Contains(err.Error(), "line 1") {
+		t.Fatalf("expected a term boost error naming the setting and line, got %v", err)
+	}
+	if err := os.Remove(filepath.Join(dir, "dict", "stop.txt")); err != nil {
+		t.Fatalf("remove stopwords: %v", err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "datasets.docs.stopwords") {
+		t.Fatalf("expected a missing stopword file to fail, got %v", err)
+	}
+}
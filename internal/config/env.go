@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// expander resolves environment and secret references in the string values
+// of a configuration document (see Load).
+type expander struct {
+	lookup func(string) (string, bool)
+	// baseDir anchors relative file: references.
+	baseDir string
+	// secrets, when set, receives the paths of resolved secret references
+	// and of ${VAR} references expanded inside the secretFields.
+	secrets *[]string
+}
+
+// value replaces ${VAR} and ${VAR:-default} references inside the string
+// values of a decoded JSON document with environment variables, then
+// resolves values of the form "env:NAME" and "file:path" to the variable or
+// the trimmed file contents. Maps and slices are updated in place. Keys,
+// numbers and booleans are left alone, and "$${" produces a literal "${".
+// Referencing an unset variable without a default is an error so that a
+// missing secret is not silently replaced by an empty string.
+func (e expander) value(value any, path string) (any, error) {
+	switch v := value.(type) {
+	case string:
+		out, err := expandString(v, e.lookup)
+		secret := err == nil && out != v && isSecretField(splitPath(strings.TrimPrefix(path, ".")))
+		if err == nil && isSecretReference(out) {
+			out, err = e.secret(out)
+			secret = err == nil
+		}
+		if secret && e.secrets != nil {
+			*e.secrets = append(*e.secrets, strings.TrimPrefix(path, "."))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("config %s: %w", strings.TrimPrefix(path, "."), err)
+		}
+		return out, nil
+	case map[string]any:
+		for key, item := range v {
+			expanded, err := e.value(item, path+"."+key)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = expanded
+		}
+	case []any:
+		for i, item := range v {
+			expanded, err := e.value(item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded
+		}
+	}
+	return value, nil
+}
+
+// Secret reference prefixes. A whole string value "env:NAME" is replaced by
+// the variable, "file:path" by the file contents without surrounding
+// whitespace (relative paths start at the config file's directory).
+const (
+	envPrefix  = "env:"
+	filePrefix = "file:"
+)
+
+func isSecretReference(s string) bool {
+	return strings.HasPrefix(s, envPrefix) || strings.HasPrefix(s, filePrefix)
+}
+
+func (e expander) secret(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, envPrefix):
+		name := strings.TrimSpace(strings.TrimPrefix(s, envPrefix))
+		val, ok := e.lookup(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return val, nil
+	case strings.HasPrefix(s, filePrefix):
+		path := strings.TrimSpace(strings.TrimPrefix(s, filePrefix))
+		if path == "" {
+			return "", fmt.Errorf("file: reference without a path")
+		}
+		if !filepath.IsAbs(path) && e.baseDir != "" {
+			path = filepath.Join(e.baseDir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("read secret: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return s, nil
+}
+
+func expandString(s string, lookup func(string) (string, bool)) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i])
+			b.WriteString("{")
+			s = s[i+2:]
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated ${ in %q", s)
+		}
+		b.WriteString(s[:i])
+		ref := s[i+2 : i+end]
+		name, fallback, hasDefault := strings.Cut(ref, ":-")
+		if name == "" {
+			return "", fmt.Errorf("empty variable name in ${%s}", ref)
+		}
+		if val, ok := lookup(name); ok && (val != "" || !hasDefault) {
+			b.WriteString(val)
+		} else if hasDefault {
+			b.WriteString(fallback)
+		} else {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		s = s[i+end+1:]
+	}
+}
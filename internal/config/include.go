@@ -0,0 +1,128 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// includeKey names the top-level list of files a configuration file builds
+// upon.
+const includeKey = "include"
+
+// loadState collects what loadDocument learns while reading a configuration.
+type loadState struct {
+	// files lists every file read, in order.
+	files []string
+	// secrets lists the field paths resolved from env: or file: references.
+	secrets []string
+}
+
+// loadDocument reads path as a JSON object, expands its references and merges
+// it over its includes. Included files are loaded in order, each over the
+// previous ones, and the including file is applied last: objects are merged
+// key by key, while arrays and other values replace what came before.
+// Relative include paths start at the including file's directory. stack
+// holds the files being loaded to detect cycles; state collects the files
+// read and the secret references resolved.
+func loadDocument(path string, stack []string, state *loadState) (map[string]any, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for i, seen := range stack {
+		if seen == abs {
+			return nil, fmt.Errorf("include cycle: %s", strings.Join(append(stack[i:], abs), " -> "))
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state.files = append(state.files, path)
+	doc, err := decodeDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := (expander{lookup: os.LookupEnv, baseDir: filepath.Dir(path), secrets: &state.secrets}).value(doc, ""); err != nil {
+		return nil, err
+	}
+
+	includes, err := includeList(doc[includeKey])
+	if err != nil {
+		return nil, err
+	}
+	delete(doc, includeKey)
+	merged := make(map[string]any)
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		included, err := loadDocument(include, append(stack, abs), state)
+		if err != nil {
+			return nil, fmt.Errorf("include %s: %w", include, err)
+		}
+		mergeDocuments(merged, included)
+	}
+	mergeDocuments(merged, doc)
+	return merged, nil
+}
+
+// decodeDocument parses a configuration file into a generic object. An empty
+// file is an empty object.
+func decodeDocument(data []byte) (map[string]any, error) {
+	doc := make(map[string]any)
+	if len(bytes.TrimSpace(data)) == 0 {
+		return doc, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("decode config: %w", err)
+	}
+	if err := ensureEOF(decoder); err != nil {
+		return nil, err
+	}
+	obj, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("decode config: top-level value must be an object")
+	}
+	return obj, nil
+}
+
+func includeList(value any) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok || strings.TrimSpace(s) == "" {
+				return nil, fmt.Errorf("config include: entries must be file paths")
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("config include: want a file path or a list of file paths")
+}
+
+// mergeDocuments applies src over dst in place.
+func mergeDocuments(dst, src map[string]any) {
+	for key, value := range src {
+		if srcObj, ok := value.(map[string]any); ok {
+			if dstObj, ok := dst[key].(map[string]any); ok {
+				mergeDocuments(dstObj, srcObj)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
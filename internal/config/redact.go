@@ -0,0 +1,171 @@
+package config
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// RedactedValue replaces secret values in Redacted.
+const RedactedValue = "[redacted]"
+
+// secretFields are the settings that hold credentials, as paths of object
+// keys in which "*" stands for any key and "[*" for any array index. Their
+// values are redacted however they are written.
+var secretFields = [][]string{
+	{"answer", "api_key"},
+	{"tenants", "*", "api_keys"},
+	{"webhooks", "[*", "secret"},
+}
+
+// isSecretField reports whether path, as produced by splitPath, is or lies
+// inside one of the secretFields.
+func isSecretField(path []string) bool {
+	for _, field := range secretFields {
+		if len(path) < len(field) {
+			continue
+		}
+		match := true
+		for i, key := range field {
+			if key == "*" || (key == "[*" && strings.HasPrefix(path[i], "[")) {
+				continue
+			}
+			if key != path[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns cfg as a generic JSON object in which the secretFields and
+// the values read from env: or file: secret references are replaced by
+// RedactedValue, so that the configuration can be printed or served without
+// leaking them.
+func (cfg *Config) Redacted() (map[string]any, error) {
+	doc := make(map[string]any)
+	if cfg == nil {
+		return doc, nil
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	for _, field := range secretFields {
+		redactField(doc, field)
+	}
+	for _, path := range cfg.secrets {
+		redact(doc, splitPath(path))
+	}
+	return doc, nil
+}
+
+// redactField replaces the non-empty values at field, a path of
+// secretFields, with RedactedValue. The elements of a list are replaced one
+// by one, so the number of keys stays visible.
+func redactField(value any, field []string) {
+	if len(field) == 0 {
+		return
+	}
+	var items []any
+	switch v := value.(type) {
+	case map[string]any:
+		switch {
+		case field[0] == "*":
+			for key := range v {
+				items = append(items, v[key])
+			}
+		case len(field) == 1:
+			v[field[0]] = redactValue(v[field[0]])
+			return
+		default:
+			items = append(items, v[field[0]])
+		}
+	case []any:
+		if field[0] != "[*" {
+			return
+		}
+		items = v
+	}
+	for _, item := range items {
+		redactField(item, field[1:])
+	}
+}
+
+func redactValue(value any) any {
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			return RedactedValue
+		}
+	case []any:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+	}
+	return value
+}
+
+// splitPath turns a field path such as "datasets.docs.text_columns[1]" into
+// its object keys and array indexes.
+func splitPath(path string) []string {
+	var parts []string
+	for _, key := range strings.Split(path, ".") {
+		for {
+			open := strings.IndexByte(key, '[')
+			if open < 0 || !strings.HasSuffix(key, "]") {
+				break
+			}
+			if open > 0 {
+				parts = append(parts, key[:open])
+			}
+			rest := key[open+1:]
+			end := strings.IndexByte(rest, ']')
+			parts = append(parts, "["+rest[:end])
+			key = rest[end+1:]
+		}
+		if key != "" {
+			parts = append(parts, key)
+		}
+	}
+	return parts
+}
+
+func redact(value any, path []string) {
+	if len(path) == 0 {
+		return
+	}
+	last := len(path) == 1
+	switch v := value.(type) {
+	case map[string]any:
+		item, ok := v[path[0]]
+		if !ok {
+			return
+		}
+		if last {
+			v[path[0]] = RedactedValue
+			return
+		}
+		redact(item, path[1:])
+	case []any:
+		if !strings.HasPrefix(path[0], "[") {
+			return
+		}
+		i, err := strconv.Atoi(path[0][1:])
+		if err != nil || i < 0 || i >= len(v) {
+			return
+		}
+		if last {
+			v[i] = RedactedValue
+			return
+		}
+		redact(v[i], path[1:])
+	}
+}
@@ -0,0 +1,274 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"yashubustudio/csv-search/internal/answer"
+	"yashubustudio/csv-search/internal/database"
+	"yashubustudio/csv-search/internal/ingest"
+	"yashubustudio/csv-search/internal/schedule"
+	"yashubustudio/csv-search/internal/search"
+	"yashubustudio/csv-search/internal/textnorm"
+)
+
+// ValidationError lists every problem Validate found, each prefixed with the
+// path of the offending field (e.g. "datasets.docs.batch_size").
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks the decoded configuration for values that would otherwise
+// only fail later at ingest or search time. It returns a *ValidationError
+// describing all problems, or nil.
+func (cfg *Config) Validate() error {
+	if cfg == nil {
+		return nil
+	}
+	var v validator
+
+	v.check(cfg.Embedding.MaxSeqLen >= 0, "embedding.max_seq_len", "must not be negative")
+	switch cfg.Embedding.Truncation {
+	case "", "head", "tail", "middle":
+	default:
+		v.add("embedding.truncation", "unknown strategy %q (want head, tail or middle)", cfg.Embedding.Truncation)
+	}
+	if _, err := textnorm.New(cfg.Embedding.Normalize); err != nil {
+		v.add("embedding.normalize", "%v", err)
+	}
+	models := make([]string, 0, len(cfg.Embedding.Models))
+	for name := range cfg.Embedding.Models {
+		models = append(models, name)
+	}
+	sort.Strings(models)
+	for _, name := range models {
+		model := cfg.Embedding.Models[name]
+		path := "embedding.models." + name
+		if strings.TrimSpace(name) == "" {
+			v.add("embedding.models", "model names must not be empty")
+			continue
+		}
+		v.check(strings.TrimSpace(model.Model) != "", path+".model", "required")
+		v.check(model.MaxSeqLen >= 0, path+".max_seq_len", "must not be negative")
+		switch model.Truncation {
+		case "", "head", "tail", "middle":
+		default:
+			v.add(path+".truncation", "unknown strategy %q (want head, tail or middle)", model.Truncation)
+		}
+		if _, err := textnorm.New(model.Normalize); err != nil {
+			v.add(path+".normalize", "%v", err)
+		}
+	}
+
+	names := make([]string, 0, len(cfg.Datasets))
+	for name := range cfg.Datasets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if cfg.DefaultDataset != "" && len(cfg.Datasets) > 0 {
+		if _, ok := cfg.Datasets[cfg.DefaultDataset]; !ok {
+			v.add("default_dataset", "unknown dataset %q (configured: %s)", cfg.DefaultDataset, strings.Join(names, ", "))
+		}
+	}
+	for _, name := range names {
+		ds := cfg.Datasets[name]
+		path := "datasets." + name
+		if strings.TrimSpace(name) == "" {
+			v.add("datasets", "dataset names must not be empty")
+			continue
+		}
+		v.check(ds.BatchSize >= 0, path+".batch_size", "must not be negative")
+		v.columns(path+".text_columns", ds.TextColumns)
+		v.columns(path+".meta_columns", ds.MetaColumns)
+		v.columns(path+".index_fields", ds.IndexFields)
+		for i, field := range ds.IndexFields {
+			if _, err := database.FieldExpr("data", strings.TrimSpace(field)); err != nil {
+				v.add(fmt.Sprintf("%s.index_fields[%d]", path, i), "%v", err)
+			}
+		}
+		if err := ingest.ValidateDuplicates(strings.TrimSpace(ds.Duplicates)); err != nil {
+			v.add(path+".duplicates", "%v", err)
+		}
+		switch {
+		case ds.LatColumn != "" && ds.LngColumn == "":
+			v.add(path+".lng_column", "required when lat_column is set")
+		case ds.LngColumn != "" && ds.LatColumn == "":
+			v.add(path+".lat_column", "required when lng_column is set")
+		}
+		if expr := strings.TrimSpace(ds.Schedule); expr != "" {
+			if _, err := schedule.Parse(expr); err != nil {
+				v.add(path+".schedule", "%v", err)
+			}
+			v.check(strings.TrimSpace(ds.CSV) != "", path+".csv", "required when schedule is set")
+		}
+		v.search(path+".search", ds.Search)
+		if ds.Cache != nil {
+			v.check(ds.Cache.TTLSeconds >= 0, path+".cache.ttl_seconds", "must not be negative")
+			v.check(ds.Cache.MaxEntries >= 0, path+".cache.max_entries", "must not be negative")
+			if header := strings.TrimSpace(ds.Cache.BypassHeader); header != "" && !validHeaderName(header) {
+				v.add(path+".cache.bypass_header", "invalid header name %q", header)
+			}
+		}
+		langs := make([]string, 0, len(ds.Languages))
+		for lang := range ds.Languages {
+			langs = append(langs, lang)
+		}
+		sort.Strings(langs)
+		for _, lang := range langs {
+			langPath := path + ".languages." + lang
+			if err := search.ValidateLanguage(lang); err != nil {
+				v.add(langPath, "%v", err)
+			}
+			if err := search.ValidateTokenizer(ds.Languages[lang].Tokenizer); err != nil {
+				v.add(langPath+".fts_tokenizer", "%v", err)
+			}
+		}
+	}
+
+	v.search("search", cfg.Search)
+	v.check(cfg.QueryLog.RetentionDays >= 0, "query_log.retention_days", "must not be negative")
+	if provider := strings.TrimSpace(cfg.Answer.Provider); provider != "" {
+		if err := answer.ValidateProvider(provider); err != nil {
+			v.add("answer.provider", "%v", err)
+		}
+		v.check(strings.TrimSpace(cfg.Answer.Model) != "", "answer.model", "required when answer.provider is set")
+	}
+	v.check(cfg.Answer.TopK >= 0, "answer.topk", "must not be negative")
+	v.check(cfg.Answer.MaxContextChars >= 0, "answer.max_context_chars", "must not be negative")
+	v.check(cfg.Answer.TimeoutSeconds >= 0, "answer.timeout_seconds", "must not be negative")
+	v.tenants(cfg)
+	v.webhooks(cfg)
+
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+// tenants checks that every tenant names known datasets and that no API key
+// is shared between tenants.
+func (v *validator) tenants(cfg *Config) {
+	names := make([]string, 0, len(cfg.Tenants))
+	for name := range cfg.Tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	owners := make(map[string]string)
+	for _, name := range names {
+		tenant := cfg.Tenants[name]
+		path := "tenants." + name
+		if strings.TrimSpace(name) == "" {
+			v.add("tenants", "tenant names must not be empty")
+			continue
+		}
+		for i, key := range tenant.APIKeys {
+			keyPath := fmt.Sprintf("%s.api_keys[%d]", path, i)
+			key = strings.TrimSpace(key)
+			if key == "" {
+				v.add(keyPath, "must not be empty")
+				continue
+			}
+			if owner, ok := owners[key]; ok {
+				v.add(keyPath, "key is also used by tenant %q", owner)
+				continue
+			}
+			owners[key] = name
+		}
+		v.check(len(tenant.Datasets) > 0, path+".datasets", "at least one dataset is required")
+		allowed := make(map[string]bool, len(tenant.Datasets))
+		for i, dataset := range tenant.Datasets {
+			dataset = strings.TrimSpace(dataset)
+			allowed[dataset] = true
+			if _, ok := cfg.Datasets[dataset]; !ok && len(cfg.Datasets) > 0 {
+				v.add(fmt.Sprintf("%s.datasets[%d]", path, i), "unknown dataset %q", dataset)
+			}
+		}
+		if dataset := strings.TrimSpace(tenant.DefaultDataset); dataset != "" && !allowed[dataset] {
+			v.add(path+".default_dataset", "%q is not one of the tenant's datasets", dataset)
+		}
+		v.check(tenant.DefaultTopK >= 0, path+".default_topk", "must not be negative")
+		v.check(tenant.MaxTopK >= 0, path+".max_topk", "must not be negative")
+		if tenant.MaxTopK > 0 && tenant.DefaultTopK > tenant.MaxTopK {
+			v.add(path+".default_topk", "exceeds max_topk %d", tenant.MaxTopK)
+		}
+		v.check(tenant.RequestsPerSecond >= 0, path+".requests_per_second", "must not be negative")
+		v.check(tenant.Burst >= 0, path+".burst", "must not be negative")
+	}
+}
+
+// webhooks checks the target and filters of every webhook.
+func (v *validator) webhooks(cfg *Config) {
+	for i, hook := range cfg.Webhooks {
+		path := fmt.Sprintf("webhooks[%d]", i)
+		if target, err := url.Parse(strings.TrimSpace(hook.URL)); err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			v.add(path+".url", "must be an http(s) URL")
+		}
+		for j, dataset := range hook.Datasets {
+			if _, ok := cfg.Datasets[strings.TrimSpace(dataset)]; !ok && len(cfg.Datasets) > 0 {
+				v.add(fmt.Sprintf("%s.datasets[%d]", path, j), "unknown dataset %q", dataset)
+			}
+		}
+		for j, typ := range hook.Types {
+			switch strings.TrimSpace(typ) {
+			case "inserted", "updated", "deleted", "reset":
+			default:
+				v.add(fmt.Sprintf("%s.types[%d]", path, j), "unknown change type %q (want inserted, updated, deleted or reset)", typ)
+			}
+		}
+		v.check(hook.TimeoutSeconds >= 0, path+".timeout_seconds", "must not be negative")
+	}
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) add(path, format string, args ...any) {
+	v.problems = append(v.problems, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *validator) check(ok bool, path, problem string) {
+	if !ok {
+		v.add(path, "%s", problem)
+	}
+}
+
+func (v *validator) columns(path string, columns []string) {
+	for i, column := range columns {
+		v.check(strings.TrimSpace(column) != "", fmt.Sprintf("%s[%d]", path, i), "column name must not be empty")
+	}
+}
+
+func (v *validator) search(path string, s SearchConfig) {
+	v.check(s.DefaultTopK >= 0, path+".default_topk", "must not be negative")
+	if err := search.ValidateMetric(s.Metric); err != nil {
+		v.add(path+".metric", "%v", err)
+	}
+	if err := search.ValidateScorePrecision(s.ScorePrecision); err != nil {
+		v.add(path+".score_precision", "%v", err)
+	}
+	if err := search.ValidateScoreNormalization(s.ScoreNormalization); err != nil {
+		v.add(path+".score_normalization", "%v", err)
+	}
+	if err := search.ValidateFieldBoosts(s.FieldBoosts); err != nil {
+		v.add(path+".field_boosts", "%v", err)
+	}
+}
+
+// validHeaderName reports whether name is an HTTP field name (an RFC 9110
+// token).
+func validHeaderName(name string) bool {
+	for _, r := range name {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", r) {
+			continue
+		}
+		return false
+	}
+	return name != ""
+}
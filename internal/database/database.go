@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -43,10 +44,74 @@ func Open(path string) (*sql.DB, error) {
 	return db, nil
 }
 
+// OpenReader opens a pool of up to conns read-only connections to the
+// database at path, which must already exist. In WAL mode these read while
+// the connection returned by Open writes, so searches are not blocked behind
+// an ingest transaction. A non-positive conns uses one per CPU.
+func OpenReader(path string, conns int) (*sql.DB, error) {
+	if path == "" {
+		return nil, fmt.Errorf("database path must not be empty")
+	}
+	if conns <= 0 {
+		conns = runtime.NumCPU()
+	}
+
+	// query_only rather than mode=ro: a read-only open cannot create the WAL
+	// index when the writer has not yet done so.
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=query_only(1)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetConnMaxLifetime(0)
+	db.SetMaxIdleConns(conns)
+	db.SetMaxOpenConns(conns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// SchemaVersion identifies the schema created by Init. It is stored in the
+// SQLite user_version pragma.
+const SchemaVersion = 4
+
 // Init prepares the database schema using the statements defined in schema.go.
 func Init(ctx context.Context, db *sql.DB) error {
 	if db == nil {
 		return fmt.Errorf("db is nil")
 	}
-	return applySchema(ctx, db, schema)
+	if err := applySchema(ctx, db, schema); err != nil {
+		return err
+	}
+	version, err := Version(ctx, db)
+	if err != nil {
+		return err
+	}
+	if version < SchemaVersion {
+		if err := applyMigrations(ctx, db, version); err != nil {
+			return err
+		}
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion)); err != nil {
+			return fmt.Errorf("set schema version: %w", err)
+		}
+	}
+	return nil
+}
+
+// Version returns the schema version recorded in the database (0 for
+// databases created before versioning).
+func Version(ctx context.Context, db *sql.DB) (int, error) {
+	if db == nil {
+		return 0, fmt.Errorf("db is nil")
+	}
+	var version int
+	if err := db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
 }
@@ -0,0 +1,290 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestInitMigratesVersion1(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(filepath.Join(t.TempDir(), "old.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+
+	// A version 1 database stored embeddings without the model column.
+	for _, stmt := range []string{
+		`CREATE TABLE records (dataset TEXT NOT NULL, id TEXT NOT NULL, data TEXT NOT NULL, lat REAL, lng REAL, hash TEXT, PRIMARY KEY(dataset, id))`,
+		`CREATE TABLE records_vec (dataset TEXT NOT NULL, id TEXT NOT NULL, embedding BLOB NOT NULL, PRIMARY KEY(dataset, id))`,
+		`INSERT INTO records_vec(dataset, id, embedding) VALUES('docs', 'a', x'00')`,
+		`PRAGMA user_version = 1`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed %q: %v", stmt, err)
+		}
+	}
+
+	if err := Init(ctx, db); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	version, err := Version(ctx, db)
+	if err != nil {
+		t.Fatalf("Version: %v", err)
+	}
+	if version != SchemaVersion {
+		t.Fatalf("expected schema version %d, got %d", SchemaVersion, version)
+	}
+	if _, err := db.ExecContext(ctx, `UPDATE records_vec SET model = 'm' WHERE id = 'a'`); err != nil {
+		t.Fatalf("expected the model column after migrating: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, `UPDATE records SET updated_at = 1`); err != nil {
+		t.Fatalf("expected the updated_at column after migrating: %v", err)
+	}
+	// Running Init again on an up-to-date database is a no-op.
+	if err := Init(ctx, db); err != nil {
+		t.Fatalf("second Init: %v", err)
+	}
+}
+
+func TestBuildVectorPages(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := Init(ctx, db); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	for _, stmt := range []string{
+		`INSERT INTO records(dataset, id, data) VALUES('docs', 'b', '{}'), ('docs', 'a', '{}'), ('other', 'c', '{}')`,
+		`INSERT INTO records_vec(dataset, id, embedding) VALUES('docs', 'b', x'0000803f00000040'), ('docs', 'a', x'0000404000008040'), ('other', 'c', x'00000000')`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed %q: %v", stmt, err)
+		}
+	}
+
+	pages, err := BuildAllVectorPages(ctx, db)
+	if err != nil || pages != 2 {
+		t.Fatalf("BuildAllVectorPages = %d, %v", pages, err)
+	}
+	var (
+		dim     int
+		ids     string
+		vectors []byte
+	)
+	if err := db.QueryRowContext(ctx, `SELECT dim, ids, vectors FROM records_vec_pages WHERE dataset = 'docs'`).Scan(&dim, &ids, &vectors); err != nil {
+		t.Fatalf("read page: %v", err)
+	}
+	if dim != 2 || ids != `["a","b"]` || len(vectors) != 16 || vectors[3] != 0x40 || vectors[11] != 0x3f {
+		t.Fatalf("unexpected page: dim %d, ids %s, vectors %x", dim, ids, vectors)
+	}
+
+	// A change to an embedding marks the page holding it stale, in its
+	// dataset only, until UpdateVectorPages rewrites it.
+	if _, err := db.ExecContext(ctx, `UPDATE records_vec SET embedding = x'0000000000000000' WHERE dataset = 'docs' AND id = 'a'`); err != nil {
+		t.Fatalf("update vector: %v", err)
+	}
+	var stale string
+	if err := db.QueryRowContext(ctx, `SELECT group_concat(dataset) FROM records_vec_pages_stale`).Scan(&stale); err != nil || stale != "docs" {
+		t.Fatalf("expected the docs page to be stale, got %q (%v)", stale, err)
+	}
+	if pages, err := UpdateVectorPages(ctx, db, "docs"); err != nil || pages != 1 {
+		t.Fatalf("UpdateVectorPages = %d, %v", pages, err)
+	}
+	if err := db.QueryRowContext(ctx, `SELECT vectors FROM records_vec_pages WHERE dataset = 'docs'`).Scan(&vectors); err != nil {
+		t.Fatalf("read page: %v", err)
+	}
+	if len(vectors) != 16 || vectors[3] != 0 || vectors[11] != 0x3f {
+		t.Fatalf("expected the rewritten page, got %x", vectors)
+	}
+	var left int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM records_vec_pages_stale`).Scan(&left); err != nil || left != 0 {
+		t.Fatalf("expected no stale pages, got %d (%v)", left, err)
+	}
+
+	// Mixed dimensions cannot be paged.
+	if _, err := db.ExecContext(ctx, `UPDATE records_vec SET embedding = x'00000000' WHERE dataset = 'docs' AND id = 'a'`); err != nil {
+		t.Fatalf("update vector: %v", err)
+	}
+	if pages, err := UpdateVectorPages(ctx, db, "docs"); err != nil || pages != 0 {
+		t.Fatalf("UpdateVectorPages with mixed dimensions = %d, %v", pages, err)
+	}
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM records_vec_pages WHERE dataset = 'docs'`).Scan(&left); err != nil || left != 0 {
+		t.Fatalf("expected the docs pages to be dropped, got %d (%v)", left, err)
+	}
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM records_vec_pages WHERE dataset = 'other'`).Scan(&left); err != nil || left != 1 {
+		t.Fatalf("expected the other pages to remain, got %d (%v)", left, err)
+	}
+	if pages, err := BuildVectorPages(ctx, db, "docs"); err != nil || pages != 0 {
+		t.Fatalf("BuildVectorPages with mixed dimensions = %d, %v", pages, err)
+	}
+}
+
+func TestUpdateVectorPages(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := Init(ctx, db); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	// The even ids from 00000 to 05998 fill three pages.
+	for _, stmt := range []string{
+		`WITH RECURSIVE n(i) AS (SELECT 0 UNION ALL SELECT i + 2 FROM n WHERE i < 5998)
+                 INSERT INTO records(dataset, id, data) SELECT 'docs', printf('%05d', i), '{}' FROM n`,
+		`INSERT INTO records_vec(dataset, id, embedding) SELECT dataset, id, x'0000803f' FROM records`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed %q: %v", stmt, err)
+		}
+	}
+	if pages, err := UpdateVectorPages(ctx, db, "docs"); err != nil || pages != 3 {
+		t.Fatalf("first UpdateVectorPages = %d, %v", pages, err)
+	}
+	firstIDs := func() string {
+		var ids string
+		if err := db.QueryRowContext(ctx, `SELECT group_concat(first_id || ':' || json_array_length(ids), ' ') FROM (SELECT * FROM records_vec_pages ORDER BY first_id)`).Scan(&ids); err != nil {
+			t.Fatalf("read pages: %v", err)
+		}
+		return ids
+	}
+	if got := firstIDs(); got != ":1024 02048:1024 04096:952" {
+		t.Fatalf("unexpected pages %s", got)
+	}
+
+	// Odd ids added to the second page only rewrite it, split in two.
+	for _, stmt := range []string{
+		`WITH RECURSIVE n(i) AS (SELECT 2049 UNION ALL SELECT i + 2 FROM n WHERE i < 3047)
+                 INSERT INTO records(dataset, id, data) SELECT 'docs', printf('%05d', i), '{}' FROM n`,
+		`INSERT INTO records_vec(dataset, id, embedding) SELECT dataset, id, x'00000040' FROM records WHERE CAST(id AS INTEGER) % 2 = 1`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed %q: %v", stmt, err)
+		}
+	}
+	if pages, err := UpdateVectorPages(ctx, db, "docs"); err != nil || pages != 2 {
+		t.Fatalf("UpdateVectorPages after inserts = %d, %v", pages, err)
+	}
+	if got := firstIDs(); got != ":1024 02048:1024 03096:500 04096:952" {
+		t.Fatalf("unexpected pages after inserts %s", got)
+	}
+
+	// Deleting every id of the first page leaves the next one first.
+	if _, err := db.ExecContext(ctx, `DELETE FROM records_vec WHERE id < '02048'`); err != nil {
+		t.Fatalf("delete vectors: %v", err)
+	}
+	if pages, err := UpdateVectorPages(ctx, db, "docs"); err != nil || pages != 0 {
+		t.Fatalf("UpdateVectorPages after deletes = %d, %v", pages, err)
+	}
+	if got := firstIDs(); got != ":1024 03096:500 04096:952" {
+		t.Fatalf("unexpected pages after deletes %s", got)
+	}
+	if pages, err := UpdateVectorPages(ctx, db, "docs"); err != nil || pages != 0 {
+		t.Fatalf("UpdateVectorPages without changes = %d, %v", pages, err)
+	}
+}
+
+func TestInitMigratesVectorPages(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(filepath.Join(t.TempDir(), "old.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+
+	// Version 3 numbered the pages and dropped them on every write.
+	for _, stmt := range []string{
+		`CREATE TABLE records_vec_pages (dataset TEXT NOT NULL, page INTEGER NOT NULL, dim INTEGER NOT NULL, ids TEXT NOT NULL, vectors BLOB NOT NULL, PRIMARY KEY(dataset, page))`,
+		`INSERT INTO records_vec_pages VALUES('docs', 0, 1, '["a"]', x'0000803f')`,
+		`PRAGMA user_version = 3`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed %q: %v", stmt, err)
+		}
+	}
+	if err := Init(ctx, db); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	numbered, err := hasColumn(ctx, db, "records_vec_pages", "page")
+	if err != nil || numbered {
+		t.Fatalf("expected the numbered pages to be replaced (%v)", err)
+	}
+	for _, stmt := range []string{
+		`INSERT INTO records(dataset, id, data) VALUES('docs', 'a', '{}')`,
+		`INSERT INTO records_vec(dataset, id, embedding) VALUES('docs', 'a', x'0000803f')`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("write after migrating %q: %v", stmt, err)
+		}
+	}
+	if pages, err := UpdateVectorPages(ctx, db, "docs"); err != nil || pages != 1 {
+		t.Fatalf("UpdateVectorPages after migrating = %d, %v", pages, err)
+	}
+}
+
+func TestFsck(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := Init(ctx, db); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	// Foreign keys would delete the orphans this test leaves behind.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("conn: %v", err)
+	}
+	for _, stmt := range []string{
+		`PRAGMA foreign_keys = OFF`,
+		`INSERT INTO records(rowid, dataset, id, data, lat, lng) VALUES(1, 'docs', 'a', '{}', 35.6, 139.7), (2, 'docs', 'b', '{}', NULL, NULL), (3, 'docs', 'c', '{}', 34.7, 135.5)`,
+		`INSERT INTO records_vec(dataset, id, embedding) VALUES('docs', 'a', x'0000803f'), ('docs', 'gone', x'0000803f')`,
+		`INSERT INTO records_sparse(dataset, id, weights) VALUES('docs', 'gone', x'00')`,
+		// b's entry sits at a rowid of its own; gone's record was deleted.
+		`INSERT INTO records_fts(rowid, dataset, id, content) VALUES(1, 'docs', 'a', 'alpha'), (7, 'docs', 'b', 'beta'), (8, 'docs', 'gone', 'gamma')`,
+		// Entry 1 is right, 2 has no coordinates and 9 has no record; c has none.
+		`INSERT INTO records_rtree(rowid, min_lat, max_lat, min_lng, max_lng) VALUES(1, 35.6, 35.6, 139.7, 139.7), (2, 0, 0, 0, 0), (9, 1, 1, 1, 1)`,
+		`PRAGMA foreign_keys = ON`,
+	} {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed %q: %v", stmt, err)
+		}
+	}
+	conn.Close()
+
+	want := Inconsistencies{OrphanVectors: 1, OrphanSparse: 1, StaleFTS: 2, StaleRTree: 2, MissingRTree: 1}
+	found, err := Fsck(ctx, db, false)
+	if err != nil {
+		t.Fatalf("Fsck: %v", err)
+	}
+	if found != want {
+		t.Fatalf("check: expected %+v, got %+v", want, found)
+	}
+
+	// Moving b's FTS row to its record reveals that b has no vector.
+	want.MissingVectors = 1
+	if found, err = Fsck(ctx, db, true); err != nil {
+		t.Fatalf("Fsck repair: %v", err)
+	}
+	if found != want {
+		t.Fatalf("repair: expected %+v, got %+v", want, found)
+	}
+	if found, err = Fsck(ctx, db, false); err != nil {
+		t.Fatalf("Fsck after repair: %v", err)
+	}
+	if want := (Inconsistencies{MissingVectors: 1}); found != want {
+		t.Fatalf("after repair: expected %+v, got %+v", want, found)
+	}
+	var content string
+	if err := db.QueryRowContext(ctx, `SELECT content FROM records_fts WHERE rowid = 2`).Scan(&content); err != nil || content != "beta" {
+		t.Fatalf("expected b's text at its record's rowid, got %q (%v)", content, err)
+	}
+}
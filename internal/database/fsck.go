@@ -0,0 +1,177 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Inconsistencies counts the rows of the derived tables that disagree with
+// the records table, as left behind by interrupted writes or by databases
+// edited without foreign keys.
+type Inconsistencies struct {
+	// MissingVectors counts the records with full-text content but no
+	// embedding. Fsck cannot repair them: they need an encoder.
+	MissingVectors int64 `json:"missing_vectors"`
+	// OrphanVectors and OrphanSparse count the embeddings and lexical
+	// weights whose record is gone.
+	OrphanVectors int64 `json:"orphan_vectors"`
+	OrphanSparse  int64 `json:"orphan_sparse"`
+	// StaleFTS counts the full-text rows whose rowid is not that of the
+	// record with their dataset and id. Repair moves them to the record's
+	// rowid, or drops them when the record is gone.
+	StaleFTS int64 `json:"stale_fts"`
+	// StaleRTree counts the R-tree entries whose record is gone or has no
+	// coordinates, and MissingRTree the records with coordinates but no
+	// entry.
+	StaleRTree   int64 `json:"stale_rtree"`
+	MissingRTree int64 `json:"missing_rtree"`
+}
+
+// Fsck looks for rows of the derived tables that disagree with the records
+// table. With repair it also fixes every kind except MissingVectors, in one
+// transaction, and rebuilds the vector pages when embeddings were removed and
+// the trigram indexes when full-text rows were moved.
+// The counts are those found before repairing.
+func Fsck(ctx context.Context, db *sql.DB, repair bool) (Inconsistencies, error) {
+	var found Inconsistencies
+	if db == nil {
+		return found, fmt.Errorf("db is nil")
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return found, err
+	}
+	defer tx.Rollback()
+
+	checks := []struct {
+		count  *int64
+		query  string
+		repair string
+	}{
+		{&found.OrphanVectors, `
+                        SELECT COUNT(*) FROM records_vec AS v
+                        WHERE NOT EXISTS (SELECT 1 FROM records AS r WHERE r.dataset = v.dataset AND r.id = v.id)`, `
+                        DELETE FROM records_vec
+                        WHERE NOT EXISTS (SELECT 1 FROM records AS r WHERE r.dataset = records_vec.dataset AND r.id = records_vec.id)`},
+		{&found.OrphanSparse, `
+                        SELECT COUNT(*) FROM records_sparse AS s
+                        WHERE NOT EXISTS (SELECT 1 FROM records AS r WHERE r.dataset = s.dataset AND r.id = s.id)`, `
+                        DELETE FROM records_sparse
+                        WHERE NOT EXISTS (SELECT 1 FROM records AS r WHERE r.dataset = records_sparse.dataset AND r.id = records_sparse.id)`},
+		{&found.StaleRTree, `
+                        SELECT COUNT(*) FROM records_rtree AS g
+                        LEFT JOIN records AS r ON r.rowid = g.rowid
+                        WHERE r.lat IS NULL OR r.lng IS NULL`, `
+                        DELETE FROM records_rtree WHERE rowid IN (
+                                SELECT g.rowid FROM records_rtree AS g
+                                LEFT JOIN records AS r ON r.rowid = g.rowid
+                                WHERE r.lat IS NULL OR r.lng IS NULL
+                        )`},
+		{&found.MissingRTree, `
+                        SELECT COUNT(*) FROM records AS r
+                        WHERE r.lat IS NOT NULL AND r.lng IS NOT NULL
+                          AND NOT EXISTS (SELECT 1 FROM records_rtree AS g WHERE g.rowid = r.rowid)`, `
+                        INSERT INTO records_rtree(rowid, min_lat, max_lat, min_lng, max_lng)
+                        SELECT r.rowid, r.lat, r.lat, r.lng, r.lng FROM records AS r
+                        WHERE r.lat IS NOT NULL AND r.lng IS NOT NULL
+                          AND NOT EXISTS (SELECT 1 FROM records_rtree AS g WHERE g.rowid = r.rowid)`},
+	}
+	for _, check := range checks {
+		if err := tx.QueryRowContext(ctx, check.query).Scan(check.count); err != nil {
+			return found, err
+		}
+		if repair && *check.count > 0 {
+			if _, err := tx.ExecContext(ctx, check.repair); err != nil {
+				return found, err
+			}
+		}
+	}
+	if found.StaleFTS, err = staleFTS(ctx, tx, repair); err != nil {
+		return found, err
+	}
+
+	// Counted last so that FTS rows moved above are matched to their record.
+	if err := tx.QueryRowContext(ctx, `
+                SELECT COUNT(*) FROM records AS r
+                INNER JOIN records_fts AS f ON f.rowid = r.rowid
+                WHERE NOT EXISTS (SELECT 1 FROM records_vec AS v WHERE v.dataset = r.dataset AND v.id = r.id)
+        `).Scan(&found.MissingVectors); err != nil {
+		return found, err
+	}
+
+	if !repair {
+		return found, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return found, err
+	}
+	if found.OrphanVectors > 0 {
+		if _, err := BuildAllVectorPages(ctx, db); err != nil {
+			return found, err
+		}
+	}
+	if found.StaleFTS > 0 {
+		if _, err := BuildAllTrigramIndexes(ctx, db); err != nil {
+			return found, err
+		}
+	}
+	return found, nil
+}
+
+// staleFTS counts the full-text rows whose rowid does not match the record
+// with their dataset and id. With repair, the rows of existing records are
+// moved to the record's rowid unless it already has an entry, and the others
+// are deleted.
+func staleFTS(ctx context.Context, tx *sql.Tx, repair bool) (int64, error) {
+	rows, err := tx.QueryContext(ctx, `
+                SELECT f.rowid, f.dataset, f.id, f.content, r.rowid
+                FROM records_fts AS f
+                LEFT JOIN records AS r ON r.dataset = f.dataset AND r.id = f.id
+                WHERE r.rowid IS NULL OR r.rowid != f.rowid
+        `)
+	if err != nil {
+		return 0, err
+	}
+	type entry struct {
+		rowid       int64
+		dataset, id string
+		content     string
+		record      sql.NullInt64
+	}
+	var stale []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.rowid, &e.dataset, &e.id, &e.content, &e.record); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		stale = append(stale, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if !repair {
+		return int64(len(stale)), nil
+	}
+
+	// Delete every stale row first: one may occupy the rowid another moves to.
+	for _, e := range stale {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM records_fts WHERE rowid = ?`, e.rowid); err != nil {
+			return 0, fmt.Errorf("prune fts: %w", err)
+		}
+	}
+	for _, e := range stale {
+		if !e.record.Valid {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `
+                        INSERT INTO records_fts(rowid, dataset, id, content)
+                        SELECT ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM records_fts WHERE rowid = ?)
+                `, e.record.Int64, e.dataset, e.id, e.content, e.record.Int64); err != nil {
+			return 0, fmt.Errorf("move fts row of %s/%s: %w", e.dataset, e.id, err)
+		}
+	}
+	return int64(len(stale)), nil
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"database/sql/driver"
+	"strconv"
+
+	"modernc.org/sqlite"
+)
+
+// RegisterPredicate makes fn callable from SQL as name(value, arg), e.g. to
+// evaluate a custom filter operator on a metadata field. SQL values are
+// passed as text and NULL is never true. Only connections opened after the
+// call see the function, so it must be registered before Open.
+func RegisterPredicate(name string, fn func(value, arg string) bool) error {
+	return sqlite.RegisterDeterministicScalarFunction(name, 2, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		value, ok := sqlText(args[0])
+		if !ok {
+			return int64(0), nil
+		}
+		arg, _ := sqlText(args[1])
+		if fn(value, arg) {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	})
+}
+
+// sqlText returns v as text, or false when it is NULL.
+func sqlText(v driver.Value) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// FieldExpr returns the SQL expression extracting a metadata field from the
+// JSON column. Search filters and the indexes of CreateFieldIndexes share it,
+// since SQLite only uses an expression index for the same expression. Fields
+// containing a double quote cannot be written as a JSON path.
+func FieldExpr(column, field string) (string, error) {
+	if strings.Contains(field, `"`) {
+		return "", fmt.Errorf("metadata field %q must not contain a double quote", field)
+	}
+	path := `$."` + field + `"`
+	return fmt.Sprintf("json_extract(%s, '%s')", column, strings.ReplaceAll(path, "'", "''")), nil
+}
+
+// CreateFieldIndexes adds an expression index on (dataset, field) for every
+// metadata field, so that SQLite uses it for equality and text range
+// filters. Existing indexes are left alone.
+func CreateFieldIndexes(ctx context.Context, db *sql.DB, fields []string) error {
+	if db == nil {
+		return fmt.Errorf("db is nil")
+	}
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		expr, err := FieldExpr("data", field)
+		if err != nil {
+			return err
+		}
+		stmt := fmt.Sprintf(`CREATE INDEX IF NOT EXISTS "idx_records_field_%s" ON records(dataset, %s)`, field, expr)
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("index field %q: %w", field, err)
+		}
+	}
+	return nil
+}
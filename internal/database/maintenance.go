@@ -0,0 +1,468 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"modernc.org/sqlite"
+
+	"yashubustudio/csv-search/internal/vector"
+)
+
+// Size returns the size of the database in bytes (page_count * page_size).
+func Size(ctx context.Context, db *sql.DB) (int64, error) {
+	if db == nil {
+		return 0, fmt.Errorf("db is nil")
+	}
+	var pageCount, pageSize int64
+	if err := db.QueryRowContext(ctx, "PRAGMA page_count").Scan(&pageCount); err != nil {
+		return 0, err
+	}
+	if err := db.QueryRowContext(ctx, "PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, err
+	}
+	return pageCount * pageSize, nil
+}
+
+// ReindexOptions select the indexes rebuilt by Reindex.
+type ReindexOptions struct {
+	// FTS drops full-text entries whose record is gone, re-creates the
+	// missing entries of the datasets in TextColumns and merges the index
+	// segments.
+	FTS bool
+	// RTree rebuilds the R-tree from the coordinates stored in records.
+	RTree bool
+	// Pages rebuilds the vector pages of every dataset (see
+	// BuildVectorPages) after the other indexes.
+	Pages bool
+	// Trigram lists datasets whose trigram index (see BuildTrigramIndex) FTS
+	// builds, in addition to those that already have one.
+	Trigram []string
+	// TextColumns maps a dataset to the metadata fields whose non-empty
+	// values, joined with newlines, form its full-text content as at ingest.
+	// Missing entries of other datasets cannot be re-created.
+	TextColumns map[string][]string
+}
+
+// ReindexStats count the entries written and removed by Reindex.
+type ReindexStats struct {
+	RTreeRows   int64
+	FTSRemoved  int64
+	FTSAdded    int64
+	VectorPages int64
+	TrigramRows int64
+}
+
+// Reindex rebuilds the derived indexes selected by opts in one transaction,
+// then the B-tree indexes.
+func Reindex(ctx context.Context, db *sql.DB, opts ReindexOptions) (ReindexStats, error) {
+	var stats ReindexStats
+	if db == nil {
+		return stats, fmt.Errorf("db is nil")
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return stats, err
+	}
+	defer tx.Rollback()
+
+	if opts.RTree {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM records_rtree`); err != nil {
+			return stats, fmt.Errorf("clear rtree: %w", err)
+		}
+		res, err := tx.ExecContext(ctx, `
+                        INSERT INTO records_rtree(rowid, min_lat, max_lat, min_lng, max_lng)
+                        SELECT rowid, lat, lat, lng, lng FROM records
+                        WHERE lat IS NOT NULL AND lng IS NOT NULL;
+                `)
+		if err != nil {
+			return stats, fmt.Errorf("rebuild rtree: %w", err)
+		}
+		stats.RTreeRows, _ = res.RowsAffected()
+	}
+	if opts.FTS {
+		if stats.FTSRemoved, stats.FTSAdded, err = repairFTS(ctx, tx, opts.TextColumns); err != nil {
+			return stats, err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO records_fts(records_fts) VALUES('optimize')`); err != nil {
+			return stats, fmt.Errorf("optimize fts: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return stats, err
+	}
+	if _, err := db.ExecContext(ctx, `REINDEX`); err != nil {
+		return stats, fmt.Errorf("reindex: %w", err)
+	}
+	if opts.FTS {
+		if stats.TrigramRows, err = buildTrigramIndexes(ctx, db, opts.Trigram); err != nil {
+			return stats, err
+		}
+	}
+	if opts.Pages {
+		pages, err := BuildAllVectorPages(ctx, db)
+		if err != nil {
+			return stats, err
+		}
+		stats.VectorPages = int64(pages)
+	}
+	return stats, nil
+}
+
+// repairFTS removes the full-text entries that do not belong to a record and
+// re-creates the missing entries of the datasets in textColumns.
+func repairFTS(ctx context.Context, tx *sql.Tx, textColumns map[string][]string) (removed, added int64, err error) {
+	res, err := tx.ExecContext(ctx, `
+                DELETE FROM records_fts
+                WHERE NOT EXISTS (
+                        SELECT 1 FROM records AS r
+                        WHERE r.rowid = records_fts.rowid AND r.dataset = records_fts.dataset AND r.id = records_fts.id
+                );
+        `)
+	if err != nil {
+		return 0, 0, fmt.Errorf("prune fts: %w", err)
+	}
+	removed, _ = res.RowsAffected()
+
+	datasets := make([]string, 0, len(textColumns))
+	for dataset := range textColumns {
+		datasets = append(datasets, dataset)
+	}
+	sort.Strings(datasets)
+	for _, dataset := range datasets {
+		type entry struct {
+			rowid   int64
+			id      string
+			content string
+		}
+		rows, err := tx.QueryContext(ctx, `
+                        SELECT r.rowid, r.id, r.data FROM records AS r
+                        WHERE r.dataset = ? AND NOT EXISTS (SELECT 1 FROM records_fts AS f WHERE f.rowid = r.rowid);
+                `, dataset)
+		if err != nil {
+			return removed, added, err
+		}
+		var missing []entry
+		for rows.Next() {
+			var (
+				e    entry
+				data string
+			)
+			if err := rows.Scan(&e.rowid, &e.id, &data); err != nil {
+				rows.Close()
+				return removed, added, err
+			}
+			var fields map[string]string
+			if err := json.Unmarshal([]byte(data), &fields); err != nil {
+				rows.Close()
+				return removed, added, fmt.Errorf("decode metadata for %s: %w", e.id, err)
+			}
+			if e.content = textContent(fields, textColumns[dataset]); e.content != "" {
+				missing = append(missing, e)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return removed, added, err
+		}
+		for _, e := range missing {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO records_fts(rowid, dataset, id, content) VALUES(?, ?, ?, ?)`, e.rowid, dataset, e.id, e.content); err != nil {
+				return removed, added, fmt.Errorf("rebuild fts: %w", err)
+			}
+			added++
+		}
+	}
+	return removed, added, nil
+}
+
+// textContent joins the non-empty values of columns (matched without regard
+// to case, like CSV headers at ingest) with newlines.
+func textContent(fields map[string]string, columns []string) string {
+	parts := make([]string, 0, len(columns))
+	for _, column := range columns {
+		column = strings.TrimSpace(column)
+		value, ok := fields[column]
+		if !ok {
+			for name, v := range fields {
+				if strings.EqualFold(name, column) {
+					value = v
+					break
+				}
+			}
+		}
+		if strings.TrimSpace(value) != "" {
+			parts = append(parts, value)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// VectorCheck reports the consistency of the embeddings of one dataset.
+type VectorCheck struct {
+	Dataset string `json:"dataset"`
+	Vectors int64  `json:"vectors"`
+	// Missing counts the records with full-text content but no embedding.
+	Missing int64 `json:"missing"`
+	// Invalid counts the embeddings that cannot be decoded.
+	Invalid int64 `json:"invalid"`
+	// Dimension is the most common dimension of the dataset; Mismatched
+	// counts the embeddings of another dimension.
+	Dimension  int   `json:"dimension"`
+	Mismatched int64 `json:"mismatched"`
+}
+
+// CheckVectors verifies the stored embeddings of every dataset against the
+// records and each other.
+func CheckVectors(ctx context.Context, db *sql.DB) ([]VectorCheck, error) {
+	if db == nil {
+		return nil, fmt.Errorf("db is nil")
+	}
+	checks := map[string]*VectorCheck{}
+	dims := map[string]map[int]int64{}
+	get := func(dataset string) *VectorCheck {
+		c, ok := checks[dataset]
+		if !ok {
+			c = &VectorCheck{Dataset: dataset}
+			checks[dataset] = c
+			dims[dataset] = map[int]int64{}
+		}
+		return c
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT dataset, embedding FROM records_vec`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	scratch := vector.GetFloats()
+	defer vector.PutFloats(scratch)
+	for rows.Next() {
+		var (
+			dataset string
+			blob    sql.RawBytes
+		)
+		if err := rows.Scan(&dataset, &blob); err != nil {
+			return nil, err
+		}
+		c := get(dataset)
+		c.Vectors++
+		vec, err := vector.View(scratch, blob)
+		if err != nil || len(vec) == 0 {
+			c.Invalid++
+			continue
+		}
+		dims[dataset][len(vec)]++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	missing, err := db.QueryContext(ctx, `
+                SELECT r.dataset, COUNT(*) FROM records AS r
+                INNER JOIN records_fts AS f ON f.rowid = r.rowid
+                LEFT JOIN records_vec AS v ON v.dataset = r.dataset AND v.id = r.id
+                WHERE v.id IS NULL
+                GROUP BY r.dataset;
+        `)
+	if err != nil {
+		return nil, err
+	}
+	defer missing.Close()
+	for missing.Next() {
+		var (
+			dataset string
+			n       int64
+		)
+		if err := missing.Scan(&dataset, &n); err != nil {
+			return nil, err
+		}
+		get(dataset).Missing = n
+	}
+	if err := missing.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]VectorCheck, 0, len(checks))
+	for dataset, c := range checks {
+		var best int64
+		for dim, n := range dims[dataset] {
+			if n > best || (n == best && dim < c.Dimension) {
+				c.Dimension, best = dim, n
+			}
+		}
+		c.Mismatched = c.Vectors - c.Invalid - best
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Dataset < out[j].Dataset })
+	return out, nil
+}
+
+// FileSize returns the on-disk size of the database at path, including its
+// write-ahead log. Missing files count as zero.
+func FileSize(path string) (int64, error) {
+	var total int64
+	for _, name := range []string{path, path + "-wal"} {
+		info, err := os.Stat(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		total += info.Size()
+	}
+	return total, nil
+}
+
+// QuickCheck opens the database file at path read-only and runs SQLite's
+// quick_check on it, so that a truncated or corrupt snapshot is rejected
+// before it replaces a live database.
+func QuickCheck(ctx context.Context, path string) error {
+	db, err := OpenReader(path, 1)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer db.Close()
+	var result string
+	if err := db.QueryRowContext(ctx, "PRAGMA quick_check").Scan(&result); err != nil {
+		return fmt.Errorf("check %s: %w", path, err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("check %s: %s", path, result)
+	}
+	return nil
+}
+
+// Compact rewrites the database file to reclaim space left by deleted rows,
+// merges the FTS5 index segments, verifies the R-tree and truncates the WAL,
+// in that order. It returns the logical sizes before and after.
+func Compact(ctx context.Context, db *sql.DB) (before, after int64, err error) {
+	if before, err = Size(ctx, db); err != nil {
+		return 0, 0, err
+	}
+	if _, err := db.ExecContext(ctx, `VACUUM`); err != nil {
+		return 0, 0, fmt.Errorf("vacuum: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO records_fts(records_fts) VALUES('optimize')`); err != nil {
+		return 0, 0, fmt.Errorf("optimize fts: %w", err)
+	}
+	var check string
+	if err := db.QueryRowContext(ctx, `SELECT rtreecheck('records_rtree')`).Scan(&check); err != nil {
+		return 0, 0, fmt.Errorf("check rtree: %w", err)
+	}
+	if check != "ok" {
+		return 0, 0, fmt.Errorf("rtree integrity check failed (rebuild it with reindex): %s", check)
+	}
+	if _, err := db.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+		return 0, 0, fmt.Errorf("checkpoint: %w", err)
+	}
+	if after, err = Size(ctx, db); err != nil {
+		return 0, 0, err
+	}
+	return before, after, nil
+}
+
+// backupStepPages is the number of pages copied per online backup step.
+// Between steps the context is checked so a long copy can be cancelled.
+const backupStepPages = 1024
+
+// onlineBackup is implemented by modernc.org/sqlite connections.
+type onlineBackup interface {
+	NewBackup(dstURI string) (*sqlite.Backup, error)
+	NewRestore(srcURI string) (*sqlite.Backup, error)
+}
+
+// Backup writes a consistent copy of the database to path using the SQLite
+// online backup API, which is safe while the database is in use. The target
+// must not exist.
+func Backup(ctx context.Context, db *sql.DB, path string) (int64, error) {
+	if db == nil {
+		return 0, fmt.Errorf("db is nil")
+	}
+	if path == "" {
+		return 0, fmt.Errorf("backup path must not be empty")
+	}
+	if _, err := os.Stat(path); err == nil {
+		return 0, fmt.Errorf("backup target %s already exists", path)
+	}
+	if dir := filepath.Dir(path); dir != "." && dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return 0, fmt.Errorf("create backup dir: %w", err)
+		}
+	}
+	err := copyOnline(ctx, db, func(c onlineBackup) (*sqlite.Backup, error) {
+		return c.NewBackup(path)
+	})
+	if err != nil {
+		os.Remove(path)
+		return 0, fmt.Errorf("backup: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Restore replaces the contents of db with the database stored at path
+// using the SQLite online backup API. The schema is not migrated; call Init
+// afterwards to bring an older snapshot up to date.
+func Restore(ctx context.Context, db *sql.DB, path string) error {
+	if db == nil {
+		return fmt.Errorf("db is nil")
+	}
+	if path == "" {
+		return fmt.Errorf("restore path must not be empty")
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("restore source: %w", err)
+	}
+	err := copyOnline(ctx, db, func(c onlineBackup) (*sqlite.Backup, error) {
+		return c.NewRestore(path)
+	})
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	return nil
+}
+
+func copyOnline(ctx context.Context, db *sql.DB, start func(onlineBackup) (*sqlite.Backup, error)) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn any) error {
+		c, ok := driverConn.(onlineBackup)
+		if !ok {
+			return fmt.Errorf("driver %T does not support online backups", driverConn)
+		}
+		b, err := start(c)
+		if err != nil {
+			return err
+		}
+		for {
+			if err := ctx.Err(); err != nil {
+				b.Finish()
+				return err
+			}
+			more, err := b.Step(backupStepPages)
+			if err != nil {
+				b.Finish()
+				return err
+			}
+			if !more {
+				break
+			}
+		}
+		return b.Finish()
+	})
+}
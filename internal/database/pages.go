@@ -0,0 +1,299 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// VectorPageSize is the number of embeddings stored in one row of
+// records_vec_pages.
+const VectorPageSize = 1024
+
+// BuildVectorPages rewrites the vector pages of dataset from records_vec:
+// the embeddings, ordered by id, are concatenated VectorPageSize at a time
+// into one BLOB per page, next to a JSON array of their ids. Searches read
+// these few large rows instead of one row per record. A dataset whose
+// embeddings do not all have the same dimension (or include one that cannot
+// be decoded) gets no pages, and is searched row by row. It returns the
+// number of pages written.
+func BuildVectorPages(ctx context.Context, db *sql.DB, dataset string) (int, error) {
+	return withVectorPages(ctx, db, dataset, buildVectorPages)
+}
+
+// UpdateVectorPages rewrites the vector pages of dataset that writes made
+// stale since they were built, so that the cost of a write grows with the
+// pages it touched rather than with the dataset. A page that grew past
+// VectorPageSize is split. A dataset without pages, or whose pages are all
+// stale, is built as by BuildVectorPages. It returns the number of pages
+// written.
+func UpdateVectorPages(ctx context.Context, db *sql.DB, dataset string) (int, error) {
+	return withVectorPages(ctx, db, dataset, updateVectorPages)
+}
+
+// withVectorPages runs build on dataset in a transaction.
+func withVectorPages(ctx context.Context, db *sql.DB, dataset string, build func(context.Context, *sql.Tx, string) (int, error)) (int, error) {
+	if db == nil {
+		return 0, fmt.Errorf("db is nil")
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	pages, err := build(ctx, tx, dataset)
+	if err != nil {
+		return 0, fmt.Errorf("build vector pages of %s: %w", dataset, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return pages, nil
+}
+
+// BuildAllVectorPages runs BuildVectorPages for every dataset with
+// embeddings and returns the total number of pages written.
+func BuildAllVectorPages(ctx context.Context, db *sql.DB) (int, error) {
+	if db == nil {
+		return 0, fmt.Errorf("db is nil")
+	}
+	rows, err := db.QueryContext(ctx, `SELECT DISTINCT dataset FROM records_vec ORDER BY dataset`)
+	if err != nil {
+		return 0, err
+	}
+	var datasets []string
+	for rows.Next() {
+		var dataset string
+		if err := rows.Scan(&dataset); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		datasets = append(datasets, dataset)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, dataset := range datasets {
+		n, err := BuildVectorPages(ctx, db, dataset)
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func buildVectorPages(ctx context.Context, tx *sql.Tx, dataset string) (int, error) {
+	if err := dropVectorPages(ctx, tx, dataset); err != nil {
+		return 0, err
+	}
+	var unpageable bool
+	if err := tx.QueryRowContext(ctx, `
+                SELECT COUNT(DISTINCT length(embedding)) > 1 OR COALESCE(MAX(length(embedding) % 4 != 0 OR length(embedding) = 0), 0)
+                FROM records_vec WHERE dataset = ?
+        `, dataset).Scan(&unpageable); err != nil {
+		return 0, err
+	}
+	if unpageable {
+		return 0, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, embedding FROM records_vec WHERE dataset = ? ORDER BY id`, dataset)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	// The first page of a dataset starts at ''.
+	w := pageWriter{tx: tx, dataset: dataset, first: new(string)}
+	for rows.Next() {
+		var (
+			id   string
+			blob sql.RawBytes
+		)
+		if err := rows.Scan(&id, &blob); err != nil {
+			return w.pages, err
+		}
+		if len(blob) == 0 || len(blob)%4 != 0 {
+			return w.pages, fmt.Errorf("invalid vector blob length %d for %s", len(blob), id)
+		}
+		w.dim = len(blob) / 4
+		if err := w.add(ctx, id, blob); err != nil {
+			return w.pages, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return w.pages, err
+	}
+	return w.pages, w.flush(ctx)
+}
+
+// updateVectorPages rewrites the stale pages of dataset from the embeddings
+// in their id ranges.
+func updateVectorPages(ctx context.Context, tx *sql.Tx, dataset string) (int, error) {
+	type page struct {
+		first string
+		stale bool
+	}
+	rows, err := tx.QueryContext(ctx, `
+                SELECT p.first_id, p.dim, s.first_id IS NOT NULL
+                FROM records_vec_pages AS p
+                LEFT JOIN records_vec_pages_stale AS s
+                        ON s.dataset = p.dataset AND s.first_id = p.first_id
+                WHERE p.dataset = ? ORDER BY p.first_id
+        `, dataset)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		pages []page
+		stale int
+		dim   int
+	)
+	for rows.Next() {
+		var (
+			p       page
+			pageDim int
+		)
+		if err := rows.Scan(&p.first, &pageDim, &p.stale); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if p.stale {
+			stale++
+		} else {
+			dim = pageDim
+		}
+		pages = append(pages, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if stale == len(pages) {
+		return buildVectorPages(ctx, tx, dataset)
+	}
+
+	written := 0
+	for i, p := range pages {
+		if !p.stale {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM records_vec_pages WHERE dataset = ? AND first_id = ?`, dataset, p.first); err != nil {
+			return written, err
+		}
+		var upper any
+		if i+1 < len(pages) {
+			upper = pages[i+1].first
+		}
+		n, pageable, err := rewriteVectorPage(ctx, tx, dataset, dim, p.first, upper)
+		if err != nil {
+			return written, err
+		}
+		if !pageable {
+			return 0, dropVectorPages(ctx, tx, dataset)
+		}
+		written += n
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM records_vec_pages_stale WHERE dataset = ?`, dataset); err != nil {
+		return written, err
+	}
+	// The first page starts at '' so that it holds the ids below all others,
+	// also when the former first page was left empty.
+	_, err = tx.ExecContext(ctx, `
+                UPDATE records_vec_pages SET first_id = ''
+                WHERE dataset = ? AND first_id = (SELECT MIN(first_id) FROM records_vec_pages WHERE dataset = ?)
+        `, dataset, dataset)
+	return written, err
+}
+
+// rewriteVectorPage writes the embeddings of dataset with ids from first up
+// to upper (the end of the dataset when nil) as pages, the first of them
+// starting at first. It reports false when one of them does not have
+// dimension dim, which leaves the dataset unpageable.
+func rewriteVectorPage(ctx context.Context, tx *sql.Tx, dataset string, dim int, first string, upper any) (int, bool, error) {
+	rows, err := tx.QueryContext(ctx, `
+                SELECT id, embedding FROM records_vec
+                WHERE dataset = ? AND id >= ? AND (? IS NULL OR id < ?)
+                ORDER BY id
+        `, dataset, first, upper, upper)
+	if err != nil {
+		return 0, false, err
+	}
+	defer rows.Close()
+	w := pageWriter{tx: tx, dataset: dataset, dim: dim, first: &first}
+	for rows.Next() {
+		var (
+			id   string
+			blob sql.RawBytes
+		)
+		if err := rows.Scan(&id, &blob); err != nil {
+			return 0, false, err
+		}
+		if len(blob) != 4*dim {
+			return w.pages, false, nil
+		}
+		if err := w.add(ctx, id, blob); err != nil {
+			return w.pages, true, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return w.pages, true, err
+	}
+	return w.pages, true, w.flush(ctx)
+}
+
+// dropVectorPages deletes the pages of dataset and their stale marks.
+func dropVectorPages(ctx context.Context, tx *sql.Tx, dataset string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM records_vec_pages WHERE dataset = ?`, dataset); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `DELETE FROM records_vec_pages_stale WHERE dataset = ?`, dataset)
+	return err
+}
+
+// pageWriter concatenates embeddings of dimension dim into pages of
+// VectorPageSize.
+type pageWriter struct {
+	tx      *sql.Tx
+	dataset string
+	dim     int
+	// first, when set, is the first_id of the next page written; the others
+	// start at their first id.
+	first   *string
+	ids     []string
+	vectors []byte
+	pages   int
+}
+
+func (w *pageWriter) add(ctx context.Context, id string, blob []byte) error {
+	w.ids = append(w.ids, id)
+	w.vectors = append(w.vectors, blob...)
+	if len(w.ids) == VectorPageSize {
+		return w.flush(ctx)
+	}
+	return nil
+}
+
+func (w *pageWriter) flush(ctx context.Context) error {
+	if len(w.ids) == 0 {
+		return nil
+	}
+	first := w.ids[0]
+	if w.first != nil {
+		first, w.first = *w.first, nil
+	}
+	list, err := json.Marshal(w.ids)
+	if err != nil {
+		return err
+	}
+	if _, err := w.tx.ExecContext(ctx, `INSERT INTO records_vec_pages(dataset, first_id, dim, ids, vectors) VALUES(?, ?, ?, ?, ?)`,
+		w.dataset, first, w.dim, string(list), w.vectors); err != nil {
+		return err
+	}
+	w.pages++
+	w.ids, w.vectors = w.ids[:0], w.vectors[:0]
+	return nil
+}
@@ -15,12 +15,21 @@ var schema = []string{
                 lat REAL,
                 lng REAL,
                 hash TEXT,
+                updated_at INTEGER,
                 PRIMARY KEY(dataset, id)
         );`,
 	`CREATE TABLE IF NOT EXISTS records_vec (
                 dataset TEXT NOT NULL,
                 id TEXT NOT NULL,
                 embedding BLOB NOT NULL,
+                model TEXT,
+                PRIMARY KEY(dataset, id),
+                FOREIGN KEY(dataset, id) REFERENCES records(dataset, id) ON DELETE CASCADE
+        );`,
+	`CREATE TABLE IF NOT EXISTS records_sparse (
+                dataset TEXT NOT NULL,
+                id TEXT NOT NULL,
+                weights BLOB NOT NULL,
                 PRIMARY KEY(dataset, id),
                 FOREIGN KEY(dataset, id) REFERENCES records(dataset, id) ON DELETE CASCADE
         );`,
@@ -36,7 +45,212 @@ var schema = []string{
                 min_lng,
                 max_lng
         );`,
+	// records_vec_pages holds the embeddings of a dataset in the columnar
+	// layout built by BuildVectorPages. A page holds the ids from its first_id
+	// up to the first_id of the next page, the first page of a dataset
+	// starting at ''. The triggers list the page holding each changed
+	// embedding in records_vec_pages_stale, for UpdateVectorPages to rewrite;
+	// the pages of a dataset with stale ones are not searched. The triggers
+	// check for an existing mark rather than use INSERT OR IGNORE, which the
+	// conflict clause of the statement firing them would override.
+	`CREATE TABLE IF NOT EXISTS records_vec_pages (
+                dataset TEXT NOT NULL,
+                first_id TEXT NOT NULL,
+                dim INTEGER NOT NULL,
+                ids TEXT NOT NULL,
+                vectors BLOB NOT NULL,
+                PRIMARY KEY(dataset, first_id)
+        );`,
+	`CREATE TABLE IF NOT EXISTS records_vec_pages_stale (
+                dataset TEXT NOT NULL,
+                first_id TEXT NOT NULL,
+                PRIMARY KEY(dataset, first_id)
+        );`,
+	`CREATE TRIGGER IF NOT EXISTS records_vec_pages_insert AFTER INSERT ON records_vec BEGIN
+                INSERT INTO records_vec_pages_stale(dataset, first_id)
+                SELECT dataset, first_id FROM (
+                        SELECT dataset, first_id FROM records_vec_pages
+                        WHERE dataset = NEW.dataset AND first_id <= NEW.id ORDER BY first_id DESC LIMIT 1
+                ) AS p
+                WHERE NOT EXISTS (SELECT 1 FROM records_vec_pages_stale AS s WHERE s.dataset = p.dataset AND s.first_id = p.first_id);
+        END;`,
+	`CREATE TRIGGER IF NOT EXISTS records_vec_pages_update AFTER UPDATE ON records_vec BEGIN
+                INSERT INTO records_vec_pages_stale(dataset, first_id)
+                SELECT dataset, first_id FROM (
+                        SELECT dataset, first_id FROM records_vec_pages
+                        WHERE dataset = OLD.dataset AND first_id <= OLD.id ORDER BY first_id DESC LIMIT 1
+                ) AS p
+                WHERE NOT EXISTS (SELECT 1 FROM records_vec_pages_stale AS s WHERE s.dataset = p.dataset AND s.first_id = p.first_id);
+                INSERT INTO records_vec_pages_stale(dataset, first_id)
+                SELECT dataset, first_id FROM (
+                        SELECT dataset, first_id FROM records_vec_pages
+                        WHERE dataset = NEW.dataset AND first_id <= NEW.id ORDER BY first_id DESC LIMIT 1
+                ) AS p
+                WHERE NOT EXISTS (SELECT 1 FROM records_vec_pages_stale AS s WHERE s.dataset = p.dataset AND s.first_id = p.first_id);
+        END;`,
+	`CREATE TRIGGER IF NOT EXISTS records_vec_pages_delete AFTER DELETE ON records_vec BEGIN
+                INSERT INTO records_vec_pages_stale(dataset, first_id)
+                SELECT dataset, first_id FROM (
+                        SELECT dataset, first_id FROM records_vec_pages
+                        WHERE dataset = OLD.dataset AND first_id <= OLD.id ORDER BY first_id DESC LIMIT 1
+                ) AS p
+                WHERE NOT EXISTS (SELECT 1 FROM records_vec_pages_stale AS s WHERE s.dataset = p.dataset AND s.first_id = p.first_id);
+        END;`,
+	// records_fts_trigram indexes the text of the datasets that search it
+	// with the trigram tokenizer (see BuildTrigramIndex), which matches
+	// Japanese words inside runs of text that the default tokenizer keeps
+	// whole. records_fts_trigram_datasets lists the datasets whose index is
+	// current; the triggers drop a dataset from it on every change to its
+	// records.
+	`CREATE VIRTUAL TABLE IF NOT EXISTS records_fts_trigram USING fts5(
+                dataset UNINDEXED,
+                id UNINDEXED,
+                content,
+                tokenize = 'trigram'
+        );`,
+	`CREATE TABLE IF NOT EXISTS records_fts_trigram_datasets (
+                dataset TEXT PRIMARY KEY
+        );`,
+	`CREATE TRIGGER IF NOT EXISTS records_fts_trigram_insert AFTER INSERT ON records BEGIN
+                DELETE FROM records_fts_trigram_datasets WHERE dataset = NEW.dataset;
+        END;`,
+	`CREATE TRIGGER IF NOT EXISTS records_fts_trigram_update AFTER UPDATE ON records BEGIN
+                DELETE FROM records_fts_trigram_datasets WHERE dataset IN (OLD.dataset, NEW.dataset);
+        END;`,
+	`CREATE TRIGGER IF NOT EXISTS records_fts_trigram_delete AFTER DELETE ON records BEGIN
+                DELETE FROM records_fts_trigram_datasets WHERE dataset = OLD.dataset;
+        END;`,
+	// records_fts_vocab lists the terms of records_fts with the row of every
+	// occurrence, from which search.Engine.Suggest counts term frequencies.
+	`CREATE VIRTUAL TABLE IF NOT EXISTS records_fts_vocab USING fts5vocab(records_fts, 'instance');`,
 	`CREATE INDEX IF NOT EXISTS idx_records_dataset ON records(dataset);`,
+	`CREATE TABLE IF NOT EXISTS query_log (
+                id INTEGER PRIMARY KEY,
+                ts INTEGER NOT NULL,
+                source TEXT NOT NULL,
+                dataset TEXT NOT NULL,
+                query TEXT NOT NULL,
+                filters TEXT NOT NULL,
+                topk INTEGER NOT NULL,
+                latency_ms REAL NOT NULL,
+                results INTEGER NOT NULL,
+                top_ids TEXT NOT NULL,
+                top_scores TEXT NOT NULL,
+                error TEXT
+        );`,
+	`CREATE INDEX IF NOT EXISTS idx_query_log_ts ON query_log(ts);`,
+	// feedback holds the results users selected for their queries (see
+	// querylog.InsertFeedback); shown lists the ids displayed with it.
+	`CREATE TABLE IF NOT EXISTS feedback (
+                id INTEGER PRIMARY KEY,
+                ts INTEGER NOT NULL,
+                dataset TEXT NOT NULL,
+                query TEXT NOT NULL,
+                selected TEXT NOT NULL,
+                position INTEGER NOT NULL,
+                shown TEXT NOT NULL
+        );`,
+	`CREATE INDEX IF NOT EXISTS idx_feedback_dataset_ts ON feedback(dataset, ts);`,
+	// dataset_versions registers the named versions of a dataset (see
+	// store.PromoteVersion). The records of a version are stored under the
+	// dataset name "<dataset>@<version>", except for the live one.
+	`CREATE TABLE IF NOT EXISTS dataset_versions (
+                dataset TEXT NOT NULL,
+                version TEXT NOT NULL,
+                created_at INTEGER NOT NULL,
+                promoted_at INTEGER,
+                live INTEGER NOT NULL DEFAULT 0,
+                PRIMARY KEY(dataset, version)
+        );`,
+}
+
+// migration upgrades databases created by an older schema version. Each
+// migration must be idempotent because fresh databases already have the
+// current schema.
+type migration struct {
+	version int
+	apply   func(ctx context.Context, db *sql.DB) error
+}
+
+var migrations = []migration{
+	// Version 2 records which model produced each embedding.
+	{version: 2, apply: addColumn("records_vec", "model", "TEXT")},
+	// Version 3 records when each record was last written, in Unix
+	// milliseconds, for ordering ties by recency.
+	{version: 3, apply: addColumn("records", "updated_at", "INTEGER")},
+	// Version 4 keys the vector pages by their first id so that writes only
+	// invalidate the pages they touch.
+	{version: 4, apply: migrateVectorPages},
+}
+
+func addColumn(table, column, decl string) func(ctx context.Context, db *sql.DB) error {
+	return func(ctx context.Context, db *sql.DB) error {
+		exists, err := hasColumn(ctx, db, table, column)
+		if err != nil || exists {
+			return err
+		}
+		_, err = db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, decl))
+		return err
+	}
+}
+
+// migrateVectorPages drops the vector pages numbered by position, with the
+// triggers that dropped them on every write, and creates the current ones.
+// The pages are rebuilt by the next write to each dataset or by reindex.
+func migrateVectorPages(ctx context.Context, db *sql.DB) error {
+	numbered, err := hasColumn(ctx, db, "records_vec_pages", "page")
+	if err != nil || !numbered {
+		return err
+	}
+	for _, stmt := range []string{
+		`DROP TRIGGER IF EXISTS records_vec_pages_insert`,
+		`DROP TRIGGER IF EXISTS records_vec_pages_update`,
+		`DROP TRIGGER IF EXISTS records_vec_pages_delete`,
+		`DROP TABLE records_vec_pages`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return applySchema(ctx, db, schema)
+}
+
+// hasColumn reports whether table has column.
+func hasColumn(ctx context.Context, db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid     int
+			name    string
+			typ     string
+			notNull bool
+			dflt    sql.NullString
+			pk      int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+func applyMigrations(ctx context.Context, db *sql.DB, from int) error {
+	for _, m := range migrations {
+		if m.version <= from {
+			continue
+		}
+		if err := m.apply(ctx, db); err != nil {
+			return fmt.Errorf("migrate schema to version %d: %w", m.version, err)
+		}
+	}
+	return nil
 }
 
 func applySchema(ctx context.Context, db *sql.DB, statements []string) error {
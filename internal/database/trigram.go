@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// BuildTrigramIndex rewrites the trigram full-text index of dataset from
+// records_fts and marks it current, so that keyword searches routed to the
+// trigram tokenizer use it until the records of the dataset change again. It
+// returns the number of records indexed.
+func BuildTrigramIndex(ctx context.Context, db *sql.DB, dataset string) (int64, error) {
+	if db == nil {
+		return 0, fmt.Errorf("db is nil")
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM records_fts_trigram WHERE dataset = ?`, dataset); err != nil {
+		return 0, fmt.Errorf("build trigram index of %s: %w", dataset, err)
+	}
+	res, err := tx.ExecContext(ctx, `
+                INSERT INTO records_fts_trigram(rowid, dataset, id, content)
+                SELECT rowid, dataset, id, content FROM records_fts WHERE dataset = ?;
+        `, dataset)
+	if err != nil {
+		return 0, fmt.Errorf("build trigram index of %s: %w", dataset, err)
+	}
+	indexed, _ := res.RowsAffected()
+	if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO records_fts_trigram_datasets(dataset) VALUES(?)`, dataset); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return indexed, nil
+}
+
+// BuildAllTrigramIndexes runs BuildTrigramIndex for every dataset that has a
+// trigram index, current or not, and returns the total number of records
+// indexed.
+func BuildAllTrigramIndexes(ctx context.Context, db *sql.DB) (int64, error) {
+	return buildTrigramIndexes(ctx, db, nil)
+}
+
+// buildTrigramIndexes runs BuildTrigramIndex for the datasets in extra and
+// every dataset that has a trigram index.
+func buildTrigramIndexes(ctx context.Context, db *sql.DB, extra []string) (int64, error) {
+	if db == nil {
+		return 0, fmt.Errorf("db is nil")
+	}
+	rows, err := db.QueryContext(ctx, `
+                SELECT dataset FROM records_fts_trigram_datasets
+                UNION SELECT DISTINCT dataset FROM records_fts_trigram
+        `)
+	if err != nil {
+		return 0, err
+	}
+	datasets := make(map[string]bool, len(extra))
+	for _, dataset := range extra {
+		datasets[dataset] = true
+	}
+	for rows.Next() {
+		var dataset string
+		if err := rows.Scan(&dataset); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		datasets[dataset] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	names := make([]string, 0, len(datasets))
+	for dataset := range datasets {
+		names = append(names, dataset)
+	}
+	sort.Strings(names)
+	var total int64
+	for _, dataset := range names {
+		n, err := BuildTrigramIndex(ctx, db, dataset)
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
@@ -0,0 +1,58 @@
+// Package embedding defines the encoder abstraction shared by the ingest,
+// search and server packages.
+package embedding
+
+import "errors"
+
+// ErrUnknownModel is returned for a query that names an embedding model
+// that is not registered.
+var ErrUnknownModel = errors.New("unknown embedding model")
+
+// ErrModelMismatch is returned when a query would be encoded with another
+// model than the one that produced the embeddings it is compared with.
+var ErrModelMismatch = errors.New("embedding model does not match the dataset")
+
+// Embedder turns text into dense vectors. Implementations must be safe for
+// concurrent use.
+type Embedder interface {
+	Encode(text string) ([]float32, error)
+	EncodeBatch(texts []string) ([][]float32, error)
+	Dimension() int
+	Close() error
+}
+
+// SparseEmbedder is implemented by embedders that can also emit bge-m3 style
+// lexical weights (token id → weight) from the same forward pass.
+type SparseEmbedder interface {
+	Embedder
+	HasSparse() bool
+	EncodeHybrid(text string) ([]float32, map[int32]float32, error)
+}
+
+// TokenCounter is implemented by embedders that can report how many tokens
+// of a text they encode.
+type TokenCounter interface {
+	Embedder
+	CountsTokens() bool
+	CountTokens(text string) (int, error)
+}
+
+// Tokens reports whether e can count tokens and returns it as a
+// TokenCounter when it can.
+func Tokens(e Embedder) (TokenCounter, bool) {
+	c, ok := e.(TokenCounter)
+	if !ok || !c.CountsTokens() {
+		return nil, false
+	}
+	return c, true
+}
+
+// Sparse reports whether e can produce lexical weights and returns it as a
+// SparseEmbedder when it can.
+func Sparse(e Embedder) (SparseEmbedder, bool) {
+	s, ok := e.(SparseEmbedder)
+	if !ok || !s.HasSparse() {
+		return nil, false
+	}
+	return s, true
+}
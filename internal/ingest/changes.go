@@ -0,0 +1,78 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+)
+
+// changeSet classifies the records written by an ingest for Options.OnChange.
+type changeSet struct {
+	// previous holds the records stored before the ingest began.
+	previous map[string]storedHash
+	// written holds every ID written so far, so that an ID repeated within
+	// one ingest is reported as an update the second time.
+	written  map[string]bool
+	inserted []string
+	updated  []string
+}
+
+func newChangeSet(previous map[string]storedHash) *changeSet {
+	c := &changeSet{previous: make(map[string]storedHash, len(previous)), written: make(map[string]bool)}
+	for id, stored := range previous {
+		c.previous[id] = stored
+	}
+	return c
+}
+
+// lookup records whether id is stored, for callers that did not load the
+// hashes of the whole dataset.
+func (c *changeSet) lookup(ctx context.Context, tx *sql.Tx, dataset, id string) error {
+	if _, ok := c.previous[id]; ok || c.written[id] {
+		return nil
+	}
+	var hash sql.NullString
+	err := tx.QueryRowContext(ctx, `SELECT hash FROM records WHERE dataset = ? AND id = ?`, dataset, id).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.previous[id] = storedHash{hash: hash.String}
+	return nil
+}
+
+// add records that id was written with hash. An empty hash always counts as
+// a change.
+func (c *changeSet) add(id, hash string) {
+	prev, existed := c.previous[id]
+	switch {
+	case c.written[id]:
+		c.updated = append(c.updated, id)
+	case !existed:
+		c.inserted = append(c.inserted, id)
+	case hash == "" || prev.hash != hash:
+		c.updated = append(c.updated, id)
+	}
+	c.written[id] = true
+}
+
+// flush reports the changes recorded since the last flush. With replaced the
+// previous records that were not written again are reported as deleted.
+func (c *changeSet) flush(replaced bool, report func(inserted, updated, deleted []string)) {
+	var deleted []string
+	if replaced {
+		for id := range c.previous {
+			if !c.written[id] {
+				deleted = append(deleted, id)
+			}
+		}
+		sort.Strings(deleted)
+	}
+	if len(c.inserted) > 0 || len(c.updated) > 0 || len(deleted) > 0 {
+		report(c.inserted, c.updated, deleted)
+	}
+	c.inserted, c.updated = nil, nil
+}
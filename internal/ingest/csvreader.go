@@ -0,0 +1,75 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// utf8BOM is the byte order mark that Excel and Windows tools put at the
+// start of UTF-8 files.
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// newCSVReader returns a reader tolerant of the CSV files that spreadsheets
+// and older tools write: a UTF-8 byte order mark is dropped so that it does
+// not end up in the first column name, and CRLF as well as bare CR line
+// endings end records. Rows may have any number of fields.
+func newCSVReader(r io.Reader) *csv.Reader {
+	br := bufio.NewReader(r)
+	if head, err := br.Peek(len(utf8BOM)); err == nil && bytes.Equal(head, utf8BOM) {
+		_, _ = br.Discard(len(utf8BOM))
+	}
+	reader := csv.NewReader(&lineEndingReader{r: br})
+	reader.FieldsPerRecord = -1
+	return reader
+}
+
+// lineEndingReader turns every CR that is not followed by LF into LF;
+// encoding/csv itself only understands LF and CRLF.
+type lineEndingReader struct {
+	r *bufio.Reader
+}
+
+func (l *lineEndingReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	for i := 0; i < n; {
+		j := bytes.IndexByte(p[i:n], '\r')
+		if j < 0 {
+			break
+		}
+		i += j
+		if i+1 < n {
+			if p[i+1] != '\n' {
+				p[i] = '\n'
+			}
+		} else if next, perr := l.r.Peek(1); perr != nil || next[0] != '\n' {
+			p[i] = '\n'
+		}
+		i++
+	}
+	return n, err
+}
+
+// readHeader returns the first row that is not blank.
+func readHeader(reader *csv.Reader) ([]string, error) {
+	for {
+		header, err := reader.Read()
+		if err != nil || !blankRow(header) {
+			return header, err
+		}
+	}
+}
+
+// blankRow reports whether every field of a row is empty or whitespace, as
+// in the ",,," lines spreadsheets leave below the data. encoding/csv already
+// skips empty lines.
+func blankRow(values []string) bool {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
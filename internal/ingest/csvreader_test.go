@@ -0,0 +1,118 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"yashubustudio/csv-search/internal/database"
+)
+
+// lengthEmbedder encodes a text as its length, which is enough to store rows.
+type lengthEmbedder struct{}
+
+func (lengthEmbedder) Encode(text string) ([]float32, error) {
+	return []float32{float32(len(text)), 1}, nil
+}
+
+func (e lengthEmbedder) EncodeBatch(texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		out[i], _ = e.Encode(text)
+	}
+	return out, nil
+}
+
+func (lengthEmbedder) Dimension() int { return 2 }
+func (lengthEmbedder) Close() error   { return nil }
+
+func TestRunMessyCSV(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "messy", "*.csv"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no test files: %v", err)
+	}
+	want := map[string]map[string]string{
+		"1": {"id": "1", "title": "りんご", "price": "100"},
+		"2": {"id": "2", "title": "みかん\nと柚子", "price": "200"},
+		"3": {"id": "3", "title": "ぶどう", "price": "300"},
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			ctx := context.Background()
+			db, err := database.Open(filepath.Join(t.TempDir(), "app.db"))
+			if err != nil {
+				t.Fatalf("open db: %v", err)
+			}
+			defer db.Close()
+			if err := database.Init(ctx, db); err != nil {
+				t.Fatalf("init db: %v", err)
+			}
+
+			var stats Stats
+			err = Run(ctx, db, lengthEmbedder{}, Options{
+				CSVPath: file,
+				Dataset: "fruits",
+				Columns: ColumnConfig{ID: "id", Text: []string{"title"}, Metadata: []string{"title", "price"}},
+				Stats:   &stats,
+			})
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if stats.Upserted != len(want) {
+				t.Fatalf("expected %d rows, got %+v", len(want), stats)
+			}
+
+			rows, err := db.QueryContext(ctx, `SELECT id, data FROM records WHERE dataset = 'fruits'`)
+			if err != nil {
+				t.Fatalf("query: %v", err)
+			}
+			defer rows.Close()
+			got := map[string]map[string]string{}
+			for rows.Next() {
+				var id, data string
+				if err := rows.Scan(&id, &data); err != nil {
+					t.Fatalf("scan: %v", err)
+				}
+				var fields map[string]string
+				if err := json.Unmarshal([]byte(data), &fields); err != nil {
+					t.Fatalf("decode %s: %v", id, err)
+				}
+				got[id] = fields
+			}
+			if err := rows.Err(); err != nil {
+				t.Fatalf("rows: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("unexpected records:\n got %v\nwant %v", got, want)
+			}
+		})
+	}
+}
+
+func TestLineEndingReader(t *testing.T) {
+	for input, want := range map[string]string{
+		"a\rb\r\nc\r": "a\nb\r\nc\n",
+		"\r\r\n":      "\n\r\n",
+		"no breaks":   "no breaks",
+	} {
+		var out strings.Builder
+		// Read through a one-byte buffer so that every CR sits at the end of
+		// a chunk and needs the look-ahead.
+		r := &lineEndingReader{r: bufio.NewReader(strings.NewReader(input))}
+		buf := make([]byte, 1)
+		for {
+			n, err := r.Read(buf)
+			out.Write(buf[:n])
+			if err != nil {
+				break
+			}
+		}
+		if out.String() != want {
+			t.Fatalf("%q: got %q, want %q", input, out.String(), want)
+		}
+	}
+}
@@ -4,18 +4,21 @@ import (
 	"context"
 	"crypto/sha256"
 	"database/sql"
-	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
+	"log/slog"
 	"os"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
-	"yashubustudio/csv-search/emb"
+	"yashubustudio/csv-search/internal/database"
+	"yashubustudio/csv-search/internal/embedding"
+	"yashubustudio/csv-search/internal/store"
 	"yashubustudio/csv-search/internal/vector"
 )
 
@@ -32,14 +35,107 @@ type ColumnConfig struct {
 	Lng      string
 }
 
-// Options control the ingest process.
+// Options control the ingest process. When Sparse is set the encoder must
+// provide bge-m3 lexical weights, which are stored in records_sparse alongside
+// the dense embedding.
 type Options struct {
 	CSVPath   string
 	BatchSize int
 	Dataset   string
 	Columns   ColumnConfig
+	Sparse    bool
+	// Model identifies the encoder model; it is stored with every embedding
+	// so that Reembed can find vectors produced by another model.
+	Model string
+	// Replace removes every existing record of the dataset before loading,
+	// so rows missing from the CSV do not survive a full refresh. The removal
+	// and the whole load then run in a single transaction (BatchSize is
+	// ignored) and a failed ingest leaves the previous contents in place.
+	Replace bool
+	// Prune deletes, once the rows are loaded, the records of the dataset
+	// whose IDs the CSV does not have. Unlike Replace it keeps the embeddings
+	// of unchanged rows; the deletion is a transaction of its own. It is
+	// ignored together with Replace.
+	Prune bool
+	// HashDataset is the dataset name that content hashes are computed with
+	// (Dataset when empty). Datasets holding copies of one another use the
+	// same name so that unchanged rows are recognised in each of them.
+	HashDataset string
+	// Stats, when set, receives the number of rows written and skipped.
+	Stats *Stats
+	// Transform, when set, sees every parsed row before it is hashed and
+	// stored. It may edit the row in place or return false to drop it; an
+	// error stops the ingest.
+	Transform func(ctx context.Context, row *Row) (bool, error)
+	// Logger receives per-row debug messages (slog.Default() when nil).
+	Logger *slog.Logger
+	// OnCommit, when set, is called after every committed transaction with
+	// the number of rows it upserted and the time since it began.
+	OnCommit func(rows int, elapsed time.Duration)
+	// OnChange, when set, is called after every committed transaction with
+	// the IDs of the records it inserted and updated and, with Replace or
+	// Prune, of the records the new contents no longer have. Records rewritten with
+	// unchanged content are not reported.
+	OnChange func(inserted, updated, deleted []string)
+	// Duplicates decides what happens to a row whose ID appeared on an
+	// earlier row of the same file: DuplicatesLast (the default when empty),
+	// DuplicatesFirst or DuplicatesError.
+	Duplicates string
 }
 
+// Policies for rows repeating an ID within one CSV file.
+const (
+	// DuplicatesLast stores every row, so the last one with an ID wins.
+	DuplicatesLast = "last"
+	// DuplicatesFirst keeps the first row with an ID and ignores the others.
+	DuplicatesFirst = "first"
+	// DuplicatesError fails the ingest at the first repeated ID.
+	DuplicatesError = "error"
+)
+
+// ValidateDuplicates reports whether policy is accepted by
+// Options.Duplicates.
+func ValidateDuplicates(policy string) error {
+	switch policy {
+	case "", DuplicatesLast, DuplicatesFirst, DuplicatesError:
+		return nil
+	}
+	return fmt.Errorf("unknown duplicates policy %q (want last, first or error)", policy)
+}
+
+// Row is a parsed CSV row as passed to Options.Transform. Text holds the
+// non-empty values of the text columns, joined with spaces for embedding.
+// Rows passed to Write may carry a precomputed Embedding (with its Sparse
+// weights and Model); it is stored as is instead of encoding Text, and the
+// row is written even when its content is unchanged.
+type Row struct {
+	ID        string
+	Text      []string
+	Metadata  map[string]string
+	Lat       *float64
+	Lng       *float64
+	Embedding []float32
+	Sparse    map[int32]float32
+	Model     string
+}
+
+// Stats summarise an ingest run.
+type Stats struct {
+	// Upserted counts rows that were embedded and written.
+	Upserted int
+	// Skipped counts rows whose content hash was unchanged.
+	Skipped int
+	// Removed counts the records deleted by Replace before loading or by
+	// Prune after it.
+	Removed int
+	// Dropped counts rows rejected by Transform.
+	Dropped int
+	// Duplicates counts rows whose ID appeared on an earlier row of the file.
+	Duplicates int
+}
+
+var errNoSparseHead = errors.New("sparse weights requested but the encoder has no sparse head")
+
 type columnIndex struct {
 	Name  string
 	Index int
@@ -59,12 +155,22 @@ type record struct {
 	TextParts []string
 	Lat       *float64
 	Lng       *float64
+	// Embedding, Sparse and Model are set for rows with precomputed vectors.
+	Embedding []float32
+	Sparse    map[int32]float32
+	Model     string
 }
 
 // Run reads the CSV file at opts.CSVPath, converts records into database rows
 // and stores them with embeddings generated via enc. The caller must provide an
-// initialized encoder (see emb.Encoder).
-func Run(ctx context.Context, db *sql.DB, enc *emb.Encoder, opts Options) error {
+// initialized embedder.
+//
+// Parsing, encoding and writing run as a pipeline of three goroutines joined
+// by bounded channels, so that the CSV is read while earlier rows are being
+// encoded and committed. Transform runs on the reader goroutine. Unchanged
+// rows are detected against the hashes stored before the run starts. The
+// vector pages of the dataset are rebuilt once the rows are committed.
+func Run(ctx context.Context, db *sql.DB, enc embedding.Embedder, opts Options) error {
 	if opts.CSVPath == "" {
 		return errors.New("csv path is required")
 	}
@@ -74,11 +180,21 @@ func Run(ctx context.Context, db *sql.DB, enc *emb.Encoder, opts Options) error
 	if enc == nil {
 		return errors.New("encoder is nil")
 	}
+	if _, hasSparse := embedding.Sparse(enc); opts.Sparse && !hasSparse {
+		return errNoSparseHead
+	}
+	if err := ValidateDuplicates(opts.Duplicates); err != nil {
+		return err
+	}
 
 	dataset := strings.TrimSpace(opts.Dataset)
 	if dataset == "" {
 		dataset = "default"
 	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
 
 	file, err := os.Open(opts.CSVPath)
 	if err != nil {
@@ -86,10 +202,8 @@ func Run(ctx context.Context, db *sql.DB, enc *emb.Encoder, opts Options) error
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
-	reader.FieldsPerRecord = -1
-
-	header, err := reader.Read()
+	reader := newCSVReader(file)
+	header, err := readHeader(reader)
 	if err != nil {
 		return fmt.Errorf("read header: %w", err)
 	}
@@ -102,61 +216,137 @@ func Run(ctx context.Context, db *sql.DB, enc *emb.Encoder, opts Options) error
 	if batchSize <= 0 {
 		batchSize = 1000
 	}
+	prune := opts.Prune && !opts.Replace
+
+	// The stored hashes are read before the transaction starts because the
+	// stages must not query the database while the writer holds it.
+	known := map[string]storedHash{}
+	if !opts.Replace || opts.OnChange != nil {
+		if known, err = loadHashes(ctx, db, dataset); err != nil {
+			return fmt.Errorf("load hashes: %w", err)
+		}
+	}
+	// stale starts with every stored ID; the IDs of the CSV are struck off
+	// as their rows arrive.
+	var stale map[string]bool
+	if prune {
+		stale = make(map[string]bool, len(known))
+		for id := range known {
+			stale[id] = true
+		}
+	}
+	// readRows updates known, so the changes are classified against a copy.
+	var changes *changeSet
+	if opts.OnChange != nil {
+		changes = newChangeSet(known)
+	}
+	if opts.Replace {
+		known = map[string]storedHash{}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	// Stop the stages and wait for them so that enc is not used after Run
+	// returns.
+	defer wg.Wait()
+	defer cancel()
+	parsed := make(chan *pipelineItem, pipelineDepth)
+	encoded := make(chan *pipelineItem, pipelineDepth)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		readRows(ctx, reader, idx, opts, hashDataset(opts, dataset), known, parsed)
+	}()
+	go func() {
+		defer wg.Done()
+		encodeRows(ctx, enc, opts.Sparse, parsed, encoded)
+	}()
 
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	rowsProcessed := 0
+	batchStart, committed := time.Now(), 0
+	commit := func() error {
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		if opts.OnCommit != nil {
+			opts.OnCommit(rowsProcessed-committed, time.Since(batchStart))
+		}
+		if changes != nil {
+			changes.flush(opts.Replace, opts.OnChange)
+		}
+		batchStart, committed = time.Now(), rowsProcessed
+		return nil
+	}
 	defer func() {
 		if tx != nil {
 			_ = tx.Rollback()
 		}
 	}()
 
-	rowsProcessed := 0
-	line := 1 // header already read
-	for {
-		recordValues, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
-		line++
+	if opts.Replace {
+		removed, err := store.ClearDataset(ctx, tx, dataset)
 		if err != nil {
-			return fmt.Errorf("read row %d: %w", line, err)
+			return fmt.Errorf("replace dataset %s: %w", dataset, err)
 		}
-
-		rec, err := buildRecord(recordValues, idx)
-		if err != nil {
-			return fmt.Errorf("row %d: %w", line, err)
+		if opts.Stats != nil {
+			opts.Stats.Removed = int(removed)
 		}
-		hash := hashRecord(dataset, rec)
+		logger.DebugContext(ctx, "ingest dataset truncated", "dataset", dataset, "records", removed)
+	}
 
-		skip, err := shouldSkip(ctx, tx, dataset, rec.ID, hash)
-		if err != nil {
-			return fmt.Errorf("row %d: %w", line, err)
+	duplicates := 0
+	for it := range encoded {
+		if it.err != nil {
+			return it.err
+		}
+		rec := it.rec
+		if stale != nil && !it.dropped {
+			delete(stale, rec.ID)
 		}
-		if skip {
+		if it.firstLine > 0 {
+			duplicates++
+			if opts.Stats != nil {
+				opts.Stats.Duplicates++
+			}
+			logger.DebugContext(ctx, "ingest row repeats an id", "dataset", dataset, "line", it.line, "id", rec.ID, "first_line", it.firstLine)
+			if it.ignored {
+				continue
+			}
+		}
+		if it.dropped {
+			if opts.Stats != nil {
+				opts.Stats.Dropped++
+			}
+			logger.DebugContext(ctx, "ingest row dropped", "dataset", dataset, "line", it.line, "id", rec.ID)
 			continue
 		}
-
-		text := embeddingText(rec)
-		var embedding []float32
-		if strings.TrimSpace(text) != "" {
-			embedding, err = enc.Encode(text)
-			if err != nil {
-				return fmt.Errorf("row %d encode: %w", line, err)
+		if it.unchanged {
+			if opts.Stats != nil {
+				opts.Stats.Skipped++
 			}
+			logger.DebugContext(ctx, "ingest row unchanged", "dataset", dataset, "line", it.line, "id", rec.ID)
+			continue
 		}
-
-		if err := upsertRecord(ctx, tx, dataset, rec, hash, embedding); err != nil {
-			return fmt.Errorf("row %d: %w", line, err)
+		if err := upsertRecord(ctx, tx, dataset, rec, it.hash, it.dense, it.sparse, opts.Model); err != nil {
+			return fmt.Errorf("row %d: %w", it.line, err)
 		}
-
+		if changes != nil {
+			changes.add(rec.ID, it.hash)
+		}
+		logger.DebugContext(ctx, "ingest row upserted", "dataset", dataset, "line", it.line, "id", rec.ID, "text_chars", len([]rune(embeddingText(rec))), "sparse", it.sparse != nil)
 		rowsProcessed++
-		if rowsProcessed%batchSize == 0 {
-			if err := tx.Commit(); err != nil {
+		if opts.Stats != nil {
+			opts.Stats.Upserted++
+		}
+		if !opts.Replace && rowsProcessed%batchSize == 0 {
+			if err := commit(); err != nil {
 				return err
 			}
+			logger.DebugContext(ctx, "ingest batch committed", "dataset", dataset, "rows", rowsProcessed)
 			tx = nil
 			tx, err = db.BeginTx(ctx, nil)
 			if err != nil {
@@ -164,16 +354,226 @@ func Run(ctx context.Context, db *sql.DB, enc *emb.Encoder, opts Options) error
 			}
 		}
 	}
+	// The stages also stop early when ctx is canceled.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	if tx != nil {
-		if err := tx.Commit(); err != nil {
+		if err := commit(); err != nil {
 			return err
 		}
 		tx = nil
 	}
+	removed := 0
+	if len(stale) > 0 {
+		if removed, err = pruneDataset(ctx, db, dataset, stale, opts.OnChange); err != nil {
+			return fmt.Errorf("prune dataset %s: %w", dataset, err)
+		}
+		if opts.Stats != nil {
+			opts.Stats.Removed = removed
+		}
+		logger.DebugContext(ctx, "ingest dataset pruned", "dataset", dataset, "records", removed)
+	}
+	if rowsProcessed > 0 || removed > 0 || opts.Replace {
+		if _, err := database.UpdateVectorPages(ctx, db, dataset); err != nil {
+			return err
+		}
+	}
+	if duplicates > 0 {
+		policy := opts.Duplicates
+		if policy == "" {
+			policy = DuplicatesLast
+		}
+		logger.WarnContext(ctx, "ingest found repeated ids", "dataset", dataset, "rows", duplicates, "policy", policy)
+	}
 	return nil
 }
 
+// Write stores rows in a single transaction the way Run stores the rows of a
+// CSV file: Transform runs first, rows whose content is unchanged are skipped
+// and the others are embedded and upserted. CSVPath, Columns, BatchSize and
+// Replace are not used. On error nothing is written. enc may be nil when
+// every row with text carries its Embedding.
+func Write(ctx context.Context, db *sql.DB, enc embedding.Embedder, opts Options, rows []Row) error {
+	if db == nil {
+		return errors.New("db is nil")
+	}
+	if _, hasSparse := embedding.Sparse(enc); enc != nil && opts.Sparse && !hasSparse {
+		return errNoSparseHead
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	dataset := strings.TrimSpace(opts.Dataset)
+	if dataset == "" {
+		dataset = "default"
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	began := time.Now()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var (
+		stats   Stats
+		changes *changeSet
+	)
+	if opts.OnChange != nil {
+		changes = newChangeSet(nil)
+	}
+	for i, row := range rows {
+		rec, err := row.record()
+		if err != nil {
+			return fmt.Errorf("row %d: %w", i+1, err)
+		}
+		if opts.Transform != nil {
+			keep, err := transformRecord(ctx, rec, opts.Transform)
+			if err != nil {
+				return fmt.Errorf("row %d: %w", i+1, err)
+			}
+			if !keep {
+				stats.Dropped++
+				logger.DebugContext(ctx, "ingest row dropped", "dataset", dataset, "id", rec.ID)
+				continue
+			}
+		}
+		if changes != nil {
+			if err := changes.lookup(ctx, tx, dataset, rec.ID); err != nil {
+				return fmt.Errorf("row %d (id %s): %w", i+1, rec.ID, err)
+			}
+		}
+		stored, sparse, err := storeRecord(ctx, tx, enc, opts, dataset, rec)
+		if err != nil {
+			return fmt.Errorf("row %d (id %s): %w", i+1, rec.ID, err)
+		}
+		if !stored {
+			stats.Skipped++
+			logger.DebugContext(ctx, "ingest row unchanged", "dataset", dataset, "id", rec.ID)
+			continue
+		}
+		if changes != nil {
+			changes.add(rec.ID, "")
+		}
+		logger.DebugContext(ctx, "ingest row upserted", "dataset", dataset, "id", rec.ID, "text_chars", len([]rune(embeddingText(rec))), "sparse", sparse)
+		stats.Upserted++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	tx = nil
+	if opts.OnCommit != nil {
+		opts.OnCommit(stats.Upserted, time.Since(began))
+	}
+	if changes != nil {
+		changes.flush(false, opts.OnChange)
+	}
+	if opts.Stats != nil {
+		opts.Stats.Upserted += stats.Upserted
+		opts.Stats.Skipped += stats.Skipped
+		opts.Stats.Dropped += stats.Dropped
+	}
+	logger.DebugContext(ctx, "ingest batch committed", "dataset", dataset, "rows", stats.Upserted)
+	return nil
+}
+
+// storeRecord writes rec with its embeddings unless the stored copy has the
+// same content hash. It reports whether rec was written and whether lexical
+// weights were stored with it.
+func storeRecord(ctx context.Context, tx *sql.Tx, enc embedding.Embedder, opts Options, dataset string, rec *record) (bool, bool, error) {
+	hash := hashRecord(hashDataset(opts, dataset), rec)
+	text := embeddingText(rec)
+	if rec.Embedding != nil {
+		if err := upsertRecord(ctx, tx, dataset, rec, hash, rec.Embedding, rec.Sparse, rec.Model); err != nil {
+			return false, false, err
+		}
+		return true, len(rec.Sparse) > 0, nil
+	}
+
+	wantSparse := opts.Sparse && strings.TrimSpace(text) != ""
+	skip, err := shouldSkip(ctx, tx, dataset, rec.ID, hash, wantSparse)
+	if err != nil || skip {
+		return false, false, err
+	}
+
+	var (
+		dense  []float32
+		sparse map[int32]float32
+	)
+	if strings.TrimSpace(text) != "" {
+		if enc == nil {
+			return false, false, errors.New("encoder is nil")
+		}
+		if dense, sparse, err = encodeText(enc, text, opts.Sparse); err != nil {
+			return false, false, fmt.Errorf("encode: %w", err)
+		}
+	}
+
+	if err := upsertRecord(ctx, tx, dataset, rec, hash, dense, sparse, opts.Model); err != nil {
+		return false, false, err
+	}
+	return true, sparse != nil, nil
+}
+
+// hashDataset returns the name the content hashes of dataset are computed
+// with.
+func hashDataset(opts Options, dataset string) string {
+	if name := strings.TrimSpace(opts.HashDataset); name != "" {
+		return name
+	}
+	return dataset
+}
+
+// pruneDataset deletes the records of dataset with the given IDs in one
+// transaction and reports them to onChange.
+func pruneDataset(ctx context.Context, db *sql.DB, dataset string, ids map[string]bool, onChange func(inserted, updated, deleted []string)) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	deleted := make([]string, 0, len(ids))
+	for id := range ids {
+		for _, query := range []string{
+			`DELETE FROM records_fts WHERE rowid IN (SELECT rowid FROM records WHERE dataset = ? AND id = ?)`,
+			`DELETE FROM records_rtree WHERE rowid IN (SELECT rowid FROM records WHERE dataset = ? AND id = ?)`,
+		} {
+			if _, err := tx.ExecContext(ctx, query, dataset, id); err != nil {
+				return 0, err
+			}
+		}
+		res, err := tx.ExecContext(ctx, `DELETE FROM records WHERE dataset = ? AND id = ?`, dataset, id)
+		if err != nil {
+			return 0, err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return 0, err
+		} else if n > 0 {
+			deleted = append(deleted, id)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	sort.Strings(deleted)
+	if onChange != nil && len(deleted) > 0 {
+		onChange(nil, nil, deleted)
+	}
+	return len(deleted), nil
+}
+
 func resolveColumns(header []string, opts Options) (columnIndexes, error) {
 	lookup := make(map[string]columnIndex, len(header))
 	normalized := make([]string, len(header))
@@ -352,6 +752,59 @@ func buildRecord(row []string, idx columnIndexes) (*record, error) {
 	return rec, nil
 }
 
+// transformRecord passes rec through transform as a Row and copies the edits
+// back.
+func transformRecord(ctx context.Context, rec *record, transform func(context.Context, *Row) (bool, error)) (bool, error) {
+	row := Row{
+		ID:        rec.ID,
+		Text:      rec.TextParts,
+		Metadata:  rec.Metadata,
+		Lat:       rec.Lat,
+		Lng:       rec.Lng,
+		Embedding: rec.Embedding,
+		Sparse:    rec.Sparse,
+		Model:     rec.Model,
+	}
+	keep, err := transform(ctx, &row)
+	if err != nil || !keep {
+		return false, err
+	}
+	updated, err := row.record()
+	if err != nil {
+		return false, fmt.Errorf("%w after transform", err)
+	}
+	*rec = *updated
+	return true, nil
+}
+
+// record converts r to its stored form: the ID is trimmed and required, and
+// blank text values are dropped.
+func (r Row) record() (*record, error) {
+	id := strings.TrimSpace(r.ID)
+	if id == "" {
+		return nil, errors.New("id is empty")
+	}
+	rec := &record{
+		ID:        id,
+		Metadata:  r.Metadata,
+		TextParts: make([]string, 0, len(r.Text)),
+		Lat:       r.Lat,
+		Lng:       r.Lng,
+		Embedding: r.Embedding,
+		Sparse:    r.Sparse,
+		Model:     r.Model,
+	}
+	for _, part := range r.Text {
+		if strings.TrimSpace(part) != "" {
+			rec.TextParts = append(rec.TextParts, part)
+		}
+	}
+	if rec.Metadata == nil {
+		rec.Metadata = map[string]string{}
+	}
+	return rec, nil
+}
+
 func parseFloat(val string) (*float64, error) {
 	if strings.TrimSpace(val) == "" {
 		return nil, nil
@@ -384,15 +837,28 @@ func hashRecord(dataset string, rec *record) string {
 	return hex.EncodeToString(sum[:])
 }
 
-func shouldSkip(ctx context.Context, tx *sql.Tx, dataset, id, hash string) (bool, error) {
-	var existing sql.NullString
-	err := tx.QueryRowContext(ctx, `SELECT hash FROM records WHERE dataset = ? AND id = ?`, dataset, id).Scan(&existing)
+// shouldSkip reports whether the stored record already matches hash. When
+// sparse weights are requested the record is only skipped if they exist too, so
+// enabling sparse on an existing dataset backfills the weights.
+func shouldSkip(ctx context.Context, tx *sql.Tx, dataset, id, hash string, sparse bool) (bool, error) {
+	var (
+		existing  sql.NullString
+		hasSparse bool
+	)
+	err := tx.QueryRowContext(ctx, `
+                SELECT r.hash, EXISTS(SELECT 1 FROM records_sparse AS s WHERE s.dataset = r.dataset AND s.id = r.id)
+                FROM records AS r
+                WHERE r.dataset = ? AND r.id = ?
+        `, dataset, id).Scan(&existing, &hasSparse)
 	if errors.Is(err, sql.ErrNoRows) {
 		return false, nil
 	}
 	if err != nil {
 		return false, err
 	}
+	if sparse && !hasSparse {
+		return false, nil
+	}
 	if existing.Valid && existing.String == hash {
 		return true, nil
 	}
@@ -414,7 +880,7 @@ func metadataJSON(metadata map[string]string) (string, error) {
 	return string(buf), nil
 }
 
-func upsertRecord(ctx context.Context, tx *sql.Tx, dataset string, rec *record, hash string, embedding []float32) error {
+func upsertRecord(ctx context.Context, tx *sql.Tx, dataset string, rec *record, hash string, embedding []float32, sparse map[int32]float32, model string) error {
 	metaJSON, err := metadataJSON(rec.Metadata)
 	if err != nil {
 		return err
@@ -422,13 +888,14 @@ func upsertRecord(ctx context.Context, tx *sql.Tx, dataset string, rec *record,
 
 	_, err = tx.ExecContext(ctx, `
                 INSERT INTO records(
-                        dataset, id, data, lat, lng, hash
-                ) VALUES(?, ?, ?, ?, ?, ?)
+                        dataset, id, data, lat, lng, hash, updated_at
+                ) VALUES(?, ?, ?, ?, ?, ?, ?)
                 ON CONFLICT(dataset, id) DO UPDATE SET
                         data=excluded.data,
                         lat=excluded.lat,
                         lng=excluded.lng,
-                        hash=excluded.hash;
+                        hash=excluded.hash,
+                        updated_at=excluded.updated_at;
         `,
 		dataset,
 		rec.ID,
@@ -436,6 +903,7 @@ func upsertRecord(ctx context.Context, tx *sql.Tx, dataset string, rec *record,
 		nullFloat(rec.Lat),
 		nullFloat(rec.Lng),
 		hash,
+		time.Now().UnixMilli(),
 	)
 	if err != nil {
 		return err
@@ -476,16 +944,40 @@ func upsertRecord(ctx context.Context, tx *sql.Tx, dataset string, rec *record,
 		}
 	}
 
+	return writeEmbeddings(ctx, tx, dataset, rec.ID, embedding, sparse, model)
+}
+
+// writeEmbeddings stores (or clears, when empty) the dense and sparse vectors
+// of a record together with the model that produced them.
+func writeEmbeddings(ctx context.Context, tx *sql.Tx, dataset, id string, embedding []float32, sparse map[int32]float32, model string) error {
+	// The blobs are encoded into pooled buffers: the driver has copied them
+	// once the statement returns.
+	buf := vector.GetBytes()
+	defer vector.PutBytes(buf)
 	if len(embedding) > 0 {
-		blob := vector.Serialize(embedding)
+		*buf = vector.SerializeInto((*buf)[:0], embedding)
 		if _, err := tx.ExecContext(ctx, `
-                        INSERT INTO records_vec(dataset, id, embedding) VALUES(?, ?, ?)
-                        ON CONFLICT(dataset, id) DO UPDATE SET embedding=excluded.embedding;
-                `, dataset, rec.ID, blob); err != nil {
+                        INSERT INTO records_vec(dataset, id, embedding, model) VALUES(?, ?, ?, ?)
+                        ON CONFLICT(dataset, id) DO UPDATE SET embedding=excluded.embedding, model=excluded.model;
+                `, dataset, id, *buf, nullString(model)); err != nil {
 			return err
 		}
 	} else {
-		if _, err := tx.ExecContext(ctx, `DELETE FROM records_vec WHERE dataset = ? AND id = ?`, dataset, rec.ID); err != nil {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM records_vec WHERE dataset = ? AND id = ?`, dataset, id); err != nil {
+			return err
+		}
+	}
+
+	if len(sparse) > 0 {
+		blob := vector.SerializeSparse(sparse)
+		if _, err := tx.ExecContext(ctx, `
+                        INSERT INTO records_sparse(dataset, id, weights) VALUES(?, ?, ?)
+                        ON CONFLICT(dataset, id) DO UPDATE SET weights=excluded.weights;
+                `, dataset, id, blob); err != nil {
+			return err
+		}
+	} else {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM records_sparse WHERE dataset = ? AND id = ?`, dataset, id); err != nil {
 			return err
 		}
 	}
@@ -493,6 +985,13 @@ func upsertRecord(ctx context.Context, tx *sql.Tx, dataset string, rec *record,
 	return nil
 }
 
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
 func nullFloat(v *float64) any {
 	if v == nil {
 		return nil
@@ -0,0 +1,98 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"yashubustudio/csv-search/internal/database"
+)
+
+func TestRunDuplicates(t *testing.T) {
+	const csvData = "id,title\n1,apple\n2,orange\n1,grape\n3,melon\n1,peach\n"
+	cases := []struct {
+		policy string
+		want   string // title stored for id 1
+	}{
+		{policy: "", want: "peach"},
+		{policy: DuplicatesLast, want: "peach"},
+		{policy: DuplicatesFirst, want: "apple"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.policy, func(t *testing.T) {
+			ctx := context.Background()
+			db := openTestDB(t)
+			var stats Stats
+			err := Run(ctx, db, lengthEmbedder{}, Options{
+				CSVPath:    writeTestCSV(t, csvData),
+				Dataset:    "fruits",
+				Columns:    ColumnConfig{ID: "id", Text: []string{"title"}, Metadata: []string{"title"}},
+				Stats:      &stats,
+				Duplicates: tc.policy,
+			})
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if stats.Duplicates != 2 {
+				t.Fatalf("expected 2 duplicate rows, got %+v", stats)
+			}
+			var title string
+			if err := db.QueryRowContext(ctx, `SELECT json_extract(data, '$.title') FROM records WHERE dataset = 'fruits' AND id = '1'`).Scan(&title); err != nil {
+				t.Fatalf("query: %v", err)
+			}
+			if title != tc.want {
+				t.Fatalf("expected %q for id 1, got %q", tc.want, title)
+			}
+		})
+	}
+
+	t.Run(DuplicatesError, func(t *testing.T) {
+		ctx := context.Background()
+		db := openTestDB(t)
+		err := Run(ctx, db, lengthEmbedder{}, Options{
+			CSVPath:    writeTestCSV(t, csvData),
+			Dataset:    "fruits",
+			Columns:    ColumnConfig{ID: "id", Text: []string{"title"}},
+			Duplicates: DuplicatesError,
+		})
+		if err == nil || !strings.Contains(err.Error(), `row 4: duplicate id "1" (first seen on row 2)`) {
+			t.Fatalf("expected duplicate id error, got %v", err)
+		}
+		var count int
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM records`).Scan(&count); err != nil {
+			t.Fatalf("count: %v", err)
+		}
+		if count != 0 {
+			t.Fatalf("expected nothing stored, got %d records", count)
+		}
+	})
+
+	if err := ValidateDuplicates("newest"); err == nil {
+		t.Fatal("expected an unknown policy to be rejected")
+	}
+}
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := database.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.Init(context.Background(), db); err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	return db
+}
+
+func writeTestCSV(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data.csv")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	return path
+}
@@ -0,0 +1,176 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"yashubustudio/csv-search/internal/embedding"
+)
+
+// pipelineDepth is the number of rows buffered between two stages of Run. A
+// full buffer blocks the stage before it, so a slow encoder or commit holds
+// back CSV parsing instead of piling rows up in memory.
+const pipelineDepth = 64
+
+// pipelineItem is a CSV row travelling through the stages of Run. The first
+// stage that fails sets err; later stages pass the item on untouched so that
+// the writer reports errors in file order.
+type pipelineItem struct {
+	line      int
+	firstLine int // earlier line with the same ID, zero when the ID is new
+	rec       *record
+	hash      string
+	dropped   bool
+	ignored   bool // repeated ID under DuplicatesFirst
+	unchanged bool
+	dense     []float32
+	sparse    map[int32]float32
+	err       error
+}
+
+// storedHash is the content hash of a stored record and whether it has
+// lexical weights.
+type storedHash struct {
+	hash   string
+	sparse bool
+}
+
+// loadHashes returns the stored hashes of dataset, which the reader stage
+// compares rows against so that unchanged rows skip the encoder.
+func loadHashes(ctx context.Context, db *sql.DB, dataset string) (map[string]storedHash, error) {
+	rows, err := db.QueryContext(ctx, `
+                SELECT r.id, COALESCE(r.hash, ''), s.id IS NOT NULL
+                FROM records AS r
+                LEFT JOIN records_sparse AS s ON s.dataset = r.dataset AND s.id = r.id
+                WHERE r.dataset = ?
+        `, dataset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	known := make(map[string]storedHash)
+	for rows.Next() {
+		var (
+			id     string
+			stored storedHash
+		)
+		if err := rows.Scan(&id, &stored.hash, &stored.sparse); err != nil {
+			return nil, err
+		}
+		known[id] = stored
+	}
+	return known, rows.Err()
+}
+
+// readRows is the first stage of Run: it parses the CSV rows, applies
+// Transform and marks the rows whose content matches known. known is updated
+// as rows are read, so a repeated ID is compared with its earlier row; how
+// such a row is treated follows opts.Duplicates.
+func readRows(ctx context.Context, reader *csv.Reader, idx columnIndexes, opts Options, hashName string, known map[string]storedHash, out chan<- *pipelineItem) {
+	defer close(out)
+	send := func(it *pipelineItem) bool {
+		select {
+		case out <- it:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	line := 1 // header already read
+	seen := make(map[string]int)
+	for {
+		values, err := reader.Read()
+		if err == io.EOF {
+			return
+		}
+		line++
+		it := &pipelineItem{line: line}
+		if err != nil {
+			it.err = fmt.Errorf("read row %d: %w", line, err)
+			send(it)
+			return
+		}
+		if blankRow(values) {
+			continue
+		}
+
+		it.rec, err = buildRecord(values, idx)
+		if err == nil && opts.Transform != nil {
+			var keep bool
+			keep, err = transformRecord(ctx, it.rec, opts.Transform)
+			it.dropped = err == nil && !keep
+		}
+		if err != nil {
+			it.err = fmt.Errorf("row %d: %w", line, err)
+			send(it)
+			return
+		}
+		if !it.dropped {
+			if first, ok := seen[it.rec.ID]; ok {
+				it.firstLine = first
+				switch opts.Duplicates {
+				case DuplicatesError:
+					it.err = fmt.Errorf("row %d: duplicate id %q (first seen on row %d)", line, it.rec.ID, first)
+					send(it)
+					return
+				case DuplicatesFirst:
+					it.ignored = true
+				}
+			} else {
+				seen[it.rec.ID] = line
+			}
+		}
+		if !it.dropped && !it.ignored {
+			it.hash = hashRecord(hashName, it.rec)
+			wantSparse := opts.Sparse && strings.TrimSpace(embeddingText(it.rec)) != ""
+			prev, ok := known[it.rec.ID]
+			it.unchanged = ok && prev.hash == it.hash && (!wantSparse || prev.sparse)
+			if !it.unchanged {
+				known[it.rec.ID] = storedHash{hash: it.hash, sparse: wantSparse}
+			}
+		}
+		if !send(it) {
+			return
+		}
+	}
+}
+
+// encodeRows is the second stage of Run: it embeds the text of every row
+// that is going to be written.
+func encodeRows(ctx context.Context, enc embedding.Embedder, sparse bool, in <-chan *pipelineItem, out chan<- *pipelineItem) {
+	defer close(out)
+	for it := range in {
+		if it.err == nil && !it.dropped && !it.ignored && !it.unchanged {
+			if text := embeddingText(it.rec); strings.TrimSpace(text) != "" {
+				var err error
+				if it.dense, it.sparse, err = encodeText(enc, text, sparse); err != nil {
+					it.err = fmt.Errorf("row %d: encode: %w", it.line, err)
+				}
+			}
+		}
+		select {
+		case out <- it:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// encodeText embeds text with enc, together with its lexical weights when
+// sparse is set.
+func encodeText(enc embedding.Embedder, text string, sparse bool) ([]float32, map[int32]float32, error) {
+	if !sparse {
+		dense, err := enc.Encode(text)
+		return dense, nil, err
+	}
+	sparseEnc, ok := embedding.Sparse(enc)
+	if !ok {
+		return nil, nil, errNoSparseHead
+	}
+	return sparseEnc.EncodeHybrid(text)
+}
@@ -0,0 +1,200 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"yashubustudio/csv-search/internal/database"
+	"yashubustudio/csv-search/internal/embedding"
+)
+
+// ReembedOptions control Reembed.
+type ReembedOptions struct {
+	// Dataset limits the run to one dataset; empty re-embeds every dataset.
+	Dataset   string
+	BatchSize int
+	// Sparse (re)computes lexical weights for every record. Without it only
+	// records that already have sparse weights get them refreshed.
+	Sparse bool
+	// Model is stored with the new embeddings. With StaleOnly, records whose
+	// embedding was already produced by Model are skipped.
+	Model     string
+	StaleOnly bool
+	// MissingOnly embeds only the records that have no embedding, such as
+	// those left by an interrupted write.
+	MissingOnly bool
+	// Workers encode texts in parallel (1 when non-positive).
+	Workers int
+	// Progress, when set, is called after every committed batch with the
+	// number of records done so far and the total.
+	Progress func(done, total int)
+	// OnChange, when set, is called after every committed batch with the
+	// IDs of the records of dataset it re-embedded, once per dataset in the
+	// batch.
+	OnChange func(dataset string, ids []string)
+}
+
+// Reembed recomputes the stored embeddings from the indexed text (the
+// records_fts content) with enc, typically after switching models. It returns
+// the number of records updated. The vector pages of the datasets it touched
+// are rebuilt at the end.
+func Reembed(ctx context.Context, db *sql.DB, enc embedding.Embedder, opts ReembedOptions) (int, error) {
+	if db == nil {
+		return 0, errors.New("db is nil")
+	}
+	if enc == nil {
+		return 0, errors.New("encoder is nil")
+	}
+	sparseEnc, hasSparse := embedding.Sparse(enc)
+	if opts.Sparse && !hasSparse {
+		return 0, errors.New("sparse weights requested but the encoder has no sparse head")
+	}
+	if opts.StaleOnly && opts.Model == "" {
+		return 0, errors.New("stale-only re-embedding requires a model version")
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	workers := max(opts.Workers, 1)
+
+	type item struct {
+		dataset, id, text string
+		sparse            bool
+		dense             []float32
+		weights           map[int32]float32
+		err               error
+	}
+	query := `
+                SELECT f.dataset, f.id, f.content, s.id IS NOT NULL
+                FROM records_fts AS f
+                LEFT JOIN records_sparse AS s
+                        ON f.dataset = s.dataset AND f.id = s.id
+                LEFT JOIN records_vec AS v
+                        ON f.dataset = v.dataset AND f.id = v.id`
+	var (
+		where []string
+		args  []any
+	)
+	if dataset := strings.TrimSpace(opts.Dataset); dataset != "" {
+		where = append(where, `f.dataset = ?`)
+		args = append(args, dataset)
+	}
+	if opts.StaleOnly {
+		where = append(where, `(v.model IS NULL OR v.model != ?)`)
+		args = append(args, opts.Model)
+	}
+	if opts.MissingOnly {
+		where = append(where, `v.id IS NULL`)
+	}
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	var items []item
+	for rows.Next() {
+		var it item
+		if err := rows.Scan(&it.dataset, &it.id, &it.text, &it.sparse); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		items = append(items, it)
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for start := 0; start < len(items); start += batchSize {
+		batch := items[start:min(start+batchSize, len(items))]
+
+		// Encode the batch in parallel, then write it in one transaction.
+		var wg sync.WaitGroup
+		next := make(chan int)
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range next {
+					it := &batch[i]
+					if hasSparse && (opts.Sparse || it.sparse) {
+						it.dense, it.weights, it.err = sparseEnc.EncodeHybrid(it.text)
+					} else {
+						it.dense, it.err = enc.Encode(it.text)
+					}
+				}
+			}()
+		}
+		for i := range batch {
+			if ctx.Err() != nil {
+				break
+			}
+			next <- i
+		}
+		close(next)
+		wg.Wait()
+		if err := ctx.Err(); err != nil {
+			return updated, err
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return updated, err
+		}
+		for i := range batch {
+			it := &batch[i]
+			if it.err != nil {
+				tx.Rollback()
+				return updated, fmt.Errorf("%s/%s encode: %w", it.dataset, it.id, it.err)
+			}
+			if err := writeEmbeddings(ctx, tx, it.dataset, it.id, it.dense, it.weights, opts.Model); err != nil {
+				tx.Rollback()
+				return updated, fmt.Errorf("%s/%s: %w", it.dataset, it.id, err)
+			}
+			// Release the vectors once written.
+			it.dense, it.weights = nil, nil
+		}
+		if err := tx.Commit(); err != nil {
+			return updated, err
+		}
+		updated += len(batch)
+		if opts.OnChange != nil {
+			var datasets []string
+			ids := make(map[string][]string)
+			for _, it := range batch {
+				if _, ok := ids[it.dataset]; !ok {
+					datasets = append(datasets, it.dataset)
+				}
+				ids[it.dataset] = append(ids[it.dataset], it.id)
+			}
+			for _, dataset := range datasets {
+				opts.OnChange(dataset, ids[dataset])
+			}
+		}
+		if opts.Progress != nil {
+			opts.Progress(updated, len(items))
+		}
+	}
+	if updated > 0 {
+		var err error
+		if dataset := strings.TrimSpace(opts.Dataset); dataset != "" {
+			_, err = database.UpdateVectorPages(ctx, db, dataset)
+		} else {
+			_, err = database.BuildAllVectorPages(ctx, db)
+		}
+		if err != nil {
+			return updated, err
+		}
+	}
+	return updated, nil
+}
@@ -0,0 +1,120 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"yashubustudio/csv-search/internal/database"
+	"yashubustudio/csv-search/internal/vector"
+)
+
+// VectorImportOptions control ImportVectors.
+type VectorImportOptions struct {
+	Dataset string
+	// Model is stored with the imported embeddings.
+	Model string
+	// OnChange, when set, is called after the commit with the IDs of the
+	// records whose embedding was replaced.
+	OnChange func(ids []string)
+}
+
+// VectorImportStats summarise an ImportVectors run.
+type VectorImportStats struct {
+	// Imported counts the embeddings written.
+	Imported int
+	// Missing counts the IDs without a stored record, which are skipped.
+	Missing int
+	// Dimension is the length of the imported vectors.
+	Dimension int
+}
+
+// ImportVectors replaces the dense embeddings of stored records with the
+// vectors returned by next, which reports io.EOF after the last one. Lexical
+// weights and record contents are left alone. The import runs in a single
+// transaction and fails when the vectors differ in dimension from each other
+// or from the embeddings of the dataset's other records.
+func ImportVectors(ctx context.Context, db *sql.DB, opts VectorImportOptions, next func() (string, []float32, error)) (VectorImportStats, error) {
+	var stats VectorImportStats
+	if db == nil {
+		return stats, errors.New("db is nil")
+	}
+	dataset := strings.TrimSpace(opts.Dataset)
+	if dataset == "" {
+		dataset = "default"
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return stats, err
+	}
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	buf := vector.GetBytes()
+	defer vector.PutBytes(buf)
+	var imported []string
+	for n := 1; ; n++ {
+		id, embedding, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return stats, fmt.Errorf("vector %d: %w", n, err)
+		}
+		if stats.Dimension == 0 {
+			stats.Dimension = len(embedding)
+		}
+		if len(embedding) != stats.Dimension {
+			return stats, fmt.Errorf("vector %d (id %s): dimension %d differs from %d", n, id, len(embedding), stats.Dimension)
+		}
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM records WHERE dataset = ? AND id = ?)`, dataset, id).Scan(&exists); err != nil {
+			return stats, err
+		}
+		if !exists {
+			stats.Missing++
+			continue
+		}
+		*buf = vector.SerializeInto((*buf)[:0], embedding)
+		if _, err := tx.ExecContext(ctx, `
+                        INSERT INTO records_vec(dataset, id, embedding, model) VALUES(?, ?, ?, ?)
+                        ON CONFLICT(dataset, id) DO UPDATE SET embedding=excluded.embedding, model=excluded.model;
+                `, dataset, id, *buf, nullString(opts.Model)); err != nil {
+			return stats, fmt.Errorf("vector %d (id %s): %w", n, id, err)
+		}
+		stats.Imported++
+		if opts.OnChange != nil {
+			imported = append(imported, id)
+		}
+	}
+
+	var other int
+	if err := tx.QueryRowContext(ctx, `
+                SELECT COUNT(*) FROM records_vec WHERE dataset = ? AND length(embedding) != ?
+        `, dataset, 4*stats.Dimension).Scan(&other); err != nil {
+		return stats, err
+	}
+	if stats.Imported > 0 && other > 0 {
+		return stats, fmt.Errorf("%d other records of %s have embeddings of another dimension than %d; import vectors for every record or re-embed", other, dataset, stats.Dimension)
+	}
+	if err := tx.Commit(); err != nil {
+		return stats, err
+	}
+	tx = nil
+	if opts.OnChange != nil && len(imported) > 0 {
+		opts.OnChange(imported)
+	}
+	if stats.Imported > 0 {
+		if _, err := database.UpdateVectorPages(ctx, db, dataset); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
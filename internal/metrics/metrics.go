@@ -0,0 +1,351 @@
+// Package metrics implements the small subset of Prometheus instrumentation
+// csv-search needs (counters, gauges and histograms with labels) and renders
+// it in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are latency buckets in seconds suited to encoder-bound
+// requests.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry holds metrics and renders them for /metrics. Registering a name
+// twice returns the existing metric, so components can be rebuilt against the
+// same registry.
+type Registry struct {
+	mu      sync.Mutex
+	order   []string
+	metrics map[string]collector
+}
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]collector)}
+}
+
+func (r *Registry) register(name string, build func() collector) collector {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.metrics[name]; ok {
+		return c
+	}
+	c := build()
+	r.metrics[name] = c
+	r.order = append(r.order, name)
+	return c
+}
+
+// Counter registers a monotonically increasing counter.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c, ok := r.register(name, func() collector {
+		return &Counter{desc: newDesc(name, help, labels), values: make(map[string]*sample)}
+	}).(*Counter)
+	if !ok {
+		panic(fmt.Sprintf("metrics: %s is already registered with another type", name))
+	}
+	return c
+}
+
+// Gauge registers a value that can go up and down.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	g, ok := r.register(name, func() collector {
+		return &Gauge{desc: newDesc(name, help, labels), values: make(map[string]*sample)}
+	}).(*Gauge)
+	if !ok {
+		panic(fmt.Sprintf("metrics: %s is already registered with another type", name))
+	}
+	return g
+}
+
+// GaugeFunc registers a gauge whose value is computed at scrape time.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(name, func() collector {
+		return &gaugeFunc{desc: newDesc(name, help, nil), fn: fn}
+	})
+}
+
+// Histogram registers a histogram with the given upper bounds (DefaultBuckets
+// when empty).
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	bounds := append([]float64(nil), buckets...)
+	sort.Float64s(bounds)
+	h, ok := r.register(name, func() collector {
+		return &Histogram{desc: newDesc(name, help, labels), bounds: bounds, values: make(map[string]*histogramSample)}
+	}).(*Histogram)
+	if !ok {
+		panic(fmt.Sprintf("metrics: %s is already registered with another type", name))
+	}
+	return h
+}
+
+// WriteText renders every registered metric in the Prometheus text format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	collectors := make([]collector, len(r.order))
+	for i, name := range r.order {
+		collectors[i] = r.metrics[name]
+	}
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func newDesc(name, help string, labels []string) desc {
+	return desc{name: name, help: help, labels: append([]string(nil), labels...)}
+}
+
+func (d desc) header(w *bufio.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, kind)
+}
+
+// key joins label values into a map key, checking their count.
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelString formats {a="x",b="y"} with optional extra pairs appended.
+func (d desc) labelString(values []string, extra ...string) string {
+	if len(d.labels) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	n := 0
+	add := func(k, v string) {
+		if n > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(v))
+		b.WriteByte('"')
+		n++
+	}
+	for i, name := range d.labels {
+		add(name, values[i])
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		add(extra[i], extra[i+1])
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+type sample struct {
+	labels []string
+	value  float64
+}
+
+// sortedSamples returns the samples in a stable order for rendering.
+func sortedSamples(values map[string]*sample) []*sample {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]*sample, len(keys))
+	for i, k := range keys {
+		s := *values[k]
+		out[i] = &s
+	}
+	return out
+}
+
+// Counter is a cumulative metric partitioned by label values.
+type Counter struct {
+	desc
+	mu     sync.Mutex
+	values map[string]*sample
+}
+
+// Inc adds one to the counter identified by labelValues.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter by v, which must not be negative.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	key := c.key(labelValues)
+	c.mu.Lock()
+	s := c.values[key]
+	if s == nil {
+		s = &sample{labels: append([]string(nil), labelValues...)}
+		c.values[key] = s
+	}
+	s.value += v
+	c.mu.Unlock()
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.header(w, "counter")
+	c.mu.Lock()
+	samples := sortedSamples(c.values)
+	c.mu.Unlock()
+	for _, s := range samples {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelString(s.labels), formatValue(s.value))
+	}
+}
+
+// Gauge is a settable metric partitioned by label values.
+type Gauge struct {
+	desc
+	mu     sync.Mutex
+	values map[string]*sample
+}
+
+// Set stores v for the gauge identified by labelValues.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	key := g.key(labelValues)
+	g.mu.Lock()
+	s := g.values[key]
+	if s == nil {
+		s = &sample{labels: append([]string(nil), labelValues...)}
+		g.values[key] = s
+	}
+	s.value = v
+	g.mu.Unlock()
+}
+
+// Add adjusts the gauge identified by labelValues by v.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	key := g.key(labelValues)
+	g.mu.Lock()
+	s := g.values[key]
+	if s == nil {
+		s = &sample{labels: append([]string(nil), labelValues...)}
+		g.values[key] = s
+	}
+	s.value += v
+	g.mu.Unlock()
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.header(w, "gauge")
+	g.mu.Lock()
+	samples := sortedSamples(g.values)
+	g.mu.Unlock()
+	for _, s := range samples {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, g.labelString(s.labels), formatValue(s.value))
+	}
+}
+
+type gaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	g.header(w, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatValue(g.fn()))
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	desc
+	bounds []float64
+	mu     sync.Mutex
+	values map[string]*histogramSample
+}
+
+type histogramSample struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Observe records v for the histogram identified by labelValues.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	s := h.values[key]
+	if s == nil {
+		s = &histogramSample{labels: append([]string(nil), labelValues...), counts: make([]uint64, len(h.bounds))}
+		h.values[key] = s
+	}
+	for i, bound := range h.bounds {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+	h.mu.Unlock()
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.header(w, "histogram")
+	h.mu.Lock()
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	samples := make([]histogramSample, len(keys))
+	for i, k := range keys {
+		s := h.values[k]
+		samples[i] = histogramSample{labels: s.labels, counts: append([]uint64(nil), s.counts...), count: s.count, sum: s.sum}
+	}
+	h.mu.Unlock()
+
+	for _, s := range samples {
+		for i, bound := range h.bounds {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(s.labels, "le", formatValue(bound)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelString(s.labels), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelString(s.labels), s.count)
+	}
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
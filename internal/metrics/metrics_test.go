@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("requests_total", "Requests served.", "path", "code")
+	c.Inc("/search", "200")
+	c.Add(2, "/search", "200")
+	c.Inc("/healthz", "200")
+	r.Gauge("last_rate", "Last rate.").Set(1.5)
+	r.GaugeFunc("size_bytes", "Size.", func() float64 { return 42 })
+	h := r.Histogram("latency_seconds", "Latency.", []float64{0.1, 1}, "stage")
+	h.Observe(0.05, "encode")
+	h.Observe(0.5, "encode")
+
+	if again := r.Counter("requests_total", "Requests served.", "path", "code"); again != c {
+		t.Fatalf("expected registering the same name to return the existing counter")
+	}
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatalf("WriteText: %v", err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE requests_total counter\n",
+		`requests_total{path="/healthz",code="200"} 1` + "\n",
+		`requests_total{path="/search",code="200"} 3` + "\n",
+		"last_rate 1.5\n",
+		"size_bytes 42\n",
+		"# TYPE latency_seconds histogram\n",
+		`latency_seconds_bucket{stage="encode",le="0.1"} 1` + "\n",
+		`latency_seconds_bucket{stage="encode",le="1"} 2` + "\n",
+		`latency_seconds_bucket{stage="encode",le="+Inf"} 2` + "\n",
+		`latency_seconds_sum{stage="encode"} 0.55` + "\n",
+		`latency_seconds_count{stage="encode"} 2` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("x_total", "X.", "v").Inc("a\"b\\c")
+	var b strings.Builder
+	_ = r.WriteText(&b)
+	if !strings.Contains(b.String(), `x_total{v="a\"b\\c"} 1`) {
+		t.Fatalf("unexpected escaping:\n%s", b.String())
+	}
+}
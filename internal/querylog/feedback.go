@@ -0,0 +1,72 @@
+package querylog
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Feedback is a result a user selected for a query.
+type Feedback struct {
+	Time    time.Time
+	Dataset string
+	Query   string
+	// Selected is the id of the selected result.
+	Selected string
+	// Position is the 1-based rank of Selected among the results shown, or
+	// zero when unknown.
+	Position int
+	// Shown are the ids of the results shown with Selected, best first.
+	Shown []string
+}
+
+// InsertFeedback writes f to the feedback table.
+func InsertFeedback(ctx context.Context, db *sql.DB, f Feedback) error {
+	if f.Time.IsZero() {
+		f.Time = time.Now()
+	}
+	shown, err := json.Marshal(nonNil(f.Shown))
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+                INSERT INTO feedback(ts, dataset, query, selected, position, shown)
+                VALUES(?, ?, ?, ?, ?, ?);
+        `, f.Time.UnixMilli(), f.Dataset, f.Query, f.Selected, f.Position, string(shown))
+	return err
+}
+
+// LoadFeedback returns the feedback recorded for dataset since the given
+// time, oldest first.
+func LoadFeedback(ctx context.Context, db *sql.DB, dataset string, since time.Time) ([]Feedback, error) {
+	if db == nil {
+		return nil, fmt.Errorf("db is nil")
+	}
+	rows, err := db.QueryContext(ctx, `
+                SELECT ts, query, selected, position, shown FROM feedback
+                WHERE dataset = ? AND ts >= ? ORDER BY ts, id`, strings.TrimSpace(dataset), since.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Feedback
+	for rows.Next() {
+		var (
+			f     = Feedback{Dataset: dataset}
+			ts    int64
+			shown string
+		)
+		if err := rows.Scan(&ts, &f.Query, &f.Selected, &f.Position, &shown); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(shown), &f.Shown); err != nil {
+			return nil, fmt.Errorf("decode shown results of feedback: %w", err)
+		}
+		f.Time = time.UnixMilli(ts)
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
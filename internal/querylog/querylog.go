@@ -0,0 +1,214 @@
+// Package querylog records searches in the query_log table and summarises
+// them for the query report. It also stores the results users selected in
+// the feedback table.
+package querylog
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Entry is one logged search.
+type Entry struct {
+	Time    time.Time
+	Source  string // "http", "ws", "grpc" or "library"
+	Dataset string
+	Query   string
+	Filters map[string]string
+	TopK    int
+	Latency time.Duration
+	Results int
+	// TopIDs and TopScores hold the leading results (at most MaxTopResults).
+	TopIDs    []string
+	TopScores []float64
+	Error     string
+}
+
+// MaxTopResults caps how many result ids are stored per entry.
+const MaxTopResults = 5
+
+const (
+	queueSize     = 1024
+	pruneInterval = time.Hour
+)
+
+// Logger writes entries asynchronously so that logging never slows searches
+// down; entries are dropped when the queue is full.
+type Logger struct {
+	db        *sql.DB
+	retention time.Duration
+	log       *slog.Logger
+	queue     chan Entry
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// New starts a logger. Entries older than retention are pruned with the first
+// write and then hourly; a non-positive retention keeps them forever. The
+// query_log table must exist before entries are logged. Write failures are
+// reported to logger (slog.Default() when nil).
+func New(db *sql.DB, retention time.Duration, logger *slog.Logger) (*Logger, error) {
+	if db == nil {
+		return nil, fmt.Errorf("db is nil")
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	l := &Logger{
+		db:        db,
+		retention: retention,
+		log:       logger,
+		queue:     make(chan Entry, queueSize),
+		done:      make(chan struct{}),
+	}
+	l.wg.Add(1)
+	go l.run()
+	return l, nil
+}
+
+// Log queues e for writing.
+func (l *Logger) Log(e Entry) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if len(e.TopIDs) > MaxTopResults {
+		e.TopIDs = e.TopIDs[:MaxTopResults]
+	}
+	if len(e.TopScores) > MaxTopResults {
+		e.TopScores = e.TopScores[:MaxTopResults]
+	}
+	select {
+	case <-l.done:
+	case l.queue <- e:
+	default:
+		l.log.Warn("query log queue full, dropping entry")
+	}
+}
+
+// Close flushes the queued entries and stops the writer.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.closeOnce.Do(func() { close(l.done) })
+	l.wg.Wait()
+	return nil
+}
+
+func (l *Logger) run() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	pruned := false
+	for {
+		select {
+		case e := <-l.queue:
+			l.write(e)
+			if !pruned {
+				l.prune()
+				pruned = true
+			}
+		case <-ticker.C:
+			l.prune()
+		case <-l.done:
+			for {
+				select {
+				case e := <-l.queue:
+					l.write(e)
+				default:
+					if !pruned {
+						l.prune()
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+func (l *Logger) write(e Entry) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Insert(ctx, l.db, e); err != nil {
+		l.log.Error("query log write failed", "err", err)
+	}
+}
+
+func (l *Logger) prune() {
+	if l.retention <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if _, err := Prune(ctx, l.db, time.Now().Add(-l.retention)); err != nil {
+		l.log.Error("query log prune failed", "err", err)
+	}
+}
+
+// Insert writes e synchronously.
+func Insert(ctx context.Context, db *sql.DB, e Entry) error {
+	filters, err := json.Marshal(e.Filters)
+	if err != nil {
+		return err
+	}
+	if e.Filters == nil {
+		filters = []byte("{}")
+	}
+	ids, err := json.Marshal(nonNil(e.TopIDs))
+	if err != nil {
+		return err
+	}
+	scores, err := json.Marshal(nonNil(e.TopScores))
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+                INSERT INTO query_log(ts, source, dataset, query, filters, topk, latency_ms, results, top_ids, top_scores, error)
+                VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+        `,
+		e.Time.UnixMilli(),
+		e.Source,
+		e.Dataset,
+		e.Query,
+		string(filters),
+		e.TopK,
+		float64(e.Latency.Microseconds())/1000,
+		e.Results,
+		string(ids),
+		string(scores),
+		nullString(e.Error),
+	)
+	return err
+}
+
+// Prune deletes entries logged before cutoff and returns how many were removed.
+func Prune(ctx context.Context, db *sql.DB, cutoff time.Time) (int64, error) {
+	res, err := db.ExecContext(ctx, `DELETE FROM query_log WHERE ts < ?`, cutoff.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func nonNil[T any](values []T) []T {
+	if values == nil {
+		return []T{}
+	}
+	return values
+}
+
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
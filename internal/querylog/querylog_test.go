@@ -0,0 +1,81 @@
+package querylog
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"yashubustudio/csv-search/internal/database"
+)
+
+func TestLoggerAndReport(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.Open(filepath.Join(t.TempDir(), "log.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := database.Init(ctx, db); err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+
+	now := time.Now()
+	stale := Entry{Time: now.Add(-48 * time.Hour), Source: "http", Dataset: "docs", Query: "old"}
+	if err := Insert(ctx, db, stale); err != nil {
+		t.Fatalf("insert stale entry: %v", err)
+	}
+
+	logger, err := New(db, 24*time.Hour, nil)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		logger.Log(Entry{Source: "http", Dataset: "docs", Query: "tokyo", Latency: time.Duration(i) * 10 * time.Millisecond, Results: 2, TopIDs: []string{"a", "b"}, TopScores: []float64{0.9, 0.8}})
+	}
+	logger.Log(Entry{Source: "grpc", Dataset: "docs", Query: "nothing", Filters: map[string]string{"city": "x"}, Results: 0})
+	logger.Log(Entry{Source: "ws", Dataset: "other", Query: "broken", Error: "boom"})
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	var count int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM query_log WHERE query = 'old'`).Scan(&count); err != nil {
+		t.Fatalf("count stale: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("expected stale entry to be pruned, found %d", count)
+	}
+
+	report, err := BuildReport(ctx, db, ReportOptions{Since: now.Add(-time.Hour)})
+	if err != nil {
+		t.Fatalf("BuildReport returned error: %v", err)
+	}
+	if report.Searches != 5 || report.Distinct != 3 {
+		t.Fatalf("unexpected totals: %+v", report)
+	}
+	if len(report.TopQueries) != 2 || report.TopQueries[0].Query != "tokyo" || report.TopQueries[0].Count != 3 || report.TopQueries[0].AvgResults != 2 {
+		t.Fatalf("unexpected top queries: %+v", report.TopQueries)
+	}
+	if len(report.ZeroResults) != 1 || report.ZeroResults[0].Query != "nothing" {
+		t.Fatalf("unexpected zero-result queries: %+v", report.ZeroResults)
+	}
+	if len(report.Datasets) != 2 {
+		t.Fatalf("unexpected datasets: %+v", report.Datasets)
+	}
+	docs := report.Datasets[0]
+	if docs.Dataset != "docs" || docs.Searches != 4 || docs.P50MS != 10 || docs.MaxMS != 30 {
+		t.Fatalf("unexpected docs latency: %+v", docs)
+	}
+	if other := report.Datasets[1]; other.Dataset != "other" || other.Errors != 1 {
+		t.Fatalf("unexpected other latency: %+v", other)
+	}
+
+	filtered, err := BuildReport(ctx, db, ReportOptions{Since: now.Add(-time.Hour), Dataset: "other"})
+	if err != nil {
+		t.Fatalf("BuildReport with dataset returned error: %v", err)
+	}
+	if filtered.Searches != 1 || len(filtered.TopQueries) != 0 {
+		t.Fatalf("unexpected filtered report: %+v", filtered)
+	}
+}
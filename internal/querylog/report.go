@@ -0,0 +1,161 @@
+package querylog
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReportOptions select the window and size of a Report.
+type ReportOptions struct {
+	Since   time.Time
+	Dataset string
+	Limit   int
+}
+
+// QueryCount is a query string with how often it was searched.
+type QueryCount struct {
+	Query      string  `json:"query"`
+	Count      int64   `json:"count"`
+	AvgResults float64 `json:"avg_results"`
+}
+
+// DatasetLatency summarises search latency for one dataset.
+type DatasetLatency struct {
+	Dataset  string  `json:"dataset"`
+	Searches int64   `json:"searches"`
+	Errors   int64   `json:"errors"`
+	P50MS    float64 `json:"p50_ms"`
+	P95MS    float64 `json:"p95_ms"`
+	MaxMS    float64 `json:"max_ms"`
+}
+
+// Report aggregates the query log.
+type Report struct {
+	Since       time.Time        `json:"since"`
+	Searches    int64            `json:"searches"`
+	Distinct    int64            `json:"distinct_queries"`
+	TopQueries  []QueryCount     `json:"top_queries"`
+	ZeroResults []QueryCount     `json:"zero_result_queries"`
+	Datasets    []DatasetLatency `json:"datasets"`
+}
+
+// BuildReport summarises the searches logged since opts.Since: the most
+// frequent queries, the queries that found nothing and latency per dataset.
+func BuildReport(ctx context.Context, db *sql.DB, opts ReportOptions) (Report, error) {
+	if db == nil {
+		return Report{}, fmt.Errorf("db is nil")
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	where := `WHERE ts >= ?`
+	args := []any{opts.Since.UnixMilli()}
+	if dataset := strings.TrimSpace(opts.Dataset); dataset != "" {
+		where += ` AND dataset = ?`
+		args = append(args, dataset)
+	}
+
+	report := Report{Since: opts.Since}
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*), COUNT(DISTINCT query) FROM query_log `+where, args...).Scan(&report.Searches, &report.Distinct); err != nil {
+		return Report{}, err
+	}
+
+	var err error
+	report.TopQueries, err = queryCounts(ctx, db, `
+                SELECT query, COUNT(*), AVG(results) FROM query_log `+where+` AND error IS NULL
+                GROUP BY query ORDER BY COUNT(*) DESC, query LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return Report{}, err
+	}
+	report.ZeroResults, err = queryCounts(ctx, db, `
+                SELECT query, COUNT(*), 0 FROM query_log `+where+` AND error IS NULL AND results = 0
+                GROUP BY query ORDER BY COUNT(*) DESC, query LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return Report{}, err
+	}
+	report.Datasets, err = datasetLatencies(ctx, db, where, args)
+	if err != nil {
+		return Report{}, err
+	}
+	return report, nil
+}
+
+func queryCounts(ctx context.Context, db *sql.DB, query string, args ...any) ([]QueryCount, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []QueryCount{}
+	for rows.Next() {
+		var qc QueryCount
+		if err := rows.Scan(&qc.Query, &qc.Count, &qc.AvgResults); err != nil {
+			return nil, err
+		}
+		out = append(out, qc)
+	}
+	return out, rows.Err()
+}
+
+func datasetLatencies(ctx context.Context, db *sql.DB, where string, args []any) ([]DatasetLatency, error) {
+	rows, err := db.QueryContext(ctx, `SELECT dataset, latency_ms, error IS NOT NULL FROM query_log `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	latencies := make(map[string][]float64)
+	errorsByDataset := make(map[string]int64)
+	for rows.Next() {
+		var (
+			dataset string
+			latency float64
+			failed  bool
+		)
+		if err := rows.Scan(&dataset, &latency, &failed); err != nil {
+			return nil, err
+		}
+		if failed {
+			errorsByDataset[dataset]++
+		}
+		latencies[dataset] = append(latencies[dataset], latency)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]DatasetLatency, 0, len(latencies))
+	for dataset, values := range latencies {
+		sort.Float64s(values)
+		out = append(out, DatasetLatency{
+			Dataset:  dataset,
+			Searches: int64(len(values)),
+			Errors:   errorsByDataset[dataset],
+			P50MS:    percentile(values, 0.50),
+			P95MS:    percentile(values, 0.95),
+			MaxMS:    values[len(values)-1],
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Dataset < out[j].Dataset })
+	return out, nil
+}
+
+// percentile uses the nearest-rank method on sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
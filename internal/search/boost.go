@@ -0,0 +1,97 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// FieldMatch returns the fraction of the terms of query (split on white
+// space, ignoring case) that occur in value, from 0 to 1.
+func FieldMatch(query, value string) float64 {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 || value == "" {
+		return 0
+	}
+	value = strings.ToLower(value)
+	found := 0
+	for _, term := range terms {
+		if strings.Contains(value, term) {
+			found++
+		}
+	}
+	return float64(found) / float64(len(terms))
+}
+
+// fieldBoost returns the score added to a record with fields for query:
+// the weight of every boosted field times FieldMatch of its value.
+func fieldBoost(boosts map[string]float64, query string, fields map[string]string) float64 {
+	var boost float64
+	for field, weight := range boosts {
+		if value, ok := fields[field]; ok {
+			boost += weight * FieldMatch(query, value)
+		}
+	}
+	return boost
+}
+
+// ValidateFieldBoosts reports whether boosts is accepted by
+// Options.FieldBoosts.
+func ValidateFieldBoosts(boosts map[string]float64) error {
+	for field, weight := range boosts {
+		if strings.TrimSpace(field) == "" {
+			return fmt.Errorf("field boost names must not be empty")
+		}
+		if math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return fmt.Errorf("field boost of %q must be a finite number", field)
+		}
+	}
+	return nil
+}
+
+// DefaultMaxBoost is the weight FitFieldBoosts gives a field whose match
+// with the query always told the selected result apart.
+const DefaultMaxBoost = 0.2
+
+// BoostSample is a result a user selected for a query together with the
+// results shown alongside it.
+type BoostSample struct {
+	Query    string
+	Selected map[string]string
+	Others   []map[string]string
+}
+
+// FitFieldBoosts fits per-field boost weights from samples. The lift of a
+// field is how much better its value matches the query on the selected
+// result than on the others shown, averaged over the samples whose records
+// have the field; fields with a positive lift get maxBoost (DefaultMaxBoost
+// when non-positive) times the lift, rounded to three decimal places.
+// Samples without other results carry no signal and are skipped.
+func FitFieldBoosts(samples []BoostSample, maxBoost float64) map[string]float64 {
+	if maxBoost <= 0 {
+		maxBoost = DefaultMaxBoost
+	}
+	sums := make(map[string]float64)
+	counts := make(map[string]int)
+	for _, sample := range samples {
+		if len(sample.Others) == 0 {
+			continue
+		}
+		for field, value := range sample.Selected {
+			var others float64
+			for _, other := range sample.Others {
+				others += FieldMatch(sample.Query, other[field])
+			}
+			sums[field] += FieldMatch(sample.Query, value) - others/float64(len(sample.Others))
+			counts[field]++
+		}
+	}
+	boosts := make(map[string]float64)
+	for field, sum := range sums {
+		lift := sum / float64(counts[field])
+		if weight := math.Round(maxBoost*lift*1000) / 1000; weight > 0 {
+			boosts[field] = weight
+		}
+	}
+	return boosts
+}
@@ -0,0 +1,152 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"yashubustudio/csv-search/internal/vector"
+)
+
+// FilterOptions describe a search by metadata alone.
+type FilterOptions struct {
+	// Dataset selects which logical table to search ("default" when empty).
+	Dataset string
+	// TopK controls how many results are returned (defaults to 10 when
+	// non-positive).
+	TopK    int
+	Filters []Filter
+	// IDs behaves as in Options.
+	IDs []string
+	// Near, when set, keeps the records with coordinates (within its radius)
+	// and returns them closest first.
+	Near *Near
+	// IncludeVectors behaves as in Options.
+	IncludeVectors bool
+	// Timings, when set, receives the scan time and candidate counts.
+	Timings *Timings
+	// Logger receives the debug summary of the search (slog.Default() when
+	// nil).
+	Logger *slog.Logger
+}
+
+// FilterSearch returns the records of a dataset that pass every filter, in
+// insertion order (or by distance with opts.Near) and with a zero Score
+// unless the distance weight adds to it. Nothing is encoded, so it serves
+// requests without a query on hosts that have no model.
+func FilterSearch(ctx context.Context, db *sql.DB, opts FilterOptions) ([]Result, error) {
+	if db == nil {
+		return nil, fmt.Errorf("db is nil")
+	}
+	return filterSearch(ctx, db, opts)
+}
+
+func filterSearch(ctx context.Context, db querier, opts FilterOptions) ([]Result, error) {
+	topK := opts.TopK
+	if topK <= 0 {
+		topK = 10
+	}
+	dataset := strings.TrimSpace(opts.Dataset)
+	if dataset == "" {
+		dataset = "default"
+	}
+
+	near := opts.Near
+	if near != nil {
+		if err := near.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	where, args, err := searchClause(opts.Filters, opts.IDs)
+	if err != nil {
+		return nil, err
+	}
+	// Sorting by distance needs every match; otherwise SQLite stops at topK.
+	geoJoin, limit := "", " LIMIT ?"
+	if near != nil {
+		join, geoWhere, geoArgs := near.clause()
+		geoJoin, where, args, limit = join, where+geoWhere, append(args, geoArgs...), ""
+	} else {
+		args = append(args, topK)
+	}
+	rows, err := db.QueryContext(ctx, `
+                SELECT r.id, r.data, r.lat, r.lng, v.embedding
+                FROM records AS r
+                LEFT JOIN records_vec AS v
+                        ON r.dataset = v.dataset AND r.id = v.id`+geoJoin+`
+                WHERE r.dataset = ?`+where+`
+                ORDER BY r.rowid`+limit+`;
+        `, append([]any{dataset}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		results []Result
+		scanned int
+	)
+	for rows.Next() {
+		var (
+			r    Result
+			data string
+			lat  sql.NullFloat64
+			lng  sql.NullFloat64
+			blob []byte
+		)
+		if err := rows.Scan(&r.ID, &data, &lat, &lng, &blob); err != nil {
+			return nil, err
+		}
+		scanned++
+		if err := json.Unmarshal([]byte(data), &r.Fields); err != nil {
+			return nil, fmt.Errorf("decode metadata for %s: %w", r.ID, err)
+		}
+		r.Dataset = dataset
+		if lat.Valid {
+			v := lat.Float64
+			r.Lat = &v
+		}
+		if lng.Valid {
+			v := lng.Float64
+			r.Lng = &v
+		}
+		if near != nil && !near.measure(&r) {
+			continue
+		}
+		if opts.IncludeVectors && len(blob) > 0 {
+			if r.Vector, err = vector.Deserialize(blob); err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	opts.Timings.count(scanned, len(results))
+	if near != nil {
+		sortStart := time.Now()
+		sortByDistance(results)
+		opts.Timings.sorted(sortStart)
+		if len(results) > topK {
+			results = results[:topK]
+		}
+	}
+	if opts.Timings != nil {
+		opts.Timings.Scan = time.Since(start)
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.DebugContext(ctx, "filter search", "dataset", dataset, "top_k", topK, "filters", len(opts.Filters),
+		"results", len(results), "scan", time.Since(start))
+	return results, nil
+}
@@ -0,0 +1,183 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"yashubustudio/csv-search/internal/vector"
+)
+
+// DefaultDuplicateThreshold is the cosine similarity from which FindDuplicates
+// reports two records when no threshold is given.
+const DefaultDuplicateThreshold = 0.95
+
+// DuplicateOptions describe a near-duplicate scan of one dataset.
+type DuplicateOptions struct {
+	// Dataset selects which logical table to scan ("default" when empty).
+	Dataset string
+	// Threshold is the cosine similarity from which two records are
+	// duplicates (DefaultDuplicateThreshold when zero). It must not exceed
+	// 1.
+	Threshold float64
+}
+
+// DuplicatePair is two records whose embeddings are at least as similar as
+// the threshold. A was ingested before B.
+type DuplicatePair struct {
+	A     string  `json:"a"`
+	B     string  `json:"b"`
+	Score float64 `json:"score"`
+}
+
+// DuplicateGroup is a set of records linked by duplicate pairs. Keep is the
+// first ingested of them and Duplicates the others, in ingestion order.
+type DuplicateGroup struct {
+	Keep       string   `json:"keep"`
+	Duplicates []string `json:"duplicates"`
+}
+
+// Duplicates is the outcome of FindDuplicates.
+type Duplicates struct {
+	// Records counts the records with an embedding that were compared.
+	Records int `json:"records"`
+	// Pairs are ordered by descending score.
+	Pairs []DuplicatePair `json:"pairs"`
+	// Groups are ordered by the ingestion of their Keep record.
+	Groups []DuplicateGroup `json:"groups"`
+}
+
+// FindDuplicates compares the stored embeddings of every pair of records of a
+// dataset by cosine similarity and reports the pairs at or above the
+// threshold, grouped transitively. The comparison is quadratic in the number
+// of records, so it is meant for offline reports rather than requests.
+func FindDuplicates(ctx context.Context, db *sql.DB, opts DuplicateOptions) (Duplicates, error) {
+	if db == nil {
+		return Duplicates{}, fmt.Errorf("db is nil")
+	}
+	threshold := opts.Threshold
+	if threshold == 0 {
+		threshold = DefaultDuplicateThreshold
+	}
+	if threshold < -1 || threshold > 1 || math.IsNaN(threshold) {
+		return Duplicates{}, fmt.Errorf("threshold must be between -1 and 1, got %v", threshold)
+	}
+	dataset := strings.TrimSpace(opts.Dataset)
+	if dataset == "" {
+		dataset = "default"
+	}
+
+	rows, err := db.QueryContext(ctx, `
+                SELECT v.id, v.embedding FROM records_vec AS v
+                INNER JOIN records AS r ON r.dataset = v.dataset AND r.id = v.id
+                WHERE v.dataset = ?
+                ORDER BY r.rowid
+        `, dataset)
+	if err != nil {
+		return Duplicates{}, err
+	}
+	var (
+		ids  []string
+		vecs [][]float32
+	)
+	for rows.Next() {
+		var (
+			id   string
+			blob []byte
+		)
+		if err := rows.Scan(&id, &blob); err != nil {
+			rows.Close()
+			return Duplicates{}, err
+		}
+		vec, err := vector.Deserialize(blob)
+		if err != nil {
+			rows.Close()
+			return Duplicates{}, fmt.Errorf("decode embedding of %s: %w", id, err)
+		}
+		if unitVector(vec) {
+			ids = append(ids, id)
+			vecs = append(vecs, vec)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return Duplicates{}, err
+	}
+
+	out := Duplicates{Records: len(ids)}
+	parent := make([]int, len(ids))
+	for i := range parent {
+		parent[i] = i
+	}
+	root := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	for i := range vecs {
+		if err := ctx.Err(); err != nil {
+			return Duplicates{}, err
+		}
+		for j := i + 1; j < len(vecs); j++ {
+			if len(vecs[i]) != len(vecs[j]) {
+				continue
+			}
+			// Unit vectors of identical records can miss 1 by a rounding
+			// error.
+			score := min(vector.Dot(vecs[i], vecs[j]), 1)
+			if score < threshold-1e-6 {
+				continue
+			}
+			out.Pairs = append(out.Pairs, DuplicatePair{A: ids[i], B: ids[j], Score: score})
+			// The earlier record becomes the root, so that it is kept.
+			if ri, rj := root(i), root(j); ri != rj {
+				parent[max(ri, rj)] = min(ri, rj)
+			}
+		}
+	}
+	sort.SliceStable(out.Pairs, func(i, j int) bool { return out.Pairs[i].Score > out.Pairs[j].Score })
+
+	groups := make(map[int]int)
+	for i := range ids {
+		r := root(i)
+		if r == i {
+			continue
+		}
+		g, ok := groups[r]
+		if !ok {
+			g = len(out.Groups)
+			groups[r] = g
+			out.Groups = append(out.Groups, DuplicateGroup{Keep: ids[r]})
+		}
+		out.Groups[g].Duplicates = append(out.Groups[g].Duplicates, ids[i])
+	}
+	// A group is created by its first duplicate; order them by their root.
+	roots := make(map[string]int, len(groups))
+	for r, g := range groups {
+		roots[out.Groups[g].Keep] = r
+	}
+	sort.Slice(out.Groups, func(i, j int) bool { return roots[out.Groups[i].Keep] < roots[out.Groups[j].Keep] })
+	return out, nil
+}
+
+// unitVector scales vec to unit length in place and reports whether it has
+// a direction to compare (is not all zeros).
+func unitVector(vec []float32) bool {
+	var sum float64
+	for _, v := range vec {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return false
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vec {
+		vec[i] /= norm
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package search
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseStopwords reads a stopword list: one word per line, matched without
+// regard to case. Blank lines and lines starting with # are skipped.
+func ParseStopwords(r io.Reader) (map[string]bool, error) {
+	stopwords := make(map[string]bool)
+	err := dictionaryLines(r, func(line int, text string) error {
+		for _, word := range strings.Fields(text) {
+			stopwords[strings.ToLower(word)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stopwords, nil
+}
+
+// ParseTermBoosts reads a term boost dictionary: one term and its positive
+// factor per line, separated by white space (e.g. "organic 1.5"). Terms are
+// matched without regard to case. Blank lines and lines starting with # are
+// skipped.
+func ParseTermBoosts(r io.Reader) (map[string]float64, error) {
+	boosts := make(map[string]float64)
+	err := dictionaryLines(r, func(line int, text string) error {
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return fmt.Errorf("line %d: want a term and a factor, got %q", line, text)
+		}
+		factor, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil || factor <= 0 || math.IsInf(factor, 0) {
+			return fmt.Errorf("line %d: factor %q of %q must be a positive number", line, fields[1], fields[0])
+		}
+		boosts[strings.ToLower(fields[0])] = factor
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return boosts, nil
+}
+
+func dictionaryLines(r io.Reader, parse func(line int, text string) error) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if err := parse(line, text); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// queryTermBoosts returns the entries of boosts whose term occurs in query.
+func queryTermBoosts(boosts map[string]float64, query string) map[string]float64 {
+	if len(boosts) == 0 {
+		return nil
+	}
+	query = strings.ToLower(query)
+	var matched map[string]float64
+	for term, factor := range boosts {
+		if strings.Contains(query, term) {
+			if matched == nil {
+				matched = make(map[string]float64)
+			}
+			matched[term] = factor
+		}
+	}
+	return matched
+}
+
+// termBoost returns the product of the factors of the terms (taken from
+// queryTermBoosts) that also occur in a field of the record.
+func termBoost(terms map[string]float64, fields map[string]string) float64 {
+	boost := 1.0
+	for term, factor := range terms {
+		for _, value := range fields {
+			if strings.Contains(strings.ToLower(value), term) {
+				boost *= factor
+				break
+			}
+		}
+	}
+	return boost
+}
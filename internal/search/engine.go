@@ -0,0 +1,132 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"yashubustudio/csv-search/internal/embedding"
+)
+
+// querier runs the SQL of a search: a *sql.DB directly or an Engine through
+// its prepared statements.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Engine runs searches against one database and keeps a prepared statement
+// for every query shape it has run (the query differs by the filtered fields
+// and operators), so repeated searches skip SQLite's parse and plan step. At
+// most maxStatements are kept; other shapes run unprepared. It is safe for
+// concurrent use and meant to live as long as the database handle.
+type Engine struct {
+	db     *sql.DB
+	mu     sync.Mutex
+	stmts  map[string]*sql.Stmt
+	closed bool
+	// fields caches the metadata field names of each dataset for
+	// CheckFilterFields.
+	fields map[string]*fieldSet
+	// terms caches the term dictionary of each dataset for Suggest.
+	terms map[string]*termSet
+}
+
+// maxStatements bounds the statement cache, since the filtered fields come
+// from clients.
+const maxStatements = 256
+
+// NewEngine returns an Engine for db. Statements are prepared on first use.
+func NewEngine(db *sql.DB) *Engine {
+	return &Engine{db: db, stmts: make(map[string]*sql.Stmt)}
+}
+
+// VectorSearch is the package-level VectorSearch run through e.
+func (e *Engine) VectorSearch(ctx context.Context, enc embedding.Embedder, opts Options) ([]Result, error) {
+	if e == nil || e.db == nil {
+		return nil, fmt.Errorf("db is nil")
+	}
+	return vectorSearch(ctx, e, enc, opts)
+}
+
+// Similar is the package-level Similar run through e.
+func (e *Engine) Similar(ctx context.Context, opts SimilarOptions) ([]Result, error) {
+	if e == nil || e.db == nil {
+		return nil, fmt.Errorf("db is nil")
+	}
+	return similar(ctx, e, opts)
+}
+
+// KeywordSearch is the package-level KeywordSearch run through e.
+func (e *Engine) KeywordSearch(ctx context.Context, opts KeywordOptions) ([]Result, error) {
+	if e == nil || e.db == nil {
+		return nil, fmt.Errorf("db is nil")
+	}
+	return keywordSearch(ctx, e, opts)
+}
+
+// FilterSearch is the package-level FilterSearch run through e.
+func (e *Engine) FilterSearch(ctx context.Context, opts FilterOptions) ([]Result, error) {
+	if e == nil || e.db == nil {
+		return nil, fmt.Errorf("db is nil")
+	}
+	return filterSearch(ctx, e, opts)
+}
+
+// Close releases the prepared statements. Searches run afterwards go to the
+// database unprepared.
+func (e *Engine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var err error
+	for query, stmt := range e.stmts {
+		if cerr := stmt.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(e.stmts, query)
+	}
+	e.closed = true
+	return err
+}
+
+// QueryContext runs query through its cached statement.
+func (e *Engine) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	stmt, err := e.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return e.db.QueryContext(ctx, query, args...)
+	}
+	return stmt.QueryContext(ctx, args...)
+}
+
+// QueryRowContext runs query through its cached statement. A query that
+// cannot be prepared runs unprepared so that the Row reports the error.
+func (e *Engine) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	stmt, err := e.prepare(ctx, query)
+	if err != nil || stmt == nil {
+		return e.db.QueryRowContext(ctx, query, args...)
+	}
+	return stmt.QueryRowContext(ctx, args...)
+}
+
+// prepare returns the statement of query, preparing it on first use. It
+// returns nil once the Engine is closed or the cache is full.
+func (e *Engine) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if stmt, ok := e.stmts[query]; ok {
+		return stmt, nil
+	}
+	if e.closed || len(e.stmts) >= maxStatements {
+		return nil, nil
+	}
+	stmt, err := e.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	e.stmts[query] = stmt
+	return stmt, nil
+}
@@ -0,0 +1,116 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"yashubustudio/csv-search/internal/store"
+)
+
+// ErrUnknownField is wrapped by the errors of CheckFilterFields.
+var ErrUnknownField = errors.New("unknown filter field")
+
+// UnknownFieldError reports filters on fields that no record of a dataset
+// has, which would otherwise silently match nothing.
+type UnknownFieldError struct {
+	Dataset string
+	// Fields are the unknown fields in filter order.
+	Fields []string
+	// Valid lists the metadata fields of the dataset, sorted.
+	Valid []string
+}
+
+func (e *UnknownFieldError) Error() string {
+	quoted := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		quoted[i] = strconv.Quote(field)
+	}
+	return fmt.Sprintf("unknown filter field %s in dataset %q (valid fields: %s)",
+		strings.Join(quoted, ", "), e.Dataset, strings.Join(e.Valid, ", "))
+}
+
+func (e *UnknownFieldError) Unwrap() error { return ErrUnknownField }
+
+// fieldsRefresh is how long the field names of a dataset are trusted before
+// a filter on an unknown field reloads them, so that fields added by another
+// process are picked up without scanning the dataset on every typo.
+const fieldsRefresh = 10 * time.Second
+
+// fieldSet is the cached metadata field names of a dataset.
+type fieldSet struct {
+	names  map[string]struct{}
+	sorted []string
+	loaded time.Time
+}
+
+// CheckFilterFields returns an *UnknownFieldError when a filter names a field
+// that no record of dataset has. Datasets without records accept any field.
+// The field names are cached until InvalidateFields.
+func (e *Engine) CheckFilterFields(ctx context.Context, dataset string, filters []Filter) error {
+	if e == nil || e.db == nil {
+		return fmt.Errorf("db is nil")
+	}
+	dataset = strings.TrimSpace(dataset)
+	if dataset == "" {
+		dataset = "default"
+	}
+	var set *fieldSet
+	var unknown []string
+	for reloaded := false; ; reloaded = true {
+		var err error
+		if set, err = e.fieldSet(ctx, dataset, reloaded); err != nil {
+			return err
+		}
+		unknown = unknown[:0]
+		for _, f := range filters {
+			field := strings.TrimSpace(f.Field)
+			if _, ok := set.names[field]; field != "" && !ok {
+				unknown = append(unknown, field)
+			}
+		}
+		if len(unknown) == 0 || len(set.sorted) == 0 {
+			return nil
+		}
+		if reloaded || time.Since(set.loaded) < fieldsRefresh {
+			break
+		}
+	}
+	return &UnknownFieldError{Dataset: dataset, Fields: unknown, Valid: append([]string(nil), set.sorted...)}
+}
+
+// InvalidateFields drops the cached field names, e.g. after an ingest.
+func (e *Engine) InvalidateFields() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.fields = nil
+}
+
+// fieldSet returns the field names of dataset, loading them unless they are
+// cached and reload is false.
+func (e *Engine) fieldSet(ctx context.Context, dataset string, reload bool) (*fieldSet, error) {
+	e.mu.Lock()
+	set, ok := e.fields[dataset]
+	e.mu.Unlock()
+	if ok && !reload {
+		return set, nil
+	}
+	names, err := store.FieldNames(ctx, e.db, dataset)
+	if err != nil {
+		return nil, err
+	}
+	set = &fieldSet{names: make(map[string]struct{}, len(names)), sorted: names, loaded: time.Now()}
+	for _, name := range names {
+		set.names[name] = struct{}{}
+	}
+	e.mu.Lock()
+	if e.fields == nil {
+		e.fields = make(map[string]*fieldSet)
+	}
+	e.fields[dataset] = set
+	e.mu.Unlock()
+	return set, nil
+}
@@ -0,0 +1,186 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"yashubustudio/csv-search/internal/database"
+)
+
+// Filter represents a metadata condition applied to search results. Op is
+// one of the Op constants (OpEqual when empty). Equality compares the stored
+// text; the range operators compare numerically when Value is a number
+// (stored values are converted the way SQLite's CAST does, so text that is
+// not a number counts as 0) and as text otherwise. A record without the
+// field never matches. Op may also name a filter operator added with
+// RegisterFilterOperator.
+type Filter struct {
+	Field string
+	Op    string
+	Value string
+}
+
+// Filter operators accepted by Filter.Op.
+const (
+	OpEqual        = "="
+	OpNotEqual     = "!="
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+)
+
+// filterOps lists the operators in the order ParseFilter tries them, two
+// character operators first.
+var filterOps = []string{OpNotEqual, OpLessEqual, OpGreaterEqual, OpEqual, OpLess, OpGreater}
+
+// ParseFilter parses "field=value" and the other operators ("price>=100",
+// "status!=closed"), and "field@name=value" for a registered filter operator
+// name. A field whose text after the last "@" is not a registered operator,
+// such as "user@domain", is a literal field name. The field is trimmed; the
+// value is kept as written.
+func ParseFilter(expr string) (Filter, error) {
+	i := strings.IndexAny(expr, "=!<>")
+	if i < 0 {
+		return Filter{}, fmt.Errorf("filter must be in the form field=value (or !=, <, <=, >, >=)")
+	}
+	field := strings.TrimSpace(expr[:i])
+	if field == "" {
+		return Filter{}, fmt.Errorf("filter field must not be empty")
+	}
+	if at := strings.LastIndex(field, "@"); at >= 0 {
+		name := strings.TrimSpace(field[at+1:])
+		if _, registered := filterFunction(name); registered {
+			field = strings.TrimSpace(field[:at])
+			if field == "" || expr[i] != '=' {
+				return Filter{}, fmt.Errorf("filter with operator %s must be in the form field@%s=value", name, name)
+			}
+			return Filter{Field: field, Op: name, Value: expr[i+1:]}, nil
+		}
+	}
+	for _, op := range filterOps {
+		if strings.HasPrefix(expr[i:], op) {
+			return Filter{Field: field, Op: op, Value: expr[i+len(op):]}, nil
+		}
+	}
+	return Filter{}, fmt.Errorf("unknown filter operator in %q", expr)
+}
+
+// Label returns the field followed by the operator unless it is equality,
+// e.g. "price>=" or "title@prefix". It keys filters in the query log.
+func (f Filter) Label() string {
+	if _, ok := filterFunction(f.Op); ok {
+		return f.Field + "@" + f.Op
+	}
+	if op := f.op(); op != OpEqual {
+		return f.Field + op
+	}
+	return f.Field
+}
+
+func (f Filter) op() string {
+	if f.Op == "" {
+		return OpEqual
+	}
+	return f.Op
+}
+
+// filterClause compiles filters into SQL conditions on the JSON metadata in
+// column, so that only matching records are read, with their arguments.
+// Filters with an empty field are ignored.
+func filterClause(column string, filters []Filter) (string, []any, error) {
+	var (
+		b    strings.Builder
+		args []any
+	)
+	for _, f := range filters {
+		field := strings.TrimSpace(f.Field)
+		if field == "" {
+			continue
+		}
+		expr, err := database.FieldExpr(column, field)
+		if err != nil {
+			return "", nil, err
+		}
+		op := f.op()
+		switch op {
+		case OpEqual, OpNotEqual:
+			fmt.Fprintf(&b, " AND %s %s ?", expr, op)
+			args = append(args, f.Value)
+		case OpLess, OpLessEqual, OpGreater, OpGreaterEqual:
+			if n, err := strconv.ParseFloat(strings.TrimSpace(f.Value), 64); err == nil {
+				fmt.Fprintf(&b, " AND %s IS NOT NULL AND CAST(%s AS REAL) %s ?", expr, expr, op)
+				args = append(args, n)
+			} else {
+				fmt.Fprintf(&b, " AND %s %s ?", expr, op)
+				args = append(args, f.Value)
+			}
+		default:
+			function, ok := filterFunction(op)
+			if !ok {
+				return "", nil, fmt.Errorf("unknown filter operator %q", f.Op)
+			}
+			fmt.Fprintf(&b, " AND %s IS NOT NULL AND %s(%s, ?)", expr, function, expr)
+			args = append(args, f.Value)
+		}
+	}
+	return b.String(), args, nil
+}
+
+// idClause compiles a restriction of the records to ids into an SQL
+// condition on column with its argument, or nothing when ids is empty. The
+// ids are passed as one JSON array, so any number of them fits into a
+// single parameter.
+func idClause(column string, ids []string) (string, []any, error) {
+	if len(ids) == 0 {
+		return "", nil, nil
+	}
+	encoded, err := json.Marshal(ids)
+	if err != nil {
+		return "", nil, err
+	}
+	return " AND " + column + " IN (SELECT value FROM json_each(?))", []any{string(encoded)}, nil
+}
+
+// searchClause compiles the filters and the id restriction of a search.
+func searchClause(filters []Filter, ids []string) (string, []any, error) {
+	where, args, err := filterClause("r.data", filters)
+	if err != nil {
+		return "", nil, err
+	}
+	idWhere, idArgs, err := idClause("r.id", ids)
+	if err != nil {
+		return "", nil, err
+	}
+	return where + idWhere, append(args, idArgs...), nil
+}
+
+// MatchingIDs returns the ids of the records of dataset that pass every
+// filter, in insertion order.
+func (e *Engine) MatchingIDs(ctx context.Context, dataset string, filters []Filter) ([]string, error) {
+	if e == nil || e.db == nil {
+		return nil, fmt.Errorf("db is nil")
+	}
+	where, args, err := filterClause("data", filters)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := e.QueryContext(ctx, `SELECT id FROM records WHERE dataset = ?`+where+` ORDER BY rowid`,
+		append([]any{dataset}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,158 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Near restricts a search to the records that have coordinates and measures
+// their distance from a point, reported as Result.DistanceKm.
+type Near struct {
+	Lat float64
+	Lng float64
+	// RadiusKm drops records farther than this from the point; zero keeps
+	// every record with coordinates. The R-tree narrows the scan to the
+	// bounding box of the circle.
+	RadiusKm float64
+	// Weight, when positive, adds Weight/(1+distance_km) to the score so that
+	// nearby records rank higher.
+	Weight float64
+	// GeoWeight, between 0 and 1, blends the proximity of records into their
+	// score: the score becomes (1-GeoWeight)*score + GeoWeight*proximity,
+	// where proximity is 1-distance/RadiusKm within a radius and
+	// 1/(1+distance_km) without one, so that both range from 1 at the point
+	// down to 0. Weight is added after the blend, so without a radius the
+	// two count the same 1/(1+distance_km) term; set one or the other.
+	GeoWeight float64
+	// SortByDistance orders the results closest first instead of by score.
+	SortByDistance bool
+}
+
+// earthRadiusKm is the mean radius of the Earth.
+const earthRadiusKm = 6371.0088
+
+// ParsePoint parses a point written as "lat,lng".
+func ParsePoint(expr string) (lat, lng float64, err error) {
+	latText, lngText, ok := strings.Cut(expr, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid point %q (want lat,lng)", expr)
+	}
+	if lat, err = strconv.ParseFloat(strings.TrimSpace(latText), 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid latitude in %q", expr)
+	}
+	if lng, err = strconv.ParseFloat(strings.TrimSpace(lngText), 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid longitude in %q", expr)
+	}
+	return lat, lng, nil
+}
+
+// Validate reports whether the point and settings of n are in range.
+func (n *Near) Validate() error {
+	switch {
+	case math.IsNaN(n.Lat) || n.Lat < -90 || n.Lat > 90:
+		return fmt.Errorf("latitude %v out of range", n.Lat)
+	case math.IsNaN(n.Lng) || n.Lng < -180 || n.Lng > 180:
+		return fmt.Errorf("longitude %v out of range", n.Lng)
+	case math.IsNaN(n.RadiusKm) || n.RadiusKm < 0:
+		return fmt.Errorf("radius must not be negative")
+	case math.IsNaN(n.Weight) || n.Weight < 0:
+		return fmt.Errorf("distance weight must not be negative")
+	case math.IsNaN(n.GeoWeight) || n.GeoWeight < 0 || n.GeoWeight > 1:
+		return fmt.Errorf("geo weight %v must be between 0 and 1", n.GeoWeight)
+	}
+	return nil
+}
+
+// String describes n canonically, e.g. for cache keys.
+func (n *Near) String() string {
+	if n == nil {
+		return ""
+	}
+	return fmt.Sprintf("%g,%g r=%g w=%g g=%g sort=%t", n.Lat, n.Lng, n.RadiusKm, n.Weight, n.GeoWeight, n.SortByDistance)
+}
+
+// clause returns the join and conditions restricting records AS r to those
+// with coordinates, within the bounding box of the radius when one is set.
+func (n *Near) clause() (join, where string, args []any) {
+	if n.RadiusKm <= 0 {
+		return "", " AND r.lat IS NOT NULL AND r.lng IS NOT NULL", nil
+	}
+	minLat, maxLat, minLng, maxLng := boundingBox(n.Lat, n.Lng, n.RadiusKm)
+	join = `
+                INNER JOIN records_rtree AS g
+                        ON g.rowid = r.rowid`
+	where = " AND g.max_lat >= ? AND g.min_lat <= ? AND g.max_lng >= ? AND g.min_lng <= ?"
+	return join, where, []any{minLat, maxLat, minLng, maxLng}
+}
+
+// measure sets the distance of r from the point and blends it into the
+// score. It reports false when r lies outside the radius.
+func (n *Near) measure(r *Result) bool {
+	if r.Lat == nil || r.Lng == nil {
+		return false
+	}
+	d := haversineKm(n.Lat, n.Lng, *r.Lat, *r.Lng)
+	if n.RadiusKm > 0 && d > n.RadiusKm {
+		return false
+	}
+	r.DistanceKm = &d
+	if n.GeoWeight > 0 {
+		r.Score = (1-n.GeoWeight)*r.Score + n.GeoWeight*n.proximity(d)
+	}
+	if n.Weight > 0 {
+		r.Score += n.Weight / (1 + d)
+	}
+	return true
+}
+
+// proximity normalizes a distance from the point to [0, 1], 1 being at the
+// point.
+func (n *Near) proximity(d float64) float64 {
+	if n.RadiusKm > 0 {
+		return 1 - d/n.RadiusKm
+	}
+	return 1 / (1 + d)
+}
+
+// sortByDistance orders results closest first, then by id.
+func sortByDistance(results []Result) {
+	sort.Slice(results, func(i, j int) bool {
+		di, dj := *results[i].DistanceKm, *results[j].DistanceKm
+		if di == dj {
+			return results[i].ID < results[j].ID
+		}
+		return di < dj
+	})
+}
+
+// haversineKm returns the great-circle distance between two points.
+func haversineKm(lat1, lng1, lat2, lng2 float64) float64 {
+	const rad = math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLng := (lng2 - lng1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// boundingBox returns the smallest latitude/longitude box containing every
+// point within radiusKm of (lat, lng). Boxes reaching a pole or crossing the
+// antimeridian span every longitude.
+func boundingBox(lat, lng, radiusKm float64) (minLat, maxLat, minLng, maxLng float64) {
+	const deg = 180 / math.Pi
+	delta := radiusKm / earthRadiusKm
+	minLat, maxLat = lat-delta*deg, lat+delta*deg
+	minLng, maxLng = -180, 180
+	if minLat > -90 && maxLat < 90 {
+		if s := math.Sin(delta) / math.Cos(lat/deg); s < 1 {
+			dLng := math.Asin(s) * deg
+			if lng-dLng >= -180 && lng+dLng <= 180 {
+				minLng, maxLng = lng-dLng, lng+dLng
+			}
+		}
+	}
+	return max(minLat, -90), min(maxLat, 90), minLng, maxLng
+}
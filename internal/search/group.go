@@ -0,0 +1,56 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidateGroup reports whether a GroupBy field and GroupSize are accepted by
+// Options: a size needs a field and must not be negative.
+func ValidateGroup(field string, size int) error {
+	if size < 0 {
+		return fmt.Errorf("group size %d must not be negative", size)
+	}
+	if size > 0 && strings.TrimSpace(field) == "" {
+		return fmt.Errorf("group size requires a group by field")
+	}
+	return nil
+}
+
+// grouper collapses ranked results to the best size per value of a metadata
+// field. Results without a value for the field are never collapsed.
+type grouper struct {
+	field string
+	size  int
+	kept  map[string]int
+}
+
+// newGrouper returns the grouper of field and size (1 when zero), or nil,
+// which keeps every result, when field is empty.
+func newGrouper(field string, size int) *grouper {
+	field = strings.TrimSpace(field)
+	if field == "" {
+		return nil
+	}
+	if size <= 0 {
+		size = 1
+	}
+	return &grouper{field: field, size: size, kept: make(map[string]int)}
+}
+
+// keep reports whether a result with fields, offered in rank order, is among
+// the best of its group, and counts it when it is.
+func (g *grouper) keep(fields map[string]string) bool {
+	if g == nil {
+		return true
+	}
+	value := fields[g.field]
+	if value == "" {
+		return true
+	}
+	if g.kept[value] >= g.size {
+		return false
+	}
+	g.kept[value]++
+	return true
+}
@@ -0,0 +1,246 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"yashubustudio/csv-search/internal/vector"
+)
+
+// KeywordOptions describe a full-text search over the indexed record texts.
+type KeywordOptions struct {
+	// Dataset selects which logical table to search ("default" when empty).
+	Dataset string
+	// Query is split on whitespace; a record matches when its text contains
+	// every term as a token. Terms are matched literally, so FTS5 operators
+	// and punctuation in the query have no special meaning.
+	Query string
+	// TopK controls how many results are returned (defaults to 10 when
+	// non-positive).
+	TopK    int
+	Filters []Filter
+	// IDs behaves as in Options.
+	IDs []string
+	// Stopwords are dropped from Query before matching; a query of nothing
+	// but stopwords matches no record. Words must be lower case.
+	Stopwords map[string]bool
+	// Languages route the query by its detected language: a language whose
+	// Tokenizer is TokenizerTrigram searches the trigram index of the
+	// dataset, or the default index while that is not built.
+	Languages map[string]Language
+	// ScorePrecision, ScoreNormalization, TieBreak, GroupBy, GroupSize and
+	// IncludeVectors behave as in Options.
+	ScorePrecision     int
+	ScoreNormalization string
+	TieBreak           string
+	GroupBy            string
+	GroupSize          int
+	IncludeVectors     bool
+	// Timings, when set, receives the scan time and candidate counts. The
+	// scan stops once TopK results are found, and SQLite sorts the matches.
+	Timings *Timings
+	// Logger receives the debug summary of the search (slog.Default() when
+	// nil).
+	Logger *slog.Logger
+}
+
+// KeywordSearch ranks the records of a dataset whose text contains every
+// term of opts.Query by BM25, using the full-text index built at ingest. The
+// score is the negated BM25 rank, so higher is better as for VectorSearch.
+func KeywordSearch(ctx context.Context, db *sql.DB, opts KeywordOptions) ([]Result, error) {
+	if db == nil {
+		return nil, fmt.Errorf("db is nil")
+	}
+	return keywordSearch(ctx, db, opts)
+}
+
+func keywordSearch(ctx context.Context, db querier, opts KeywordOptions) ([]Result, error) {
+	if strings.TrimSpace(opts.Query) == "" {
+		return nil, fmt.Errorf("query must not be empty")
+	}
+	terms := keywordTerms(opts.Query, opts.Stopwords)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	topK := opts.TopK
+	if topK <= 0 {
+		topK = 10
+	}
+	dataset := strings.TrimSpace(opts.Dataset)
+	if dataset == "" {
+		dataset = "default"
+	}
+
+	tieBreak, err := normalizeTieBreak(opts.TieBreak)
+	if err != nil {
+		return nil, err
+	}
+	normalization, err := normalizeScoreMode(opts.ScoreNormalization)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateGroup(opts.GroupBy, opts.GroupSize); err != nil {
+		return nil, err
+	}
+	group := newGrouper(opts.GroupBy, opts.GroupSize)
+
+	start := time.Now()
+	where, args, err := searchClause(opts.Filters, opts.IDs)
+	if err != nil {
+		return nil, err
+	}
+	lang, settings := routeLanguage(opts.Languages, opts.Query)
+	tokenizer := TokenizerUnicode61
+	if strings.EqualFold(strings.TrimSpace(settings.Tokenizer), TokenizerTrigram) {
+		var current int
+		err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM records_fts_trigram_datasets WHERE dataset = ?`, dataset).Scan(&current)
+		if err != nil {
+			return nil, err
+		}
+		if current > 0 {
+			tokenizer = TokenizerTrigram
+		}
+	}
+	var rows *sql.Rows
+	if tokenizer == TokenizerTrigram {
+		rows, err = trigramRows(ctx, db, dataset, terms, where, args, tieBreak)
+	} else {
+		rows, err = db.QueryContext(ctx, `
+                        SELECT r.id, r.data, r.lat, r.lng, -bm25(records_fts), v.embedding
+                        FROM records_fts AS f
+                        INNER JOIN records AS r
+                                ON r.rowid = f.rowid
+                        LEFT JOIN records_vec AS v
+                                ON r.dataset = v.dataset AND r.id = v.id
+                        WHERE records_fts MATCH ? AND f.dataset = ?`+where+`
+                        ORDER BY bm25(records_fts), `+tieOrderBy(tieBreak)+`;
+                `, append([]any{matchQuery(terms), dataset}, args...)...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []Result
+	var scanned int
+	for len(results) < topK && rows.Next() {
+		var (
+			r    Result
+			data string
+			lat  sql.NullFloat64
+			lng  sql.NullFloat64
+			blob []byte
+		)
+		if err := rows.Scan(&r.ID, &data, &lat, &lng, &r.Score, &blob); err != nil {
+			return nil, err
+		}
+		scanned++
+		if err := json.Unmarshal([]byte(data), &r.Fields); err != nil {
+			return nil, fmt.Errorf("decode metadata for %s: %w", r.ID, err)
+		}
+		if !group.keep(r.Fields) {
+			continue
+		}
+		r.Dataset = dataset
+		if lat.Valid {
+			v := lat.Float64
+			r.Lat = &v
+		}
+		if lng.Valid {
+			v := lng.Float64
+			r.Lng = &v
+		}
+		if opts.IncludeVectors && len(blob) > 0 {
+			if r.Vector, err = vector.Deserialize(blob); err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	scanTime := time.Since(start)
+	if t := opts.Timings; t != nil {
+		t.Scan, t.Scanned, t.Matched = scanTime, scanned, scanned
+	}
+	normalizeScores(results, normalization)
+	roundScores(results, opts.ScorePrecision)
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.DebugContext(ctx, "keyword search", "dataset", dataset, "query", opts.Query, "language", lang, "tokenizer", tokenizer,
+		"top_k", topK, "filters", len(opts.Filters), "results", len(results), "scan", scanTime)
+	return results, nil
+}
+
+// trigramRows queries the trigram index of dataset for records containing
+// every term. Terms of three or more characters are matched through the
+// index and ranked by BM25; shorter ones, which the trigram tokenizer cannot
+// index, are matched as substrings of the text. Without a term of three or
+// more characters every match scores zero.
+func trigramRows(ctx context.Context, db querier, dataset string, terms []string, where string, args []any, tieBreak string) (*sql.Rows, error) {
+	var (
+		indexed []string
+		clause  strings.Builder
+		params  []any
+	)
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) >= 3 {
+			indexed = append(indexed, term)
+			continue
+		}
+		clause.WriteString(` AND f.content LIKE ? ESCAPE '\'`)
+		params = append(params, "%"+likeEscaper.Replace(term)+"%")
+	}
+	score, order := "0", ""
+	if len(indexed) > 0 {
+		clause.WriteString(` AND records_fts_trigram MATCH ?`)
+		params = append(params, matchQuery(indexed))
+		score, order = "-bm25(records_fts_trigram)", "bm25(records_fts_trigram), "
+	}
+	params = append(append([]any{dataset}, params...), args...)
+	return db.QueryContext(ctx, `
+                SELECT r.id, r.data, r.lat, r.lng, `+score+`, v.embedding
+                FROM records_fts_trigram AS f
+                INNER JOIN records AS r
+                        ON r.rowid = f.rowid
+                LEFT JOIN records_vec AS v
+                        ON r.dataset = v.dataset AND r.id = v.id
+                WHERE f.dataset = ?`+clause.String()+where+`
+                ORDER BY `+order+tieOrderBy(tieBreak)+`;
+        `, params...)
+}
+
+// likeEscaper escapes the LIKE wildcards of a term matched as a substring.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// keywordTerms splits free text on whitespace and drops the stopwords.
+func keywordTerms(text string, stopwords map[string]bool) []string {
+	var terms []string
+	for _, term := range strings.Fields(text) {
+		if stopwords[strings.ToLower(term)] {
+			continue
+		}
+		terms = append(terms, term)
+	}
+	return terms
+}
+
+// matchQuery turns terms into an FTS5 query requiring every one of them,
+// each quoted as a string so that it is matched literally.
+func matchQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(quoted, " AND ")
+}
@@ -0,0 +1,103 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Languages told apart by DetectLanguage.
+const (
+	LanguageJapanese = "ja"
+	LanguageEnglish  = "en"
+)
+
+// FTS tokenizers accepted by Language.Tokenizer.
+const (
+	// TokenizerUnicode61 splits on spaces and punctuation, so a run of
+	// Japanese text is a single token.
+	TokenizerUnicode61 = "unicode61"
+	// TokenizerTrigram matches any substring of three or more characters
+	// (shorter terms are matched as substrings without the index).
+	TokenizerTrigram = "trigram"
+)
+
+// japaneseShare is the share of the letters of a text that must be kana or
+// kanji for DetectLanguage to report Japanese. Japanese packs more meaning
+// into a character than English, so a few are enough.
+const japaneseShare = 0.2
+
+// DetectLanguage reports the language of text: LanguageJapanese when at
+// least a fifth of its letters are kana or kanji, LanguageEnglish when it has
+// other letters, and "" when it has no letters at all.
+func DetectLanguage(text string) string {
+	var japanese, other int
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana, unicode.Han):
+			japanese++
+		case unicode.IsLetter(r):
+			other++
+		}
+	}
+	switch {
+	case japanese+other == 0:
+		return ""
+	case float64(japanese) >= japaneseShare*float64(japanese+other):
+		return LanguageJapanese
+	}
+	return LanguageEnglish
+}
+
+// Language tunes the searches of the queries detected as one language, for
+// datasets that mix Japanese and English records.
+type Language struct {
+	// QueryPrefix is put before the query text when it is encoded, e.g.
+	// "query: " for models trained with instruction prefixes.
+	QueryPrefix string `json:"query_prefix,omitempty"`
+	// SparseWeight replaces Options.SparseWeight when non-zero; negative
+	// disables hybrid scoring.
+	SparseWeight float64 `json:"sparse_weight,omitempty"`
+	// Tokenizer selects the full-text index of keyword searches:
+	// TokenizerUnicode61 (the default when empty) or TokenizerTrigram.
+	Tokenizer string `json:"fts_tokenizer,omitempty"`
+}
+
+// ValidateLanguage reports whether lang is a language DetectLanguage reports.
+func ValidateLanguage(lang string) error {
+	switch lang {
+	case LanguageJapanese, LanguageEnglish:
+		return nil
+	}
+	return fmt.Errorf("unknown language %q (want ja or en)", lang)
+}
+
+// ValidateTokenizer reports whether tokenizer is accepted by
+// Language.Tokenizer.
+func ValidateTokenizer(tokenizer string) error {
+	switch strings.ToLower(strings.TrimSpace(tokenizer)) {
+	case "", TokenizerUnicode61, TokenizerTrigram:
+		return nil
+	}
+	return fmt.Errorf("unknown FTS tokenizer %q (want unicode61 or trigram)", tokenizer)
+}
+
+// routeLanguage returns the language of query and its settings in languages.
+func routeLanguage(languages map[string]Language, query string) (string, Language) {
+	if len(languages) == 0 {
+		return "", Language{}
+	}
+	lang := DetectLanguage(query)
+	return lang, languages[lang]
+}
+
+// UsesTrigram reports whether any of languages searches the trigram index,
+// which must then be built for the dataset (see database.BuildTrigramIndex).
+func UsesTrigram(languages map[string]Language) bool {
+	for _, l := range languages {
+		if strings.EqualFold(strings.TrimSpace(l.Tokenizer), TokenizerTrigram) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Normalizations of the reported scores accepted by Options.ScoreNormalization.
+const (
+	// ScoresRaw reports the scores as computed (the default).
+	ScoresRaw = "raw"
+	// ScoresMinMax rescales the scores of the returned results to [0, 1]:
+	// the best result scores 1 and the worst 0. When every result scores the
+	// same they all score 1.
+	ScoresMinMax = "minmax"
+	// ScoresSoftmax replaces the scores of the returned results by their
+	// softmax, so that they are positive and add up to 1.
+	ScoresSoftmax = "softmax"
+)
+
+// ValidateScoreNormalization reports whether mode is accepted by
+// Options.ScoreNormalization.
+func ValidateScoreNormalization(mode string) error {
+	_, err := normalizeScoreMode(mode)
+	return err
+}
+
+func normalizeScoreMode(mode string) (string, error) {
+	switch mode = strings.ToLower(strings.TrimSpace(mode)); mode {
+	case "", ScoresRaw:
+		return ScoresRaw, nil
+	case ScoresMinMax, ScoresSoftmax:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown score normalization %q (want raw, minmax or softmax)", mode)
+}
+
+// normalizeScores applies a normalized score mode to the scores of the
+// returned results. The order of the results does not change.
+func normalizeScores(results []Result, mode string) {
+	if len(results) == 0 {
+		return
+	}
+	lo, hi := results[0].Score, results[0].Score
+	for _, r := range results[1:] {
+		lo, hi = math.Min(lo, r.Score), math.Max(hi, r.Score)
+	}
+	switch mode {
+	case ScoresMinMax:
+		for i := range results {
+			if hi == lo {
+				results[i].Score = 1
+			} else {
+				results[i].Score = (results[i].Score - lo) / (hi - lo)
+			}
+		}
+	case ScoresSoftmax:
+		// Subtracting the best score keeps math.Exp from overflowing.
+		var sum float64
+		for i := range results {
+			results[i].Score = math.Exp(results[i].Score - hi)
+			sum += results[i].Score
+		}
+		for i := range results {
+			results[i].Score /= sum
+		}
+	}
+}
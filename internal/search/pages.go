@@ -0,0 +1,223 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"yashubustudio/csv-search/internal/vector"
+)
+
+// candidate is a record scored from the vector pages, before its fields are
+// read.
+type candidate struct {
+	id    string
+	score float64
+}
+
+// rankPages is rank over the vector pages of the dataset (see
+// database.BuildVectorPages), which are read as a few large blobs instead of
+// one row per record. It reports false when the dataset has no pages, or
+// has pages that a write made stale and that were not rewritten yet (see
+// database.UpdateVectorPages). Only the fields of the topK best records are
+// read afterwards. When rk reports progress, the pages are read one query
+// at a time and the best records among them are reported after each.
+func rankPages(ctx context.Context, db querier, rk ranking) ([]Result, bool, error) {
+	var stale bool
+	err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM records_vec_pages_stale WHERE dataset = ?)`, rk.dataset).Scan(&stale)
+	if err != nil || stale {
+		return nil, false, err
+	}
+
+	scratch := vector.GetFloats()
+	defer vector.PutFloats(scratch)
+
+	var (
+		pages, scanned, matched int
+		candidates              []candidate
+		reported                []string
+	)
+	// read scores the pages after the one starting at after (all pages when
+	// after is nil), at most limit of them (all when negative), and returns
+	// how many it read and the first_id of the last.
+	read := func(after any, limit int) (int, string, error) {
+		rows, err := db.QueryContext(ctx, `
+                        SELECT first_id, dim, ids, vectors FROM records_vec_pages
+                        WHERE dataset = ?1 AND (?2 IS NULL OR first_id > ?2)
+                        ORDER BY first_id
+                        LIMIT ?3
+                `, rk.dataset, after, limit)
+		if err != nil {
+			return 0, "", err
+		}
+		defer rows.Close()
+		var (
+			n    int
+			last string
+		)
+		for rows.Next() {
+			var (
+				dim     int
+				list    string
+				vectors sql.RawBytes
+				ids     []string
+			)
+			if err := rows.Scan(&last, &dim, &list, &vectors); err != nil {
+				return 0, "", err
+			}
+			n++
+			if err := json.Unmarshal([]byte(list), &ids); err != nil {
+				return 0, "", fmt.Errorf("decode vector page ids: %w", err)
+			}
+			size := 4 * dim
+			if len(vectors) != size*len(ids) {
+				return 0, "", fmt.Errorf("vector page of %d ids has %d bytes", len(ids), len(vectors))
+			}
+			scanned += len(ids)
+			for i, id := range ids {
+				if rk.exclude != "" && id == rk.exclude {
+					continue
+				}
+				vec, err := vector.View(scratch, vectors[i*size:(i+1)*size])
+				if err != nil {
+					return 0, "", err
+				}
+				score := rk.score(rk.qvec, vec)
+				if rk.minScore != 0 && score < rk.minScore {
+					continue
+				}
+				candidates = append(candidates, candidate{id: id, score: score})
+				matched++
+			}
+		}
+		return n, last, rows.Err()
+	}
+
+	if rk.progress == nil {
+		if pages, _, err = read(nil, -1); err != nil {
+			return nil, false, err
+		}
+	} else {
+		// The fields of the provisional results are read between two pages,
+		// since the database may allow a single connection. Only the topK
+		// best candidates can still be in the results, so the others are
+		// dropped as the pages are read.
+		var after any
+		for {
+			n, last, err := read(after, 1)
+			if err != nil {
+				return nil, false, err
+			}
+			if n == 0 {
+				break
+			}
+			pages, after = pages+n, last
+			sortCandidates(candidates)
+			if len(candidates) > rk.topK {
+				candidates = candidates[:rk.topK]
+			}
+			partial, err := loadResults(ctx, db, rk, candidates)
+			if err != nil {
+				return nil, false, err
+			}
+			rk.report(partial, &reported)
+		}
+	}
+	if pages == 0 {
+		return nil, false, nil
+	}
+	rk.timings.count(scanned, matched)
+
+	sortStart := time.Now()
+	sortCandidates(candidates)
+	rk.timings.sorted(sortStart)
+	if len(candidates) > rk.topK {
+		candidates = candidates[:rk.topK]
+	}
+	results, err := loadResults(ctx, db, rk, candidates)
+	return results, true, err
+}
+
+// sortCandidates orders candidates by descending score, then by id.
+func sortCandidates(candidates []candidate) {
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score == candidates[j].score {
+			return candidates[i].id < candidates[j].id
+		}
+		return candidates[i].score > candidates[j].score
+	})
+}
+
+// loadResults reads the fields of the ranked candidates. Records deleted
+// since the pages were read are left out.
+func loadResults(ctx context.Context, db querier, rk ranking, candidates []candidate) ([]Result, error) {
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	ids := make([]string, len(candidates))
+	for i, c := range candidates {
+		ids[i] = c.id
+	}
+	list, err := json.Marshal(ids)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, `
+                SELECT r.id, r.data, r.lat, r.lng, v.embedding
+                FROM records AS r
+                LEFT JOIN records_vec AS v
+                        ON r.dataset = v.dataset AND r.id = v.id
+                WHERE r.dataset = ? AND r.id IN (SELECT value FROM json_each(?));
+        `, rk.dataset, string(list))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make(map[string]Result, len(candidates))
+	for rows.Next() {
+		var (
+			r    Result
+			data string
+			lat  sql.NullFloat64
+			lng  sql.NullFloat64
+			blob []byte
+		)
+		if err := rows.Scan(&r.ID, &data, &lat, &lng, &blob); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &r.Fields); err != nil {
+			return nil, fmt.Errorf("decode metadata for %s: %w", r.ID, err)
+		}
+		r.Dataset = rk.dataset
+		if lat.Valid {
+			v := lat.Float64
+			r.Lat = &v
+		}
+		if lng.Valid {
+			v := lng.Float64
+			r.Lng = &v
+		}
+		if rk.vectors && len(blob) > 0 {
+			if r.Vector, err = vector.Deserialize(blob); err != nil {
+				return nil, err
+			}
+		}
+		found[r.ID] = r
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0, len(candidates))
+	for _, c := range candidates {
+		if r, ok := found[c.id]; ok {
+			r.Score = c.score
+			results = append(results, r)
+		}
+	}
+	return results, nil
+}
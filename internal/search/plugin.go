@@ -0,0 +1,107 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"yashubustudio/csv-search/internal/database"
+)
+
+// FilterOperatorFunc reports whether the value of a metadata field passes a
+// custom filter operator given the value of the filter as arg.
+type FilterOperatorFunc func(value, arg string) bool
+
+// ScoreFunc returns the score of a result of a semantic search, given the
+// score computed so far (similarity with the boosts and distance weights
+// applied) and the result with its fields and distance.
+type ScoreFunc func(score float64, r Result) float64
+
+// plugins holds the filter operators and scorers registered by packages
+// built into the binary.
+var plugins struct {
+	mu sync.RWMutex
+	// filters maps operator names to the SQL functions that evaluate them.
+	filters map[string]string
+	scorers map[string]ScoreFunc
+}
+
+var pluginName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// RegisterFilterOperator adds a filter operator written "field@name=arg"
+// (Filter{Op: name}). The operator runs inside SQLite like the built-in
+// ones, so it must be registered before the database is opened, typically
+// from an init function. Records without the field never match.
+func RegisterFilterOperator(name string, fn FilterOperatorFunc) error {
+	if !pluginName.MatchString(name) {
+		return fmt.Errorf("filter operator name %q must be lower case letters, digits and underscores", name)
+	}
+	if fn == nil {
+		return fmt.Errorf("filter operator %s has no function", name)
+	}
+	plugins.mu.Lock()
+	defer plugins.mu.Unlock()
+	if _, ok := plugins.filters[name]; ok {
+		return fmt.Errorf("filter operator %q is already registered", name)
+	}
+	function := "csvsearch_filter_" + name
+	if err := database.RegisterPredicate(function, fn); err != nil {
+		return err
+	}
+	if plugins.filters == nil {
+		plugins.filters = make(map[string]string)
+	}
+	plugins.filters[name] = function
+	return nil
+}
+
+// filterFunction returns the SQL function of a registered filter operator.
+func filterFunction(name string) (string, bool) {
+	plugins.mu.RLock()
+	defer plugins.mu.RUnlock()
+	function, ok := plugins.filters[name]
+	return function, ok
+}
+
+// RegisterScorer adds a scorer that searches select by name with
+// Options.Scorer.
+func RegisterScorer(name string, fn ScoreFunc) error {
+	if !pluginName.MatchString(name) {
+		return fmt.Errorf("scorer name %q must be lower case letters, digits and underscores", name)
+	}
+	if fn == nil {
+		return fmt.Errorf("scorer %s has no function", name)
+	}
+	plugins.mu.Lock()
+	defer plugins.mu.Unlock()
+	if _, ok := plugins.scorers[name]; ok {
+		return fmt.Errorf("scorer %q is already registered", name)
+	}
+	if plugins.scorers == nil {
+		plugins.scorers = make(map[string]ScoreFunc)
+	}
+	plugins.scorers[name] = fn
+	return nil
+}
+
+// ValidateScorer reports whether name is a registered scorer or empty.
+func ValidateScorer(name string) error {
+	_, err := lookupScorer(name)
+	return err
+}
+
+// lookupScorer returns the scorer registered as name, or nil for an empty
+// name.
+func lookupScorer(name string) (ScoreFunc, error) {
+	if name = strings.TrimSpace(name); name == "" {
+		return nil, nil
+	}
+	plugins.mu.RLock()
+	defer plugins.mu.RUnlock()
+	fn, ok := plugins.scorers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown scorer %q", name)
+	}
+	return fn, nil
+}
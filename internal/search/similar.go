@@ -0,0 +1,117 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"yashubustudio/csv-search/internal/store"
+	"yashubustudio/csv-search/internal/vector"
+)
+
+// SimilarOptions describe a similar-by-ID search.
+type SimilarOptions struct {
+	// Dataset selects which logical table to search ("default" when empty).
+	Dataset string
+	// ID is the record whose stored embedding is used as the query. The
+	// record itself is left out of the results.
+	ID string
+	// TopK controls how many results are returned (defaults to 10 when
+	// non-positive).
+	TopK    int
+	Filters []Filter
+	// SparseWeight adds the weighted lexical score of the stored sparse
+	// weights when positive and the record has them.
+	SparseWeight float64
+	// Metric, MinScore, ScorePrecision, ScoreNormalization and TieBreak
+	// behave as in Options.
+	Metric             string
+	MinScore           float64
+	ScorePrecision     int
+	ScoreNormalization string
+	TieBreak           string
+	// IncludeVectors behaves as in Options.
+	IncludeVectors bool
+}
+
+// Similar ranks the records of a dataset by their similarity to the stored
+// embedding of opts.ID, without encoding anything. It returns an error
+// wrapping store.ErrNotFound when the record has no embedding.
+func Similar(ctx context.Context, db *sql.DB, opts SimilarOptions) ([]Result, error) {
+	if db == nil {
+		return nil, fmt.Errorf("db is nil")
+	}
+	return similar(ctx, db, opts)
+}
+
+func similar(ctx context.Context, db querier, opts SimilarOptions) ([]Result, error) {
+	id := strings.TrimSpace(opts.ID)
+	if id == "" {
+		return nil, fmt.Errorf("id must not be empty")
+	}
+	topK := opts.TopK
+	if topK <= 0 {
+		topK = 10
+	}
+	dataset := strings.TrimSpace(opts.Dataset)
+	if dataset == "" {
+		dataset = "default"
+	}
+	score, err := scorer(opts.Metric)
+	if err != nil {
+		return nil, err
+	}
+	tieBreak, err := normalizeTieBreak(opts.TieBreak)
+	if err != nil {
+		return nil, err
+	}
+	normalization, err := normalizeScoreMode(opts.ScoreNormalization)
+	if err != nil {
+		return nil, err
+	}
+
+	var blob, sparseBlob []byte
+	err = db.QueryRowContext(ctx, `
+                SELECT v.embedding, s.weights
+                FROM records_vec AS v
+                LEFT JOIN records_sparse AS s
+                        ON v.dataset = s.dataset AND v.id = s.id
+                WHERE v.dataset = ? AND v.id = ?;
+        `, dataset, id).Scan(&blob, &sparseBlob)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%s/%s: %w", dataset, id, store.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	qvec, err := vector.Deserialize(blob)
+	if err != nil {
+		return nil, err
+	}
+	var qsparse map[int32]float32
+	sparseWeight := opts.SparseWeight
+	if sparseWeight > 0 && len(sparseBlob) > 0 {
+		if qsparse, err = vector.DeserializeSparse(sparseBlob); err != nil {
+			return nil, err
+		}
+	} else {
+		sparseWeight = 0
+	}
+	return rank(ctx, db, ranking{
+		dataset:      dataset,
+		qvec:         qvec,
+		qsparse:      qsparse,
+		sparseWeight: sparseWeight,
+		score:        score,
+		minScore:     opts.MinScore,
+		precision:    opts.ScorePrecision,
+		normalize:    normalization,
+		tieBreak:     tieBreak,
+		filters:      opts.Filters,
+		topK:         topK,
+		exclude:      id,
+		vectors:      opts.IncludeVectors,
+	})
+}
@@ -0,0 +1,263 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// termsRefresh is how long the term dictionary of a dataset is trusted before
+// Suggest reloads it, so that records written by another process are picked
+// up.
+const termsRefresh = 5 * time.Minute
+
+// minSuggestLength is the length under which query terms are not corrected:
+// one edit away from a short word there are too many other words.
+const minSuggestLength = 4
+
+// termSet is the cached term dictionary of a dataset: how often every term of
+// ASCII letters occurs in its full-text index.
+type termSet struct {
+	freq   map[string]int64
+	loaded time.Time
+}
+
+// Suggest returns query with every term that does not occur in the full-text
+// index of dataset replaced by the most frequent indexed term at the smallest
+// edit distance (one edit for terms under eight letters, two otherwise), or ""
+// when no term was replaced. Only terms of at least four ASCII letters are
+// corrected. The dictionary is cached until InvalidateTerms.
+func (e *Engine) Suggest(ctx context.Context, dataset, query string) (string, error) {
+	if e == nil || e.db == nil {
+		return "", fmt.Errorf("db is nil")
+	}
+	dataset = strings.TrimSpace(dataset)
+	if dataset == "" {
+		dataset = "default"
+	}
+	words := strings.Fields(query)
+	var set *termSet
+	changed := false
+	for i, word := range words {
+		term := strings.ToLower(word)
+		if len(term) < minSuggestLength || !asciiLetters(term) {
+			continue
+		}
+		if set == nil {
+			var err error
+			if set, err = e.termSet(ctx, dataset); err != nil {
+				return "", err
+			}
+		}
+		if _, ok := set.freq[term]; ok {
+			continue
+		}
+		if best := set.closest(term); best != "" {
+			words[i] = best
+			changed = true
+		}
+	}
+	if !changed {
+		return "", nil
+	}
+	return strings.Join(words, " "), nil
+}
+
+// InvalidateTerms drops the cached term dictionaries, e.g. after an ingest.
+func (e *Engine) InvalidateTerms() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.terms = nil
+}
+
+// termSet returns the term dictionary of dataset, loading it unless it is
+// cached and recent.
+func (e *Engine) termSet(ctx context.Context, dataset string) (*termSet, error) {
+	e.mu.Lock()
+	set, ok := e.terms[dataset]
+	e.mu.Unlock()
+	if ok && time.Since(set.loaded) < termsRefresh {
+		return set, nil
+	}
+	rows, err := e.db.QueryContext(ctx, `
+                SELECT v.term, COUNT(*) FROM records_fts_vocab AS v
+                INNER JOIN records_fts AS f ON f.rowid = v.doc
+                WHERE f.dataset = ?
+                GROUP BY v.term
+        `, dataset)
+	if err != nil {
+		return nil, fmt.Errorf("load terms of %s: %w", dataset, err)
+	}
+	defer rows.Close()
+	set = &termSet{freq: make(map[string]int64), loaded: time.Now()}
+	for rows.Next() {
+		var (
+			term string
+			n    int64
+		)
+		if err := rows.Scan(&term, &n); err != nil {
+			return nil, err
+		}
+		if asciiLetters(term) {
+			set.freq[term] = n
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	if e.terms == nil {
+		e.terms = make(map[string]*termSet)
+	}
+	e.terms[dataset] = set
+	e.mu.Unlock()
+	return set, nil
+}
+
+// closest returns the most frequent term of s within the edit distance
+// allowed for term, preferring fewer edits and then the alphabetically first
+// term, or "" when there is none.
+func (s *termSet) closest(term string) string {
+	maxDist := 1
+	if len(term) >= 8 {
+		maxDist = 2
+	}
+	var (
+		best     string
+		bestDist = maxDist + 1
+		bestFreq int64
+	)
+	for candidate, freq := range s.freq {
+		if diff := len(candidate) - len(term); diff > maxDist || -diff > maxDist {
+			continue
+		}
+		d := editDistance(term, candidate, maxDist)
+		if d > maxDist {
+			continue
+		}
+		if d < bestDist || (d == bestDist && (freq > bestFreq || (freq == bestFreq && candidate < best))) {
+			best, bestDist, bestFreq = candidate, d, freq
+		}
+	}
+	return best
+}
+
+// editDistance returns the number of insertions, deletions, substitutions and
+// transpositions of adjacent letters turning a into b, or limit+1 once it is
+// known to exceed limit.
+func editDistance(a, b string, limit int) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d := min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d = min(d, prev2[j-2]+1)
+			}
+			cur[j] = d
+			rowMin = min(rowMin, d)
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
+
+func asciiLetters(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// Completion is a completion of the last word of a query.
+type Completion struct {
+	// Text is the query with its last word completed.
+	Text string `json:"text"`
+	// Count is the number of records of the dataset whose text contains the
+	// completed term.
+	Count int64 `json:"count"`
+}
+
+// CompleteOptions describe a type-ahead lookup.
+type CompleteOptions struct {
+	// Dataset selects which logical table to draw terms from ("default"
+	// when empty).
+	Dataset string
+	// Query is the text typed so far; its last whitespace-separated word is
+	// the prefix completed.
+	Query string
+	// Limit caps the completions returned (10 when non-positive).
+	Limit int
+}
+
+// Complete returns the indexed terms of the dataset starting with the last
+// word of opts.Query, most frequent first, each as the query with that word
+// replaced. Terms are matched as the full-text index stores them: lower case,
+// split on spaces and punctuation, so that a run of Japanese text completes
+// to the whole run.
+func (e *Engine) Complete(ctx context.Context, opts CompleteOptions) ([]Completion, error) {
+	if e == nil || e.db == nil {
+		return nil, fmt.Errorf("db is nil")
+	}
+	words := strings.Fields(opts.Query)
+	if len(words) == 0 {
+		return nil, fmt.Errorf("query must not be empty")
+	}
+	dataset := strings.TrimSpace(opts.Dataset)
+	if dataset == "" {
+		dataset = "default"
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+	prefix := strings.ToLower(words[len(words)-1])
+	// Terms compare as UTF-8 bytes, so every term starting with prefix sorts
+	// before prefix followed by the largest code point.
+	rows, err := e.QueryContext(ctx, `
+                SELECT v.term, COUNT(DISTINCT v.doc) FROM records_fts_vocab AS v
+                INNER JOIN records_fts AS f ON f.rowid = v.doc
+                WHERE v.term >= ? AND v.term < ? AND f.dataset = ?
+                GROUP BY v.term
+                ORDER BY 2 DESC, v.term
+                LIMIT ?
+        `, prefix, prefix+string(utf8.MaxRune), dataset, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	head := strings.Join(words[:len(words)-1], " ")
+	if head != "" {
+		head += " "
+	}
+	var out []Completion
+	for rows.Next() {
+		var (
+			term string
+			c    Completion
+		)
+		if err := rows.Scan(&term, &c.Count); err != nil {
+			return nil, err
+		}
+		c.Text = head + term
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
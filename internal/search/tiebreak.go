@@ -0,0 +1,69 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Orders of equally scored results accepted by Options.TieBreak.
+const (
+	// TieBreakID orders ties by ascending id (the default).
+	TieBreakID = "id"
+	// TieBreakUpdated puts the most recently ingested or changed records
+	// first, then orders by id. Records not written since the column was
+	// added come last.
+	TieBreakUpdated = "updated"
+	// TieBreakIngestion keeps the order in which the records were first
+	// ingested.
+	TieBreakIngestion = "ingestion"
+)
+
+// ValidateTieBreak reports whether order is accepted by Options.TieBreak.
+func ValidateTieBreak(order string) error {
+	_, err := normalizeTieBreak(order)
+	return err
+}
+
+func normalizeTieBreak(order string) (string, error) {
+	switch order = strings.ToLower(strings.TrimSpace(order)); order {
+	case "", TieBreakID:
+		return TieBreakID, nil
+	case TieBreakUpdated, TieBreakIngestion:
+		return order, nil
+	}
+	return "", fmt.Errorf("unknown tie break %q (want id, updated or ingestion)", order)
+}
+
+// tiedResult is a Result with the keys its ties are broken by.
+type tiedResult struct {
+	Result
+	rowid, updated int64
+}
+
+// tieLess returns the order of two equally ranked results under a normalized
+// tie break.
+func tieLess(order string) func(a, b *tiedResult) bool {
+	switch order {
+	case TieBreakUpdated:
+		return func(a, b *tiedResult) bool {
+			if a.updated != b.updated {
+				return a.updated > b.updated
+			}
+			return a.ID < b.ID
+		}
+	case TieBreakIngestion:
+		return func(a, b *tiedResult) bool { return a.rowid < b.rowid }
+	}
+	return func(a, b *tiedResult) bool { return a.ID < b.ID }
+}
+
+// tieOrderBy is the SQL equivalent of tieLess over the records table r.
+func tieOrderBy(order string) string {
+	switch order {
+	case TieBreakUpdated:
+		return "r.updated_at DESC, r.id"
+	case TieBreakIngestion:
+		return "r.rowid"
+	}
+	return "r.id"
+}
@@ -5,10 +5,14 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"math"
+	"slices"
 	"sort"
 	"strings"
+	"time"
 
-	"yashubustudio/csv-search/emb"
+	"yashubustudio/csv-search/internal/embedding"
 	"yashubustudio/csv-search/internal/vector"
 )
 
@@ -20,83 +24,457 @@ type Result struct {
 	Score   float64           `json:"score"`
 	Lat     *float64          `json:"lat,omitempty"`
 	Lng     *float64          `json:"lng,omitempty"`
+	// DistanceKm is the distance from the point of a Near search.
+	DistanceKm *float64 `json:"distance_km,omitempty"`
+	// Vector is the stored embedding, set when Options.IncludeVectors is.
+	Vector []float32 `json:"vector,omitempty"`
 }
 
-// Filter represents a metadata equality condition applied to search results.
-type Filter struct {
-	Field string
-	Value string
+// Options describe a single vector search request.
+type Options struct {
+	// Dataset selects which logical table to search ("default" when empty).
+	Dataset string
+	Query   string
+	// TopK controls how many results are returned (defaults to 10 when
+	// non-positive).
+	TopK    int
+	Filters []Filter
+	// IDs, when not empty, restricts the search to the records with these
+	// ids, e.g. the results of a previous search that a follow-up query
+	// re-ranks. Unknown ids are ignored.
+	IDs []string
+	// SparseWeight enables hybrid retrieval when positive: the bge-m3 lexical
+	// score is multiplied by the weight and added to the cosine similarity.
+	SparseWeight float64
+	// Metric selects the similarity between the query and stored vectors:
+	// MetricCosine (the default when empty), MetricDot or MetricEuclidean.
+	Metric string
+	// MinScore drops results scoring below it; zero keeps every result.
+	MinScore float64
+	// ScorePrecision rounds the reported scores to that many decimal places
+	// so that float noise (e.g. from another CPU or storage format) does not
+	// show up in result sets that are compared; zero leaves them as computed.
+	// Results are ordered by the unrounded scores.
+	ScorePrecision int
+	// ScoreNormalization rescales the scores of the returned results before
+	// they are rounded: ScoresRaw (the default when empty), ScoresMinMax or
+	// ScoresSoftmax, so that consumers thresholding on them get comparable
+	// numbers across queries and hybrid weights. MinScore applies to the raw
+	// scores.
+	ScoreNormalization string
+	// TieBreak orders results with equal scores: TieBreakID (the default
+	// when empty), TieBreakUpdated or TieBreakIngestion, so that clients
+	// paging through results get a stable order.
+	TieBreak string
+	// GroupBy collapses the results to the best GroupSize (1 when zero) per
+	// value of that metadata field, e.g. one result per store chain; TopK
+	// counts the results kept. Records without the field are not collapsed.
+	GroupBy   string
+	GroupSize int
+	// FieldBoosts add weight times FieldMatch of the query and the field's
+	// value to the score of every record, e.g. as fitted from feedback by
+	// FitFieldBoosts.
+	FieldBoosts map[string]float64
+	// TermBoosts multiply the score of a record by the factor of every term
+	// that occurs both in the query and in one of its fields (see
+	// ParseTermBoosts). Terms must be lower case.
+	TermBoosts map[string]float64
+	// Scorer names a ScoreFunc added with RegisterScorer that rescores every
+	// record once the boosts and distance weights are applied; MinScore and
+	// the ordering use its scores.
+	Scorer string
+	// Languages route the query by its detected language (see
+	// DetectLanguage): the QueryPrefix of the language is encoded with the
+	// query and its SparseWeight replaces SparseWeight.
+	Languages map[string]Language
+	// Near, when set, keeps the records with coordinates (within its radius)
+	// and reports their distance from its point.
+	Near *Near
+	// Vector, when set, is used as the query embedding instead of encoding
+	// Query, e.g. when a batch of queries was encoded up front. Hybrid
+	// searches ignore it because they need the lexical weights as well, and
+	// so do queries routed to a language with a QueryPrefix.
+	Vector []float32
+	// IncludeVectors returns the stored embedding of every result.
+	IncludeVectors bool
+	// Timings, when set, receives how long the query encoding and the record
+	// scan took.
+	Timings *Timings
+	// Progress, when set, receives the best results among the records
+	// scored so far whenever they change, after every vector page or
+	// progressRows rows, so that they can be shown before the search ends.
+	// They are provisional: records scored later may displace them. The
+	// final results are only returned. It is called while the search reads
+	// the database and must not query it.
+	Progress func([]Result)
+	// Logger receives the debug summary of the search (slog.Default() when
+	// nil).
+	Logger *slog.Logger
 }
 
-// VectorSearch encodes the query with enc and ranks records stored in the
-// database by cosine similarity. The dataset parameter selects which logical
-// table to search. The topK parameter controls how many results are returned
-// (defaults to 10 when non-positive). When filters are provided they must all
-// match the metadata fields on a record for it to be included in the results.
-func VectorSearch(ctx context.Context, db *sql.DB, enc *emb.Encoder, dataset, query string, topK int, filters []Filter) ([]Result, error) {
-	if enc == nil {
-		return nil, fmt.Errorf("encoder is nil")
+// Similarity metrics accepted by Options.Metric.
+const (
+	MetricCosine = "cosine"
+	MetricDot    = "dot"
+	// MetricEuclidean scores 1/(1+distance).
+	MetricEuclidean = "euclidean"
+)
+
+// ValidateMetric reports whether metric is accepted by Options.Metric.
+func ValidateMetric(metric string) error {
+	_, err := scorer(metric)
+	return err
+}
+
+// scorer returns the similarity function of metric.
+func scorer(metric string) (func(a, b []float32) float64, error) {
+	switch strings.ToLower(strings.TrimSpace(metric)) {
+	case "", MetricCosine:
+		return vector.Cosine, nil
+	case MetricDot:
+		return vector.Dot, nil
+	case MetricEuclidean:
+		return vector.EuclideanSimilarity, nil
 	}
+	return nil, fmt.Errorf("unknown metric %q (want cosine, dot or euclidean)", metric)
+}
+
+// Timings break down the duration of a search and count the records it
+// considered.
+type Timings struct {
+	Encode time.Duration
+	// Scan covers reading and ranking the records, including Sort.
+	Scan time.Duration
+	Sort time.Duration
+	// Scanned counts the records read by the scan. Metadata filters and
+	// the id restriction are applied by SQLite before it, so they lower
+	// Scanned; Matched counts the scanned records that also passed the
+	// radius and minimum score and were ranked.
+	Scanned int
+	Matched int
+}
+
+// count records the candidates of a search in t, which may be nil.
+func (t *Timings) count(scanned, matched int) {
+	if t != nil {
+		t.Scanned, t.Matched = scanned, matched
+	}
+}
+
+// sorted records how long sorting the candidates took since start in t,
+// which may be nil.
+func (t *Timings) sorted(start time.Time) {
+	if t != nil {
+		t.Sort = time.Since(start)
+	}
+}
+
+// VectorSearch encodes the query with enc and ranks records stored in the
+// database by cosine similarity. When filters are provided they must all match
+// the metadata fields on a record for it to be included in the results; they
+// are evaluated by SQLite, so the vectors of other records are not read.
+func VectorSearch(ctx context.Context, db *sql.DB, enc embedding.Embedder, opts Options) ([]Result, error) {
 	if db == nil {
 		return nil, fmt.Errorf("db is nil")
 	}
+	return vectorSearch(ctx, db, enc, opts)
+}
+
+func vectorSearch(ctx context.Context, db querier, enc embedding.Embedder, opts Options) ([]Result, error) {
+	if enc == nil {
+		return nil, fmt.Errorf("encoder is nil")
+	}
+	query := opts.Query
 	if query == "" {
 		return nil, fmt.Errorf("query must not be empty")
 	}
+	topK := opts.TopK
 	if topK <= 0 {
 		topK = 10
 	}
+	filters := opts.Filters
 
-	dataset = strings.TrimSpace(dataset)
+	dataset := strings.TrimSpace(opts.Dataset)
 	if dataset == "" {
 		dataset = "default"
 	}
 
-	qvec, err := enc.Encode(query)
+	score, err := scorer(opts.Metric)
+	if err != nil {
+		return nil, err
+	}
+	tieBreak, err := normalizeTieBreak(opts.TieBreak)
+	if err != nil {
+		return nil, err
+	}
+	normalization, err := normalizeScoreMode(opts.ScoreNormalization)
+	if err != nil {
+		return nil, err
+	}
+	rescore, err := lookupScorer(opts.Scorer)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateFieldBoosts(opts.FieldBoosts); err != nil {
+		return nil, err
+	}
+	if err := ValidateGroup(opts.GroupBy, opts.GroupSize); err != nil {
+		return nil, err
+	}
+	if opts.Near != nil {
+		if err := opts.Near.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	lang, settings := routeLanguage(opts.Languages, query)
+	sparseWeight := opts.SparseWeight
+	if settings.SparseWeight != 0 {
+		sparseWeight = settings.SparseWeight
+	}
+	hybrid := sparseWeight > 0
+	encoded := settings.QueryPrefix + query
+	encodeStart := time.Now()
+	var (
+		qvec    []float32
+		qsparse map[int32]float32
+	)
+	if hybrid {
+		sparseEnc, ok := embedding.Sparse(enc)
+		if !ok {
+			return nil, fmt.Errorf("sparse weight requested but the encoder has no sparse head")
+		}
+		qvec, qsparse, err = sparseEnc.EncodeHybrid(encoded)
+	} else if len(opts.Vector) > 0 && settings.QueryPrefix == "" {
+		qvec = opts.Vector
+	} else {
+		qvec, err = enc.Encode(encoded)
+	}
+	if err != nil {
+		return nil, err
+	}
+	scanStart := time.Now()
+	results, err := rank(ctx, db, ranking{
+		dataset:      dataset,
+		qvec:         qvec,
+		qsparse:      qsparse,
+		sparseWeight: sparseWeight,
+		score:        score,
+		minScore:     opts.MinScore,
+		precision:    opts.ScorePrecision,
+		normalize:    normalization,
+		tieBreak:     tieBreak,
+		query:        query,
+		boosts:       opts.FieldBoosts,
+		terms:        queryTermBoosts(opts.TermBoosts, query),
+		rescore:      rescore,
+		filters:      filters,
+		ids:          opts.IDs,
+		near:         opts.Near,
+		topK:         topK,
+		groupBy:      opts.GroupBy,
+		groupSize:    opts.GroupSize,
+		vectors:      opts.IncludeVectors,
+		timings:      opts.Timings,
+		progress:     opts.Progress,
+	})
+	encodeTime, scanTime := scanStart.Sub(encodeStart), time.Since(scanStart)
+	if opts.Timings != nil {
+		opts.Timings.Encode = encodeTime
+		opts.Timings.Scan = scanTime
+	}
 	if err != nil {
 		return nil, err
 	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.DebugContext(ctx, "vector search", "dataset", dataset, "query", query, "language", lang, "top_k", topK,
+		"filters", len(filters), "hybrid", hybrid, "results", len(results), "encode", encodeTime, "scan", scanTime)
+	return results, nil
+}
+
+// ranking describes a rank call.
+type ranking struct {
+	dataset      string
+	qvec         []float32
+	qsparse      map[int32]float32
+	sparseWeight float64
+	score        func(a, b []float32) float64
+	minScore     float64
+	precision    int
+	normalize    string
+	tieBreak     string
+	// query and boosts give the field boosts of a search with query text;
+	// terms are the term boosts whose term occurs in the query.
+	query  string
+	boosts map[string]float64
+	terms  map[string]float64
+	// rescore is the scorer of Options.Scorer.
+	rescore ScoreFunc
+	filters []Filter
+	ids     []string
+	near    *Near
+	topK    int
+	// groupBy and groupSize collapse the results as Options.GroupBy does.
+	groupBy   string
+	groupSize int
+	// exclude is the id of a record left out of the results.
+	exclude string
+	// vectors keeps the stored embeddings in the results.
+	vectors bool
+	// timings, when set, receives the candidate counts and sort time.
+	timings *Timings
+	// progress, when set, receives the provisional results (see
+	// Options.Progress).
+	progress func([]Result)
+}
 
+// progressRows is how many rows rank scans between two progress reports.
+const progressRows = 1024
+
+// report passes the provisional results to rk.progress unless they are the
+// ones reported last, whose ids are kept in last.
+func (rk ranking) report(results []Result, last *[]string) {
+	ids := make([]string, len(results))
+	for i := range results {
+		ids[i] = results[i].ID
+	}
+	if slices.Equal(ids, *last) {
+		return
+	}
+	*last = ids
+	normalizeScores(results, rk.normalize)
+	roundScores(results, rk.precision)
+	rk.progress(results)
+}
+
+// rank scores every record of the dataset against qvec (plus the weighted
+// lexical score when sparseWeight is positive) and returns the topK best
+// matches that pass the filters, are among ids when it is set and reach
+// minScore. Dense searches without filters, ids, a point, boosts, a scorer or
+// grouping read the vector pages of the dataset when it has them and ties are broken
+// by id, the only key the pages hold. rk.progress, when set, is given the
+// provisional results along the way.
+func rank(ctx context.Context, db querier, rk ranking) ([]Result, error) {
+	dataset, filters, exclude, near := rk.dataset, rk.filters, rk.exclude, rk.near
+	hybrid := rk.sparseWeight > 0
+	if rk.tieBreak == "" {
+		rk.tieBreak = TieBreakID
+	}
+	if !hybrid && len(filters) == 0 && len(rk.ids) == 0 && near == nil && len(rk.boosts) == 0 && len(rk.terms) == 0 && rk.rescore == nil && rk.groupBy == "" && rk.tieBreak == TieBreakID {
+		if results, ok, err := rankPages(ctx, db, rk); err != nil || ok {
+			normalizeScores(results, rk.normalize)
+			roundScores(results, rk.precision)
+			return results, err
+		}
+	}
+	where, args, err := searchClause(filters, rk.ids)
+	if err != nil {
+		return nil, err
+	}
+	var geoJoin string
+	if near != nil {
+		join, geoWhere, geoArgs := near.clause()
+		geoJoin, where, args = join, where+geoWhere, append(args, geoArgs...)
+	}
 	rows, err := db.QueryContext(ctx, `
-                SELECT r.id, r.data, r.lat, r.lng, v.embedding
+                SELECT r.rowid, COALESCE(r.updated_at, 0), r.id, r.data, r.lat, r.lng, v.embedding, s.weights
                 FROM records AS r
                 INNER JOIN records_vec AS v
                         ON r.dataset = v.dataset AND r.id = v.id
-                WHERE r.dataset = ?;
-        `, dataset)
+                LEFT JOIN records_sparse AS s
+                        ON r.dataset = s.dataset AND r.id = s.id`+geoJoin+`
+                WHERE r.dataset = ?`+where+`;
+        `, append([]any{dataset}, args...)...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var results []Result
+	// The stored vectors are viewed in place or decoded into pooled scratch
+	// space, since most of them are scored and dropped; only the kept ones
+	// are copied out.
+	scratch := vector.GetFloats()
+	defer vector.PutFloats(scratch)
+	weights := vector.GetSparse()
+	defer vector.PutSparse(weights)
+
+	byDistance := near != nil && near.SortByDistance
+	tieLess := tieLess(rk.tieBreak)
+	var (
+		results  []tiedResult
+		scanned  int
+		reported []string
+	)
+	// best sorts results and returns the topK best, grouped.
+	best := func() []Result {
+		sort.Slice(results, func(i, j int) bool {
+			a, b := &results[i], &results[j]
+			switch {
+			case byDistance && *a.DistanceKm != *b.DistanceKm:
+				return *a.DistanceKm < *b.DistanceKm
+			case !byDistance && a.Score != b.Score:
+				return a.Score > b.Score
+			}
+			return tieLess(a, b)
+		})
+		// Grouping happens after scoring, so every group keeps its best
+		// results.
+		group := newGrouper(rk.groupBy, rk.groupSize)
+		ranked := make([]Result, 0, min(len(results), rk.topK))
+		for i := range results {
+			if len(ranked) == rk.topK {
+				break
+			}
+			if group.keep(results[i].Fields) {
+				ranked = append(ranked, results[i].Result)
+			}
+		}
+		return ranked
+	}
 	for rows.Next() {
+		if rk.progress != nil && scanned > 0 && scanned%progressRows == 0 {
+			rk.report(best(), &reported)
+		}
 		var (
-			r    Result
-			data string
-			lat  sql.NullFloat64
-			lng  sql.NullFloat64
-			blob []byte
+			r          tiedResult
+			data       string
+			lat        sql.NullFloat64
+			lng        sql.NullFloat64
+			blob       sql.RawBytes
+			sparseBlob sql.RawBytes
 		)
-		if err := rows.Scan(&r.ID, &data, &lat, &lng, &blob); err != nil {
+		if err := rows.Scan(&r.rowid, &r.updated, &r.ID, &data, &lat, &lng, &blob, &sparseBlob); err != nil {
 			return nil, err
 		}
+		scanned++
+		if exclude != "" && r.ID == exclude {
+			continue
+		}
 
 		if err := json.Unmarshal([]byte(data), &r.Fields); err != nil {
 			return nil, fmt.Errorf("decode metadata for %s: %w", r.ID, err)
 		}
 
-		if !matchesFilters(r.Fields, filters) {
-			continue
-		}
-
-		vec, err := vector.Deserialize(blob)
+		vec, err := vector.View(scratch, blob)
 		if err != nil {
 			return nil, err
 		}
-		r.Score = vector.Cosine(qvec, vec)
-		r.Dataset = dataset
-
+		r.Score = rk.score(rk.qvec, vec)
+		if hybrid && len(sparseBlob) > 0 {
+			if err := vector.DeserializeSparseInto(weights, sparseBlob); err != nil {
+				return nil, err
+			}
+			r.Score += rk.sparseWeight * vector.LexicalScore(rk.qsparse, weights)
+		}
+		if len(rk.boosts) > 0 {
+			r.Score += fieldBoost(rk.boosts, rk.query, r.Fields)
+		}
+		if len(rk.terms) > 0 {
+			r.Score *= termBoost(rk.terms, r.Fields)
+		}
 		if lat.Valid {
 			v := lat.Float64
 			r.Lat = &v
@@ -105,46 +483,61 @@ func VectorSearch(ctx context.Context, db *sql.DB, enc *emb.Encoder, dataset, qu
 			v := lng.Float64
 			r.Lng = &v
 		}
+		if near != nil && !near.measure(&r.Result) {
+			continue
+		}
+		r.Dataset = dataset
+		if rk.rescore != nil {
+			r.Score = rk.rescore(r.Score, r.Result)
+		}
+		if rk.minScore != 0 && r.Score < rk.minScore {
+			continue
+		}
+		if rk.vectors {
+			r.Vector = append([]float32(nil), vec...)
+		}
 
 		results = append(results, r)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	rk.timings.count(scanned, len(results))
 
-	sort.Slice(results, func(i, j int) bool {
-		if results[i].Score == results[j].Score {
-			return results[i].ID < results[j].ID
-		}
-		return results[i].Score > results[j].Score
-	})
+	sortStart := time.Now()
+	ranked := best()
+	rk.timings.sorted(sortStart)
+	normalizeScores(ranked, rk.normalize)
+	roundScores(ranked, rk.precision)
+	return ranked, nil
+}
+
+// maxScorePrecision is the largest ScorePrecision; float64 holds about 15
+// significant decimal digits.
+const maxScorePrecision = 15
 
-	if len(results) > topK {
-		results = results[:topK]
+// ValidateScorePrecision reports whether digits is accepted by
+// Options.ScorePrecision.
+func ValidateScorePrecision(digits int) error {
+	if digits < 0 || digits > maxScorePrecision {
+		return fmt.Errorf("score precision %d out of range (0 to %d decimal places)", digits, maxScorePrecision)
 	}
-	return results, nil
+	return nil
 }
 
-func matchesFilters(fields map[string]string, filters []Filter) bool {
-	if len(filters) == 0 {
-		return true
-	}
-	if len(fields) == 0 {
-		return false
+// roundScores rounds the score of every result to digits decimal places,
+// half away from zero; zero digits leave the scores unchanged. Negative zero
+// becomes zero so that it prints the same.
+func roundScores(results []Result, digits int) {
+	if digits <= 0 {
+		return
 	}
-	for _, f := range filters {
-		field := strings.TrimSpace(f.Field)
-		value := f.Value
-		if field == "" {
-			continue
-		}
-		v, ok := fields[field]
-		if !ok {
-			return false
-		}
-		if v != value {
-			return false
+	scale := math.Pow10(min(digits, maxScorePrecision))
+	for i := range results {
+		score := math.Round(results[i].Score*scale) / scale
+		if score == 0 {
+			score = 0
 		}
+		results[i].Score = score
 	}
-	return true
 }
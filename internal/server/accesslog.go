@@ -0,0 +1,169 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"yashubustudio/csv-search/internal/search"
+)
+
+// Access log formats accepted by Config.AccessLogFormat.
+const (
+	AccessLogJSON   = "json"
+	AccessLogCommon = "common"
+)
+
+// accessLogger writes one line per request to Config.AccessLog.
+type accessLogger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+}
+
+func newAccessLogger(w io.Writer, format string) (*accessLogger, error) {
+	if w == nil {
+		return nil, nil
+	}
+	switch format {
+	case "":
+		format = AccessLogCommon
+	case AccessLogJSON, AccessLogCommon:
+	default:
+		return nil, fmt.Errorf("unknown access log format %q (want %q or %q)", format, AccessLogJSON, AccessLogCommon)
+	}
+	return &accessLogger{w: w, format: format}, nil
+}
+
+// accessEntry is the JSON shape of an access log line. EncodeMS and ScanMS are
+// only present for searches.
+type accessEntry struct {
+	Time       time.Time `json:"time"`
+	Remote     string    `json:"remote"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Query      string    `json:"query,omitempty"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMS float64   `json:"duration_ms"`
+	EncodeMS   *float64  `json:"encode_ms,omitempty"`
+	ScanMS     *float64  `json:"scan_ms,omitempty"`
+}
+
+func (l *accessLogger) log(e accessEntry) {
+	var line []byte
+	if l.format == AccessLogJSON {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return
+		}
+		line = append(data, '\n')
+	} else {
+		target := e.Path
+		if e.Query != "" {
+			target += "?" + e.Query
+		}
+		line = fmt.Appendf(nil, "%s - - [%s] %q %d %d %.3fms",
+			e.Remote, e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+			e.Method+" "+target+" "+e.Proto, e.Status, e.Bytes, e.DurationMS)
+		if e.EncodeMS != nil && e.ScanMS != nil {
+			line = fmt.Appendf(line, " encode=%.3fms scan=%.3fms", *e.EncodeMS, *e.ScanMS)
+		}
+		line = append(line, '\n')
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(line)
+}
+
+type timingsKey struct{}
+
+// noteTimings hands the search stage timings to the access log middleware.
+func noteTimings(ctx context.Context, timings search.Timings) {
+	if slot, ok := ctx.Value(timingsKey{}).(*search.Timings); ok {
+		*slot = timings
+	}
+}
+
+// accessLog wraps next so that every request is written to the access log.
+func (s *Server) accessLog(next http.Handler) http.Handler {
+	if s.access == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		timings := &search.Timings{}
+		rec := &accessRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), timingsKey{}, timings)))
+
+		remote := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(remote); err == nil {
+			remote = host
+		}
+		entry := accessEntry{
+			Time:       start,
+			Remote:     remote,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Query:      r.URL.RawQuery,
+			Proto:      r.Proto,
+			Status:     rec.status,
+			Bytes:      rec.bytes,
+			DurationMS: milliseconds(time.Since(start)),
+		}
+		if *timings != (search.Timings{}) {
+			encode, scan := milliseconds(timings.Encode), milliseconds(timings.Scan)
+			entry.EncodeMS, entry.ScanMS = &encode, &scan
+		}
+		s.access.log(entry)
+	})
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// accessRecorder captures the status code and response size. It forwards
+// Hijack so that WebSocket upgrades keep working behind the access log.
+type accessRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (r *accessRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *accessRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *accessRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *accessRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	r.status = http.StatusSwitchingProtocols
+	r.wroteHeader = true
+	return hj.Hijack()
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ReloadRequest carries the encoder assets for POST /admin/reload-model. Empty
+// fields keep the currently loaded values.
+type ReloadRequest struct {
+	OrtLibrary    string   `json:"ort_lib,omitempty"`
+	ModelPath     string   `json:"model,omitempty"`
+	TokenizerPath string   `json:"tokenizer,omitempty"`
+	MaxSeqLen     int      `json:"max_seq_len,omitempty"`
+	SparseHead    string   `json:"sparse_head,omitempty"`
+	Truncation    string   `json:"truncation,omitempty"`
+	Normalize     []string `json:"normalize,omitempty"`
+}
+
+func (s *Server) handleReloadModel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+
+	var req ReloadRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+			return
+		}
+	}
+	req.OrtLibrary = strings.TrimSpace(req.OrtLibrary)
+	req.ModelPath = strings.TrimSpace(req.ModelPath)
+	req.TokenizerPath = strings.TrimSpace(req.TokenizerPath)
+	req.SparseHead = strings.TrimSpace(req.SparseHead)
+	req.Truncation = strings.TrimSpace(req.Truncation)
+
+	// Loading a model can take far longer than a search, so the reload is not
+	// bound by RequestTimeout.
+	loaded, err := s.cfg.ReloadModel(r.Context(), req)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.purgeCaches()
+	s.log.Info("encoder reloaded", "model", loaded.ModelPath, "tokenizer", loaded.TokenizerPath)
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"status":  "reloaded",
+		"encoder": loaded,
+	})
+}
+
+// authorizeAdmin checks the bearer token when one is configured and otherwise
+// restricts admin endpoints to loopback clients. It writes the error response
+// itself and reports whether the request may proceed.
+func (s *Server) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if token := s.cfg.AdminToken; token != "" {
+		const prefix = "Bearer "
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, prefix) || subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, prefix)), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="csv-search admin"`)
+			s.writeError(w, http.StatusUnauthorized, fmt.Errorf("admin token required"))
+			return false
+		}
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		s.writeError(w, http.StatusForbidden, fmt.Errorf("admin endpoints are restricted to localhost unless an admin token is configured"))
+		return false
+	}
+	return true
+}
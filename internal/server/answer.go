@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"yashubustudio/csv-search/internal/search"
+)
+
+// defaultAnswerTopK is the number of results given to Config.Answer when
+// neither the request nor Config.AnswerTopK sets it.
+const defaultAnswerTopK = 5
+
+// Answer is the answer of Config.Answer to a question.
+type Answer struct {
+	Text string
+	// Citations are the ids of the results the answer cites.
+	Citations []string
+	Model     string
+}
+
+// answerResponse is the /answer response: the answer and the results it was
+// given.
+type answerResponse struct {
+	Query     string          `json:"query"`
+	Answer    string          `json:"answer"`
+	Citations []string        `json:"citations"`
+	Model     string          `json:"model,omitempty"`
+	Results   []search.Result `json:"results"`
+	TookMS    float64         `json:"took_ms"`
+}
+
+// handleAnswer runs the search described by the request like /search and
+// hands its results to Config.Answer. The search is bounded by
+// RequestTimeout; the answer by the client and Config.Answer.
+func (s *Server) handleAnswer(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodPost:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	start := time.Now()
+	req, err := s.decodeSearchRequest(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	question := req.Query
+	switch {
+	case req.Query != "" && req.Keyword != "":
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("query and keyword are mutually exclusive"))
+		return
+	case req.Query == "" && req.Keyword == "":
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("query or keyword is required"))
+		return
+	case req.Keyword != "" && req.Near != nil:
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("near is not supported with keyword"))
+		return
+	case req.Stream != "":
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("stream is not supported by /answer"))
+		return
+	case req.Keyword != "":
+		question = req.Keyword
+	}
+	if req.TopK <= 0 {
+		req.TopK = s.cfg.AnswerTopK
+		if req.TopK <= 0 {
+			req.TopK = defaultAnswerTopK
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.RequestTimeout)
+	results, _, err := s.runSearch(ctx, "answer", req)
+	cancel()
+	if err != nil {
+		s.writeError(w, searchErrorStatus(err), err)
+		return
+	}
+
+	answer, err := s.cfg.Answer(r.Context(), question, results)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusGatewayTimeout
+		}
+		s.log.Warn("answer failed", "query", question, "err", err)
+		s.writeError(w, status, fmt.Errorf("answer: %w", err))
+		return
+	}
+	if results == nil {
+		results = []search.Result{}
+	}
+	if answer.Citations == nil {
+		answer.Citations = []string{}
+	}
+	s.writeJSON(w, http.StatusOK, answerResponse{
+		Query:     question,
+		Answer:    answer.Text,
+		Citations: answer.Citations,
+		Model:     answer.Model,
+		Results:   results,
+		TookMS:    float64(time.Since(start).Microseconds()) / 1000,
+	})
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"yashubustudio/csv-search/internal/cache"
+	"yashubustudio/csv-search/internal/search"
+)
+
+// searchCacheKey hashes everything that determines a search response: the
+// dataset, query, filters and ids (order-insensitive), topK and sparse
+// weight. req must already carry the server defaults (see withDefaults).
+func searchCacheKey(req searchRequest) string {
+	filters := make([]string, len(req.Filters))
+	for i, f := range req.Filters {
+		filters[i] = f.Label() + "\x00" + f.Value
+	}
+	sort.Strings(filters)
+	ids := append([]string(nil), req.IDs...)
+	sort.Strings(ids)
+
+	h := sha256.New()
+	for _, part := range []string{
+		req.Dataset,
+		req.Query,
+		req.Keyword,
+		strings.Join(filters, "\x01"),
+		strings.Join(ids, "\x01"),
+		strconv.Itoa(req.TopK),
+		strconv.FormatFloat(*req.SparseWeight, 'g', -1, 64),
+		req.TieBreak,
+		req.ScoreNormalization,
+		req.GroupBy,
+		strconv.Itoa(req.GroupSize),
+		strconv.FormatBool(req.IncludeVectors),
+		req.Near.String(),
+		req.Model,
+		req.Scorer,
+	} {
+		h.Write([]byte(part))
+		h.Write([]byte{0xff})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cachedResponse is a serialized search response.
+type cachedResponse struct {
+	body    []byte
+	etag    string
+	results []search.Result
+	// suggestion is sent in the didYouMeanHeader when not empty.
+	suggestion string
+}
+
+func newCachedResponse(results []search.Result, suggestion string) (*cachedResponse, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(results); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return &cachedResponse{
+		body:       buf.Bytes(),
+		etag:       `"` + hex.EncodeToString(sum[:16]) + `"`,
+		results:    results,
+		suggestion: suggestion,
+	}, nil
+}
+
+// writeCachedResponse sends resp, or 304 Not Modified when the client already
+// holds it. ttl is that of the cache resp was stored in.
+func (s *Server) writeCachedResponse(w http.ResponseWriter, r *http.Request, resp *cachedResponse, ttl time.Duration) {
+	w.Header().Set("ETag", resp.etag)
+	if resp.suggestion != "" {
+		w.Header().Set(didYouMeanHeader, resp.suggestion)
+	}
+	if ttl > 0 {
+		w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(math.Ceil(ttl.Seconds()))))
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	if etagMatches(r.Header.Get("If-None-Match"), resp.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(resp.body)
+}
+
+// responseCache returns the cache of the searches of dataset and the header
+// that bypasses it, if any. A version of a dataset shares its cache.
+func (s *Server) responseCache(dataset string) (*cache.LRU[*cachedResponse], string) {
+	table, _, _ := strings.Cut(dataset, "@")
+	settings, ok := s.Defaults().Caches[table]
+	if !ok {
+		return s.cache, ""
+	}
+	return s.datasetCaches.get(table, settings), strings.TrimSpace(settings.BypassHeader)
+}
+
+// datasetCaches are the response caches of individual datasets.
+type datasetCaches struct {
+	mu     sync.Mutex
+	caches map[string]*cache.LRU[*cachedResponse]
+}
+
+// get returns the cache of table, creating it with settings. The cache is
+// nil, caching nothing, when settings have no TTL.
+func (c *datasetCaches) get(table string, settings DatasetCache) *cache.LRU[*cachedResponse] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if lru, ok := c.caches[table]; ok {
+		return lru
+	}
+	if c.caches == nil {
+		c.caches = make(map[string]*cache.LRU[*cachedResponse])
+	}
+	lru := cache.New[*cachedResponse](settings.TTL, settings.Size)
+	c.caches[table] = lru
+	return lru
+}
+
+// drop discards the caches of tables, or of every dataset when none are
+// given; they are created anew with the settings then in force.
+func (c *datasetCaches) drop(tables ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(tables) == 0 {
+		c.caches = nil
+		return
+	}
+	for _, table := range tables {
+		delete(c.caches, table)
+	}
+}
+
+// purgeCaches drops every cached search response.
+func (s *Server) purgeCaches() {
+	s.cache.Purge()
+	s.datasetCaches.drop()
+}
+
+// PurgeDatasetCaches drops the cached responses of the datasets (tables)
+// with a cache of their own, or of all of them when none are given, e.g.
+// after records of the datasets were written.
+func (s *Server) PurgeDatasetCaches(tables ...string) {
+	s.datasetCaches.drop(tables...)
+}
+
+// etagMatches implements the weak comparison used by If-None-Match.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// DatasetInfo is one entry of the GET /datasets response.
+type DatasetInfo struct {
+	Name       string `json:"name"`
+	Table      string `json:"table"`
+	Default    bool   `json:"default"`
+	Configured bool   `json:"configured"`
+	Version    string `json:"version,omitempty"`
+	Rows       int64  `json:"rows"`
+	Vectors    int64  `json:"vectors"`
+	Sparse     int64  `json:"sparse"`
+	FTS        int64  `json:"fts"`
+	Geo        int64  `json:"geo"`
+	Dimension  int64  `json:"dimension"`
+	HasFTS     bool   `json:"has_fts"`
+	HasGeo     bool   `json:"has_geo"`
+	HasSparse  bool   `json:"has_sparse"`
+}
+
+func (s *Server) handleDatasets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.RequestTimeout)
+	defer cancel()
+
+	datasets, err := s.cfg.Datasets(ctx)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusGatewayTimeout
+		}
+		s.writeError(w, status, err)
+		return
+	}
+	datasets = tenantDatasets(r.Context(), datasets)
+	if datasets == nil {
+		datasets = []DatasetInfo{}
+	}
+	s.writeJSON(w, http.StatusOK, datasets)
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"yashubustudio/csv-search/internal/search"
+)
+
+// searchDebug is the diagnostics block that searches asking for debug get
+// with their results, so that slow queries can be looked into from the
+// client. Durations are in milliseconds; sort_ms is part of scan_ms.
+type searchDebug struct {
+	CandidatesScanned int     `json:"candidates_scanned"`
+	CandidatesMatched int     `json:"candidates_after_filters"`
+	DecodeMS          float64 `json:"decode_ms"`
+	EncodeMS          float64 `json:"encode_ms"`
+	ScanMS            float64 `json:"scan_ms"`
+	SortMS            float64 `json:"sort_ms"`
+	TotalMS           float64 `json:"total_ms"`
+	// CacheHit reports a response served from the response cache, which
+	// ran no search; CacheBypassed one whose request skipped the cache with
+	// the dataset's bypass header.
+	CacheHit      bool `json:"cache_hit"`
+	CacheBypassed bool `json:"cache_bypassed"`
+}
+
+func newSearchDebug(decode time.Duration, timings search.Timings, total time.Duration) *searchDebug {
+	return &searchDebug{
+		CandidatesScanned: timings.Scanned,
+		CandidatesMatched: timings.Matched,
+		DecodeMS:          milliseconds(decode),
+		EncodeMS:          milliseconds(timings.Encode),
+		ScanMS:            milliseconds(timings.Scan),
+		SortMS:            milliseconds(timings.Sort),
+		TotalMS:           milliseconds(total),
+	}
+}
+
+// writeDebugResponse sends results wrapped in an object with the debug
+// block. The response is not cacheable, since its timings change with every
+// request.
+func (s *Server) writeDebugResponse(w http.ResponseWriter, results []search.Result, suggestion string, debug *searchDebug) {
+	if results == nil {
+		results = []search.Result{}
+	}
+	if suggestion != "" {
+		w.Header().Set(didYouMeanHeader, suggestion)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	s.writeJSON(w, http.StatusOK, struct {
+		Results []search.Result `json:"results"`
+		Debug   *searchDebug    `json:"debug"`
+	}{results, debug})
+}
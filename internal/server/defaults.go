@@ -0,0 +1,134 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"yashubustudio/csv-search/internal/search"
+)
+
+// SearchDefaults are the settings applied to searches that leave them unset.
+type SearchDefaults struct {
+	TopK         int     `json:"topk,omitempty"`
+	SparseWeight float64 `json:"sparse_weight,omitempty"`
+	// Metric, MinScore, ScorePrecision and ScoreNormalization are passed to
+	// search.Options; a request's score_normalization replaces
+	// ScoreNormalization.
+	Metric             string  `json:"metric,omitempty"`
+	MinScore           float64 `json:"min_score,omitempty"`
+	ScorePrecision     int     `json:"score_precision,omitempty"`
+	ScoreNormalization string  `json:"score_normalization,omitempty"`
+	// StrictFilters rejects filters on fields the dataset does not have
+	// (see search.Engine.CheckFilterFields).
+	StrictFilters bool `json:"strict_filters,omitempty"`
+	// FieldBoosts are passed to search.Options; a dataset's boosts replace
+	// the global ones.
+	FieldBoosts map[string]float64 `json:"field_boosts,omitempty"`
+	// Stopwords and TermBoosts are the dictionaries of a dataset, passed to
+	// search.KeywordOptions and search.Options.
+	Stopwords  map[string]bool    `json:"-"`
+	TermBoosts map[string]float64 `json:"-"`
+	// Languages route the searches of a dataset by query language (see
+	// search.Language).
+	Languages map[string]search.Language `json:"languages,omitempty"`
+}
+
+// Defaults are applied to searches that leave the dataset, topK or sparse
+// weight unset. They start out as Config.Dataset, Config.DefaultTopK,
+// Config.SparseWeight, Config.Metric, Config.MinScore, Config.ScorePrecision,
+// Config.ScoreNormalization,
+// Config.StrictFilters, Config.FieldBoosts and Config.DatasetDefaults and can be replaced while serving with SetDefaults.
+type Defaults struct {
+	Dataset string
+	Search  SearchDefaults
+	// Datasets override Search for individual datasets; zero fields inherit.
+	Datasets map[string]SearchDefaults
+	// Caches give individual datasets a response cache of their own instead
+	// of the global one (Config.CacheTTL).
+	Caches map[string]DatasetCache
+}
+
+// DatasetCache configures the response cache of one dataset, which also
+// holds the responses of its versions. A zero TTL keeps the dataset out of
+// every cache.
+type DatasetCache struct {
+	TTL  time.Duration
+	Size int
+	// BypassHeader names a request header that, when present, skips the
+	// cached response; the fresh response replaces it.
+	BypassHeader string
+}
+
+func (d Defaults) normalized() Defaults {
+	d.Dataset = strings.TrimSpace(d.Dataset)
+	if d.Dataset == "" {
+		d.Dataset = "default"
+	}
+	if d.Search.TopK <= 0 {
+		d.Search.TopK = 10
+	}
+	return d
+}
+
+// forDataset returns the search settings of dataset.
+func (d Defaults) forDataset(dataset string) SearchDefaults {
+	settings := d.Search
+	override, ok := d.Datasets[dataset]
+	if !ok {
+		return settings
+	}
+	if override.TopK > 0 {
+		settings.TopK = override.TopK
+	}
+	if override.SparseWeight != 0 {
+		settings.SparseWeight = override.SparseWeight
+	}
+	if override.Metric != "" {
+		settings.Metric = override.Metric
+	}
+	if override.MinScore != 0 {
+		settings.MinScore = override.MinScore
+	}
+	if override.ScorePrecision != 0 {
+		settings.ScorePrecision = override.ScorePrecision
+	}
+	if override.ScoreNormalization != "" {
+		settings.ScoreNormalization = override.ScoreNormalization
+	}
+	if override.StrictFilters {
+		settings.StrictFilters = true
+	}
+	if len(override.FieldBoosts) > 0 {
+		settings.FieldBoosts = override.FieldBoosts
+	}
+	settings.Stopwords = override.Stopwords
+	settings.TermBoosts = override.TermBoosts
+	settings.Languages = override.Languages
+	return settings
+}
+
+// Defaults returns the search defaults in effect.
+func (s *Server) Defaults() Defaults {
+	s.defaultsMu.RLock()
+	defer s.defaultsMu.RUnlock()
+	return s.defaults
+}
+
+// SetDefaults replaces the search defaults without restarting the server.
+// Cached responses are dropped, since the configuration they were computed
+// under (including dataset to table mappings) may have changed as well.
+func (s *Server) SetDefaults(d Defaults) {
+	d = d.normalized()
+	s.defaultsMu.Lock()
+	changed := !reflect.DeepEqual(d, s.defaults)
+	s.defaults = d
+	s.defaultsMu.Unlock()
+	s.purgeCaches()
+	if changed {
+		s.log.Info("search defaults updated", "dataset", d.Dataset, "top_k", d.Search.TopK, "sparse_weight", d.Search.SparseWeight,
+			"metric", d.Search.Metric, "min_score", d.Search.MinScore,
+			"score_precision", d.Search.ScorePrecision, "score_normalization", d.Search.ScoreNormalization, "strict_filters", d.Search.StrictFilters,
+			"field_boosts", len(d.Search.FieldBoosts), "dataset_overrides", len(d.Datasets))
+	}
+}
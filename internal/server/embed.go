@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// maxEmbedTexts caps the number of texts encoded by one POST /embed request.
+const maxEmbedTexts = 256
+
+// EmbedRequest is the decoded POST /embed body.
+type EmbedRequest struct {
+	Texts  []string
+	Sparse bool
+}
+
+// Embedding is one entry of the POST /embed response.
+type Embedding struct {
+	Text      string            `json:"text"`
+	Model     string            `json:"model,omitempty"`
+	Dimension int               `json:"dimension"`
+	Vector    []float32         `json:"vector"`
+	Sparse    map[int32]float32 `json:"sparse,omitempty"`
+	Tokens    int               `json:"tokens,omitempty"`
+}
+
+func (s *Server) handleEmbed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var payload struct {
+		Text   string   `json:"text"`
+		Texts  []string `json:"texts"`
+		Sparse bool     `json:"sparse"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+		return
+	}
+	req := EmbedRequest{Texts: payload.Texts, Sparse: payload.Sparse}
+	if payload.Text != "" {
+		req.Texts = append([]string{payload.Text}, req.Texts...)
+	}
+	switch {
+	case len(req.Texts) == 0:
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("text or texts is required"))
+		return
+	case len(req.Texts) > maxEmbedTexts:
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("at most %d texts can be embedded per request", maxEmbedTexts))
+		return
+	}
+	for i, text := range req.Texts {
+		if strings.TrimSpace(text) == "" {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("text %d is empty", i+1))
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.RequestTimeout)
+	defer cancel()
+	embeddings, err := s.cfg.Embed(ctx, req)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusGatewayTimeout
+		}
+		s.writeError(w, status, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, embeddings)
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// FeedbackRequest is the decoded POST /feedback body: the result a user
+// selected for a query.
+type FeedbackRequest struct {
+	Query   string
+	Dataset string
+	ID      string
+	// Position is the 1-based rank of ID among the results shown, or zero
+	// when unknown.
+	Position int
+	// Shown are the ids of the results shown with ID, best first.
+	Shown []string
+}
+
+func (s *Server) handleFeedback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var payload struct {
+		Query    string   `json:"query"`
+		Dataset  string   `json:"dataset"`
+		ID       string   `json:"id"`
+		Position int      `json:"position"`
+		Results  []string `json:"results"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+		return
+	}
+	req := FeedbackRequest{
+		Query:    strings.TrimSpace(payload.Query),
+		Dataset:  strings.TrimSpace(payload.Dataset),
+		ID:       strings.TrimSpace(payload.ID),
+		Position: payload.Position,
+		Shown:    payload.Results,
+	}
+	switch {
+	case req.Query == "":
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("query is required"))
+		return
+	case req.ID == "":
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("id is required"))
+		return
+	case req.Position < 0:
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("position must not be negative"))
+		return
+	}
+	if tenant := tenantFrom(r.Context()); tenant != nil {
+		dataset, err := tenant.dataset(req.Dataset)
+		if err != nil {
+			s.writeError(w, http.StatusForbidden, err)
+			return
+		}
+		req.Dataset = dataset
+	}
+	if req.Dataset == "" {
+		req.Dataset = s.Defaults().Dataset
+	}
+	if err := s.cfg.Feedback(r.Context(), req); err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// inflightLimiter bounds the number of requests executing at once. Requests
+// over the limit wait in a bounded queue for a free slot; once the queue is
+// full they are rejected with 503.
+type inflightLimiter struct {
+	slots    chan struct{}
+	maxQueue int64
+	queued   atomic.Int64
+}
+
+func newInflightLimiter(maxInFlight, maxQueue int) *inflightLimiter {
+	if maxInFlight <= 0 {
+		return nil
+	}
+	if maxQueue < 0 {
+		maxQueue = 0
+	}
+	return &inflightLimiter{slots: make(chan struct{}, maxInFlight), maxQueue: int64(maxQueue)}
+}
+
+// acquire takes a slot, queueing for at most wait. It reports false when the
+// queue is full or no slot frees up in time.
+func (l *inflightLimiter) acquire(ctx context.Context, wait time.Duration) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if l.queued.Add(1) > l.maxQueue {
+		l.queued.Add(-1)
+		return false
+	}
+	defer l.queued.Add(-1)
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (l *inflightLimiter) release() {
+	<-l.slots
+}
+
+// requestTracker counts running requests and background work so that
+// shutdown can wait for them to finish.
+type requestTracker struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{}
+}
+
+func (t *requestTracker) begin() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.n == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.n++
+}
+
+func (t *requestTracker) end() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.n--
+	if t.n == 0 {
+		close(t.idle)
+	}
+}
+
+func (t *requestTracker) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.n
+}
+
+// wait blocks until nothing is running or ctx ends.
+func (t *requestTracker) wait(ctx context.Context) error {
+	t.mu.Lock()
+	if t.n == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	idle := t.idle
+	t.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// limitInFlight tracks every request for graceful draining and, when
+// Config.MaxInFlight is set, applies the concurrency limit. Health checks,
+// metrics, the OpenAPI document and long-lived WebSockets do not take a slot.
+func (s *Server) limitInFlight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.active.begin()
+		defer s.active.end()
+
+		if s.inflight != nil {
+			switch r.URL.Path {
+			case "/healthz", "/version", "/openapi.json", "/metrics", "/ws":
+			default:
+				if !s.inflight.acquire(r.Context(), s.cfg.RequestTimeout) {
+					w.Header().Set("Retry-After", "1")
+					s.writeError(w, http.StatusServiceUnavailable, fmt.Errorf("server is at capacity, retry later"))
+					return
+				}
+				defer s.inflight.release()
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
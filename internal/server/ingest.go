@@ -0,0 +1,291 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"yashubustudio/csv-search/internal/ingest"
+)
+
+// IngestRequest describes a CSV upload accepted by POST /ingest. The column
+// mapping is sent as the "mapping" multipart field; empty values fall back to
+// the dataset configuration.
+type IngestRequest struct {
+	Dataset         string   `json:"dataset,omitempty"`
+	Table           string   `json:"table,omitempty"`
+	IDColumn        string   `json:"id_column,omitempty"`
+	TextColumns     []string `json:"text_columns,omitempty"`
+	MetadataColumns []string `json:"meta_columns,omitempty"`
+	LatColumn       string   `json:"lat_column,omitempty"`
+	LngColumn       string   `json:"lng_column,omitempty"`
+	BatchSize       int      `json:"batch_size,omitempty"`
+	Sparse          bool     `json:"sparse,omitempty"`
+	// Duplicates is the policy for IDs repeated within the file: "last"
+	// (the default), "first" or "error".
+	Duplicates string `json:"duplicates,omitempty"`
+
+	// CSVPath is the uploaded file stored by the server.
+	CSVPath string `json:"-"`
+}
+
+// IngestResult reports the outcome of a finished ingest job.
+type IngestResult struct {
+	Dataset  string `json:"dataset"`
+	Table    string `json:"table"`
+	Upserted int    `json:"upserted"`
+	Skipped  int    `json:"skipped"`
+	// Dropped counts rows rejected by the application's ingest hooks.
+	Dropped int `json:"dropped,omitempty"`
+	// Duplicates counts rows whose ID appeared earlier in the file.
+	Duplicates int `json:"duplicates,omitempty"`
+}
+
+// Ingest job states.
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+)
+
+// maxIngestJobs bounds how many finished jobs are remembered.
+const maxIngestJobs = 100
+
+// defaultMaxUploadBytes caps CSV uploads when Config.MaxUploadBytes is unset.
+const defaultMaxUploadBytes = 256 << 20
+
+type ingestJob struct {
+	ID         string        `json:"id"`
+	Status     string        `json:"status"`
+	Filename   string        `json:"filename,omitempty"`
+	Request    IngestRequest `json:"request"`
+	Result     *IngestResult `json:"result,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	CreatedAt  time.Time     `json:"created_at"`
+	StartedAt  *time.Time    `json:"started_at,omitempty"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+}
+
+// ingestJobs keeps the status of asynchronous ingest jobs in memory and runs
+// them one at a time.
+type ingestJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*ingestJob
+	run  sync.Mutex
+}
+
+func newIngestJobs() *ingestJobs {
+	return &ingestJobs{jobs: make(map[string]*ingestJob)}
+}
+
+func (j *ingestJobs) add(job *ingestJob) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jobs[job.ID] = job
+	if len(j.jobs) <= maxIngestJobs {
+		return
+	}
+	// Forget the oldest finished jobs.
+	finished := make([]*ingestJob, 0, len(j.jobs))
+	for _, existing := range j.jobs {
+		if existing.FinishedAt != nil {
+			finished = append(finished, existing)
+		}
+	}
+	sort.Slice(finished, func(a, b int) bool { return finished[a].CreatedAt.Before(finished[b].CreatedAt) })
+	for _, old := range finished {
+		if len(j.jobs) <= maxIngestJobs {
+			break
+		}
+		delete(j.jobs, old.ID)
+	}
+}
+
+// get returns a copy of the job so that callers can encode it without racing
+// the worker.
+func (j *ingestJobs) get(id string) (ingestJob, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	if !ok {
+		return ingestJob{}, false
+	}
+	return *job, true
+}
+
+func (j *ingestJobs) update(id string, fn func(job *ingestJob)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if job, ok := j.jobs[id]; ok {
+		fn(job)
+	}
+}
+
+func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+
+	limit := s.cfg.MaxUploadBytes
+	if limit <= 0 {
+		limit = defaultMaxUploadBytes
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		s.writeError(w, status, fmt.Errorf("parse upload: %w", err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	var req IngestRequest
+	if raw := strings.TrimSpace(r.FormValue("mapping")); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &req); err != nil {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("decode mapping: %w", err))
+			return
+		}
+	}
+	if dataset := strings.TrimSpace(r.FormValue("dataset")); dataset != "" {
+		req.Dataset = dataset
+	}
+	req.Dataset = strings.TrimSpace(req.Dataset)
+	req.Table = strings.TrimSpace(req.Table)
+	req.IDColumn = strings.TrimSpace(req.IDColumn)
+	req.LatColumn = strings.TrimSpace(req.LatColumn)
+	req.LngColumn = strings.TrimSpace(req.LngColumn)
+	req.Duplicates = strings.TrimSpace(req.Duplicates)
+	if err := ingest.ValidateDuplicates(req.Duplicates); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("decode mapping: %w", err))
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("a CSV file is required in the \"file\" field"))
+		return
+	}
+	defer file.Close()
+
+	path, err := saveUpload(file)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, fmt.Errorf("store upload: %w", err))
+		return
+	}
+	req.CSVPath = path
+
+	job := &ingestJob{
+		ID:        newJobID(),
+		Status:    jobQueued,
+		Filename:  header.Filename,
+		Request:   req,
+		CreatedAt: time.Now().UTC(),
+	}
+	s.ingestJobs.add(job)
+	s.active.begin()
+	go func() {
+		defer s.active.end()
+		s.runIngestJob(job.ID, req)
+	}()
+
+	w.Header().Set("Location", "/ingest/"+job.ID)
+	snapshot, _ := s.ingestJobs.get(job.ID)
+	s.writeJSON(w, http.StatusAccepted, snapshot)
+}
+
+func (s *Server) handleIngestStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/ingest/"), "/")
+	job, ok := s.ingestJobs.get(id)
+	if !ok {
+		s.writeError(w, http.StatusNotFound, fmt.Errorf("ingest job %q not found", id))
+		return
+	}
+	s.writeJSON(w, http.StatusOK, job)
+}
+
+func (s *Server) runIngestJob(id string, req IngestRequest) {
+	defer os.Remove(req.CSVPath)
+
+	// Jobs run one at a time; SQLite only allows a single writer anyway.
+	s.ingestJobs.run.Lock()
+	defer s.ingestJobs.run.Unlock()
+
+	started := time.Now().UTC()
+	s.ingestJobs.update(id, func(job *ingestJob) {
+		job.Status = jobRunning
+		job.StartedAt = &started
+	})
+
+	result, err := s.cfg.Ingest(s.baseCtx, req)
+	// The caches of individual datasets are dropped by whoever writes them
+	// (PurgeDatasetCaches), which knows the table ingested into.
+	if err == nil {
+		s.cache.Purge()
+	}
+
+	finished := time.Now().UTC()
+	s.ingestJobs.update(id, func(job *ingestJob) {
+		job.FinishedAt = &finished
+		if err != nil {
+			job.Status = jobFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = jobSucceeded
+		job.Result = &result
+	})
+	if err != nil {
+		s.log.Error("ingest job failed", "job", id, "err", err)
+		return
+	}
+	s.log.Info("ingest job finished", "job", id, "dataset", result.Table, "upserted", result.Upserted, "skipped", result.Skipped)
+}
+
+func saveUpload(src io.Reader) (string, error) {
+	file, err := os.CreateTemp("", "csv-search-upload-*.csv")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(file, src); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+func newJobID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b[:])
+}
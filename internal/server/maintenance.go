@@ -0,0 +1,255 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Maintenance backs the /admin maintenance endpoints. The operations can take
+// minutes on large databases, so they are not bound by RequestTimeout.
+type Maintenance interface {
+	// Reindex rebuilds the derived indexes selected by req.
+	Reindex(ctx context.Context, req ReindexRequest) (ReindexResult, error)
+	// Reembed recomputes embeddings and returns the number of records.
+	Reembed(ctx context.Context, req ReembedRequest) (int, error)
+	// Compact vacuums the database and returns its size before and after.
+	Compact(ctx context.Context) (before, after int64, err error)
+	// Backup writes a snapshot to path (a default location when empty) and
+	// returns the path and size written.
+	Backup(ctx context.Context, path string) (string, int64, error)
+	// Settings describes the effective service configuration for
+	// GET /admin/config. It must not contain secrets.
+	Settings() any
+}
+
+// ReindexRequest is the optional body of POST /admin/reindex; leaving every
+// field false selects all of them.
+type ReindexRequest struct {
+	FTS     bool `json:"fts,omitempty"`
+	RTree   bool `json:"rtree,omitempty"`
+	Pages   bool `json:"pages,omitempty"`
+	Vectors bool `json:"vectors,omitempty"`
+}
+
+// ReindexResult is the outcome of Maintenance.Reindex. Vectors holds the
+// embedding checks when they ran.
+type ReindexResult struct {
+	RTreeRows  int64 `json:"rtree_rows"`
+	FTSRemoved int64 `json:"fts_removed"`
+	FTSAdded   int64 `json:"fts_added"`
+	// VectorPages counts the vector pages rebuilt.
+	VectorPages int64 `json:"vector_pages"`
+	// TrigramRows counts the records written to the trigram indexes.
+	TrigramRows int64 `json:"trigram_rows"`
+	Vectors     any   `json:"vectors,omitempty"`
+}
+
+// ReembedRequest is the body of POST /admin/re-embed.
+type ReembedRequest struct {
+	Dataset   string `json:"dataset,omitempty"`
+	BatchSize int    `json:"batch_size,omitempty"`
+	Sparse    bool   `json:"sparse,omitempty"`
+	// StaleOnly skips records already embedded by the active model.
+	StaleOnly bool `json:"stale_only,omitempty"`
+}
+
+func (s *Server) handleReindex(w http.ResponseWriter, r *http.Request) {
+	if !s.adminPost(w, r) {
+		return
+	}
+	var req ReindexRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+			return
+		}
+	}
+
+	start := time.Now()
+	result, err := s.cfg.Maintenance.Reindex(r.Context(), req)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.purgeCaches()
+	s.log.Info("reindex finished", "fts_removed", result.FTSRemoved, "fts_added", result.FTSAdded, "duration", time.Since(start).Round(time.Millisecond))
+	resp := map[string]any{
+		"status":       "reindexed",
+		"rtree_rows":   result.RTreeRows,
+		"fts_removed":  result.FTSRemoved,
+		"fts_added":    result.FTSAdded,
+		"vector_pages": result.VectorPages,
+		"trigram_rows": result.TrigramRows,
+		"duration_sec": time.Since(start).Seconds(),
+	}
+	if result.Vectors != nil {
+		resp["vectors"] = result.Vectors
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleReembed(w http.ResponseWriter, r *http.Request) {
+	if !s.adminPost(w, r) {
+		return
+	}
+	var req ReembedRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+			return
+		}
+	}
+	req.Dataset = strings.TrimSpace(req.Dataset)
+
+	start := time.Now()
+	n, err := s.cfg.Maintenance.Reembed(r.Context(), req)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.purgeCaches()
+	s.log.Info("re-embed finished", "records", n, "duration", time.Since(start).Round(time.Millisecond))
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"status":       "re-embedded",
+		"dataset":      req.Dataset,
+		"records":      n,
+		"duration_sec": time.Since(start).Seconds(),
+	})
+}
+
+func (s *Server) handleCompact(w http.ResponseWriter, r *http.Request) {
+	if !s.adminPost(w, r) {
+		return
+	}
+	before, after, err := s.cfg.Maintenance.Compact(r.Context())
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"status":       "compacted",
+		"bytes_before": before,
+		"bytes_after":  after,
+	})
+}
+
+// handleBackup writes a snapshot on the server. With ?download=1 the snapshot
+// is streamed back to the client instead and removed afterwards.
+func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	if !s.adminPost(w, r) {
+		return
+	}
+	var req struct {
+		Path string `json:"path"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+			return
+		}
+	}
+
+	download, _ := strconv.ParseBool(r.URL.Query().Get("download"))
+	if !download {
+		path, size, err := s.cfg.Maintenance.Backup(r.Context(), strings.TrimSpace(req.Path))
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		s.log.Info("backup written", "path", path, "bytes", size)
+		s.writeJSON(w, http.StatusOK, map[string]any{
+			"status": "backed-up",
+			"path":   path,
+			"bytes":  size,
+		})
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "csv-search-backup-*")
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	path, size, err := s.cfg.Maintenance.Backup(r.Context(), filepath.Join(dir, "backup.db"))
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer file.Close()
+
+	name := fmt.Sprintf("csv-search-%s.db", time.Now().UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, file); err != nil {
+		s.log.Warn("backup download interrupted", "err", err)
+	}
+}
+
+func (s *Server) handleAdminConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"server":  s.settings(),
+		"service": s.cfg.Maintenance.Settings(),
+	})
+}
+
+// settings lists the effective server configuration without secrets.
+func (s *Server) settings() map[string]any {
+	defaults := s.Defaults()
+	return map[string]any{
+		"addr":                 s.cfg.Addr,
+		"dataset":              defaults.Dataset,
+		"default_topk":         defaults.Search.TopK,
+		"sparse_weight":        defaults.Search.SparseWeight,
+		"metric":               defaults.Search.Metric,
+		"min_score":            defaults.Search.MinScore,
+		"score_precision":      defaults.Search.ScorePrecision,
+		"score_normalization":  defaults.Search.ScoreNormalization,
+		"strict_filters":       defaults.Search.StrictFilters,
+		"field_boosts":         defaults.Search.FieldBoosts,
+		"dataset_overrides":    defaults.Datasets,
+		"request_timeout_sec":  s.cfg.RequestTimeout.Seconds(),
+		"shutdown_timeout_sec": s.cfg.ShutdownTimeout.Seconds(),
+		"admin_token_set":      s.cfg.AdminToken != "",
+		"tls":                  s.certs != nil,
+		"max_upload_bytes":     s.cfg.MaxUploadBytes,
+		"rate_limit": map[string]any{
+			"rate":         s.cfg.RateLimit.Rate,
+			"burst":        s.cfg.RateLimit.Burst,
+			"client_rate":  s.cfg.RateLimit.ClientRate,
+			"client_burst": s.cfg.RateLimit.ClientBurst,
+		},
+	}
+}
+
+// adminPost checks the method and admin authorization of a maintenance
+// request, writing the error response itself.
+func (s *Server) adminPost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return s.authorizeAdmin(w, r)
+}
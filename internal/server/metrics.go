@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"yashubustudio/csv-search/internal/metrics"
+	"yashubustudio/csv-search/internal/search"
+)
+
+// serverMetrics are the HTTP-level instruments registered on Config.Metrics.
+type serverMetrics struct {
+	requests *metrics.Counter
+	duration *metrics.Histogram
+	stages   *metrics.Histogram
+	results  *metrics.Histogram
+}
+
+func newServerMetrics(reg *metrics.Registry) *serverMetrics {
+	if reg == nil {
+		return nil
+	}
+	return &serverMetrics{
+		requests: reg.Counter("csvsearch_http_requests_total", "HTTP requests served, by route, method and status code.", "route", "method", "code"),
+		duration: reg.Histogram("csvsearch_http_request_duration_seconds", "HTTP request latency by route.", nil, "route"),
+		stages:   reg.Histogram("csvsearch_search_stage_duration_seconds", "Search latency by stage: decode, encode, scan and total.", nil, "stage"),
+		results:  reg.Histogram("csvsearch_search_results", "Number of results returned per search.", []float64{0, 1, 5, 10, 25, 50, 100}),
+	}
+}
+
+// observeSearch records the per-stage latency of a successful search.
+func (m *serverMetrics) observeSearch(decode time.Duration, timings search.Timings, total time.Duration, results int) {
+	if m == nil {
+		return
+	}
+	m.stages.Observe(decode.Seconds(), "decode")
+	m.stages.Observe(timings.Encode.Seconds(), "encode")
+	m.stages.Observe(timings.Scan.Seconds(), "scan")
+	m.stages.Observe(total.Seconds(), "total")
+	m.results.Observe(float64(results))
+}
+
+// instrument counts requests to route and measures their latency.
+func (s *Server) instrument(route string, next http.HandlerFunc) http.HandlerFunc {
+	if s.metrics == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+		s.metrics.requests.Inc(route, r.Method, strconv.Itoa(rec.status))
+		s.metrics.duration.Observe(time.Since(start).Seconds(), route)
+	}
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := s.cfg.Metrics.WriteText(w); err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer (for
+// flushing and deadlines).
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
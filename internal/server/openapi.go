@@ -0,0 +1,827 @@
+package server
+
+import (
+	"net/http"
+)
+
+// openAPIVersion is the version of the HTTP API described by /openapi.json.
+const openAPIVersion = "1.0.0"
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, s.openAPISpec())
+}
+
+// openAPISpec builds the OpenAPI 3 document for the endpoints registered by
+// Handler. Optional endpoints are only listed when they are enabled.
+func (s *Server) openAPISpec() map[string]any {
+	searchOp := func(summary string) map[string]any {
+		return map[string]any{
+			"summary":    summary,
+			"parameters": searchParameters(),
+			"responses":  searchResponses(),
+		}
+	}
+	searchPostOp := func(summary string) map[string]any {
+		return map[string]any{
+			"summary": summary,
+			"requestBody": map[string]any{
+				"required": true,
+				"content":  jsonContent(ref("SearchRequest")),
+			},
+			"responses": searchResponses(),
+		}
+	}
+
+	paths := map[string]any{
+		"/search": map[string]any{
+			"get":  searchOp("Search records with query parameters"),
+			"post": searchPostOp("Search records with a JSON body"),
+		},
+		"/query": map[string]any{
+			"get":  searchOp("Alias of GET /search"),
+			"post": searchPostOp("Alias of POST /search"),
+		},
+		"/suggest": map[string]any{
+			"get": map[string]any{
+				"summary":     "Complete the last word of a query from the indexed terms of a dataset",
+				"description": "Terms are drawn from the full-text index (lower case, split on spaces and punctuation) and ordered by the number of records containing them.",
+				"parameters": []any{
+					map[string]any{"name": "q", "in": "query", "required": true, "description": "Text typed so far; its last word is completed", "schema": map[string]any{"type": "string"}},
+					map[string]any{"name": "dataset", "in": "query", "description": "Dataset to draw terms from (defaults to the server dataset)", "schema": map[string]any{"type": "string"}},
+					map[string]any{"name": "limit", "in": "query", "description": "Maximum number of suggestions (default 10)", "schema": map[string]any{"type": "integer", "minimum": 1, "maximum": maxCompletions}},
+				},
+				"responses": map[string]any{
+					"200": map[string]any{
+						"description": "Completions, most frequent first",
+						"content":     jsonContent(ref("SuggestResponse")),
+					},
+					"400": errorResponse("Missing q or invalid limit"),
+				},
+			},
+		},
+		"/healthz": map[string]any{
+			"get": map[string]any{
+				"summary": "Health check",
+				"responses": map[string]any{
+					"200": map[string]any{
+						"description": "The server is up",
+						"content": map[string]any{
+							"text/plain": map[string]any{"schema": map[string]any{"type": "string", "example": "ok"}},
+						},
+					},
+				},
+			},
+		},
+		"/ws": map[string]any{
+			"get": map[string]any{
+				"summary":     "Interactive search over a WebSocket",
+				"description": `Send {"id","query","dataset","topk","filters","sparse_weight","tie_break"} messages; each is answered with "result" messages in rank order and a final "done". A new query supersedes the running one and {"type":"cancel"} stops it.`,
+				"responses": map[string]any{
+					"101": map[string]any{"description": "Switching to the WebSocket protocol"},
+					"400": map[string]any{"description": "Not a WebSocket handshake"},
+				},
+			},
+		},
+		"/openapi.json": map[string]any{
+			"get": map[string]any{
+				"summary": "This OpenAPI document",
+				"responses": map[string]any{
+					"200": map[string]any{
+						"description": "OpenAPI 3 document",
+						"content":     jsonContent(map[string]any{"type": "object"}),
+					},
+				},
+			},
+		},
+	}
+	if !s.cfg.DisableUI {
+		paths["/"] = map[string]any{
+			"get": map[string]any{
+				"summary": "Embedded search page",
+				"responses": map[string]any{
+					"200": map[string]any{
+						"description": "HTML page",
+						"content": map[string]any{
+							"text/html": map[string]any{"schema": map[string]any{"type": "string"}},
+						},
+					},
+				},
+			},
+		}
+	}
+	if s.cfg.Datasets != nil {
+		paths["/datasets"] = map[string]any{
+			"get": map[string]any{
+				"summary": "List datasets with their tables and row counts",
+				"responses": map[string]any{
+					"200": map[string]any{
+						"description": "Datasets ordered by name",
+						"content": jsonContent(map[string]any{
+							"type":  "array",
+							"items": ref("Dataset"),
+						}),
+					},
+					"500": errorResponse("The database could not be read"),
+				},
+			},
+		}
+	}
+	if s.cfg.Embed != nil {
+		paths["/embed"] = map[string]any{
+			"post": map[string]any{
+				"summary": "Return the raw embedding vectors of texts",
+				"requestBody": map[string]any{
+					"required": true,
+					"content":  jsonContent(ref("EmbedRequest")),
+				},
+				"responses": map[string]any{
+					"200": map[string]any{
+						"description": "One embedding per text, in request order",
+						"content": jsonContent(map[string]any{
+							"type":  "array",
+							"items": ref("Embedding"),
+						}),
+					},
+					"400": errorResponse("Missing, empty or too many texts"),
+					"500": errorResponse("Encoding failed"),
+				},
+			},
+		}
+	}
+	if s.cfg.Answer != nil {
+		answerResponses := map[string]any{
+			"200": map[string]any{
+				"description": "The answer with the ids of the cited results and the results it was given",
+				"content":     jsonContent(ref("Answer")),
+			},
+			"400": errorResponse("Invalid request, a missing query, or a filter on an unknown field when strict_filters is enabled"),
+			"405": map[string]any{"description": "Method not allowed"},
+			"429": errorResponse("Rate limit exceeded; see the Retry-After header"),
+			"500": errorResponse("Search failed"),
+			"502": errorResponse("The language model failed"),
+			"503": errorResponse("The encoder is unavailable or the server is at capacity"),
+			"504": errorResponse("The search or the language model timed out"),
+		}
+		paths["/answer"] = map[string]any{
+			"get": map[string]any{
+				"summary":    "Answer a query from its top search results with a language model",
+				"parameters": searchParameters(),
+				"responses":  answerResponses,
+			},
+			"post": map[string]any{
+				"summary": "Answer a query from its top search results with a language model",
+				"requestBody": map[string]any{
+					"required": true,
+					"content":  jsonContent(ref("SearchRequest")),
+				},
+				"responses": answerResponses,
+			},
+		}
+	}
+	if s.cfg.Feedback != nil {
+		paths["/feedback"] = map[string]any{
+			"post": map[string]any{
+				"summary": "Record the result a user selected for a query",
+				"requestBody": map[string]any{
+					"required": true,
+					"content":  jsonContent(ref("FeedbackRequest")),
+				},
+				"responses": map[string]any{
+					"204": map[string]any{"description": "The feedback was recorded"},
+					"400": errorResponse("Malformed request, or a missing query or id"),
+					"500": errorResponse("The feedback could not be stored"),
+				},
+			},
+		}
+	}
+	if s.cfg.Version != nil {
+		paths["/version"] = map[string]any{
+			"get": map[string]any{
+				"summary": "Build metadata and the ONNX Runtime version",
+				"responses": map[string]any{
+					"200": map[string]any{
+						"description": "Version information",
+						"content":     jsonContent(ref("Version")),
+					},
+				},
+			},
+		}
+	}
+	if s.cfg.Metrics != nil {
+		paths["/metrics"] = map[string]any{
+			"get": map[string]any{
+				"summary": "Prometheus metrics",
+				"responses": map[string]any{
+					"200": map[string]any{
+						"description": "Metrics in the Prometheus text exposition format",
+						"content": map[string]any{
+							"text/plain": map[string]any{"schema": map[string]any{"type": "string"}},
+						},
+					},
+				},
+			},
+		}
+	}
+	if s.cfg.Ingest != nil {
+		paths["/ingest"] = map[string]any{
+			"post": map[string]any{
+				"summary":  "Upload a CSV file and ingest it asynchronously",
+				"security": adminSecurity(),
+				"requestBody": map[string]any{
+					"required": true,
+					"content": map[string]any{
+						"multipart/form-data": map[string]any{
+							"schema": map[string]any{
+								"type":     "object",
+								"required": []string{"file"},
+								"properties": map[string]any{
+									"file":    map[string]any{"type": "string", "format": "binary"},
+									"mapping": map[string]any{"type": "string", "description": "IngestMapping as JSON"},
+									"dataset": map[string]any{"type": "string"},
+								},
+							},
+							"encoding": map[string]any{"mapping": map[string]any{"contentType": "application/json"}},
+						},
+					},
+				},
+				"responses": map[string]any{
+					"202": map[string]any{
+						"description": "The job was queued; poll the Location header",
+						"content":     jsonContent(ref("IngestJob")),
+					},
+					"400": errorResponse("Missing file or malformed mapping"),
+					"401": errorResponse("Missing or invalid admin token"),
+					"403": errorResponse("Admin endpoints are restricted to localhost"),
+					"413": errorResponse("The upload exceeds the size limit"),
+				},
+			},
+		}
+		paths["/ingest/{job}"] = map[string]any{
+			"get": map[string]any{
+				"summary":  "Status of an ingest job",
+				"security": adminSecurity(),
+				"parameters": []any{map[string]any{
+					"name": "job", "in": "path", "required": true,
+					"schema": map[string]any{"type": "string"},
+				}},
+				"responses": map[string]any{
+					"200": map[string]any{
+						"description": "Current job state",
+						"content":     jsonContent(ref("IngestJob")),
+					},
+					"404": errorResponse("Unknown job"),
+				},
+			},
+		}
+	}
+	if s.cfg.Schedules != nil {
+		paths["/admin/schedules"] = map[string]any{
+			"get": map[string]any{
+				"summary":  "State of the scheduled re-ingestion of datasets",
+				"security": adminSecurity(),
+				"responses": map[string]any{
+					"200": map[string]any{
+						"description": "Every dataset with a schedule, its next run and the outcome of its last run",
+						"content":     jsonContent(ref("Schedules")),
+					},
+					"401": errorResponse("Missing or invalid admin token"),
+					"403": errorResponse("Admin endpoints are restricted to localhost"),
+				},
+			},
+		}
+	}
+	if s.cfg.Replica != nil {
+		paths["/admin/replica"] = map[string]any{
+			"get": map[string]any{
+				"summary":  "State of the read replica's synchronization",
+				"security": adminSecurity(),
+				"responses": map[string]any{
+					"200": map[string]any{
+						"description": "The snapshot source, the version in use and the outcome of the last check",
+						"content":     jsonContent(ref("Replica")),
+					},
+					"401": errorResponse("Missing or invalid admin token"),
+					"403": errorResponse("Admin endpoints are restricted to localhost"),
+				},
+			},
+		}
+	}
+	if s.cfg.ReloadModel != nil {
+		paths["/admin/reload-model"] = map[string]any{
+			"post": map[string]any{
+				"summary":  "Swap the encoder model without restarting",
+				"security": adminSecurity(),
+				"requestBody": map[string]any{
+					"required": false,
+					"content":  jsonContent(ref("ReloadRequest")),
+				},
+				"responses": map[string]any{
+					"200": map[string]any{
+						"description": "The new encoder is active",
+						"content":     jsonContent(ref("ReloadResponse")),
+					},
+					"400": errorResponse("Malformed request"),
+					"401": errorResponse("Missing or invalid admin token"),
+					"403": errorResponse("Admin endpoints are restricted to localhost"),
+					"500": errorResponse("The model could not be loaded"),
+				},
+			},
+		}
+	}
+
+	if s.cfg.Maintenance != nil {
+		adminOp := func(method, summary string, body map[string]any, ok map[string]any) map[string]any {
+			op := map[string]any{
+				"summary":  summary,
+				"security": adminSecurity(),
+				"responses": map[string]any{
+					"200": ok,
+					"401": errorResponse("Missing or invalid admin token"),
+					"403": errorResponse("Admin endpoints are restricted to localhost"),
+					"500": errorResponse("The operation failed"),
+				},
+			}
+			if body != nil {
+				op["requestBody"] = map[string]any{"required": false, "content": jsonContent(body)}
+			}
+			return map[string]any{method: op}
+		}
+		object := func(description string) map[string]any {
+			return map[string]any{"description": description, "content": jsonContent(map[string]any{"type": "object"})}
+		}
+		str := map[string]any{"type": "string"}
+		paths["/admin/reindex"] = adminOp("post", "Rebuild the R-tree and full-text index from records and check the stored vectors", map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"fts":     map[string]any{"type": "boolean"},
+				"rtree":   map[string]any{"type": "boolean"},
+				"pages":   map[string]any{"type": "boolean", "description": "Rebuild the paged copy of the embeddings"},
+				"vectors": map[string]any{"type": "boolean"},
+			},
+		}, object("Entries rebuilt and per-dataset vector checks"))
+		paths["/admin/re-embed"] = adminOp("post", "Recompute stored embeddings with the active encoder", map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"dataset":    str,
+				"batch_size": map[string]any{"type": "integer"},
+				"sparse":     map[string]any{"type": "boolean"},
+				"stale_only": map[string]any{"type": "boolean", "description": "Skip records already embedded by the active model"},
+			},
+		}, object("Number of records re-embedded"))
+		paths["/admin/compact"] = adminOp("post", "Checkpoint the WAL and vacuum the database", nil, object("Database size before and after"))
+		backup := adminOp("post", "Write a database snapshot (or download it with download=true)", map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"path": str},
+		}, map[string]any{
+			"description": "Backup location and size, or the snapshot itself when downloading",
+			"content": map[string]any{
+				"application/json":        map[string]any{"schema": map[string]any{"type": "object"}},
+				"application/vnd.sqlite3": map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}},
+			},
+		})
+		backup["post"].(map[string]any)["parameters"] = []any{map[string]any{
+			"name": "download", "in": "query",
+			"schema": map[string]any{"type": "boolean"},
+		}}
+		paths["/admin/backup"] = backup
+		paths["/admin/config"] = adminOp("get", "Effective server and service configuration (secrets omitted)", nil, object("Configuration"))
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "csv-search API",
+			"description": "Semantic search over CSV datasets stored in SQLite.",
+			"version":     openAPIVersion,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": openAPISchemas(),
+			"securitySchemes": map[string]any{
+				"adminToken": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "Required by /admin endpoints when the server is started with --admin-token.",
+				},
+				"tenantKey": map[string]any{
+					"type":        "apiKey",
+					"in":          "header",
+					"name":        "X-API-Key",
+					"description": "Identifies the tenant of API requests when the configuration defines tenants; a bearer token is accepted as well.",
+				},
+			},
+		},
+	}
+}
+
+func searchParameters() []any {
+	query := func(name, description string, schema map[string]any) map[string]any {
+		return map[string]any{
+			"name":        name,
+			"in":          "query",
+			"description": description,
+			"schema":      schema,
+		}
+	}
+	str := map[string]any{"type": "string"}
+	integer := map[string]any{"type": "integer", "minimum": 1}
+	tieBreak := tieBreakSchema()
+	return []any{
+		query("q", "Search query text", str),
+		query("query", "Alias of q", str),
+		query("keyword", "Full-text search terms, used instead of q; needs no encoder. Without q or keyword the records matching filter are returned", str),
+		query("dataset", "Dataset to search (defaults to the server dataset)", str),
+		query("table", "Alias of dataset", str),
+		query("version", "Named version of the dataset to search instead of its live contents (404 when unknown)", str),
+		query("model", "Registered embedding model to encode q with instead of the server's (400 when unknown, 409 when the dataset's embeddings come from another model)", str),
+		query("topk", "Maximum number of results", integer),
+		query("max_results", "Alias of topk", integer),
+		query("sparse_weight", "Weight of the sparse lexical score (0 disables hybrid scoring)", map[string]any{"type": "number"}),
+		query("stream", "Stream results one per line (ndjson) or as Server-Sent Events (sse) once the search has finished; Accept: application/x-ndjson or text/event-stream work too", map[string]any{"type": "string", "enum": []string{"ndjson", "sse"}}),
+		query("summary_only", "Accepted for compatibility; has no effect", map[string]any{"type": "boolean"}),
+		query("near", "Point lat,lng: keeps records with coordinates and reports distance_km", str),
+		query("radius_km", "With near, drops records farther than this", map[string]any{"type": "number", "minimum": 0}),
+		query("distance_weight", "With near, adds distance_weight/(1+distance_km) to the score", map[string]any{"type": "number", "minimum": 0}),
+		query("geo_weight", "With near, blends proximity into the score: (1-geo_weight)*score + geo_weight*proximity, proximity being 1-distance/radius_km, or 1/(1+distance_km) without a radius", map[string]any{"type": "number", "minimum": 0, "maximum": 1}),
+		query("sort", "Order by score (default) or by distance from near", map[string]any{"type": "string", "enum": []string{"score", "distance"}}),
+		query("tie_break", "Order of results with equal scores: id ascending (default), most recently updated first, or ingestion order", tieBreak),
+		query("debug", "Return {results, debug} with the candidates scanned and left after filters, the decode, encode, scan and sort times and the cache flags; sse streams send a debug event instead", map[string]any{"type": "boolean"}),
+		query("score_normalization", "Rescaling of the returned scores: raw (default unless configured), minmax over the result set to [0, 1], or softmax", scoreNormalizationSchema()),
+		query("group_by", "Metadata field to collapse the results by, keeping the best group_size per value; needs q or keyword", str),
+		query("group_size", "Results kept per group_by value (default 1)", integer),
+		query("scorer", "Registered scorer that rescores the results before they are ordered; needs q", str),
+		map[string]any{
+			"name":        "ids",
+			"in":          "query",
+			"description": "Restrict the search to these record ids, e.g. the results of a previous search; repeat for each id",
+			"schema":      map[string]any{"type": "array", "items": str},
+			"style":       "form",
+			"explode":     true,
+		},
+		map[string]any{
+			"name":        "filter",
+			"in":          "query",
+			"description": "Metadata filter in the form field=value (or !=, <, <=, >, >=, or field@name=value with a registered operator); repeat for AND conditions",
+			"schema":      map[string]any{"type": "array", "items": str},
+			"style":       "form",
+			"explode":     true,
+		},
+	}
+}
+
+func searchResponses() map[string]any {
+	return map[string]any{
+		"200": map[string]any{
+			"description": "Search results ordered by score",
+			"headers": map[string]any{
+				"ETag": map[string]any{"description": "Hash of the JSON response; send it back in If-None-Match", "schema": map[string]any{"type": "string"}},
+				"X-Did-You-Mean": map[string]any{
+					"description": "The query with its misspelt terms replaced by near-miss terms of the dataset, when there are any",
+					"schema":      map[string]any{"type": "string"},
+				},
+			},
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": map[string]any{
+					"oneOf": []any{
+						map[string]any{"type": "array", "items": ref("SearchResult")},
+						ref("SearchDebugResponse"),
+					},
+				}},
+				"application/x-ndjson": map[string]any{
+					"schema": ref("SearchResult"),
+				},
+				"text/event-stream": map[string]any{
+					"schema": map[string]any{"type": "string", "description": "result events carrying a SearchResult, then a done event with the count"},
+				},
+			},
+		},
+		"304": map[string]any{"description": "Not modified: If-None-Match matched the current ETag"},
+		"400": errorResponse("Invalid request, or a filter on an unknown field when strict_filters is enabled"),
+		"401": errorResponse("No tenant API key, when the server hosts tenants"),
+		"403": errorResponse("The dataset belongs to another tenant"),
+		"405": map[string]any{"description": "Method not allowed"},
+		"409": errorResponse("The dataset's embeddings were produced by another model than the one requested"),
+		"429": errorResponse("Rate limit or tenant quota exceeded; see the Retry-After header"),
+		"500": errorResponse("Search failed"),
+		"503": errorResponse("The encoder is unavailable or the server is at capacity"),
+		"504": errorResponse("The request timed out"),
+	}
+}
+
+// tieBreakSchema is the schema of the tie_break search parameter.
+func tieBreakSchema() map[string]any {
+	return map[string]any{"type": "string", "enum": []string{"id", "updated", "ingestion"}}
+}
+
+// scoreNormalizationSchema is the schema of the score_normalization search
+// parameter.
+func scoreNormalizationSchema() map[string]any {
+	return map[string]any{"type": "string", "enum": []string{"raw", "minmax", "softmax"}}
+}
+
+func openAPISchemas() map[string]any {
+	str := map[string]any{"type": "string"}
+	number := map[string]any{"type": "number"}
+	stringMap := map[string]any{"type": "object", "additionalProperties": str}
+	tieBreak := tieBreakSchema()
+	return map[string]any{
+		"SearchRequest": map[string]any{
+			"type":        "object",
+			"description": "Set query for a vector search or keyword for a full-text search; with neither, the records matching the filters are returned",
+			"properties": map[string]any{
+				"query":         str,
+				"keyword":       map[string]any{"type": "string", "description": "Full-text search terms; needs no encoder"},
+				"dataset":       str,
+				"table":         map[string]any{"type": "string", "description": "Alias of dataset"},
+				"version":       map[string]any{"type": "string", "description": "Named version of the dataset to search"},
+				"model":         map[string]any{"type": "string", "description": "Registered embedding model to encode query with"},
+				"topk":          map[string]any{"type": "integer", "minimum": 1},
+				"max_results":   map[string]any{"type": "integer", "minimum": 1, "description": "Alias of topk"},
+				"filters":       stringMap,
+				"filter":        map[string]any{"type": "array", "items": str, "description": "Filters in the form field=value"},
+				"ids":           map[string]any{"type": "array", "items": str, "description": "Record ids to restrict the search to, e.g. the results of a previous search"},
+				"sparse_weight": map[string]any{"type": "number"},
+				"stream":        map[string]any{"type": "string", "enum": []string{"ndjson", "sse"}},
+				"summary_only":  map[string]any{"type": "boolean"},
+				"near": map[string]any{
+					"type":       "object",
+					"required":   []string{"lat", "lng"},
+					"properties": map[string]any{"lat": map[string]any{"type": "number"}, "lng": map[string]any{"type": "number"}},
+				},
+				"radius_km":           map[string]any{"type": "number", "minimum": 0},
+				"distance_weight":     map[string]any{"type": "number", "minimum": 0},
+				"geo_weight":          map[string]any{"type": "number", "minimum": 0, "maximum": 1},
+				"sort":                map[string]any{"type": "string", "enum": []string{"score", "distance"}},
+				"tie_break":           tieBreak,
+				"score_normalization": scoreNormalizationSchema(),
+				"debug":               map[string]any{"type": "boolean", "description": "Wrap the results in {results, debug} with diagnostics of the search"},
+				"group_by":            map[string]any{"type": "string", "description": "Metadata field to collapse the results by; needs query or keyword"},
+				"group_size":          map[string]any{"type": "integer", "minimum": 1, "description": "Results kept per group_by value (default 1)"},
+				"scorer":              map[string]any{"type": "string", "description": "Registered scorer that rescores the results before they are ordered; needs query"},
+			},
+		},
+		"SearchDebugResponse": map[string]any{
+			"type":        "object",
+			"description": "Response of a search with debug set",
+			"properties": map[string]any{
+				"results": map[string]any{"type": "array", "items": ref("SearchResult")},
+				"debug": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"candidates_scanned":       map[string]any{"type": "integer", "description": "Records read by the scan, after the metadata filters and ids applied by the database"},
+						"candidates_after_filters": map[string]any{"type": "integer", "description": "Scanned records that also passed the radius and min_score"},
+						"decode_ms":                number,
+						"encode_ms":                number,
+						"scan_ms":                  map[string]any{"type": "number", "description": "Includes sort_ms"},
+						"sort_ms":                  number,
+						"total_ms":                 number,
+						"cache_hit":                map[string]any{"type": "boolean", "description": "Served from the response cache without searching"},
+						"cache_bypassed":           map[string]any{"type": "boolean", "description": "The dataset's cache bypass header skipped the cache"},
+					},
+				},
+			},
+		},
+		"SearchResult": map[string]any{
+			"type":     "object",
+			"required": []string{"dataset", "id", "score"},
+			"properties": map[string]any{
+				"dataset":     str,
+				"id":          str,
+				"fields":      stringMap,
+				"score":       map[string]any{"type": "number"},
+				"lat":         map[string]any{"type": "number", "format": "double"},
+				"lng":         map[string]any{"type": "number", "format": "double"},
+				"distance_km": map[string]any{"type": "number", "description": "Distance from near, when given"},
+			},
+		},
+		"ReloadRequest": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"ort_lib":     str,
+				"model":       str,
+				"tokenizer":   str,
+				"max_seq_len": map[string]any{"type": "integer"},
+				"sparse_head": str,
+				"truncation":  map[string]any{"type": "string", "enum": []string{"head", "tail", "middle"}},
+				"normalize":   map[string]any{"type": "array", "items": str},
+			},
+		},
+		"ReloadResponse": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"status":  str,
+				"encoder": ref("ReloadRequest"),
+			},
+		},
+		"SuggestResponse": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"query":   str,
+				"dataset": str,
+				"suggestions": map[string]any{
+					"type": "array",
+					"items": map[string]any{
+						"type": "object",
+						"properties": map[string]any{
+							"text":  map[string]any{"type": "string", "description": "The query with its last word completed"},
+							"count": map[string]any{"type": "integer", "description": "Records containing the completed term"},
+						},
+					},
+				},
+			},
+		},
+		"Schedules": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"schedules": map[string]any{
+					"type": "array",
+					"items": map[string]any{
+						"type": "object",
+						"properties": map[string]any{
+							"dataset":  str,
+							"table":    str,
+							"schedule": map[string]any{"type": "string", "description": "Cron expression"},
+							"csv":      map[string]any{"type": "string", "description": "CSV path or URL"},
+							"running":  map[string]any{"type": "boolean"},
+							"next_run": map[string]any{"type": "string", "format": "date-time", "description": "Absent when the scheduler is not running"},
+							"overlaps": map[string]any{"type": "integer", "description": "Runs skipped because the previous one had not finished"},
+							"last_run": map[string]any{
+								"type": "object",
+								"properties": map[string]any{
+									"status":      map[string]any{"type": "string", "enum": []string{"succeeded", "failed"}},
+									"started_at":  map[string]any{"type": "string", "format": "date-time"},
+									"finished_at": map[string]any{"type": "string", "format": "date-time"},
+									"upserted":    map[string]any{"type": "integer"},
+									"skipped":     map[string]any{"type": "integer"},
+									"removed":     map[string]any{"type": "integer"},
+									"error":       str,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"Replica": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"source":     map[string]any{"type": "string", "description": "Snapshot path or URL"},
+				"interval":   map[string]any{"type": "string", "description": "Time between checks"},
+				"version":    map[string]any{"type": "string", "description": "Checksum, or size and modification time, of the snapshot in use"},
+				"last_check": map[string]any{"type": "string", "format": "date-time"},
+				"last_sync":  map[string]any{"type": "string", "format": "date-time"},
+				"syncs":      map[string]any{"type": "integer", "description": "Snapshots applied since the server started"},
+				"error":      map[string]any{"type": "string", "description": "Failure of the last check; the previous snapshot stays in use"},
+			},
+		},
+		"Dataset": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"name":       str,
+				"table":      str,
+				"default":    map[string]any{"type": "boolean"},
+				"configured": map[string]any{"type": "boolean"},
+				"version":    map[string]any{"type": "string", "description": "Named version held by the table, searched with the version parameter"},
+				"rows":       map[string]any{"type": "integer"},
+				"vectors":    map[string]any{"type": "integer"},
+				"sparse":     map[string]any{"type": "integer"},
+				"fts":        map[string]any{"type": "integer"},
+				"geo":        map[string]any{"type": "integer"},
+				"dimension":  map[string]any{"type": "integer", "description": "Embedding dimension (0 when no vectors are stored)"},
+				"has_fts":    map[string]any{"type": "boolean"},
+				"has_geo":    map[string]any{"type": "boolean"},
+				"has_sparse": map[string]any{"type": "boolean"},
+			},
+		},
+		"EmbedRequest": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"text":   str,
+				"texts":  map[string]any{"type": "array", "items": str, "maxItems": maxEmbedTexts},
+				"sparse": map[string]any{"type": "boolean", "description": "Also return bge-m3 lexical weights (requires a sparse head)"},
+			},
+		},
+		"FeedbackRequest": map[string]any{
+			"type":     "object",
+			"required": []string{"query", "id"},
+			"properties": map[string]any{
+				"query":    str,
+				"dataset":  str,
+				"id":       map[string]any{"type": "string", "description": "Id of the selected result"},
+				"position": map[string]any{"type": "integer", "minimum": 0, "description": "1-based rank of the selected result (0 when unknown)"},
+				"results":  map[string]any{"type": "array", "items": str, "description": "Ids of the results shown, best first; the tune command compares the selected result with them"},
+			},
+		},
+		"Answer": map[string]any{
+			"type":     "object",
+			"required": []string{"query", "answer", "citations", "results"},
+			"properties": map[string]any{
+				"query":     str,
+				"answer":    str,
+				"citations": map[string]any{"type": "array", "items": str, "description": "Ids of the results cited by the answer, in citation order"},
+				"model":     str,
+				"results":   map[string]any{"type": "array", "items": ref("SearchResult")},
+				"took_ms":   map[string]any{"type": "number"},
+			},
+		},
+		"Embedding": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"text":      str,
+				"model":     str,
+				"dimension": map[string]any{"type": "integer"},
+				"vector":    map[string]any{"type": "array", "items": map[string]any{"type": "number"}},
+				"sparse": map[string]any{
+					"type":                 "object",
+					"description":          "Token id → weight",
+					"additionalProperties": map[string]any{"type": "number"},
+				},
+				"tokens": map[string]any{"type": "integer", "description": "Tokens encoded, special tokens included and after truncation; omitted when the encoder does not count tokens"},
+			},
+		},
+		"Version": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"version":            str,
+				"commit":             str,
+				"build_date":         str,
+				"go_version":         str,
+				"platform":           map[string]any{"type": "string", "example": "linux/amd64"},
+				"onnx_runtime":       map[string]any{"type": "string", "description": "ONNX Runtime library version (omitted when it could not be loaded)"},
+				"onnx_runtime_error": map[string]any{"type": "string", "description": "Why the ONNX Runtime version is unavailable"},
+			},
+		},
+		"IngestMapping": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"dataset":      str,
+				"table":        str,
+				"id_column":    str,
+				"text_columns": map[string]any{"type": "array", "items": str},
+				"meta_columns": map[string]any{"type": "array", "items": str},
+				"lat_column":   str,
+				"lng_column":   str,
+				"batch_size":   map[string]any{"type": "integer"},
+				"sparse":       map[string]any{"type": "boolean"},
+				"duplicates":   map[string]any{"type": "string", "enum": []string{"last", "first", "error"}},
+			},
+		},
+		"IngestJob": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"id":       str,
+				"status":   map[string]any{"type": "string", "enum": []string{jobQueued, jobRunning, jobSucceeded, jobFailed}},
+				"filename": str,
+				"request":  ref("IngestMapping"),
+				"result": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"dataset":    str,
+						"table":      str,
+						"upserted":   map[string]any{"type": "integer"},
+						"skipped":    map[string]any{"type": "integer"},
+						"dropped":    map[string]any{"type": "integer"},
+						"duplicates": map[string]any{"type": "integer"},
+					},
+				},
+				"error":       str,
+				"created_at":  map[string]any{"type": "string", "format": "date-time"},
+				"started_at":  map[string]any{"type": "string", "format": "date-time"},
+				"finished_at": map[string]any{"type": "string", "format": "date-time"},
+			},
+		},
+		"Error": map[string]any{
+			"type":     "object",
+			"required": []string{"error"},
+			"properties": map[string]any{
+				"error":        str,
+				"valid_fields": map[string]any{"type": "array", "items": str, "description": "Fields of the dataset, when a filter named an unknown one"},
+			},
+		},
+	}
+}
+
+func adminSecurity() []any {
+	return []any{map[string]any{"adminToken": []string{}}}
+}
+
+func errorResponse(description string) map[string]any {
+	return map[string]any{
+		"description": description,
+		"content":     jsonContent(ref("Error")),
+	}
+}
+
+func jsonContent(schema map[string]any) map[string]any {
+	return map[string]any{
+		"application/json": map[string]any{"schema": schema},
+	}
+}
+
+func ref(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit configures the token-bucket limiter placed in front of the API.
+// A zero rate disables the corresponding limit.
+type RateLimit struct {
+	// Rate and Burst bound the requests accepted from all clients combined.
+	Rate  float64
+	Burst int
+	// ClientRate and ClientBurst bound each client, identified by its tenant
+	// API key (X-API-Key header or bearer token) or, failing that, its IP
+	// address. Keys that no tenant owns do not count, so that made-up keys
+	// neither escape the limit nor pile up buckets.
+	ClientRate  float64
+	ClientBurst int
+}
+
+func (c RateLimit) enabled() bool {
+	return c.Rate > 0 || c.ClientRate > 0
+}
+
+// clientIdleTTL is how long an unused per-client bucket is kept around.
+const clientIdleTTL = 10 * time.Minute
+
+// tokenBucket is a classic token bucket refilled continuously at rate tokens
+// per second up to burst tokens.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	b := float64(burst)
+	if b < 1 {
+		b = math.Max(1, math.Ceil(rate))
+	}
+	return &tokenBucket{rate: rate, burst: b, tokens: b, last: now}
+}
+
+// take consumes a token when available. Otherwise it reports how long the
+// caller has to wait until the next token becomes available.
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	return false, wait
+}
+
+// refund returns a token taken by a request that was rejected by another
+// bucket, so that a throttled client does not drain the global budget.
+func (b *tokenBucket) refund() {
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
+
+type rateLimiter struct {
+	cfg     RateLimit
+	mu      sync.Mutex
+	global  *tokenBucket
+	clients map[string]*tokenBucket
+	lastGC  time.Time
+	now     func() time.Time
+}
+
+func newRateLimiter(cfg RateLimit) *rateLimiter {
+	l := &rateLimiter{cfg: cfg, clients: make(map[string]*tokenBucket), now: time.Now}
+	if cfg.Rate > 0 {
+		l.global = newTokenBucket(cfg.Rate, cfg.Burst, l.now())
+	}
+	l.lastGC = l.now()
+	return l
+}
+
+// allow reports whether a request from client may proceed and, if not, how
+// long it should wait before retrying.
+func (l *rateLimiter) allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.collect(now)
+
+	var clientBucket *tokenBucket
+	if l.cfg.ClientRate > 0 {
+		clientBucket = l.clients[client]
+		if clientBucket == nil {
+			clientBucket = newTokenBucket(l.cfg.ClientRate, l.cfg.ClientBurst, now)
+			l.clients[client] = clientBucket
+		}
+		if ok, wait := clientBucket.take(now); !ok {
+			return false, wait
+		}
+	}
+	if l.global != nil {
+		if ok, wait := l.global.take(now); !ok {
+			if clientBucket != nil {
+				clientBucket.refund()
+			}
+			return false, wait
+		}
+	}
+	return true, 0
+}
+
+// collect drops per-client buckets that have been idle long enough to be full
+// again, keeping memory bounded for servers facing many distinct clients.
+func (l *rateLimiter) collect(now time.Time) {
+	if now.Sub(l.lastGC) < clientIdleTTL {
+		return
+	}
+	for key, b := range l.clients {
+		if now.Sub(b.last) >= clientIdleTTL {
+			delete(l.clients, key)
+		}
+	}
+	l.lastGC = now
+}
+
+// rateLimit wraps next with the configured limiter. Health checks and the
+// OpenAPI document and metrics are never throttled.
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	if s.limiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz", "/version", "/openapi.json", "/metrics":
+			next.ServeHTTP(w, r)
+			return
+		}
+		ok, wait := s.limiter.allow(s.rateLimitKey(r))
+		if !ok {
+			seconds := int(math.Ceil(wait.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			s.writeError(w, http.StatusTooManyRequests, fmt.Errorf("rate limit exceeded, retry after %ds", seconds))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitKey identifies the client of a request: the API key when it is
+// a configured tenant's, the remote IP address otherwise.
+func (s *Server) rateLimitKey(r *http.Request) string {
+	if key := apiKey(r); key != "" && s.tenants != nil && s.tenants.byKey[key] != nil {
+		return "key:" + key
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// apiKey returns the API key presented by a request in the X-API-Key header
+// or as a bearer token, or "".
+func apiKey(r *http.Request) string {
+	if key := strings.TrimSpace(r.Header.Get("X-API-Key")); key != "" {
+		return key
+	}
+	if auth := strings.TrimSpace(r.Header.Get("Authorization")); len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ReplicaStatus reports the synchronization of a read replica for
+// GET /admin/replica.
+type ReplicaStatus struct {
+	Source   string `json:"source"`
+	Interval string `json:"interval,omitempty"`
+	// Version identifies the snapshot in use.
+	Version   string     `json:"version,omitempty"`
+	LastCheck *time.Time `json:"last_check,omitempty"`
+	LastSync  *time.Time `json:"last_sync,omitempty"`
+	Syncs     int        `json:"syncs"`
+	// Error is the failure of the last check; the previous snapshot stays
+	// in use.
+	Error string `json:"error,omitempty"`
+}
+
+func (s *Server) handleReplica(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	status := s.cfg.Replica()
+	if status == nil {
+		s.writeError(w, http.StatusNotFound, fmt.Errorf("the server is not a replica"))
+		return
+	}
+	s.writeJSON(w, http.StatusOK, status)
+}
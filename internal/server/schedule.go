@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http"
+	"time"
+)
+
+// ScheduleStatus reports the scheduled re-ingestion of a dataset for
+// GET /admin/schedules.
+type ScheduleStatus struct {
+	Dataset  string `json:"dataset"`
+	Table    string `json:"table"`
+	Schedule string `json:"schedule"`
+	CSV      string `json:"csv"`
+	// Running is set while an ingest started by the schedule is in progress.
+	Running bool `json:"running"`
+	// NextRun is unset when the scheduler is not running.
+	NextRun *time.Time `json:"next_run,omitempty"`
+	// Overlaps counts the runs skipped because the previous one had not
+	// finished.
+	Overlaps int          `json:"overlaps,omitempty"`
+	LastRun  *ScheduleRun `json:"last_run,omitempty"`
+}
+
+// ScheduleRun is the outcome of a scheduled ingest.
+type ScheduleRun struct {
+	Status     string    `json:"status"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Upserted   int       `json:"upserted"`
+	Skipped    int       `json:"skipped"`
+	Removed    int       `json:"removed,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// PurgeCache drops the cached search responses, e.g. after the records were
+// changed behind the server's back.
+func (s *Server) PurgeCache() {
+	s.purgeCaches()
+}
+
+func (s *Server) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	schedules := s.cfg.Schedules()
+	if schedules == nil {
+		schedules = []ScheduleStatus{}
+	}
+	s.writeJSON(w, http.StatusOK, map[string]any{"schedules": schedules})
+}
@@ -6,74 +6,297 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"yashubustudio/csv-search/emb"
+	"yashubustudio/csv-search/internal/cache"
+	"yashubustudio/csv-search/internal/embedding"
+	"yashubustudio/csv-search/internal/metrics"
+	"yashubustudio/csv-search/internal/querylog"
 	"yashubustudio/csv-search/internal/search"
+	"yashubustudio/csv-search/internal/store"
 )
 
 type Config struct {
-	Addr            string
-	Dataset         string
-	DefaultTopK     int
+	Addr         string
+	Dataset      string
+	DefaultTopK  int
+	SparseWeight float64
+	// Metric, MinScore and ScorePrecision tune the scoring of every search
+	// (see search.Options); DatasetDefaults overrides them, DefaultTopK and
+	// SparseWeight for individual datasets.
+	Metric         string
+	MinScore       float64
+	ScorePrecision int
+	// ScoreNormalization rescales the scores of every result set (see
+	// search.Options); requests can choose another with score_normalization.
+	ScoreNormalization string
+	// StrictFilters answers 400 to filters on fields the dataset does not
+	// have, listing the valid ones.
+	StrictFilters bool
+	// FieldBoosts add per-field boosts to the scores of vector searches
+	// (see search.Options).
+	FieldBoosts     map[string]float64
+	DatasetDefaults map[string]SearchDefaults
 	RequestTimeout  time.Duration
 	ShutdownTimeout time.Duration
+
+	// AdminToken protects the /admin endpoints with a bearer token. When empty
+	// they only accept requests from loopback addresses.
+	AdminToken string
+	// ReloadModel backs POST /admin/reload-model. The endpoint is not
+	// registered when nil.
+	ReloadModel func(ctx context.Context, req ReloadRequest) (ReloadRequest, error)
+	// Ingest backs POST /ingest and GET /ingest/{job}. Uploads are ingested
+	// asynchronously; the endpoints are not registered when nil.
+	Ingest func(ctx context.Context, req IngestRequest) (IngestResult, error)
+	// MaxUploadBytes caps CSV uploads (256 MiB when zero).
+	MaxUploadBytes int64
+	// Datasets backs GET /datasets; the endpoint is not registered when nil.
+	Datasets func(ctx context.Context) ([]DatasetInfo, error)
+	// Embed backs POST /embed, which returns the raw vectors of the posted
+	// texts; the endpoint is not registered when nil.
+	Embed func(ctx context.Context, req EmbedRequest) ([]Embedding, error)
+	// Version backs GET /version; the endpoint is not registered when nil.
+	Version func() VersionInfo
+	// Answer backs /answer, which runs a search like /search and returns
+	// the answer Answer gives to its query from the top AnswerTopK results
+	// (5 when zero) unless the request sets topk. The endpoint is not
+	// registered when nil.
+	Answer     func(ctx context.Context, question string, results []search.Result) (Answer, error)
+	AnswerTopK int
+	// Feedback backs POST /feedback, which records the result a user
+	// selected for a query; the endpoint is not registered when nil.
+	Feedback func(ctx context.Context, req FeedbackRequest) error
+	// DisableUI turns off the embedded search page served at "/".
+	DisableUI bool
+	// Engine runs the searches and caches their prepared statements; when
+	// nil the server creates one for its database.
+	Engine *search.Engine
+	// Schedules backs GET /admin/schedules, the state of the scheduled
+	// re-ingestion of datasets; the endpoint is not registered when nil.
+	Schedules func() []ScheduleStatus
+	// DatasetVersion resolves the version parameter of a search to the
+	// dataset holding the records of that version of table; an unknown
+	// version wraps store.ErrVersionNotFound. Searches with a version are
+	// rejected when nil.
+	DatasetVersion func(ctx context.Context, table, version string) (string, error)
+	// Model hands out the encoder registered under the model parameter of a
+	// search of table, with the function releasing it; a name that is not
+	// registered wraps embedding.ErrUnknownModel and a model that did not
+	// produce the embeddings of table embedding.ErrModelMismatch. Searches
+	// naming a model are rejected when nil.
+	Model func(ctx context.Context, table, name string) (embedding.Embedder, func(), error)
+	// Replica backs GET /admin/replica, the state of a read replica's
+	// synchronization; the endpoint is not registered when nil.
+	Replica func() *ReplicaStatus
+	// Maintenance backs /admin/reindex, /admin/re-embed, /admin/compact,
+	// /admin/backup and /admin/config; they are not registered when nil.
+	Maintenance Maintenance
+	// RateLimit throttles clients with 429 Too Many Requests responses.
+	RateLimit RateLimit
+	// Tenants, when set, require every API request to identify one of them
+	// (401 otherwise) and confine it to the tenant's datasets (403) and
+	// quota (429).
+	Tenants []Tenant
+	// TLSCertFile and TLSKeyFile serve HTTPS instead of plain HTTP. Rotated
+	// files are picked up without a restart.
+	TLSCertFile string
+	TLSKeyFile  string
+	// Metrics enables GET /metrics and request instrumentation when set.
+	Metrics *metrics.Registry
+	// QueryLog records every search (HTTP and WebSocket) when set.
+	QueryLog *querylog.Logger
+	// AccessLog receives one line per request (method, path, status, bytes,
+	// latency and, for searches, the encode/scan breakdown) when set.
+	AccessLog io.Writer
+	// AccessLogFormat is AccessLogCommon (the default) or AccessLogJSON.
+	AccessLogFormat string
+	// MaxInFlight caps concurrently executing requests (unlimited when zero).
+	// Up to MaxQueue further requests wait for a free slot, at most
+	// RequestTimeout; the rest receive 503 Service Unavailable.
+	MaxInFlight int
+	MaxQueue    int
+	// CacheTTL enables an in-process cache of serialized search responses
+	// for identical queries (same dataset, query, filters and topK). At most
+	// CacheSize entries (1024 when zero) are kept. Search responses always
+	// carry an ETag and honour If-None-Match.
+	CacheTTL  time.Duration
+	CacheSize int
+	// DatasetCaches give datasets (by table) a response cache of their own
+	// instead of the CacheTTL one; see Defaults.Caches.
+	DatasetCaches map[string]DatasetCache
+	// Logger receives the server's log messages (slog.Default() when nil).
+	Logger *slog.Logger
+	// BeforeSearch, when set, may rewrite every search (HTTP and WebSocket)
+	// after the defaults are applied; AfterSearch may re-rank, filter or
+	// redact its results. An error from either fails the search. Cached
+	// responses are served without calling them again.
+	BeforeSearch func(ctx context.Context, q *SearchQuery) error
+	AfterSearch  func(ctx context.Context, q SearchQuery, results []search.Result) ([]search.Result, error)
+	// ObserveSearch, when set, receives the timings of every search run
+	// (source is "http", "ws" or "answer"); cached responses are not
+	// reported.
+	ObserveSearch func(source string, q SearchQuery, timings search.Timings, total time.Duration, err error)
+}
+
+// SearchQuery is a search as seen by Config.BeforeSearch and
+// Config.AfterSearch.
+type SearchQuery struct {
+	Query   string
+	Dataset string
+	TopK    int
+	Filters []search.Filter
+}
+
+// EncoderFunc hands out the encoder for a single request. The release function
+// must be called once the encoder is no longer in use so that a model reload
+// can retire the previous instance.
+type EncoderFunc func() (enc embedding.Embedder, release func(), err error)
+
+// StaticEncoder returns an EncoderFunc that always yields enc.
+func StaticEncoder(enc embedding.Embedder) EncoderFunc {
+	return func() (embedding.Embedder, func(), error) {
+		if enc == nil {
+			return nil, nil, fmt.Errorf("encoder must not be nil")
+		}
+		return enc, func() {}, nil
+	}
 }
 
 type Server struct {
 	db       *sql.DB
-	enc      *emb.Encoder
+	encoders EncoderFunc
 	cfg      Config
-	encodeMu sync.Mutex
+	log      *slog.Logger
+	limiter  *rateLimiter
+	certs    *CertReloader
+	metrics  *serverMetrics
+	access   *accessLogger
+	inflight *inflightLimiter
+	cache    *cache.LRU[*cachedResponse]
+	tenants  *tenants
+	// datasetCaches holds the caches of the datasets in Defaults.Caches,
+	// created on first use.
+	datasetCaches datasetCaches
+
+	defaultsMu sync.RWMutex
+	defaults   Defaults
+	// active tracks running requests and ingest jobs for graceful draining.
+	active requestTracker
+
+	ingestJobs *ingestJobs
+	// baseCtx outlives individual requests and is cancelled when Serve
+	// returns, stopping background ingest jobs and closing WebSockets.
+	baseCtx    context.Context
+	cancelBase context.CancelFunc
 }
 
-func New(db *sql.DB, enc *emb.Encoder, cfg Config) (*Server, error) {
+func New(db *sql.DB, encoders EncoderFunc, cfg Config) (*Server, error) {
 	if db == nil {
 		return nil, fmt.Errorf("db must not be nil")
 	}
-	if enc == nil {
+	if encoders == nil {
 		return nil, fmt.Errorf("encoder must not be nil")
 	}
-	cfg.Dataset = strings.TrimSpace(cfg.Dataset)
-	if cfg.Dataset == "" {
-		cfg.Dataset = "default"
-	}
 	cfg.Addr = strings.TrimSpace(cfg.Addr)
 	if cfg.Addr == "" {
 		cfg.Addr = ":8080"
 	}
-	if cfg.DefaultTopK <= 0 {
-		cfg.DefaultTopK = 10
-	}
 	if cfg.RequestTimeout <= 0 {
 		cfg.RequestTimeout = 30 * time.Second
 	}
 	if cfg.ShutdownTimeout <= 0 {
 		cfg.ShutdownTimeout = 5 * time.Second
 	}
-	return &Server{db: db, enc: enc, cfg: cfg}, nil
+	cfg.TLSCertFile = strings.TrimSpace(cfg.TLSCertFile)
+	cfg.TLSKeyFile = strings.TrimSpace(cfg.TLSKeyFile)
+	if cfg.Engine == nil {
+		cfg.Engine = search.NewEngine(db)
+	}
+	srv := &Server{db: db, encoders: encoders, cfg: cfg, log: cfg.Logger, metrics: newServerMetrics(cfg.Metrics), ingestJobs: newIngestJobs()}
+	if srv.log == nil {
+		srv.log = slog.Default()
+	}
+	srv.defaults = Defaults{
+		Dataset: cfg.Dataset,
+		Search: SearchDefaults{
+			TopK:               cfg.DefaultTopK,
+			SparseWeight:       cfg.SparseWeight,
+			Metric:             cfg.Metric,
+			MinScore:           cfg.MinScore,
+			ScorePrecision:     cfg.ScorePrecision,
+			ScoreNormalization: cfg.ScoreNormalization,
+			StrictFilters:      cfg.StrictFilters,
+			FieldBoosts:        cfg.FieldBoosts,
+		},
+		Datasets: cfg.DatasetDefaults,
+		Caches:   cfg.DatasetCaches,
+	}.normalized()
+	srv.baseCtx, srv.cancelBase = context.WithCancel(context.Background())
+	access, err := newAccessLogger(cfg.AccessLog, strings.TrimSpace(cfg.AccessLogFormat))
+	if err != nil {
+		return nil, err
+	}
+	srv.access = access
+	srv.inflight = newInflightLimiter(cfg.MaxInFlight, cfg.MaxQueue)
+	srv.cache = cache.New[*cachedResponse](cfg.CacheTTL, cfg.CacheSize)
+	if cfg.Metrics != nil {
+		cfg.Metrics.GaugeFunc("csvsearch_http_requests_in_flight", "HTTP requests and background ingest jobs currently running.", func() float64 {
+			return float64(srv.active.count())
+		})
+	}
+	if cfg.RateLimit.enabled() {
+		srv.limiter = newRateLimiter(cfg.RateLimit)
+	}
+	if srv.tenants, err = newTenants(cfg.Tenants); err != nil {
+		return nil, err
+	}
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		certs, err := NewCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		certs.Logger = srv.log
+		srv.certs = certs
+	}
+	return srv, nil
 }
 
 func (s *Server) Serve(ctx context.Context) error {
 	if ctx == nil {
 		return fmt.Errorf("context must not be nil")
 	}
+	defer s.cancelBase()
 	handler := s.Handler()
 	srv := &http.Server{
-		Addr:    s.cfg.Addr,
-		Handler: handler,
+		Addr:     s.cfg.Addr,
+		Handler:  handler,
+		ErrorLog: slog.NewLogLogger(s.log.Handler(), slog.LevelWarn),
 	}
 
-	log.Printf("csv-search server listening on %s (dataset=%s, topK=%d)\n", s.cfg.Addr, s.cfg.Dataset, s.cfg.DefaultTopK)
+	scheme := "http"
+	if s.certs != nil {
+		srv.TLSConfig = s.certs.TLSConfig()
+		scheme = "https"
+	}
+
+	defaults := s.Defaults()
+	s.log.Info("server listening", "addr", s.cfg.Addr, "scheme", scheme, "dataset", defaults.Dataset, "top_k", defaults.Search.TopK)
 
 	errCh := make(chan error, 1)
 	go func() {
-		if err := srv.ListenAndServe(); err != nil {
+		listen := srv.ListenAndServe
+		if s.certs != nil {
+			// The certificate comes from TLSConfig.GetCertificate.
+			listen = func() error { return srv.ListenAndServeTLS("", "") }
+		}
+		if err := listen(); err != nil {
 			errCh <- err
 			return
 		}
@@ -85,12 +308,20 @@ func (s *Server) Serve(ctx context.Context) error {
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
 		defer cancel()
 
-		if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, context.Canceled) {
-			return err
+		// Shutdown stops accepting connections and waits for regular
+		// requests. Hijacked WebSockets and ingest jobs are not covered, so
+		// stop them and wait for them to return within the same deadline.
+		shutdownErr := srv.Shutdown(shutdownCtx)
+		s.cancelBase()
+		if err := s.active.wait(shutdownCtx); err != nil {
+			s.log.Warn("shutdown timed out", "in_flight", s.active.count())
+		}
+		if shutdownErr != nil && !errors.Is(shutdownErr, context.Canceled) {
+			return shutdownErr
 		}
 		err := <-errCh
 		if err == nil || errors.Is(err, http.ErrServerClosed) {
-			log.Printf("csv-search server shutdown complete\n")
+			s.log.Info("server shutdown complete")
 			return nil
 		}
 		return err
@@ -106,10 +337,54 @@ func (s *Server) Serve(ctx context.Context) error {
 // Callers can mount the handler on an existing mux when embedding the service.
 func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/search", s.handleSearch)
-	mux.HandleFunc("/query", s.handleSearch)
+	mux.HandleFunc("/search", s.instrument("/search", s.handleSearch))
+	mux.HandleFunc("/query", s.instrument("/query", s.handleSearch))
+	mux.HandleFunc("/suggest", s.instrument("/suggest", s.handleSuggest))
 	mux.HandleFunc("/healthz", s.handleHealth)
-	return mux
+	mux.HandleFunc("/ws", s.handleWebSocket)
+	if !s.cfg.DisableUI {
+		mux.HandleFunc("/", s.handleUI)
+	}
+	if s.cfg.Datasets != nil {
+		mux.HandleFunc("/datasets", s.instrument("/datasets", s.handleDatasets))
+	}
+	if s.cfg.Embed != nil {
+		mux.HandleFunc("/embed", s.instrument("/embed", s.handleEmbed))
+	}
+	if s.cfg.Version != nil {
+		mux.HandleFunc("/version", s.handleVersion)
+	}
+	if s.cfg.Answer != nil {
+		mux.HandleFunc("/answer", s.instrument("/answer", s.handleAnswer))
+	}
+	if s.cfg.Feedback != nil {
+		mux.HandleFunc("/feedback", s.instrument("/feedback", s.handleFeedback))
+	}
+	mux.HandleFunc("/openapi.json", s.handleOpenAPI)
+	if s.cfg.Metrics != nil {
+		mux.HandleFunc("/metrics", s.handleMetrics)
+	}
+	if s.cfg.Ingest != nil {
+		mux.HandleFunc("/ingest", s.instrument("/ingest", s.handleIngest))
+		mux.HandleFunc("/ingest/", s.instrument("/ingest/{job}", s.handleIngestStatus))
+	}
+	if s.cfg.Schedules != nil {
+		mux.HandleFunc("/admin/schedules", s.instrument("/admin/schedules", s.handleSchedules))
+	}
+	if s.cfg.Replica != nil {
+		mux.HandleFunc("/admin/replica", s.instrument("/admin/replica", s.handleReplica))
+	}
+	if s.cfg.ReloadModel != nil {
+		mux.HandleFunc("/admin/reload-model", s.instrument("/admin/reload-model", s.handleReloadModel))
+	}
+	if s.cfg.Maintenance != nil {
+		mux.HandleFunc("/admin/reindex", s.instrument("/admin/reindex", s.handleReindex))
+		mux.HandleFunc("/admin/re-embed", s.instrument("/admin/re-embed", s.handleReembed))
+		mux.HandleFunc("/admin/compact", s.instrument("/admin/compact", s.handleCompact))
+		mux.HandleFunc("/admin/backup", s.instrument("/admin/backup", s.handleBackup))
+		mux.HandleFunc("/admin/config", s.instrument("/admin/config", s.handleAdminConfig))
+	}
+	return s.accessLog(s.rateLimit(s.tenantAuth(s.limitInFlight(mux))))
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -118,11 +393,64 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 }
 
 type searchRequest struct {
-	Query       string
-	Dataset     string
-	TopK        int
-	Filters     []search.Filter
-	SummaryOnly bool
+	Query string
+	// Keyword asks for a full-text search instead of a vector search. A
+	// request with neither Query nor Keyword returns the records passing
+	// Filters. Only Query needs the encoder.
+	Keyword string
+	Dataset string
+	TopK    int
+	Filters []search.Filter
+	// IDs restricts the search to these records, e.g. the results of a
+	// previous search that a follow-up query refines.
+	IDs []string
+	// Near restricts and ranks the results by distance from a point.
+	Near         *search.Near
+	SummaryOnly  bool
+	SparseWeight *float64
+	// Metric, MinScore, ScorePrecision, StrictFilters and FieldBoosts come
+	// from the dataset's defaults.
+	Metric         string
+	MinScore       float64
+	ScorePrecision int
+	StrictFilters  bool
+	FieldBoosts    map[string]float64
+	// Stopwords and TermBoosts are the dictionaries of the dataset.
+	Stopwords  map[string]bool
+	TermBoosts map[string]float64
+	// Languages route the query by its language (see search.Language).
+	Languages map[string]search.Language
+	// TieBreak orders results with equal scores (see search.Options).
+	TieBreak string
+	// ScoreNormalization rescales the scores of the results (see
+	// search.Options); withDefaults fills in the dataset's when empty.
+	ScoreNormalization string
+	// GroupBy and GroupSize collapse the results per value of a field (see
+	// search.Options).
+	GroupBy   string
+	GroupSize int
+	// Scorer names a registered scorer that rescores the results of a vector
+	// search (see search.RegisterScorer).
+	Scorer string
+	// Stream selects a streaming response ("ndjson" or "sse"); empty returns a
+	// single JSON array.
+	Stream string
+	// IncludeVectors adds the stored embedding to every result.
+	IncludeVectors bool
+	// Version searches a named version of the dataset instead of its live
+	// contents; withDefaults replaces Dataset with the version's dataset.
+	Version string
+	// Model names the registered encoder of a vector search's query (see
+	// Config.Model); empty uses the server's encoder.
+	Model string
+	// Debug adds the candidate counts, stage timings and cache flags of the
+	// search to the response (see searchDebug).
+	Debug bool
+	// defaulted marks a request that withDefaults was applied to.
+	defaulted bool
+	// progress receives the provisional results of a vector search (see
+	// search.Options.Progress).
+	progress func([]search.Result)
 }
 
 func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
@@ -133,41 +461,401 @@ func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	start := time.Now()
 	req, err := s.decodeSearchRequest(r)
+	decodeTime := time.Since(start)
 	if err != nil {
 		s.writeError(w, http.StatusBadRequest, err)
 		return
 	}
-	if strings.TrimSpace(req.Query) == "" {
-		s.writeError(w, http.StatusBadRequest, fmt.Errorf("query is required"))
+	switch {
+	case req.Query != "" && req.Keyword != "":
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("query and keyword are mutually exclusive"))
+		return
+	case req.Keyword != "" && req.Near != nil:
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("near is not supported with keyword"))
+		return
+	case req.Query == "" && req.Keyword == "" && len(req.Filters) == 0 && len(req.IDs) == 0 && req.Near == nil:
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("query, keyword, filter, ids or near is required"))
 		return
 	}
 
-	dataset := req.Dataset
-	if dataset == "" {
-		dataset = s.cfg.Dataset
+	req, err = s.withDefaults(r.Context(), req)
+	if err != nil {
+		s.writeError(w, searchErrorStatus(err), err)
+		return
 	}
-	topK := req.TopK
-	if topK <= 0 {
-		topK = s.cfg.DefaultTopK
+	format := streamFormat(r, req.Stream)
+	responses, bypass := s.responseCache(req.Dataset)
+	bypassed := bypass != "" && len(r.Header.Values(bypass)) > 0
+	cacheKey := ""
+	if format == "" {
+		cacheKey = searchCacheKey(req)
+		if !bypassed {
+			if cached, ok := responses.Get(cacheKey); ok {
+				s.logSearch("http", req, time.Since(start), cached.results, nil)
+				if req.Debug {
+					debug := newSearchDebug(decodeTime, search.Timings{}, time.Since(start))
+					debug.CacheHit = true
+					s.writeDebugResponse(w, cached.results, cached.suggestion, debug)
+					return
+				}
+				s.writeCachedResponse(w, r, cached, responses.TTL())
+				return
+			}
+		}
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.RequestTimeout)
 	defer cancel()
 
-	s.encodeMu.Lock()
-	results, err := search.VectorSearch(ctx, s.db, s.enc, dataset, req.Query, topK, req.Filters)
-	s.encodeMu.Unlock()
+	var stream *resultStream
+	if format != "" {
+		// The headers of a stream may go out before the search ends.
+		stream = s.newResultStream(w, format)
+		if suggestion := s.suggest(ctx, req); suggestion != "" {
+			w.Header().Set(didYouMeanHeader, suggestion)
+		}
+		// An AfterSearch hook only sees the final results, so the
+		// provisional ones are not sent past it.
+		if s.cfg.AfterSearch == nil {
+			req.progress = stream.partial
+		}
+	}
+	results, timings, err := s.runSearch(ctx, "http", req)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if errors.Is(err, context.DeadlineExceeded) {
-			status = http.StatusGatewayTimeout
+		if stream != nil && stream.started {
+			stream.fail(err)
+			return
 		}
-		s.writeError(w, status, err)
+		s.writeError(w, searchErrorStatus(err), err)
 		return
 	}
 
-	s.writeJSON(w, http.StatusOK, results)
+	s.metrics.observeSearch(decodeTime, timings, time.Since(start), len(results))
+	noteTimings(r.Context(), timings)
+	var debug *searchDebug
+	if req.Debug {
+		debug = newSearchDebug(decodeTime, timings, time.Since(start))
+		debug.CacheBypassed = bypassed
+	}
+	if stream != nil {
+		stream.finish(results, debug)
+		return
+	}
+	suggestion := s.suggest(ctx, req)
+	resp, err := newCachedResponse(results, suggestion)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.Put(cacheKey, resp)
+	if debug != nil {
+		s.writeDebugResponse(w, results, suggestion, debug)
+		return
+	}
+	s.writeCachedResponse(w, r, resp, responses.TTL())
+}
+
+// didYouMeanHeader carries the correction of a query with typos (see
+// search.Engine.Suggest) in search responses.
+const didYouMeanHeader = "X-Did-You-Mean"
+
+// suggest returns the correction of the query or keyword of req, or "" when
+// there is none. Failures are only logged since the results stand without it.
+func (s *Server) suggest(ctx context.Context, req searchRequest) string {
+	text := req.Query
+	if req.Keyword != "" {
+		text = req.Keyword
+	}
+	if strings.TrimSpace(text) == "" {
+		return ""
+	}
+	suggestion, err := s.cfg.Engine.Suggest(ctx, req.Dataset, text)
+	if err != nil {
+		s.log.Warn("suggest failed", "dataset", req.Dataset, "err", err)
+		return ""
+	}
+	return suggestion
+}
+
+// withDefaults fills in the server's default dataset and that dataset's
+// topK, sparse weight, metric and minimum score. The tenant of ctx, if any,
+// replaces the default dataset and topK, caps the topK and rejects the
+// datasets of other tenants. A Version replaces Dataset with the dataset
+// holding that version. Applying it to its own result changes nothing.
+func (s *Server) withDefaults(ctx context.Context, req searchRequest) (searchRequest, error) {
+	if req.defaulted {
+		return req, nil
+	}
+	defaults := s.Defaults()
+	tenant := tenantFrom(ctx)
+	if tenant != nil {
+		dataset, err := tenant.dataset(req.Dataset)
+		if err != nil {
+			return req, err
+		}
+		req.Dataset = dataset
+	}
+	if req.Dataset == "" {
+		req.Dataset = defaults.Dataset
+	}
+	settings := defaults.forDataset(req.Dataset)
+	if req.TopK <= 0 && tenant != nil {
+		req.TopK = tenant.TopK
+	}
+	if req.TopK <= 0 {
+		req.TopK = settings.TopK
+	}
+	if tenant != nil && tenant.MaxTopK > 0 {
+		req.TopK = min(req.TopK, tenant.MaxTopK)
+	}
+	if req.SparseWeight == nil {
+		sparseWeight := settings.SparseWeight
+		req.SparseWeight = &sparseWeight
+	}
+	req.Metric = settings.Metric
+	req.MinScore = settings.MinScore
+	req.ScorePrecision = settings.ScorePrecision
+	if req.ScoreNormalization == "" {
+		req.ScoreNormalization = settings.ScoreNormalization
+	}
+	req.StrictFilters = settings.StrictFilters
+	req.FieldBoosts = settings.FieldBoosts
+	req.Stopwords = settings.Stopwords
+	req.TermBoosts = settings.TermBoosts
+	req.Languages = settings.Languages
+	if req.Version != "" {
+		if s.cfg.DatasetVersion == nil {
+			return req, errVersionsUnsupported
+		}
+		table, err := s.cfg.DatasetVersion(ctx, req.Dataset, req.Version)
+		if err != nil {
+			return req, err
+		}
+		req.Dataset = table
+	}
+	req.defaulted = true
+	return req, nil
+}
+
+// errVersionsUnsupported rejects searches of a dataset version on servers
+// without Config.DatasetVersion.
+var errVersionsUnsupported = errors.New("dataset versions are not supported by this server")
+
+// errModelsUnsupported rejects searches naming a model on servers without
+// Config.Model.
+var errModelsUnsupported = errors.New("model selection is not supported by this server")
+
+// runSearch applies the server defaults to req, runs the vector, keyword or
+// filter search it asks for and records it in the query log under source.
+func (s *Server) runSearch(ctx context.Context, source string, req searchRequest) ([]search.Result, search.Timings, error) {
+	var timings search.Timings
+	start := time.Now()
+	req, err := s.withDefaults(ctx, req)
+	if err != nil {
+		s.finishSearch(source, req, start, timings, nil, err)
+		return nil, timings, err
+	}
+
+	var results []search.Result
+	if s.cfg.BeforeSearch != nil {
+		q := req.hookQuery()
+		if err := s.cfg.BeforeSearch(ctx, &q); err != nil {
+			s.finishSearch(source, req, start, timings, nil, err)
+			return nil, timings, err
+		}
+		req.Filters = q.Filters
+		if req.Keyword != "" {
+			req.Keyword = q.Query
+		} else {
+			req.Query = q.Query
+		}
+		if dataset := strings.TrimSpace(q.Dataset); dataset != "" {
+			req.Dataset = dataset
+		}
+		if q.TopK > 0 {
+			req.TopK = q.TopK
+		}
+	}
+	if req.StrictFilters && len(req.Filters) > 0 {
+		if err := s.cfg.Engine.CheckFilterFields(ctx, req.Dataset, req.Filters); err != nil {
+			s.finishSearch(source, req, start, timings, nil, err)
+			return nil, timings, err
+		}
+	}
+	switch {
+	case req.Keyword != "":
+		results, err = s.cfg.Engine.KeywordSearch(ctx, search.KeywordOptions{
+			Dataset:            req.Dataset,
+			Query:              req.Keyword,
+			TopK:               req.TopK,
+			Filters:            req.Filters,
+			IDs:                req.IDs,
+			Stopwords:          req.Stopwords,
+			Languages:          req.Languages,
+			ScorePrecision:     req.ScorePrecision,
+			ScoreNormalization: req.ScoreNormalization,
+			TieBreak:           req.TieBreak,
+			GroupBy:            req.GroupBy,
+			GroupSize:          req.GroupSize,
+			IncludeVectors:     req.IncludeVectors,
+			Timings:            &timings,
+		})
+	case req.Query == "":
+		results, err = s.cfg.Engine.FilterSearch(ctx, search.FilterOptions{
+			Dataset:        req.Dataset,
+			TopK:           req.TopK,
+			Filters:        req.Filters,
+			IDs:            req.IDs,
+			Near:           req.Near,
+			IncludeVectors: req.IncludeVectors,
+			Timings:        &timings,
+		})
+	default:
+		results, err = s.vectorSearch(ctx, req, &timings)
+	}
+	if err == nil && s.cfg.AfterSearch != nil {
+		results, err = s.cfg.AfterSearch(ctx, req.hookQuery(), results)
+	}
+	s.finishSearch(source, req, start, timings, results, err)
+	return results, timings, err
+}
+
+// vectorSearch runs req.Query through the encoder handed out by s.encoders,
+// or by Config.Model when the request names a model.
+func (s *Server) vectorSearch(ctx context.Context, req searchRequest, timings *search.Timings) ([]search.Result, error) {
+	var (
+		enc     embedding.Embedder
+		release func()
+		err     error
+	)
+	switch {
+	case req.Model == "":
+		if enc, release, err = s.encoders(); err != nil {
+			return nil, &unavailableError{err: err}
+		}
+	case s.cfg.Model == nil:
+		return nil, errModelsUnsupported
+	default:
+		if enc, release, err = s.cfg.Model(ctx, req.Dataset, req.Model); err != nil {
+			return nil, err
+		}
+	}
+	defer release()
+	// Embedders are safe for concurrent use (the ONNX encoder only
+	// serializes the session run), so concurrent requests overlap their
+	// database scans with other requests' encoding.
+	return s.cfg.Engine.VectorSearch(ctx, enc, search.Options{
+		Dataset:            req.Dataset,
+		Query:              req.Query,
+		TopK:               req.TopK,
+		Filters:            req.Filters,
+		IDs:                req.IDs,
+		SparseWeight:       *req.SparseWeight,
+		Metric:             req.Metric,
+		MinScore:           req.MinScore,
+		ScorePrecision:     req.ScorePrecision,
+		ScoreNormalization: req.ScoreNormalization,
+		TieBreak:           req.TieBreak,
+		GroupBy:            req.GroupBy,
+		GroupSize:          req.GroupSize,
+		FieldBoosts:        req.FieldBoosts,
+		TermBoosts:         req.TermBoosts,
+		Scorer:             req.Scorer,
+		Languages:          req.Languages,
+		Near:               req.Near,
+		Timings:            timings,
+		IncludeVectors:     req.IncludeVectors,
+		Progress:           req.progress,
+	})
+}
+
+// finishSearch records a search run by runSearch in the query log and reports
+// it to Config.ObserveSearch.
+func (s *Server) finishSearch(source string, req searchRequest, start time.Time, timings search.Timings, results []search.Result, err error) {
+	total := time.Since(start)
+	s.logSearch(source, req, total, results, err)
+	if s.cfg.ObserveSearch != nil {
+		s.cfg.ObserveSearch(source, req.hookQuery(), timings, total, err)
+	}
+}
+
+// hookQuery is req as seen by the hooks. A keyword search passes its keyword
+// as the query.
+func (req searchRequest) hookQuery() SearchQuery {
+	query := req.Query
+	if req.Keyword != "" {
+		query = req.Keyword
+	}
+	return SearchQuery{
+		Query:   query,
+		Dataset: req.Dataset,
+		TopK:    req.TopK,
+		Filters: append([]search.Filter(nil), req.Filters...),
+	}
+}
+
+// logSearch records a search in the query log when one is configured.
+func (s *Server) logSearch(source string, req searchRequest, latency time.Duration, results []search.Result, err error) {
+	if s.cfg.QueryLog != nil {
+		s.cfg.QueryLog.Log(queryLogEntry(source, req, latency, results, err))
+	}
+}
+
+func queryLogEntry(source string, req searchRequest, latency time.Duration, results []search.Result, err error) querylog.Entry {
+	entry := querylog.Entry{
+		Source:  source,
+		Dataset: req.Dataset,
+		Query:   req.hookQuery().Query,
+		TopK:    req.TopK,
+		Latency: latency,
+		Results: len(results),
+	}
+	if len(req.Filters) > 0 {
+		entry.Filters = make(map[string]string, len(req.Filters))
+		for _, f := range req.Filters {
+			entry.Filters[f.Label()] = f.Value
+		}
+	}
+	for i, r := range results {
+		if i == querylog.MaxTopResults {
+			break
+		}
+		entry.TopIDs = append(entry.TopIDs, r.ID)
+		entry.TopScores = append(entry.TopScores, r.Score)
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	return entry
+}
+
+// unavailableError marks failures to obtain the encoder.
+type unavailableError struct{ err error }
+
+func (e *unavailableError) Error() string { return e.err.Error() }
+func (e *unavailableError) Unwrap() error { return e.err }
+
+func searchErrorStatus(err error) int {
+	var unavailable *unavailableError
+	switch {
+	case errors.As(err, &unavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, search.ErrUnknownField):
+		return http.StatusBadRequest
+	case errors.Is(err, errDatasetForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, store.ErrVersionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errVersionsUnsupported), errors.Is(err, errModelsUnsupported), errors.Is(err, embedding.ErrUnknownModel):
+		return http.StatusBadRequest
+	case errors.Is(err, embedding.ErrModelMismatch):
+		return http.StatusConflict
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
 }
 
 func (s *Server) decodeSearchRequest(r *http.Request) (searchRequest, error) {
@@ -177,6 +865,7 @@ func (s *Server) decodeSearchRequest(r *http.Request) (searchRequest, error) {
 		if query == "" {
 			query = strings.TrimSpace(values.Get("query"))
 		}
+		keyword := strings.TrimSpace(values.Get("keyword"))
 		dataset := strings.TrimSpace(values.Get("dataset"))
 		if dataset == "" {
 			dataset = strings.TrimSpace(values.Get("table"))
@@ -222,20 +911,104 @@ func (s *Server) decodeSearchRequest(r *http.Request) (searchRequest, error) {
 			}
 			summaryOnly = v
 		}
-		return searchRequest{Query: query, Dataset: dataset, TopK: topK, Filters: filters, SummaryOnly: summaryOnly}, nil
+		var sparseWeight *float64
+		if rawWeight := strings.TrimSpace(values.Get("sparse_weight")); rawWeight != "" {
+			v, err := strconv.ParseFloat(rawWeight, 64)
+			if err != nil {
+				return searchRequest{}, fmt.Errorf("invalid sparse_weight value %q", rawWeight)
+			}
+			sparseWeight = &v
+		}
+		includeVectors := false
+		if raw := strings.TrimSpace(values.Get("include_vectors")); raw != "" {
+			v, err := strconv.ParseBool(raw)
+			if err != nil {
+				return searchRequest{}, fmt.Errorf("invalid include_vectors value %q", raw)
+			}
+			includeVectors = v
+		}
+		debug := false
+		if raw := strings.TrimSpace(values.Get("debug")); raw != "" {
+			v, err := strconv.ParseBool(raw)
+			if err != nil {
+				return searchRequest{}, fmt.Errorf("invalid debug value %q", raw)
+			}
+			debug = v
+		}
+		tieBreak := strings.TrimSpace(values.Get("tie_break"))
+		if err := search.ValidateTieBreak(tieBreak); err != nil {
+			return searchRequest{}, err
+		}
+		scoreNormalization := strings.TrimSpace(values.Get("score_normalization"))
+		if err := search.ValidateScoreNormalization(scoreNormalization); err != nil {
+			return searchRequest{}, err
+		}
+		groupSize := 0
+		if raw := strings.TrimSpace(values.Get("group_size")); raw != "" {
+			v, err := strconv.Atoi(raw)
+			if err != nil {
+				return searchRequest{}, fmt.Errorf("invalid group_size value %q", raw)
+			}
+			groupSize = v
+		}
+		groupBy := strings.TrimSpace(values.Get("group_by"))
+		if err := validateGroup(query+keyword, groupBy, groupSize); err != nil {
+			return searchRequest{}, err
+		}
+		scorer := strings.TrimSpace(values.Get("scorer"))
+		if err := validateScorer(query, scorer); err != nil {
+			return searchRequest{}, err
+		}
+		stream, err := parseStreamFormat(values.Get("stream"))
+		if err != nil {
+			return searchRequest{}, err
+		}
+		var near *search.Near
+		if raw := strings.TrimSpace(values.Get("near")); raw != "" {
+			lat, lng, err := search.ParsePoint(raw)
+			if err != nil {
+				return searchRequest{}, err
+			}
+			near = &search.Near{Lat: lat, Lng: lng}
+		}
+		if near, err = withNearOptions(near, values.Get("radius_km"), values.Get("distance_weight"), values.Get("geo_weight"), values.Get("sort")); err != nil {
+			return searchRequest{}, err
+		}
+		return searchRequest{Query: query, Keyword: keyword, Dataset: dataset, TopK: topK, Filters: filters, IDs: parseIDValues(values["ids"]), Near: near, SummaryOnly: summaryOnly, SparseWeight: sparseWeight, TieBreak: tieBreak, ScoreNormalization: scoreNormalization, GroupBy: groupBy, GroupSize: groupSize, Scorer: scorer, Stream: stream, IncludeVectors: includeVectors, Version: strings.TrimSpace(values.Get("version")), Model: strings.TrimSpace(values.Get("model")), Debug: debug}, nil
 	}
 
 	var payload struct {
-		Query          string            `json:"query"`
-		Dataset        string            `json:"dataset"`
-		Table          string            `json:"table"`
-		TopK           int               `json:"topk"`
-		MaxResults     int               `json:"max_results"`
-		MaxResultsAlt  int               `json:"maxResults"`
-		SummaryOnly    bool              `json:"summary_only"`
-		SummaryOnlyAlt bool              `json:"summaryOnly"`
-		Filters        map[string]string `json:"filters"`
-		Filter         []string          `json:"filter"`
+		Query              string            `json:"query"`
+		Keyword            string            `json:"keyword"`
+		Dataset            string            `json:"dataset"`
+		Table              string            `json:"table"`
+		TopK               int               `json:"topk"`
+		MaxResults         int               `json:"max_results"`
+		MaxResultsAlt      int               `json:"maxResults"`
+		SummaryOnly        bool              `json:"summary_only"`
+		SummaryOnlyAlt     bool              `json:"summaryOnly"`
+		Filters            map[string]string `json:"filters"`
+		Filter             []string          `json:"filter"`
+		IDs                []string          `json:"ids"`
+		SparseWeight       *float64          `json:"sparse_weight"`
+		TieBreak           string            `json:"tie_break"`
+		ScoreNormalization string            `json:"score_normalization"`
+		GroupBy            string            `json:"group_by"`
+		GroupSize          int               `json:"group_size"`
+		Scorer             string            `json:"scorer"`
+		Stream             string            `json:"stream"`
+		IncludeVectors     bool              `json:"include_vectors"`
+		Debug              bool              `json:"debug"`
+		Version            string            `json:"version"`
+		Model              string            `json:"model"`
+		Near               *struct {
+			Lat float64 `json:"lat"`
+			Lng float64 `json:"lng"`
+		} `json:"near"`
+		RadiusKm       json.Number `json:"radius_km"`
+		DistanceWeight json.Number `json:"distance_weight"`
+		GeoWeight      json.Number `json:"geo_weight"`
+		Sort           string      `json:"sort"`
 	}
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&payload); err != nil {
@@ -254,11 +1027,52 @@ func (s *Server) decodeSearchRequest(r *http.Request) (searchRequest, error) {
 			topK = payload.MaxResultsAlt
 		}
 	}
+	tieBreak := strings.TrimSpace(payload.TieBreak)
+	if err := search.ValidateTieBreak(tieBreak); err != nil {
+		return searchRequest{}, err
+	}
+	scoreNormalization := strings.TrimSpace(payload.ScoreNormalization)
+	if err := search.ValidateScoreNormalization(scoreNormalization); err != nil {
+		return searchRequest{}, err
+	}
+	groupBy := strings.TrimSpace(payload.GroupBy)
+	if err := validateGroup(payload.Query+payload.Keyword, groupBy, payload.GroupSize); err != nil {
+		return searchRequest{}, err
+	}
+	scorer := strings.TrimSpace(payload.Scorer)
+	if err := validateScorer(payload.Query, scorer); err != nil {
+		return searchRequest{}, err
+	}
+	stream, err := parseStreamFormat(payload.Stream)
+	if err != nil {
+		return searchRequest{}, err
+	}
+	var near *search.Near
+	if payload.Near != nil {
+		near = &search.Near{Lat: payload.Near.Lat, Lng: payload.Near.Lng}
+	}
+	if near, err = withNearOptions(near, payload.RadiusKm.String(), payload.DistanceWeight.String(), payload.GeoWeight.String(), payload.Sort); err != nil {
+		return searchRequest{}, err
+	}
 	req := searchRequest{
-		Query:       strings.TrimSpace(payload.Query),
-		Dataset:     dataset,
-		TopK:        topK,
-		SummaryOnly: payload.SummaryOnly || payload.SummaryOnlyAlt,
+		Query:              strings.TrimSpace(payload.Query),
+		Keyword:            strings.TrimSpace(payload.Keyword),
+		Dataset:            dataset,
+		TopK:               topK,
+		IDs:                parseIDValues(payload.IDs),
+		Near:               near,
+		SummaryOnly:        payload.SummaryOnly || payload.SummaryOnlyAlt,
+		SparseWeight:       payload.SparseWeight,
+		TieBreak:           tieBreak,
+		ScoreNormalization: scoreNormalization,
+		GroupBy:            groupBy,
+		GroupSize:          payload.GroupSize,
+		Scorer:             scorer,
+		Stream:             stream,
+		IncludeVectors:     payload.IncludeVectors,
+		Version:            strings.TrimSpace(payload.Version),
+		Model:              strings.TrimSpace(payload.Model),
+		Debug:              payload.Debug,
 	}
 	if len(payload.Filters) > 0 {
 		req.Filters = make([]search.Filter, 0, len(payload.Filters))
@@ -280,6 +1094,86 @@ func (s *Server) decodeSearchRequest(r *http.Request) (searchRequest, error) {
 	return req, nil
 }
 
+// validateGroup checks the group_by and group_size of a request with the
+// given query text: grouping collapses scored results, so it needs a query
+// or keyword.
+func validateGroup(query, field string, size int) error {
+	if err := search.ValidateGroup(field, size); err != nil {
+		return err
+	}
+	if field != "" && strings.TrimSpace(query) == "" {
+		return fmt.Errorf("group_by requires a query or keyword")
+	}
+	return nil
+}
+
+// validateScorer checks the scorer of a request with the given query text:
+// scorers rescore the results of a vector search, so they need a query.
+func validateScorer(query, name string) error {
+	if err := search.ValidateScorer(name); err != nil {
+		return err
+	}
+	if name != "" && strings.TrimSpace(query) == "" {
+		return fmt.Errorf("scorer requires a query")
+	}
+	return nil
+}
+
+// withNearOptions applies the radius, distance and geo weights and sort
+// order of a request to near, which they require.
+func withNearOptions(near *search.Near, radius, weight, geoWeight, order string) (*search.Near, error) {
+	radius, weight, geoWeight, order = strings.TrimSpace(radius), strings.TrimSpace(weight), strings.TrimSpace(geoWeight), strings.TrimSpace(order)
+	if near == nil {
+		if radius != "" || weight != "" || geoWeight != "" || order == "distance" {
+			return nil, fmt.Errorf("radius_km, distance_weight, geo_weight and sort=distance require near")
+		}
+	} else {
+		if radius != "" {
+			v, err := strconv.ParseFloat(radius, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid radius_km value %q", radius)
+			}
+			near.RadiusKm = v
+		}
+		if weight != "" {
+			v, err := strconv.ParseFloat(weight, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid distance_weight value %q", weight)
+			}
+			near.Weight = v
+		}
+		if geoWeight != "" {
+			v, err := strconv.ParseFloat(geoWeight, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid geo_weight value %q", geoWeight)
+			}
+			near.GeoWeight = v
+		}
+		near.SortByDistance = order == "distance"
+		if err := near.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	switch order {
+	case "", "score", "distance":
+	default:
+		return nil, fmt.Errorf("invalid sort value %q (want score or distance)", order)
+	}
+	return near, nil
+}
+
+// parseIDValues returns the trimmed ids of a search restriction, without
+// empty ones.
+func parseIDValues(values []string) []string {
+	var ids []string
+	for _, raw := range values {
+		if id := strings.TrimSpace(raw); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
 func parseFilterValues(values []string) ([]search.Filter, error) {
 	if len(values) == 0 {
 		return nil, nil
@@ -290,15 +1184,11 @@ func parseFilterValues(values []string) ([]search.Filter, error) {
 		if trimmed == "" {
 			continue
 		}
-		parts := strings.SplitN(trimmed, "=", 2)
-		if len(parts) != 2 {
-			return nil, fmt.Errorf("filter must be in the form field=value")
-		}
-		field := strings.TrimSpace(parts[0])
-		if field == "" {
-			return nil, fmt.Errorf("filter field must not be empty")
+		filter, err := search.ParseFilter(trimmed)
+		if err != nil {
+			return nil, err
 		}
-		filters = append(filters, search.Filter{Field: field, Value: parts[1]})
+		filters = append(filters, filter)
 	}
 	return filters, nil
 }
@@ -311,7 +1201,7 @@ func (s *Server) writeJSON(w http.ResponseWriter, status int, v any) {
 		encoder.SetIndent("", "  ")
 	}
 	if err := encoder.Encode(v); err != nil {
-		log.Printf("writeJSON encode error: %v\n", err)
+		s.log.Warn("writeJSON encode error", "err", err)
 	}
 }
 
@@ -319,10 +1209,14 @@ func (s *Server) writeError(w http.ResponseWriter, status int, err error) {
 	if err == nil {
 		err = fmt.Errorf("unknown error")
 	}
-	payload := map[string]string{"error": err.Error()}
+	payload := map[string]any{"error": err.Error()}
+	var unknown *search.UnknownFieldError
+	if errors.As(err, &unknown) {
+		payload["valid_fields"] = unknown.Valid
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	if encodeErr := json.NewEncoder(w).Encode(payload); encodeErr != nil {
-		log.Printf("writeError encode error: %v\n", encodeErr)
+		s.log.Warn("writeError encode error", "err", encodeErr)
 	}
 }
@@ -1,12 +1,51 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"yashubustudio/csv-search/internal/database"
+	"yashubustudio/csv-search/internal/embedding"
+	"yashubustudio/csv-search/internal/search"
+	"yashubustudio/csv-search/internal/vector"
 )
 
+// newTestDB returns an initialized database in a temporary directory that
+// is closed when the test ends.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := database.Open(filepath.Join(t.TempDir(), "server.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.Init(context.Background(), db); err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	return db
+}
+
 func TestDecodeSearchRequestPostMaxResults(t *testing.T) {
 	s := &Server{}
 	body := `{"query":"テスト","dataset":"textile_jobs","max_results":2,"summary_only":true,"filters":{"得意先名":"艶栄工業㈱"}}`
@@ -56,3 +95,1319 @@ func TestDecodeSearchRequestGetMaxResults(t *testing.T) {
 		t.Fatalf("expected SummaryOnly=true")
 	}
 }
+
+func TestDecodeSearchRequestSparseWeight(t *testing.T) {
+	s := &Server{}
+	req := httptest.NewRequest(http.MethodGet, "/search?q=hello&sparse_weight=0.25", nil)
+
+	decoded, err := s.decodeSearchRequest(req)
+	if err != nil {
+		t.Fatalf("decodeSearchRequest returned error: %v", err)
+	}
+	if decoded.SparseWeight == nil || *decoded.SparseWeight != 0.25 {
+		t.Fatalf("expected SparseWeight=0.25, got %v", decoded.SparseWeight)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(`{"query":"hello"}`))
+	decoded, err = s.decodeSearchRequest(req)
+	if err != nil {
+		t.Fatalf("decodeSearchRequest returned error: %v", err)
+	}
+	if decoded.SparseWeight != nil {
+		t.Fatalf("expected SparseWeight to be unset, got %v", *decoded.SparseWeight)
+	}
+}
+
+func TestDecodeSearchRequestNear(t *testing.T) {
+	s := &Server{}
+	req := httptest.NewRequest(http.MethodGet, "/search?near=35.68,139.76&radius_km=5&sort=distance", nil)
+	decoded, err := s.decodeSearchRequest(req)
+	if err != nil {
+		t.Fatalf("decodeSearchRequest returned error: %v", err)
+	}
+	want := search.Near{Lat: 35.68, Lng: 139.76, RadiusKm: 5, SortByDistance: true}
+	if decoded.Near == nil || *decoded.Near != want {
+		t.Fatalf("expected %+v, got %+v", want, decoded.Near)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(`{"query":"hello","near":{"lat":35.68,"lng":139.76},"distance_weight":0.5,"geo_weight":0.3}`))
+	decoded, err = s.decodeSearchRequest(req)
+	if err != nil {
+		t.Fatalf("decodeSearchRequest returned error: %v", err)
+	}
+	want = search.Near{Lat: 35.68, Lng: 139.76, Weight: 0.5, GeoWeight: 0.3}
+	if decoded.Near == nil || *decoded.Near != want {
+		t.Fatalf("expected %+v, got %+v", want, decoded.Near)
+	}
+
+	for _, target := range []string{"/search?q=a&radius_km=5", "/search?near=35.68", "/search?near=91,0", "/search?near=0,0&sort=nearest", "/search?q=a&geo_weight=0.5", "/search?near=0,0&geo_weight=1.5"} {
+		if _, err := s.decodeSearchRequest(httptest.NewRequest(http.MethodGet, target, nil)); err == nil {
+			t.Fatalf("expected an error for %s", target)
+		}
+	}
+}
+
+func TestDecodeSearchRequestScorer(t *testing.T) {
+	s := &Server{}
+	for _, target := range []string{"/search?q=a&scorer=missing", "/search?filter=a=b&scorer=missing"} {
+		if _, err := s.decodeSearchRequest(httptest.NewRequest(http.MethodGet, target, nil)); err == nil {
+			t.Fatalf("expected an error for %s", target)
+		}
+	}
+	req := httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(`{"keyword":"a","scorer":"missing"}`))
+	if _, err := s.decodeSearchRequest(req); err == nil {
+		t.Fatalf("expected an error for a scorer without a query")
+	}
+}
+
+func TestAuthorizeAdmin(t *testing.T) {
+	s := &Server{}
+	req := httptest.NewRequest(http.MethodPost, "/admin/reload-model", nil)
+	req.RemoteAddr = "192.0.2.10:51234"
+	rec := httptest.NewRecorder()
+	if s.authorizeAdmin(rec, req) {
+		t.Fatalf("expected remote client to be rejected without a token")
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rec.Code)
+	}
+
+	req.RemoteAddr = "127.0.0.1:51234"
+	if !s.authorizeAdmin(httptest.NewRecorder(), req) {
+		t.Fatalf("expected loopback client to be accepted without a token")
+	}
+
+	s.cfg.AdminToken = "secret"
+	rec = httptest.NewRecorder()
+	if s.authorizeAdmin(rec, req) {
+		t.Fatalf("expected missing token to be rejected")
+	}
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rec.Code)
+	}
+
+	req.RemoteAddr = "192.0.2.10:51234"
+	req.Header.Set("Authorization", "Bearer secret")
+	if !s.authorizeAdmin(httptest.NewRecorder(), req) {
+		t.Fatalf("expected valid token to be accepted")
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	s := &Server{}
+	rec := httptest.NewRecorder()
+	s.handleOpenAPI(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var doc struct {
+		OpenAPI string                    `json:"openapi"`
+		Paths   map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode spec: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Fatalf("unexpected openapi version %q", doc.OpenAPI)
+	}
+	for _, path := range []string{"/search", "/query", "/healthz", "/openapi.json"} {
+		if _, ok := doc.Paths[path]; !ok {
+			t.Fatalf("expected %s to be documented", path)
+		}
+	}
+	if _, ok := doc.Paths["/admin/reload-model"]; ok {
+		t.Fatalf("reload endpoint must not be documented when disabled")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter(RateLimit{Rate: 10, Burst: 3, ClientRate: 1, ClientBurst: 2})
+	l.now = func() time.Time { return now }
+	l.global.last = now
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.allow("a"); !ok {
+			t.Fatalf("request %d from a should be allowed", i)
+		}
+	}
+	ok, wait := l.allow("a")
+	if ok {
+		t.Fatalf("third request from a should exceed the client burst")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Fatalf("unexpected retry delay %v", wait)
+	}
+	if ok, _ := l.allow("b"); !ok {
+		t.Fatalf("first request from b should be allowed")
+	}
+	if ok, _ := l.allow("c"); ok {
+		t.Fatalf("global burst should be exhausted")
+	}
+
+	now = now.Add(time.Second)
+	if ok, _ := l.allow("a"); !ok {
+		t.Fatalf("client bucket should refill after a second")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	tenants, err := newTenants([]Tenant{{Name: "acme", APIKeys: []string{"acme-key"}, Datasets: []string{"docs"}}})
+	if err != nil {
+		t.Fatalf("newTenants: %v", err)
+	}
+	s := &Server{limiter: newRateLimiter(RateLimit{ClientRate: 1, ClientBurst: 1}), tenants: tenants}
+	h := s.rateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(path, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do("/search?q=a", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	rec := do("/search?q=a", "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected Retry-After header")
+	}
+	// A key no tenant owns is limited by the IP address.
+	if rec := do("/search?q=a", "made-up"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected an unknown API key to share the IP bucket, got %d", rec.Code)
+	}
+	if rec := do("/search?q=a", "acme-key"); rec.Code != http.StatusOK {
+		t.Fatalf("expected a separate bucket per tenant API key, got %d", rec.Code)
+	}
+	if n := len(s.limiter.clients); n != 2 {
+		t.Fatalf("expected 2 client buckets, got %d", n)
+	}
+	if rec := do("/healthz", ""); rec.Code != http.StatusOK {
+		t.Fatalf("health checks must not be throttled, got %d", rec.Code)
+	}
+}
+
+func TestCertReloaderPicksUpRotation(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	writeTestCert(t, certFile, keyFile, "first")
+
+	r, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewCertReloader: %v", err)
+	}
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	if got := leafCommonName(t, r); got != "first" {
+		t.Fatalf("expected initial certificate, got %q", got)
+	}
+
+	writeTestCert(t, certFile, keyFile, "second")
+	future := now.Add(time.Hour)
+	if err := os.Chtimes(certFile, future, future); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	if got := leafCommonName(t, r); got != "first" {
+		t.Fatalf("expected rotation to wait for the check interval, got %q", got)
+	}
+	now = now.Add(certCheckInterval)
+	if got := leafCommonName(t, r); got != "second" {
+		t.Fatalf("expected rotated certificate, got %q", got)
+	}
+
+	if _, err := NewCertReloader(certFile, ""); err == nil {
+		t.Fatalf("expected an error when the key is missing")
+	}
+}
+
+func leafCommonName(t *testing.T, r *CertReloader) string {
+	t.Helper()
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func writeTestCert(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+}
+
+func TestSearchStreamFormats(t *testing.T) {
+	s := &Server{}
+	req := httptest.NewRequest(http.MethodGet, "/search?q=a&stream=sse", nil)
+	decoded, err := s.decodeSearchRequest(req)
+	if err != nil {
+		t.Fatalf("decodeSearchRequest returned error: %v", err)
+	}
+	if decoded.Stream != streamSSE {
+		t.Fatalf("expected sse, got %q", decoded.Stream)
+	}
+	if _, err := s.decodeSearchRequest(httptest.NewRequest(http.MethodGet, "/search?q=a&stream=xml", nil)); err == nil {
+		t.Fatalf("expected an error for an unknown stream format")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/search?q=a", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	if got := streamFormat(req, ""); got != streamNDJSON {
+		t.Fatalf("expected Accept header to select ndjson, got %q", got)
+	}
+
+	results := []search.Result{{Dataset: "d", ID: "1", Score: 0.9}, {Dataset: "d", ID: "2", Score: 0.5}}
+	rec := httptest.NewRecorder()
+	s.newResultStream(rec, streamNDJSON).finish(results, nil)
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"id":"1"`) {
+		t.Fatalf("unexpected ndjson body: %q", rec.Body.String())
+	}
+	if !rec.Flushed {
+		t.Fatalf("expected the stream to be flushed")
+	}
+
+	rec = httptest.NewRecorder()
+	s.newResultStream(rec, streamSSE).finish(results, nil)
+	body := rec.Body.String()
+	if rec.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+	if strings.Count(body, "event: result\n") != 2 || !strings.HasSuffix(body, "event: done\ndata: {\"count\":2}\n\n") {
+		t.Fatalf("unexpected sse body: %q", body)
+	}
+}
+
+func TestSearchStreamPartialResults(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	// Later records score higher against the query, so the best ones change
+	// on every vector page and every batch of scanned rows.
+	const n = 3 * database.VectorPageSize
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("%05d", i)
+		if _, err := tx.ExecContext(ctx, `INSERT INTO records(dataset, id, data) VALUES('docs', ?, '{"kind":"x"}')`, id); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO records_vec(dataset, id, embedding) VALUES('docs', ?, ?)`, id, vector.Serialize([]float32{float32(i), n})); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if _, err := database.BuildVectorPages(ctx, db, "docs"); err != nil {
+		t.Fatalf("BuildVectorPages: %v", err)
+	}
+	s, err := New(db, StaticEncoder(constEmbedder{}), Config{Dataset: "docs"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	handler := s.Handler()
+
+	// The vector pages are reported one by one; the filtered search scans
+	// the rows instead.
+	for target, partials := range map[string]int{
+		"/search?q=a&topk=2&stream=sse":                 3,
+		"/search?q=a&topk=2&stream=sse&filter=kind%3Dx": 2,
+		"/search?q=a&topk=2&stream=ndjson":              0,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		body := rec.Body.String()
+		if rec.Code != http.StatusOK || strings.Count(body, "event: partial\n") != partials {
+			t.Fatalf("%s: expected %d partial events, got %d: %.500s", target, partials, strings.Count(body, "event: partial\n"), body)
+		}
+		last := fmt.Sprintf(`"id":"%05d"`, n-1)
+		if partials > 0 && strings.Index(body, "event: partial\n") > strings.Index(body, "event: result\n") {
+			t.Fatalf("%s: expected the partial events before the results: %.500s", target, body)
+		}
+		if !strings.Contains(body, last) {
+			t.Fatalf("%s: expected the best record %s in the results: %.500s", target, last, body)
+		}
+	}
+}
+
+func TestIngestUploadJob(t *testing.T) {
+	done := make(chan IngestRequest, 1)
+	db := &sql.DB{}
+	s, err := New(db, StaticEncoder(nil), Config{
+		Ingest: func(ctx context.Context, req IngestRequest) (IngestResult, error) {
+			data, err := os.ReadFile(req.CSVPath)
+			if err != nil {
+				return IngestResult{}, err
+			}
+			if !strings.HasPrefix(string(data), "id,text") {
+				return IngestResult{}, fmt.Errorf("unexpected upload %q", data)
+			}
+			done <- req
+			return IngestResult{Dataset: req.Dataset, Table: req.Dataset, Upserted: 1}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	handler := s.Handler()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	_ = mw.WriteField("mapping", `{"dataset":"docs","text_columns":["text"]}`)
+	part, _ := mw.CreateFormFile("file", "docs.csv")
+	_, _ = part.Write([]byte("id,text\n1,hello\n"))
+	_ = mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/ingest", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.RemoteAddr = "127.0.0.1:1234"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	location := rec.Header().Get("Location")
+	if !strings.HasPrefix(location, "/ingest/") {
+		t.Fatalf("unexpected Location %q", location)
+	}
+
+	select {
+	case got := <-done:
+		if got.Dataset != "docs" || len(got.TextColumns) != 1 {
+			t.Fatalf("unexpected mapping: %+v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("ingest job did not run")
+	}
+
+	var job ingestJob
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		req := httptest.NewRequest(http.MethodGet, location, nil)
+		req.RemoteAddr = "127.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+			t.Fatalf("decode job: %v", err)
+		}
+		if job.Status == jobSucceeded || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if job.Status != jobSucceeded || job.Result == nil || job.Result.Upserted != 1 {
+		t.Fatalf("unexpected job state: %+v", job)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/ingest/missing", nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown job, got %d", rec.Code)
+	}
+}
+
+type constEmbedder struct{}
+
+func (constEmbedder) Encode(string) ([]float32, error) { return []float32{1, 0}, nil }
+func (constEmbedder) EncodeBatch(texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i := range texts {
+		out[i] = []float32{1, 0}
+	}
+	return out, nil
+}
+func (constEmbedder) Dimension() int { return 2 }
+func (constEmbedder) Close() error   { return nil }
+
+func TestWebSocketSearch(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	for _, stmt := range []string{
+		`INSERT INTO records(dataset, id, data) VALUES('docs', 'a', '{"title":"A"}'), ('docs', 'b', '{"title":"B"}')`,
+		`INSERT INTO records_vec(dataset, id, embedding) VALUES('docs', 'a', x'0000803f00000000'), ('docs', 'b', x'000000000000803f')`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	s, err := New(db, StaticEncoder(constEmbedder{}), Config{Dataset: "docs"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteJSON(map[string]any{"id": "q1", "query": "a", "topk": 2}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var got []wsResponse
+	for {
+		var msg wsResponse
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		got = append(got, msg)
+		if msg.Type != "result" {
+			break
+		}
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected 2 results and done, got %+v", got)
+	}
+	if got[0].Rank != 1 || got[0].Result == nil || got[0].Result.ID != "a" || got[0].ID != "q1" {
+		t.Fatalf("unexpected first result: %+v", got[0])
+	}
+	if got[2].Type != "done" || got[2].Count == nil || *got[2].Count != 2 {
+		t.Fatalf("unexpected final message: %+v", got[2])
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("{")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var msg wsResponse
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if msg.Type != "error" {
+		t.Fatalf("expected an error for malformed JSON, got %+v", msg)
+	}
+}
+
+func TestEmbeddedUI(t *testing.T) {
+	s := &Server{}
+	rec := httptest.NewRecorder()
+	s.handleUI(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("unexpected response: %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), `fetch("search"`) {
+		t.Fatalf("expected the page to call the search API")
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleUI(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown paths, got %d", rec.Code)
+	}
+}
+
+// rendezvousEmbedder blocks each Encode until `want` calls are in flight at
+// once, proving that searches are not serialized around the encoder.
+type rendezvousEmbedder struct {
+	constEmbedder
+	arrived chan struct{}
+	want    int
+}
+
+func (e rendezvousEmbedder) Encode(text string) ([]float32, error) {
+	e.arrived <- struct{}{}
+	for len(e.arrived) < e.want {
+		time.Sleep(time.Millisecond)
+	}
+	return e.constEmbedder.Encode(text)
+}
+
+func TestConcurrentSearches(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	const parallel = 4
+	enc := rendezvousEmbedder{arrived: make(chan struct{}, parallel), want: parallel}
+	s, err := New(db, StaticEncoder(enc), Config{Dataset: "docs"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	errs := make(chan error, parallel)
+	for i := 0; i < parallel; i++ {
+		go func() {
+			_, _, err := s.runSearch(ctx, "http", searchRequest{Query: "a"})
+			errs <- err
+		}()
+	}
+	for i := 0; i < parallel; i++ {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatalf("search: %v", err)
+			}
+		case <-ctx.Done():
+			t.Fatal("searches did not run concurrently")
+		}
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	db := newTestDB(t)
+
+	if _, err := New(db, StaticEncoder(constEmbedder{}), Config{AccessLog: &bytes.Buffer{}, AccessLogFormat: "xml"}); err == nil {
+		t.Fatalf("expected an error for an unknown access log format")
+	}
+
+	var buf bytes.Buffer
+	s, err := New(db, StaticEncoder(constEmbedder{}), Config{Dataset: "docs", AccessLog: &buf, AccessLogFormat: AccessLogJSON})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	handler := s.Handler()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/search?q=a", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 access log lines, got %q", buf.String())
+	}
+	var entry accessEntry
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("decode access log: %v", err)
+	}
+	if entry.Method != http.MethodGet || entry.Path != "/search" || entry.Query != "q=a" || entry.Status != http.StatusOK || entry.Bytes == 0 {
+		t.Fatalf("unexpected search entry: %+v", entry)
+	}
+	if entry.EncodeMS == nil || entry.ScanMS == nil {
+		t.Fatalf("expected the search latency breakdown, got %s", lines[0])
+	}
+	if strings.Contains(lines[1], "encode_ms") || !strings.Contains(lines[1], `"path":"/healthz"`) {
+		t.Fatalf("unexpected health entry: %s", lines[1])
+	}
+
+	buf.Reset()
+	s.access.format = AccessLogCommon
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if line := buf.String(); !strings.Contains(line, `"GET /missing HTTP/1.1" 404 `) || !strings.HasPrefix(line, "192.0.2.1 - - [") {
+		t.Fatalf("unexpected common log line: %q", line)
+	}
+}
+
+// blockingEmbedder signals started and then blocks each Encode until release
+// is closed.
+type blockingEmbedder struct {
+	constEmbedder
+	started chan struct{}
+	release chan struct{}
+}
+
+func (e blockingEmbedder) Encode(text string) ([]float32, error) {
+	e.started <- struct{}{}
+	<-e.release
+	return e.constEmbedder.Encode(text)
+}
+
+func TestMaxInFlight(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	enc := blockingEmbedder{started: make(chan struct{}, 4), release: make(chan struct{})}
+	s, err := New(db, StaticEncoder(enc), Config{Dataset: "docs", MaxInFlight: 1, MaxQueue: 1})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	handler := s.Handler()
+
+	codes := make(chan int, 2)
+	serve := func() {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?q=a", nil))
+		codes <- rec.Code
+	}
+	go serve()
+	<-enc.started
+	go serve() // queued behind the first request
+	for s.inflight.queued.Load() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?q=a", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 503 with Retry-After once the queue is full, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected health checks to bypass the limit, got %d", rec.Code)
+	}
+
+	drainCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := s.active.wait(drainCtx); err == nil {
+		t.Fatalf("expected draining to wait for the running requests")
+	}
+
+	close(enc.release)
+	for i := 0; i < 2; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Fatalf("expected queued requests to succeed, got %d", code)
+		}
+	}
+	if err := s.active.wait(ctx); err != nil || s.active.count() != 0 {
+		t.Fatalf("expected no requests in flight, got %d (%v)", s.active.count(), err)
+	}
+}
+
+// countingEmbedder counts Encode calls.
+type countingEmbedder struct {
+	constEmbedder
+	calls *atomic.Int64
+}
+
+func (e countingEmbedder) Encode(text string) ([]float32, error) {
+	e.calls.Add(1)
+	return e.constEmbedder.Encode(text)
+}
+
+func TestSearchCacheAndETag(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	if _, err := db.ExecContext(ctx, `INSERT INTO records(dataset, id, data) VALUES('docs', 'a', '{"city":"tokyo"}')`); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO records_vec(dataset, id, embedding) VALUES('docs', 'a', x'0000803f00000000')`); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	var calls atomic.Int64
+	s, err := New(db, StaticEncoder(countingEmbedder{calls: &calls}), Config{Dataset: "docs", CacheTTL: time.Minute})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	handler := s.Handler()
+	get := func(target, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := get("/search?q=a&filter=city=tokyo", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Header().Get("Cache-Control") != "private, max-age=60" {
+		t.Fatalf("unexpected first response: %d %v", first.Code, first.Header())
+	}
+	second := get("/search?q=a&filter=city=tokyo&topk=10", "")
+	if second.Body.String() != first.Body.String() || calls.Load() != 1 {
+		t.Fatalf("expected the identical query to be served from cache (encodes=%d)", calls.Load())
+	}
+	if rec := get("/search?q=a&filter=city=tokyo", etag); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("expected 304 for a matching If-None-Match, got %d", rec.Code)
+	}
+	if get("/search?q=b", ""); calls.Load() != 2 {
+		t.Fatalf("expected a different query to miss the cache (encodes=%d)", calls.Load())
+	}
+
+	s.cache.Purge()
+	if rec := get("/search?q=a&filter=city=tokyo", etag); rec.Code != http.StatusNotModified || calls.Load() != 3 {
+		t.Fatalf("expected a recomputed response with the same ETag, got %d (encodes=%d)", rec.Code, calls.Load())
+	}
+}
+
+func TestDatasetCaches(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	for _, dataset := range []string{"docs", "live"} {
+		if _, err := db.ExecContext(ctx, `INSERT INTO records(dataset, id, data) VALUES(?, 'a', '{}')`, dataset); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+		if _, err := db.ExecContext(ctx, `INSERT INTO records_vec(dataset, id, embedding) VALUES(?, 'a', x'0000803f00000000')`, dataset); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	var calls atomic.Int64
+	s, err := New(db, StaticEncoder(countingEmbedder{calls: &calls}), Config{
+		Dataset:  "docs",
+		CacheTTL: time.Minute,
+		DatasetCaches: map[string]DatasetCache{
+			"docs": {TTL: 5 * time.Minute, Size: 10, BypassHeader: "X-Fresh"},
+			"live": {},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	handler := s.Handler()
+	get := func(target string, fresh bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if fresh {
+			req.Header.Set("X-Fresh", "1")
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	expect := func(want int64, msg string) {
+		t.Helper()
+		if got := calls.Load(); got != want {
+			t.Fatalf("%s: encodes=%d, want %d", msg, got, want)
+		}
+	}
+
+	first := get("/search?q=a", false)
+	if first.Code != http.StatusOK || first.Header().Get("Cache-Control") != "private, max-age=300" {
+		t.Fatalf("unexpected first response: %d %v", first.Code, first.Header())
+	}
+	get("/search?q=a", false)
+	expect(1, "repeated search")
+	if s.cache.Len() != 0 {
+		t.Fatalf("expected the dataset's responses to stay out of the global cache")
+	}
+	get("/search?q=a", true)
+	expect(2, "bypass header")
+	get("/search?q=a", false)
+	expect(2, "search after bypass")
+
+	if rec := get("/search?q=a&dataset=live", false); rec.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("expected an uncached dataset to be revalidated, got %v", rec.Header())
+	}
+	get("/search?q=a&dataset=live", false)
+	expect(4, "dataset without cache")
+
+	s.PurgeDatasetCaches("live")
+	get("/search?q=a", false)
+	expect(4, "purge of another dataset")
+	s.PurgeDatasetCaches("docs")
+	get("/search?q=a", false)
+	expect(5, "purge of the dataset")
+}
+
+func TestSearchDebug(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	for _, rec := range []struct{ id, data string }{{"a", `{"kind":"x"}`}, {"b", `{"kind":"x"}`}, {"c", `{"kind":"y"}`}} {
+		if _, err := db.ExecContext(ctx, `INSERT INTO records(dataset, id, data) VALUES('docs', ?, ?)`, rec.id, rec.data); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+		if _, err := db.ExecContext(ctx, `INSERT INTO records_vec(dataset, id, embedding) VALUES('docs', ?, x'0000803f00000000')`, rec.id); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	s, err := New(db, StaticEncoder(constEmbedder{}), Config{Dataset: "docs", CacheTTL: time.Minute})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	handler := s.Handler()
+	get := func(target string) (*httptest.ResponseRecorder, searchDebug, int) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", target, rec.Code, rec.Body)
+		}
+		var body struct {
+			Results []search.Result `json:"results"`
+			Debug   *searchDebug    `json:"debug"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Debug == nil {
+			t.Fatalf("%s: expected a debug response, got %s (%v)", target, rec.Body, err)
+		}
+		return rec, *body.Debug, len(body.Results)
+	}
+
+	rec, debug, results := get("/search?q=a&filter=kind%3Dx&topk=1&debug=true")
+	if results != 1 || debug.CandidatesScanned != 2 || debug.CandidatesMatched != 2 || debug.CacheHit || debug.ScanMS < debug.SortMS {
+		t.Fatalf("unexpected debug block %+v with %d results", debug, results)
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" || rec.Header().Get("ETag") != "" {
+		t.Fatalf("expected debug responses to be uncacheable, got %v", rec.Header())
+	}
+	if _, debug, results = get("/search?q=a&filter=kind%3Dx&topk=1&debug=1"); results != 1 || !debug.CacheHit || debug.CandidatesScanned != 0 {
+		t.Fatalf("expected a cache hit, got %+v with %d results", debug, results)
+	}
+	// The debug flag does not change the plain response of the same search.
+	plain := httptest.NewRecorder()
+	handler.ServeHTTP(plain, httptest.NewRequest(http.MethodGet, "/search?q=a&filter=kind%3Dx&topk=1", nil))
+	var list []search.Result
+	if err := json.Unmarshal(plain.Body.Bytes(), &list); err != nil || len(list) != 1 {
+		t.Fatalf("expected a plain result array, got %s (%v)", plain.Body, err)
+	}
+	if _, debug, _ = get("/search?keyword=a&debug=true"); debug.CandidatesScanned != 0 || debug.CacheHit {
+		t.Fatalf("unexpected keyword debug block %+v", debug)
+	}
+}
+
+func TestVersionEndpoint(t *testing.T) {
+	db := newTestDB(t)
+
+	srv, err := New(db, StaticEncoder(constEmbedder{}), Config{DisableUI: true})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected /version to be absent without Config.Version, got %d", rec.Code)
+	}
+
+	srv, err = New(db, StaticEncoder(constEmbedder{}), Config{DisableUI: true, Version: func() VersionInfo {
+		return VersionInfo{Version: "v1.2.3", Commit: "abc123", GoVersion: "go1.24", Platform: "linux/amd64", OnnxRuntime: "1.21.0"}
+	}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	var got VersionInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Version != "v1.2.3" || got.Commit != "abc123" || got.OnnxRuntime != "1.21.0" {
+		t.Fatalf("unexpected version info: %+v", got)
+	}
+}
+
+func TestEmbedEndpoint(t *testing.T) {
+	var got EmbedRequest
+	s := &Server{cfg: Config{RequestTimeout: time.Second, Embed: func(ctx context.Context, req EmbedRequest) ([]Embedding, error) {
+		got = req
+		out := make([]Embedding, len(req.Texts))
+		for i, text := range req.Texts {
+			out[i] = Embedding{Text: text, Dimension: 2, Vector: []float32{float32(len(text)), 1}, Tokens: len(text)}
+		}
+		return out, nil
+	}}}
+
+	rec := httptest.NewRecorder()
+	s.handleEmbed(rec, httptest.NewRequest(http.MethodPost, "/embed", strings.NewReader(`{"text":"abc","texts":["hello"],"sparse":true}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	var embeddings []Embedding
+	if err := json.Unmarshal(rec.Body.Bytes(), &embeddings); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(embeddings) != 2 || embeddings[0].Text != "abc" || embeddings[1].Vector[0] != 5 || embeddings[1].Tokens != 5 || !got.Sparse {
+		t.Fatalf("unexpected response %+v for request %+v", embeddings, got)
+	}
+
+	for _, body := range []string{`{}`, `{"texts":["a",""]}`, `{"texts":[` + strings.Repeat(`"a",`, maxEmbedTexts) + `"a"]}`} {
+		rec = httptest.NewRecorder()
+		s.handleEmbed(rec, httptest.NewRequest(http.MethodPost, "/embed", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %.40s, got %d", body, rec.Code)
+		}
+	}
+}
+
+func TestSearchWithoutEncoder(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	for _, stmt := range []string{
+		`INSERT INTO records(rowid, dataset, id, data) VALUES(1, 'docs', 'a', '{"city":"tokyo"}'), (2, 'docs', 'b', '{"city":"osaka"}')`,
+		`INSERT INTO records_fts(rowid, dataset, id, content) VALUES(1, 'docs', 'a', 'tokyo tower'), (2, 'docs', 'b', 'osaka castle')`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	noEncoder := func() (embedding.Embedder, func(), error) {
+		return nil, nil, fmt.Errorf("encoder configuration is incomplete")
+	}
+	s, err := New(db, noEncoder, Config{Dataset: "docs"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	handler := s.Handler()
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+	ids := func(rec *httptest.ResponseRecorder) []string {
+		var results []search.Result
+		if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+			t.Fatalf("decode %q: %v", rec.Body.String(), err)
+		}
+		var ids []string
+		for _, r := range results {
+			ids = append(ids, r.ID)
+		}
+		return ids
+	}
+
+	if rec := get("/search?filter=city=osaka"); rec.Code != http.StatusOK || strings.Join(ids(rec), ",") != "b" {
+		t.Fatalf("unexpected filter-only response: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := get("/search?keyword=tokyo"); rec.Code != http.StatusOK || strings.Join(ids(rec), ",") != "a" || rec.Header().Get("X-Did-You-Mean") != "" {
+		t.Fatalf("unexpected keyword response: %d %s %v", rec.Code, rec.Body.String(), rec.Header())
+	}
+	if rec := get("/search?keyword=Tokio+towr"); rec.Code != http.StatusOK || len(ids(rec)) != 0 || rec.Header().Get("X-Did-You-Mean") != "tokyo tower" {
+		t.Fatalf("expected a suggestion for the misspelt keyword, got %d %v", rec.Code, rec.Header())
+	}
+	if rec := get("/search?q=tokyo"); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 for a vector search, got %d", rec.Code)
+	}
+	if rec := get("/search"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without query, keyword or filter, got %d", rec.Code)
+	}
+	if rec := get("/search?q=a&keyword=b"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for both query and keyword, got %d", rec.Code)
+	}
+}
+
+func TestStrictFilters(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	if _, err := db.ExecContext(ctx, `INSERT INTO records(dataset, id, data) VALUES('docs', 'a', '{"category":"cafe","city":"tokyo"}'), ('docs', 'b', '{"category":"bar"}')`); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	noEncoder := func() (embedding.Embedder, func(), error) {
+		return nil, nil, fmt.Errorf("encoder configuration is incomplete")
+	}
+	s, err := New(db, noEncoder, Config{Dataset: "docs", DatasetDefaults: map[string]SearchDefaults{"docs": {StrictFilters: true}}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	handler := s.Handler()
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	if rec := get("/search?filter=city=tokyo"); rec.Code != http.StatusOK {
+		t.Fatalf("expected a known field to be accepted, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec := get("/search?filter=catagory=cafe")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown field, got %d %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Error       string   `json:"error"`
+		ValidFields []string `json:"valid_fields"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	if !strings.Contains(body.Error, `"catagory"`) || strings.Join(body.ValidFields, ",") != "category,city" {
+		t.Fatalf("unexpected error body: %s", rec.Body.String())
+	}
+
+	// Other datasets keep matching nothing.
+	if rec := get("/search?dataset=other&filter=catagory=cafe"); rec.Code != http.StatusOK {
+		t.Fatalf("expected non-strict datasets to accept any field, got %d", rec.Code)
+	}
+}
+
+func TestAnswer(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	for _, stmt := range []string{
+		`INSERT INTO records(rowid, dataset, id, data) VALUES(1, 'docs', 'a', '{"name":"Tokyo Tower"}'), (2, 'docs', 'b', '{"name":"Osaka Castle"}')`,
+		`INSERT INTO records_fts(rowid, dataset, id, content) VALUES(1, 'docs', 'a', 'tokyo tower'), (2, 'docs', 'b', 'osaka castle')`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	var gotQuestion string
+	var gotIDs []string
+	answer := func(ctx context.Context, question string, results []search.Result) (Answer, error) {
+		if question == "fail" {
+			return Answer{}, fmt.Errorf("model unavailable")
+		}
+		gotQuestion = question
+		gotIDs = nil
+		for _, r := range results {
+			gotIDs = append(gotIDs, r.ID)
+		}
+		return Answer{Text: "It is in Tokyo [a].", Citations: []string{"a"}, Model: "test"}, nil
+	}
+	noEncoder := func() (embedding.Embedder, func(), error) {
+		return nil, nil, fmt.Errorf("encoder configuration is incomplete")
+	}
+	s, err := New(db, noEncoder, Config{Dataset: "docs", Answer: answer})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	handler := s.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/answer", strings.NewReader(`{"keyword":"tokyo"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Query     string          `json:"query"`
+		Answer    string          `json:"answer"`
+		Citations []string        `json:"citations"`
+		Model     string          `json:"model"`
+		Results   []search.Result `json:"results"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	if body.Query != "tokyo" || body.Answer != "It is in Tokyo [a]." || strings.Join(body.Citations, ",") != "a" || body.Model != "test" ||
+		len(body.Results) != 1 || body.Results[0].ID != "a" {
+		t.Fatalf("unexpected answer: %s", rec.Body.String())
+	}
+	if gotQuestion != "tokyo" || strings.Join(gotIDs, ",") != "a" {
+		t.Fatalf("answer got %q with %v", gotQuestion, gotIDs)
+	}
+
+	for target, want := range map[string]int{
+		"/answer":                             http.StatusBadRequest,
+		"/answer?keyword=tokyo&stream=ndjson": http.StatusBadRequest,
+		"/answer?keyword=fail":                http.StatusBadGateway,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != want {
+			t.Fatalf("%s: expected %d, got %d %s", target, want, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Without Config.Answer the endpoint does not exist.
+	plain, err := New(db, noEncoder, Config{Dataset: "docs", DisableUI: true})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	rec = httptest.NewRecorder()
+	plain.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/answer?keyword=tokyo", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without an answerer, got %d", rec.Code)
+	}
+}
+
+func TestFeedback(t *testing.T) {
+	db := newTestDB(t)
+
+	var got []FeedbackRequest
+	feedback := func(ctx context.Context, req FeedbackRequest) error {
+		got = append(got, req)
+		return nil
+	}
+	noEncoder := func() (embedding.Embedder, func(), error) {
+		return nil, nil, fmt.Errorf("encoder configuration is incomplete")
+	}
+	s, err := New(db, noEncoder, Config{Dataset: "docs", Feedback: feedback, DisableUI: true})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	handler := s.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/feedback",
+		strings.NewReader(`{"query":" tokyo ","id":"b","position":2,"results":["a","b"]}`)))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d %s", rec.Code, rec.Body.String())
+	}
+	if len(got) != 1 || got[0].Query != "tokyo" || got[0].Dataset != "docs" || got[0].ID != "b" || got[0].Position != 2 ||
+		strings.Join(got[0].Shown, ",") != "a,b" {
+		t.Fatalf("unexpected feedback %+v", got)
+	}
+
+	for body, want := range map[string]int{
+		`{"id":"b"}`:        http.StatusBadRequest,
+		`{"query":"tokyo"}`: http.StatusBadRequest,
+		`{"query":"tokyo","id":"b","position":-1}`: http.StatusBadRequest,
+		`not json`: http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/feedback", strings.NewReader(body)))
+		if rec.Code != want {
+			t.Fatalf("%s: expected %d, got %d", body, want, rec.Code)
+		}
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/feedback", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for GET, got %d", rec.Code)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected invalid feedback to be rejected, got %+v", got)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	for _, stmt := range []string{
+		`INSERT INTO records(rowid, dataset, id, data) VALUES(1, 'docs', 'a', '{}'), (2, 'docs', 'b', '{}'), (3, 'docs', 'c', '{}'), (4, 'other', 'd', '{}')`,
+		`INSERT INTO records_fts(rowid, dataset, id, content) VALUES
+                        (1, 'docs', 'a', 'Tokyo Tower'), (2, 'docs', 'b', 'Tokyo tour, tokyo'), (3, 'docs', 'c', '東京タワー'), (4, 'other', 'd', 'town tower toy')`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	noEncoder := func() (embedding.Embedder, func(), error) {
+		return nil, nil, fmt.Errorf("encoder configuration is incomplete")
+	}
+	s, err := New(db, noEncoder, Config{Dataset: "docs"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	get := func(target string) (*httptest.ResponseRecorder, []string) {
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var resp suggestResponse
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode %q: %v", rec.Body.String(), err)
+			}
+		}
+		var out []string
+		for _, c := range resp.Suggestions {
+			out = append(out, fmt.Sprintf("%s:%d", c.Text, c.Count))
+		}
+		return rec, out
+	}
+
+	for target, want := range map[string]string{
+		"/suggest?q=to":                 "tokyo:2,tour:1,tower:1",
+		"/suggest?q=Visit+TO&limit=1":   "Visit tokyo:2",
+		"/suggest?q=%E6%9D%B1%E4%BA%AC": "東京タワー:1",
+		"/suggest?q=tow&dataset=other":  "tower:1,town:1",
+		"/suggest?q=xyz":                "",
+	} {
+		rec, got := get(target)
+		if rec.Code != http.StatusOK || strings.Join(got, ",") != want {
+			t.Fatalf("GET %s: %d %v, want %q", target, rec.Code, got, want)
+		}
+	}
+	for _, target := range []string{"/suggest", "/suggest?q=to&limit=0", "/suggest?q=to&limit=x"} {
+		if rec, _ := get(target); rec.Code != http.StatusBadRequest {
+			t.Fatalf("GET %s: expected 400, got %d", target, rec.Code)
+		}
+	}
+}
+
+func TestTenants(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	for _, stmt := range []string{
+		`INSERT INTO records(rowid, dataset, id, data) VALUES(1, 'docs', 'a', '{}'), (2, 'docs', 'b', '{}'), (3, 'other', 'c', '{}')`,
+		`INSERT INTO records_fts(rowid, dataset, id, content) VALUES(1, 'docs', 'a', 'tokyo tower'), (2, 'docs', 'b', 'tokyo tour'), (3, 'other', 'c', 'tokyo town')`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	noEncoder := func() (embedding.Embedder, func(), error) {
+		return nil, nil, fmt.Errorf("encoder configuration is incomplete")
+	}
+	s, err := New(db, noEncoder, Config{Dataset: "other", Tenants: []Tenant{
+		{Name: "acme", APIKeys: []string{"acme-key"}, Datasets: []string{"docs"}, TopK: 1, MaxTopK: 1},
+		{Name: "globex", Datasets: []string{"other"}, Rate: 0.001, Burst: 1},
+	}})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	handler := s.Handler()
+	get := func(target string, header ...string) (*httptest.ResponseRecorder, []string) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var ids []string
+		if rec.Code == http.StatusOK && strings.HasPrefix(target, "/search") {
+			var results []search.Result
+			if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+				t.Fatalf("decode %q: %v", rec.Body.String(), err)
+			}
+			for _, r := range results {
+				ids = append(ids, r.ID)
+			}
+		}
+		return rec, ids
+	}
+
+	if rec, _ := get("/search?keyword=tokyo"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a tenant, got %d", rec.Code)
+	}
+	if rec, _ := get("/search?keyword=tokyo", "X-Tenant", "acme"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("a tenant with API keys must not be selected by name, got %d", rec.Code)
+	}
+	if rec, _ := get("/healthz"); rec.Code != http.StatusOK {
+		t.Fatalf("health checks must stay open, got %d", rec.Code)
+	}
+	// The tenant's default dataset and topK apply, and its cap wins over the
+	// request.
+	for _, target := range []string{"/search?keyword=tokyo", "/search?keyword=tokyo&topk=5"} {
+		rec, ids := get(target, "Authorization", "Bearer acme-key")
+		if rec.Code != http.StatusOK || len(ids) != 1 || (ids[0] != "a" && ids[0] != "b") {
+			t.Fatalf("GET %s as acme: %d %v", target, rec.Code, ids)
+		}
+	}
+	for _, target := range []string{"/search?keyword=tokyo&dataset=other", "/suggest?q=to&dataset=other"} {
+		if rec, _ := get(target, "X-API-Key", "acme-key"); rec.Code != http.StatusForbidden {
+			t.Fatalf("GET %s as acme: expected 403, got %d", target, rec.Code)
+		}
+	}
+	rec, ids := get("/search?keyword=tokyo", "X-Tenant", "globex")
+	if rec.Code != http.StatusOK || strings.Join(ids, ",") != "c" {
+		t.Fatalf("GET as globex: %d %v", rec.Code, ids)
+	}
+	rec, _ = get("/search?keyword=tokyo", "X-Tenant", "globex")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected the tenant quota to answer 429 with Retry-After, got %d", rec.Code)
+	}
+	if rec, _ := get("/search?keyword=tokyo", "X-API-Key", "acme-key"); rec.Code != http.StatusOK {
+		t.Fatalf("quotas must be per tenant, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"yashubustudio/csv-search/internal/search"
+)
+
+// Streaming formats for search responses.
+const (
+	streamNDJSON = "ndjson"
+	streamSSE    = "sse"
+)
+
+func parseStreamFormat(raw string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "", "false", "0", "none":
+		return "", nil
+	case streamNDJSON, "jsonl", "true", "1":
+		return streamNDJSON, nil
+	case streamSSE, "event-stream":
+		return streamSSE, nil
+	}
+	return "", fmt.Errorf("invalid stream value %q (use ndjson or sse)", raw)
+}
+
+// streamFormat resolves the response mode from the explicit request field and
+// falls back to the Accept header.
+func streamFormat(r *http.Request, requested string) string {
+	if requested != "" {
+		return requested
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/x-ndjson", "application/jsonl":
+			return streamNDJSON
+		case "text/event-stream":
+			return streamSSE
+		}
+	}
+	return ""
+}
+
+// resultStream writes a streamed search response. The headers go out with
+// the first event, so that a search failing before it still gets an error
+// status.
+type resultStream struct {
+	w       http.ResponseWriter
+	flusher *http.ResponseController
+	format  string
+	log     *slog.Logger
+	started bool
+	// failed is set once a write failed, e.g. because the client went away.
+	failed bool
+}
+
+func (s *Server) newResultStream(w http.ResponseWriter, format string) *resultStream {
+	return &resultStream{w: w, flusher: http.NewResponseController(w), format: format, log: s.log}
+}
+
+func (st *resultStream) start() {
+	if st.started {
+		return
+	}
+	st.started = true
+	header := st.w.Header()
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	if st.format == streamSSE {
+		header.Set("Content-Type", "text/event-stream")
+	} else {
+		header.Set("Content-Type", "application/x-ndjson")
+	}
+	st.w.WriteHeader(http.StatusOK)
+}
+
+// event writes value as an SSE event called name, or as an NDJSON line, and
+// flushes it.
+func (st *resultStream) event(name, id string, value any) {
+	if st.failed {
+		return
+	}
+	payload, err := json.Marshal(value)
+	if err != nil {
+		st.log.Warn("stream encode error", "err", err)
+		st.failed = true
+		return
+	}
+	st.start()
+	switch {
+	case st.format != streamSSE:
+		_, err = fmt.Fprintf(st.w, "%s\n", payload)
+	case id != "":
+		_, err = fmt.Fprintf(st.w, "event: %s\nid: %s\ndata: %s\n\n", name, id, payload)
+	default:
+		_, err = fmt.Fprintf(st.w, "event: %s\ndata: %s\n\n", name, payload)
+	}
+	if err != nil {
+		// The client went away.
+		st.failed = true
+		return
+	}
+	_ = st.flusher.Flush()
+}
+
+// partial sends the provisional results of a search that is still running
+// (see search.Options.Progress) as an SSE "partial" event holding the whole
+// list, which replaces the one sent before. NDJSON has no way to tell such
+// a list from the results, so it only carries the final ones.
+func (st *resultStream) partial(results []search.Result) {
+	if st.format == streamSSE {
+		st.event("partial", "", results)
+	}
+}
+
+// fail ends a stream whose search failed after it started, with an SSE
+// "error" event or an NDJSON line holding the error.
+func (st *resultStream) fail(err error) {
+	st.event("error", "", map[string]string{"error": err.Error()})
+}
+
+// finish sends the final results one record at a time, flushing after each
+// so that clients can process them without buffering the whole array. SSE
+// streams end with a "done" event carrying the result count, preceded by a
+// "debug" event when debug is set.
+func (st *resultStream) finish(results []search.Result, debug *searchDebug) {
+	st.start()
+	for i, result := range results {
+		st.event("result", strconv.Itoa(i+1), result)
+	}
+	if st.format == streamSSE {
+		if debug != nil {
+			st.event("debug", "", debug)
+		}
+		st.event("done", "", map[string]int{"count": len(results)})
+	}
+}
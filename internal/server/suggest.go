@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"yashubustudio/csv-search/internal/search"
+)
+
+// maxCompletions caps the limit parameter of GET /suggest.
+const maxCompletions = 100
+
+// suggestResponse is the GET /suggest response.
+type suggestResponse struct {
+	Query       string              `json:"query"`
+	Dataset     string              `json:"dataset"`
+	Suggestions []search.Completion `json:"suggestions"`
+}
+
+func (s *Server) handleSuggest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	values := r.URL.Query()
+	query := strings.TrimSpace(values.Get("q"))
+	if query == "" {
+		query = strings.TrimSpace(values.Get("query"))
+	}
+	if query == "" {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("q is required"))
+		return
+	}
+	dataset := strings.TrimSpace(values.Get("dataset"))
+	if dataset == "" {
+		dataset = strings.TrimSpace(values.Get("table"))
+	}
+	if tenant := tenantFrom(r.Context()); tenant != nil {
+		var err error
+		if dataset, err = tenant.dataset(dataset); err != nil {
+			s.writeError(w, http.StatusForbidden, err)
+			return
+		}
+	}
+	if dataset == "" {
+		dataset = s.Defaults().Dataset
+	}
+	limit := 10
+	if raw := strings.TrimSpace(values.Get("limit")); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 || v > maxCompletions {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d, got %q", maxCompletions, raw))
+			return
+		}
+		limit = v
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.RequestTimeout)
+	defer cancel()
+	completions, err := s.cfg.Engine.Complete(ctx, search.CompleteOptions{Dataset: dataset, Query: query, Limit: limit})
+	if err != nil {
+		s.writeError(w, searchErrorStatus(err), err)
+		return
+	}
+	if completions == nil {
+		completions = []search.Completion{}
+	}
+	s.writeJSON(w, http.StatusOK, suggestResponse{Query: query, Dataset: dataset, Suggestions: completions})
+}
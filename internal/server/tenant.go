@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tenantHeader selects a tenant without API keys.
+const tenantHeader = "X-Tenant"
+
+// Tenant confines the requests of one customer to its own datasets (see
+// Config.Tenants).
+type Tenant struct {
+	Name string
+	// APIKeys identify the tenant's requests (X-API-Key header or bearer
+	// token). A tenant without keys is selected by the X-Tenant header.
+	APIKeys []string
+	// Datasets are the tables the tenant may search; Dataset is searched when
+	// a request names none (the first of Datasets when empty).
+	Datasets []string
+	Dataset  string
+	// TopK replaces the dataset's default topK and MaxTopK caps the topK of
+	// every request (no cap when zero).
+	TopK    int
+	MaxTopK int
+	// Rate and Burst are the tenant's request quota (unlimited when zero).
+	Rate  float64
+	Burst int
+}
+
+// errDatasetForbidden rejects a dataset outside the tenant's.
+var errDatasetForbidden = errors.New("dataset not available to this tenant")
+
+// tenantState is a Tenant with its quota.
+type tenantState struct {
+	Tenant
+	allowed map[string]bool
+
+	mu     sync.Mutex
+	bucket *tokenBucket
+}
+
+// tenants resolves requests to the configured tenants.
+type tenants struct {
+	byKey  map[string]*tenantState
+	byName map[string]*tenantState
+}
+
+func newTenants(list []Tenant) (*tenants, error) {
+	if len(list) == 0 {
+		return nil, nil
+	}
+	t := &tenants{byKey: make(map[string]*tenantState), byName: make(map[string]*tenantState)}
+	now := time.Now()
+	for _, tenant := range list {
+		tenant.Name = strings.TrimSpace(tenant.Name)
+		if tenant.Name == "" {
+			return nil, fmt.Errorf("tenant name must not be empty")
+		}
+		if len(tenant.Datasets) == 0 {
+			return nil, fmt.Errorf("tenant %s: at least one dataset is required", tenant.Name)
+		}
+		state := &tenantState{Tenant: tenant, allowed: make(map[string]bool, len(tenant.Datasets))}
+		for _, dataset := range tenant.Datasets {
+			state.allowed[strings.TrimSpace(dataset)] = true
+		}
+		state.Dataset = strings.TrimSpace(state.Dataset)
+		if state.Dataset == "" {
+			state.Dataset = strings.TrimSpace(tenant.Datasets[0])
+		}
+		if !state.allowed[state.Dataset] {
+			return nil, fmt.Errorf("tenant %s: default dataset %q is not one of its datasets", tenant.Name, state.Dataset)
+		}
+		if tenant.Rate > 0 {
+			state.bucket = newTokenBucket(tenant.Rate, tenant.Burst, now)
+		}
+		if _, ok := t.byName[tenant.Name]; ok {
+			return nil, fmt.Errorf("tenant %s is configured twice", tenant.Name)
+		}
+		t.byName[tenant.Name] = state
+		for _, key := range tenant.APIKeys {
+			key = strings.TrimSpace(key)
+			if key == "" {
+				continue
+			}
+			if other, ok := t.byKey[key]; ok {
+				return nil, fmt.Errorf("tenant %s: API key is also used by tenant %s", tenant.Name, other.Name)
+			}
+			t.byKey[key] = state
+		}
+	}
+	return t, nil
+}
+
+// resolve returns the tenant of r: the owner of its API key or, for tenants
+// without keys, the one named by the X-Tenant header.
+func (t *tenants) resolve(r *http.Request) *tenantState {
+	if key := apiKey(r); key != "" {
+		return t.byKey[key]
+	}
+	if name := strings.TrimSpace(r.Header.Get(tenantHeader)); name != "" {
+		if state, ok := t.byName[name]; ok && len(state.APIKeys) == 0 {
+			return state
+		}
+	}
+	return nil
+}
+
+// allow takes a request from the tenant's quota and otherwise reports how long
+// to wait before retrying.
+func (t *tenantState) allow() (bool, time.Duration) {
+	if t.bucket == nil {
+		return true, 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.bucket.take(time.Now())
+}
+
+// dataset resolves the dataset of a tenant's request, rejecting the datasets
+// of other tenants.
+func (t *tenantState) dataset(requested string) (string, error) {
+	if requested == "" {
+		return t.Dataset, nil
+	}
+	if !t.allowed[requested] {
+		return "", fmt.Errorf("%w: %s", errDatasetForbidden, requested)
+	}
+	return requested, nil
+}
+
+type tenantKey struct{}
+
+// tenantFrom returns the tenant of a request, or nil when the server has
+// none.
+func tenantFrom(ctx context.Context) *tenantState {
+	t, _ := ctx.Value(tenantKey{}).(*tenantState)
+	return t
+}
+
+// tenantAuth attributes every API request to a tenant and enforces the
+// tenant's quota. Health checks, the OpenAPI document, metrics and the search
+// page are open, and the admin and ingest endpoints keep their admin
+// authorization.
+func (s *Server) tenantAuth(next http.Handler) http.Handler {
+	if s.tenants == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path := r.URL.Path; {
+		case path == "/healthz", path == "/version", path == "/openapi.json", path == "/metrics", path == "/",
+			path == "/ingest", strings.HasPrefix(path, "/ingest/"), strings.HasPrefix(path, "/admin/"):
+			next.ServeHTTP(w, r)
+			return
+		}
+		tenant := s.tenants.resolve(r)
+		if tenant == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="csv-search"`)
+			s.writeError(w, http.StatusUnauthorized, fmt.Errorf("a tenant API key is required"))
+			return
+		}
+		if ok, wait := tenant.allow(); !ok {
+			seconds := max(int(math.Ceil(wait.Seconds())), 1)
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			s.writeError(w, http.StatusTooManyRequests, fmt.Errorf("tenant quota exceeded, retry after %ds", seconds))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantKey{}, tenant)))
+	})
+}
+
+// tenantDatasets keeps the entries of datasets the tenant of ctx may search.
+func tenantDatasets(ctx context.Context, datasets []DatasetInfo) []DatasetInfo {
+	tenant := tenantFrom(ctx)
+	if tenant == nil {
+		return datasets
+	}
+	out := datasets[:0]
+	for _, ds := range datasets {
+		if tenant.allowed[ds.Table] {
+			ds.Default = ds.Table == tenant.Dataset
+			out = append(out, ds)
+		}
+	}
+	return out
+}
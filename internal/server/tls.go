@@ -0,0 +1,122 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval limits how often the certificate files are stat'ed for
+// rotation during TLS handshakes.
+const certCheckInterval = 10 * time.Second
+
+// CertReloader serves a certificate/key pair from disk and picks up rotated
+// files without a restart. A rotation that fails to load keeps the previous
+// certificate in use.
+type CertReloader struct {
+	// Logger receives reload messages (slog.Default() when nil).
+	Logger *slog.Logger
+
+	certFile string
+	keyFile  string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	certMod   time.Time
+	keyMod    time.Time
+	lastCheck time.Time
+	now       func() time.Time
+}
+
+// NewCertReloader loads the certificate pair once so that configuration errors
+// surface before the server starts listening.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("both a TLS certificate and key are required")
+	}
+	r := &CertReloader{certFile: certFile, keyFile: keyFile, now: time.Now}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.maybeReload()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// TLSConfig returns a server configuration backed by the reloader.
+func (r *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+func (r *CertReloader) maybeReload() {
+	now := r.now()
+	r.mu.RLock()
+	due := now.Sub(r.lastCheck) >= certCheckInterval
+	r.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	certMod, keyMod, err := r.modTimes()
+	r.mu.Lock()
+	r.lastCheck = now
+	changed := err == nil && (!certMod.Equal(r.certMod) || !keyMod.Equal(r.keyMod))
+	r.mu.Unlock()
+	if !changed {
+		return
+	}
+	if err := r.reload(); err != nil {
+		r.logger().Error("TLS certificate reload failed, keeping the previous certificate", "err", err)
+		return
+	}
+	r.logger().Info("TLS certificate reloaded", "cert", r.certFile)
+}
+
+func (r *CertReloader) logger() *slog.Logger {
+	if r.Logger != nil {
+		return r.Logger
+	}
+	return slog.Default()
+}
+
+func (r *CertReloader) reload() error {
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS certificate: %w", err)
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.certMod = certMod
+	r.keyMod = keyMod
+	r.lastCheck = r.now()
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *CertReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("stat TLS certificate: %w", err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("stat TLS key: %w", err)
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// indexHTML is the search page served at "/". It only talks to the public
+// API (/datasets and /search).
+//
+//go:embed web/index.html
+var indexHTML []byte
+
+func (s *Server) handleUI(w http.ResponseWriter, r *http.Request) {
+	// "/" is the catch-all pattern of the mux.
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	_, _ = w.Write(indexHTML)
+}
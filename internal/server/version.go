@@ -0,0 +1,22 @@
+package server
+
+import "net/http"
+
+// VersionInfo is the GET /version response.
+type VersionInfo struct {
+	Version          string `json:"version"`
+	Commit           string `json:"commit,omitempty"`
+	BuildDate        string `json:"build_date,omitempty"`
+	GoVersion        string `json:"go_version"`
+	Platform         string `json:"platform"`
+	OnnxRuntime      string `json:"onnx_runtime,omitempty"`
+	OnnxRuntimeError string `json:"onnx_runtime_error,omitempty"`
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, s.cfg.Version())
+}
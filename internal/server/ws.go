@@ -0,0 +1,261 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"yashubustudio/csv-search/internal/search"
+)
+
+const (
+	wsMaxMessageBytes = 64 << 10
+	wsPongWait        = 60 * time.Second
+	wsPingInterval    = 30 * time.Second
+	wsWriteWait       = 10 * time.Second
+)
+
+// wsRequest is a client message on /ws. A "search" message (the default type)
+// supersedes any search still running on the connection, which suits
+// as-you-type frontends; "cancel" stops the running search.
+type wsRequest struct {
+	Type           string            `json:"type"`
+	ID             string            `json:"id"`
+	Query          string            `json:"query"`
+	Dataset        string            `json:"dataset"`
+	Table          string            `json:"table"`
+	TopK           int               `json:"topk"`
+	Filters        map[string]string `json:"filters"`
+	SparseWeight   *float64          `json:"sparse_weight"`
+	TieBreak       string            `json:"tie_break"`
+	IncludeVectors bool              `json:"include_vectors"`
+}
+
+// wsResponse is a server message on /ws: one "result" per hit in rank order,
+// then "done", or "error".
+type wsResponse struct {
+	Type       string         `json:"type"`
+	ID         string         `json:"id,omitempty"`
+	Rank       int            `json:"rank,omitempty"`
+	Result     *search.Result `json:"result,omitempty"`
+	Count      *int           `json:"count,omitempty"`
+	TookMS     float64        `json:"took_ms,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	RetryAfter int            `json:"retry_after,omitempty"`
+}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// wsConn serializes writes and tracks the search currently running on a
+// connection.
+type wsConn struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	current uint64
+	cancel  context.CancelFunc
+}
+
+func (c *wsConn) send(msg wsResponse) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return c.conn.WriteJSON(msg)
+}
+
+// start cancels the running search and returns the context and generation
+// for a new one.
+func (c *wsConn) start(parent context.Context, timeout time.Duration) (context.Context, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	c.current++
+	c.cancel = cancel
+	return ctx, c.current
+}
+
+func (c *wsConn) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
+	c.current++
+}
+
+// isCurrent reports whether gen is still the latest search on the connection.
+func (c *wsConn) isCurrent(gen uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.current == gen
+}
+
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade already wrote the error response.
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// Deferred calls run in reverse: stop the running search, then wait for
+	// it to return before the connection is closed.
+	var searches sync.WaitGroup
+	defer searches.Wait()
+	c := &wsConn{conn: conn}
+	defer c.stop()
+	clientKey := s.rateLimitKey(r)
+	tenant := tenantFrom(r.Context())
+
+	conn.SetReadLimit(wsMaxMessageBytes)
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	go s.wsKeepAlive(ctx, c)
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) && !errors.Is(err, net.ErrClosed) {
+				s.log.Warn("websocket read error", "err", err)
+			}
+			return
+		}
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			_ = c.send(wsResponse{Type: "error", Error: "invalid message: " + err.Error()})
+			continue
+		}
+
+		switch strings.ToLower(strings.TrimSpace(req.Type)) {
+		case "cancel":
+			c.stop()
+			continue
+		case "", "search":
+		default:
+			_ = c.send(wsResponse{Type: "error", ID: req.ID, Error: "unknown message type " + req.Type})
+			continue
+		}
+
+		query := strings.TrimSpace(req.Query)
+		if query == "" {
+			// An emptied search box clears the running search.
+			c.stop()
+			continue
+		}
+		if err := search.ValidateTieBreak(req.TieBreak); err != nil {
+			_ = c.send(wsResponse{Type: "error", ID: req.ID, Error: err.Error()})
+			continue
+		}
+		if s.limiter != nil {
+			if ok, wait := s.limiter.allow(clientKey); !ok {
+				_ = c.send(wsResponse{Type: "error", ID: req.ID, Error: "rate limit exceeded", RetryAfter: int(wait.Seconds()) + 1})
+				continue
+			}
+		}
+		if tenant != nil {
+			if ok, wait := tenant.allow(); !ok {
+				_ = c.send(wsResponse{Type: "error", ID: req.ID, Error: "tenant quota exceeded", RetryAfter: int(wait.Seconds()) + 1})
+				continue
+			}
+		}
+
+		sreq := searchRequest{
+			Query:          query,
+			Dataset:        strings.TrimSpace(req.Dataset),
+			TopK:           req.TopK,
+			SparseWeight:   req.SparseWeight,
+			TieBreak:       strings.TrimSpace(req.TieBreak),
+			IncludeVectors: req.IncludeVectors,
+		}
+		if sreq.Dataset == "" {
+			sreq.Dataset = strings.TrimSpace(req.Table)
+		}
+		for field, value := range req.Filters {
+			if field = strings.TrimSpace(field); field != "" {
+				sreq.Filters = append(sreq.Filters, search.Filter{Field: field, Value: value})
+			}
+		}
+
+		searchCtx, gen := c.start(ctx, s.cfg.RequestTimeout)
+		searches.Add(1)
+		go func(id string) {
+			defer searches.Done()
+			s.wsSearch(searchCtx, c, gen, id, sreq)
+		}(req.ID)
+	}
+}
+
+func (s *Server) wsSearch(ctx context.Context, c *wsConn, gen uint64, id string, req searchRequest) {
+	start := time.Now()
+	results, timings, err := s.runSearch(ctx, "ws", req)
+	if !c.isCurrent(gen) {
+		// A newer query superseded this one; drop its results.
+		return
+	}
+	if err != nil {
+		_ = c.send(wsResponse{Type: "error", ID: id, Error: err.Error()})
+		return
+	}
+	s.metrics.observeSearch(0, timings, time.Since(start), len(results))
+
+	for i := range results {
+		if !c.isCurrent(gen) {
+			return
+		}
+		if err := c.send(wsResponse{Type: "result", ID: id, Rank: i + 1, Result: &results[i]}); err != nil {
+			return
+		}
+	}
+	count := len(results)
+	_ = c.send(wsResponse{Type: "done", ID: id, Count: &count, TookMS: float64(time.Since(start).Microseconds()) / 1000})
+}
+
+// wsKeepAlive pings the client until the connection ends and closes it when
+// the server shuts down (hijacked connections are not closed by Shutdown).
+func (s *Server) wsKeepAlive(ctx context.Context, c *wsConn) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	var shutdown <-chan struct{}
+	if s.baseCtx != nil {
+		shutdown = s.baseCtx.Done()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-shutdown:
+			c.writeMu.Lock()
+			_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(wsWriteWait))
+			c.writeMu.Unlock()
+			c.conn.Close()
+			return
+		case <-ticker.C:
+			c.writeMu.Lock()
+			err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+			c.writeMu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// DatasetStats summarises what is stored for one dataset.
+type DatasetStats struct {
+	Dataset string `json:"dataset"`
+	Rows    int64  `json:"rows"`
+	Vectors int64  `json:"vectors"`
+	Sparse  int64  `json:"sparse"`
+	FTS     int64  `json:"fts"`
+	Geo     int64  `json:"geo"`
+	// Dimension is the largest embedding dimension stored for the dataset.
+	Dimension int64 `json:"dimension"`
+}
+
+// Datasets returns per-dataset row counts for every dataset in the database,
+// ordered by name.
+func Datasets(ctx context.Context, db *sql.DB) ([]DatasetStats, error) {
+	if db == nil {
+		return nil, fmt.Errorf("db is nil")
+	}
+	stats := make(map[string]*DatasetStats)
+	get := func(dataset string) *DatasetStats {
+		s := stats[dataset]
+		if s == nil {
+			s = &DatasetStats{Dataset: dataset}
+			stats[dataset] = s
+		}
+		return s
+	}
+
+	counts := []struct {
+		query string
+		field func(*DatasetStats) *int64
+	}{
+		{`SELECT dataset, COUNT(*) FROM records GROUP BY dataset`, func(s *DatasetStats) *int64 { return &s.Rows }},
+		{`SELECT dataset, COUNT(*) FROM records_vec GROUP BY dataset`, func(s *DatasetStats) *int64 { return &s.Vectors }},
+		{`SELECT dataset, COUNT(*) FROM records_sparse GROUP BY dataset`, func(s *DatasetStats) *int64 { return &s.Sparse }},
+		{`SELECT dataset, COUNT(*) FROM records_fts GROUP BY dataset`, func(s *DatasetStats) *int64 { return &s.FTS }},
+		{`SELECT dataset, MAX(length(embedding)) / 4 FROM records_vec GROUP BY dataset`, func(s *DatasetStats) *int64 { return &s.Dimension }},
+		{`SELECT r.dataset, COUNT(*) FROM records_rtree AS g INNER JOIN records AS r ON r.rowid = g.rowid GROUP BY r.dataset`, func(s *DatasetStats) *int64 { return &s.Geo }},
+	}
+	for _, c := range counts {
+		if err := scanCounts(ctx, db, c.query, func(dataset string, n int64) {
+			*c.field(get(dataset)) = n
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]DatasetStats, 0, len(stats))
+	for _, s := range stats {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Dataset < out[j].Dataset })
+	return out, nil
+}
+
+func scanCounts(ctx context.Context, db *sql.DB, query string, fn func(dataset string, n int64)) error {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			dataset string
+			n       int64
+		)
+		if err := rows.Scan(&dataset, &n); err != nil {
+			return err
+		}
+		fn(dataset, n)
+	}
+	return rows.Err()
+}
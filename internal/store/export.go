@@ -0,0 +1,212 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"yashubustudio/csv-search/internal/vector"
+)
+
+// ExportedRecord is a stored row with its indexed text and, optionally, its
+// embeddings and the model that produced them.
+type ExportedRecord struct {
+	Record
+	Text      string            `json:"text,omitempty"`
+	Embedding []float32         `json:"embedding,omitempty"`
+	Model     string            `json:"model,omitempty"`
+	Sparse    map[int32]float32 `json:"sparse,omitempty"`
+}
+
+// Each calls fn for every record in dataset in insertion order. Embeddings are
+// only loaded when withEmbeddings is set.
+func Each(ctx context.Context, db *sql.DB, dataset string, withEmbeddings bool, fn func(ExportedRecord) error) error {
+	if db == nil {
+		return fmt.Errorf("db is nil")
+	}
+	dataset = normalizeDataset(dataset)
+
+	query := `
+                SELECT r.id, r.data, r.lat, r.lng, f.content, NULL, NULL, NULL
+                FROM records AS r
+                LEFT JOIN records_fts AS f ON f.rowid = r.rowid
+                WHERE r.dataset = ?
+                ORDER BY r.rowid`
+	if withEmbeddings {
+		query = `
+                SELECT r.id, r.data, r.lat, r.lng, f.content, v.embedding, v.model, s.weights
+                FROM records AS r
+                LEFT JOIN records_fts AS f ON f.rowid = r.rowid
+                LEFT JOIN records_vec AS v
+                        ON r.dataset = v.dataset AND r.id = v.id
+                LEFT JOIN records_sparse AS s
+                        ON r.dataset = s.dataset AND r.id = s.id
+                WHERE r.dataset = ?
+                ORDER BY r.rowid`
+	}
+	rows, err := db.QueryContext(ctx, query, dataset)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			rec        = ExportedRecord{Record: Record{Dataset: dataset}}
+			data       string
+			lat, lng   sql.NullFloat64
+			text       sql.NullString
+			blob       []byte
+			model      sql.NullString
+			sparseBlob []byte
+		)
+		if err := rows.Scan(&rec.ID, &data, &lat, &lng, &text, &blob, &model, &sparseBlob); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(data), &rec.Fields); err != nil {
+			return fmt.Errorf("decode metadata for %s: %w", rec.ID, err)
+		}
+		rec.Text, rec.Model = text.String, model.String
+		if lat.Valid {
+			v := lat.Float64
+			rec.Lat = &v
+		}
+		if lng.Valid {
+			v := lng.Float64
+			rec.Lng = &v
+		}
+		if len(blob) > 0 {
+			if rec.Embedding, err = vector.Deserialize(blob); err != nil {
+				return fmt.Errorf("decode embedding for %s: %w", rec.ID, err)
+			}
+		}
+		if len(sparseBlob) > 0 {
+			if rec.Sparse, err = vector.DeserializeSparse(sparseBlob); err != nil {
+				return fmt.Errorf("decode sparse weights for %s: %w", rec.ID, err)
+			}
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// FieldNames returns the sorted union of metadata field names in dataset.
+func FieldNames(ctx context.Context, db *sql.DB, dataset string) ([]string, error) {
+	if db == nil {
+		return nil, fmt.Errorf("db is nil")
+	}
+	rows, err := db.QueryContext(ctx, `
+                SELECT DISTINCT j.key
+                FROM records AS r, json_each(r.data) AS j
+                WHERE r.dataset = ?
+                ORDER BY j.key`, normalizeDataset(dataset))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// VectorDimensions returns the number of embeddings stored for dataset and
+// their distinct dimensions in ascending order.
+func VectorDimensions(ctx context.Context, db *sql.DB, dataset string) (int, []int, error) {
+	if db == nil {
+		return 0, nil, fmt.Errorf("db is nil")
+	}
+	rows, err := db.QueryContext(ctx, `
+                SELECT length(embedding) / 4, COUNT(*)
+                FROM records_vec
+                WHERE dataset = ?
+                GROUP BY 1
+                ORDER BY 1`, normalizeDataset(dataset))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+	var (
+		total int
+		dims  []int
+	)
+	for rows.Next() {
+		var dim, count int
+		if err := rows.Scan(&dim, &count); err != nil {
+			return 0, nil, err
+		}
+		total += count
+		dims = append(dims, dim)
+	}
+	return total, dims, rows.Err()
+}
+
+// VectorModels returns the models recorded with the embeddings of dataset,
+// sorted. Embeddings stored without a model are not counted.
+func VectorModels(ctx context.Context, db *sql.DB, dataset string) ([]string, error) {
+	if db == nil {
+		return nil, fmt.Errorf("db is nil")
+	}
+	rows, err := db.QueryContext(ctx, `
+                SELECT DISTINCT model
+                FROM records_vec
+                WHERE dataset = ? AND model IS NOT NULL AND model != ''
+                ORDER BY 1`, normalizeDataset(dataset))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var models []string
+	for rows.Next() {
+		var model string
+		if err := rows.Scan(&model); err != nil {
+			return nil, err
+		}
+		models = append(models, model)
+	}
+	return models, rows.Err()
+}
+
+// EachVector calls fn with the ID and embedding of every record in dataset
+// that has one, in insertion order.
+func EachVector(ctx context.Context, db *sql.DB, dataset string, fn func(id string, embedding []float32) error) error {
+	if db == nil {
+		return fmt.Errorf("db is nil")
+	}
+	rows, err := db.QueryContext(ctx, `
+                SELECT r.id, v.embedding
+                FROM records AS r
+                JOIN records_vec AS v
+                        ON r.dataset = v.dataset AND r.id = v.id
+                WHERE r.dataset = ?
+                ORDER BY r.rowid`, normalizeDataset(dataset))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id   string
+			blob []byte
+		)
+		if err := rows.Scan(&id, &blob); err != nil {
+			return err
+		}
+		embedding, err := vector.Deserialize(blob)
+		if err != nil {
+			return fmt.Errorf("decode embedding for %s: %w", id, err)
+		}
+		if err := fn(id, embedding); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,207 @@
+// Package store provides record-level access to the SQLite tables populated
+// by the ingest package.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a record does not exist.
+var ErrNotFound = errors.New("record not found")
+
+// Record is a stored row without its embedding.
+type Record struct {
+	Dataset string            `json:"dataset"`
+	ID      string            `json:"id"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	Lat     *float64          `json:"lat,omitempty"`
+	Lng     *float64          `json:"lng,omitempty"`
+}
+
+// Get loads a single record by dataset and id.
+func Get(ctx context.Context, db *sql.DB, dataset, id string) (Record, error) {
+	if db == nil {
+		return Record{}, fmt.Errorf("db is nil")
+	}
+	dataset = normalizeDataset(dataset)
+	var (
+		rec  = Record{Dataset: dataset, ID: id}
+		data string
+		lat  sql.NullFloat64
+		lng  sql.NullFloat64
+	)
+	err := db.QueryRowContext(ctx, `SELECT data, lat, lng FROM records WHERE dataset = ? AND id = ?`, dataset, id).Scan(&data, &lat, &lng)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Record{}, fmt.Errorf("%s/%s: %w", dataset, id, ErrNotFound)
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	if err := json.Unmarshal([]byte(data), &rec.Fields); err != nil {
+		return Record{}, fmt.Errorf("decode metadata for %s: %w", id, err)
+	}
+	if lat.Valid {
+		v := lat.Float64
+		rec.Lat = &v
+	}
+	if lng.Valid {
+		v := lng.Float64
+		rec.Lng = &v
+	}
+	return rec, nil
+}
+
+// SetFields sets metadata fields of a record, keeping the others, and marks
+// it updated. The text and embedding of the record are left alone, so fields
+// that feed the full-text index only change there on the next ingest. It
+// returns ErrNotFound when the record does not exist.
+func SetFields(ctx context.Context, db *sql.DB, dataset, id string, fields map[string]string) error {
+	if db == nil {
+		return fmt.Errorf("db is nil")
+	}
+	dataset = normalizeDataset(dataset)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var data string
+	err = tx.QueryRowContext(ctx, `SELECT data FROM records WHERE dataset = ? AND id = ?`, dataset, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s/%s: %w", dataset, id, ErrNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	var current map[string]string
+	if err := json.Unmarshal([]byte(data), &current); err != nil {
+		return fmt.Errorf("decode metadata for %s: %w", id, err)
+	}
+	if current == nil {
+		current = make(map[string]string, len(fields))
+	}
+	for field, value := range fields {
+		current[field] = value
+	}
+	buf, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE records SET data = ?, updated_at = ? WHERE dataset = ? AND id = ?`,
+		string(buf), time.Now().UnixMilli(), dataset, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete removes the given ids from dataset together with their embedding,
+// full-text and spatial index entries. It returns the number of records that
+// existed and were removed.
+func Delete(ctx context.Context, db *sql.DB, dataset string, ids []string) (int64, error) {
+	deleted, err := DeleteIDs(ctx, db, dataset, ids)
+	return int64(len(deleted)), err
+}
+
+// DeleteIDs is Delete returning the IDs of the records that existed and were
+// removed.
+func DeleteIDs(ctx context.Context, db *sql.DB, dataset string, ids []string) ([]string, error) {
+	if db == nil {
+		return nil, fmt.Errorf("db is nil")
+	}
+	dataset = normalizeDataset(dataset)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var deleted []string
+	for _, id := range ids {
+		n, err := deleteRecord(ctx, tx, dataset, id)
+		if err != nil {
+			return nil, fmt.Errorf("delete %s: %w", id, err)
+		}
+		if n > 0 {
+			deleted = append(deleted, id)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	tx = nil
+	return deleted, nil
+}
+
+func deleteRecord(ctx context.Context, tx *sql.Tx, dataset, id string) (int64, error) {
+	return deleteRecords(ctx, tx, dataset, ` AND id = ?`, id)
+}
+
+// ClearDataset deletes every record of dataset in tx together with every
+// table derived from them, including the vector pages of the dataset. It
+// returns the number of records deleted.
+func ClearDataset(ctx context.Context, tx *sql.Tx, dataset string) (int64, error) {
+	return deleteRecords(ctx, tx, normalizeDataset(dataset), "")
+}
+
+// deleteRecords deletes the records of dataset that match cond, a condition
+// on the id column appended to "WHERE dataset = ?" with its args (every
+// record when empty), and their rows in every derived table: embeddings,
+// lexical weights, full-text and trigram entries and spatial index entries.
+// Clearing the dataset also drops its vector pages; otherwise the pages of
+// the deleted records are left stale for database.UpdateVectorPages.
+func deleteRecords(ctx context.Context, tx *sql.Tx, dataset, cond string, args ...any) (int64, error) {
+	args = append([]any{dataset}, args...)
+	// The virtual tables are keyed by the records rowid. records_vec and
+	// records_sparse also follow through ON DELETE CASCADE; deleting them
+	// here keeps the list of derived tables in one place.
+	rowids := `SELECT rowid FROM records WHERE dataset = ?` + cond
+	for _, query := range []string{
+		`DELETE FROM records_fts WHERE rowid IN (` + rowids + `)`,
+		`DELETE FROM records_fts_trigram WHERE rowid IN (` + rowids + `)`,
+		`DELETE FROM records_rtree WHERE rowid IN (` + rowids + `)`,
+		`DELETE FROM records_vec WHERE dataset = ?` + cond,
+		`DELETE FROM records_sparse WHERE dataset = ?` + cond,
+	} {
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return 0, err
+		}
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM records WHERE dataset = ?`+cond, args...)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil || cond != "" {
+		return deleted, err
+	}
+	for _, query := range []string{
+		`DELETE FROM records_vec_pages WHERE dataset = ?`,
+		`DELETE FROM records_vec_pages_stale WHERE dataset = ?`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, dataset); err != nil {
+			return 0, err
+		}
+	}
+	return deleted, nil
+}
+
+func normalizeDataset(dataset string) string {
+	dataset = strings.TrimSpace(dataset)
+	if dataset == "" {
+		return "default"
+	}
+	return dataset
+}
@@ -0,0 +1,224 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"yashubustudio/csv-search/internal/database"
+)
+
+func TestGetAndDelete(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.Open(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := database.Init(ctx, db); err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+
+	if _, err := db.ExecContext(ctx, `INSERT INTO records(dataset, id, data, lat, lng) VALUES('docs', 'a', '{"title":"A"}', 35.6, 139.7)`); err != nil {
+		t.Fatalf("insert record: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO records_vec(dataset, id, embedding) VALUES('docs', 'a', x'0000803f')`); err != nil {
+		t.Fatalf("insert vector: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO records_fts(rowid, dataset, id, content) SELECT rowid, dataset, id, 'A' FROM records`); err != nil {
+		t.Fatalf("insert fts: %v", err)
+	}
+	if _, err := database.BuildTrigramIndex(ctx, db, "docs"); err != nil {
+		t.Fatalf("build trigram index: %v", err)
+	}
+
+	rec, err := Get(ctx, db, "docs", "a")
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if rec.Fields["title"] != "A" || rec.Lat == nil || *rec.Lat != 35.6 {
+		t.Fatalf("unexpected record: %+v", rec)
+	}
+
+	deleted, err := Delete(ctx, db, "docs", []string{"a", "missing"})
+	if err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	if deleted != 1 {
+		t.Fatalf("expected 1 deleted record, got %d", deleted)
+	}
+	if _, err := Get(ctx, db, "docs", "a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after delete, got %v", err)
+	}
+	for _, table := range []string{"records_vec", "records_fts", "records_fts_trigram"} {
+		var n int
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table).Scan(&n); err != nil {
+			t.Fatalf("count %s: %v", table, err)
+		}
+		if n != 0 {
+			t.Fatalf("expected %s to be empty, found %d rows", table, n)
+		}
+	}
+}
+
+func TestClearDataset(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.Open(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := database.Init(ctx, db); err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	for _, stmt := range []string{
+		`INSERT INTO records(dataset, id, data, lat, lng) VALUES('docs', 'a', '{}', 35.6, 139.7), ('docs', 'b', '{}', NULL, NULL), ('shops', 'x', '{}', 35.6, 139.7)`,
+		`INSERT INTO records_vec(dataset, id, embedding) SELECT dataset, id, x'0000803f' FROM records`,
+		`INSERT INTO records_sparse(dataset, id, weights) SELECT dataset, id, x'' FROM records`,
+		`INSERT INTO records_fts(rowid, dataset, id, content) SELECT rowid, dataset, id, 'text' FROM records`,
+		`INSERT INTO records_rtree SELECT rowid, lat, lat, lng, lng FROM records WHERE lat IS NOT NULL`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	for _, dataset := range []string{"docs", "shops"} {
+		if _, err := database.BuildTrigramIndex(ctx, db, dataset); err != nil {
+			t.Fatalf("build trigram index: %v", err)
+		}
+		if _, err := database.BuildVectorPages(ctx, db, dataset); err != nil {
+			t.Fatalf("build vector pages: %v", err)
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	removed, err := ClearDataset(ctx, tx, "docs")
+	if err != nil {
+		t.Fatalf("ClearDataset: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if removed != 2 {
+		t.Fatalf("expected 2 records removed, got %d", removed)
+	}
+	// Only the rows of the other dataset are left in every table.
+	for _, table := range []string{"records", "records_vec", "records_sparse", "records_fts", "records_fts_trigram", "records_rtree", "records_vec_pages"} {
+		var n int
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table).Scan(&n); err != nil {
+			t.Fatalf("count %s: %v", table, err)
+		}
+		if n != 1 {
+			t.Fatalf("expected 1 row left in %s, found %d", table, n)
+		}
+	}
+	var stale int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM records_vec_pages_stale`).Scan(&stale); err != nil || stale != 0 {
+		t.Fatalf("expected no stale pages, got %d (%v)", stale, err)
+	}
+}
+
+func TestDatasets(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.Open(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := database.Init(ctx, db); err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+
+	for _, stmt := range []string{
+		`INSERT INTO records(dataset, id, data, lat, lng) VALUES('docs', 'a', '{}', 35.6, 139.7), ('docs', 'b', '{}', NULL, NULL), ('shops', 'x', '{}', NULL, NULL)`,
+		`INSERT INTO records_vec(dataset, id, embedding) VALUES('docs', 'a', x'0000803f'), ('docs', 'b', x'0000803f')`,
+		`INSERT INTO records_fts(rowid, dataset, id, content) SELECT rowid, dataset, id, 'text' FROM records WHERE dataset = 'docs'`,
+		`INSERT INTO records_rtree SELECT rowid, lat, lat, lng, lng FROM records WHERE lat IS NOT NULL`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	stats, err := Datasets(ctx, db)
+	if err != nil {
+		t.Fatalf("Datasets returned error: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 datasets, got %+v", stats)
+	}
+	docs := stats[0]
+	if docs.Dataset != "docs" || docs.Rows != 2 || docs.Vectors != 2 || docs.FTS != 2 || docs.Geo != 1 || docs.Sparse != 0 {
+		t.Fatalf("unexpected docs stats: %+v", docs)
+	}
+	if stats[1].Dataset != "shops" || stats[1].Rows != 1 || stats[1].FTS != 0 {
+		t.Fatalf("unexpected shops stats: %+v", stats[1])
+	}
+}
+
+func TestVersionVectorPages(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.Open(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := database.Init(ctx, db); err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	for _, stmt := range []string{
+		`INSERT INTO records(dataset, id, data) VALUES('docs', 'a', '{}'), ('docs', 'b', '{}'), ('docs@v2', 'c', '{}')`,
+		`INSERT INTO records_vec(dataset, id, embedding) VALUES('docs', 'a', x'0000803f'), ('docs', 'b', x'0000803f'), ('docs@v2', 'c', x'0000803f')`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	for _, dataset := range []string{"docs", "docs@v2"} {
+		if _, err := database.BuildVectorPages(ctx, db, dataset); err != nil {
+			t.Fatalf("BuildVectorPages %s: %v", dataset, err)
+		}
+	}
+	if err := AddVersion(ctx, db, "docs", "v2"); err != nil {
+		t.Fatalf("AddVersion: %v", err)
+	}
+	// A page of v2 is stale before the promotion.
+	if _, err := db.ExecContext(ctx, `UPDATE records_vec SET embedding = x'00000040' WHERE dataset = 'docs@v2'`); err != nil {
+		t.Fatalf("update vector: %v", err)
+	}
+	pages := func() string {
+		t.Helper()
+		var got string
+		err := db.QueryRowContext(ctx, `
+                        SELECT COALESCE(group_concat(entry, ' '), '') FROM (
+                                SELECT dataset || ':' || ids AS entry FROM records_vec_pages
+                                UNION ALL
+                                SELECT 'stale ' || dataset FROM records_vec_pages_stale
+                                ORDER BY entry
+                        )`).Scan(&got)
+		if err != nil {
+			t.Fatalf("read pages: %v", err)
+		}
+		return got
+	}
+
+	if _, err := PromoteVersion(ctx, db, "docs", "v2"); err != nil {
+		t.Fatalf("PromoteVersion: %v", err)
+	}
+	// The pages moved with their records, and only the page that was stale
+	// before is stale now.
+	if got, want := pages(), `docs:["c"] docs@previous:["a","b"] stale docs`; got != want {
+		t.Fatalf("pages after promotion = %q, want %q", got, want)
+	}
+
+	if _, err := DeleteVersion(ctx, db, "docs", RetiredVersion); err != nil {
+		t.Fatalf("DeleteVersion: %v", err)
+	}
+	if got, want := pages(), `docs:["c"] stale docs`; got != want {
+		t.Fatalf("pages after deletion = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,320 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// ErrVersionNotFound is returned when a dataset has no version of the given
+// name.
+var ErrVersionNotFound = errors.New("dataset version not found")
+
+// RetiredVersion names the version that PromoteVersion moves the live
+// contents to when they were not loaded as a named version.
+const RetiredVersion = "previous"
+
+var versionName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Version describes a named snapshot of a dataset registered in
+// dataset_versions. The records of a version other than the live one are
+// stored under the dataset name returned by VersionTable; the live version
+// is the dataset itself.
+type Version struct {
+	Dataset  string
+	Version  string
+	Created  time.Time
+	Promoted time.Time
+	Live     bool
+}
+
+// VersionTable returns the dataset name that holds the records of version.
+func VersionTable(dataset, version string) string {
+	return dataset + "@" + version
+}
+
+// ValidateVersion reports whether name may be used as a version name:
+// letters, digits, '.', '_' and '-'.
+func ValidateVersion(name string) error {
+	if !versionName.MatchString(name) {
+		return fmt.Errorf("invalid version name %q (use letters, digits, '.', '_' and '-')", name)
+	}
+	return nil
+}
+
+// Versions returns the registered versions of dataset, oldest first.
+func Versions(ctx context.Context, db *sql.DB, dataset string) ([]Version, error) {
+	if db == nil {
+		return nil, fmt.Errorf("db is nil")
+	}
+	rows, err := db.QueryContext(ctx, `
+                SELECT dataset, version, created_at, promoted_at, live
+                FROM dataset_versions
+                WHERE dataset = ?
+                ORDER BY created_at, version
+        `, normalizeDataset(dataset))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Version
+	for rows.Next() {
+		v, err := scanVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// GetVersion returns the version of dataset called name, or an error
+// wrapping ErrVersionNotFound.
+func GetVersion(ctx context.Context, db *sql.DB, dataset, name string) (Version, error) {
+	if db == nil {
+		return Version{}, fmt.Errorf("db is nil")
+	}
+	dataset = normalizeDataset(dataset)
+	v, err := scanVersion(db.QueryRowContext(ctx, `
+                SELECT dataset, version, created_at, promoted_at, live
+                FROM dataset_versions
+                WHERE dataset = ? AND version = ?
+        `, dataset, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Version{}, fmt.Errorf("%s@%s: %w", dataset, name, ErrVersionNotFound)
+	}
+	return v, err
+}
+
+// AddVersion registers version name of dataset unless it exists already.
+func AddVersion(ctx context.Context, db *sql.DB, dataset, name string) error {
+	if db == nil {
+		return fmt.Errorf("db is nil")
+	}
+	if err := ValidateVersion(name); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, `INSERT OR IGNORE INTO dataset_versions(dataset, version, created_at) VALUES(?, ?, ?)`,
+		normalizeDataset(dataset), name, time.Now().Unix())
+	return err
+}
+
+// CopyDataset replaces the records of dataset to with a copy of the records
+// of dataset from, including their embeddings and index entries, in one
+// transaction. It returns the number of records copied.
+func CopyDataset(ctx context.Context, db *sql.DB, from, to string) (int64, error) {
+	if db == nil {
+		return 0, fmt.Errorf("db is nil")
+	}
+	from, to = normalizeDataset(from), normalizeDataset(to)
+	if from == to {
+		return 0, fmt.Errorf("cannot copy dataset %s onto itself", from)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if err := clearDataset(ctx, tx, to); err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, `
+                INSERT INTO records(dataset, id, data, lat, lng, hash, updated_at)
+                SELECT ?, id, data, lat, lng, hash, updated_at FROM records WHERE dataset = ?
+        `, to, from)
+	if err != nil {
+		return 0, fmt.Errorf("copy %s to %s: %w", from, to, err)
+	}
+	copied, _ := res.RowsAffected()
+	// The virtual tables are keyed by the records rowid, which the copies
+	// get anew.
+	for _, query := range []string{
+		`INSERT INTO records_vec(dataset, id, embedding, model) SELECT ?1, id, embedding, model FROM records_vec WHERE dataset = ?2`,
+		`INSERT INTO records_sparse(dataset, id, weights) SELECT ?1, id, weights FROM records_sparse WHERE dataset = ?2`,
+		`INSERT INTO records_fts(rowid, dataset, id, content)
+                SELECT r.rowid, r.dataset, f.id, f.content
+                FROM records_fts AS f
+                INNER JOIN records AS r ON r.dataset = ?1 AND r.id = f.id
+                WHERE f.dataset = ?2`,
+		`INSERT INTO records_rtree(rowid, min_lat, max_lat, min_lng, max_lng)
+                SELECT n.rowid, g.min_lat, g.max_lat, g.min_lng, g.max_lng
+                FROM records_rtree AS g
+                INNER JOIN records AS o ON o.rowid = g.rowid
+                INNER JOIN records AS n ON n.dataset = ?1 AND n.id = o.id
+                WHERE o.dataset = ?2`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, to, from); err != nil {
+			return 0, fmt.Errorf("copy %s to %s: %w", from, to, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return copied, nil
+}
+
+// PromoteVersion makes version name the live contents of dataset in one
+// transaction: the records of dataset move to the version that was live
+// (RetiredVersion when none was registered), replacing whatever that
+// version held, and the records of name move to dataset. It returns the
+// version the previous contents were moved to, or "" when name was live
+// already. The vector pages follow the records; the trigram indexes of both
+// datasets must be rebuilt afterwards.
+func PromoteVersion(ctx context.Context, db *sql.DB, dataset, name string) (string, error) {
+	if db == nil {
+		return "", fmt.Errorf("db is nil")
+	}
+	dataset = normalizeDataset(dataset)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var live bool
+	err = tx.QueryRowContext(ctx, `SELECT live FROM dataset_versions WHERE dataset = ? AND version = ?`, dataset, name).Scan(&live)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%s@%s: %w", dataset, name, ErrVersionNotFound)
+	}
+	if err != nil || live {
+		return "", err
+	}
+	retired := RetiredVersion
+	err = tx.QueryRowContext(ctx, `SELECT version FROM dataset_versions WHERE dataset = ? AND live = 1`, dataset).Scan(&retired)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	if retired == name {
+		return "", fmt.Errorf("version %s of %s cannot be promoted over the unregistered live contents", name, dataset)
+	}
+
+	// records_vec and records_sparse reference records, so the foreign keys
+	// are checked at commit, once every table was renamed.
+	if _, err := tx.ExecContext(ctx, `PRAGMA defer_foreign_keys = ON`); err != nil {
+		return "", err
+	}
+	if err := clearDataset(ctx, tx, VersionTable(dataset, retired)); err != nil {
+		return "", err
+	}
+	if err := renameDataset(ctx, tx, dataset, VersionTable(dataset, retired)); err != nil {
+		return "", err
+	}
+	if err := renameDataset(ctx, tx, VersionTable(dataset, name), dataset); err != nil {
+		return "", err
+	}
+
+	now := time.Now().Unix()
+	for _, stmt := range []struct {
+		query string
+		args  []any
+	}{
+		{`INSERT OR IGNORE INTO dataset_versions(dataset, version, created_at) VALUES(?, ?, ?)`, []any{dataset, retired, now}},
+		{`UPDATE dataset_versions SET live = 0 WHERE dataset = ?`, []any{dataset}},
+		{`UPDATE dataset_versions SET live = 1, promoted_at = ? WHERE dataset = ? AND version = ?`, []any{now, dataset, name}},
+	} {
+		if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return "", err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return retired, nil
+}
+
+// DeleteVersion deletes the records of version name of dataset and its
+// registration. It returns the number of records deleted. The live version
+// is stored as dataset itself and is not deleted by it.
+func DeleteVersion(ctx context.Context, db *sql.DB, dataset, name string) (int64, error) {
+	if db == nil {
+		return 0, fmt.Errorf("db is nil")
+	}
+	dataset = normalizeDataset(dataset)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var live bool
+	err = tx.QueryRowContext(ctx, `SELECT live FROM dataset_versions WHERE dataset = ? AND version = ?`, dataset, name).Scan(&live)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%s@%s: %w", dataset, name, ErrVersionNotFound)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if live {
+		return 0, fmt.Errorf("version %s is the live contents of %s", name, dataset)
+	}
+	var removed int64
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM records WHERE dataset = ?`, VersionTable(dataset, name)).Scan(&removed); err != nil {
+		return 0, err
+	}
+	if err := clearDataset(ctx, tx, VersionTable(dataset, name)); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM dataset_versions WHERE dataset = ? AND version = ?`, dataset, name); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// clearDataset is ClearDataset for the transactions of this file.
+func clearDataset(ctx context.Context, tx *sql.Tx, dataset string) error {
+	if _, err := ClearDataset(ctx, tx, dataset); err != nil {
+		return fmt.Errorf("clear %s: %w", dataset, err)
+	}
+	return nil
+}
+
+// renameDataset moves the records of dataset from to dataset to, which must
+// be empty. Row IDs are kept, so the spatial index needs no change, and the
+// vector pages move with the embeddings they hold.
+func renameDataset(ctx context.Context, tx *sql.Tx, from, to string) error {
+	// Moving records_vec makes its triggers mark every page of from stale.
+	// The marks that were there before move to the new name first; the
+	// ones the move adds are dropped, since the pages still match.
+	type statement struct {
+		query string
+		args  []any
+	}
+	stmts := []statement{{`UPDATE records_vec_pages_stale SET dataset = ? WHERE dataset = ?`, []any{to, from}}}
+	for _, table := range []string{"records", "records_vec", "records_sparse", "records_fts", "records_fts_trigram"} {
+		stmts = append(stmts, statement{`UPDATE ` + table + ` SET dataset = ? WHERE dataset = ?`, []any{to, from}})
+	}
+	stmts = append(stmts,
+		statement{`DELETE FROM records_vec_pages_stale WHERE dataset = ?`, []any{from}},
+		statement{`UPDATE records_vec_pages SET dataset = ? WHERE dataset = ?`, []any{to, from}})
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return fmt.Errorf("rename %s to %s: %w", from, to, err)
+		}
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVersion(row rowScanner) (Version, error) {
+	var (
+		v        Version
+		created  int64
+		promoted sql.NullInt64
+	)
+	if err := row.Scan(&v.Dataset, &v.Version, &created, &promoted, &v.Live); err != nil {
+		return Version{}, err
+	}
+	v.Created = time.Unix(created, 0).UTC()
+	if promoted.Valid {
+		v.Promoted = time.Unix(promoted.Int64, 0).UTC()
+	}
+	return v, nil
+}
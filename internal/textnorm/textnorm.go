@@ -0,0 +1,80 @@
+// Package textnorm normalizes text before it is passed to the encoder so that
+// visually equivalent strings (「ＡＢＣ」 and "ABC") embed to nearby vectors.
+package textnorm
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+// Supported normalization steps. They are applied in the order given.
+const (
+	// NFKC applies Unicode compatibility composition (full-width alphanumerics
+	// become ASCII, half-width katakana become full-width, ① becomes 1, ...).
+	NFKC = "nfkc"
+	// Width folds full-width ASCII to half-width and half-width katakana to
+	// full-width without the other NFKC rewrites.
+	Width = "width"
+	// Space collapses runs of whitespace (including U+3000) into a single
+	// ASCII space and trims both ends.
+	Space = "space"
+)
+
+// Normalizer applies a fixed sequence of normalization steps. A nil
+// Normalizer leaves text untouched.
+type Normalizer struct {
+	steps []func(string) string
+	names []string
+}
+
+// New validates steps and builds a Normalizer. It returns nil when steps is
+// empty.
+func New(steps []string) (*Normalizer, error) {
+	var n Normalizer
+	for _, raw := range steps {
+		name := strings.ToLower(strings.TrimSpace(raw))
+		switch name {
+		case "":
+			continue
+		case NFKC:
+			n.steps = append(n.steps, norm.NFKC.String)
+		case Width:
+			n.steps = append(n.steps, width.Fold.String)
+		case Space:
+			n.steps = append(n.steps, collapseSpace)
+		default:
+			return nil, fmt.Errorf("unknown normalization step %q (supported: %s, %s, %s)", raw, NFKC, Width, Space)
+		}
+		n.names = append(n.names, name)
+	}
+	if len(n.steps) == 0 {
+		return nil, nil
+	}
+	return &n, nil
+}
+
+// Apply normalizes text.
+func (n *Normalizer) Apply(text string) string {
+	if n == nil {
+		return text
+	}
+	for _, step := range n.steps {
+		text = step(text)
+	}
+	return text
+}
+
+// Steps returns the normalized step names.
+func (n *Normalizer) Steps() []string {
+	if n == nil {
+		return nil
+	}
+	return append([]string(nil), n.names...)
+}
+
+func collapseSpace(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,31 @@
+package textnorm
+
+import "testing"
+
+func TestNormalizerApply(t *testing.T) {
+	n, err := New([]string{"nfkc", "space"})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if got := n.Apply("　ＡＢＣ　 ｶﾌｪ\n① "); got != "ABC カフェ 1" {
+		t.Fatalf("unexpected normalization: %q", got)
+	}
+
+	w, err := New([]string{"width"})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if got := w.Apply("ＡＢＣ①"); got != "ABC①" {
+		t.Fatalf("width fold should keep ①: %q", got)
+	}
+
+	if n, err := New(nil); err != nil || n != nil {
+		t.Fatalf("empty steps should yield nil normalizer, got %v, %v", n, err)
+	}
+	if got := (*Normalizer)(nil).Apply(" x "); got != " x " {
+		t.Fatalf("nil normalizer must not modify text: %q", got)
+	}
+	if _, err := New([]string{"lower"}); err == nil {
+		t.Fatalf("expected error for unknown step")
+	}
+}
@@ -0,0 +1,100 @@
+package vector
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// benchDim matches bge-m3 embeddings.
+const benchDim = 1024
+
+func benchVector(seed int64) []float32 {
+	rng := rand.New(rand.NewSource(seed))
+	vec := make([]float32, benchDim)
+	for i := range vec {
+		vec[i] = rng.Float32()*2 - 1
+	}
+	return vec
+}
+
+func BenchmarkSerialize(b *testing.B) {
+	vec := benchVector(1)
+	b.ReportAllocs()
+	b.SetBytes(4 * benchDim)
+	for b.Loop() {
+		Serialize(vec)
+	}
+}
+
+func BenchmarkSerializeInto(b *testing.B) {
+	vec := benchVector(1)
+	buf := GetBytes()
+	defer PutBytes(buf)
+	b.ReportAllocs()
+	b.SetBytes(4 * benchDim)
+	for b.Loop() {
+		*buf = SerializeInto((*buf)[:0], vec)
+	}
+}
+
+func BenchmarkDeserialize(b *testing.B) {
+	blob := Serialize(benchVector(1))
+	b.ReportAllocs()
+	b.SetBytes(int64(len(blob)))
+	for b.Loop() {
+		if _, err := Deserialize(blob); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDeserializeInto(b *testing.B) {
+	blob := Serialize(benchVector(1))
+	scratch := GetFloats()
+	defer PutFloats(scratch)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(blob)))
+	for b.Loop() {
+		vec, err := DeserializeInto(*scratch, blob)
+		if err != nil {
+			b.Fatal(err)
+		}
+		*scratch = vec
+	}
+}
+
+func BenchmarkView(b *testing.B) {
+	blob := Serialize(benchVector(1))
+	scratch := GetFloats()
+	defer PutFloats(scratch)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(blob)))
+	for b.Loop() {
+		if _, err := View(scratch, blob); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCosine(b *testing.B) {
+	x, y := benchVector(1), benchVector(2)
+	b.ReportAllocs()
+	for b.Loop() {
+		Cosine(x, y)
+	}
+}
+
+func BenchmarkLexicalScore(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	query, doc := map[int32]float32{}, map[int32]float32{}
+	for i := 0; i < 16; i++ {
+		query[rng.Int31n(2000)] = rng.Float32()
+	}
+	for i := 0; i < 200; i++ {
+		doc[rng.Int31n(2000)] = rng.Float32()
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		LexicalScore(query, doc)
+	}
+}
@@ -0,0 +1,180 @@
+package vector
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// npyMagic starts every NumPy .npy file.
+const npyMagic = "\x93NUMPY"
+
+var (
+	npyDescr   = regexp.MustCompile(`'descr':\s*'([^']*)'`)
+	npyFortran = regexp.MustCompile(`'fortran_order':\s*(True|False)`)
+	npyShape   = regexp.MustCompile(`'shape':\s*\(([^)]*)\)`)
+)
+
+// WriteNPYHeader writes the header of a NumPy .npy file (format 1.0) holding
+// a C-ordered little-endian float32 matrix of rows vectors with dim values
+// each. The rows follow as the encoding produced by Serialize.
+func WriteNPYHeader(w io.Writer, rows, dim int) error {
+	dict := fmt.Sprintf("{'descr': '<f4', 'fortran_order': False, 'shape': (%d, %d), }", rows, dim)
+	// The magic, version and length take 10 bytes; the header is padded
+	// with spaces so that the data starts at a multiple of 64 and ends with
+	// a newline.
+	size := 10 + len(dict) + 1
+	pad := (64 - size%64) % 64
+	header := dict + strings.Repeat(" ", pad) + "\n"
+	if len(header) > math.MaxUint16 {
+		return fmt.Errorf("npy header too long")
+	}
+	buf := make([]byte, 0, 10+len(header))
+	buf = append(buf, npyMagic...)
+	buf = append(buf, 1, 0)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(header)))
+	buf = append(buf, header...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// NPYReader reads the rows of a two-dimensional float32 or float64 matrix
+// stored in a NumPy .npy file.
+type NPYReader struct {
+	r     *bufio.Reader
+	Rows  int
+	Dim   int
+	width int // bytes per value
+	read  int
+	buf   []byte
+}
+
+// NewNPYReader reads the header of the .npy file in r.
+func NewNPYReader(r io.Reader) (*NPYReader, error) {
+	br := bufio.NewReader(r)
+	prefix := make([]byte, 8)
+	if _, err := io.ReadFull(br, prefix); err != nil {
+		return nil, fmt.Errorf("read npy header: %w", err)
+	}
+	if string(prefix[:6]) != npyMagic {
+		return nil, errors.New("not a .npy file")
+	}
+	var headerLen int
+	switch prefix[6] {
+	case 1:
+		var n uint16
+		if err := binary.Read(br, binary.LittleEndian, &n); err != nil {
+			return nil, fmt.Errorf("read npy header: %w", err)
+		}
+		headerLen = int(n)
+	case 2, 3:
+		var n uint32
+		if err := binary.Read(br, binary.LittleEndian, &n); err != nil {
+			return nil, fmt.Errorf("read npy header: %w", err)
+		}
+		headerLen = int(n)
+	default:
+		return nil, fmt.Errorf("unsupported npy version %d.%d", prefix[6], prefix[7])
+	}
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("read npy header: %w", err)
+	}
+
+	n := &NPYReader{r: br}
+	dict := string(header)
+	descr := npyDescr.FindStringSubmatch(dict)
+	if descr == nil {
+		return nil, errors.New("npy header has no descr")
+	}
+	switch descr[1] {
+	case "<f4":
+		n.width = 4
+	case "<f8":
+		n.width = 8
+	default:
+		return nil, fmt.Errorf("unsupported npy dtype %q (want <f4 or <f8)", descr[1])
+	}
+	if fortran := npyFortran.FindStringSubmatch(dict); fortran != nil && fortran[1] == "True" {
+		return nil, errors.New("fortran-ordered npy arrays are not supported")
+	}
+	shape := npyShape.FindStringSubmatch(dict)
+	if shape == nil {
+		return nil, errors.New("npy header has no shape")
+	}
+	var dims []int
+	for _, part := range strings.Split(shape[1], ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		v, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid npy shape %q", shape[1])
+		}
+		dims = append(dims, v)
+	}
+	if len(dims) != 2 || dims[1] <= 0 {
+		return nil, fmt.Errorf("npy shape (%s) is not a matrix of vectors", shape[1])
+	}
+	n.Rows, n.Dim = dims[0], dims[1]
+	n.buf = make([]byte, n.Dim*n.width)
+	return n, nil
+}
+
+// Next returns the next row, or io.EOF after the last one.
+func (n *NPYReader) Next() ([]float32, error) {
+	if n.read == n.Rows {
+		return nil, io.EOF
+	}
+	if _, err := io.ReadFull(n.r, n.buf); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("npy row %d: %w", n.read, err)
+	}
+	n.read++
+	vec := make([]float32, n.Dim)
+	for i := range vec {
+		if n.width == 8 {
+			vec[i] = float32(math.Float64frombits(binary.LittleEndian.Uint64(n.buf[i*8:])))
+		} else {
+			vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(n.buf[i*4:]))
+		}
+	}
+	return vec, nil
+}
+
+// WriteFvec writes vec in the .fvecs format used by Faiss and the ANN
+// benchmarks: the dimension as a little-endian int32 followed by the values.
+func WriteFvec(w io.Writer, vec []float32) error {
+	buf := make([]byte, 4, 4+4*len(vec))
+	binary.LittleEndian.PutUint32(buf, uint32(len(vec)))
+	_, err := w.Write(SerializeInto(buf, vec))
+	return err
+}
+
+// ReadFvec reads a vector written by WriteFvec. It returns io.EOF when r
+// ends before the vector.
+func ReadFvec(r io.Reader) ([]float32, error) {
+	var dim int32
+	if err := binary.Read(r, binary.LittleEndian, &dim); err != nil {
+		return nil, err
+	}
+	if dim <= 0 {
+		return nil, fmt.Errorf("invalid fvecs dimension %d", dim)
+	}
+	data := make([]byte, 4*int(dim))
+	if _, err := io.ReadFull(r, data); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return Deserialize(data)
+}
@@ -0,0 +1,82 @@
+package vector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestNPYRoundTrip(t *testing.T) {
+	rows := [][]float32{{1, 2, 3}, {-0.5, 0, 4.25}}
+	var buf bytes.Buffer
+	if err := WriteNPYHeader(&buf, len(rows), 3); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len()%64 != 0 {
+		t.Fatalf("header is %d bytes, want a multiple of 64", buf.Len())
+	}
+	for _, row := range rows {
+		buf.Write(Serialize(row))
+	}
+	r, err := NewNPYReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Rows != 2 || r.Dim != 3 {
+		t.Fatalf("shape = (%d, %d)", r.Rows, r.Dim)
+	}
+	for _, want := range rows {
+		got, err := r.Next()
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("Next = %v, %v, want %v", got, err, want)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("expected io.EOF after the last row, got %v", err)
+	}
+
+	// NumPy writes float64 unless told otherwise.
+	header := "{'descr': '<f8', 'fortran_order': False, 'shape': (1, 2), }"
+	buf.Reset()
+	buf.WriteString(npyMagic + "\x01\x00")
+	binary.Write(&buf, binary.LittleEndian, uint16(len(header)+1))
+	buf.WriteString(header + "\n")
+	binary.Write(&buf, binary.LittleEndian, []float64{0.25, -1})
+	if r, err = NewNPYReader(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := r.Next(); err != nil || !reflect.DeepEqual(got, []float32{0.25, -1}) {
+		t.Fatalf("Next = %v, %v", got, err)
+	}
+
+	buf.Reset()
+	buf.WriteString(npyMagic + "\x01\x00")
+	header = "{'descr': '<i8', 'fortran_order': False, 'shape': (1, 2), }\n"
+	binary.Write(&buf, binary.LittleEndian, uint16(len(header)))
+	buf.WriteString(header)
+	if _, err := NewNPYReader(&buf); err == nil {
+		t.Fatalf("expected integer arrays to be rejected")
+	}
+}
+
+func TestFvecsRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	rows := [][]float32{{1, float32(math.Pi)}, {0, -1}}
+	for _, row := range rows {
+		if err := WriteFvec(&buf, row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range rows {
+		got, err := ReadFvec(&buf)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("ReadFvec = %v, %v, want %v", got, err, want)
+		}
+	}
+	if _, err := ReadFvec(&buf); err != io.EOF {
+		t.Fatalf("expected io.EOF at the end, got %v", err)
+	}
+}
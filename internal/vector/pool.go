@@ -0,0 +1,121 @@
+package vector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// Scratch buffers for scans, which decode one stored vector per row and
+// would otherwise allocate a fresh slice for every record.
+var (
+	floatPool  = sync.Pool{New: func() any { return new([]float32) }}
+	bytePool   = sync.Pool{New: func() any { return new([]byte) }}
+	sparsePool = sync.Pool{New: func() any { return map[int32]float32{} }}
+)
+
+// GetFloats returns an empty scratch slice from the pool. Store the grown
+// slice back through the pointer and return it with PutFloats once nothing
+// refers to its contents.
+func GetFloats() *[]float32 {
+	buf := floatPool.Get().(*[]float32)
+	*buf = (*buf)[:0]
+	return buf
+}
+
+// PutFloats returns a slice obtained from GetFloats to the pool.
+func PutFloats(buf *[]float32) {
+	if buf != nil {
+		floatPool.Put(buf)
+	}
+}
+
+// GetBytes returns an empty scratch byte slice from the pool, to be used
+// like GetFloats and returned with PutBytes.
+func GetBytes() *[]byte {
+	buf := bytePool.Get().(*[]byte)
+	*buf = (*buf)[:0]
+	return buf
+}
+
+// PutBytes returns a slice obtained from GetBytes to the pool.
+func PutBytes(buf *[]byte) {
+	if buf != nil {
+		bytePool.Put(buf)
+	}
+}
+
+// GetSparse returns an empty scratch map from the pool for
+// DeserializeSparseInto. Return it with PutSparse.
+func GetSparse() map[int32]float32 {
+	m := sparsePool.Get().(map[int32]float32)
+	clear(m)
+	return m
+}
+
+// PutSparse returns a map obtained from GetSparse to the pool.
+func PutSparse(m map[int32]float32) {
+	if m != nil {
+		sparsePool.Put(m)
+	}
+}
+
+// SerializeInto appends the encoding of vec produced by Serialize to dst and
+// returns the extended slice.
+func SerializeInto(dst []byte, vec []float32) []byte {
+	n := len(dst)
+	dst = grow(dst, 4*len(vec))
+	for i, v := range vec {
+		binary.LittleEndian.PutUint32(dst[n+i*4:], math.Float32bits(v))
+	}
+	return dst
+}
+
+// DeserializeInto decodes data like Deserialize, reusing the capacity of dst.
+// The returned slice holds only the decoded vector.
+func DeserializeInto(dst []float32, data []byte) ([]float32, error) {
+	if len(data)%4 != 0 {
+		return dst[:0], fmt.Errorf("invalid vector blob length %d", len(data))
+	}
+	n := len(data) / 4
+	if cap(dst) < n {
+		dst = make([]float32, n)
+	}
+	dst = dst[:n]
+	for i := range dst {
+		dst[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return dst, nil
+}
+
+// DeserializeSparseInto decodes data like DeserializeSparse into dst, which
+// is cleared first.
+func DeserializeSparseInto(dst map[int32]float32, data []byte) error {
+	if len(data)%8 != 0 {
+		return fmt.Errorf("invalid sparse blob length %d", len(data))
+	}
+	clear(dst)
+	for i := 0; i+8 <= len(data); i += 8 {
+		id := int32(binary.LittleEndian.Uint32(data[i:]))
+		dst[id] = math.Float32frombits(binary.LittleEndian.Uint32(data[i+4:]))
+	}
+	return nil
+}
+
+// grow extends dst by n bytes, reallocating only when its capacity is short.
+func grow(dst []byte, n int) []byte {
+	if cap(dst)-len(dst) < n {
+		next := make([]byte, len(dst), len(dst)+n)
+		copy(next, dst)
+		dst = next
+	}
+	return dst[:len(dst)+n]
+}
+
+// decodeScratch decodes data into *scratch and stores the grown slice back.
+func decodeScratch(scratch *[]float32, data []byte) ([]float32, error) {
+	vec, err := DeserializeInto(*scratch, data)
+	*scratch = vec
+	return vec, err
+}
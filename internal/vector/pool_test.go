@@ -0,0 +1,98 @@
+package vector
+
+import (
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func TestDeserializeInto(t *testing.T) {
+	vec := []float32{1, -2.5, 0, 3.25}
+	blob := SerializeInto([]byte{0xff}, vec)[1:]
+	if !reflect.DeepEqual(blob, Serialize(vec)) {
+		t.Fatalf("SerializeInto appended %v, want %v", blob, Serialize(vec))
+	}
+
+	dst := make([]float32, 1, 8)
+	got, err := DeserializeInto(dst, blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, vec) {
+		t.Fatalf("DeserializeInto = %v, want %v", got, vec)
+	}
+	if &got[0] != &dst[:1][0] {
+		t.Fatalf("expected the capacity of dst to be reused")
+	}
+	if _, err := DeserializeInto(dst, blob[:3]); err == nil {
+		t.Fatalf("expected an error for a truncated blob")
+	}
+}
+
+func TestDeserializeSparseInto(t *testing.T) {
+	weights := map[int32]float32{3: 0.5, 7: 1.25}
+	dst := GetSparse()
+	defer PutSparse(dst)
+	dst[99] = 1
+	if err := DeserializeSparseInto(dst, SerializeSparse(weights)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dst, weights) {
+		t.Fatalf("DeserializeSparseInto = %v, want %v", dst, weights)
+	}
+}
+
+func TestLexicalScoreDeterministic(t *testing.T) {
+	// Weights of very different magnitudes make the float sum depend on
+	// the order of the terms.
+	query := map[int32]float32{}
+	doc := map[int32]float32{}
+	for id := int32(0); id < 40; id++ {
+		query[id] = float32(id%7) * 1e-3
+		doc[id] = 1 / float32(id+1)
+		if id%5 == 0 {
+			query[id] = 1e7
+		}
+	}
+	var want float64
+	for id := int32(0); id < 40; id++ {
+		want += float64(query[id]) * float64(doc[id])
+	}
+	for i := 0; i < 100; i++ {
+		if got := LexicalScore(query, doc); got != want {
+			t.Fatalf("LexicalScore = %v, want %v (summed in token order)", got, want)
+		}
+	}
+}
+
+func TestView(t *testing.T) {
+	vec := []float32{1, -2.5, 0, 3.25}
+	blob := Serialize(vec)
+	scratch := GetFloats()
+	defer PutFloats(scratch)
+
+	got, err := View(scratch, blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, vec) {
+		t.Fatalf("View = %v, want %v", got, vec)
+	}
+	if viewed := unsafe.Pointer(&got[0]) == unsafe.Pointer(&blob[0]); viewed != ZeroCopy {
+		t.Fatalf("View aliased the blob: %v, ZeroCopy is %v", viewed, ZeroCopy)
+	}
+
+	// A misaligned blob is decoded into the scratch slice.
+	shifted := append(make([]byte, 1, len(blob)+1), blob...)[1:]
+	got, err = View(scratch, shifted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, vec) || &got[0] != &(*scratch)[0] {
+		t.Fatalf("expected a misaligned blob to be decoded into scratch, got %v", got)
+	}
+
+	if _, err := View(scratch, blob[:3]); err == nil {
+		t.Fatalf("expected an error for a truncated blob")
+	}
+}
@@ -20,3 +20,31 @@ func Cosine(a, b []float32) float64 {
 	}
 	return dot / (math.Sqrt(na) * math.Sqrt(nb))
 }
+
+// Dot returns the inner product of two vectors, or 0 when the lengths do
+// not match.
+func Dot(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+// EuclideanSimilarity maps the Euclidean distance between two vectors to
+// 1/(1+distance), so that identical vectors score 1 and higher is closer. It
+// returns 0 when the lengths do not match.
+func EuclideanSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var sum float64
+	for i := range a {
+		d := float64(a[i]) - float64(b[i])
+		sum += d * d
+	}
+	return 1 / (1 + math.Sqrt(sum))
+}
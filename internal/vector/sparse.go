@@ -0,0 +1,65 @@
+package vector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+)
+
+// SerializeSparse encodes lexical weights as little-endian (token id, weight)
+// pairs ordered by token id.
+func SerializeSparse(weights map[int32]float32) []byte {
+	ids := make([]int32, 0, len(weights))
+	for id := range weights {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	out := make([]byte, 8*len(ids))
+	for i, id := range ids {
+		binary.LittleEndian.PutUint32(out[i*8:], uint32(id))
+		binary.LittleEndian.PutUint32(out[i*8+4:], math.Float32bits(weights[id]))
+	}
+	return out
+}
+
+// DeserializeSparse converts a byte slice produced by SerializeSparse back to
+// a token id → weight map.
+func DeserializeSparse(data []byte) (map[int32]float32, error) {
+	if len(data)%8 != 0 {
+		return nil, fmt.Errorf("invalid sparse blob length %d", len(data))
+	}
+	n := len(data) / 8
+	out := make(map[int32]float32, n)
+	for i := 0; i < n; i++ {
+		id := int32(binary.LittleEndian.Uint32(data[i*8:]))
+		out[id] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*8+4:]))
+	}
+	return out, nil
+}
+
+// LexicalScore returns the bge-m3 lexical matching score: the sum of weight
+// products over the tokens shared by both inputs.
+func LexicalScore(query, doc map[int32]float32) float64 {
+	if len(query) == 0 || len(doc) == 0 {
+		return 0
+	}
+	// Map iteration order is random and float addition is not associative,
+	// so the shared tokens are summed in token id order to give the same
+	// score on every call.
+	var buf [64]int32
+	shared := buf[:0]
+	for id := range query {
+		if _, ok := doc[id]; ok {
+			shared = append(shared, id)
+		}
+	}
+	slices.Sort(shared)
+	var score float64
+	for _, id := range shared {
+		score += float64(query[id]) * float64(doc[id])
+	}
+	return score
+}
@@ -0,0 +1,13 @@
+//go:build purego || !(386 || amd64 || arm || arm64 || loong64 || mips64le || mipsle || ppc64le || riscv64 || wasm)
+
+package vector
+
+// ZeroCopy reports whether View can return vectors without copying them.
+const ZeroCopy = false
+
+// View decodes the vector encoded in data into *scratch, which keeps the
+// grown slice. Little-endian builds without the purego tag reinterpret data
+// in place instead.
+func View(scratch *[]float32, data []byte) ([]float32, error) {
+	return decodeScratch(scratch, data)
+}
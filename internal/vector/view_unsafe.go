@@ -0,0 +1,32 @@
+//go:build !purego && (386 || amd64 || arm || arm64 || loong64 || mips64le || mipsle || ppc64le || riscv64 || wasm)
+
+package vector
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// ZeroCopy reports whether View can return vectors without copying them. It
+// is false on big-endian platforms and in builds with the purego tag.
+const ZeroCopy = true
+
+// View returns the vector encoded in data. On little-endian platforms the
+// encoding matches the in-memory layout of []float32, so a 4-byte aligned
+// blob is reinterpreted in place instead of being decoded; otherwise the
+// vector is decoded into *scratch, which keeps the grown slice. A view
+// aliases data: it must not be modified or kept after data is reused, which
+// for sql.RawBytes happens on the next call to Next or Scan.
+func View(scratch *[]float32, data []byte) ([]float32, error) {
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("invalid vector blob length %d", len(data))
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	p := unsafe.Pointer(unsafe.SliceData(data))
+	if uintptr(p)%unsafe.Alignof(float32(0)) != 0 {
+		return decodeScratch(scratch, data)
+	}
+	return unsafe.Slice((*float32)(p), len(data)/4), nil
+}
@@ -1,31 +1,48 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"yashubustudio/csv-search/pkg/csvsearch"
 )
 
+// logLevel is the level of the shared slog logger, set by the global flags.
+var logLevel = new(slog.LevelVar)
+
 func main() {
-	if len(os.Args) < 2 {
+	args, err := parseGlobalFlags(os.Args[1:])
+	if err != nil {
+		exitWithError(withCode(codeUsage, err))
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
+	if len(args) < 1 {
 		usage()
-		os.Exit(1)
+		os.Exit(exitStatus[codeUsage])
 	}
 
 	ctx := context.Background()
-	cmd := os.Args[1]
-	args := os.Args[2:]
+	cmd := args[0]
+	args = args[1:]
 
-	var err error
 	switch cmd {
 	case "init":
 		err = runInit(ctx, args)
@@ -33,19 +50,71 @@ func main() {
 		err = runIngest(ctx, args)
 	case "search":
 		err = runSearch(ctx, args)
+	case "similar":
+		err = runSimilar(ctx, args)
+	case "embed":
+		err = runEmbed(ctx, args)
 	case "serve":
 		err = runServe(ctx, args)
+	case "reload-model":
+		err = runReloadModel(ctx, args)
+	case "parity":
+		err = runParity(ctx, args)
+	case "drift":
+		err = runDrift(ctx, args)
+	case "query-report":
+		err = runQueryReport(ctx, args)
+	case "tune":
+		err = runTune(ctx, args)
+	case "export":
+		err = runExport(ctx, args)
+	case "import":
+		err = runImport(ctx, args)
+	case "delete":
+		err = runDelete(ctx, args)
+	case "dedupe":
+		err = runDedupe(ctx, args)
+	case "stats":
+		err = runStats(ctx, args)
+	case "versions":
+		err = runVersions(ctx, args)
+	case "datasets":
+		err = runDatasets(ctx, args)
+	case "reembed":
+		err = runReembed(ctx, args)
+	case "bench":
+		err = runBench(ctx, args)
+	case "reindex":
+		err = runReindex(ctx, args)
+	case "fsck":
+		err = runFsck(ctx, args)
+	case "compact":
+		err = runCompact(ctx, args)
+	case "backup":
+		err = runBackup(ctx, args)
+	case "restore":
+		err = runRestore(ctx, args)
+	case "doctor":
+		err = runDoctor(ctx, args)
+	case "completion":
+		err = runCompletion(args)
+	case "config":
+		err = runConfig(args)
+	case "version", "--version":
+		err = runVersion(args)
 	case "help", "-h", "--help":
 		usage()
 		return
 	default:
+		if jsonErrors {
+			exitWithError(usageErrorf("unknown command %q", cmd))
+		}
 		fmt.Fprintf(os.Stderr, "unknown command %q\n", cmd)
 		usage()
-		os.Exit(1)
+		os.Exit(exitStatus[codeUsage])
 	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+		exitWithError(err)
 	}
 }
 
@@ -53,7 +122,7 @@ func runInit(ctx context.Context, args []string) error {
 	fs := flag.NewFlagSet("init", flag.ExitOnError)
 	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
 	dbPath := fs.String("db", "", "path to SQLite database")
-	if err := fs.Parse(args); err != nil {
+	if err := parseFlags(fs, args); err != nil {
 		return err
 	}
 
@@ -82,12 +151,15 @@ func runIngest(ctx context.Context, args []string) error {
 	fs := flag.NewFlagSet("ingest", flag.ExitOnError)
 	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
 	dbPath := fs.String("db", "", "path to SQLite database")
-	csvPath := fs.String("csv", "", "path to source CSV file")
+	csvPath := fs.String("csv", "", "path or http(s) URL of the source CSV file")
 	batchSize := fs.Int("batch", -1, "rows per transaction batch")
 	ortLib := fs.String("ort-lib", "", "path to ONNX Runtime shared library")
 	modelPath := fs.String("model", "", "path to encoder ONNX model")
 	tokenizerPath := fs.String("tokenizer", "", "path to tokenizer.json")
 	maxSeqLen := fs.Int("max-seq-len", -1, "maximum sequence length for the encoder")
+	sparseHead := fs.String("sparse-head", "", "path to bge-m3 sparse_linear weights (JSON) for lexical weights")
+	truncation := fs.String("truncation", "", "truncation for over-length inputs: head, tail or middle")
+	normalize := fs.String("normalize", "", "comma-separated text normalization steps before encoding: nfkc,width,space")
 
 	tableName := fs.String("table", "", "logical table/dataset name to store the records")
 	idCol := fs.String("id-col", "", "CSV column containing the primary identifier")
@@ -95,8 +167,12 @@ func runIngest(ctx context.Context, args []string) error {
 	metaColsFlag := fs.String("meta-cols", "", "comma-separated CSV columns to persist as metadata; use '*' to keep all")
 	latCol := fs.String("lat-col", "", "CSV column for latitude (empty to disable)")
 	lngCol := fs.String("lng-col", "", "CSV column for longitude (empty to disable)")
+	sparse := fs.Bool("sparse", false, "store bge-m3 sparse lexical weights for hybrid search")
+	replace := fs.Bool("replace", false, "delete the dataset's existing records in the same transaction before loading (full refresh)")
+	duplicates := fs.String("duplicates", "", "what to do with IDs repeated in the CSV: last (default), first or error")
+	version := fs.String("version", "", "load the CSV as this named version of the dataset instead of its live contents (see versions)")
 
-	if err := fs.Parse(args); err != nil {
+	if err := parseFlags(fs, args); err != nil {
 		return err
 	}
 
@@ -109,6 +185,9 @@ func runIngest(ctx context.Context, args []string) error {
 				ModelPath:         *modelPath,
 				TokenizerPath:     *tokenizerPath,
 				MaxSequenceLength: *maxSeqLen,
+				SparseHeadPath:    *sparseHead,
+				Truncation:        strings.TrimSpace(*truncation),
+				Normalize:         parseCSVList(*normalize),
 			},
 		},
 	})
@@ -129,6 +208,10 @@ func runIngest(ctx context.Context, args []string) error {
 		MetadataColumns: metaCols,
 		LatitudeColumn:  strings.TrimSpace(*latCol),
 		LongitudeColumn: strings.TrimSpace(*lngCol),
+		Sparse:          *sparse,
+		Replace:         *replace,
+		Duplicates:      strings.TrimSpace(*duplicates),
+		Version:         strings.TrimSpace(*version),
 	})
 	if err != nil {
 		return err
@@ -141,7 +224,17 @@ func runIngest(ctx context.Context, args []string) error {
 	if datasetLabel == "" {
 		datasetLabel = "default"
 	}
-	fmt.Fprintf(os.Stdout, "ingested dataset %s from %s\n", datasetLabel, summary.CSVPath)
+	if summary.Version != "" {
+		datasetLabel += " version " + summary.Version
+	}
+	if summary.DuplicateRows > 0 {
+		fmt.Fprintf(os.Stderr, "warning: %d rows repeat an earlier id (kept the %s)\n", summary.DuplicateRows, summary.Duplicates)
+	}
+	if summary.Replace {
+		fmt.Fprintf(os.Stdout, "replaced dataset %s from %s (%d removed, %d loaded in %s)\n", datasetLabel, summary.CSVPath, summary.Removed, summary.Upserted, summary.Duration.Round(time.Millisecond))
+		return nil
+	}
+	fmt.Fprintf(os.Stdout, "ingested dataset %s from %s (%d upserted, %d unchanged in %s)\n", datasetLabel, summary.CSVPath, summary.Upserted, summary.Skipped, summary.Duration.Round(time.Millisecond))
 	return nil
 }
 
@@ -155,15 +248,95 @@ func runSearch(ctx context.Context, args []string) error {
 	modelPath := fs.String("model", "", "path to encoder ONNX model")
 	tokenizerPath := fs.String("tokenizer", "", "path to tokenizer.json")
 	maxSeqLen := fs.Int("max-seq-len", -1, "maximum sequence length for the encoder")
+	sparseHead := fs.String("sparse-head", "", "path to bge-m3 sparse_linear weights (JSON) for lexical weights")
+	truncation := fs.String("truncation", "", "truncation for over-length inputs: head, tail or middle")
+	normalize := fs.String("normalize", "", "comma-separated text normalization steps before encoding: nfkc,width,space")
 	tableName := fs.String("table", "", "logical table/dataset to search")
+	sparseWeight := fs.Float64("sparse-weight", 0, "weight of the sparse lexical score in hybrid ranking (0 uses config, negative disables)")
+	output := fs.String("output", outputJSON, "output format: json, jsonl, table or csv")
+	version := fs.String("version", "", "search this named version of the dataset instead of its live contents")
+	queriesFile := fs.String("queries-file", "", "run every query of a file (one per line, or JSON lines with id, query, dataset, topk and filters; - reads stdin) and print JSONL results")
+	batchSize := fs.Int("batch", 0, "queries encoded together with --queries-file (default 32)")
+	includeVectors := fs.Bool("include-vectors", false, "add the stored embedding of every result (json and jsonl output only)")
+	tieBreak := fs.String("tie-break", "", "order of results with equal scores: id (default), updated or ingestion")
+	scoreNormalization := fs.String("score-normalization", "", "rescale the returned scores: raw, minmax or softmax (default: search.score_normalization)")
+	scorerName := fs.String("scorer", "", "rescore the results with this registered scorer (see csvsearch.RegisterScorer)")
+	idsFile := fs.String("ids-file", "", "only search the records whose IDs a file lists, one per line (- reads stdin), e.g. to refine earlier results")
+	groupBy := fs.String("group-by", "", "collapse the results to the best --group-size per value of this metadata field")
+	groupSize := fs.Int("group-size", 0, "results kept per --group-by value (default 1)")
+	queryModel := fs.String("query-model", "", "encode the query with this model of embedding.models (must have produced the dataset's embeddings)")
+	nearPoint := fs.String("near", "", "keep records with coordinates and report their distance from this point (lat,lng)")
+	radiusKm := fs.Float64("radius-km", 0, "with --near, drop records farther than this many kilometres")
+	distanceWeight := fs.Float64("distance-weight", 0, "with --near, add distance-weight/(1+distance_km) to the score")
+	geoWeight := fs.Float64("geo-weight", 0, "with --near, blend proximity into the score: (1-geo-weight)*similarity + geo-weight*proximity (0 to 1)")
+	sortByDistance := fs.Bool("sort-by-distance", false, "with --near, order results closest first instead of by score")
 	var filterArgs filterFlag
-	fs.Var(&filterArgs, "filter", "metadata filter in the form field=value (repeatable)")
+	fs.Var(&filterArgs, "filter", "metadata filter such as field=value or field>=10 (repeatable)")
 
-	if err := fs.Parse(args); err != nil {
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	var near *csvsearch.Near
+	if point := strings.TrimSpace(*nearPoint); point != "" {
+		lat, lng, err := csvsearch.ParsePoint(point)
+		if err != nil {
+			return usageErrorf("--near: %v", err)
+		}
+		near = &csvsearch.Near{Lat: lat, Lng: lng, RadiusKm: *radiusKm, Weight: *distanceWeight, GeoWeight: *geoWeight, SortByDistance: *sortByDistance}
+	} else if flagWasProvided(fs, "radius-km") || flagWasProvided(fs, "distance-weight") || flagWasProvided(fs, "geo-weight") || *sortByDistance {
+		return usageErrorf("--radius-km, --distance-weight, --geo-weight and --sort-by-distance require --near")
+	}
+	var queries []csvsearch.BatchQuery
+	if path := strings.TrimSpace(*queriesFile); path != "" {
+		if strings.TrimSpace(*query) != "" {
+			return usageErrorf("--query and --queries-file are mutually exclusive")
+		}
+		if flagWasProvided(fs, "output") && *output != outputJSONL {
+			return usageErrorf("--queries-file always writes jsonl output")
+		}
+		if near != nil {
+			return usageErrorf("--near cannot be combined with --queries-file")
+		}
+		if strings.TrimSpace(*version) != "" {
+			return usageErrorf("--version cannot be combined with --queries-file")
+		}
+		if strings.TrimSpace(*groupBy) != "" {
+			return usageErrorf("--group-by cannot be combined with --queries-file")
+		}
+		if strings.TrimSpace(*queryModel) != "" {
+			return usageErrorf("--query-model cannot be combined with --queries-file")
+		}
+		if strings.TrimSpace(*idsFile) != "" {
+			return usageErrorf("--ids-file cannot be combined with --queries-file")
+		}
+		var err error
+		if queries, err = readBatchQueries(path); err != nil {
+			return err
+		}
+		if len(queries) == 0 {
+			return usageErrorf("%s contains no queries", path)
+		}
+	} else if strings.TrimSpace(*query) == "" && len(filterArgs) == 0 && strings.TrimSpace(*idsFile) == "" && near == nil {
+		return usageErrorf("query, --filter, --ids-file or --near is required")
+	}
+	var ids []string
+	if path := strings.TrimSpace(*idsFile); path != "" {
+		var err error
+		if ids, err = readIDs(path); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return usageErrorf("%s contains no IDs", path)
+		}
+	}
+	if flagWasProvided(fs, "group-size") && strings.TrimSpace(*groupBy) == "" {
+		return usageErrorf("--group-size requires --group-by")
+	}
+	if err := checkOutputFormat(*output); err != nil {
 		return err
 	}
-	if strings.TrimSpace(*query) == "" {
-		return fmt.Errorf("query is required")
+	if err := checkVectorOutput(*includeVectors, *output); err != nil {
+		return err
 	}
 
 	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
@@ -175,6 +348,9 @@ func runSearch(ctx context.Context, args []string) error {
 				ModelPath:         *modelPath,
 				TokenizerPath:     *tokenizerPath,
 				MaxSequenceLength: *maxSeqLen,
+				SparseHeadPath:    *sparseHead,
+				Truncation:        strings.TrimSpace(*truncation),
+				Normalize:         parseCSVList(*normalize),
 			},
 		},
 	})
@@ -183,22 +359,257 @@ func runSearch(ctx context.Context, args []string) error {
 	}
 	defer svc.Close()
 
+	if queries != nil {
+		return runBatchSearch(ctx, svc, csvsearch.BatchSearchOptions{
+			Queries:            queries,
+			Dataset:            strings.TrimSpace(*tableName),
+			TopK:               *topK,
+			Filters:            []csvsearch.Filter(filterArgs),
+			SparseWeight:       *sparseWeight,
+			BatchSize:          *batchSize,
+			TieBreak:           strings.TrimSpace(*tieBreak),
+			ScoreNormalization: strings.TrimSpace(*scoreNormalization),
+			Scorer:             strings.TrimSpace(*scorerName),
+			Source:             "cli",
+			IncludeVectors:     *includeVectors,
+		})
+	}
+
 	searchCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	results, err := svc.Search(searchCtx, csvsearch.SearchOptions{
-		Query:   strings.TrimSpace(*query),
-		Dataset: strings.TrimSpace(*tableName),
-		TopK:    *topK,
-		Filters: []csvsearch.Filter(filterArgs),
+		Query:              strings.TrimSpace(*query),
+		Dataset:            strings.TrimSpace(*tableName),
+		TopK:               *topK,
+		Filters:            []csvsearch.Filter(filterArgs),
+		IDs:                ids,
+		SparseWeight:       *sparseWeight,
+		Near:               near,
+		TieBreak:           strings.TrimSpace(*tieBreak),
+		GroupBy:            strings.TrimSpace(*groupBy),
+		GroupSize:          *groupSize,
+		ScoreNormalization: strings.TrimSpace(*scoreNormalization),
+		Scorer:             strings.TrimSpace(*scorerName),
+		Source:             "cli",
+		IncludeVectors:     *includeVectors,
+		Version:            strings.TrimSpace(*version),
+		Model:              strings.TrimSpace(*queryModel),
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeResults(os.Stdout, *output, results); err != nil {
+		return err
+	}
+	if q := strings.TrimSpace(*query); q != "" {
+		suggestion, err := svc.Suggest(searchCtx, csvsearch.SuggestOptions{Query: q, Dataset: strings.TrimSpace(*tableName)})
+		if err != nil {
+			return err
+		}
+		if suggestion != "" {
+			fmt.Fprintf(os.Stderr, "did you mean: %s\n", suggestion)
+		}
+	}
+	return nil
+}
+
+// readBatchQueries parses a --queries-file; "-" reads stdin.
+// readIDs reads the record IDs of a file (- for stdin), one per line;
+// blank lines are skipped.
+func readIDs(path string) ([]string, error) {
+	in := os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		in = file
+	}
+	var ids []string
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		if id := strings.TrimSpace(scanner.Text()); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ids, nil
+}
+
+func readBatchQueries(path string) ([]csvsearch.BatchQuery, error) {
+	if path == "-" {
+		queries, err := csvsearch.ParseBatchQueries(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("read stdin: %w", err)
+		}
+		return queries, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	queries, err := csvsearch.ParseBatchQueries(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return queries, nil
+}
+
+// runBatchSearch writes one JSON line per query to stdout. Failed queries
+// carry an "error" field and do not stop the run.
+func runBatchSearch(ctx context.Context, svc *csvsearch.Service, opts csvsearch.BatchSearchOptions) error {
+	buffered := bufio.NewWriter(os.Stdout)
+	encoder := json.NewEncoder(buffered)
+	summary, err := svc.SearchBatch(ctx, opts, func(r csvsearch.BatchResult) error {
+		if r.Error != "" {
+			slog.Warn("query failed", "id", r.ID, "query", r.Query, "error", r.Error)
+		}
+		return encoder.Encode(r)
+	})
+	if ferr := buffered.Flush(); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		return err
+	}
+	if progressEnabled() {
+		fmt.Fprintf(os.Stderr, "ran %d queries (%d failed)\n", summary.Queries, summary.Failed)
+	}
+	return nil
+}
+
+func runEmbed(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("embed", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	dbPath := fs.String("db", "", "path to SQLite database")
+	ortLib := fs.String("ort-lib", "", "path to ONNX Runtime shared library")
+	modelPath := fs.String("model", "", "path to encoder ONNX model")
+	tokenizerPath := fs.String("tokenizer", "", "path to tokenizer.json")
+	maxSeqLen := fs.Int("max-seq-len", -1, "maximum sequence length for the encoder")
+	sparseHead := fs.String("sparse-head", "", "path to bge-m3 sparse_linear weights (JSON) for lexical weights")
+	truncation := fs.String("truncation", "", "truncation for over-length inputs: head, tail or middle")
+	normalize := fs.String("normalize", "", "comma-separated text normalization steps before encoding: nfkc,width,space")
+	sparse := fs.Bool("sparse", false, "also print the bge-m3 lexical weights (requires --sparse-head)")
+	output := fs.String("output", outputJSON, "output format: json or jsonl")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s embed [options] [text ...]\n\nTexts are read one per line from stdin when none are given.\n\n", programName())
+		fs.PrintDefaults()
+	}
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *output != outputJSON && *output != outputJSONL {
+		return usageErrorf("unsupported output format %q (want json or jsonl)", *output)
+	}
+	texts := fs.Args()
+	if len(texts) == 0 {
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				texts = append(texts, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("read stdin: %w", err)
+		}
+	}
+	if len(texts) == 0 {
+		return usageErrorf("at least one text is required")
+	}
+
+	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
+		Config:   csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Database: csvsearch.DatabaseOptions{Path: *dbPath},
+		Encoder: csvsearch.EncoderOptions{
+			Config: csvsearch.EncoderConfig{
+				OrtLibrary:        *ortLib,
+				ModelPath:         *modelPath,
+				TokenizerPath:     *tokenizerPath,
+				MaxSequenceLength: *maxSeqLen,
+				SparseHeadPath:    *sparseHead,
+				Truncation:        strings.TrimSpace(*truncation),
+				Normalize:         parseCSVList(*normalize),
+			},
+		},
 	})
 	if err != nil {
 		return err
 	}
+	defer svc.Close()
 
+	embeddings, err := svc.Embed(ctx, csvsearch.EmbedOptions{Texts: texts, Sparse: *sparse})
+	if err != nil {
+		return err
+	}
 	encoder := json.NewEncoder(os.Stdout)
+	if *output == outputJSONL {
+		for _, e := range embeddings {
+			if err := encoder.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 	encoder.SetIndent("", "  ")
-	return encoder.Encode(results)
+	return encoder.Encode(embeddings)
+}
+
+func runSimilar(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("similar", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	dbPath := fs.String("db", "", "path to SQLite database")
+	id := fs.String("id", "", "id of the record to find neighbours for")
+	dataset := fs.String("dataset", "", "dataset the record belongs to")
+	topK := fs.Int("topk", -1, "number of results to return")
+	sparseWeight := fs.Float64("sparse-weight", 0, "weight of the stored sparse lexical score (0 uses config, negative disables)")
+	output := fs.String("output", outputJSON, "output format: json, jsonl, table or csv")
+	includeVectors := fs.Bool("include-vectors", false, "add the stored embedding of every result (json and jsonl output only)")
+	tieBreak := fs.String("tie-break", "", "order of results with equal scores: id (default), updated or ingestion")
+	var filterArgs filterFlag
+	fs.Var(&filterArgs, "filter", "metadata filter such as field=value or field>=10 (repeatable)")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*id) == "" {
+		return usageErrorf("--id is required")
+	}
+	if err := checkOutputFormat(*output); err != nil {
+		return err
+	}
+	if err := checkVectorOutput(*includeVectors, *output); err != nil {
+		return err
+	}
+
+	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
+		Config:   csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Database: csvsearch.DatabaseOptions{Path: *dbPath},
+	})
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+
+	results, err := svc.Similar(ctx, csvsearch.SimilarOptions{
+		ID:             strings.TrimSpace(*id),
+		Dataset:        strings.TrimSpace(*dataset),
+		TopK:           *topK,
+		Filters:        []csvsearch.Filter(filterArgs),
+		SparseWeight:   *sparseWeight,
+		TieBreak:       strings.TrimSpace(*tieBreak),
+		IncludeVectors: *includeVectors,
+	})
+	if err != nil {
+		return err
+	}
+	return writeResults(os.Stdout, *output, results)
 }
 
 func runServe(ctx context.Context, args []string) error {
@@ -206,16 +617,42 @@ func runServe(ctx context.Context, args []string) error {
 	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
 	dbPath := fs.String("db", "", "path to SQLite database")
 	addr := fs.String("addr", ":8080", "address for the HTTP server (host:port)")
+	grpcAddr := fs.String("grpc-addr", "", "address for the gRPC server (host:port, empty disables gRPC)")
 	tableName := fs.String("table", "", "default dataset to search")
 	topK := fs.Int("topk", -1, "default number of results to return")
+	sparseWeight := fs.Float64("sparse-weight", 0, "default weight of the sparse lexical score (0 uses config, negative disables)")
 	ortLib := fs.String("ort-lib", "", "path to ONNX Runtime shared library")
 	modelPath := fs.String("model", "", "path to encoder ONNX model")
 	tokenizerPath := fs.String("tokenizer", "", "path to tokenizer.json")
 	maxSeqLen := fs.Int("max-seq-len", -1, "maximum sequence length for the encoder")
+	sparseHead := fs.String("sparse-head", "", "path to bge-m3 sparse_linear weights (JSON) for lexical weights")
+	truncation := fs.String("truncation", "", "truncation for over-length inputs: head, tail or middle")
+	normalize := fs.String("normalize", "", "comma-separated text normalization steps before encoding: nfkc,width,space")
 	requestTimeout := fs.Duration("request-timeout", 30*time.Second, "maximum duration for each search request")
 	shutdownTimeout := fs.Duration("shutdown-timeout", 5*time.Second, "graceful shutdown timeout")
+	adminToken := fs.String("admin-token", "", "bearer token required by /admin endpoints (default: localhost only)")
+	tlsCert := fs.String("tls-cert", "", "TLS certificate (PEM) to serve HTTPS; reloaded when the file changes")
+	tlsKey := fs.String("tls-key", "", "TLS private key (PEM) matching --tls-cert")
+	noUI := fs.Bool("no-ui", false, "disable the embedded search page at /")
+	noSchedule := fs.Bool("no-schedule", false, "do not re-ingest the datasets that have a schedule in the config")
+	replicaSource := fs.String("replica-source", "", "serve as a read replica of this database snapshot (path or http(s) URL, e.g. a published backup)")
+	replicaInterval := fs.Duration("replica-interval", time.Minute, "how often a replica checks --replica-source for a new snapshot")
+	accessLog := fs.String("access-log", "", "write per-request access logs to stdout: common or json (empty disables)")
+	maxUpload := fs.Int64("max-upload-bytes", 0, "maximum size of CSV uploads to POST /ingest (default 256 MiB)")
+	rateLimit := fs.Float64("rate-limit", 0, "maximum requests per second across all clients (0 disables)")
+	rateBurst := fs.Int("rate-burst", 0, "burst size for --rate-limit (default: the rate rounded up)")
+	clientRateLimit := fs.Float64("client-rate-limit", 0, "maximum requests per second per tenant API key or IP (0 disables)")
+	maxInFlight := fs.Int("max-in-flight", 0, "maximum concurrently executing requests (0 means unlimited)")
+	maxQueue := fs.Int("max-queue", 0, "requests allowed to wait for --max-in-flight slots before 503 responses")
+	cacheTTL := fs.Duration("cache-ttl", 0, "cache responses of identical searches for this long (0 disables)")
+	cacheSize := fs.Int("cache-size", 0, "maximum number of cached search responses (default 1024)")
+	clientRateBurst := fs.Int("client-rate-burst", 0, "burst size for --client-rate-limit (default: the rate rounded up)")
+	queryLog := fs.Bool("query-log", false, "record every search in the query_log table (also enabled by query_log.enabled)")
+	queryLogRetention := fs.Duration("query-log-retention", 0, "prune query log entries older than this (0 uses query_log.retention_days)")
+	watchConfig := fs.Duration("watch-config", 0, "poll the config file at this interval and apply changed search defaults and dataset mappings (0 disables; SIGHUP always reloads)")
+	pprofAddr := fs.String("pprof-addr", "", "serve net/http/pprof profiles on this address, e.g. localhost:6060 (empty disables)")
 
-	if err := fs.Parse(args); err != nil {
+	if err := parseFlags(fs, args); err != nil {
 		return err
 	}
 
@@ -228,8 +665,15 @@ func runServe(ctx context.Context, args []string) error {
 				ModelPath:         *modelPath,
 				TokenizerPath:     *tokenizerPath,
 				MaxSequenceLength: *maxSeqLen,
+				SparseHeadPath:    *sparseHead,
+				Truncation:        strings.TrimSpace(*truncation),
+				Normalize:         parseCSVList(*normalize),
 			},
 		},
+		QueryLog: csvsearch.QueryLogOptions{
+			Enabled:   *queryLog,
+			Retention: *queryLogRetention,
+		},
 	})
 	if err != nil {
 		return err
@@ -239,79 +683,1782 @@ func runServe(ctx context.Context, args []string) error {
 	serveCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	if addr := strings.TrimSpace(*pprofAddr); addr != "" {
+		if err := startPprof(serveCtx, addr); err != nil {
+			return err
+		}
+	}
+
+	// SIGHUP re-reads the config file, as with --watch-config.
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+	reloadConfig := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-serveCtx.Done():
+				return
+			case <-hangups:
+				select {
+				case reloadConfig <- struct{}{}:
+				case <-serveCtx.Done():
+					return
+				}
+			}
+		}
+	}()
+
 	return svc.StartServer(serveCtx, csvsearch.ServeOptions{
 		Address:         *addr,
 		Dataset:         strings.TrimSpace(*tableName),
 		TopK:            *topK,
+		SparseWeight:    *sparseWeight,
 		RequestTimeout:  *requestTimeout,
 		ShutdownTimeout: *shutdownTimeout,
+		AdminToken:      *adminToken,
+		GRPCAddress:     strings.TrimSpace(*grpcAddr),
+		RateLimit: csvsearch.RateLimitOptions{
+			RequestsPerSecond:          *rateLimit,
+			Burst:                      *rateBurst,
+			PerClientRequestsPerSecond: *clientRateLimit,
+			PerClientBurst:             *clientRateBurst,
+		},
+		TLSCertFile:      strings.TrimSpace(*tlsCert),
+		TLSKeyFile:       strings.TrimSpace(*tlsKey),
+		MaxUploadBytes:   *maxUpload,
+		DisableUI:        *noUI,
+		AccessLogFormat:  strings.TrimSpace(*accessLog),
+		MaxInFlight:      *maxInFlight,
+		MaxQueue:         *maxQueue,
+		CacheTTL:         *cacheTTL,
+		CacheSize:        *cacheSize,
+		WatchConfig:      *watchConfig,
+		ReloadConfig:     reloadConfig,
+		DisableSchedules: *noSchedule,
+		ReplicaSource:    strings.TrimSpace(*replicaSource),
+		ReplicaInterval:  *replicaInterval,
 	})
 }
 
-func usage() {
-	exe := filepath.Base(os.Args[0])
-	fmt.Fprintf(os.Stderr, `Usage: %s <command> [options]
+func runReloadModel(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("reload-model", flag.ExitOnError)
+	serverURL := fs.String("server", "http://127.0.0.1:8080", "base URL of the running csv-search server")
+	adminToken := fs.String("admin-token", "", "bearer token configured on the server")
+	ortLib := fs.String("ort-lib", "", "path to ONNX Runtime shared library (empty keeps current)")
+	modelPath := fs.String("model", "", "path to encoder ONNX model (empty keeps current)")
+	tokenizerPath := fs.String("tokenizer", "", "path to tokenizer.json (empty keeps current)")
+	maxSeqLen := fs.Int("max-seq-len", 0, "maximum sequence length for the encoder (0 keeps current)")
+	sparseHead := fs.String("sparse-head", "", "path to bge-m3 sparse_linear weights (empty keeps current)")
+	truncation := fs.String("truncation", "", "truncation strategy: head, tail or middle (empty keeps current)")
+	normalize := fs.String("normalize", "", "comma-separated normalization steps: nfkc,width,space (empty keeps current)")
+	timeout := fs.Duration("timeout", 5*time.Minute, "maximum time to wait for the reload")
 
-Commands:
-  init      Initialize the SQLite database schema
-  ingest    Ingest CSV data and generate embeddings
-  search    Perform a semantic vector search
-  serve     Start the long-running HTTP search server
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(map[string]any{
+		"ort_lib":     strings.TrimSpace(*ortLib),
+		"model":       strings.TrimSpace(*modelPath),
+		"tokenizer":   strings.TrimSpace(*tokenizerPath),
+		"max_seq_len": *maxSeqLen,
+		"sparse_head": strings.TrimSpace(*sparseHead),
+		"truncation":  strings.TrimSpace(*truncation),
+		"normalize":   parseCSVList(*normalize),
+	})
+	if err != nil {
+		return err
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	endpoint := strings.TrimRight(strings.TrimSpace(*serverURL), "/") + "/admin/reload-model"
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := strings.TrimSpace(*adminToken); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
 
-Use "%s <command> -h" to see command-specific options.
-`, exe, exe)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("reload failed (%s): %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	_, err = os.Stdout.Write(body)
+	return err
 }
 
-func flagWasProvided(fs *flag.FlagSet, name string) bool {
-	provided := false
-	fs.Visit(func(f *flag.Flag) {
-		if f.Name == name {
-			provided = true
-		}
+func runParity(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("parity", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	dbPath := fs.String("db", "", "path to SQLite database used to sample texts")
+	tableName := fs.String("table", "", "dataset to sample texts from")
+	ortLib := fs.String("ort-lib", "", "path to ONNX Runtime shared library")
+	refModel := fs.String("reference-model", "", "path to the reference (fp32) ONNX model (default: configured model)")
+	refTokenizer := fs.String("reference-tokenizer", "", "tokenizer for the reference model (default: configured tokenizer)")
+	modelPath := fs.String("model", "", "path to the candidate ONNX model, e.g. an int8-quantized export")
+	tokenizerPath := fs.String("tokenizer", "", "tokenizer for the candidate model (default: configured tokenizer)")
+	maxSeqLen := fs.Int("max-seq-len", -1, "maximum sequence length for both encoders")
+	samples := fs.Int("samples", 16, "number of stored texts to compare when --text is not given")
+	threshold := fs.Float64("threshold", 0.98, "minimum acceptable cosine similarity per sample")
+	var texts stringList
+	fs.Var(&texts, "text", "text to compare (repeatable)")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*modelPath) == "" {
+		return usageErrorf("model is required")
+	}
+
+	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
+		Config:   csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Database: csvsearch.DatabaseOptions{Path: *dbPath},
+		Encoder: csvsearch.EncoderOptions{
+			Config: csvsearch.EncoderConfig{
+				OrtLibrary:        *ortLib,
+				MaxSequenceLength: *maxSeqLen,
+			},
+		},
 	})
-	return provided
-}
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
 
-func parseCSVList(value string) []string {
-	if strings.TrimSpace(value) == "" {
-		return nil
+	report, err := svc.ParityCheck(ctx, csvsearch.ParityOptions{
+		Reference: csvsearch.EncoderConfig{
+			ModelPath:     strings.TrimSpace(*refModel),
+			TokenizerPath: strings.TrimSpace(*refTokenizer),
+		},
+		Candidate: csvsearch.EncoderConfig{
+			ModelPath:     strings.TrimSpace(*modelPath),
+			TokenizerPath: strings.TrimSpace(*tokenizerPath),
+		},
+		Texts:     texts,
+		Table:     strings.TrimSpace(*tableName),
+		Samples:   *samples,
+		Threshold: *threshold,
+	})
+	if err != nil {
+		return err
 	}
-	var result []string
-	for _, part := range strings.Split(value, ",") {
-		trimmed := strings.TrimSpace(part)
-		if trimmed != "" {
-			result = append(result, trimmed)
-		}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
 	}
-	return result
+	if !report.Passed {
+		return withCode(codeCheckFailed, fmt.Errorf("parity check failed: min cosine %.4f below threshold %.4f", report.MinCosine, report.Threshold))
+	}
+	return nil
 }
 
-type filterFlag []csvsearch.Filter
+func runDrift(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("drift", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	dbPath := fs.String("db", "", "path to SQLite database used to sample texts")
+	tableName := fs.String("table", "", "dataset to sample texts from")
+	ortLib := fs.String("ort-lib", "", "path to ONNX Runtime shared library")
+	refModel := fs.String("reference-model", "", "path to the current ONNX model (default: configured model)")
+	refTokenizer := fs.String("reference-tokenizer", "", "tokenizer for the current model (default: configured tokenizer)")
+	modelPath := fs.String("model", "", "path to the ONNX model considered as an upgrade")
+	tokenizerPath := fs.String("tokenizer", "", "tokenizer for the new model (default: configured tokenizer)")
+	maxSeqLen := fs.Int("max-seq-len", -1, "maximum sequence length for both encoders")
+	samples := fs.Int("samples", 100, "number of stored texts to compare when --text is not given")
+	topK := fs.Int("topk", 10, "neighbours of every sample compared between the models")
+	var texts stringList
+	fs.Var(&texts, "text", "text to compare (repeatable)")
 
-func (f *filterFlag) String() string {
-	if f == nil || len(*f) == 0 {
-		return ""
+	if err := parseFlags(fs, args); err != nil {
+		return err
 	}
-	parts := make([]string, 0, len(*f))
-	for _, filter := range *f {
-		parts = append(parts, fmt.Sprintf("%s=%s", filter.Field, filter.Value))
+	if strings.TrimSpace(*modelPath) == "" {
+		return usageErrorf("model is required")
+	}
+	if *topK <= 0 {
+		return usageErrorf("--topk must be positive")
 	}
-	return strings.Join(parts, ",")
-}
 
-func (f *filterFlag) Set(value string) error {
-	if strings.TrimSpace(value) == "" {
-		return fmt.Errorf("filter must be in the form field=value")
+	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
+		Config:   csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Database: csvsearch.DatabaseOptions{Path: *dbPath},
+		Encoder: csvsearch.EncoderOptions{
+			Config: csvsearch.EncoderConfig{
+				OrtLibrary:        *ortLib,
+				MaxSequenceLength: *maxSeqLen,
+			},
+		},
+	})
+	if err != nil {
+		return err
 	}
-	parts := strings.SplitN(value, "=", 2)
-	if len(parts) != 2 {
-		return fmt.Errorf("filter must be in the form field=value")
+	defer svc.Close()
+
+	report, err := svc.ModelDrift(ctx, csvsearch.DriftOptions{
+		Baseline: csvsearch.EncoderConfig{
+			ModelPath:     strings.TrimSpace(*refModel),
+			TokenizerPath: strings.TrimSpace(*refTokenizer),
+		},
+		Candidate: csvsearch.EncoderConfig{
+			ModelPath:     strings.TrimSpace(*modelPath),
+			TokenizerPath: strings.TrimSpace(*tokenizerPath),
+		},
+		Texts:   texts,
+		Table:   strings.TrimSpace(*tableName),
+		Samples: *samples,
+		TopK:    *topK,
+	})
+	if err != nil {
+		return err
 	}
-	field := strings.TrimSpace(parts[0])
-	val := strings.TrimSpace(parts[1])
-	if field == "" {
-		return fmt.Errorf("filter field must not be empty")
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+func runQueryReport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("query-report", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	dbPath := fs.String("db", "", "path to SQLite database")
+	since := fs.Duration("since", 7*24*time.Hour, "summarise searches logged within this duration")
+	tableName := fs.String("table", "", "only include searches against this dataset")
+	limit := fs.Int("limit", 20, "number of top and zero-result queries to list")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
+		Config:   csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Database: csvsearch.DatabaseOptions{Path: *dbPath},
+	})
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+
+	report, err := svc.QueryReport(ctx, csvsearch.QueryReportOptions{
+		Since:   time.Now().Add(-*since),
+		Dataset: strings.TrimSpace(*tableName),
+		Limit:   *limit,
+	})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+func runTune(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("tune", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	dbPath := fs.String("db", "", "path to SQLite database")
+	since := fs.Duration("since", 30*24*time.Hour, "fit the feedback recorded within this duration")
+	tableName := fs.String("table", "", "dataset whose feedback is fitted")
+	maxBoost := fs.Float64("max-boost", 0.2, "boost of a field that always told the selected result apart")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *maxBoost < 0 {
+		return usageErrorf("--max-boost must not be negative")
+	}
+
+	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
+		Config:   csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Database: csvsearch.DatabaseOptions{Path: *dbPath},
+	})
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+
+	fit, err := svc.TuneBoosts(ctx, csvsearch.TuneOptions{
+		Dataset:  strings.TrimSpace(*tableName),
+		Since:    time.Now().Add(-*since),
+		MaxBoost: *maxBoost,
+	})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(fit)
+}
+
+func runExport(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	dbPath := fs.String("db", "", "path to SQLite database")
+	tableName := fs.String("table", "", "dataset to export")
+	format := fs.String("format", csvsearch.ExportJSONL, "output format: jsonl or csv, or npy or fvecs for the embeddings alone")
+	output := fs.String("output", "", "file to write (default: stdout)")
+	idsPath := fs.String("ids", "", "with npy or fvecs: file receiving the record IDs, one per line (default: the output path with .ids.txt)")
+	withEmbeddings := fs.Bool("include-embeddings", false, "include dense embeddings and sparse weights")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	switch strings.ToLower(strings.TrimSpace(*format)) {
+	case csvsearch.VectorsNPY, csvsearch.VectorsFvecs:
+		ref := csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")}
+		return exportVectors(ctx, ref, *dbPath, strings.TrimSpace(*tableName), *format, strings.TrimSpace(*output), strings.TrimSpace(*idsPath))
+	}
+
+	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
+		Config:   csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Database: csvsearch.DatabaseOptions{Path: *dbPath},
+	})
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+
+	var w io.Writer = os.Stdout
+	if path := strings.TrimSpace(*output); path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := file.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}()
+		w = file
+	}
+	buffered := bufio.NewWriter(w)
+
+	summary, err := svc.Export(ctx, buffered, csvsearch.ExportOptions{
+		Dataset:           strings.TrimSpace(*tableName),
+		Format:            *format,
+		IncludeEmbeddings: *withEmbeddings,
+	})
+	if err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d records from %s as %s\n", summary.Records, summary.Table, summary.Format)
+	return nil
+}
+
+// exportVectors implements export --format npy|fvecs, which writes the
+// embeddings and their IDs to two files.
+func exportVectors(ctx context.Context, ref csvsearch.ConfigReference, dbPath, dataset, format, output, idsPath string) error {
+	if output == "" {
+		return usageErrorf("--output is required with --format %s", format)
+	}
+	if idsPath == "" {
+		idsPath = strings.TrimSuffix(output, filepath.Ext(output)) + ".ids.txt"
+	}
+	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
+		Config:   ref,
+		Database: csvsearch.DatabaseOptions{Path: dbPath},
+	})
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+
+	create := func(path string) (*os.File, *bufio.Writer, error) {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return file, bufio.NewWriter(file), nil
+	}
+	vectorsFile, vectors, err := create(output)
+	if err != nil {
+		return err
+	}
+	defer vectorsFile.Close()
+	idsFile, ids, err := create(idsPath)
+	if err != nil {
+		return err
+	}
+	defer idsFile.Close()
+
+	summary, err := svc.ExportVectors(ctx, vectors, ids, csvsearch.VectorExportOptions{Dataset: dataset, Format: format})
+	if err != nil {
+		return err
+	}
+	for _, file := range []struct {
+		f *os.File
+		w *bufio.Writer
+	}{{vectorsFile, vectors}, {idsFile, ids}} {
+		if err := file.w.Flush(); err != nil {
+			return err
+		}
+		if err := file.f.Close(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "exported %d vectors of dimension %d from %s as %s (ids in %s)\n", summary.Vectors, summary.Dimension, summary.Table, summary.Format, idsPath)
+	return nil
+}
+
+func runImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	dbPath := fs.String("db", "", "path to SQLite database")
+	input := fs.String("input", "", "JSON Lines file written by export (default: stdin)")
+	vectorsPath := fs.String("vectors", "", "import externally computed embeddings from this .npy or .fvecs file instead of records")
+	idsPath := fs.String("ids", "", "with --vectors: record IDs of the vectors, one per line (default: the vectors path with .ids.txt)")
+	dataset := fs.String("dataset", "", "with --vectors: dataset whose records receive the vectors")
+	modelVersion := fs.String("model-version", "", "model version stored with the embeddings (default: embedding.model_version or the model file name)")
+	ortLib := fs.String("ort-lib", "", "path to ONNX Runtime shared library")
+	modelPath := fs.String("model", "", "path to encoder ONNX model")
+	tokenizerPath := fs.String("tokenizer", "", "path to tokenizer.json")
+	maxSeqLen := fs.Int("max-seq-len", -1, "maximum sequence length for the encoder")
+	sparseHead := fs.String("sparse-head", "", "path to bge-m3 sparse_linear weights (JSON) for lexical weights")
+	truncation := fs.String("truncation", "", "truncation for over-length inputs: head, tail or middle")
+	normalize := fs.String("normalize", "", "comma-separated text normalization steps before encoding: nfkc,width,space")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
+		Config:   csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Database: csvsearch.DatabaseOptions{Path: *dbPath},
+		Encoder: csvsearch.EncoderOptions{
+			Config: csvsearch.EncoderConfig{
+				OrtLibrary:        *ortLib,
+				ModelPath:         *modelPath,
+				TokenizerPath:     *tokenizerPath,
+				MaxSequenceLength: *maxSeqLen,
+				SparseHeadPath:    *sparseHead,
+				Truncation:        strings.TrimSpace(*truncation),
+				Normalize:         parseCSVList(*normalize),
+				ModelVersion:      strings.TrimSpace(*modelVersion),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+
+	if path := strings.TrimSpace(*vectorsPath); path != "" {
+		ids := strings.TrimSpace(*idsPath)
+		if ids == "" {
+			ids = strings.TrimSuffix(path, filepath.Ext(path)) + ".ids.txt"
+		}
+		vectorsFile, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer vectorsFile.Close()
+		idsFile, err := os.Open(ids)
+		if err != nil {
+			return err
+		}
+		defer idsFile.Close()
+		summary, err := svc.ImportVectors(ctx, bufio.NewReader(vectorsFile), idsFile, csvsearch.VectorImportOptions{
+			Dataset: strings.TrimSpace(*dataset),
+			Format:  csvsearch.VectorFormat(path),
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "imported %d vectors of dimension %d into %s (%d ids without a record)\n", summary.Vectors, summary.Dimension, summary.Table, summary.Missing)
+		return nil
+	}
+
+	var r io.Reader = os.Stdin
+	if path := strings.TrimSpace(*input); path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	summary, err := svc.Import(ctx, r)
+	for _, ds := range summary.Datasets {
+		fmt.Fprintf(os.Stderr, "imported %d records into %s (%d unchanged, %d dropped)\n", ds.Upserted, ds.Table, ds.Skipped, ds.Dropped)
+	}
+	return err
+}
+
+func runDelete(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	dbPath := fs.String("db", "", "path to SQLite database")
+	dataset := fs.String("dataset", "", "dataset to delete from")
+	yes := fs.Bool("yes", false, "delete without asking for confirmation")
+	var ids stringList
+	fs.Var(&ids, "id", "record id to delete (repeatable)")
+	var filterArgs filterFlag
+	fs.Var(&filterArgs, "filter", "delete records whose metadata matches field=value, field>=10, ... (repeatable, AND)")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if len(ids) == 0 && len(filterArgs) == 0 {
+		return usageErrorf("at least one --id or --filter is required")
+	}
+
+	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
+		Config:   csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Database: csvsearch.DatabaseOptions{Path: *dbPath},
+	})
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+
+	name := strings.TrimSpace(*dataset)
+	targets := []string(ids)
+	if len(filterArgs) > 0 {
+		matched, err := svc.FindIDs(ctx, name, []csvsearch.Filter(filterArgs))
+		if err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			// --id and --filter together delete only the listed ids that
+			// also match the filters.
+			wanted := make(map[string]bool, len(ids))
+			for _, id := range ids {
+				wanted[strings.TrimSpace(id)] = true
+			}
+			targets = targets[:0:0]
+			for _, id := range matched {
+				if wanted[id] {
+					targets = append(targets, id)
+				}
+			}
+		} else {
+			targets = matched
+		}
+	}
+	if len(targets) == 0 {
+		fmt.Fprintln(os.Stderr, "no matching records")
+		return nil
+	}
+
+	if !*yes {
+		label := name
+		if label == "" {
+			label = "the default dataset"
+		}
+		ok, err := confirm(fmt.Sprintf("Delete %d record(s) from %s?", len(targets), label))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errAborted
+		}
+	}
+
+	deleted, err := svc.Delete(ctx, name, targets)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "deleted %d record(s)\n", deleted)
+	return nil
+}
+
+func runDedupe(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("dedupe", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	dbPath := fs.String("db", "", "path to SQLite database")
+	dataset := fs.String("dataset", "", "dataset to scan")
+	threshold := fs.Float64("threshold", 0.95, "cosine similarity from which two records are duplicates")
+	tag := fs.String("tag", "", "set this metadata field of every duplicate to the id of the record kept")
+	merge := fs.Bool("merge", false, "fill the empty fields of the first record of every group from its duplicates and delete them")
+	yes := fs.Bool("yes", false, "merge without asking for confirmation")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *threshold <= 0 || *threshold > 1 {
+		return usageErrorf("--threshold must be in (0, 1]")
+	}
+	if *merge && strings.TrimSpace(*tag) != "" {
+		return usageErrorf("--tag and --merge are mutually exclusive")
+	}
+
+	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
+		Config:   csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Database: csvsearch.DatabaseOptions{Path: *dbPath},
+	})
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+
+	opts := csvsearch.DedupeOptions{Dataset: strings.TrimSpace(*dataset), Threshold: *threshold, Tag: strings.TrimSpace(*tag)}
+	if *merge && !*yes {
+		// Report first so that the merge can be confirmed against it.
+		report, err := svc.Dedupe(ctx, opts)
+		if err != nil {
+			return err
+		}
+		if len(report.Groups) == 0 {
+			return writeDedupeReport(report, *asJSON)
+		}
+		duplicates := 0
+		for _, g := range report.Groups {
+			duplicates += len(g.Duplicates)
+		}
+		ok, err := confirm(fmt.Sprintf("Merge and delete %d duplicate record(s) of %s?", duplicates, report.Dataset))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errAborted
+		}
+	}
+	opts.Merge = *merge
+	report, err := svc.Dedupe(ctx, opts)
+	if err != nil {
+		return err
+	}
+	return writeDedupeReport(report, *asJSON)
+}
+
+func writeDedupeReport(report csvsearch.DedupeReport, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	fmt.Fprintf(os.Stdout, "%s: %d records, %d pairs at or above %g in %d groups\n",
+		report.Dataset, report.Records, len(report.Pairs), report.Threshold, len(report.Groups))
+	for _, p := range report.Pairs {
+		fmt.Fprintf(os.Stdout, "%.4f\t%s\t%s\n", p.Score, p.A, p.B)
+	}
+	for _, g := range report.Groups {
+		fmt.Fprintf(os.Stdout, "keep %s: %s\n", g.Keep, strings.Join(g.Duplicates, ", "))
+	}
+	if report.Tagged > 0 {
+		fmt.Fprintf(os.Stderr, "tagged %d record(s)\n", report.Tagged)
+	}
+	if report.Merged > 0 {
+		fmt.Fprintf(os.Stderr, "merged %d record(s)\n", report.Merged)
+	}
+	return nil
+}
+
+// confirm asks a yes/no question on stderr and reads the answer from stdin.
+func confirm(question string) (bool, error) {
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+func runStats(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	dbPath := fs.String("db", "", "path to SQLite database")
+	output := fs.String("output", outputTable, "output format: table, json, jsonl or csv (csv lists the datasets)")
+	asJSON := fs.Bool("json", false, "shorthand for --output json")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *asJSON {
+		*output = outputJSON
+	}
+	if err := checkOutputFormat(*output); err != nil {
+		return err
+	}
+
+	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
+		Config:   csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Database: csvsearch.DatabaseOptions{Path: *dbPath},
+	})
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+
+	stats, err := svc.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	switch *output {
+	case outputJSON, outputJSONL:
+		encoder := json.NewEncoder(os.Stdout)
+		if *output == outputJSON {
+			encoder.SetIndent("", "  ")
+		}
+		return encoder.Encode(stats)
+	case outputCSV:
+		return writeRecords(os.Stdout, outputCSV, stats.Datasets, datasetStatsHeader, datasetStatsRow)
+	}
+
+	fmt.Printf("Database:        %s\n", stats.DatabasePath)
+	fmt.Printf("Size:            %s\n", formatBytes(stats.SizeBytes))
+	fmt.Printf("Schema version:  %d\n\n", stats.SchemaVersion)
+
+	return writeRecords(os.Stdout, outputTable, stats.Datasets, datasetStatsHeader, func(ds csvsearch.DatasetInfo) []string {
+		row := datasetStatsRow(ds)
+		if ds.Default {
+			row[0] += " *"
+		}
+		return row
+	})
+}
+
+var datasetStatsHeader = []string{"dataset", "table", "records", "vectors", "dim", "sparse", "fts", "rtree"}
+
+func datasetStatsRow(ds csvsearch.DatasetInfo) []string {
+	return []string{ds.Name, ds.Table, strconv.FormatInt(ds.Rows, 10), strconv.FormatInt(ds.Vectors, 10), strconv.FormatInt(ds.Dimension, 10),
+		strconv.FormatInt(ds.Sparse, 10), strconv.FormatInt(ds.FTS, 10), strconv.FormatInt(ds.Geo, 10)}
+}
+
+func runDatasets(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("datasets", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	dbPath := fs.String("db", "", "path to SQLite database")
+	output := fs.String("output", outputTable, "output format: table, json, jsonl or csv")
+	asJSON := fs.Bool("json", false, "shorthand for --output json")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *asJSON {
+		*output = outputJSON
+	}
+	if err := checkOutputFormat(*output); err != nil {
+		return err
+	}
+
+	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
+		Config:   csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Database: csvsearch.DatabaseOptions{Path: *dbPath},
+	})
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+
+	datasets, err := svc.Datasets(ctx)
+	if err != nil {
+		return err
+	}
+
+	type datasetStatus struct {
+		csvsearch.DatasetInfo
+		Status string `json:"status"`
+	}
+	out := make([]datasetStatus, len(datasets))
+	mismatches := 0
+	for i, ds := range datasets {
+		out[i] = datasetStatus{DatasetInfo: ds, Status: "ok"}
+		switch {
+		case ds.Configured && ds.Rows == 0:
+			out[i].Status = "configured but empty"
+			mismatches++
+		case !ds.Configured:
+			out[i].Status = "present but unconfigured"
+			mismatches++
+		}
+	}
+
+	err = writeRecords(os.Stdout, *output, out, []string{"name", "table", "records", "status"}, func(ds datasetStatus) []string {
+		name := ds.Name
+		if ds.Default && *output == outputTable {
+			name += " *"
+		}
+		return []string{name, ds.Table, strconv.FormatInt(ds.Rows, 10), ds.Status}
+	})
+	if err != nil {
+		return err
+	}
+	if mismatches > 0 && *output == outputTable {
+		fmt.Fprintf(os.Stderr, "%d dataset(s) differ between the configuration and the database\n", mismatches)
+	}
+	return nil
+}
+
+func runVersions(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("versions", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	dbPath := fs.String("db", "", "path to SQLite database")
+	dataset := fs.String("dataset", "", "dataset whose versions to list (default: the configured default)")
+	promote := fs.String("promote", "", "make this version the live contents of the dataset")
+	remove := fs.String("delete", "", "delete this version and its records")
+	output := fs.String("output", outputTable, "output format: table, json, jsonl or csv")
+	asJSON := fs.Bool("json", false, "shorthand for --output json")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *asJSON {
+		*output = outputJSON
+	}
+	if err := checkOutputFormat(*output); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*promote) != "" && strings.TrimSpace(*remove) != "" {
+		return usageErrorf("--promote and --delete are mutually exclusive")
+	}
+
+	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
+		Config:   csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Database: csvsearch.DatabaseOptions{Path: *dbPath},
+	})
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+
+	name := strings.TrimSpace(*dataset)
+	switch {
+	case strings.TrimSpace(*promote) != "":
+		v, err := svc.PromoteVersion(ctx, name, strings.TrimSpace(*promote))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "promoted version %s of %s (%d records)\n", v.Version, v.Dataset, v.Records)
+	case strings.TrimSpace(*remove) != "":
+		if err := svc.DeleteVersion(ctx, name, strings.TrimSpace(*remove)); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "deleted version %s\n", strings.TrimSpace(*remove))
+	}
+
+	versions, err := svc.Versions(ctx, name)
+	if err != nil {
+		return err
+	}
+	return writeRecords(os.Stdout, *output, versions, []string{"version", "table", "records", "created", "promoted", "live"}, func(v csvsearch.DatasetVersion) []string {
+		promoted := ""
+		if v.Promoted != nil {
+			promoted = v.Promoted.Format(time.RFC3339)
+		}
+		live := ""
+		if v.Live {
+			live = "yes"
+		}
+		return []string{v.Version, v.Table, strconv.FormatInt(v.Records, 10), v.Created.Format(time.RFC3339), promoted, live}
+	})
+}
+
+func runReembed(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("reembed", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	dbPath := fs.String("db", "", "path to SQLite database")
+	dataset := fs.String("dataset", "", "dataset to re-embed (default: every dataset)")
+	batchSize := fs.Int("batch", 0, "records per transaction batch (default 1000)")
+	workers := fs.Int("workers", runtime.GOMAXPROCS(0), "number of texts encoded in parallel")
+	sparse := fs.Bool("sparse", false, "compute bge-m3 sparse weights for every record")
+	staleOnly := fs.Bool("stale-only", false, "only re-embed records whose stored model version differs from the active model")
+	modelVersion := fs.String("model-version", "", "model version stored with the embeddings (default: embedding.model_version or the model file name)")
+	ortLib := fs.String("ort-lib", "", "path to ONNX Runtime shared library")
+	modelPath := fs.String("model", "", "path to encoder ONNX model")
+	tokenizerPath := fs.String("tokenizer", "", "path to tokenizer.json")
+	maxSeqLen := fs.Int("max-seq-len", -1, "maximum sequence length for the encoder")
+	sparseHead := fs.String("sparse-head", "", "path to bge-m3 sparse_linear weights (JSON) for lexical weights")
+	truncation := fs.String("truncation", "", "truncation for over-length inputs: head, tail or middle")
+	normalize := fs.String("normalize", "", "comma-separated text normalization steps before encoding: nfkc,width,space")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
+		Config:   csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Database: csvsearch.DatabaseOptions{Path: *dbPath},
+		Encoder: csvsearch.EncoderOptions{
+			Config: csvsearch.EncoderConfig{
+				OrtLibrary:        *ortLib,
+				ModelPath:         *modelPath,
+				TokenizerPath:     *tokenizerPath,
+				MaxSequenceLength: *maxSeqLen,
+				SparseHeadPath:    *sparseHead,
+				Truncation:        strings.TrimSpace(*truncation),
+				Normalize:         parseCSVList(*normalize),
+				ModelVersion:      strings.TrimSpace(*modelVersion),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+
+	summary, err := svc.Reembed(ctx, csvsearch.ReembedOptions{
+		Dataset:   strings.TrimSpace(*dataset),
+		BatchSize: *batchSize,
+		Sparse:    *sparse,
+		StaleOnly: *staleOnly,
+		Workers:   *workers,
+		Progress: func(done, total int) {
+			if progressEnabled() {
+				fmt.Fprintf(os.Stderr, "\rre-embedded %d/%d records", done, total)
+			}
+		},
+	})
+	if progressEnabled() && (summary.Records > 0 || err != nil) {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "re-embedded %d records with model %q in %s\n", summary.Records, svc.ModelVersion(), summary.Duration.Round(time.Millisecond))
+	return nil
+}
+
+func runBench(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	dbPath := fs.String("db", "", "path to SQLite database")
+	tableName := fs.String("table", "", "logical table/dataset to search")
+	queriesPath := fs.String("queries", "", "file with one query per line (default: generated from stored texts)")
+	samples := fs.Int("samples", 100, "number of queries generated from stored texts when --queries is not set")
+	iterations := fs.Int("iterations", 1, "number of passes over the query set")
+	concurrency := fs.Int("concurrency", 1, "number of searches run in parallel")
+	warmup := fs.Int("warmup", 5, "searches run before measuring")
+	topK := fs.Int("topk", -1, "number of results per search")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	ortLib := fs.String("ort-lib", "", "path to ONNX Runtime shared library")
+	modelPath := fs.String("model", "", "path to encoder ONNX model")
+	tokenizerPath := fs.String("tokenizer", "", "path to tokenizer.json")
+	maxSeqLen := fs.Int("max-seq-len", -1, "maximum sequence length for the encoder")
+	sparseHead := fs.String("sparse-head", "", "path to bge-m3 sparse_linear weights (JSON) for lexical weights")
+	truncation := fs.String("truncation", "", "truncation for over-length inputs: head, tail or middle")
+	normalize := fs.String("normalize", "", "comma-separated text normalization steps before encoding: nfkc,width,space")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	var queries []string
+	if path := strings.TrimSpace(*queriesPath); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read queries: %w", err)
+		}
+		queries = strings.Split(string(data), "\n")
+	}
+
+	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
+		Config:   csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Database: csvsearch.DatabaseOptions{Path: *dbPath},
+		Encoder: csvsearch.EncoderOptions{
+			Config: csvsearch.EncoderConfig{
+				OrtLibrary:        *ortLib,
+				ModelPath:         *modelPath,
+				TokenizerPath:     *tokenizerPath,
+				MaxSequenceLength: *maxSeqLen,
+				SparseHeadPath:    *sparseHead,
+				Truncation:        strings.TrimSpace(*truncation),
+				Normalize:         parseCSVList(*normalize),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+
+	report, err := svc.Bench(ctx, csvsearch.BenchOptions{
+		Dataset:     strings.TrimSpace(*tableName),
+		Queries:     queries,
+		Samples:     *samples,
+		Iterations:  *iterations,
+		Concurrency: *concurrency,
+		Warmup:      *warmup,
+		TopK:        *topK,
+	})
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	fmt.Printf("Table:        %s\n", report.Table)
+	fmt.Printf("Searches:     %d (%d errors, concurrency %d)\n", report.Queries, report.Errors, report.Concurrency)
+	fmt.Printf("Duration:     %.1f ms\n", report.DurationMS)
+	fmt.Printf("Throughput:   %.1f queries/s\n", report.QPS)
+	fmt.Printf("Memory:       heap %s, sys %s, %s allocated per query, %d GC cycles\n",
+		formatBytes(int64(report.Memory.HeapAllocBytes)), formatBytes(int64(report.Memory.SysBytes)),
+		formatBytes(int64(report.Memory.AllocPerQueryBytes)), report.Memory.GarbageCollections)
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STAGE\tP50 ms\tP95 ms\tP99 ms\tMEAN ms\tMAX ms")
+	for _, row := range []struct {
+		name  string
+		stats csvsearch.LatencyStats
+	}{{"total", report.Latency}, {"encode", report.Encode}, {"scan", report.Scan}} {
+		fmt.Fprintf(w, "%s\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\n", row.name, row.stats.P50MS, row.stats.P95MS, row.stats.P99MS, row.stats.MeanMS, row.stats.MaxMS)
+	}
+	return w.Flush()
+}
+
+// runConfig implements "config show". Without --effective it prints the
+// configuration file as read (includes merged, references expanded); with it,
+// the settings a command would actually run with.
+func runConfig(args []string) error {
+	fs := flag.NewFlagSet("config show", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	effective := fs.Bool("effective", false, "apply flag overrides and defaults and make paths absolute")
+	dbPath := fs.String("db", "", "path to SQLite database (with --effective)")
+	ortLib := fs.String("ort-lib", "", "path to ONNX Runtime shared library (with --effective)")
+	modelPath := fs.String("model", "", "path to encoder ONNX model (with --effective)")
+	tokenizerPath := fs.String("tokenizer", "", "path to tokenizer.json (with --effective)")
+	maxSeqLen := fs.Int("max-seq-len", -1, "maximum sequence length for the encoder (with --effective)")
+	sparseHead := fs.String("sparse-head", "", "path to bge-m3 sparse_linear weights (with --effective)")
+	truncation := fs.String("truncation", "", "truncation for over-length inputs: head, tail or middle (with --effective)")
+	normalize := fs.String("normalize", "", "comma-separated text normalization steps: nfkc,width,space (with --effective)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s config show [--effective] [options]\n", programName())
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 || args[0] != "show" {
+		fs.Usage()
+		return usageErrorf("config requires the show subcommand")
+	}
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usageErrorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	ref := csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")}
+
+	var (
+		doc map[string]any
+		err error
+	)
+	if *effective {
+		doc, err = csvsearch.EffectiveConfig(csvsearch.ServiceOptions{
+			Config:   ref,
+			Database: csvsearch.DatabaseOptions{Path: *dbPath},
+			Encoder: csvsearch.EncoderOptions{
+				Config: csvsearch.EncoderConfig{
+					OrtLibrary:        *ortLib,
+					ModelPath:         *modelPath,
+					TokenizerPath:     *tokenizerPath,
+					MaxSequenceLength: *maxSeqLen,
+					SparseHeadPath:    *sparseHead,
+					Truncation:        strings.TrimSpace(*truncation),
+					Normalize:         parseCSVList(*normalize),
+				},
+			},
+		})
+	} else {
+		var overrides []string
+		fs.Visit(func(f *flag.Flag) {
+			if f.Name != "config" && f.Name != "effective" {
+				overrides = append(overrides, "--"+f.Name)
+			}
+		})
+		if len(overrides) > 0 {
+			return usageErrorf("%s: only valid with --effective", strings.Join(overrides, ", "))
+		}
+		doc, err = csvsearch.LoadedConfig(ref)
+	}
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+func runVersion(args []string) error {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	ortLib := fs.String("ort-lib", "", "path to ONNX Runtime shared library")
+	asJSON := fs.Bool("json", false, "print the version information as JSON")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	info := csvsearch.DescribeVersion(csvsearch.ServiceOptions{
+		Config:  csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Encoder: csvsearch.EncoderOptions{Config: csvsearch.EncoderConfig{OrtLibrary: *ortLib}},
+	})
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(info)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Version:\t%s\n", info.Version)
+	fmt.Fprintf(w, "Commit:\t%s\n", orUnknown(info.Commit))
+	fmt.Fprintf(w, "Built:\t%s\n", orUnknown(info.BuildDate))
+	fmt.Fprintf(w, "Go:\t%s %s\n", info.GoVersion, info.Platform)
+	if info.OnnxRuntime != "" {
+		fmt.Fprintf(w, "ONNX Runtime:\t%s\n", info.OnnxRuntime)
+	} else {
+		fmt.Fprintf(w, "ONNX Runtime:\tunavailable (%s)\n", info.OnnxRuntimeError)
+	}
+	return w.Flush()
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+func runDoctor(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	dbPath := fs.String("db", "", "path to SQLite database")
+	asJSON := fs.Bool("json", false, "print the checks as JSON")
+	ortLib := fs.String("ort-lib", "", "path to ONNX Runtime shared library")
+	modelPath := fs.String("model", "", "path to encoder ONNX model")
+	tokenizerPath := fs.String("tokenizer", "", "path to tokenizer.json")
+	sparseHead := fs.String("sparse-head", "", "path to bge-m3 sparse_linear weights (JSON) for lexical weights")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	report := csvsearch.Diagnose(ctx, csvsearch.ServiceOptions{
+		Config:   csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Database: csvsearch.DatabaseOptions{Path: *dbPath},
+		Encoder: csvsearch.EncoderOptions{
+			Config: csvsearch.EncoderConfig{
+				OrtLibrary:     *ortLib,
+				ModelPath:      *modelPath,
+				TokenizerPath:  *tokenizerPath,
+				SparseHeadPath: *sparseHead,
+			},
+		},
+	})
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, c := range report.Checks {
+			fmt.Fprintf(w, "[%s]\t%s\t%s\n", c.Status, c.Name, c.Detail)
+			if c.Fix != "" {
+				fmt.Fprintf(w, "\t\t-> %s\n", c.Fix)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	if !report.Healthy() {
+		return withCode(codeCheckFailed, errors.New("doctor found problems"))
+	}
+	return nil
+}
+
+func runReindex(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("reindex", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	dbPath := fs.String("db", "", "path to SQLite database")
+	fts := fs.Bool("fts", false, "rebuild the full-text indexes")
+	rtree := fs.Bool("rtree", false, "rebuild the R-tree")
+	pages := fs.Bool("pages", false, "rebuild the vector pages scanned by unfiltered searches")
+	vectors := fs.Bool("vectors", false, "check the stored vectors")
+	jsonOut := fs.Bool("json", false, "print the summary as JSON")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
+		Config:   csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Database: csvsearch.DatabaseOptions{Path: *dbPath},
+	})
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+
+	summary, err := svc.Reindex(ctx, csvsearch.ReindexOptions{FTS: *fts, RTree: *rtree, Pages: *pages, Vectors: *vectors})
+	if err != nil {
+		return err
+	}
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(summary); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintf(os.Stdout, "rtree: %d entries\nfts:   %d added, %d removed (trigram: %d)\npages: %d\n",
+			summary.RTreeRows, summary.FTSAdded, summary.FTSRemoved, summary.TrigramRows, summary.VectorPages)
+		for _, check := range summary.Vectors {
+			fmt.Fprintf(os.Stdout, "vectors %s: %d stored (dim %d), %d missing, %d invalid, %d mismatched\n",
+				check.Dataset, check.Vectors, check.Dimension, check.Missing, check.Invalid, check.Mismatched)
+		}
+	}
+	for _, check := range summary.Vectors {
+		if !check.OK() {
+			return withCode(codeCheckFailed, fmt.Errorf("dataset %q has missing or invalid vectors; run reembed to repair them", check.Dataset))
+		}
+	}
+	return nil
+}
+
+func runFsck(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	dbPath := fs.String("db", "", "path to SQLite database")
+	ortLib := fs.String("ort-lib", "", "path to ONNX Runtime shared library (re-embeds records without vectors with --repair)")
+	modelPath := fs.String("model", "", "path to ONNX model file")
+	tokenizerPath := fs.String("tokenizer", "", "path to tokenizer.json")
+	maxSeqLen := fs.Int("max-seq-len", 0, "maximum sequence length for tokenization")
+	sparseHead := fs.String("sparse-head", "", "path to bge-m3 sparse_linear weights (JSON) for lexical weights")
+	truncation := fs.String("truncation", "", "truncation for over-length inputs: head, tail or middle")
+	normalize := fs.String("normalize", "", "comma-separated text normalization steps before encoding: nfkc,width,space")
+	repair := fs.Bool("repair", false, "fix the inconsistencies found")
+	jsonOut := fs.Bool("json", false, "print the summary as JSON")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
+		Config:   csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Database: csvsearch.DatabaseOptions{Path: *dbPath},
+		Encoder: csvsearch.EncoderOptions{
+			Config: csvsearch.EncoderConfig{
+				OrtLibrary:        *ortLib,
+				ModelPath:         *modelPath,
+				TokenizerPath:     *tokenizerPath,
+				MaxSequenceLength: *maxSeqLen,
+				SparseHeadPath:    *sparseHead,
+				Truncation:        strings.TrimSpace(*truncation),
+				Normalize:         parseCSVList(*normalize),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+
+	summary, err := svc.Fsck(ctx, csvsearch.FsckOptions{Repair: *repair})
+	if err != nil {
+		return err
+	}
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(summary); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintf(os.Stdout, "records without vectors: %d\nvectors without records: %d\nsparse without records:  %d\nstale fts rows:          %d\nstale rtree entries:     %d\nmissing rtree entries:   %d\n",
+			summary.MissingVectors, summary.OrphanVectors, summary.OrphanSparse, summary.StaleFTS, summary.StaleRTree, summary.MissingRTree)
+		if summary.Repaired {
+			fmt.Fprintf(os.Stdout, "repaired: %d fixed, %d re-embedded\n", summary.Problems()-summary.MissingVectors, summary.Reembedded)
+		}
+	}
+	switch remaining := summary.Remaining(); {
+	case remaining == 0:
+		return nil
+	case summary.Repaired:
+		return withCode(codeCheckFailed, fmt.Errorf("%d records still have no vector; configure the encoder and run fsck --repair or reembed", remaining))
+	default:
+		return withCode(codeCheckFailed, fmt.Errorf("found %d inconsistencies; run fsck --repair to fix them", remaining))
+	}
+}
+
+func runCompact(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("compact", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	dbPath := fs.String("db", "", "path to SQLite database")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
+		Config:   csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Database: csvsearch.DatabaseOptions{Path: *dbPath},
+	})
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+
+	summary, err := svc.Compact(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "before: %s\nafter:  %s\n", formatBytes(summary.BytesBefore), formatBytes(summary.BytesAfter))
+	return nil
+}
+
+func runBackup(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	dbPath := fs.String("db", "", "path to SQLite database")
+	output := fs.String("output", "", "snapshot file (default: backups/<db>-<timestamp>.db next to the database)")
+	compress := fs.Bool("gzip", false, "gzip-compress the snapshot")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
+		Config:   csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Database: csvsearch.DatabaseOptions{Path: *dbPath},
+	})
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+
+	summary, err := svc.Backup(ctx, csvsearch.BackupOptions{Path: *output, Gzip: *compress})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "wrote %s (%s)\n", summary.Path, formatBytes(summary.Bytes))
+	return nil
+}
+
+func runRestore(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	configFlag := fs.String("config", "", "path to configuration file (default: csv-search_config.json if present)")
+	dbPath := fs.String("db", "", "path to SQLite database")
+	input := fs.String("input", "", "snapshot file written by backup (.db or .db.gz)")
+	yes := fs.Bool("yes", false, "restore without asking for confirmation")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	source := strings.TrimSpace(*input)
+	if source == "" && fs.NArg() > 0 {
+		source = fs.Arg(0)
+	}
+	if source == "" {
+		return usageErrorf("--input is required")
+	}
+
+	svc, err := csvsearch.NewService(csvsearch.ServiceOptions{
+		Config:   csvsearch.ConfigReference{Path: *configFlag, Required: flagWasProvided(fs, "config")},
+		Database: csvsearch.DatabaseOptions{Path: *dbPath},
+	})
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+
+	if !*yes {
+		ok, err := confirm(fmt.Sprintf("Replace %s with %s?", svc.DatabasePath(), source))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errAborted
+		}
+	}
+
+	if err := svc.Restore(ctx, source); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "restored %s from %s\n", svc.DatabasePath(), source)
+	return nil
+}
+
+// formatBytes renders n with a binary unit suffix.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// command describes a subcommand for the usage text and the completion
+// scripts. flags take a value and switches are boolean; keep both in sync
+// with the flag set of the run function.
+type command struct {
+	name     string
+	summary  string
+	flags    []string
+	switches []string
+}
+
+// encoderFlags are the encoder asset flags shared by the encoding commands.
+var encoderFlags = []string{"ort-lib", "model", "tokenizer", "max-seq-len", "sparse-head", "truncation", "normalize"}
+
+var commands = []command{
+	{name: "init", summary: "Initialize the SQLite database schema",
+		flags: []string{"config", "db"}},
+	{name: "ingest", summary: "Ingest CSV data and generate embeddings",
+		flags:    append([]string{"config", "db", "csv", "batch", "table", "id-col", "text-cols", "meta-cols", "lat-col", "lng-col", "duplicates", "version"}, encoderFlags...),
+		switches: []string{"sparse", "replace"}},
+	{name: "search", summary: "Perform a semantic vector search",
+		flags:    append([]string{"config", "db", "query", "queries-file", "batch", "topk", "table", "sparse-weight", "filter", "near", "radius-km", "distance-weight", "geo-weight", "tie-break", "score-normalization", "scorer", "ids-file", "group-by", "group-size", "query-model", "output", "version"}, encoderFlags...),
+		switches: []string{"include-vectors", "sort-by-distance"}},
+	{name: "similar", summary: "List the records closest to an existing record",
+		flags:    []string{"config", "db", "id", "dataset", "topk", "filter", "sparse-weight", "tie-break", "output"},
+		switches: []string{"include-vectors"}},
+	{name: "embed", summary: "Print the raw embedding vectors of texts as JSON",
+		flags:    append([]string{"config", "db", "output"}, encoderFlags...),
+		switches: []string{"sparse"}},
+	{name: "serve", summary: "Start the long-running HTTP search server",
+		flags: append([]string{"config", "db", "addr", "grpc-addr", "table", "topk", "sparse-weight", "request-timeout", "shutdown-timeout",
+			"admin-token", "tls-cert", "tls-key", "access-log", "max-upload-bytes", "rate-limit", "rate-burst", "client-rate-limit",
+			"client-rate-burst", "max-in-flight", "max-queue", "cache-ttl", "cache-size", "query-log-retention", "watch-config", "pprof-addr",
+			"replica-source", "replica-interval"}, encoderFlags...),
+		switches: []string{"no-ui", "query-log", "no-schedule"}},
+	{name: "reload-model", summary: "Swap the encoder model of a running server without restarting it",
+		flags: append([]string{"server", "admin-token", "timeout"}, encoderFlags...)},
+	{name: "parity", summary: "Compare a candidate (e.g. quantized) model against the reference model",
+		flags: []string{"config", "db", "table", "ort-lib", "reference-model", "reference-tokenizer", "model", "tokenizer", "max-seq-len", "samples", "threshold", "text"}},
+	{name: "drift", summary: "Compare how two models rank stored texts before a model upgrade",
+		flags: []string{"config", "db", "table", "ort-lib", "reference-model", "reference-tokenizer", "model", "tokenizer", "max-seq-len", "samples", "topk", "text"}},
+	{name: "reembed", summary: "Re-encode stored texts with the configured model",
+		flags:    append([]string{"config", "db", "dataset", "batch", "workers", "model-version"}, encoderFlags...),
+		switches: []string{"sparse", "stale-only"}},
+	{name: "doctor", summary: "Check the config, database schema, encoder assets and vector dimensions",
+		flags:    []string{"config", "db", "ort-lib", "model", "tokenizer", "sparse-head"},
+		switches: []string{"json"}},
+	{name: "bench", summary: "Measure search latency percentiles, throughput and memory use",
+		flags:    append([]string{"config", "db", "table", "queries", "samples", "iterations", "concurrency", "warmup", "topk"}, encoderFlags...),
+		switches: []string{"json"}},
+	{name: "reindex", summary: "Rebuild the full-text index and R-tree from records and check stored vectors",
+		flags:    []string{"config", "db"},
+		switches: []string{"fts", "rtree", "pages", "vectors", "json"}},
+	{name: "fsck", summary: "Find and optionally repair orphaned vectors, stale FTS rows and R-tree entries",
+		flags:    append([]string{"config", "db"}, encoderFlags...),
+		switches: []string{"repair", "json"}},
+	{name: "compact", summary: "Vacuum, optimize the FTS index, check the R-tree and truncate the WAL",
+		flags: []string{"config", "db"}},
+	{name: "backup", summary: "Write a snapshot of the database (optionally gzip-compressed)",
+		flags:    []string{"config", "db", "output"},
+		switches: []string{"gzip"}},
+	{name: "restore", summary: "Replace the database with a snapshot written by backup",
+		flags:    []string{"config", "db", "input"},
+		switches: []string{"yes"}},
+	{name: "datasets", summary: "List configured datasets and DB tables, flagging mismatches",
+		flags:    []string{"config", "db", "output"},
+		switches: []string{"json"}},
+	{name: "versions", summary: "List the named versions of a dataset, promote one to live or delete one",
+		flags:    []string{"config", "db", "dataset", "promote", "delete", "output"},
+		switches: []string{"json"}},
+	{name: "stats", summary: "Show database size, schema version and per-dataset counts",
+		flags:    []string{"config", "db", "output"},
+		switches: []string{"json"}},
+	{name: "delete", summary: "Delete records by id or metadata filter",
+		flags:    []string{"config", "db", "dataset", "id", "filter"},
+		switches: []string{"yes"}},
+	{name: "dedupe", summary: "Report near-duplicate records by embedding similarity, optionally tagging or merging them",
+		flags:    []string{"config", "db", "dataset", "threshold", "tag"},
+		switches: []string{"merge", "yes", "json"}},
+	{name: "export", summary: "Dump the records of a dataset as JSON Lines or CSV, or its embeddings as .npy or .fvecs",
+		flags:    []string{"config", "db", "table", "format", "output", "ids"},
+		switches: []string{"include-embeddings"}},
+	{name: "import", summary: "Load records written by export, keeping their embeddings, or external vectors",
+		flags: append([]string{"config", "db", "input", "vectors", "ids", "dataset", "model-version"}, encoderFlags...)},
+	{name: "query-report", summary: "Summarise logged searches: top queries, zero-result queries, latency",
+		flags: []string{"config", "db", "since", "table", "limit"}},
+	{name: "tune", summary: "Fit per-field search boosts from the results users selected (/feedback)",
+		flags: []string{"config", "db", "since", "table", "max-boost"}},
+	{name: "config", summary: "Print the loaded or effective configuration (config show [--effective]), secrets redacted",
+		flags:    append([]string{"config", "db"}, encoderFlags...),
+		switches: []string{"effective"}},
+	{name: "completion", summary: "Print a shell completion script (bash, zsh, fish or powershell)",
+		flags: []string{"config"}},
+	{name: "version", summary: "Print the build version, commit, build date and ONNX Runtime version",
+		flags:    []string{"config", "ort-lib"},
+		switches: []string{"json"}},
+}
+
+func usage() {
+	exe := filepath.Base(os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [options]\n\nCommands:\n", exe)
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s  %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nGlobal options (accepted anywhere on the command line):\n")
+	fmt.Fprintf(os.Stderr, "  --log-level    Log level: debug, info, warn or error (default info)\n")
+	fmt.Fprintf(os.Stderr, "  --verbose      Same as --log-level debug, including per-row ingest logs\n")
+	fmt.Fprintf(os.Stderr, "  --quiet        Only log errors and hide progress output\n")
+	fmt.Fprintf(os.Stderr, "  --json-errors  Print failures as {\"error\": message, \"code\": code} on stderr\n")
+	fmt.Fprintf(os.Stderr, "\nEvery flag can also be set through the environment as %s<FLAG>, with the\n", envPrefix)
+	fmt.Fprintf(os.Stderr, "flag name upper-cased and dashes replaced by underscores (e.g. CSVSEARCH_DB,\n")
+	fmt.Fprintf(os.Stderr, "CSVSEARCH_ORT_LIB), or for one command as %s<COMMAND>_<FLAG> (e.g.\n", envPrefix)
+	fmt.Fprintf(os.Stderr, "CSVSEARCH_EXPORT_OUTPUT). Command-line flags take precedence. The flags that\n")
+	fmt.Fprintf(os.Stderr, "select or confirm deletions (delete --yes/--id/--filter, dedupe --yes, restore\n")
+	fmt.Fprintf(os.Stderr, "--yes/--input, versions --delete, ingest --replace) are never read from it.\n")
+	fmt.Fprintf(os.Stderr, "\nExit status: 0 success, 1 error, 2 usage, 3 config, 4 database, 5 encoder,\n")
+	fmt.Fprintf(os.Stderr, "6 not found, 7 timeout, 8 file, 9 check failed, 10 aborted, 130 canceled.\n")
+	fmt.Fprintf(os.Stderr, "\nUse \"%s <command> -h\" to see command-specific options.\n", exe)
+}
+
+// parseGlobalFlags removes the flags shared by every command from args,
+// wherever they appear before a "--" terminator, and applies them to
+// logLevel: --log-level debug|info|warn|error, --verbose (debug) and --quiet
+// (errors only). The last one given wins; CSVSEARCH_LOG_LEVEL,
+// CSVSEARCH_VERBOSE and CSVSEARCH_QUIET apply first. --json-errors (or
+// CSVSEARCH_JSON_ERRORS) sets jsonErrors.
+func parseGlobalFlags(args []string) ([]string, error) {
+	logLevel.Set(slog.LevelInfo)
+	if value := os.Getenv(envName("log-level")); value != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return nil, fmt.Errorf("invalid %s %q (want debug, info, warn or error)", envName("log-level"), value)
+		}
+		logLevel.Set(level)
+	}
+	if enabled, _ := strconv.ParseBool(os.Getenv(envName("verbose"))); enabled {
+		logLevel.Set(slog.LevelDebug)
+	}
+	if enabled, _ := strconv.ParseBool(os.Getenv(envName("quiet"))); enabled {
+		logLevel.Set(slog.LevelError)
+	}
+	jsonErrors, _ = strconv.ParseBool(os.Getenv(envName("json-errors")))
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") {
+			name = ""
+		}
+		switch name {
+		case "verbose", "v":
+			logLevel.Set(slog.LevelDebug)
+		case "quiet", "q":
+			logLevel.Set(slog.LevelError)
+		case "json-errors":
+			jsonErrors = true
+		case "log-level":
+			if !hasValue {
+				if i+1 >= len(args) {
+					return nil, fmt.Errorf("--log-level requires a value")
+				}
+				i++
+				value = args[i]
+			}
+			var level slog.Level
+			if err := level.UnmarshalText([]byte(value)); err != nil {
+				return nil, fmt.Errorf("invalid --log-level %q (want debug, info, warn or error)", value)
+			}
+			logLevel.Set(level)
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, nil
+}
+
+// envPrefix prefixes the environment variables that provide flag defaults.
+const envPrefix = "CSVSEARCH_"
+
+// envName returns the environment variable for a flag: CSVSEARCH_ followed
+// by the upper-cased name with dashes replaced by underscores.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// commandOnlyEnvFlags lists, by command, the flags that mean something
+// different there than in the other commands, such as the file written by
+// export where search takes an output format. They are only read from the
+// command's own variable.
+var commandOnlyEnvFlags = map[string][]string{
+	"export": {"output"},
+	"backup": {"output"},
+}
+
+// noEnvFlags lists, by command, the flags that select or confirm the
+// destruction of data. They are never read from the environment, so that a
+// stray variable cannot turn a command into a deletion that nobody asked for.
+var noEnvFlags = map[string][]string{
+	"delete":   {"yes", "id", "filter"},
+	"dedupe":   {"yes"},
+	"restore":  {"yes", "input"},
+	"versions": {"delete"},
+	"ingest":   {"replace"},
+}
+
+// envNames returns the environment variables for a flag of command, most
+// specific first: CSVSEARCH_<COMMAND>_<FLAG>, then CSVSEARCH_<FLAG> unless
+// the flag is listed in commandOnlyEnvFlags. Flags listed in noEnvFlags
+// have none.
+func envNames(command, flagName string) []string {
+	if slices.Contains(noEnvFlags[command], flagName) {
+		return nil
+	}
+	names := []string{envName(strings.ReplaceAll(command, " ", "-") + "-" + flagName)}
+	if !slices.Contains(commandOnlyEnvFlags[command], flagName) {
+		names = append(names, envName(flagName))
+	}
+	return names
+}
+
+// parseFlags parses args, then sets the flags they did not mention from the
+// CSVSEARCH_* environment variables, so command-line flags take precedence
+// (repeatable flags such as --filter included). Flags set from the
+// environment count as provided for flagWasProvided.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	provided := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		provided[f.Name] = true
+	})
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || provided[f.Name] {
+			return
+		}
+		for _, name := range envNames(fs.Name(), f.Name) {
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				continue
+			}
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = usageErrorf("invalid value %q for %s: %v", value, name, setErr)
+			}
+			return
+		}
+	})
+	return err
+}
+
+// parseArgs parses the command-line flags of fs. With --json-errors,
+// invalid flags are returned as usage errors instead of printing the usage
+// text.
+func parseArgs(fs *flag.FlagSet, args []string) error {
+	if !jsonErrors {
+		return fs.Parse(args)
+	}
+	fs.Init(fs.Name(), flag.ContinueOnError)
+	output := fs.Output()
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			fs.SetOutput(output)
+			fs.Usage()
+			os.Exit(0)
+		}
+		return withCode(codeUsage, err)
+	}
+	return nil
+}
+
+// progressEnabled reports whether progress output should be written, which
+// --quiet suppresses.
+func progressEnabled() bool {
+	return logLevel.Level() <= slog.LevelInfo
+}
+
+func flagWasProvided(fs *flag.FlagSet, name string) bool {
+	provided := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			provided = true
+		}
+	})
+	return provided
+}
+
+func parseCSVList(value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	var result []string
+	for _, part := range strings.Split(value, ",") {
+		trimmed := strings.TrimSpace(part)
+		if trimmed != "" {
+			result = append(result, trimmed)
+		}
+	}
+	return result
+}
+
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("value must not be empty")
+	}
+	*l = append(*l, value)
+	return nil
+}
+
+type filterFlag []csvsearch.Filter
+
+func (f *filterFlag) String() string {
+	if f == nil || len(*f) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(*f))
+	for _, filter := range *f {
+		op := filter.Op
+		switch op {
+		case "":
+			op = "="
+		case "=", "!=", "<", "<=", ">", ">=":
+		default:
+			op = "@" + op + "="
+		}
+		parts = append(parts, filter.Field+op+filter.Value)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f *filterFlag) Set(value string) error {
+	filter, err := csvsearch.ParseFilter(value)
+	if err != nil {
+		return err
 	}
-	*f = append(*f, csvsearch.Filter{Field: field, Value: val})
+	filter.Value = strings.TrimSpace(filter.Value)
+	*f = append(*f, filter)
 	return nil
 }
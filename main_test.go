@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestParseFlagsEnvironment(t *testing.T) {
+	t.Setenv("CSVSEARCH_OUTPUT", "table")
+	t.Setenv("CSVSEARCH_TOPK", "7")
+	t.Setenv("CSVSEARCH_FILTER", "kind=b")
+
+	search := flag.NewFlagSet("search", flag.ContinueOnError)
+	output := search.String("output", "json", "")
+	topK := search.Int("topk", 10, "")
+	var filters filterFlag
+	search.Var(&filters, "filter", "")
+	if err := parseFlags(search, []string{"--topk", "3", "--filter", "kind=a"}); err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if *output != "table" || *topK != 3 {
+		t.Fatalf("unexpected flags: output=%q topk=%d", *output, *topK)
+	}
+	// The command-line filters replace the environment's instead of adding
+	// to them.
+	if got := filters.String(); got != "kind=a" {
+		t.Fatalf("expected only the command-line filter, got %q", got)
+	}
+
+	filters = nil
+	search = flag.NewFlagSet("search", flag.ContinueOnError)
+	search.Var(&filters, "filter", "")
+	if err := parseFlags(search, nil); err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if got := filters.String(); got != "kind=b" {
+		t.Fatalf("expected the filter from the environment, got %q", got)
+	}
+
+	// CSVSEARCH_OUTPUT is a format for search, not the file export writes;
+	// export only reads its own variable.
+	export := flag.NewFlagSet("export", flag.ContinueOnError)
+	path := export.String("output", "", "")
+	if err := parseFlags(export, nil); err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if *path != "" {
+		t.Fatalf("expected export to ignore CSVSEARCH_OUTPUT, got %q", *path)
+	}
+	t.Setenv("CSVSEARCH_EXPORT_OUTPUT", "records.jsonl")
+	export = flag.NewFlagSet("export", flag.ContinueOnError)
+	path = export.String("output", "", "")
+	if err := parseFlags(export, nil); err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if *path != "records.jsonl" {
+		t.Fatalf("expected the export output from CSVSEARCH_EXPORT_OUTPUT, got %q", *path)
+	}
+
+	// A command's own variable wins over the shared one.
+	t.Setenv("CSVSEARCH_SEARCH_TOPK", "5")
+	search = flag.NewFlagSet("search", flag.ContinueOnError)
+	topK = search.Int("topk", 10, "")
+	if err := parseFlags(search, nil); err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if *topK != 5 {
+		t.Fatalf("expected topk from CSVSEARCH_SEARCH_TOPK, got %d", *topK)
+	}
+
+	// Flags that select or confirm a deletion never come from the
+	// environment, even under the command's own name.
+	t.Setenv("CSVSEARCH_YES", "1")
+	t.Setenv("CSVSEARCH_ID", "victim")
+	t.Setenv("CSVSEARCH_DELETE_ID", "victim")
+	del := flag.NewFlagSet("delete", flag.ContinueOnError)
+	yes := del.Bool("yes", false, "")
+	var ids stringList
+	del.Var(&ids, "id", "")
+	filters = nil
+	del.Var(&filters, "filter", "")
+	if err := parseFlags(del, nil); err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if *yes || len(ids) != 0 || len(filters) != 0 || flagWasProvided(del, "yes") {
+		t.Fatalf("expected delete to ignore the environment, got yes=%t ids=%v filters=%v", *yes, ids, filters)
+	}
+
+	t.Setenv("CSVSEARCH_SEARCH_TOPK", "many")
+	search = flag.NewFlagSet("search", flag.ContinueOnError)
+	search.Int("topk", 10, "")
+	if err := parseFlags(search, nil); err == nil {
+		t.Fatalf("expected an error for an invalid environment value")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"yashubustudio/csv-search/pkg/csvsearch"
+)
+
+// Formats accepted by the --output flag of the listing commands.
+const (
+	outputJSON  = "json"
+	outputJSONL = "jsonl"
+	outputTable = "table"
+	outputCSV   = "csv"
+)
+
+func checkOutputFormat(format string) error {
+	switch format {
+	case outputJSON, outputJSONL, outputTable, outputCSV:
+		return nil
+	}
+	return usageErrorf("unsupported output format %q (want json, jsonl, table or csv)", format)
+}
+
+// checkVectorOutput rejects --include-vectors with the table and csv formats,
+// which have no column for the embedding.
+func checkVectorOutput(includeVectors bool, format string) error {
+	if includeVectors && format != outputJSON && format != outputJSONL {
+		return usageErrorf("--include-vectors requires json or jsonl output")
+	}
+	return nil
+}
+
+// writeRecords renders items as an indented JSON array, one JSON object per
+// line, an aligned table or CSV. The table and CSV forms use header and the
+// cells returned by row; table headers are upper-cased.
+func writeRecords[T any](w io.Writer, format string, items []T, header []string, row func(T) []string) error {
+	switch format {
+	case outputJSON:
+		if items == nil {
+			items = []T{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(items)
+	case outputJSONL:
+		encoder := json.NewEncoder(w)
+		for _, item := range items {
+			if err := encoder.Encode(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case outputTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		upper := make([]string, len(header))
+		for i, h := range header {
+			upper[i] = strings.ToUpper(h)
+		}
+		fmt.Fprintln(tw, strings.Join(upper, "\t"))
+		for _, item := range items {
+			cells := row(item)
+			for i, cell := range cells {
+				// Keep embedded tabs and newlines from breaking the columns.
+				cells[i] = strings.Join(strings.Fields(cell), " ")
+			}
+			fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		}
+		return tw.Flush()
+	case outputCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := cw.Write(row(item)); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return checkOutputFormat(format)
+}
+
+// writeResults renders search results with one column per metadata field,
+// plus distance_km for searches near a point.
+func writeResults(w io.Writer, format string, results []csvsearch.Result) error {
+	seen := make(map[string]bool)
+	var (
+		fields   []string
+		distance bool
+	)
+	for _, r := range results {
+		distance = distance || r.DistanceKm != nil
+		for name := range r.Fields {
+			if !seen[name] {
+				seen[name] = true
+				fields = append(fields, name)
+			}
+		}
+	}
+	sort.Strings(fields)
+	header := []string{"id", "score", "lat", "lng"}
+	if distance {
+		header = append(header, "distance_km")
+	}
+	header = append(header, fields...)
+	return writeRecords(w, format, results, header, func(r csvsearch.Result) []string {
+		cells := []string{r.ID, strconv.FormatFloat(r.Score, 'f', 6, 64), formatCoord(r.Lat), formatCoord(r.Lng)}
+		if distance {
+			cells = append(cells, formatCoord(r.DistanceKm))
+		}
+		for _, name := range fields {
+			cells = append(cells, r.Fields[name])
+		}
+		return cells
+	})
+}
+
+func formatCoord(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
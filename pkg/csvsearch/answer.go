@@ -0,0 +1,117 @@
+package csvsearch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"yashubustudio/csv-search/internal/answer"
+	intsearch "yashubustudio/csv-search/internal/search"
+	"yashubustudio/csv-search/internal/server"
+)
+
+// AnswerOptions describe a question answered by Service.Answer.
+type AnswerOptions struct {
+	// Query is both the search query and the question put to the model.
+	Query   string
+	Dataset string
+	Table   string
+	// TopK is the number of results given to the model (answer.topk from
+	// the config, or 5, when zero).
+	TopK    int
+	Filters []Filter
+	// Source labels the search in the query log ("library" when empty).
+	Source string
+}
+
+// Answer is a language model answer grounded in search results.
+type Answer struct {
+	Query string `json:"query"`
+	Text  string `json:"answer"`
+	// Citations are the ids of the results the answer cites, in the order
+	// they are first cited. Ids the model made up are left out.
+	Citations []string `json:"citations"`
+	Model     string   `json:"model,omitempty"`
+	// Results are the search results the model was given, best first.
+	Results []Result `json:"results"`
+}
+
+// Answer searches for opts.Query like Search and has the language model of
+// the answer config section answer it from the top results, citing them by
+// id. It fails when no answer provider is configured.
+func (s *Service) Answer(ctx context.Context, opts AnswerOptions) (*Answer, error) {
+	if strings.TrimSpace(opts.Query) == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	synth, topK, err := s.synthesizer()
+	if err != nil {
+		return nil, err
+	}
+	results, err := s.Search(ctx, SearchOptions{
+		Query:   opts.Query,
+		Dataset: opts.Dataset,
+		Table:   opts.Table,
+		TopK:    firstPositive(opts.TopK, topK),
+		Filters: opts.Filters,
+		Source:  opts.Source,
+	})
+	if err != nil {
+		return nil, err
+	}
+	got, err := synth.Answer(ctx, opts.Query, toSearchResults(results))
+	if err != nil {
+		return nil, err
+	}
+	if results == nil {
+		results = []Result{}
+	}
+	return &Answer{Query: strings.TrimSpace(opts.Query), Text: got.Text, Citations: got.Citations, Model: got.Model, Results: results}, nil
+}
+
+// answerConfigured reports whether the config enables answer synthesis.
+func (s *Service) answerConfigured() bool {
+	cfg := s.Config()
+	return cfg != nil && strings.TrimSpace(cfg.Answer.Provider) != ""
+}
+
+// synthesizer returns the answer synthesizer of the config and the number of
+// results it is given.
+func (s *Service) synthesizer() (*answer.Synthesizer, int, error) {
+	if !s.answerConfigured() {
+		return nil, 0, fmt.Errorf("answer synthesis is not configured (set answer.provider and answer.model)")
+	}
+	cfg := s.Config().Answer
+	synth, err := answer.New(answer.Options{
+		Provider:        cfg.Provider,
+		URL:             cfg.URL,
+		Model:           cfg.Model,
+		APIKey:          cfg.APIKey,
+		MaxContextChars: cfg.MaxContextChars,
+		Timeout:         time.Duration(cfg.TimeoutSeconds) * time.Second,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return synth, firstPositive(cfg.TopK, 5), nil
+}
+
+func (s *Service) serverAnswer(ctx context.Context, question string, results []intsearch.Result) (server.Answer, error) {
+	synth, _, err := s.synthesizer()
+	if err != nil {
+		return server.Answer{}, err
+	}
+	got, err := synth.Answer(ctx, question, results)
+	if err != nil {
+		return server.Answer{}, err
+	}
+	return server.Answer{Text: got.Text, Citations: got.Citations, Model: got.Model}, nil
+}
+
+func toSearchResults(results []Result) []intsearch.Result {
+	out := make([]intsearch.Result, len(results))
+	for i, r := range results {
+		out[i] = intsearch.Result(r)
+	}
+	return out
+}
@@ -0,0 +1,234 @@
+package csvsearch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"yashubustudio/csv-search/internal/config"
+	intsearch "yashubustudio/csv-search/internal/search"
+)
+
+// defaultBatchSize is the number of queries SearchBatch encodes per
+// EncodeBatch call.
+const defaultBatchSize = 32
+
+// BatchQuery is one search of a batch. Empty fields fall back to the
+// defaults in BatchSearchOptions.
+type BatchQuery struct {
+	ID      string            `json:"id,omitempty"`
+	Query   string            `json:"query"`
+	Dataset string            `json:"dataset,omitempty"`
+	TopK    int               `json:"topk,omitempty"`
+	Filters map[string]string `json:"filters,omitempty"`
+}
+
+// BatchResult is the outcome of one BatchQuery. A failed query has Error set
+// and does not stop the batch.
+type BatchResult struct {
+	ID      string   `json:"id,omitempty"`
+	Query   string   `json:"query"`
+	Dataset string   `json:"dataset"`
+	Results []Result `json:"results"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// BatchSearchOptions configure SearchBatch.
+type BatchSearchOptions struct {
+	Queries []BatchQuery
+	// Dataset, Table and TopK apply to queries that do not set their own.
+	Dataset string
+	Table   string
+	TopK    int
+	// Filters are added to the filters of every query.
+	Filters      []Filter
+	SparseWeight float64
+	// BatchSize is the number of queries encoded together (defaults to 32).
+	BatchSize int
+	// TieBreak, ScoreNormalization and Scorer behave like those of
+	// SearchOptions.
+	TieBreak           string
+	ScoreNormalization string
+	Scorer             string
+	// Source labels the searches in the query log ("library" when empty).
+	Source string
+	// IncludeVectors returns the stored embedding of every result.
+	IncludeVectors bool
+}
+
+// BatchSummary counts the queries run by SearchBatch.
+type BatchSummary struct {
+	Queries int
+	Failed  int
+}
+
+// ParseBatchQueries reads one query per line from r. Lines starting with
+// "{" are decoded as a JSON BatchQuery (e.g. {"id":"q1","query":"...",
+// "filters":{"field":"value"}}); any other non-blank line is the query text.
+func ParseBatchQueries(r io.Reader) ([]BatchQuery, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	var queries []BatchQuery
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if !strings.HasPrefix(text, "{") {
+			queries = append(queries, BatchQuery{Query: text})
+			continue
+		}
+		var q BatchQuery
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&q); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if strings.TrimSpace(q.Query) == "" {
+			return nil, fmt.Errorf("line %d: query is required", line)
+		}
+		queries = append(queries, q)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return queries, nil
+}
+
+// SearchBatch runs every query of opts and passes each outcome to fn in
+// input order. Dense queries are encoded BatchSize at a time with a single
+// EncodeBatch call; hybrid queries (per the options or the dataset's search
+// settings) are encoded one by one because they need the lexical weights as
+// well. An error returned by fn stops the batch.
+func (s *Service) SearchBatch(ctx context.Context, opts BatchSearchOptions, fn func(BatchResult) error) (BatchSummary, error) {
+	if err := s.ready(ctx); err != nil {
+		return BatchSummary{}, err
+	}
+	if len(opts.Queries) == 0 {
+		return BatchSummary{}, fmt.Errorf("at least one query is required")
+	}
+	for i, q := range opts.Queries {
+		if strings.TrimSpace(q.Query) == "" {
+			return BatchSummary{}, fmt.Errorf("query %d is empty", i+1)
+		}
+	}
+	if err := intsearch.ValidateTieBreak(opts.TieBreak); err != nil {
+		return BatchSummary{}, err
+	}
+	if err := intsearch.ValidateScoreNormalization(opts.ScoreNormalization); err != nil {
+		return BatchSummary{}, err
+	}
+	if err := s.ensureDatabase(ctx); err != nil {
+		return BatchSummary{}, err
+	}
+
+	size := firstPositive(opts.BatchSize, defaultBatchSize)
+
+	var summary BatchSummary
+	for start := 0; start < len(opts.Queries); start += size {
+		chunk := opts.Queries[start:min(start+size, len(opts.Queries))]
+		cfg := s.Config()
+		plans := make([]searchPlan, len(chunk))
+		var dense []int
+		for i, q := range chunk {
+			plans[i] = batchPlan(cfg, opts, q)
+			if !plans[i].hybrid() {
+				dense = append(dense, i)
+			}
+		}
+		vecs := make([][]float32, len(chunk))
+		if len(dense) > 0 {
+			texts := make([]string, len(dense))
+			for j, i := range dense {
+				texts[j] = strings.TrimSpace(chunk[i].Query)
+			}
+			encoded, err := s.encodeTexts(texts)
+			if err != nil {
+				return summary, err
+			}
+			for j, i := range dense {
+				vecs[i] = encoded[j]
+			}
+		}
+		for i, q := range chunk {
+			if err := ctx.Err(); err != nil {
+				return summary, err
+			}
+			result := s.batchSearch(ctx, opts, q, plans[i], vecs[i])
+			summary.Queries++
+			if result.Error != "" {
+				summary.Failed++
+			}
+			if err := fn(result); err != nil {
+				return summary, err
+			}
+		}
+	}
+	return summary, nil
+}
+
+func (s *Service) encodeTexts(texts []string) ([][]float32, error) {
+	enc, release, err := s.acquireEncoder()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	vecs, err := enc.EncodeBatch(texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vecs) != len(texts) {
+		return nil, fmt.Errorf("encoder returned %d vectors for %d texts", len(vecs), len(texts))
+	}
+	return vecs, nil
+}
+
+// batchPlan resolves a query of a batch: its own dataset and topK first,
+// then the batch defaults.
+func batchPlan(cfg *config.Config, opts BatchSearchOptions, q BatchQuery) searchPlan {
+	dataset, table := strings.TrimSpace(q.Dataset), opts.Table
+	if dataset == "" {
+		dataset = opts.Dataset
+	} else {
+		table = ""
+	}
+	plan := planSearch(cfg, dataset, table, firstPositive(q.TopK, opts.TopK), opts.SparseWeight)
+	plan.normalization = firstNonEmpty(strings.TrimSpace(opts.ScoreNormalization), plan.normalization)
+	return plan
+}
+
+func (s *Service) batchSearch(ctx context.Context, opts BatchSearchOptions, q BatchQuery, plan searchPlan, vec []float32) BatchResult {
+	filters := append([]Filter{}, opts.Filters...)
+	fields := make([]string, 0, len(q.Filters))
+	for field := range q.Filters {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		filters = append(filters, Filter{Field: field, Value: q.Filters[field]})
+	}
+
+	search := SearchOptions{
+		Query:          strings.TrimSpace(q.Query),
+		Filters:        filters,
+		TieBreak:       opts.TieBreak,
+		Scorer:         opts.Scorer,
+		Source:         opts.Source,
+		IncludeVectors: opts.IncludeVectors,
+	}
+	result := BatchResult{ID: q.ID, Query: search.Query, Dataset: plan.table}
+	began := time.Now()
+	results, err := s.hookedSearch(ctx, &search, &plan, vec)
+	s.logSearch(search, plan.table, plan.limit, time.Since(began), results, err)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Results = results
+	return result
+}
@@ -0,0 +1,236 @@
+package csvsearch
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	intsearch "yashubustudio/csv-search/internal/search"
+)
+
+// benchQueryRunes is the length stored texts are cut to when Bench
+// generates queries, so that they resemble search input rather than records.
+const benchQueryRunes = 32
+
+// BenchOptions configure Bench.
+type BenchOptions struct {
+	Dataset string
+	Table   string
+	// Queries to run. When empty, up to Samples stored texts of the dataset
+	// (cut to their first 32 characters) are used.
+	Queries []string
+	Samples int
+	// Iterations repeats the query set (defaults to 1).
+	Iterations int
+	// Concurrency is the number of searches run in parallel (defaults to 1).
+	Concurrency int
+	// Warmup searches run before measuring and are not reported.
+	Warmup int
+	TopK   int
+}
+
+// LatencyStats summarises a set of durations in milliseconds.
+type LatencyStats struct {
+	P50MS  float64 `json:"p50_ms"`
+	P95MS  float64 `json:"p95_ms"`
+	P99MS  float64 `json:"p99_ms"`
+	MeanMS float64 `json:"mean_ms"`
+	MaxMS  float64 `json:"max_ms"`
+}
+
+// BenchMemory reports the Go heap during a benchmark run.
+type BenchMemory struct {
+	HeapAllocBytes     uint64 `json:"heap_alloc_bytes"`
+	SysBytes           uint64 `json:"sys_bytes"`
+	TotalAllocBytes    uint64 `json:"total_alloc_bytes"`
+	AllocPerQueryBytes uint64 `json:"alloc_per_query_bytes"`
+	GarbageCollections uint32 `json:"gc_cycles"`
+}
+
+// BenchReport is the outcome of Bench. Encode and Scan split the latency
+// into query encoding and the ranking of the stored vectors.
+type BenchReport struct {
+	Table       string       `json:"table"`
+	Queries     int          `json:"queries"`
+	Errors      int          `json:"errors"`
+	Concurrency int          `json:"concurrency"`
+	DurationMS  float64      `json:"duration_ms"`
+	QPS         float64      `json:"qps"`
+	Latency     LatencyStats `json:"latency"`
+	Encode      LatencyStats `json:"encode"`
+	Scan        LatencyStats `json:"scan"`
+	Memory      BenchMemory  `json:"memory"`
+}
+
+// Bench runs a set of searches against the database and reports latency
+// percentiles, throughput and memory use. Benchmark searches are not written
+// to the query log.
+func (s *Service) Bench(ctx context.Context, opts BenchOptions) (BenchReport, error) {
+	if err := s.ready(ctx); err != nil {
+		return BenchReport{}, err
+	}
+	if err := s.ensureDatabase(ctx); err != nil {
+		return BenchReport{}, err
+	}
+
+	cfg := s.Config()
+	datasetName, _, _ := resolveDataset(cfg, opts.Dataset)
+	plan := planSearch(cfg, opts.Dataset, opts.Table, opts.TopK, 0)
+	table := plan.table
+
+	queries := make([]string, 0, len(opts.Queries))
+	for _, q := range opts.Queries {
+		if q = strings.TrimSpace(q); q != "" {
+			queries = append(queries, q)
+		}
+	}
+	if len(queries) == 0 {
+		texts, err := s.sampleTexts(ctx, datasetName, opts.Table, firstPositive(opts.Samples, 100))
+		if err != nil {
+			return BenchReport{}, err
+		}
+		for _, text := range texts {
+			queries = append(queries, truncateRunes(text, benchQueryRunes))
+		}
+	}
+	if len(queries) == 0 {
+		return BenchReport{}, fmt.Errorf("no queries to run: dataset %q has no stored texts", table)
+	}
+
+	run := func(query string, timings *intsearch.Timings) error {
+		_, err := s.search(ctx, SearchOptions{Query: query}, plan, nil, timings)
+		return err
+	}
+	for i := 0; i < opts.Warmup; i++ {
+		if err := run(queries[i%len(queries)], nil); err != nil {
+			return BenchReport{}, fmt.Errorf("warmup: %w", err)
+		}
+	}
+
+	iterations := firstPositive(opts.Iterations, 1)
+	workers := firstPositive(opts.Concurrency, 1)
+	total := iterations * len(queries)
+	type sample struct {
+		latency time.Duration
+		timings intsearch.Timings
+		err     error
+	}
+	samples := make([]sample, total)
+	jobs := make(chan int)
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				began := time.Now()
+				err := run(queries[i%len(queries)], &samples[i].timings)
+				samples[i].latency = time.Since(began)
+				samples[i].err = err
+			}
+		}()
+	}
+dispatch:
+	for i := 0; i < total; i++ {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	elapsed := time.Since(start)
+	if err := ctx.Err(); err != nil {
+		return BenchReport{}, err
+	}
+
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+
+	report := BenchReport{
+		Table:       table,
+		Queries:     total,
+		Concurrency: workers,
+		DurationMS:  milliseconds(elapsed),
+		Memory: BenchMemory{
+			HeapAllocBytes:     after.HeapAlloc,
+			SysBytes:           after.Sys,
+			TotalAllocBytes:    after.TotalAlloc - before.TotalAlloc,
+			AllocPerQueryBytes: (after.TotalAlloc - before.TotalAlloc) / uint64(total),
+			GarbageCollections: after.NumGC - before.NumGC,
+		},
+	}
+	if elapsed > 0 {
+		report.QPS = float64(total) / elapsed.Seconds()
+	}
+	var latency, encode, scan []time.Duration
+	for _, smp := range samples {
+		if smp.err != nil {
+			report.Errors++
+			continue
+		}
+		latency = append(latency, smp.latency)
+		encode = append(encode, smp.timings.Encode)
+		scan = append(scan, smp.timings.Scan)
+	}
+	if report.Errors == total {
+		return report, fmt.Errorf("all %d searches failed: %w", total, samples[0].err)
+	}
+	report.Latency = latencyStats(latency)
+	report.Encode = latencyStats(encode)
+	report.Scan = latencyStats(scan)
+	return report, nil
+}
+
+func latencyStats(values []time.Duration) LatencyStats {
+	if len(values) == 0 {
+		return LatencyStats{}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	var sum time.Duration
+	for _, v := range values {
+		sum += v
+	}
+	return LatencyStats{
+		P50MS:  milliseconds(nearestRank(values, 0.50)),
+		P95MS:  milliseconds(nearestRank(values, 0.95)),
+		P99MS:  milliseconds(nearestRank(values, 0.99)),
+		MeanMS: milliseconds(sum / time.Duration(len(values))),
+		MaxMS:  milliseconds(values[len(values)-1]),
+	}
+}
+
+// nearestRank returns the p-th percentile of sorted values.
+func nearestRank(sorted []time.Duration, p float64) time.Duration {
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func truncateRunes(text string, n int) string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) <= n {
+		return string(runes)
+	}
+	return strings.TrimSpace(string(runes[:n]))
+}
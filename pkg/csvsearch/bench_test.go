@@ -0,0 +1,156 @@
+package csvsearch
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBench(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t, "id,title\n1,hello\n2,world\n3,tokyo tower\n")
+
+	report, err := svc.Bench(ctx, BenchOptions{Dataset: "docs", Iterations: 4, Concurrency: 2, Warmup: 1})
+	if err != nil {
+		t.Fatalf("Bench: %v", err)
+	}
+	if report.Queries != 12 || report.Errors != 0 || report.Concurrency != 2 || report.Table != "docs" {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report.QPS <= 0 || report.Latency.P99MS < report.Latency.P50MS || report.Latency.MaxMS < report.Latency.P99MS {
+		t.Fatalf("unexpected latency figures: %+v", report)
+	}
+
+	report, err = svc.Bench(ctx, BenchOptions{Dataset: "docs", Queries: []string{"tokyo", " "}})
+	if err != nil {
+		t.Fatalf("Bench with queries: %v", err)
+	}
+	if report.Queries != 1 {
+		t.Fatalf("expected the blank query to be skipped, got %d queries", report.Queries)
+	}
+}
+
+// hashEmbedder derives a deterministic pseudo-random vector from the text,
+// so that benchmarks rank realistic-looking embeddings without a model.
+type hashEmbedder struct{ dim int }
+
+func (h hashEmbedder) Encode(text string) ([]float32, error) {
+	f := fnv.New64a()
+	f.Write([]byte(text))
+	rng := rand.New(rand.NewSource(int64(f.Sum64())))
+	vec := make([]float32, h.dim)
+	for i := range vec {
+		vec[i] = rng.Float32()*2 - 1
+	}
+	return vec, nil
+}
+
+func (h hashEmbedder) EncodeBatch(texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		out[i], _ = h.Encode(text)
+	}
+	return out, nil
+}
+
+func (h hashEmbedder) Dimension() int { return h.dim }
+func (h hashEmbedder) Close() error   { return nil }
+
+// benchRecords and benchDim size the benchmark dataset.
+const (
+	benchRecords = 5000
+	benchDim     = 384
+)
+
+// writeBenchCSV writes n rows with a text column and a "kind" column that
+// takes ten values.
+func writeBenchCSV(b *testing.B, path string, n int) {
+	b.Helper()
+	var sb strings.Builder
+	sb.WriteString("id,title,kind\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, "%d,record number %d about topic %d,k%d\n", i, i, i%37, i%10)
+	}
+	if err := os.WriteFile(path, []byte(sb.String()), 0o600); err != nil {
+		b.Fatalf("write csv: %v", err)
+	}
+}
+
+// newBenchService returns a Service over an ingested benchmark dataset.
+func newBenchService(b *testing.B) *Service {
+	b.Helper()
+	dir := b.TempDir()
+	csvPath := filepath.Join(dir, "docs.csv")
+	writeBenchCSV(b, csvPath, benchRecords)
+	svc, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "app.db")},
+		Encoder:  EncoderOptions{Embedder: hashEmbedder{dim: benchDim}},
+	})
+	if err != nil {
+		b.Fatalf("NewService: %v", err)
+	}
+	b.Cleanup(func() { svc.Close() })
+	if _, err := svc.Ingest(context.Background(), IngestOptions{Dataset: "docs", CSVPath: csvPath, TextColumns: []string{"title"}}); err != nil {
+		b.Fatalf("Ingest: %v", err)
+	}
+	return svc
+}
+
+// BenchmarkSearch runs unfiltered searches, which read the vector pages.
+func BenchmarkSearch(b *testing.B) {
+	svc := newBenchService(b)
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for b.Loop() {
+		if _, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "topic 7", TopK: 10}); err != nil {
+			b.Fatalf("Search: %v", err)
+		}
+	}
+}
+
+// BenchmarkSearchFiltered runs searches with a metadata filter, which scan
+// the matching rows.
+func BenchmarkSearchFiltered(b *testing.B) {
+	svc := newBenchService(b)
+	ctx := context.Background()
+	filters := []Filter{{Field: "kind", Value: "k3"}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for b.Loop() {
+		if _, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "topic 7", TopK: 10, Filters: filters}); err != nil {
+			b.Fatalf("Search: %v", err)
+		}
+	}
+}
+
+// BenchmarkIngest loads the benchmark CSV into a fresh dataset per
+// iteration; b.N counts whole files.
+func BenchmarkIngest(b *testing.B) {
+	dir := b.TempDir()
+	csvPath := filepath.Join(dir, "docs.csv")
+	writeBenchCSV(b, csvPath, benchRecords)
+	svc, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "app.db")},
+		Encoder:  EncoderOptions{Embedder: hashEmbedder{dim: benchDim}},
+	})
+	if err != nil {
+		b.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+	ctx := context.Background()
+	b.ReportAllocs()
+	i := 0
+	for b.Loop() {
+		i++
+		if _, err := svc.Ingest(ctx, IngestOptions{Dataset: fmt.Sprintf("docs%d", i), CSVPath: csvPath, TextColumns: []string{"title"}}); err != nil {
+			b.Fatalf("Ingest: %v", err)
+		}
+	}
+	b.ReportMetric(float64(benchRecords*i)/b.Elapsed().Seconds(), "rows/s")
+}
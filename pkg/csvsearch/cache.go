@@ -0,0 +1,94 @@
+package csvsearch
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	intsearch "yashubustudio/csv-search/internal/search"
+)
+
+// ResultCacheOptions enable an in-process LRU of search results, for callers
+// such as autocomplete UIs that repeat the same queries. Search and
+// KeywordSearch calls with the same dataset, query, filters, topK and
+// scoring settings are answered from the cache for TTL without encoding or
+// scanning. Every write made through the Service (ingest, Writer, Import,
+// Delete, Reembed, Reindex, Restore) and every encoder or config reload drop
+// the cached results; writes from other processes show up once TTL expires.
+// Cached results are stored after the post-search hooks and returned without
+// calling any hook again.
+type ResultCacheOptions struct {
+	// TTL enables the cache when positive.
+	TTL time.Duration
+	// Size bounds the number of cached searches (1024 when zero).
+	Size int
+}
+
+// resultCacheKey identifies a search by everything that determines its
+// results. Filters and ids are order-insensitive.
+func resultCacheKey(op string, opts SearchOptions, plan searchPlan) string {
+	filters := make([]string, len(opts.Filters))
+	for i, f := range opts.Filters {
+		filters[i] = intsearch.Filter(f).Label() + "\x00" + f.Value
+	}
+	sort.Strings(filters)
+	ids := append([]string(nil), opts.IDs...)
+	sort.Strings(ids)
+	return strings.Join([]string{
+		op,
+		plan.table,
+		strings.TrimSpace(opts.Query),
+		strings.Join(filters, "\x01"),
+		strings.Join(ids, "\x01"),
+		strconv.Itoa(plan.limit),
+		strconv.FormatFloat(plan.sparseWeight, 'g', -1, 64),
+		plan.metric,
+		strconv.FormatFloat(plan.minScore, 'g', -1, 64),
+		plan.normalization,
+		opts.TieBreak,
+		strings.TrimSpace(opts.GroupBy),
+		strconv.Itoa(opts.GroupSize),
+		strconv.FormatBool(opts.IncludeVectors),
+		opts.Near.toSearch().String(),
+		strings.TrimSpace(opts.Model),
+		strings.TrimSpace(opts.Scorer),
+	}, "\xff")
+}
+
+// cachedResults returns a copy of the results stored under key.
+func (s *Service) cachedResults(key string) ([]Result, bool) {
+	results, ok := s.results.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return append([]Result(nil), results...), true
+}
+
+func (s *Service) cacheResults(key string, results []Result) {
+	s.results.Put(key, append([]Result(nil), results...))
+}
+
+// invalidateResults drops the cached search results and field names after a
+// write to the datasets (tables) given, or to any dataset when none are.
+// The listeners added with onInvalidate are told which.
+func (s *Service) invalidateResults(tables ...string) {
+	s.results.Purge()
+	s.engine.InvalidateFields()
+	s.engine.InvalidateTerms()
+	s.models.forgetStored()
+	s.hooksMu.RLock()
+	listeners := s.hooks.invalidate
+	s.hooksMu.RUnlock()
+	for _, fn := range listeners {
+		fn(tables...)
+	}
+}
+
+// onInvalidate registers fn to be called by invalidateResults, e.g. to drop
+// the per-dataset response caches of an API server.
+func (s *Service) onInvalidate(fn func(tables ...string)) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.hooks.invalidate = append(s.hooks.invalidate, fn)
+}
@@ -0,0 +1,292 @@
+package csvsearch
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"yashubustudio/csv-search/internal/config"
+)
+
+// Types of Change.
+const (
+	ChangeInserted = "inserted"
+	ChangeUpdated  = "updated"
+	ChangeDeleted  = "deleted"
+	// ChangeReset reports that the records were replaced wholesale, so
+	// everything derived from them must be rebuilt: those of the whole
+	// database by Restore and SyncReplica, which name no dataset, or those
+	// of one dataset by PromoteVersion. It carries no IDs.
+	ChangeReset = "reset"
+)
+
+const (
+	// maxChangeIDs splits the changes of large ingests into several
+	// notifications.
+	maxChangeIDs = 1000
+	// webhookQueueSize bounds the changes waiting for delivery; further
+	// changes are dropped with a warning.
+	webhookQueueSize = 1024
+	// webhookAttempts is the number of deliveries tried per change and
+	// webhook, webhookBackoff the wait before the first retry (doubled for
+	// each further one).
+	webhookAttempts = 3
+	// webhookDrainTimeout is how long Close waits for pending deliveries.
+	webhookDrainTimeout = 10 * time.Second
+	// signatureHeader carries the HMAC-SHA256 of the body when the webhook
+	// has a secret.
+	signatureHeader = "X-CSV-Search-Signature"
+)
+
+var webhookBackoff = time.Second
+
+// Change describes records of a dataset that were inserted, updated or
+// deleted by a committed write. Dataset is the table of the records.
+type Change struct {
+	Dataset string    `json:"dataset,omitempty"`
+	Type    string    `json:"type"`
+	IDs     []string  `json:"ids,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// ChangeHook is called with every Change after it was committed, e.g. to
+// invalidate a downstream cache or index entry by entry. Hooks run on the
+// goroutine that made the change and should return quickly.
+type ChangeHook func(ctx context.Context, change Change)
+
+// AddChangeHook registers a hook notified of the records written by Ingest,
+// Writer, Delete and Dedupe, of the records whose embeddings Reembed,
+// ImportVectors and Fsck repairs replaced as ChangeUpdated, and of Restore,
+// SyncReplica and PromoteVersion as ChangeReset. Ingesting a version reports
+// its table, "<dataset>@<version>". Writes that began before the hook was
+// registered may not report to it.
+func (s *Service) AddChangeHook(hook ChangeHook) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.hooks.change = append(s.hooks.change, hook)
+}
+
+// watchesChanges reports whether a change hook or webhook is registered, so
+// that writers skip the bookkeeping otherwise.
+func (s *Service) watchesChanges() bool {
+	cfg := s.Config()
+	return len(s.registeredHooks().change) > 0 || (cfg != nil && len(cfg.Webhooks) > 0)
+}
+
+// changeReporter adapts notifyChange to ingest.Options.OnChange; it returns
+// nil when no one watches the changes.
+func (s *Service) changeReporter(ctx context.Context, table string) func(inserted, updated, deleted []string) {
+	if !s.watchesChanges() {
+		return nil
+	}
+	return func(inserted, updated, deleted []string) {
+		s.notifyChange(ctx, table, ChangeInserted, inserted)
+		s.notifyChange(ctx, table, ChangeUpdated, updated)
+		s.notifyChange(ctx, table, ChangeDeleted, deleted)
+	}
+}
+
+// embeddingReporter adapts notifyChange to ingest.ReembedOptions.OnChange,
+// reporting the re-embedded records as updated; it returns nil when no one
+// watches the changes.
+func (s *Service) embeddingReporter(ctx context.Context) func(table string, ids []string) {
+	if !s.watchesChanges() {
+		return nil
+	}
+	return func(table string, ids []string) {
+		s.notifyChange(ctx, table, ChangeUpdated, ids)
+	}
+}
+
+// notifyChange hands the change of ids to the change hooks and webhooks.
+// Changes other than ChangeReset are dropped when ids is empty.
+func (s *Service) notifyChange(ctx context.Context, table, typ string, ids []string) {
+	if typ != ChangeReset && len(ids) == 0 {
+		return
+	}
+	hooks := s.registeredHooks().change
+	cfg := s.Config()
+	if len(hooks) == 0 && (cfg == nil || len(cfg.Webhooks) == 0) {
+		return
+	}
+	now := time.Now().UTC()
+	for {
+		chunk := ids
+		if len(chunk) > maxChangeIDs {
+			chunk = chunk[:maxChangeIDs]
+		}
+		change := Change{Dataset: table, Type: typ, IDs: append([]string(nil), chunk...), Time: now}
+		for _, hook := range hooks {
+			hook(ctx, change)
+		}
+		if cfg != nil && len(cfg.Webhooks) > 0 {
+			s.webhooks.enqueue(s, change)
+		}
+		ids = ids[len(chunk):]
+		if len(ids) == 0 {
+			return
+		}
+	}
+}
+
+// webhookQueue delivers changes to the configured webhooks in the order they
+// were made, on a goroutine started with the first change.
+type webhookQueue struct {
+	mu     sync.Mutex
+	queue  chan Change
+	closed bool
+	done   chan struct{}
+	cancel context.CancelFunc
+}
+
+func (q *webhookQueue) enqueue(s *Service, change Change) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	if q.queue == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		q.queue, q.done, q.cancel = make(chan Change, webhookQueueSize), make(chan struct{}), cancel
+		go s.deliverWebhooks(ctx, q.queue, q.done)
+	}
+	select {
+	case q.queue <- change:
+	default:
+		s.log.Warn("webhook queue full, change dropped", "dataset", change.Dataset, "type", change.Type, "ids", len(change.IDs))
+	}
+}
+
+// close stops accepting changes and gives the pending deliveries
+// webhookDrainTimeout to finish.
+func (q *webhookQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	queue, done, cancel := q.queue, q.done, q.cancel
+	q.mu.Unlock()
+	if queue == nil {
+		return
+	}
+	close(queue)
+	timer := time.NewTimer(webhookDrainTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		cancel()
+		<-done
+	}
+	cancel()
+}
+
+func (s *Service) deliverWebhooks(ctx context.Context, queue <-chan Change, done chan<- struct{}) {
+	defer close(done)
+	for change := range queue {
+		cfg := s.Config()
+		if cfg == nil {
+			continue
+		}
+		body, err := json.Marshal(change)
+		if err != nil {
+			s.log.Error("encode change", "err", err)
+			continue
+		}
+		for _, hook := range cfg.Webhooks {
+			if !webhookWants(cfg, hook, change) {
+				continue
+			}
+			if err := s.deliverWebhook(ctx, hook, change.Type, body); err != nil {
+				s.log.Error("webhook delivery failed", "url", hook.URL, "dataset", change.Dataset, "type", change.Type, "ids", len(change.IDs), "err", err)
+			}
+		}
+	}
+}
+
+// webhookWants reports whether change passes the filters of hook. A reset
+// without a dataset concerns every dataset.
+func webhookWants(cfg *config.Config, hook config.WebhookConfig, change Change) bool {
+	if len(hook.Types) > 0 && !containsTrimmed(hook.Types, change.Type) {
+		return false
+	}
+	if len(hook.Datasets) == 0 || change.Dataset == "" {
+		return true
+	}
+	for _, name := range hook.Datasets {
+		name = strings.TrimSpace(name)
+		ds, _ := cfg.Dataset(name)
+		if resolveTable(name, ds, "") == change.Dataset {
+			return true
+		}
+	}
+	return false
+}
+
+func containsTrimmed(list []string, value string) bool {
+	for _, item := range list {
+		if strings.TrimSpace(item) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// deliverWebhook posts body to hook, retrying failed attempts and server
+// errors with exponential backoff.
+func (s *Service) deliverWebhook(ctx context.Context, hook config.WebhookConfig, typ string, body []byte) error {
+	timeout := time.Duration(firstPositive(hook.TimeoutSeconds, 10)) * time.Second
+	backoff := webhookBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		if retry, err = postWebhook(ctx, hook, typ, body, timeout); err == nil || !retry || attempt == webhookAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// postWebhook makes one delivery attempt and reports whether a failure is
+// worth retrying.
+func postWebhook(ctx context.Context, hook config.WebhookConfig, typ string, body []byte, timeout time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSpace(hook.URL), bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-CSV-Search-Event", typ)
+	if hook.Secret != "" {
+		req.Header.Set(signatureHeader, "sha256="+signPayload(hook.Secret, body))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("%s", resp.Status)
+}
+
+// signPayload returns the hex HMAC-SHA256 of body keyed with secret.
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,108 @@
+package csvsearch
+
+import (
+	"path/filepath"
+
+	"yashubustudio/csv-search/internal/config"
+)
+
+// LoadedConfig returns the configuration file referenced by ref as read:
+// includes merged and references expanded, with secret values redacted. A
+// missing optional file yields an empty object.
+func LoadedConfig(ref ConfigReference) (map[string]any, error) {
+	cfg, err := loadConfig(ref.Path, ref.Required)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Redacted()
+}
+
+// EffectiveConfig returns the configuration a Service built from opts would
+// run with, without opening the database or the encoder: flag overrides and
+// defaults applied, paths made absolute and secret values redacted.
+func EffectiveConfig(opts ServiceOptions) (map[string]any, error) {
+	cfg, err := loadConfig(opts.Config.Path, opts.Config.Required)
+	if err != nil {
+		return nil, err
+	}
+	dbPath := firstNonEmpty(opts.Database.Path, configDatabasePath(cfg), "data/app.db")
+	return effectiveConfig(cfg, dbPath, resolveEncoderConfig(cfg, opts.Encoder.Config))
+}
+
+// EffectiveConfig returns the configuration the Service is running with (see
+// the package-level EffectiveConfig).
+func (s *Service) EffectiveConfig() (map[string]any, error) {
+	return effectiveConfig(s.Config(), s.DatabasePath(), s.EncoderConfig())
+}
+
+func effectiveConfig(cfg *config.Config, dbPath string, enc EncoderConfig) (map[string]any, error) {
+	var eff config.Config
+	if cfg != nil {
+		eff = *cfg
+	}
+	eff.Database.Path = absolutePath(dbPath)
+	eff.Embedding = config.EmbeddingConfig{
+		OrtLib:       absolutePath(enc.OrtLibrary),
+		Model:        absolutePath(enc.ModelPath),
+		Tokenizer:    absolutePath(enc.TokenizerPath),
+		MaxSeqLen:    firstPositive(enc.MaxSequenceLength, 512),
+		SparseHead:   absolutePath(enc.SparseHeadPath),
+		Truncation:   firstNonEmpty(enc.Truncation, "head"),
+		Normalize:    cloneStrings(enc.Normalize),
+		ModelVersion: modelVersion(enc),
+	}
+	if cfg != nil && len(cfg.Embedding.Models) > 0 {
+		eff.Embedding.Models = make(map[string]config.ModelConfig, len(cfg.Embedding.Models))
+		for name, mc := range cfg.Embedding.Models {
+			model := mergeEncoderConfig(enc, modelEncoderConfig(cfg, mc))
+			eff.Embedding.Models[name] = config.ModelConfig{
+				Model:        absolutePath(model.ModelPath),
+				Tokenizer:    absolutePath(model.TokenizerPath),
+				MaxSeqLen:    firstPositive(model.MaxSequenceLength, 512),
+				SparseHead:   absolutePath(model.SparseHeadPath),
+				Truncation:   firstNonEmpty(model.Truncation, "head"),
+				Normalize:    cloneStrings(model.Normalize),
+				ModelVersion: modelVersion(model),
+			}
+		}
+	}
+	eff.Search.DefaultTopK = firstPositive(eff.Search.DefaultTopK, 10)
+	eff.Search.Metric = firstNonEmpty(eff.Search.Metric, "cosine")
+
+	datasets := eff.Datasets
+	eff.Datasets = make(map[string]config.DatasetConfig, len(datasets))
+	for name, ds := range datasets {
+		ds.Table = resolveTable(name, ds, "")
+		ds.CSV = absolutePath(cfg.ResolvePath(ds.CSV))
+		ds.BatchSize = firstPositive(ds.BatchSize, 1000)
+		ds.IDColumn = firstNonEmpty(ds.IDColumn, "id")
+		if len(ds.MetaColumns) == 0 {
+			ds.MetaColumns = []string{"*"}
+		}
+		ds.Search = eff.Search.Override(ds.Search)
+		eff.Datasets[name] = ds
+	}
+
+	doc, err := eff.Redacted()
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(cfg.Files()))
+	for _, file := range cfg.Files() {
+		files = append(files, absolutePath(file))
+	}
+	doc["files"] = files
+	return doc, nil
+}
+
+// absolutePath makes a non-empty path absolute, leaving it unchanged when the
+// working directory is unknown.
+func absolutePath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
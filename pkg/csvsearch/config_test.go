@@ -0,0 +1,50 @@
+package csvsearch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEffectiveConfig(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(filepath.Join(dir, "token"), []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatalf("write secret: %v", err)
+	}
+	if err := os.WriteFile(cfgPath, []byte(`{
+  "database": {"path": "app.db"},
+  "embedding": {"model": "models/model.onnx", "tokenizer": "file:token"},
+  "datasets": {"docs": {"csv": "docs.csv", "search": {"default_topk": 3}}},
+  "search": {"metric": "dot"}
+}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	doc, err := EffectiveConfig(ServiceOptions{
+		Config:  ConfigReference{Path: cfgPath, Required: true},
+		Encoder: EncoderOptions{Config: EncoderConfig{MaxSequenceLength: 256}},
+	})
+	if err != nil {
+		t.Fatalf("EffectiveConfig: %v", err)
+	}
+	database := doc["database"].(map[string]any)
+	if database["path"] != filepath.Join(dir, "app.db") {
+		t.Fatalf("database.path = %v", database["path"])
+	}
+	embedding := doc["embedding"].(map[string]any)
+	if embedding["model"] != filepath.Join(dir, "models", "model.onnx") || embedding["max_seq_len"] != float64(256) || embedding["model_version"] != "model.onnx" {
+		t.Fatalf("unexpected embedding: %v", embedding)
+	}
+	if embedding["tokenizer"] != "[redacted]" {
+		t.Fatalf("secret not redacted: %v", embedding["tokenizer"])
+	}
+	docs := doc["datasets"].(map[string]any)["docs"].(map[string]any)
+	search := docs["search"].(map[string]any)
+	if docs["table"] != "docs" || docs["csv"] != filepath.Join(dir, "docs.csv") || docs["batch_size"] != float64(1000) {
+		t.Fatalf("unexpected dataset: %v", docs)
+	}
+	if search["default_topk"] != float64(3) || search["metric"] != "dot" {
+		t.Fatalf("unexpected dataset search: %v", search)
+	}
+}
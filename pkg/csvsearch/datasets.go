@@ -0,0 +1,119 @@
+package csvsearch
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"yashubustudio/csv-search/internal/store"
+)
+
+// DatasetInfo describes a dataset known to the configuration or present in
+// the database.
+type DatasetInfo struct {
+	// Name is the configured dataset name (the table name for datasets that
+	// only exist in the database).
+	Name  string `json:"name"`
+	Table string `json:"table"`
+	// Default marks the dataset searched when a request names none.
+	Default bool `json:"default"`
+	// Configured reports whether the dataset appears in the configuration;
+	// the versions of a configured dataset count as configured.
+	Configured bool `json:"configured"`
+	// Version is set for the table of a named version of a dataset other
+	// than its live one (see IngestOptions.Version).
+	Version string `json:"version,omitempty"`
+	Rows    int64  `json:"rows"`
+	Vectors int64  `json:"vectors"`
+	Sparse  int64  `json:"sparse"`
+	FTS     int64  `json:"fts"`
+	Geo     int64  `json:"geo"`
+	// Dimension is the embedding dimension (0 when no vectors are stored).
+	Dimension int64 `json:"dimension"`
+	HasFTS    bool  `json:"has_fts"`
+	HasGeo    bool  `json:"has_geo"`
+	HasSparse bool  `json:"has_sparse"`
+}
+
+// Datasets lists the configured datasets together with every table found in
+// the database, with their row counts.
+func (s *Service) Datasets(ctx context.Context) ([]DatasetInfo, error) {
+	if err := s.ready(ctx); err != nil {
+		return nil, err
+	}
+	stats, err := store.Datasets(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+	byTable := make(map[string]store.DatasetStats, len(stats))
+	for _, st := range stats {
+		byTable[st.Dataset] = st
+	}
+
+	cfg := s.Config()
+	defaultName, defaultCfg, _ := resolveDataset(cfg, "")
+	defaultTable := resolveTable(defaultName, defaultCfg, "")
+
+	var (
+		out           []DatasetInfo
+		seen          = make(map[string]bool)
+		defaultMarked bool
+	)
+	if cfg != nil {
+		for name, ds := range cfg.Datasets {
+			table := resolveTable(name, ds, "")
+			info := datasetInfo(name, table, byTable[table])
+			info.Configured = true
+			info.Default = name == defaultName
+			defaultMarked = defaultMarked || info.Default
+			out = append(out, info)
+			seen[table] = true
+		}
+	}
+	for _, st := range stats {
+		if seen[st.Dataset] {
+			continue
+		}
+		info := datasetInfo(st.Dataset, st.Dataset, st)
+		info.Default = !defaultMarked && st.Dataset == defaultTable
+		if table, version, ok := strings.Cut(st.Dataset, "@"); ok && store.ValidateVersion(version) == nil {
+			info.Version = version
+			info.Configured = seen[table]
+		}
+		out = append(out, info)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func datasetInfo(name, table string, st store.DatasetStats) DatasetInfo {
+	return DatasetInfo{
+		Name:      name,
+		Table:     table,
+		Rows:      st.Rows,
+		Vectors:   st.Vectors,
+		Sparse:    st.Sparse,
+		FTS:       st.FTS,
+		Geo:       st.Geo,
+		Dimension: st.Dimension,
+		HasFTS:    st.FTS > 0,
+		HasGeo:    st.Geo > 0,
+		HasSparse: st.Sparse > 0,
+	}
+}
+
+// ConfiguredDatasets returns the sorted dataset names defined in the
+// configuration file referenced by ref without opening the database. A
+// missing optional file yields no names.
+func ConfiguredDatasets(ref ConfigReference) ([]string, error) {
+	cfg, err := loadConfig(ref.Path, ref.Required)
+	if err != nil || cfg == nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(cfg.Datasets))
+	for name := range cfg.Datasets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,161 @@
+package csvsearch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"yashubustudio/csv-search/internal/database"
+	intsearch "yashubustudio/csv-search/internal/search"
+	"yashubustudio/csv-search/internal/store"
+)
+
+// DedupeOptions configure Dedupe.
+type DedupeOptions struct {
+	Dataset string
+	Table   string
+	// Threshold is the cosine similarity of the embeddings from which two
+	// records are duplicates (0.95 when zero).
+	Threshold float64
+	// Tag, when set, names a metadata field set on every duplicate to the id
+	// of the record kept in its group.
+	Tag string
+	// Merge fills the empty metadata fields of the record kept in every group
+	// from its duplicates, in ingestion order, and deletes the duplicates.
+	// It cannot be combined with Tag.
+	Merge bool
+}
+
+// DuplicatePair is two records of a dataset whose embeddings are at least as
+// similar as the threshold. A was ingested before B.
+type DuplicatePair struct {
+	A     string  `json:"a"`
+	B     string  `json:"b"`
+	Score float64 `json:"score"`
+}
+
+// DuplicateGroup is a set of records linked by duplicate pairs: Keep is the
+// first ingested, Duplicates the others in ingestion order.
+type DuplicateGroup struct {
+	Keep       string   `json:"keep"`
+	Duplicates []string `json:"duplicates"`
+}
+
+// DedupeReport is the outcome of Dedupe. Tagged counts the records given the
+// Tag field and Merged the duplicates deleted by Merge.
+type DedupeReport struct {
+	Dataset   string           `json:"dataset"`
+	Threshold float64          `json:"threshold"`
+	Records   int              `json:"records"`
+	Pairs     []DuplicatePair  `json:"pairs"`
+	Groups    []DuplicateGroup `json:"groups"`
+	Tagged    int              `json:"tagged,omitempty"`
+	Merged    int64            `json:"merged,omitempty"`
+}
+
+// Dedupe finds the near-duplicate records of a dataset, as vendor CSVs often
+// list the same entity more than once, by comparing the stored embeddings of
+// every pair of records. The comparison is quadratic in the size of the
+// dataset. With Tag or Merge the duplicates are marked or folded into the
+// first record of their group.
+func (s *Service) Dedupe(ctx context.Context, opts DedupeOptions) (DedupeReport, error) {
+	if err := s.ready(ctx); err != nil {
+		return DedupeReport{}, err
+	}
+	tag := strings.TrimSpace(opts.Tag)
+	if tag != "" && opts.Merge {
+		return DedupeReport{}, fmt.Errorf("tag and merge are mutually exclusive")
+	}
+	threshold := opts.Threshold
+	if threshold == 0 {
+		threshold = intsearch.DefaultDuplicateThreshold
+	}
+	datasetName, datasetCfg, _ := resolveDataset(s.Config(), opts.Dataset)
+	table := resolveTable(datasetName, datasetCfg, opts.Table)
+	found, err := intsearch.FindDuplicates(ctx, s.db, intsearch.DuplicateOptions{Dataset: table, Threshold: threshold})
+	if err != nil {
+		return DedupeReport{}, err
+	}
+
+	report := DedupeReport{
+		Dataset:   table,
+		Threshold: threshold,
+		Records:   found.Records,
+		Pairs:     make([]DuplicatePair, len(found.Pairs)),
+		Groups:    make([]DuplicateGroup, len(found.Groups)),
+	}
+	for i, p := range found.Pairs {
+		report.Pairs[i] = DuplicatePair(p)
+	}
+	for i, g := range found.Groups {
+		report.Groups[i] = DuplicateGroup(g)
+	}
+	if (tag == "" && !opts.Merge) || len(report.Groups) == 0 {
+		return report, nil
+	}
+
+	defer s.invalidateResults(table)
+	for _, g := range report.Groups {
+		if tag != "" {
+			for _, id := range g.Duplicates {
+				if err := store.SetFields(ctx, s.db, table, id, map[string]string{tag: g.Keep}); err != nil {
+					return report, err
+				}
+				report.Tagged++
+			}
+			s.notifyChange(ctx, table, ChangeUpdated, g.Duplicates)
+			continue
+		}
+		merged, err := s.mergeDuplicates(ctx, table, g)
+		if err != nil {
+			return report, err
+		}
+		if merged {
+			s.notifyChange(ctx, table, ChangeUpdated, []string{g.Keep})
+		}
+		deleted, err := store.DeleteIDs(ctx, s.db, table, g.Duplicates)
+		if err != nil {
+			return report, err
+		}
+		s.notifyChange(ctx, table, ChangeDeleted, deleted)
+		report.Merged += int64(len(deleted))
+	}
+	if report.Merged > 0 {
+		if _, err := database.UpdateVectorPages(ctx, s.db, table); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// mergeDuplicates copies into the kept record of g the fields that it lacks
+// or leaves empty, from the first duplicate that has them. It reports whether
+// the kept record changed.
+func (s *Service) mergeDuplicates(ctx context.Context, table string, g DuplicateGroup) (bool, error) {
+	keep, err := store.Get(ctx, s.db, table, g.Keep)
+	if err != nil {
+		return false, err
+	}
+	fill := make(map[string]string)
+	for _, id := range g.Duplicates {
+		dup, err := store.Get(ctx, s.db, table, id)
+		if err != nil {
+			return false, err
+		}
+		for field, value := range dup.Fields {
+			if strings.TrimSpace(keep.Fields[field]) != "" || strings.TrimSpace(value) == "" {
+				continue
+			}
+			if _, ok := fill[field]; !ok {
+				fill[field] = value
+			}
+		}
+	}
+	if len(fill) == 0 {
+		return false, nil
+	}
+	if err := store.SetFields(ctx, s.db, table, g.Keep, fill); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,225 @@
+package csvsearch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"yashubustudio/csv-search/internal/database"
+	"yashubustudio/csv-search/internal/store"
+)
+
+// Doctor check statuses.
+const (
+	CheckOK   = "ok"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+	CheckSkip = "skip"
+)
+
+// doctorProbe is the text encoded to learn the dimension of the active model.
+const doctorProbe = "csv-search doctor"
+
+// DoctorCheck is the outcome of one Diagnose check. Fix suggests how to
+// resolve a warning or failure.
+type DoctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+// DoctorReport lists the checks run by Diagnose in order.
+type DoctorReport struct {
+	Checks []DoctorCheck `json:"checks"`
+}
+
+// Healthy reports whether no check failed.
+func (r DoctorReport) Healthy() bool {
+	for _, c := range r.Checks {
+		if c.Status == CheckFail {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *DoctorReport) add(name, status, detail, fix string) {
+	r.Checks = append(r.Checks, DoctorCheck{Name: name, Status: status, Detail: detail, Fix: fix})
+}
+
+// Diagnose checks the installation described by opts: the configuration
+// file, the database schema, the encoder assets, whether the encoder loads
+// and whether its dimension matches the stored vectors. Problems are
+// reported as checks rather than returned as errors.
+func Diagnose(ctx context.Context, opts ServiceOptions) DoctorReport {
+	var report DoctorReport
+
+	cfgPath := strings.TrimSpace(opts.Config.Path)
+	if cfgPath == "" {
+		cfgPath = "csv-search_config.json"
+	}
+	cfg, err := loadConfig(opts.Config.Path, opts.Config.Required)
+	switch {
+	case err != nil:
+		report.add("config", CheckFail, err.Error(), fmt.Sprintf("fix %s (it must be valid JSON with known keys) or pass --config", cfgPath))
+		report.add("database", CheckSkip, "configuration could not be loaded", "")
+		return report
+	case cfg == nil:
+		report.add("config", CheckWarn, fmt.Sprintf("%s not found; using flags and defaults", cfgPath), "create csv-search_config.json or pass --config to pin asset and database paths")
+	default:
+		report.add("config", CheckOK, fmt.Sprintf("%s (%d datasets)", cfgPath, len(cfg.Datasets)), "")
+	}
+
+	svc, err := NewService(opts)
+	if err != nil {
+		report.add("database", CheckFail, err.Error(), "set database.path in the config or pass --db")
+		return report
+	}
+	defer svc.Close()
+
+	schemaOK := svc.checkSchema(ctx, &report)
+	dim := svc.checkEncoder(&report)
+	if schemaOK {
+		svc.checkDimensions(ctx, &report, dim)
+	} else {
+		report.add("dimensions", CheckSkip, "database schema is not usable", "")
+	}
+	return report
+}
+
+func (s *Service) checkSchema(ctx context.Context, report *DoctorReport) bool {
+	version, err := database.Version(ctx, s.db)
+	if err != nil {
+		report.add("schema", CheckFail, err.Error(), "check that "+s.dbPath+" is a SQLite database")
+		return false
+	}
+	var tables int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'records'`).Scan(&tables); err != nil {
+		report.add("schema", CheckFail, err.Error(), "")
+		return false
+	}
+	switch {
+	case tables == 0:
+		report.add("schema", CheckFail, fmt.Sprintf("%s has no csv-search tables", s.dbPath), "run: csv-search init")
+		return false
+	case version > database.SchemaVersion:
+		report.add("schema", CheckFail, fmt.Sprintf("schema version %d is newer than this binary supports (%d)", version, database.SchemaVersion), "upgrade csv-search")
+		return false
+	case version < database.SchemaVersion:
+		report.add("schema", CheckWarn, fmt.Sprintf("schema version %d, current is %d", version, database.SchemaVersion), "run: csv-search init (migrations keep existing data)")
+	default:
+		report.add("schema", CheckOK, fmt.Sprintf("version %d at %s", version, s.dbPath), "")
+	}
+	return true
+}
+
+// checkEncoder verifies the encoder assets and loads the encoder. It
+// returns the embedding dimension, or 0 when the encoder is unusable.
+func (s *Service) checkEncoder(report *DoctorReport) int {
+	s.encMu.RLock()
+	injected := s.encoder != nil
+	s.encMu.RUnlock()
+	cfg := s.EncoderConfig()
+
+	if injected {
+		report.add("encoder assets", CheckSkip, "an embedder was supplied by the caller", "")
+	} else {
+		ok := true
+		for _, asset := range []struct {
+			name, path, setting string
+		}{
+			{"onnx runtime", cfg.OrtLibrary, "embedding.ort_lib or --ort-lib"},
+			{"model", cfg.ModelPath, "embedding.model or --model"},
+			{"tokenizer", cfg.TokenizerPath, "embedding.tokenizer or --tokenizer"},
+		} {
+			if !checkAsset(report, asset.name, asset.path, asset.setting) {
+				ok = false
+			}
+		}
+		if cfg.SparseHeadPath != "" && !checkAsset(report, "sparse head", cfg.SparseHeadPath, "embedding.sparse_head or --sparse-head") {
+			ok = false
+		}
+		if !ok {
+			report.add("encoder", CheckSkip, "encoder assets are missing", "")
+			return 0
+		}
+	}
+
+	enc, release, err := s.acquireEncoder()
+	if err != nil {
+		report.add("encoder", CheckFail, err.Error(), "check that the ONNX Runtime library matches this OS/architecture and the model/tokenizer belong together")
+		return 0
+	}
+	defer release()
+	vec, err := enc.Encode(doctorProbe)
+	if err != nil {
+		report.add("encoder", CheckFail, "encode failed: "+err.Error(), "check that the model and tokenizer belong together")
+		return 0
+	}
+	report.add("encoder", CheckOK, fmt.Sprintf("loaded %s, %d dimensions", firstNonEmpty(modelVersion(cfg), "embedder"), len(vec)), "")
+	return len(vec)
+}
+
+func checkAsset(report *DoctorReport, name, path, setting string) bool {
+	if strings.TrimSpace(path) == "" {
+		report.add(name, CheckFail, "not configured", "set "+setting)
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		report.add(name, CheckFail, err.Error(), "fix the path in "+setting)
+		return false
+	}
+	if info.IsDir() {
+		report.add(name, CheckFail, path+" is a directory", "point "+setting+" at the file")
+		return false
+	}
+	report.add(name, CheckOK, path, "")
+	return true
+}
+
+// checkDimensions compares the dimension of the stored vectors of every
+// dataset with the active encoder and flags vectors from other models.
+func (s *Service) checkDimensions(ctx context.Context, report *DoctorReport, dim int) {
+	stats, err := store.Datasets(ctx, s.db)
+	if err != nil {
+		report.add("dimensions", CheckFail, err.Error(), "")
+		return
+	}
+	if len(stats) == 0 {
+		report.add("dimensions", CheckSkip, "no datasets ingested yet", "")
+		return
+	}
+	model := s.ModelVersion()
+	for _, st := range stats {
+		name := "dataset " + st.Dataset
+		switch {
+		case st.Vectors == 0:
+			report.add(name, CheckWarn, fmt.Sprintf("%d records without vectors", st.Rows), "run: csv-search reembed --dataset "+st.Dataset)
+		case dim == 0:
+			report.add(name, CheckSkip, fmt.Sprintf("%d-dimensional vectors; encoder unavailable for comparison", st.Dimension), "")
+		case st.Dimension != int64(dim):
+			report.add(name, CheckFail, fmt.Sprintf("stored vectors have %d dimensions, the encoder produces %d", st.Dimension, dim), "run: csv-search reembed --dataset "+st.Dataset)
+		default:
+			stale, err := s.countStale(ctx, st.Dataset, model)
+			if err != nil {
+				report.add(name, CheckFail, err.Error(), "")
+			} else if stale > 0 {
+				report.add(name, CheckWarn, fmt.Sprintf("%d of %d vectors were produced by another model version than %q", stale, st.Vectors, model), "run: csv-search reembed --stale-only --dataset "+st.Dataset)
+			} else {
+				report.add(name, CheckOK, fmt.Sprintf("%d vectors, %d dimensions", st.Vectors, st.Dimension), "")
+			}
+		}
+	}
+}
+
+func (s *Service) countStale(ctx context.Context, dataset, model string) (int64, error) {
+	if model == "" {
+		return 0, nil
+	}
+	var n int64
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM records_vec WHERE dataset = ? AND (model IS NULL OR model != ?)`, dataset, model).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,61 @@
+package csvsearch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiagnose(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "app.db")
+	csvPath := filepath.Join(dir, "docs.csv")
+	if err := os.WriteFile(csvPath, []byte("id,title\n1,hello\n2,world\n"), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+
+	svc, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: dbPath},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	if _, err := svc.Ingest(ctx, IngestOptions{Dataset: "docs", CSVPath: csvPath, TextColumns: []string{"title"}}); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	svc.Close()
+
+	status := func(report DoctorReport, name string) string {
+		for _, c := range report.Checks {
+			if c.Name == name {
+				return c.Status
+			}
+		}
+		return ""
+	}
+
+	report := Diagnose(ctx, ServiceOptions{
+		Config:   ConfigReference{Path: filepath.Join(dir, "missing.json")},
+		Database: DatabaseOptions{Path: dbPath},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if !report.Healthy() || status(report, "config") != CheckWarn || status(report, "schema") != CheckOK || status(report, "dataset docs") != CheckOK {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	report = Diagnose(ctx, ServiceOptions{
+		Database: DatabaseOptions{Path: dbPath},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 3}},
+	})
+	if report.Healthy() || status(report, "dataset docs") != CheckFail {
+		t.Fatalf("expected a dimension mismatch: %+v", report)
+	}
+
+	report = Diagnose(ctx, ServiceOptions{Database: DatabaseOptions{Path: filepath.Join(dir, "empty.db")}})
+	if report.Healthy() || status(report, "schema") != CheckFail || status(report, "model") != CheckFail {
+		t.Fatalf("expected schema and asset failures: %+v", report)
+	}
+}
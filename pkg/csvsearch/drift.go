@@ -0,0 +1,258 @@
+package csvsearch
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	"yashubustudio/csv-search/internal/vector"
+)
+
+// driftSelfCosine is the cosine between the two embeddings of the same text
+// under which the stored vectors cannot be searched with the candidate's
+// query vectors (the parity check's default threshold).
+const driftSelfCosine = 0.98
+
+// driftSimilarityShift is how far the median or 95th percentile similarity of
+// the sample pairs may move before score thresholds need re-tuning.
+const driftSimilarityShift = 0.02
+
+// DriftOptions configure a comparison of how two models rank the stored
+// texts. Empty fields in Baseline and Candidate fall back to the active
+// encoder config.
+type DriftOptions struct {
+	Baseline  EncoderConfig
+	Candidate EncoderConfig
+	// Texts to embed. When empty, up to Samples texts are taken from the
+	// dataset's stored records.
+	Texts   []string
+	Dataset string
+	Table   string
+	Samples int
+	// TopK is the number of neighbours of every sample compared between the
+	// models (10 when zero).
+	TopK int
+}
+
+// Distribution summarizes a set of measurements.
+type Distribution struct {
+	Mean float64 `json:"mean"`
+	Min  float64 `json:"min"`
+	P50  float64 `json:"p50"`
+	P95  float64 `json:"p95"`
+	Max  float64 `json:"max"`
+}
+
+// DriftReport compares two models on a sample of texts. Every text is used
+// as a query against the others, as a search would rank them.
+type DriftReport struct {
+	Samples            int `json:"samples"`
+	TopK               int `json:"topk"`
+	BaselineDimension  int `json:"baseline_dimension"`
+	CandidateDimension int `json:"candidate_dimension"`
+	// SelfCosine is the cosine between the two embeddings of every text,
+	// reported only when both models have the same dimension.
+	SelfCosine *Distribution `json:"self_cosine,omitempty"`
+	// BaselineSimilarity and CandidateSimilarity are the cosine similarities
+	// of every pair of texts under each model: score thresholds tuned for the
+	// baseline move with them.
+	BaselineSimilarity  Distribution `json:"baseline_similarity"`
+	CandidateSimilarity Distribution `json:"candidate_similarity"`
+	// SimilarityDrift is the absolute change of the similarity of every pair.
+	SimilarityDrift Distribution `json:"similarity_drift"`
+	// TopKOverlap is the share of the baseline's TopK neighbours of every
+	// text that are also among the candidate's.
+	TopKOverlap Distribution `json:"topk_overlap"`
+	// RankShift is the mean number of places the baseline's TopK neighbours
+	// of every text move in the candidate's ranking.
+	RankShift Distribution `json:"rank_shift"`
+	// ReembedRequired is set when the dimensions differ or a text's two
+	// embeddings are less similar than 0.98, so that stored vectors must be
+	// re-encoded before the candidate serves queries.
+	ReembedRequired bool `json:"reembed_required"`
+	// RetuneThresholds is set when the median or 95th percentile pair
+	// similarity moves by more than 0.02, so that score thresholds (min_score,
+	// dedupe) tuned for the baseline no longer select the same records.
+	RetuneThresholds bool `json:"retune_thresholds"`
+}
+
+// CompareModels embeds texts with both embedders and reports how the
+// similarities and rankings among them change from baseline to candidate.
+// Unlike CompareEmbedders the models may differ in dimension.
+func CompareModels(baseline, candidate Embedder, texts []string, topK int) (DriftReport, error) {
+	if baseline == nil || candidate == nil {
+		return DriftReport{}, fmt.Errorf("both embedders are required")
+	}
+	if len(texts) < 3 {
+		return DriftReport{}, fmt.Errorf("at least 3 texts are required to compare rankings, got %d", len(texts))
+	}
+	if topK <= 0 {
+		topK = 10
+	}
+	topK = min(topK, len(texts)-1)
+
+	base, err := baseline.EncodeBatch(texts)
+	if err != nil {
+		return DriftReport{}, fmt.Errorf("baseline encode: %w", err)
+	}
+	cand, err := candidate.EncodeBatch(texts)
+	if err != nil {
+		return DriftReport{}, fmt.Errorf("candidate encode: %w", err)
+	}
+
+	report := DriftReport{
+		Samples:            len(texts),
+		TopK:               topK,
+		BaselineDimension:  baseline.Dimension(),
+		CandidateDimension: candidate.Dimension(),
+	}
+	if report.BaselineDimension == report.CandidateDimension {
+		self := make([]float64, len(texts))
+		for i := range texts {
+			self[i] = vector.Cosine(base[i], cand[i])
+		}
+		dist := summarize(self)
+		report.SelfCosine = &dist
+		report.ReembedRequired = dist.Min < driftSelfCosine
+	} else {
+		report.ReembedRequired = true
+	}
+
+	baseSim := similarityMatrix(base)
+	candSim := similarityMatrix(cand)
+	var basePairs, candPairs, drift []float64
+	for i := range texts {
+		for j := i + 1; j < len(texts); j++ {
+			basePairs = append(basePairs, baseSim[i][j])
+			candPairs = append(candPairs, candSim[i][j])
+			drift = append(drift, math.Abs(candSim[i][j]-baseSim[i][j]))
+		}
+	}
+	report.BaselineSimilarity = summarize(basePairs)
+	report.CandidateSimilarity = summarize(candPairs)
+	report.SimilarityDrift = summarize(drift)
+	report.RetuneThresholds = math.Abs(report.CandidateSimilarity.P50-report.BaselineSimilarity.P50) > driftSimilarityShift ||
+		math.Abs(report.CandidateSimilarity.P95-report.BaselineSimilarity.P95) > driftSimilarityShift
+
+	overlap := make([]float64, len(texts))
+	shift := make([]float64, len(texts))
+	for i := range texts {
+		baseRank := neighbourRanks(baseSim[i], i)
+		candRank := neighbourRanks(candSim[i], i)
+		var kept, moved int
+		for j, r := range baseRank {
+			if r < 0 || r >= topK {
+				continue
+			}
+			if candRank[j] < topK {
+				kept++
+			}
+			moved += abs(candRank[j] - r)
+		}
+		overlap[i] = float64(kept) / float64(topK)
+		shift[i] = float64(moved) / float64(topK)
+	}
+	report.TopKOverlap = summarize(overlap)
+	report.RankShift = summarize(shift)
+	return report, nil
+}
+
+// ModelDrift loads the baseline and candidate encoders side by side and
+// compares how they rank a sample of stored texts, so that a model upgrade
+// can be judged before the dataset is re-embedded with it.
+func (s *Service) ModelDrift(ctx context.Context, opts DriftOptions) (DriftReport, error) {
+	if ctx == nil {
+		return DriftReport{}, fmt.Errorf("context must not be nil")
+	}
+
+	texts := cloneStrings(opts.Texts)
+	if len(texts) == 0 {
+		sampled, err := s.sampleTexts(ctx, opts.Dataset, opts.Table, firstPositive(opts.Samples, 100))
+		if err != nil {
+			return DriftReport{}, err
+		}
+		texts = sampled
+	}
+	if len(texts) == 0 {
+		texts = cloneStrings(defaultParityTexts)
+	}
+
+	base := s.EncoderConfig()
+	baseline, err := newEncoder(mergeEncoderConfig(base, opts.Baseline))
+	if err != nil {
+		return DriftReport{}, fmt.Errorf("baseline encoder: %w", err)
+	}
+	defer baseline.Close()
+	candidate, err := newEncoder(mergeEncoderConfig(base, opts.Candidate))
+	if err != nil {
+		return DriftReport{}, fmt.Errorf("candidate encoder: %w", err)
+	}
+	defer candidate.Close()
+
+	return CompareModels(baseline, candidate, texts, opts.TopK)
+}
+
+// similarityMatrix returns the cosine similarity of every pair of vecs.
+func similarityMatrix(vecs [][]float32) [][]float64 {
+	sim := make([][]float64, len(vecs))
+	for i := range vecs {
+		sim[i] = make([]float64, len(vecs))
+	}
+	for i := range vecs {
+		for j := i + 1; j < len(vecs); j++ {
+			sim[i][j] = vector.Cosine(vecs[i], vecs[j])
+			sim[j][i] = sim[i][j]
+		}
+	}
+	return sim
+}
+
+// neighbourRanks returns the 0-based rank of every text by descending
+// similarity to text self, which is left out (rank -1). Ties keep the order
+// of the texts.
+func neighbourRanks(similarities []float64, self int) []int {
+	order := make([]int, 0, len(similarities)-1)
+	for j := range similarities {
+		if j != self {
+			order = append(order, j)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool { return similarities[order[a]] > similarities[order[b]] })
+	ranks := make([]int, len(similarities))
+	ranks[self] = -1
+	for r, j := range order {
+		ranks[j] = r
+	}
+	return ranks
+}
+
+// summarize returns the distribution of values, which it sorts.
+func summarize(values []float64) Distribution {
+	if len(values) == 0 {
+		return Distribution{}
+	}
+	sort.Float64s(values)
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	rank := func(p float64) float64 {
+		r := int(p*float64(len(values))+0.5) - 1
+		return values[min(max(r, 0), len(values)-1)]
+	}
+	return Distribution{
+		Mean: sum / float64(len(values)),
+		Min:  values[0],
+		P50:  rank(0.5),
+		P95:  rank(0.95),
+		Max:  values[len(values)-1],
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,96 @@
+package csvsearch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"yashubustudio/csv-search/internal/embedding"
+)
+
+// EmbedOptions configure Embed.
+type EmbedOptions struct {
+	Texts []string
+	// Sparse also returns the bge-m3 lexical weights; it fails when the
+	// encoder has no sparse head.
+	Sparse bool
+}
+
+// Embedding is the raw encoder output for one text, exactly as it would be
+// stored by ingest (after the configured text normalization).
+type Embedding struct {
+	Text      string            `json:"text"`
+	Model     string            `json:"model,omitempty"`
+	Dimension int               `json:"dimension"`
+	Vector    []float32         `json:"vector"`
+	Sparse    map[int32]float32 `json:"sparse,omitempty"`
+	// Tokens is the number of tokens encoded, special tokens included and
+	// after truncation; zero when the encoder does not count tokens.
+	Tokens int `json:"tokens,omitempty"`
+}
+
+// Embed encodes each text with the active encoder and returns the vectors
+// in input order, with their token counts when the encoder implements
+// TokenCounter.
+func (s *Service) Embed(ctx context.Context, opts EmbedOptions) ([]Embedding, error) {
+	if len(opts.Texts) == 0 {
+		return nil, fmt.Errorf("at least one text is required")
+	}
+	for i, text := range opts.Texts {
+		if strings.TrimSpace(text) == "" {
+			return nil, fmt.Errorf("text %d is empty", i+1)
+		}
+	}
+	enc, model, release, err := s.acquireModel()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	out := make([]Embedding, len(opts.Texts))
+	if opts.Sparse {
+		sparse, ok := embedding.Sparse(enc)
+		if !ok {
+			return nil, errNoSparse
+		}
+		for i, text := range opts.Texts {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			vec, weights, err := sparse.EncodeHybrid(text)
+			if err != nil {
+				return nil, fmt.Errorf("encode text %d: %w", i+1, err)
+			}
+			out[i] = Embedding{Text: text, Model: model, Dimension: len(vec), Vector: vec, Sparse: weights}
+		}
+		return out, countTokens(enc, out)
+	}
+
+	vecs, err := enc.EncodeBatch(opts.Texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vecs) != len(opts.Texts) {
+		return nil, fmt.Errorf("encoder returned %d vectors for %d texts", len(vecs), len(opts.Texts))
+	}
+	for i, vec := range vecs {
+		out[i] = Embedding{Text: opts.Texts[i], Model: model, Dimension: len(vec), Vector: vec}
+	}
+	return out, countTokens(enc, out)
+}
+
+// countTokens sets the token counts of embeddings when enc counts tokens.
+func countTokens(enc Embedder, embeddings []Embedding) error {
+	counter, ok := embedding.Tokens(enc)
+	if !ok {
+		return nil
+	}
+	for i := range embeddings {
+		n, err := counter.CountTokens(embeddings[i].Text)
+		if err != nil {
+			return fmt.Errorf("count tokens of text %d: %w", i+1, err)
+		}
+		embeddings[i].Tokens = n
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package csvsearch
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// countingEmbedder counts one token per word.
+type countingEmbedder struct{ fakeEmbedder }
+
+func (countingEmbedder) CountsTokens() bool { return true }
+
+func (countingEmbedder) CountTokens(text string) (int, error) {
+	return len(strings.Fields(text)), nil
+}
+
+func TestEmbed(t *testing.T) {
+	ctx := context.Background()
+	svc, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(t.TempDir(), "app.db")},
+		Encoder: EncoderOptions{
+			Embedder: fakeEmbedder{dim: 2},
+			Config:   EncoderConfig{ModelVersion: "fake-v1", Normalize: []string{"space"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+
+	got, err := svc.Embed(ctx, EmbedOptions{Texts: []string{"abc", "  hello   world "}})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(got) != 2 || got[0].Model != "fake-v1" || got[0].Dimension != 2 || got[0].Vector[0] != 3 || got[0].Tokens != 0 {
+		t.Fatalf("unexpected embeddings: %+v", got)
+	}
+	// Normalization applies as it does at ingest time.
+	if got[1].Text != "  hello   world " || got[1].Vector[0] != float32(len("hello world")) {
+		t.Fatalf("expected the normalized text to be encoded, got %+v", got[1])
+	}
+
+	if _, err := svc.Embed(ctx, EmbedOptions{Texts: []string{"abc", " "}}); err == nil {
+		t.Fatalf("expected an error for an empty text")
+	}
+	if _, err := svc.Embed(ctx, EmbedOptions{Texts: []string{"abc"}, Sparse: true}); !errors.Is(err, errNoSparse) {
+		t.Fatalf("expected errNoSparse, got %v", err)
+	}
+}
+
+func TestEmbedTokens(t *testing.T) {
+	svc := newTestService(t, "", WithEmbedder(countingEmbedder{fakeEmbedder{dim: 2}}), WithEncoderConfig(EncoderConfig{Normalize: []string{"space"}}))
+
+	got, err := svc.Embed(context.Background(), EmbedOptions{Texts: []string{"tokyo tower", " a  b c "}})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if got[0].Tokens != 2 || got[1].Tokens != 3 {
+		t.Fatalf("unexpected token counts: %d, %d", got[0].Tokens, got[1].Tokens)
+	}
+}
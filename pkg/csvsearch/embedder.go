@@ -0,0 +1,66 @@
+package csvsearch
+
+import (
+	"errors"
+
+	"yashubustudio/csv-search/emb"
+	"yashubustudio/csv-search/internal/embedding"
+)
+
+// Embedder converts text into dense vectors. Applications can supply their own
+// implementation through EncoderOptions.Embedder instead of the bundled ONNX
+// encoder. Implementations must be safe for concurrent use and return vectors
+// of length Dimension().
+type Embedder interface {
+	Encode(text string) ([]float32, error)
+	EncodeBatch(texts []string) ([][]float32, error)
+	Dimension() int
+	Close() error
+}
+
+// SparseEmbedder is optionally implemented by embedders that can also emit
+// bge-m3 style lexical weights, enabling hybrid retrieval.
+type SparseEmbedder interface {
+	Embedder
+	HasSparse() bool
+	EncodeHybrid(text string) ([]float32, map[int32]float32, error)
+}
+
+// TokenCounter is optionally implemented by embedders that can report the
+// number of tokens they encode for a text, returned by Embed.
+type TokenCounter interface {
+	Embedder
+	CountsTokens() bool
+	CountTokens(text string) (int, error)
+}
+
+var (
+	errNoSparse = withKind(ErrEncoder, errors.New("sparse head is not configured"))
+	errNoTokens = withKind(ErrEncoder, errors.New("encoder does not count tokens"))
+)
+
+var (
+	_ embedding.Embedder       = Embedder(nil)
+	_ embedding.SparseEmbedder = SparseEmbedder(nil)
+	_ embedding.TokenCounter   = TokenCounter(nil)
+	_ SparseEmbedder           = (*onnxEmbedder)(nil)
+	_ TokenCounter             = (*onnxEmbedder)(nil)
+)
+
+// onnxEmbedder adapts emb.Encoder to the Embedder interface.
+type onnxEmbedder struct {
+	*emb.Encoder
+}
+
+// WrapEncoder exposes an initialized emb.Encoder as an Embedder.
+func WrapEncoder(enc *emb.Encoder) Embedder {
+	if enc == nil {
+		return nil
+	}
+	return onnxEmbedder{Encoder: enc}
+}
+
+func (e onnxEmbedder) Close() error {
+	e.Encoder.Close()
+	return nil
+}
@@ -0,0 +1,33 @@
+package csvsearch
+
+import "errors"
+
+// Error kinds returned by the Service. Test for them with errors.Is; the
+// error message is left unchanged.
+var (
+	// ErrConfig reports a configuration file that cannot be read or parsed.
+	ErrConfig = errors.New("configuration error")
+	// ErrDatabase reports a database that cannot be opened or initialized.
+	ErrDatabase = errors.New("database error")
+	// ErrEncoder reports an encoder that cannot be loaded or lacks a
+	// requested capability such as the sparse head.
+	ErrEncoder = errors.New("encoder error")
+	// ErrClosed reports a call made after Close.
+	ErrClosed = errors.New("service is closed")
+)
+
+// kindError tags err with one of the error kinds above.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func withKind(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.kind, e.err} }
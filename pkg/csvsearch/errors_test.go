@@ -0,0 +1,36 @@
+package csvsearch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestErrorKinds(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "broken.json")
+	if err := os.WriteFile(cfgPath, []byte(`{"unknown": true}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	_, err := NewService(ServiceOptions{Config: ConfigReference{Path: cfgPath, Required: true}})
+	if !errors.Is(err, ErrConfig) || err.Error() == ErrConfig.Error() {
+		t.Fatalf("expected ErrConfig with the original message, got %v", err)
+	}
+
+	svc, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "app.db")},
+		Encoder:  EncoderOptions{Config: EncoderConfig{OrtLibrary: filepath.Join(dir, "missing.so")}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+	if _, err := svc.Search(context.Background(), SearchOptions{Query: "hello"}); !errors.Is(err, ErrEncoder) {
+		t.Fatalf("expected ErrEncoder, got %v", err)
+	}
+	if _, err := svc.Get(context.Background(), "docs", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
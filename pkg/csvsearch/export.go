@@ -0,0 +1,154 @@
+package csvsearch
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"yashubustudio/csv-search/internal/store"
+)
+
+// Export formats accepted by ExportOptions.Format.
+const (
+	ExportJSONL = "jsonl"
+	ExportCSV   = "csv"
+)
+
+// ExportOptions select what Export writes.
+type ExportOptions struct {
+	Dataset string
+	Table   string
+	// Format is ExportJSONL (the default) or ExportCSV.
+	Format string
+	// IncludeEmbeddings adds the dense embedding and, when stored, the
+	// bge-m3 sparse weights of every record.
+	IncludeEmbeddings bool
+}
+
+// ExportSummary reports what Export wrote.
+type ExportSummary struct {
+	Dataset string `json:"dataset"`
+	Table   string `json:"table"`
+	Format  string `json:"format"`
+	Records int    `json:"records"`
+}
+
+// ExportedRecord is the JSON Lines representation of a stored record, as
+// written by Export and read by Import. Besides the Record fields it holds
+// the text indexed for full-text search ("text") and, when embeddings are
+// included, the dense vector ("embedding"), the model that produced it
+// ("model") and the bge-m3 lexical weights keyed by token id ("sparse").
+type ExportedRecord struct {
+	Record
+	Text      string            `json:"text,omitempty"`
+	Embedding []float32         `json:"embedding,omitempty"`
+	Model     string            `json:"model,omitempty"`
+	Sparse    map[int32]float32 `json:"sparse,omitempty"`
+}
+
+// Export writes every record of a dataset to w, for audits and migrations.
+// JSON Lines emits one ExportedRecord per line. CSV emits the metadata fields
+// as columns next to the reserved _id, _lat and _lng columns (plus _embedding
+// and _sparse as JSON when embeddings are included).
+func (s *Service) Export(ctx context.Context, w io.Writer, opts ExportOptions) (ExportSummary, error) {
+	if w == nil {
+		return ExportSummary{}, fmt.Errorf("writer is nil")
+	}
+	if err := s.ready(ctx); err != nil {
+		return ExportSummary{}, err
+	}
+
+	format := strings.ToLower(strings.TrimSpace(opts.Format))
+	if format == "" {
+		format = ExportJSONL
+	}
+	datasetName, datasetCfg, _ := resolveDataset(s.Config(), opts.Dataset)
+	table := resolveTable(datasetName, datasetCfg, opts.Table)
+	summary := ExportSummary{Dataset: datasetName, Table: table, Format: format}
+
+	var err error
+	switch format {
+	case ExportJSONL:
+		encoder := json.NewEncoder(w)
+		err = store.Each(ctx, s.db, table, opts.IncludeEmbeddings, func(rec store.ExportedRecord) error {
+			summary.Records++
+			return encoder.Encode(ExportedRecord{
+				Record:    Record(rec.Record),
+				Text:      rec.Text,
+				Embedding: rec.Embedding,
+				Model:     rec.Model,
+				Sparse:    rec.Sparse,
+			})
+		})
+	case ExportCSV:
+		summary.Records, err = s.exportCSV(ctx, w, table, opts.IncludeEmbeddings)
+	default:
+		return ExportSummary{}, fmt.Errorf("unknown export format %q (want %q or %q)", opts.Format, ExportJSONL, ExportCSV)
+	}
+	if err != nil {
+		return ExportSummary{}, err
+	}
+	return summary, nil
+}
+
+func (s *Service) exportCSV(ctx context.Context, w io.Writer, table string, withEmbeddings bool) (int, error) {
+	fields, err := store.FieldNames(ctx, s.db, table)
+	if err != nil {
+		return 0, err
+	}
+	header := append([]string{"_id"}, fields...)
+	header = append(header, "_lat", "_lng")
+	if withEmbeddings {
+		header = append(header, "_embedding", "_sparse")
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return 0, err
+	}
+	count := 0
+	row := make([]string, len(header))
+	err = store.Each(ctx, s.db, table, withEmbeddings, func(rec store.ExportedRecord) error {
+		row[0] = rec.ID
+		for i, field := range fields {
+			row[1+i] = rec.Fields[field]
+		}
+		n := 1 + len(fields)
+		row[n], row[n+1] = formatCoordinate(rec.Lat), formatCoordinate(rec.Lng)
+		if withEmbeddings {
+			row[n+2], row[n+3] = "", ""
+			if rec.Embedding != nil {
+				data, err := json.Marshal(rec.Embedding)
+				if err != nil {
+					return err
+				}
+				row[n+2] = string(data)
+			}
+			if rec.Sparse != nil {
+				data, err := json.Marshal(rec.Sparse)
+				if err != nil {
+					return err
+				}
+				row[n+3] = string(data)
+			}
+		}
+		count++
+		return cw.Write(row)
+	})
+	if err != nil {
+		return 0, err
+	}
+	cw.Flush()
+	return count, cw.Error()
+}
+
+func formatCoordinate(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
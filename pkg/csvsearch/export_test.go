@@ -0,0 +1,239 @@
+package csvsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"yashubustudio/csv-search/internal/vector"
+)
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "docs.csv")
+	if err := os.WriteFile(csvPath, []byte("id,title,lat,lng\n1,hello,35.6,139.7\n2,world,,\n"), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+
+	svc, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "app.db")},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+
+	if _, err := svc.Ingest(ctx, IngestOptions{
+		Dataset:         "docs",
+		CSVPath:         csvPath,
+		TextColumns:     []string{"title"},
+		LatitudeColumn:  "lat",
+		LongitudeColumn: "lng",
+	}); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+
+	var buf bytes.Buffer
+	summary, err := svc.Export(ctx, &buf, ExportOptions{Dataset: "docs", IncludeEmbeddings: true})
+	if err != nil {
+		t.Fatalf("Export jsonl: %v", err)
+	}
+	if summary.Records != 2 || summary.Format != ExportJSONL {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var first ExportedRecord
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("decode jsonl: %v", err)
+	}
+	if len(lines) != 2 || first.ID != "1" || first.Fields["title"] != "hello" || len(first.Embedding) != 2 || first.Lat == nil {
+		t.Fatalf("unexpected jsonl export: %q", buf.String())
+	}
+
+	buf.Reset()
+	if _, err := svc.Export(ctx, &buf, ExportOptions{Dataset: "docs", Format: "csv"}); err != nil {
+		t.Fatalf("Export csv: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv export: %v", err)
+	}
+	want := []string{"_id,id,lat,lng,title,_lat,_lng", "1,1,35.6,139.7,hello,35.6,139.7", "2,2,,,world,,"}
+	if len(rows) != len(want) {
+		t.Fatalf("unexpected csv export: %v", rows)
+	}
+	for i, row := range rows {
+		if got := strings.Join(row, ","); got != want[i] {
+			t.Fatalf("csv row %d: got %q, want %q", i, got, want[i])
+		}
+	}
+
+	if _, err := svc.Export(ctx, &buf, ExportOptions{Dataset: "docs", Format: "xml"}); err == nil {
+		t.Fatalf("expected an error for an unknown format")
+	}
+
+	ids, err := svc.FindIDs(ctx, "docs", []Filter{{Field: "title", Value: "world"}})
+	if err != nil {
+		t.Fatalf("FindIDs: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != "2" {
+		t.Fatalf("unexpected matching ids: %v", ids)
+	}
+}
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "docs.csv")
+	if err := os.WriteFile(csvPath, []byte("id,title,lat,lng\n1,hello,35.6,139.7\n2,world,,\n"), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+
+	src, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "src.db")},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer src.Close()
+	if _, err := src.Ingest(ctx, IngestOptions{
+		Dataset:         "docs",
+		CSVPath:         csvPath,
+		TextColumns:     []string{"title"},
+		LatitudeColumn:  "lat",
+		LongitudeColumn: "lng",
+	}); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	var exported bytes.Buffer
+	if _, err := src.Export(ctx, &exported, ExportOptions{Dataset: "docs", IncludeEmbeddings: true}); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+
+	// The destination encodes differently, so re-encoded records would not
+	// round-trip.
+	dst, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "dst.db")},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2, shift: 1}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer dst.Close()
+	input := exported.String() + "\n" + `{"dataset":"notes","id":"n1","text":"abc"}` + "\n"
+	summary, err := dst.Import(ctx, strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if summary.Records != 3 || len(summary.Datasets) != 2 || summary.Datasets[0].Upserted != 2 || summary.Datasets[1].Upserted != 1 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	var roundTrip bytes.Buffer
+	if _, err := dst.Export(ctx, &roundTrip, ExportOptions{Dataset: "docs", IncludeEmbeddings: true}); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if roundTrip.String() != exported.String() {
+		t.Fatalf("round trip changed the records:\n%s\nwant:\n%s", roundTrip.String(), exported.String())
+	}
+	note, err := dst.Get(ctx, "notes", "n1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if note.ID != "n1" {
+		t.Fatalf("unexpected record: %+v", note)
+	}
+	results, err := dst.Search(ctx, SearchOptions{Dataset: "notes", Query: "abc", IncludeVectors: true})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) != 1 || !reflect.DeepEqual(results[0].Vector, []float32{3, 2}) {
+		t.Fatalf("expected the record without an embedding to be encoded, got %+v", results)
+	}
+
+	if _, err := dst.Import(ctx, strings.NewReader("{not json}\n")); err == nil {
+		t.Fatalf("expected an error for a malformed line")
+	}
+}
+
+func TestVectorExportImport(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t, "id,title\n1,hello\n2,world\n3,tokyo tower\n")
+
+	for _, format := range []string{VectorsNPY, VectorsFvecs} {
+		var vectors, ids bytes.Buffer
+		summary, err := svc.ExportVectors(ctx, &vectors, &ids, VectorExportOptions{Dataset: "docs", Format: format})
+		if err != nil {
+			t.Fatalf("ExportVectors %s: %v", format, err)
+		}
+		if summary.Vectors != 3 || summary.Dimension != 2 || ids.String() != "1\n2\n3\n" {
+			t.Fatalf("unexpected %s export: %+v %q", format, summary, ids.String())
+		}
+		// Importing the exported vectors leaves them in place.
+		imported, err := svc.ImportVectors(ctx, &vectors, &ids, VectorImportOptions{Dataset: "docs", Format: format})
+		if err != nil {
+			t.Fatalf("ImportVectors %s: %v", format, err)
+		}
+		if imported.Vectors != 3 || imported.Missing != 0 {
+			t.Fatalf("unexpected %s import: %+v", format, imported)
+		}
+	}
+
+	// External vectors replace the embeddings: record 3 now points to where
+	// record 1 did.
+	var vectors bytes.Buffer
+	rec := func(id string) []float32 {
+		var buf bytes.Buffer
+		if _, err := svc.Export(ctx, &buf, ExportOptions{Dataset: "docs", IncludeEmbeddings: true}); err != nil {
+			t.Fatalf("Export: %v", err)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var r ExportedRecord
+			if err := json.Unmarshal([]byte(line), &r); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if r.ID == id {
+				return r.Embedding
+			}
+		}
+		t.Fatalf("record %s not exported", id)
+		return nil
+	}
+	want := rec("1")
+	if err := vector.WriteNPYHeader(&vectors, 2, 2); err != nil {
+		t.Fatal(err)
+	}
+	vectors.Write(vector.Serialize(want))
+	vectors.Write(vector.Serialize(want))
+	summary, err := svc.ImportVectors(ctx, &vectors, strings.NewReader("3\nmissing\n"), VectorImportOptions{Dataset: "docs", Model: "external-v1"})
+	if err != nil {
+		t.Fatalf("ImportVectors: %v", err)
+	}
+	if summary.Vectors != 1 || summary.Missing != 1 {
+		t.Fatalf("unexpected import: %+v", summary)
+	}
+	if got := rec("3"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("embedding of 3 = %v, want %v", got, want)
+	}
+
+	// Vectors of another dimension than the stored ones are rejected.
+	vectors.Reset()
+	vector.WriteFvec(&vectors, []float32{1, 2, 3})
+	if _, err := svc.ImportVectors(ctx, &vectors, strings.NewReader("2\n"), VectorImportOptions{Dataset: "docs", Format: VectorsFvecs}); err == nil {
+		t.Fatalf("expected a dimension mismatch to be rejected")
+	}
+	vectors.Reset()
+	vector.WriteFvec(&vectors, []float32{1, 2})
+	if _, err := svc.ImportVectors(ctx, &vectors, strings.NewReader("1\n2\n"), VectorImportOptions{Dataset: "docs", Format: VectorsFvecs}); err == nil {
+		t.Fatalf("expected surplus ids to be rejected")
+	}
+}
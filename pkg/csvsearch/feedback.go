@@ -0,0 +1,156 @@
+package csvsearch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"yashubustudio/csv-search/internal/querylog"
+	intsearch "yashubustudio/csv-search/internal/search"
+	"yashubustudio/csv-search/internal/server"
+	"yashubustudio/csv-search/internal/store"
+)
+
+// FeedbackOptions describe a result a user selected for a query.
+type FeedbackOptions struct {
+	Query   string
+	Dataset string
+	Table   string
+	// ID is the selected result.
+	ID string
+	// Position is the 1-based rank of ID among the results shown, or zero
+	// when unknown.
+	Position int
+	// Shown are the ids of the results shown with ID, best first. Feedback
+	// without them is stored but does not inform TuneBoosts, which compares
+	// the selected result with the others.
+	Shown []string
+}
+
+// RecordFeedback stores which result a user selected for a query in the
+// feedback table, for TuneBoosts.
+func (s *Service) RecordFeedback(ctx context.Context, opts FeedbackOptions) error {
+	if err := s.ready(ctx); err != nil {
+		return err
+	}
+	query := strings.TrimSpace(opts.Query)
+	if query == "" {
+		return fmt.Errorf("query is required")
+	}
+	id := strings.TrimSpace(opts.ID)
+	if id == "" {
+		return fmt.Errorf("id is required")
+	}
+	if opts.Position < 0 {
+		return fmt.Errorf("position must not be negative")
+	}
+	datasetName, datasetCfg, _ := resolveDataset(s.Config(), opts.Dataset)
+	return querylog.InsertFeedback(ctx, s.db, querylog.Feedback{
+		Dataset:  resolveTable(datasetName, datasetCfg, opts.Table),
+		Query:    query,
+		Selected: id,
+		Position: opts.Position,
+		Shown:    opts.Shown,
+	})
+}
+
+// TuneOptions select the feedback fitted by TuneBoosts.
+type TuneOptions struct {
+	Dataset string
+	Table   string
+	// Since limits the fit to feedback recorded after this time.
+	Since time.Time
+	// MaxBoost is the weight of a field that always told the selected result
+	// apart from the others shown (0.2 when zero).
+	MaxBoost float64
+}
+
+// BoostFit is the outcome of TuneBoosts. FieldBoosts can be copied into
+// search.field_boosts of the dataset in the config.
+type BoostFit struct {
+	Dataset string `json:"dataset"`
+	// Feedback counts the feedback read; Used the feedback whose selected
+	// result and at least one other shown result still exist.
+	Feedback    int                `json:"feedback"`
+	Used        int                `json:"used"`
+	FieldBoosts map[string]float64 `json:"field_boosts"`
+}
+
+// TuneBoosts fits per-field boost weights from the recorded feedback: fields
+// whose values match the query better on the selected results than on the
+// other results shown get a positive weight. Records that no longer exist
+// are left out.
+func (s *Service) TuneBoosts(ctx context.Context, opts TuneOptions) (BoostFit, error) {
+	if err := s.ready(ctx); err != nil {
+		return BoostFit{}, err
+	}
+	if opts.MaxBoost < 0 {
+		return BoostFit{}, fmt.Errorf("max boost must not be negative")
+	}
+	datasetName, datasetCfg, _ := resolveDataset(s.Config(), opts.Dataset)
+	table := resolveTable(datasetName, datasetCfg, opts.Table)
+	feedback, err := querylog.LoadFeedback(ctx, s.db, table, opts.Since)
+	if err != nil {
+		return BoostFit{}, err
+	}
+
+	records := make(map[string]map[string]string)
+	fields := func(id string) (map[string]string, error) {
+		if f, ok := records[id]; ok {
+			return f, nil
+		}
+		rec, err := store.Get(ctx, s.db, table, id)
+		if errors.Is(err, store.ErrNotFound) {
+			err = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records[id] = rec.Fields
+		return rec.Fields, nil
+	}
+
+	fit := BoostFit{Dataset: table, Feedback: len(feedback)}
+	samples := make([]intsearch.BoostSample, 0, len(feedback))
+	for _, f := range feedback {
+		selected, err := fields(f.Selected)
+		if err != nil {
+			return BoostFit{}, err
+		}
+		if selected == nil {
+			continue
+		}
+		sample := intsearch.BoostSample{Query: f.Query, Selected: selected}
+		for _, id := range f.Shown {
+			if id == f.Selected {
+				continue
+			}
+			other, err := fields(id)
+			if err != nil {
+				return BoostFit{}, err
+			}
+			if other != nil {
+				sample.Others = append(sample.Others, other)
+			}
+		}
+		if len(sample.Others) == 0 {
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	fit.Used = len(samples)
+	fit.FieldBoosts = intsearch.FitFieldBoosts(samples, opts.MaxBoost)
+	return fit, nil
+}
+
+func (s *Service) serverFeedback(ctx context.Context, req server.FeedbackRequest) error {
+	return s.RecordFeedback(ctx, FeedbackOptions{
+		Query:    req.Query,
+		Table:    req.Dataset,
+		ID:       req.ID,
+		Position: req.Position,
+		Shown:    req.Shown,
+	})
+}
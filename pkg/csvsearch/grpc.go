@@ -0,0 +1,408 @@
+package csvsearch
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"yashubustudio/csv-search/internal/server"
+	"yashubustudio/csv-search/pkg/csvsearchpb"
+)
+
+// GRPCOptions configure the gRPC API server exposed by the Service.
+type GRPCOptions struct {
+	Address         string
+	Dataset         string
+	TopK            int
+	RequestTimeout  time.Duration
+	ShutdownTimeout time.Duration
+	// AdminToken protects Ingest and Delete like the HTTP admin endpoints:
+	// callers must send "authorization: Bearer <token>" metadata. Without it
+	// they only accept loopback peers.
+	AdminToken string
+	// TLSCertFile and TLSKeyFile enable TLS with automatic reloading of
+	// rotated certificates.
+	TLSCertFile string
+	TLSKeyFile  string
+	// ServerOptions are passed to grpc.NewServer (credentials, interceptors,
+	// message size limits, ...).
+	ServerOptions []grpc.ServerOption
+}
+
+// GRPCServer wraps a grpc.Server serving the csvsearch.v1.CSVSearch service.
+type GRPCServer struct {
+	server          *grpc.Server
+	log             *slog.Logger
+	addr            string
+	shutdownTimeout time.Duration
+}
+
+// Server exposes the underlying grpc.Server so that callers can register
+// additional services before calling Serve.
+func (g *GRPCServer) Server() *grpc.Server {
+	if g == nil {
+		return nil
+	}
+	return g.server
+}
+
+// Serve listens on the configured address until ctx is cancelled, then stops
+// gracefully (forcing the stop after the shutdown timeout).
+func (g *GRPCServer) Serve(ctx context.Context) error {
+	if g == nil {
+		return fmt.Errorf("server is nil")
+	}
+	lis, err := net.Listen("tcp", g.addr)
+	if err != nil {
+		return err
+	}
+	g.log.Info("gRPC server listening", "addr", g.addr)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- g.server.Serve(lis)
+	}()
+
+	select {
+	case <-ctx.Done():
+		stopped := make(chan struct{})
+		go func() {
+			g.server.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(g.shutdownTimeout):
+			g.server.Stop()
+		}
+		<-errCh
+		g.log.Info("gRPC server shutdown complete")
+		return nil
+	case err := <-errCh:
+		if errors.Is(err, grpc.ErrServerStopped) {
+			return nil
+		}
+		return err
+	}
+}
+
+// NewGRPCServer prepares a gRPC server sharing the Service's database and
+// encoder.
+func (s *Service) NewGRPCServer(opts GRPCOptions) (*GRPCServer, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("database handle is nil")
+	}
+	if err := s.ensureDatabase(context.Background()); err != nil {
+		return nil, err
+	}
+	if err := s.ensureEncoderAtStart(); err != nil {
+		return nil, err
+	}
+
+	shutdownTimeout := opts.ShutdownTimeout
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = 5 * time.Second
+	}
+
+	serverOpts := opts.ServerOptions
+	certFile, keyFile := strings.TrimSpace(opts.TLSCertFile), strings.TrimSpace(opts.TLSKeyFile)
+	if certFile != "" || keyFile != "" {
+		certs, err := server.NewCertReloader(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		certs.Logger = s.log
+		serverOpts = append([]grpc.ServerOption{grpc.Creds(credentials.NewTLS(certs.TLSConfig()))}, serverOpts...)
+	}
+
+	serverOpts = append(serverOpts,
+		grpc.ChainUnaryInterceptor(GRPCAdminUnaryInterceptor(opts.AdminToken)),
+		grpc.ChainStreamInterceptor(GRPCAdminStreamInterceptor(opts.AdminToken)))
+	srv := grpc.NewServer(serverOpts...)
+	s.RegisterGRPC(srv, opts)
+	return &GRPCServer{
+		server:          srv,
+		log:             s.log,
+		addr:            firstNonEmpty(strings.TrimSpace(opts.Address), ":9090"),
+		shutdownTimeout: shutdownTimeout,
+	}, nil
+}
+
+// RegisterGRPC registers the csvsearch.v1.CSVSearch service on reg. Use it to
+// mount the API on an existing grpc.Server, created with
+// GRPCAdminUnaryInterceptor and GRPCAdminStreamInterceptor so that Ingest and
+// Delete are authorized.
+func (s *Service) RegisterGRPC(reg grpc.ServiceRegistrar, opts GRPCOptions) {
+	timeout := opts.RequestTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	csvsearchpb.RegisterCSVSearchServer(reg, &grpcService{
+		svc:     s,
+		dataset: strings.TrimSpace(opts.Dataset),
+		topK:    opts.TopK,
+		timeout: timeout,
+	})
+}
+
+// grpcAdminMethods lists the methods that write to the database, which
+// require the admin token.
+var grpcAdminMethods = map[string]bool{
+	csvsearchpb.CSVSearch_Ingest_FullMethodName: true,
+	csvsearchpb.CSVSearch_Delete_FullMethodName: true,
+}
+
+// GRPCAdminUnaryInterceptor authorizes the calls to Ingest and Delete: with
+// a token, they must carry it as "authorization: Bearer <token>" metadata;
+// without one, they are restricted to loopback peers.
+func GRPCAdminUnaryInterceptor(token string) grpc.UnaryServerInterceptor {
+	token = strings.TrimSpace(token)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if grpcAdminMethods[info.FullMethod] {
+			if err := authorizeGRPCAdmin(ctx, token); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// GRPCAdminStreamInterceptor is GRPCAdminUnaryInterceptor for streaming
+// methods.
+func GRPCAdminStreamInterceptor(token string) grpc.StreamServerInterceptor {
+	token = strings.TrimSpace(token)
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if grpcAdminMethods[info.FullMethod] {
+			if err := authorizeGRPCAdmin(stream.Context(), token); err != nil {
+				return err
+			}
+		}
+		return handler(srv, stream)
+	}
+}
+
+// authorizeGRPCAdmin checks the bearer token of a call when one is
+// configured and otherwise restricts it to loopback peers.
+func authorizeGRPCAdmin(ctx context.Context, token string) error {
+	if token != "" {
+		const prefix = "Bearer "
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, header := range md.Get("authorization") {
+			if strings.HasPrefix(header, prefix) && subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, prefix)), []byte(token)) == 1 {
+				return nil
+			}
+		}
+		return status.Error(codes.Unauthenticated, "admin token required")
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+			return nil
+		}
+	}
+	return status.Error(codes.PermissionDenied, "ingest and delete are restricted to localhost unless an admin token is configured")
+}
+
+type grpcService struct {
+	csvsearchpb.UnimplementedCSVSearchServer
+
+	svc     *Service
+	dataset string
+	topK    int
+	timeout time.Duration
+}
+
+func (g *grpcService) Search(ctx context.Context, req *csvsearchpb.SearchRequest) (*csvsearchpb.SearchResponse, error) {
+	results, err := g.search(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	resp := &csvsearchpb.SearchResponse{Results: make([]*csvsearchpb.SearchResult, len(results))}
+	for i, r := range results {
+		resp.Results[i] = resultToProto(r)
+	}
+	return resp, nil
+}
+
+func (g *grpcService) SearchStream(req *csvsearchpb.SearchRequest, stream grpc.ServerStreamingServer[csvsearchpb.SearchResult]) error {
+	results, err := g.search(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		if err := stream.Send(resultToProto(r)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *grpcService) search(ctx context.Context, req *csvsearchpb.SearchRequest) ([]Result, error) {
+	query := strings.TrimSpace(req.GetQuery())
+	if query == "" && len(req.GetFilters()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "query or filter is required")
+	}
+	opts := SearchOptions{
+		Query:   query,
+		Dataset: firstNonEmpty(strings.TrimSpace(req.GetDataset()), g.dataset),
+		TopK:    firstPositive(int(req.GetTopK()), g.topK),
+		Source:  "grpc",
+	}
+	for _, f := range req.GetFilters() {
+		field := strings.TrimSpace(f.GetField())
+		if field == "" {
+			return nil, status.Error(codes.InvalidArgument, "filter field must not be empty")
+		}
+		opts.Filters = append(opts.Filters, Filter{Field: field, Value: f.GetValue()})
+	}
+	if req.SparseWeight != nil {
+		opts.SparseWeight = req.GetSparseWeight()
+		if opts.SparseWeight == 0 {
+			// An explicit zero disables hybrid scoring instead of falling back
+			// to the configured default.
+			opts.SparseWeight = -1
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+	results, err := g.svc.Search(ctx, opts)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return results, nil
+}
+
+func (g *grpcService) Ingest(ctx context.Context, req *csvsearchpb.IngestRequest) (*csvsearchpb.IngestResponse, error) {
+	if path := strings.TrimSpace(req.GetCsvPath()); path != "" && len(req.GetCsvData()) == 0 && !g.svc.isDatasetCSV(req.GetDataset(), path) {
+		return nil, status.Error(codes.PermissionDenied, "csv_path must be the csv configured for the dataset; send other files as csv_data")
+	}
+	opts := IngestOptions{
+		Dataset:         strings.TrimSpace(req.GetDataset()),
+		Table:           strings.TrimSpace(req.GetTable()),
+		CSVPath:         strings.TrimSpace(req.GetCsvPath()),
+		BatchSize:       int(req.GetBatchSize()),
+		IDColumn:        strings.TrimSpace(req.GetIdColumn()),
+		TextColumns:     req.GetTextColumns(),
+		MetadataColumns: req.GetMetadataColumns(),
+		LatitudeColumn:  strings.TrimSpace(req.GetLatitudeColumn()),
+		LongitudeColumn: strings.TrimSpace(req.GetLongitudeColumn()),
+		Sparse:          req.GetSparse(),
+	}
+
+	if data := req.GetCsvData(); len(data) > 0 {
+		path, cleanup, err := writeTempCSV(data)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "store upload: %v", err)
+		}
+		defer cleanup()
+		opts.CSVPath = path
+	}
+
+	summary, err := g.svc.Ingest(ctx, opts)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	resp := &csvsearchpb.IngestResponse{Dataset: summary.Dataset, Table: summary.Table}
+	if len(req.GetCsvData()) == 0 {
+		resp.CsvPath = summary.CSVPath
+	}
+	return resp, nil
+}
+
+func (g *grpcService) Get(ctx context.Context, req *csvsearchpb.GetRequest) (*csvsearchpb.Record, error) {
+	if strings.TrimSpace(req.GetId()) == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	rec, err := g.svc.Get(ctx, firstNonEmpty(strings.TrimSpace(req.GetDataset()), g.dataset), req.GetId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &csvsearchpb.Record{
+		Dataset: rec.Dataset,
+		Id:      rec.ID,
+		Fields:  rec.Fields,
+		Lat:     rec.Lat,
+		Lng:     rec.Lng,
+	}, nil
+}
+
+func (g *grpcService) Delete(ctx context.Context, req *csvsearchpb.DeleteRequest) (*csvsearchpb.DeleteResponse, error) {
+	if len(req.GetIds()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "at least one id is required")
+	}
+	deleted, err := g.svc.Delete(ctx, firstNonEmpty(strings.TrimSpace(req.GetDataset()), g.dataset), req.GetIds())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &csvsearchpb.DeleteResponse{Deleted: deleted}, nil
+}
+
+func (g *grpcService) Health(ctx context.Context, _ *csvsearchpb.HealthRequest) (*csvsearchpb.HealthResponse, error) {
+	if g.svc.db == nil {
+		return nil, status.Error(codes.Unavailable, "database handle is nil")
+	}
+	if err := g.svc.db.PingContext(ctx); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "database unavailable: %v", err)
+	}
+	return &csvsearchpb.HealthResponse{Status: "ok"}, nil
+}
+
+func resultToProto(r Result) *csvsearchpb.SearchResult {
+	return &csvsearchpb.SearchResult{
+		Dataset: r.Dataset,
+		Id:      r.ID,
+		Fields:  r.Fields,
+		Score:   r.Score,
+		Lat:     r.Lat,
+		Lng:     r.Lng,
+	}
+}
+
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrUnknownField):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func writeTempCSV(data []byte) (string, func(), error) {
+	file, err := os.CreateTemp("", "csv-search-upload-*.csv")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { _ = os.Remove(file.Name()) }
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		cleanup()
+		return "", nil, err
+	}
+	if err := file.Close(); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return file.Name(), cleanup, nil
+}
@@ -0,0 +1,75 @@
+package csvsearch
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"yashubustudio/csv-search/pkg/csvsearchpb"
+)
+
+// newTestGRPCClient serves the gRPC API of svc in memory, authorizing
+// writes with token, and returns a client for it.
+func newTestGRPCClient(t *testing.T, svc *Service, token string) csvsearchpb.CSVSearchClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(GRPCAdminUnaryInterceptor(token)),
+		grpc.ChainStreamInterceptor(GRPCAdminStreamInterceptor(token)))
+	svc.RegisterGRPC(srv, GRPCOptions{Dataset: "docs"})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return csvsearchpb.NewCSVSearchClient(conn)
+}
+
+func TestGRPCAdminAuthorization(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t, "id,title\n1,hello\n2,world\n")
+	client := newTestGRPCClient(t, svc, "secret")
+	code := func(err error) codes.Code { return status.Code(err) }
+
+	if _, err := client.Search(ctx, &csvsearchpb.SearchRequest{Query: "hello"}); err != nil {
+		t.Fatalf("Search without a token: %v", err)
+	}
+	if _, err := client.Delete(ctx, &csvsearchpb.DeleteRequest{Ids: []string{"1"}}); code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Delete without a token to be unauthenticated, got %v", err)
+	}
+	wrong := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer nope")
+	if _, err := client.Ingest(wrong, &csvsearchpb.IngestRequest{Dataset: "docs", CsvData: []byte("id,title\n3,x\n")}); code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Ingest with a wrong token to be unauthenticated, got %v", err)
+	}
+
+	admin := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret")
+	resp, err := client.Delete(admin, &csvsearchpb.DeleteRequest{Ids: []string{"1"}})
+	if err != nil || resp.GetDeleted() != 1 {
+		t.Fatalf("Delete with the token = %v, %v", resp, err)
+	}
+	// Server files other than the dataset's configured CSV cannot be read.
+	if _, err := client.Ingest(admin, &csvsearchpb.IngestRequest{Dataset: "docs", CsvPath: "/etc/passwd", TextColumns: []string{"title"}}); code(err) != codes.PermissionDenied {
+		t.Fatalf("expected an arbitrary csv_path to be denied, got %v", err)
+	}
+	if _, err := client.Ingest(admin, &csvsearchpb.IngestRequest{Dataset: "docs", CsvData: []byte("id,title\n3,x\n"), TextColumns: []string{"title"}}); err != nil {
+		t.Fatalf("Ingest of uploaded data with the token: %v", err)
+	}
+
+	// Without a token, writes are limited to loopback peers, which an
+	// in-memory connection is not.
+	open := newTestGRPCClient(t, svc, "")
+	if _, err := open.Delete(ctx, &csvsearchpb.DeleteRequest{Ids: []string{"2"}}); code(err) != codes.PermissionDenied {
+		t.Fatalf("expected Delete from a remote peer to be denied, got %v", err)
+	}
+}
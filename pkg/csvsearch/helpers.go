@@ -17,7 +17,7 @@ func loadConfig(path string, required bool) (*config.Config, error) {
 		if os.IsNotExist(err) && !required {
 			return nil, nil
 		}
-		return nil, err
+		return nil, withKind(ErrConfig, err)
 	}
 	return cfg, nil
 }
@@ -29,13 +29,6 @@ func configDatabasePath(cfg *config.Config) string {
 	return cfg.ResolvePath(cfg.Database.Path)
 }
 
-func cfgSearchTopK(cfg *config.Config) int {
-	if cfg == nil {
-		return 0
-	}
-	return cfg.Search.DefaultTopK
-}
-
 func firstNonEmpty(values ...string) string {
 	for _, v := range values {
 		if strings.TrimSpace(v) != "" {
@@ -76,6 +69,20 @@ func resolveDataset(cfg *config.Config, name string) (string, config.DatasetConf
 	return datasetName, config.DatasetConfig{}, false
 }
 
+// isDatasetCSV reports whether path names the CSV file configured for
+// dataset, the only server-side file that remote ingests may read.
+func (s *Service) isDatasetCSV(dataset, path string) bool {
+	cfg := s.Config()
+	_, ds, ok := resolveDataset(cfg, dataset)
+	if !ok || strings.TrimSpace(ds.CSV) == "" {
+		return false
+	}
+	if isURL(ds.CSV) || isURL(path) {
+		return ds.CSV == path
+	}
+	return cfg.ResolvePath(ds.CSV) == cfg.ResolvePath(path)
+}
+
 func resolveTable(datasetName string, dataset config.DatasetConfig, override string) string {
 	return firstNonEmpty(strings.TrimSpace(override), dataset.Table, datasetName, "default")
 }
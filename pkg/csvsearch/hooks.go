@@ -0,0 +1,189 @@
+package csvsearch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"yashubustudio/csv-search/internal/ingest"
+	intsearch "yashubustudio/csv-search/internal/search"
+	"yashubustudio/csv-search/internal/server"
+)
+
+// SearchRequest is a search as seen by the search hooks. Dataset is the
+// table searched and TopK the number of results requested, both resolved
+// against the configuration. Query is empty for Similar.
+type SearchRequest struct {
+	Query   string
+	Dataset string
+	TopK    int
+	Filters []Filter
+}
+
+// PreSearchHook may rewrite a search before it runs, e.g. to expand the query
+// or add filters. A changed Dataset keeps the scoring settings of the original
+// one. An error fails the search.
+type PreSearchHook func(ctx context.Context, req *SearchRequest) error
+
+// PostSearchHook returns the results to hand back for req, e.g. re-ranked,
+// filtered or with fields redacted. An error fails the search.
+type PostSearchHook func(ctx context.Context, req SearchRequest, results []Result) ([]Result, error)
+
+// IngestRow is a parsed CSV row about to be stored. Text holds the non-empty
+// values of the text columns, which are joined with spaces for embedding.
+type IngestRow struct {
+	Dataset  string
+	ID       string
+	Text     []string
+	Metadata map[string]string
+	Lat      *float64
+	Lng      *float64
+}
+
+// IngestRowHook may edit a row in place before it is stored, or return false
+// to drop it. An error stops the ingest.
+type IngestRowHook func(ctx context.Context, row *IngestRow) (keep bool, err error)
+
+// serviceHooks are the hooks registered on a Service, run in registration
+// order.
+type serviceHooks struct {
+	preSearch  []PreSearchHook
+	postSearch []PostSearchHook
+	ingestRow  []IngestRowHook
+	change     []ChangeHook
+	invalidate []func(tables ...string)
+}
+
+// AddPreSearchHook registers a hook run before every search: Search,
+// SearchBatch, Similar, KeywordSearch and the searches of the HTTP, WebSocket and gRPC
+// servers. Benchmarks run without hooks.
+func (s *Service) AddPreSearchHook(hook PreSearchHook) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.hooks.preSearch = append(s.hooks.preSearch, hook)
+}
+
+// AddPostSearchHook registers a hook run on the results of every search (see
+// AddPreSearchHook).
+func (s *Service) AddPostSearchHook(hook PostSearchHook) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.hooks.postSearch = append(s.hooks.postSearch, hook)
+}
+
+// AddIngestRowHook registers a hook run on every CSV row ingested by Ingest
+// and the server's upload endpoint. Rows are hashed after the hooks ran, so
+// edits made by a hook count as content changes.
+func (s *Service) AddIngestRowHook(hook IngestRowHook) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.hooks.ingestRow = append(s.hooks.ingestRow, hook)
+}
+
+func (s *Service) registeredHooks() serviceHooks {
+	s.hooksMu.RLock()
+	defer s.hooksMu.RUnlock()
+	return s.hooks
+}
+
+// preSearch runs the pre-search hooks and applies their changes to opts and
+// plan.
+func (s *Service) preSearch(ctx context.Context, opts *SearchOptions, plan *searchPlan) error {
+	hooks := s.registeredHooks().preSearch
+	if len(hooks) == 0 {
+		return nil
+	}
+	req := SearchRequest{
+		Query:   opts.Query,
+		Dataset: plan.table,
+		TopK:    plan.limit,
+		Filters: append([]Filter(nil), opts.Filters...),
+	}
+	for _, hook := range hooks {
+		if err := hook(ctx, &req); err != nil {
+			return err
+		}
+	}
+	opts.Query, opts.Filters = req.Query, req.Filters
+	plan.table = firstNonEmpty(strings.TrimSpace(req.Dataset), plan.table)
+	plan.limit = firstPositive(req.TopK, plan.limit)
+	return nil
+}
+
+// postSearch runs the post-search hooks on the results of a search.
+func (s *Service) postSearch(ctx context.Context, opts SearchOptions, plan searchPlan, results []Result) ([]Result, error) {
+	hooks := s.registeredHooks().postSearch
+	req := SearchRequest{Query: opts.Query, Dataset: plan.table, TopK: plan.limit, Filters: opts.Filters}
+	for _, hook := range hooks {
+		var err error
+		if results, err = hook(ctx, req, results); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// ingestTransform adapts the ingest-row hooks to ingest.Options.Transform; it
+// returns nil when none are registered.
+func (s *Service) ingestTransform(table string) func(context.Context, *ingest.Row) (bool, error) {
+	hooks := s.registeredHooks().ingestRow
+	if len(hooks) == 0 {
+		return nil
+	}
+	return func(ctx context.Context, row *ingest.Row) (bool, error) {
+		r := IngestRow{
+			Dataset:  table,
+			ID:       row.ID,
+			Text:     row.Text,
+			Metadata: row.Metadata,
+			Lat:      row.Lat,
+			Lng:      row.Lng,
+		}
+		for _, hook := range hooks {
+			keep, err := hook(ctx, &r)
+			if err != nil {
+				return false, fmt.Errorf("ingest hook: %w", err)
+			}
+			if !keep {
+				return false, nil
+			}
+		}
+		*row = ingest.Row{ID: r.ID, Text: r.Text, Metadata: r.Metadata, Lat: r.Lat, Lng: r.Lng}
+		return true, nil
+	}
+}
+
+// serverBeforeSearch and serverAfterSearch run the search hooks for the HTTP
+// and WebSocket servers.
+func (s *Service) serverBeforeSearch(ctx context.Context, q *server.SearchQuery) error {
+	if len(s.registeredHooks().preSearch) == 0 {
+		return nil
+	}
+	opts := SearchOptions{Query: q.Query, Filters: fromSearchFilters(q.Filters)}
+	plan := searchPlan{table: q.Dataset, limit: q.TopK}
+	if err := s.preSearch(ctx, &opts, &plan); err != nil {
+		return err
+	}
+	*q = server.SearchQuery{Query: opts.Query, Dataset: plan.table, TopK: plan.limit, Filters: toSearchFilters(opts.Filters)}
+	return nil
+}
+
+func (s *Service) serverAfterSearch(ctx context.Context, q server.SearchQuery, results []intsearch.Result) ([]intsearch.Result, error) {
+	if len(s.registeredHooks().postSearch) == 0 {
+		return results, nil
+	}
+	opts := SearchOptions{Query: q.Query, Filters: fromSearchFilters(q.Filters)}
+	converted, err := s.postSearch(ctx, opts, searchPlan{table: q.Dataset, limit: q.TopK}, convertResults(results))
+	if err != nil {
+		return nil, err
+	}
+	return toSearchResults(converted), nil
+}
+
+func fromSearchFilters(in []intsearch.Filter) []Filter {
+	filters := make([]Filter, len(in))
+	for i, f := range in {
+		filters[i] = Filter(f)
+	}
+	return filters
+}
@@ -0,0 +1,91 @@
+package csvsearch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ImportSummary reports what Import wrote, per destination dataset.
+type ImportSummary struct {
+	Records  int
+	Datasets []IngestSummary
+}
+
+// Import reads records in the JSON Lines format written by Export (one
+// ExportedRecord per line) and stores them, so datasets can be moved between
+// databases. Each line goes to the dataset named by its "dataset" field (the
+// default dataset when empty) through a Writer, so batching and ingest-row
+// hooks apply. Records with an "embedding" keep it together with their
+// "sparse" weights and "model"; the others have their "text" encoded with the
+// Service's encoder. Blank lines are ignored. On error the batches already
+// written stay in place and the queued records are discarded.
+func (s *Service) Import(ctx context.Context, r io.Reader) (ImportSummary, error) {
+	if r == nil {
+		return ImportSummary{}, fmt.Errorf("reader is nil")
+	}
+	if err := s.ready(ctx); err != nil {
+		return ImportSummary{}, err
+	}
+
+	writers := make(map[string]*Writer)
+	var summary ImportSummary
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var rec ExportedRecord
+		if err := json.Unmarshal([]byte(text), &rec); err != nil {
+			return summary, fmt.Errorf("line %d: %w", line, err)
+		}
+		dataset := strings.TrimSpace(rec.Dataset)
+		w, ok := writers[dataset]
+		if !ok {
+			var err error
+			if w, err = s.NewWriter(ctx, dataset); err != nil {
+				return summary, err
+			}
+			writers[dataset] = w
+		}
+		doc := Document{
+			ID:        rec.ID,
+			Metadata:  rec.Fields,
+			Lat:       rec.Lat,
+			Lng:       rec.Lng,
+			Embedding: rec.Embedding,
+			Sparse:    rec.Sparse,
+			Model:     rec.Model,
+		}
+		if rec.Text != "" {
+			doc.Text = []string{rec.Text}
+		}
+		if err := w.Add(doc); err != nil {
+			return summary, fmt.Errorf("line %d (id %s): %w", line, rec.ID, err)
+		}
+		summary.Records++
+	}
+	if err := scanner.Err(); err != nil {
+		return summary, err
+	}
+
+	names := make([]string, 0, len(writers))
+	for name := range writers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var err error
+	for _, name := range names {
+		if closeErr := writers[name].Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		summary.Datasets = append(summary.Datasets, writers[name].Summary())
+	}
+	return summary, err
+}
@@ -3,9 +3,16 @@ package csvsearch
 import (
 	"context"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
 	"strings"
+	"time"
 
+	"yashubustudio/csv-search/internal/database"
 	"yashubustudio/csv-search/internal/ingest"
+	intsearch "yashubustudio/csv-search/internal/search"
+	"yashubustudio/csv-search/internal/store"
 )
 
 // IngestOptions configure CSV ingestion for a logical dataset.
@@ -19,6 +26,24 @@ type IngestOptions struct {
 	MetadataColumns []string
 	LatitudeColumn  string
 	LongitudeColumn string
+	// Sparse stores bge-m3 lexical weights for hybrid retrieval. It requires
+	// an encoder configured with a sparse head.
+	Sparse bool
+	// Replace deletes the existing records of the dataset in the same
+	// transaction as the load, instead of upserting into them, so rows removed
+	// from the CSV disappear. Every row is re-embedded.
+	Replace bool
+	// Duplicates decides what happens when an ID appears on several rows of
+	// the file: "last" (the default) stores each row in turn so the last one
+	// wins, "first" keeps the first row and "error" fails the ingest, naming
+	// both rows.
+	Duplicates string
+	// Version loads the CSV as a named version of the dataset instead of
+	// into its live contents. A new version starts as a copy of the live
+	// contents, so only the rows that differ are embedded, and records
+	// missing from the CSV are removed from it. Search it with
+	// SearchOptions.Version and make it live with PromoteVersion.
+	Version string
 }
 
 // IngestSummary describes the resolved ingestion parameters that were applied.
@@ -32,6 +57,21 @@ type IngestSummary struct {
 	MetadataColumns []string
 	LatitudeColumn  string
 	LongitudeColumn string
+	Sparse          bool
+	Replace         bool
+	Duplicates      string
+	// Version is the version loaded, whose records Table holds.
+	Version string
+	// Upserted and Skipped count the rows embedded and the rows left as-is
+	// because their content was unchanged; Removed counts the records
+	// deleted by Replace (or missing from the CSV of a Version) and Dropped the rows rejected by ingest-row hooks.
+	// DuplicateRows counts the rows whose ID appeared on an earlier row.
+	Upserted      int
+	Skipped       int
+	Removed       int
+	Dropped       int
+	DuplicateRows int
+	Duration      time.Duration
 }
 
 // Ingest reads a CSV file, generates embeddings and upserts records into the
@@ -44,15 +84,16 @@ func (s *Service) Ingest(ctx context.Context, opts IngestOptions) (IngestSummary
 		return IngestSummary{}, fmt.Errorf("database handle is nil")
 	}
 
-	datasetName, dataset, hasDataset := resolveDataset(s.cfg, opts.Dataset)
+	cfg := s.Config()
+	datasetName, dataset, hasDataset := resolveDataset(cfg, opts.Dataset)
 	table := resolveTable(datasetName, dataset, opts.Table)
 
 	csvPath := strings.TrimSpace(opts.CSVPath)
 	if csvPath == "" && hasDataset {
 		csvPath = dataset.CSV
 	}
-	if s.cfg != nil {
-		csvPath = s.cfg.ResolvePath(csvPath)
+	if cfg != nil && !isURL(csvPath) {
+		csvPath = cfg.ResolvePath(csvPath)
 	}
 	if csvPath == "" {
 		return IngestSummary{}, fmt.Errorf("csv path is required")
@@ -77,20 +118,45 @@ func (s *Service) Ingest(ctx context.Context, opts IngestOptions) (IngestSummary
 
 	latitude := firstNonEmpty(strings.TrimSpace(opts.LatitudeColumn), dataset.LatColumn)
 	longitude := firstNonEmpty(strings.TrimSpace(opts.LongitudeColumn), dataset.LngColumn)
+	sparse := opts.Sparse || (hasDataset && dataset.Sparse)
+	duplicates := firstNonEmpty(strings.TrimSpace(opts.Duplicates), dataset.Duplicates, ingest.DuplicatesLast)
+	if err := ingest.ValidateDuplicates(duplicates); err != nil {
+		return IngestSummary{}, err
+	}
 
-	if err := s.ensureDatabase(ctx); err != nil {
+	var err error
+	if err = s.ensureDatabase(ctx); err != nil {
 		return IngestSummary{}, err
 	}
 
-	enc, err := s.ensureEncoder()
+	source := csvPath
+	if isURL(csvPath) {
+		if source, err = downloadCSV(ctx, csvPath); err != nil {
+			return IngestSummary{}, err
+		}
+		defer os.Remove(source)
+	}
+
+	enc, model, release, err := s.acquireModel()
 	if err != nil {
 		return IngestSummary{}, err
 	}
+	defer release()
+
+	target := table
+	version := strings.TrimSpace(opts.Version)
+	if version != "" {
+		if target, err = s.prepareVersion(ctx, table, version); err != nil {
+			return IngestSummary{}, err
+		}
+	}
 
 	ingestOpts := ingest.Options{
-		CSVPath:   csvPath,
-		BatchSize: batchSize,
-		Dataset:   table,
+		CSVPath:     source,
+		BatchSize:   batchSize,
+		Dataset:     target,
+		HashDataset: table,
+		Prune:       version != "",
 		Columns: ingest.ColumnConfig{
 			ID:       identifier,
 			Text:     textCols,
@@ -98,15 +164,39 @@ func (s *Service) Ingest(ctx context.Context, opts IngestOptions) (IngestSummary
 			Lat:      latitude,
 			Lng:      longitude,
 		},
+		Sparse:     sparse,
+		Replace:    opts.Replace,
+		Duplicates: duplicates,
+		Model:      model,
+		Stats:      &ingest.Stats{},
+		Transform:  s.ingestTransform(table),
+		Logger:     s.log,
+		OnCommit:   s.observeIngestBatch(table),
+		OnChange:   s.changeReporter(ctx, target),
 	}
 
+	start := time.Now()
+	defer s.invalidateResults(table)
 	if err := ingest.Run(ctx, s.db, enc, ingestOpts); err != nil {
 		return IngestSummary{}, err
 	}
+	if intsearch.UsesTrigram(dataset.Languages) {
+		if _, err := database.BuildTrigramIndex(ctx, s.db, target); err != nil {
+			return IngestSummary{}, err
+		}
+	}
+	if version != "" {
+		if err := store.AddVersion(ctx, s.db, table, version); err != nil {
+			return IngestSummary{}, err
+		}
+	}
+	elapsed := time.Since(start)
+	s.metrics.observeIngest(table, ingestOpts.Stats.Upserted, ingestOpts.Stats.Skipped, elapsed)
+	s.observeIngestRows(table, *ingestOpts.Stats)
 
 	summary := IngestSummary{
 		Dataset:         datasetName,
-		Table:           table,
+		Table:           target,
 		CSVPath:         csvPath,
 		BatchSize:       batchSize,
 		IDColumn:        identifier,
@@ -114,7 +204,54 @@ func (s *Service) Ingest(ctx context.Context, opts IngestOptions) (IngestSummary
 		MetadataColumns: cloneStrings(metaCols),
 		LatitudeColumn:  latitude,
 		LongitudeColumn: longitude,
+		Sparse:          sparse,
+		Replace:         opts.Replace,
+		Duplicates:      duplicates,
+		Version:         version,
+		Upserted:        ingestOpts.Stats.Upserted,
+		Skipped:         ingestOpts.Stats.Skipped,
+		Removed:         ingestOpts.Stats.Removed,
+		Dropped:         ingestOpts.Stats.Dropped,
+		DuplicateRows:   ingestOpts.Stats.Duplicates,
+		Duration:        elapsed,
 	}
 
 	return summary, nil
 }
+
+// isURL reports whether a CSV path is an http(s) URL to download.
+func isURL(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// downloadCSV saves the CSV at url to a temporary file, which the caller
+// removes.
+func downloadCSV(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download %s: %s", url, resp.Status)
+	}
+	file, err := os.CreateTemp("", "csv-search-download-*.csv")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", fmt.Errorf("download %s: %w", url, err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
@@ -0,0 +1,444 @@
+package csvsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIngestReplace(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write csv: %v", err)
+		}
+		return path
+	}
+	full := write("full.csv", "id,title,lat,lng\n1,hello,35.6,139.7\n2,world,35.7,139.8\n3,tokyo tower,35.65,139.74\n")
+	refresh := write("refresh.csv", "id,title,lat,lng\n1,hello,35.6,139.7\n4,skytree,35.71,139.81\n")
+	broken := write("broken.csv", "id,title,lat,lng\n5,ok,35.6,139.7\n,missing id,35.6,139.7\n")
+
+	svc, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "app.db")},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+
+	ingestOpts := IngestOptions{Dataset: "docs", CSVPath: full, TextColumns: []string{"title"}, LatitudeColumn: "lat", LongitudeColumn: "lng"}
+	if _, err := svc.Ingest(ctx, ingestOpts); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+
+	ingestOpts.CSVPath = refresh
+	ingestOpts.Replace = true
+	summary, err := svc.Ingest(ctx, ingestOpts)
+	if err != nil {
+		t.Fatalf("Ingest --replace: %v", err)
+	}
+	if summary.Removed != 3 || summary.Upserted != 2 || summary.Skipped != 0 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	datasets, err := svc.Datasets(ctx)
+	if err != nil {
+		t.Fatalf("Datasets: %v", err)
+	}
+	if len(datasets) != 1 || datasets[0].Rows != 2 || datasets[0].Vectors != 2 || datasets[0].FTS != 2 || datasets[0].Geo != 2 {
+		t.Fatalf("expected only the refreshed rows and their index entries, got %+v", datasets)
+	}
+	if _, err := svc.Get(ctx, "docs", "2"); err == nil {
+		t.Fatalf("expected record 2 to be removed by the refresh")
+	}
+
+	// A failed refresh rolls back the truncation as well.
+	ingestOpts.CSVPath = broken
+	if _, err := svc.Ingest(ctx, ingestOpts); err == nil {
+		t.Fatalf("expected the broken CSV to fail")
+	}
+	if datasets, err = svc.Datasets(ctx); err != nil || datasets[0].Rows != 2 {
+		t.Fatalf("expected the previous contents to survive a failed refresh, got %+v (%v)", datasets, err)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(cfgPath, []byte(`{"datasets": {"docs": {"batch_size": 2}}}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	svc, err := NewService(ServiceOptions{
+		Config:   ConfigReference{Path: cfgPath, Required: true},
+		Database: DatabaseOptions{Path: filepath.Join(dir, "app.db")},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+
+	w, err := svc.NewWriter(ctx, "docs")
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	docs := []Document{
+		{ID: "1", Text: []string{"hello"}, Metadata: map[string]string{"title": "hello"}},
+		{ID: "2", Text: []string{"world"}, Metadata: map[string]string{"title": "world"}},
+		{ID: "3", Text: []string{"tokyo tower"}, Metadata: map[string]string{"title": "tokyo tower"}},
+	}
+	for _, doc := range docs {
+		if err := w.Add(doc); err != nil {
+			t.Fatalf("Add %s: %v", doc.ID, err)
+		}
+	}
+	// The first batch of two is already committed.
+	if _, err := svc.Get(ctx, "docs", "2"); err != nil {
+		t.Fatalf("expected the full batch to be committed: %v", err)
+	}
+	if err := w.Add(Document{ID: " "}); err == nil {
+		t.Fatalf("expected an error for a document without an ID")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if summary := w.Summary(); summary.Table != "docs" || summary.Upserted != 3 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	if err := w.Add(docs[0]); err == nil {
+		t.Fatalf("expected Add to fail after Close")
+	}
+
+	rec, err := svc.Get(ctx, "docs", "3")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if rec.Fields["title"] != "tokyo tower" {
+		t.Fatalf("unexpected record: %+v", rec)
+	}
+	results, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "tokyo tower", TopK: 1})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "3" {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+
+	// Writing the same documents again skips them.
+	w, err = svc.NewWriter(ctx, "docs")
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	for _, doc := range docs {
+		if err := w.Add(doc); err != nil {
+			t.Fatalf("Add %s: %v", doc.ID, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if summary := w.Summary(); summary.Upserted != 0 || summary.Skipped != 3 {
+		t.Fatalf("expected unchanged documents to be skipped, got %+v", summary)
+	}
+}
+
+func TestScheduledIngest(t *testing.T) {
+	ctx := context.Background()
+	csv := "id,title\n1,hello\n2,world\n"
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, csv)
+	}))
+	defer source.Close()
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	config := fmt.Sprintf(`{
+  "database": {"path": "app.db"},
+  "datasets": {
+    "docs": {"csv": %q, "text_columns": ["title"], "schedule": "@every 1h"},
+    "faq": {}
+  }
+}`, source.URL+"/docs.csv")
+	if err := os.WriteFile(cfgPath, []byte(config), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	svc, err := NewService(ServiceOptions{
+		Config:  ConfigReference{Path: cfgPath, Required: true},
+		Encoder: EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+
+	statuses := svc.Schedules()
+	if len(statuses) != 1 || statuses[0].Dataset != "docs" || statuses[0].NextRun != nil || statuses[0].LastRun != nil {
+		t.Fatalf("expected docs to be scheduled but not yet planned, got %+v", statuses)
+	}
+
+	start := time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)
+	if due, wake := svc.scheduler.plan(svc.Config(), start, svc.log); len(due) != 0 || !wake.Equal(start.Add(scheduleRecheck)) {
+		t.Fatalf("expected nothing due at start, got %v (wake %v)", due, wake)
+	}
+	due, _ := svc.scheduler.plan(svc.Config(), start.Add(time.Hour), svc.log)
+	if len(due) != 1 || due[0] != "docs" {
+		t.Fatalf("expected docs to be due after an hour, got %v", due)
+	}
+	// The first run is still in progress when the next one comes due.
+	if due, _ := svc.scheduler.plan(svc.Config(), start.Add(2*time.Hour), svc.log); len(due) != 0 {
+		t.Fatalf("expected the overlapping run to be skipped, got %v", due)
+	}
+	statuses = svc.Schedules()
+	if !statuses[0].Running || statuses[0].Overlaps != 1 || statuses[0].NextRun == nil || !statuses[0].NextRun.Equal(start.Add(3*time.Hour)) {
+		t.Fatalf("unexpected status while running: %+v", statuses[0])
+	}
+
+	ingested := false
+	svc.runScheduled(ctx, "docs", func() { ingested = true })
+	statuses = svc.Schedules()
+	last := statuses[0].LastRun
+	if statuses[0].Running || last == nil || last.Status != "succeeded" || last.Upserted != 2 || !ingested {
+		t.Fatalf("unexpected status after the run: %+v (last %+v)", statuses[0], last)
+	}
+	if _, err := svc.Get(ctx, "docs", "2"); err != nil {
+		t.Fatalf("expected the downloaded CSV to be ingested: %v", err)
+	}
+}
+
+func TestChangeNotifications(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return path
+	}
+	full := write("full.csv", "id,title\n1,hello\n2,world\n3,tokyo tower\n")
+	refresh := write("refresh.csv", "id,title\n1,hello\n2,world!\n4,skytree\n")
+
+	delivered := make(chan Change, 16)
+	hookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got := r.Header.Get(signatureHeader); got != "sha256="+signPayload("s3cret", body) {
+			t.Errorf("signature = %q", got)
+		}
+		var change Change
+		if err := json.Unmarshal(body, &change); err != nil {
+			t.Errorf("decode webhook body: %v", err)
+		}
+		delivered <- change
+	}))
+	defer hookServer.Close()
+	cfgPath := write("config.json", fmt.Sprintf(`{"datasets": {"docs": {}}, "webhooks": [{"url": %q, "types": ["deleted"], "secret": "s3cret"}]}`, hookServer.URL))
+
+	svc, err := NewService(ServiceOptions{
+		Config:   ConfigReference{Path: cfgPath, Required: true},
+		Database: DatabaseOptions{Path: filepath.Join(dir, "app.db")},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+	var changes []Change
+	svc.AddChangeHook(func(_ context.Context, change Change) {
+		changes = append(changes, change)
+	})
+	expect := func(want ...string) {
+		t.Helper()
+		var got []string
+		for _, change := range changes {
+			got = append(got, fmt.Sprintf("%s %s %v", change.Dataset, change.Type, change.IDs))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("changes = %q, want %q", got, want)
+		}
+		changes = nil
+	}
+
+	opts := IngestOptions{Dataset: "docs", CSVPath: full, TextColumns: []string{"title"}}
+	if _, err := svc.Ingest(ctx, opts); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	expect("docs inserted [1 2 3]")
+
+	// Unchanged rows rewritten by a refresh are not reported.
+	opts.CSVPath, opts.Replace = refresh, true
+	if _, err := svc.Ingest(ctx, opts); err != nil {
+		t.Fatalf("Ingest --replace: %v", err)
+	}
+	expect("docs inserted [4]", "docs updated [2]", "docs deleted [3]")
+
+	w, err := svc.NewWriter(ctx, "docs")
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	for _, doc := range []Document{{ID: "4", Text: []string{"skytree"}, Metadata: map[string]string{"title": "skytree"}}, {ID: "5", Text: []string{"new"}}} {
+		if err := w.Add(doc); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	expect("docs inserted [5]", "docs updated [4]")
+
+	if _, err := svc.Delete(ctx, "docs", []string{"1", "missing"}); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	expect("docs deleted [1]")
+
+	// Replacing embeddings reports the records as updated.
+	if _, err := svc.Reembed(ctx, ReembedOptions{Dataset: "docs"}); err != nil {
+		t.Fatalf("Reembed: %v", err)
+	}
+	for _, change := range changes {
+		sort.Strings(change.IDs)
+	}
+	expect("docs updated [2 4 5]")
+	var vectors, ids bytes.Buffer
+	if _, err := svc.ExportVectors(ctx, &vectors, &ids, VectorExportOptions{Dataset: "docs"}); err != nil {
+		t.Fatalf("ExportVectors: %v", err)
+	}
+	if _, err := svc.ImportVectors(ctx, &vectors, &ids, VectorImportOptions{Dataset: "docs"}); err != nil {
+		t.Fatalf("ImportVectors: %v", err)
+	}
+	expect("docs updated [2 4 5]")
+
+	// The webhook only subscribed to deletions.
+	for _, want := range []string{"[3]", "[1]"} {
+		select {
+		case change := <-delivered:
+			if change.Dataset != "docs" || change.Type != ChangeDeleted || fmt.Sprint(change.IDs) != want {
+				t.Fatalf("webhook received %+v, want deleted %s", change, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("webhook did not receive the deletion of %s", want)
+		}
+	}
+}
+
+func TestIngestVersions(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write csv: %v", err)
+		}
+		return path
+	}
+	v1 := write("v1.csv", "id,title,lat,lng\n1,hello,35.6,139.7\n2,world,35.7,139.8\n3,tokyo tower,35.65,139.74\n")
+	v2 := write("v2.csv", "id,title,lat,lng\n1,hello,35.6,139.7\n2,world!,35.7,139.8\n4,skytree,35.71,139.81\n")
+
+	svc, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "app.db")},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+
+	searchIDs := func(version string) string {
+		t.Helper()
+		results, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "hello", TopK: 10, Version: version, TieBreak: "id"})
+		if err != nil {
+			t.Fatalf("Search version %q: %v", version, err)
+		}
+		ids := make([]string, len(results))
+		for i, r := range results {
+			ids[i] = r.ID
+		}
+		sort.Strings(ids)
+		return strings.Join(ids, ",")
+	}
+
+	opts := IngestOptions{Dataset: "docs", CSVPath: v1, TextColumns: []string{"title"}, LatitudeColumn: "lat", LongitudeColumn: "lng"}
+	if _, err := svc.Ingest(ctx, opts); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+
+	// A new version starts from the live contents: only the changed and new
+	// rows are embedded, and rows missing from its CSV are removed.
+	opts.CSVPath, opts.Version = v2, "v2"
+	summary, err := svc.Ingest(ctx, opts)
+	if err != nil {
+		t.Fatalf("Ingest version: %v", err)
+	}
+	if summary.Table != "docs@v2" || summary.Upserted != 2 || summary.Skipped != 1 || summary.Removed != 1 {
+		t.Fatalf("unexpected version summary: %+v", summary)
+	}
+	if got := searchIDs(""); got != "1,2,3" {
+		t.Fatalf("live search = %s, want the first load", got)
+	}
+	if got := searchIDs("v2"); got != "1,2,4" {
+		t.Fatalf("version search = %s, want the second load", got)
+	}
+	if _, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "hello", Version: "v3"}); !errors.Is(err, ErrVersionNotFound) {
+		t.Fatalf("search of an unknown version: %v", err)
+	}
+
+	promoted, err := svc.PromoteVersion(ctx, "docs", "v2")
+	if err != nil {
+		t.Fatalf("PromoteVersion: %v", err)
+	}
+	if !promoted.Live || promoted.Table != "docs" || promoted.Records != 3 {
+		t.Fatalf("unexpected promoted version: %+v", promoted)
+	}
+	if got := searchIDs(""); got != "1,2,4" {
+		t.Fatalf("live search after promotion = %s", got)
+	}
+	if got := searchIDs("previous"); got != "1,2,3" {
+		t.Fatalf("search of the replaced contents = %s", got)
+	}
+	datasets, err := svc.Datasets(ctx)
+	if err != nil {
+		t.Fatalf("Datasets: %v", err)
+	}
+	for _, ds := range datasets {
+		if ds.Vectors != ds.Rows || ds.FTS != ds.Rows || ds.Geo != ds.Rows {
+			t.Fatalf("index entries do not follow the swapped records: %+v", ds)
+		}
+	}
+
+	// Re-ingesting the live version through its name keeps the hashes.
+	summary, err = svc.Ingest(ctx, opts)
+	if err != nil || summary.Table != "docs" || summary.Upserted != 0 || summary.Skipped != 3 {
+		t.Fatalf("re-ingest of the live version: %+v (%v)", summary, err)
+	}
+
+	// Promoting the replaced contents rolls the change back.
+	if _, err := svc.PromoteVersion(ctx, "docs", "previous"); err != nil {
+		t.Fatalf("roll back: %v", err)
+	}
+	if got := searchIDs(""); got != "1,2,3" {
+		t.Fatalf("live search after the roll back = %s", got)
+	}
+	if err := svc.DeleteVersion(ctx, "docs", "previous"); err == nil {
+		t.Fatalf("expected the live version to be kept")
+	}
+	if err := svc.DeleteVersion(ctx, "docs", "v2"); err != nil {
+		t.Fatalf("DeleteVersion: %v", err)
+	}
+	versions, err := svc.Versions(ctx, "docs")
+	if err != nil || len(versions) != 1 || versions[0].Version != "previous" || !versions[0].Live {
+		t.Fatalf("Versions = %+v (%v)", versions, err)
+	}
+}
@@ -3,8 +3,11 @@ package csvsearch
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
+	"yashubustudio/csv-search/internal/config"
 	"yashubustudio/csv-search/internal/database"
 )
 
@@ -19,6 +22,9 @@ func (s *Service) InitDatabase(ctx context.Context, opts InitDatabaseOptions) er
 	if ctx == nil {
 		return fmt.Errorf("context must not be nil")
 	}
+	if s.closed.Load() {
+		return ErrClosed
+	}
 	if s.db == nil {
 		return fmt.Errorf("database handle is nil")
 	}
@@ -32,13 +38,40 @@ func (s *Service) InitDatabase(ctx context.Context, opts InitDatabaseOptions) er
 	defer cancel()
 
 	if err := database.Init(initCtx, s.db); err != nil {
-		return err
+		return withKind(ErrDatabase, err)
+	}
+	if err := database.CreateFieldIndexes(initCtx, s.db, indexFields(s.Config())); err != nil {
+		return withKind(ErrDatabase, err)
 	}
 	s.setDatabaseReady(true)
 	return nil
 }
 
+// indexFields returns the sorted union of the datasets' index_fields.
+func indexFields(cfg *config.Config) []string {
+	if cfg == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var fields []string
+	for _, ds := range cfg.Datasets {
+		for _, field := range ds.IndexFields {
+			if field = strings.TrimSpace(field); field != "" && !seen[field] {
+				seen[field] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
 func (s *Service) ensureDatabase(ctx context.Context) error {
+	if s.databaseReady() {
+		return nil
+	}
+	s.dbInitMu.Lock()
+	defer s.dbInitMu.Unlock()
 	if s.databaseReady() {
 		return nil
 	}
@@ -0,0 +1,122 @@
+package csvsearch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	intsearch "yashubustudio/csv-search/internal/search"
+)
+
+// KeywordSearchOptions describe a full-text search.
+type KeywordSearchOptions struct {
+	// Query is split on whitespace; a record matches when its text contains
+	// every term as a token (the full-text index splits on spaces and
+	// punctuation, so a run of Japanese text without spaces is one token).
+	// Terms are matched literally.
+	Query   string
+	Dataset string
+	Table   string
+	TopK    int
+	Filters []Filter
+	// IDs behaves like SearchOptions.IDs.
+	IDs []string
+	// Source labels the search in the query log ("library" when empty).
+	Source string
+	// TieBreak, GroupBy, GroupSize, ScoreNormalization and IncludeVectors
+	// behave like those of SearchOptions.
+	TieBreak           string
+	GroupBy            string
+	GroupSize          int
+	ScoreNormalization string
+	IncludeVectors     bool
+}
+
+// KeywordSearch finds the records whose text contains every term of the
+// query using the full-text index built at ingest, ranked by BM25 (the Score
+// of the results; higher is better). No encoder is needed. The search hooks,
+// the query log and the Metrics of the Service apply as for Search.
+func (s *Service) KeywordSearch(ctx context.Context, opts KeywordSearchOptions) ([]Result, error) {
+	if err := s.ready(ctx); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(opts.Query) == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	if err := intsearch.ValidateGroup(opts.GroupBy, opts.GroupSize); err != nil {
+		return nil, err
+	}
+	if err := intsearch.ValidateScoreNormalization(opts.ScoreNormalization); err != nil {
+		return nil, err
+	}
+
+	plan := planSearch(s.Config(), opts.Dataset, opts.Table, opts.TopK, 0)
+	plan.normalization = firstNonEmpty(strings.TrimSpace(opts.ScoreNormalization), plan.normalization)
+	hooked := SearchOptions{Query: strings.TrimSpace(opts.Query), Filters: opts.Filters, IDs: opts.IDs, TieBreak: opts.TieBreak, GroupBy: opts.GroupBy, GroupSize: opts.GroupSize, Source: opts.Source}
+	start := time.Now()
+	key := resultCacheKey("keyword", SearchOptions{Query: hooked.Query, Filters: opts.Filters, IDs: opts.IDs, TieBreak: opts.TieBreak, GroupBy: opts.GroupBy, GroupSize: opts.GroupSize, IncludeVectors: opts.IncludeVectors}, plan)
+	if results, ok := s.cachedResults(key); ok {
+		s.logSearch(hooked, plan.table, plan.limit, time.Since(start), results, nil)
+		return results, nil
+	}
+	results, err := s.keywordSearch(ctx, &hooked, &plan, opts.IncludeVectors)
+	total := time.Since(start)
+	s.observeSearch("keyword", opts.Source, plan.table, nil, total, err)
+	s.logSearch(hooked, plan.table, plan.limit, total, results, err)
+	if err == nil {
+		s.cacheResults(key, results)
+	}
+	return results, err
+}
+
+func (s *Service) keywordSearch(ctx context.Context, opts *SearchOptions, plan *searchPlan, includeVectors bool) ([]Result, error) {
+	if err := s.preSearch(ctx, opts, plan); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(opts.Query) == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	if err := s.checkFilters(ctx, *plan, opts.Filters); err != nil {
+		return nil, err
+	}
+	results, err := s.engine.KeywordSearch(ctx, intsearch.KeywordOptions{
+		Dataset:            plan.table,
+		Query:              opts.Query,
+		TopK:               plan.limit,
+		Filters:            toSearchFilters(opts.Filters),
+		IDs:                opts.IDs,
+		Stopwords:          plan.dicts.Stopwords,
+		Languages:          plan.languages,
+		ScorePrecision:     plan.precision,
+		ScoreNormalization: plan.normalization,
+		TieBreak:           opts.TieBreak,
+		GroupBy:            opts.GroupBy,
+		GroupSize:          opts.GroupSize,
+		IncludeVectors:     includeVectors,
+		Logger:             s.log,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.postSearch(ctx, *opts, *plan, convertResults(results))
+}
+
+// SuggestOptions describe a query to check for typos.
+type SuggestOptions struct {
+	Query   string
+	Dataset string
+	Table   string
+}
+
+// Suggest returns a "did you mean" correction of the query: every term of at
+// least four ASCII letters that does not occur in the full-text index of the
+// dataset is replaced by the most frequent indexed term a typo or two away.
+// It returns "" when there is nothing to correct.
+func (s *Service) Suggest(ctx context.Context, opts SuggestOptions) (string, error) {
+	if err := s.ready(ctx); err != nil {
+		return "", err
+	}
+	plan := planSearch(s.Config(), opts.Dataset, opts.Table, 0, 0)
+	return s.engine.Suggest(ctx, plan.table, opts.Query)
+}
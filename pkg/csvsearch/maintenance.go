@@ -0,0 +1,470 @@
+package csvsearch
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"yashubustudio/csv-search/internal/database"
+	"yashubustudio/csv-search/internal/ingest"
+	intsearch "yashubustudio/csv-search/internal/search"
+)
+
+// ReembedOptions configure Reembed.
+type ReembedOptions struct {
+	// Dataset limits the run to one dataset (resolved like IngestOptions);
+	// empty re-embeds every dataset in the database.
+	Dataset   string
+	BatchSize int
+	// Sparse computes lexical weights for every record instead of only
+	// refreshing the records that already have them.
+	Sparse bool
+	// StaleOnly skips records whose embedding was produced by the active
+	// model (see EncoderConfig.ModelVersion).
+	StaleOnly bool
+	// Workers encode texts in parallel (1 when zero).
+	Workers int
+	// Progress, when set, is called after every batch with the number of
+	// records re-embedded so far and the total.
+	Progress func(done, total int)
+}
+
+// ReembedSummary reports the outcome of Reembed.
+type ReembedSummary struct {
+	Table    string
+	Records  int
+	Duration time.Duration
+}
+
+// CompactSummary reports the database size around Compact. When the
+// database path is known the sizes are those of the files on disk (database
+// plus WAL); otherwise they are page_count * page_size.
+type CompactSummary struct {
+	BytesBefore int64
+	BytesAfter  int64
+}
+
+// BackupOptions configure Backup.
+type BackupOptions struct {
+	// Path is the snapshot file. Empty writes a timestamped file in a
+	// "backups" directory next to the database.
+	Path string
+	// Gzip compresses the snapshot; ".gz" is appended to Path when missing.
+	// Paths that already end in ".gz" are always compressed.
+	Gzip bool
+}
+
+// BackupSummary describes a backup written by Backup.
+type BackupSummary struct {
+	Path       string
+	Bytes      int64
+	Compressed bool
+}
+
+// ReindexOptions select the work of Reindex. Leaving every field false
+// selects all of them.
+type ReindexOptions struct {
+	// FTS drops full-text entries whose record is gone and re-creates missing
+	// ones from the stored fields. Only datasets with text_columns in the
+	// configuration can be re-created, as the text of the others is not
+	// stored elsewhere.
+	FTS bool
+	// RTree rebuilds the spatial index from the records' coordinates.
+	RTree bool
+	// Pages rebuilds the paged copy of the embeddings that unfiltered
+	// searches scan. Ingest keeps it current; databases written by older
+	// versions or streamed through a Writer that failed need a rebuild.
+	Pages bool
+	// Vectors checks the stored embeddings without changing them; Reembed
+	// repairs the problems it reports.
+	Vectors bool
+}
+
+// VectorCheck reports the consistency of the embeddings of one dataset:
+// records with text but no embedding, embeddings that cannot be decoded and
+// embeddings whose dimension differs from the most common one.
+type VectorCheck struct {
+	Dataset    string `json:"dataset"`
+	Vectors    int64  `json:"vectors"`
+	Missing    int64  `json:"missing"`
+	Invalid    int64  `json:"invalid"`
+	Dimension  int    `json:"dimension"`
+	Mismatched int64  `json:"mismatched"`
+}
+
+// OK reports whether the check found no problem.
+func (c VectorCheck) OK() bool {
+	return c.Missing == 0 && c.Invalid == 0 && c.Mismatched == 0
+}
+
+// ReindexSummary reports the outcome of Reindex. Vectors is set when the
+// embeddings were checked.
+type ReindexSummary struct {
+	RTreeRows  int64 `json:"rtree_rows"`
+	FTSRemoved int64 `json:"fts_removed"`
+	FTSAdded   int64 `json:"fts_added"`
+	// VectorPages counts the vector pages written when Pages was selected.
+	VectorPages int64 `json:"vector_pages"`
+	// TrigramRows counts the records written to the trigram indexes of the
+	// datasets whose languages use the trigram tokenizer, rebuilt with FTS.
+	TrigramRows int64         `json:"trigram_rows"`
+	Vectors     []VectorCheck `json:"vectors,omitempty"`
+}
+
+// Reindex rebuilds the derived tables from the records table, to recover
+// from interrupted writes or schema changes: the R-tree and the full-text
+// index (see ReindexOptions), followed by the B-tree indexes. It can also
+// verify the stored embeddings.
+func (s *Service) Reindex(ctx context.Context, opts ReindexOptions) (ReindexSummary, error) {
+	if err := s.ready(ctx); err != nil {
+		return ReindexSummary{}, err
+	}
+	if !opts.FTS && !opts.RTree && !opts.Pages && !opts.Vectors {
+		opts = ReindexOptions{FTS: true, RTree: true, Pages: true, Vectors: true}
+	}
+
+	var summary ReindexSummary
+	if opts.FTS || opts.RTree || opts.Pages {
+		defer s.invalidateResults()
+		textColumns := map[string][]string{}
+		var trigram []string
+		if cfg := s.Config(); cfg != nil {
+			for name, dataset := range cfg.Datasets {
+				if len(dataset.TextColumns) > 0 {
+					textColumns[resolveTable(name, dataset, "")] = dataset.TextColumns
+				}
+				if intsearch.UsesTrigram(dataset.Languages) {
+					trigram = append(trigram, resolveTable(name, dataset, ""))
+				}
+			}
+		}
+		stats, err := database.Reindex(ctx, s.db, database.ReindexOptions{
+			FTS: opts.FTS, RTree: opts.RTree, Pages: opts.Pages, Trigram: trigram, TextColumns: textColumns,
+		})
+		if err != nil {
+			return summary, err
+		}
+		summary.RTreeRows, summary.FTSRemoved, summary.FTSAdded = stats.RTreeRows, stats.FTSRemoved, stats.FTSAdded
+		summary.VectorPages, summary.TrigramRows = stats.VectorPages, stats.TrigramRows
+	}
+	if opts.Vectors {
+		checks, err := database.CheckVectors(ctx, s.db)
+		if err != nil {
+			return summary, err
+		}
+		summary.Vectors = make([]VectorCheck, len(checks))
+		for i, c := range checks {
+			summary.Vectors[i] = VectorCheck(c)
+		}
+	}
+	return summary, nil
+}
+
+// FsckOptions configure Fsck.
+type FsckOptions struct {
+	// Repair fixes what Fsck finds: orphaned rows are deleted, full-text rows
+	// are moved to their record and the R-tree is brought in line with the
+	// records' coordinates. Records without an embedding are re-embedded when
+	// an encoder is configured.
+	Repair bool
+}
+
+// FsckSummary reports the inconsistencies found by Fsck between the records
+// and the tables derived from them. Reembedded counts the records given the
+// embedding they were missing; when Repair was set every other count was
+// fixed.
+type FsckSummary struct {
+	MissingVectors int64 `json:"missing_vectors"`
+	OrphanVectors  int64 `json:"orphan_vectors"`
+	OrphanSparse   int64 `json:"orphan_sparse"`
+	StaleFTS       int64 `json:"stale_fts"`
+	StaleRTree     int64 `json:"stale_rtree"`
+	MissingRTree   int64 `json:"missing_rtree"`
+	Repaired       bool  `json:"repaired"`
+	Reembedded     int   `json:"reembedded"`
+}
+
+// Problems returns the number of inconsistencies found.
+func (f FsckSummary) Problems() int64 {
+	return f.MissingVectors + f.OrphanVectors + f.OrphanSparse + f.StaleFTS + f.StaleRTree + f.MissingRTree
+}
+
+// Remaining returns the number of inconsistencies left after a repair, or
+// all of them when Repair was not set.
+func (f FsckSummary) Remaining() int64 {
+	if !f.Repaired {
+		return f.Problems()
+	}
+	return f.MissingVectors - int64(f.Reembedded)
+}
+
+// Fsck checks that the embeddings, lexical weights, full-text index and
+// R-tree agree with the records, as partial ingest failures can leave them
+// out of step, and repairs them when asked to.
+func (s *Service) Fsck(ctx context.Context, opts FsckOptions) (FsckSummary, error) {
+	if err := s.ready(ctx); err != nil {
+		return FsckSummary{}, err
+	}
+	if opts.Repair {
+		defer s.invalidateResults()
+	}
+	found, err := database.Fsck(ctx, s.db, opts.Repair)
+	if err != nil {
+		return FsckSummary{}, err
+	}
+	summary := FsckSummary{
+		MissingVectors: found.MissingVectors,
+		OrphanVectors:  found.OrphanVectors,
+		OrphanSparse:   found.OrphanSparse,
+		StaleFTS:       found.StaleFTS,
+		StaleRTree:     found.StaleRTree,
+		MissingRTree:   found.MissingRTree,
+		Repaired:       opts.Repair,
+	}
+	if !opts.Repair || found.MissingVectors == 0 || !s.encoderConfigured() {
+		return summary, nil
+	}
+	enc, model, release, err := s.acquireModel()
+	if err != nil {
+		return summary, err
+	}
+	defer release()
+	summary.Reembedded, err = ingest.Reembed(ctx, s.db, enc, ingest.ReembedOptions{
+		Model:       model,
+		MissingOnly: true,
+		OnChange:    s.embeddingReporter(ctx),
+	})
+	return summary, err
+}
+
+// Reembed recomputes the stored embeddings with the active encoder, which is
+// required after switching to a model with a different vector space.
+func (s *Service) Reembed(ctx context.Context, opts ReembedOptions) (ReembedSummary, error) {
+	if err := s.ready(ctx); err != nil {
+		return ReembedSummary{}, err
+	}
+
+	table := ""
+	if name := strings.TrimSpace(opts.Dataset); name != "" {
+		datasetName, datasetCfg, _ := resolveDataset(s.Config(), name)
+		table = resolveTable(datasetName, datasetCfg, "")
+	}
+
+	enc, model, release, err := s.acquireModel()
+	if err != nil {
+		return ReembedSummary{}, err
+	}
+	defer release()
+	if opts.StaleOnly && model == "" {
+		return ReembedSummary{}, fmt.Errorf("stale-only re-embedding requires a model version (set EncoderConfig.ModelVersion)")
+	}
+
+	start := time.Now()
+	defer s.invalidateResults()
+	n, err := ingest.Reembed(ctx, s.db, enc, ingest.ReembedOptions{
+		Dataset:   table,
+		BatchSize: opts.BatchSize,
+		Sparse:    opts.Sparse,
+		Model:     model,
+		StaleOnly: opts.StaleOnly,
+		Workers:   opts.Workers,
+		Progress:  opts.Progress,
+		OnChange:  s.embeddingReporter(ctx),
+	})
+	if err != nil {
+		return ReembedSummary{}, err
+	}
+	return ReembedSummary{Table: table, Records: n, Duration: time.Since(start)}, nil
+}
+
+// Compact vacuums the database, optimizes the full-text index, checks the
+// R-tree and truncates the WAL.
+func (s *Service) Compact(ctx context.Context) (CompactSummary, error) {
+	if err := s.ready(ctx); err != nil {
+		return CompactSummary{}, err
+	}
+	var fileBefore int64
+	if s.dbPath != "" {
+		size, err := database.FileSize(s.dbPath)
+		if err != nil {
+			return CompactSummary{}, err
+		}
+		fileBefore = size
+	}
+	before, after, err := database.Compact(ctx, s.db)
+	if err != nil {
+		return CompactSummary{}, err
+	}
+	if s.dbPath != "" {
+		fileAfter, err := database.FileSize(s.dbPath)
+		if err != nil {
+			return CompactSummary{}, err
+		}
+		before, after = fileBefore, fileAfter
+	}
+	return CompactSummary{BytesBefore: before, BytesAfter: after}, nil
+}
+
+// Backup writes a consistent snapshot of the database using the SQLite
+// online backup API, optionally gzip-compressed.
+func (s *Service) Backup(ctx context.Context, opts BackupOptions) (BackupSummary, error) {
+	if err := s.ready(ctx); err != nil {
+		return BackupSummary{}, err
+	}
+	path := strings.TrimSpace(opts.Path)
+	if path == "" {
+		if s.dbPath == "" {
+			return BackupSummary{}, fmt.Errorf("a backup path is required when the database path is unknown")
+		}
+		base := strings.TrimSuffix(filepath.Base(s.dbPath), filepath.Ext(s.dbPath))
+		name := fmt.Sprintf("%s-%s.db", base, time.Now().UTC().Format("20060102T150405Z"))
+		path = filepath.Join(filepath.Dir(s.dbPath), "backups", name)
+	}
+	compress := opts.Gzip || strings.HasSuffix(path, ".gz")
+	if !compress {
+		size, err := database.Backup(ctx, s.db, path)
+		if err != nil {
+			return BackupSummary{}, err
+		}
+		return BackupSummary{Path: path, Bytes: size}, nil
+	}
+
+	if !strings.HasSuffix(path, ".gz") {
+		path += ".gz"
+	}
+	if _, err := os.Stat(path); err == nil {
+		return BackupSummary{}, fmt.Errorf("backup target %s already exists", path)
+	}
+	raw := strings.TrimSuffix(path, ".gz") + ".tmp"
+	os.Remove(raw)
+	defer os.Remove(raw)
+	if _, err := database.Backup(ctx, s.db, raw); err != nil {
+		return BackupSummary{}, err
+	}
+	size, err := gzipFile(raw, path)
+	if err != nil {
+		os.Remove(path)
+		return BackupSummary{}, err
+	}
+	return BackupSummary{Path: path, Bytes: size, Compressed: true}, nil
+}
+
+// Restore replaces the database contents with the snapshot at path, which
+// may be gzip-compressed, and migrates it to the current schema. Other
+// processes using the database should be stopped first.
+func (s *Service) Restore(ctx context.Context, path string) error {
+	if err := s.ready(ctx); err != nil {
+		return err
+	}
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return fmt.Errorf("restore path must not be empty")
+	}
+	compressed, err := isGzip(path)
+	if err != nil {
+		return err
+	}
+	if compressed {
+		tmp, err := os.CreateTemp("", "csv-search-restore-*.db")
+		if err != nil {
+			return err
+		}
+		tmp.Close()
+		defer os.Remove(tmp.Name())
+		if err := gunzipFile(path, tmp.Name()); err != nil {
+			return err
+		}
+		path = tmp.Name()
+	}
+	defer s.invalidateResults()
+	if err := database.Restore(ctx, s.db, path); err != nil {
+		return err
+	}
+	if err := database.Init(ctx, s.db); err != nil {
+		return fmt.Errorf("migrate restored database: %w", err)
+	}
+	s.setDatabaseReady(true)
+	s.notifyChange(ctx, "", ChangeReset, nil)
+	return nil
+}
+
+// gzipFile compresses src into dst and returns the size of dst.
+func gzipFile(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+	zw := gzip.NewWriter(out)
+	zw.Name = filepath.Base(strings.TrimSuffix(dst, ".gz"))
+	if _, err := io.Copy(zw, in); err != nil {
+		return 0, fmt.Errorf("compress backup: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return 0, fmt.Errorf("compress backup: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func gunzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return fmt.Errorf("decompress backup: %w", err)
+	}
+	defer zr.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, zr); err != nil {
+		return fmt.Errorf("decompress backup: %w", err)
+	}
+	return out.Close()
+}
+
+// isGzip reports whether the file at path starts with the gzip magic bytes.
+func isGzip(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("restore source: %w", err)
+	}
+	defer f.Close()
+	var magic [2]byte
+	if _, err := io.ReadFull(f, magic[:]); err != nil {
+		return false, nil
+	}
+	return magic[0] == 0x1f && magic[1] == 0x8b, nil
+}
+
+func (s *Service) ready(ctx context.Context) error {
+	if ctx == nil {
+		return fmt.Errorf("context must not be nil")
+	}
+	if s.db == nil {
+		return fmt.Errorf("database handle is nil")
+	}
+	return s.ensureDatabase(ctx)
+}
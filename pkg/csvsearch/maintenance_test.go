@@ -0,0 +1,437 @@
+package csvsearch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"yashubustudio/csv-search/internal/database"
+)
+
+func TestMaintenanceOperations(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "docs.csv")
+	if err := os.WriteFile(csvPath, []byte("id,title,lat,lng\n1,hello,35.6,139.7\n2,world,,\n"), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+
+	svc, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "app.db")},
+		Encoder: EncoderOptions{
+			Embedder: fakeEmbedder{dim: 2},
+			Config:   EncoderConfig{ModelVersion: "fake-v1"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+
+	summary, err := svc.Ingest(ctx, IngestOptions{
+		Dataset:         "docs",
+		CSVPath:         csvPath,
+		TextColumns:     []string{"title"},
+		LatitudeColumn:  "lat",
+		LongitudeColumn: "lng",
+	})
+	if err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	if summary.Upserted != 2 {
+		t.Fatalf("expected 2 upserted rows, got %d", summary.Upserted)
+	}
+
+	datasets, err := svc.Datasets(ctx)
+	if err != nil {
+		t.Fatalf("Datasets: %v", err)
+	}
+	if len(datasets) != 1 || datasets[0].Table != "docs" || datasets[0].Rows != 2 || !datasets[0].HasGeo || !datasets[0].HasFTS || datasets[0].Dimension != 2 {
+		t.Fatalf("unexpected datasets: %+v", datasets)
+	}
+
+	stats, err := svc.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if stats.SchemaVersion != database.SchemaVersion || stats.SizeBytes == 0 || len(stats.Datasets) != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	// Corrupt the stored vectors so that re-embedding has to restore them.
+	if _, err := svc.DB().ExecContext(ctx, `UPDATE records_vec SET embedding = x'00000000'`); err != nil {
+		t.Fatalf("update vectors: %v", err)
+	}
+	reembed, err := svc.Reembed(ctx, ReembedOptions{Dataset: "docs"})
+	if err != nil {
+		t.Fatalf("Reembed: %v", err)
+	}
+	if reembed.Records != 2 {
+		t.Fatalf("expected 2 re-embedded records, got %d", reembed.Records)
+	}
+	var size int
+	if err := svc.DB().QueryRowContext(ctx, `SELECT length(embedding) FROM records_vec WHERE id = '1'`).Scan(&size); err != nil {
+		t.Fatalf("read vector: %v", err)
+	}
+	if size != 8 {
+		t.Fatalf("expected a 2-dimensional vector after re-embedding, got %d bytes", size)
+	}
+	if _, err := svc.DB().ExecContext(ctx, `UPDATE records_vec SET model = 'fake-v0' WHERE id = '1'`); err != nil {
+		t.Fatalf("update model: %v", err)
+	}
+	stale, err := svc.Reembed(ctx, ReembedOptions{Dataset: "docs", StaleOnly: true})
+	if err != nil {
+		t.Fatalf("Reembed stale-only: %v", err)
+	}
+	if stale.Records != 1 {
+		t.Fatalf("expected 1 stale record, got %d", stale.Records)
+	}
+
+	reindex, err := svc.Reindex(ctx, ReindexOptions{RTree: true})
+	if err != nil {
+		t.Fatalf("Reindex: %v", err)
+	}
+	if reindex.RTreeRows != 1 {
+		t.Fatalf("expected 1 R-tree entry, got %d", reindex.RTreeRows)
+	}
+
+	// Prepare the cached search statement before the database is vacuumed
+	// and restored underneath it.
+	if results, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "hello"}); err != nil || len(results) != 2 {
+		t.Fatalf("Search: %v (%d results)", err, len(results))
+	}
+
+	if _, err := svc.Compact(ctx); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+
+	backup, err := svc.Backup(ctx, BackupOptions{})
+	if err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	if filepath.Dir(backup.Path) != filepath.Join(dir, "backups") || backup.Bytes == 0 {
+		t.Fatalf("unexpected backup: %+v", backup)
+	}
+	if _, err := svc.Backup(ctx, BackupOptions{Path: backup.Path}); err == nil {
+		t.Fatalf("expected an error when the backup target exists")
+	}
+
+	compressed, err := svc.Backup(ctx, BackupOptions{Path: filepath.Join(dir, "snap.db"), Gzip: true})
+	if err != nil {
+		t.Fatalf("Backup gzip: %v", err)
+	}
+	if compressed.Path != filepath.Join(dir, "snap.db.gz") || !compressed.Compressed {
+		t.Fatalf("unexpected compressed backup: %+v", compressed)
+	}
+	if _, err := svc.Delete(ctx, "docs", []string{"1", "2"}); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := svc.Restore(ctx, compressed.Path); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if _, err := svc.Get(ctx, "docs", "2"); err != nil {
+		t.Fatalf("expected record 2 after restore: %v", err)
+	}
+	if results, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "hello"}); err != nil || len(results) != 2 {
+		t.Fatalf("Search after restore: %v (%d results)", err, len(results))
+	}
+}
+
+func TestReindexRepairsDerivedTables(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(cfgPath, []byte(`{"datasets": {"docs": {"text_columns": ["title"]}}}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	csvPath := filepath.Join(dir, "docs.csv")
+	if err := os.WriteFile(csvPath, []byte("id,title\n1,tokyo tower\n2,osaka castle\n3,kyoto temple\n"), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	svc, err := NewService(ServiceOptions{
+		Config:   ConfigReference{Path: cfgPath, Required: true},
+		Database: DatabaseOptions{Path: filepath.Join(dir, "app.db")},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+	if _, err := svc.Ingest(ctx, IngestOptions{Dataset: "docs", CSVPath: csvPath}); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+
+	// Simulate a partial failure: a lost full-text entry, a stale one, a
+	// missing and a corrupt embedding.
+	for _, stmt := range []string{
+		`DELETE FROM records_fts WHERE id = '1'`,
+		`INSERT INTO records_fts(rowid, dataset, id, content) VALUES(999, 'docs', 'gone', 'ghost')`,
+		`DELETE FROM records_vec WHERE id = '2'`,
+		`UPDATE records_vec SET embedding = x'0000' WHERE id = '3'`,
+	} {
+		if _, err := svc.DB().ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	summary, err := svc.Reindex(ctx, ReindexOptions{})
+	if err != nil {
+		t.Fatalf("Reindex: %v", err)
+	}
+	if summary.FTSAdded != 1 || summary.FTSRemoved != 1 {
+		t.Fatalf("unexpected FTS repair: %+v", summary)
+	}
+	want := []VectorCheck{{Dataset: "docs", Vectors: 2, Missing: 1, Invalid: 1, Dimension: 2}}
+	if !reflect.DeepEqual(summary.Vectors, want) {
+		t.Fatalf("unexpected vector check: %+v", summary.Vectors)
+	}
+	results, err := svc.KeywordSearch(ctx, KeywordSearchOptions{Dataset: "docs", Query: "tower"})
+	if err != nil {
+		t.Fatalf("KeywordSearch: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "1" {
+		t.Fatalf("expected the rebuilt entry to be searchable, got %+v", results)
+	}
+	if results, _ := svc.KeywordSearch(ctx, KeywordSearchOptions{Dataset: "docs", Query: "ghost"}); len(results) != 0 {
+		t.Fatalf("expected the stale entry to be removed, got %+v", results)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "teas.csv")
+	// The fake embedder encodes the length of the text, so titles of the same
+	// length are identical.
+	csv := "id,title,origin\n1,green tea,\n2,black tea,India\n3,white tea,China\n4,hi,\n"
+	if err := os.WriteFile(csvPath, []byte(csv), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	svc, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "app.db")},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+	for _, dataset := range []string{"tagged", "merged"} {
+		if _, err := svc.Ingest(ctx, IngestOptions{Dataset: dataset, CSVPath: csvPath, TextColumns: []string{"title"}}); err != nil {
+			t.Fatalf("Ingest %s: %v", dataset, err)
+		}
+	}
+
+	report, err := svc.Dedupe(ctx, DedupeOptions{Dataset: "tagged", Threshold: 1})
+	if err != nil {
+		t.Fatalf("Dedupe: %v", err)
+	}
+	if report.Records != 4 || len(report.Pairs) != 3 {
+		t.Fatalf("expected 3 pairs among 4 records, got %+v", report)
+	}
+	wantGroups := []DuplicateGroup{{Keep: "1", Duplicates: []string{"2", "3"}}}
+	if !reflect.DeepEqual(report.Groups, wantGroups) {
+		t.Fatalf("unexpected groups: %+v", report.Groups)
+	}
+
+	if _, err := svc.Dedupe(ctx, DedupeOptions{Dataset: "tagged", Tag: "duplicate_of", Merge: true}); err == nil {
+		t.Fatalf("expected tag and merge together to be rejected")
+	}
+
+	report, err = svc.Dedupe(ctx, DedupeOptions{Dataset: "tagged", Threshold: 1, Tag: "duplicate_of"})
+	if err != nil {
+		t.Fatalf("Dedupe with tag: %v", err)
+	}
+	if report.Tagged != 2 {
+		t.Fatalf("expected 2 tagged records, got %d", report.Tagged)
+	}
+	for id, want := range map[string]string{"1": "", "2": "1", "3": "1", "4": ""} {
+		record, err := svc.Get(ctx, "tagged", id)
+		if err != nil {
+			t.Fatalf("Get %s: %v", id, err)
+		}
+		if got := record.Fields["duplicate_of"]; got != want {
+			t.Fatalf("record %s: expected duplicate_of %q, got %q", id, want, got)
+		}
+	}
+
+	report, err = svc.Dedupe(ctx, DedupeOptions{Dataset: "merged", Threshold: 1, Merge: true})
+	if err != nil {
+		t.Fatalf("Dedupe with merge: %v", err)
+	}
+	if report.Merged != 2 {
+		t.Fatalf("expected 2 merged records, got %d", report.Merged)
+	}
+	kept, err := svc.Get(ctx, "merged", "1")
+	if err != nil {
+		t.Fatalf("Get kept record: %v", err)
+	}
+	if kept.Fields["origin"] != "India" || kept.Fields["title"] != "green tea" {
+		t.Fatalf("expected the empty origin to be filled from the first duplicate, got %+v", kept.Fields)
+	}
+	if _, err := svc.Get(ctx, "merged", "2"); err == nil {
+		t.Fatalf("expected the duplicate to be deleted")
+	}
+	var stale int
+	if err := svc.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM records_vec_pages_stale`).Scan(&stale); err != nil || stale != 0 {
+		t.Fatalf("expected Dedupe to rewrite the pages it made stale, got %d (%v)", stale, err)
+	}
+}
+
+func TestSyncReplica(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writer, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "writer.db")},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService writer: %v", err)
+	}
+	defer writer.Close()
+	replica, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "replica.db")},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService replica: %v", err)
+	}
+	defer replica.Close()
+
+	snapshot := filepath.Join(dir, "published.db.gz")
+	publish := func(rows string) {
+		t.Helper()
+		csvPath := filepath.Join(dir, "docs.csv")
+		if err := os.WriteFile(csvPath, []byte("id,title\n"+rows), 0o600); err != nil {
+			t.Fatalf("write csv: %v", err)
+		}
+		if _, err := writer.Ingest(ctx, IngestOptions{Dataset: "docs", CSVPath: csvPath, TextColumns: []string{"title"}}); err != nil {
+			t.Fatalf("Ingest: %v", err)
+		}
+		// Publish atomically, as a replica may read the snapshot at any time.
+		tmp := filepath.Join(dir, "next.db.gz")
+		if _, err := writer.Backup(ctx, BackupOptions{Path: tmp}); err != nil {
+			t.Fatalf("Backup: %v", err)
+		}
+		if err := os.Rename(tmp, snapshot); err != nil {
+			t.Fatalf("rename: %v", err)
+		}
+	}
+	count := func() int {
+		t.Helper()
+		var n int
+		if err := replica.DB().QueryRowContext(ctx, `SELECT COUNT(*) FROM records`).Scan(&n); err != nil {
+			t.Fatalf("count: %v", err)
+		}
+		return n
+	}
+
+	publish("1,hello\n")
+	if changed, err := replica.SyncReplica(ctx, snapshot); err != nil || !changed {
+		t.Fatalf("first sync: changed=%v err=%v", changed, err)
+	}
+	if n := count(); n != 1 {
+		t.Fatalf("expected 1 record after the first sync, got %d", n)
+	}
+	if changed, err := replica.SyncReplica(ctx, snapshot); err != nil || changed {
+		t.Fatalf("unchanged snapshot: changed=%v err=%v", changed, err)
+	}
+	publish("1,hello\n2,world\n")
+	if changed, err := replica.SyncReplica(ctx, snapshot); err != nil || !changed {
+		t.Fatalf("second sync: changed=%v err=%v", changed, err)
+	}
+	if results, err := replica.Search(ctx, SearchOptions{Dataset: "docs", Query: "hello"}); err != nil || len(results) != 2 {
+		t.Fatalf("Search on the replica: %v (%d results)", err, len(results))
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, snapshot)
+	}))
+	defer srv.Close()
+	if changed, err := replica.SyncReplica(ctx, srv.URL); err != nil || !changed {
+		t.Fatalf("sync from URL: changed=%v err=%v", changed, err)
+	}
+	if changed, err := replica.SyncReplica(ctx, srv.URL); err != nil || changed {
+		t.Fatalf("unchanged URL: changed=%v err=%v", changed, err)
+	}
+
+	if err := os.WriteFile(snapshot, []byte("not a database"), 0o600); err != nil {
+		t.Fatalf("write snapshot: %v", err)
+	}
+	if _, err := replica.SyncReplica(ctx, snapshot); err == nil {
+		t.Fatalf("expected a corrupt snapshot to be rejected")
+	}
+	status := replica.ReplicaStatus()
+	if status == nil || status.Error == "" || status.Syncs != 0 || status.Source != snapshot {
+		t.Fatalf("unexpected status after a failed sync: %+v", status)
+	}
+	if n := count(); n != 2 {
+		t.Fatalf("a failed sync must keep the previous snapshot, got %d records", n)
+	}
+}
+
+// TestSyncReplicaRetriesFailedSnapshot checks that a snapshot that fails to
+// apply is downloaded again instead of being skipped as not modified.
+func TestSyncReplicaRetriesFailedSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writer := newTestService(t, "id,title\n1,hello\n")
+	snapshot := filepath.Join(dir, "published.db.gz")
+	if _, err := writer.Backup(ctx, BackupOptions{Path: snapshot}); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	good, err := os.ReadFile(snapshot)
+	if err != nil {
+		t.Fatalf("read snapshot: %v", err)
+	}
+	replica, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "replica.db")},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService replica: %v", err)
+	}
+	defer replica.Close()
+
+	var (
+		etag      = `"good"`
+		body      = good
+		downloads int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+
+	if changed, err := replica.SyncReplica(ctx, srv.URL); err != nil || !changed {
+		t.Fatalf("first sync: changed=%v err=%v", changed, err)
+	}
+	etag, body = `"corrupt"`, []byte("not a database")
+	for i := 0; i < 2; i++ {
+		if _, err := replica.SyncReplica(ctx, srv.URL); err == nil {
+			t.Fatalf("poll %d: expected the corrupt snapshot to be rejected", i+1)
+		}
+		if status := replica.ReplicaStatus(); status.Error == "" || status.Syncs != 1 {
+			t.Fatalf("poll %d: unexpected status %+v", i+1, status)
+		}
+	}
+	if downloads != 3 {
+		t.Fatalf("expected the corrupt snapshot to be downloaded on every poll, got %d downloads", downloads)
+	}
+	etag, body = `"fixed"`, good
+	if changed, err := replica.SyncReplica(ctx, srv.URL); err != nil || changed {
+		t.Fatalf("sync of the snapshot in use: changed=%v err=%v", changed, err)
+	}
+	if status := replica.ReplicaStatus(); status.Error != "" {
+		t.Fatalf("expected the error to clear, got %+v", status)
+	}
+}
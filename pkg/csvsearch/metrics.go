@@ -0,0 +1,147 @@
+package csvsearch
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"yashubustudio/csv-search/internal/database"
+	"yashubustudio/csv-search/internal/ingest"
+	"yashubustudio/csv-search/internal/metrics"
+	intsearch "yashubustudio/csv-search/internal/search"
+	"yashubustudio/csv-search/internal/server"
+)
+
+// Metrics receives telemetry from a Service so that applications embedding
+// the package can feed their own metrics system instead of (or in addition
+// to) the Prometheus endpoint of the HTTP server. Names are the Metric*
+// constants. Implementations must be safe for concurrent use and should
+// return quickly.
+type Metrics interface {
+	// Count adds delta to the counter name.
+	Count(name string, delta float64, labels map[string]string)
+	// Time records one duration of name.
+	Time(name string, d time.Duration, labels map[string]string)
+}
+
+// Names reported to Metrics, with the labels they carry.
+const (
+	// MetricEncode times query encoding (dataset).
+	MetricEncode = "encode"
+	// MetricScan times the ranking of the stored vectors (dataset).
+	MetricScan = "scan"
+	// MetricRequest times a whole search including its hooks (dataset, op:
+	// "search", "similar" or "keyword", source as in the query log, status:
+	// "ok" or "error").
+	MetricRequest = "request"
+	// MetricIngestBatch times one committed ingest transaction (dataset).
+	MetricIngestBatch = "ingest_batch"
+	// MetricIngestRows counts ingested CSV rows (dataset, result:
+	// "upserted", "skipped" or "dropped").
+	MetricIngestRows = "ingest_rows"
+)
+
+// observeSearch reports a finished search to the Metrics of the Service.
+// timings is nil for searches without a query encoding (Similar).
+func (s *Service) observeSearch(op, source, table string, timings *intsearch.Timings, total time.Duration, err error) {
+	if s.telemetry == nil {
+		return
+	}
+	if timings != nil && err == nil {
+		labels := map[string]string{"dataset": table}
+		s.telemetry.Time(MetricEncode, timings.Encode, labels)
+		s.telemetry.Time(MetricScan, timings.Scan, labels)
+	}
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	s.telemetry.Time(MetricRequest, total, map[string]string{
+		"dataset": table,
+		"op":      op,
+		"source":  firstNonEmpty(source, "library"),
+		"status":  status,
+	})
+}
+
+// serverObserveSearch reports the searches of the HTTP and WebSocket servers.
+func (s *Service) serverObserveSearch(source string, q server.SearchQuery, timings intsearch.Timings, total time.Duration, err error) {
+	s.observeSearch("search", source, q.Dataset, &timings, total, err)
+}
+
+// observeIngestBatch returns the ingest.Options.OnCommit callback reporting
+// to the Metrics of the Service, or nil when none is set.
+func (s *Service) observeIngestBatch(table string) func(int, time.Duration) {
+	if s.telemetry == nil {
+		return nil
+	}
+	return func(_ int, elapsed time.Duration) {
+		s.telemetry.Time(MetricIngestBatch, elapsed, map[string]string{"dataset": table})
+	}
+}
+
+func (s *Service) observeIngestRows(table string, stats ingest.Stats) {
+	if s.telemetry == nil {
+		return
+	}
+	for _, c := range []struct {
+		result string
+		rows   int
+	}{{"upserted", stats.Upserted}, {"skipped", stats.Skipped}, {"dropped", stats.Dropped}} {
+		s.telemetry.Count(MetricIngestRows, float64(c.rows), map[string]string{"dataset": table, "result": c.result})
+	}
+}
+
+// serviceMetrics are the instruments shared by every server built from the
+// Service.
+type serviceMetrics struct {
+	registry     *metrics.Registry
+	ingestRows   *metrics.Counter
+	ingestTime   *metrics.Histogram
+	ingestRate   *metrics.Gauge
+	lastIngestAt *metrics.Gauge
+}
+
+func newServiceMetrics(s *Service) *serviceMetrics {
+	reg := metrics.NewRegistry()
+	m := &serviceMetrics{
+		registry:     reg,
+		ingestRows:   reg.Counter("csvsearch_ingest_rows_total", "CSV rows processed by ingest, by dataset and result (upserted or skipped).", "dataset", "result"),
+		ingestTime:   reg.Histogram("csvsearch_ingest_duration_seconds", "Duration of ingest runs.", []float64{1, 5, 15, 60, 300, 900, 3600}, "dataset"),
+		ingestRate:   reg.Gauge("csvsearch_ingest_rows_per_second", "Throughput of the last ingest run (upserted rows per second).", "dataset"),
+		lastIngestAt: reg.Gauge("csvsearch_ingest_last_success_timestamp_seconds", "Unix time of the last successful ingest run.", "dataset"),
+	}
+	reg.GaugeFunc("csvsearch_database_size_bytes", "Size of the SQLite database (page_count * page_size).", s.databaseSize)
+	return m
+}
+
+func (m *serviceMetrics) observeIngest(table string, upserted, skipped int, elapsed time.Duration) {
+	m.ingestRows.Add(float64(upserted), table, "upserted")
+	m.ingestRows.Add(float64(skipped), table, "skipped")
+	m.ingestTime.Observe(elapsed.Seconds(), table)
+	if secs := elapsed.Seconds(); secs > 0 {
+		m.ingestRate.Set(float64(upserted)/secs, table)
+	}
+	m.lastIngestAt.Set(float64(time.Now().Unix()), table)
+}
+
+// WriteMetrics renders the Service metrics (including those of the HTTP
+// servers it created) in the Prometheus text exposition format, for callers
+// that expose them on their own endpoint.
+func (s *Service) WriteMetrics(w io.Writer) error {
+	return s.metrics.registry.WriteText(w)
+}
+
+func (s *Service) databaseSize() float64 {
+	db := s.db
+	if db == nil {
+		return 0
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	size, err := database.Size(ctx, db)
+	if err != nil {
+		return 0
+	}
+	return float64(size)
+}
@@ -0,0 +1,207 @@
+package csvsearch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"yashubustudio/csv-search/internal/config"
+	"yashubustudio/csv-search/internal/embedding"
+	"yashubustudio/csv-search/internal/store"
+)
+
+// ErrUnknownModel is returned for a SearchOptions.Model that is not
+// registered.
+var ErrUnknownModel = embedding.ErrUnknownModel
+
+// ErrModelMismatch is returned when SearchOptions.Model names a model other
+// than the one that produced the stored embeddings of the dataset.
+var ErrModelMismatch = embedding.ErrModelMismatch
+
+// ModelOptions register a named encoder that searches can select with
+// SearchOptions.Model (see EncoderOptions.Models).
+type ModelOptions struct {
+	// Embedder is used as is and not closed by the Service. Its model
+	// version is Config.ModelVersion, or the name it is registered under.
+	Embedder Embedder
+	// Config creates an ONNX encoder on first use when Embedder is nil. Empty
+	// fields inherit the active encoder config.
+	Config EncoderConfig
+}
+
+// models are the named encoders of a Service, created on first use.
+type models struct {
+	mu      sync.RWMutex // readers hold it while encoding; close takes it
+	entries map[string]*namedModel
+	closed  bool
+
+	// stored caches the models of the stored embeddings of every table
+	// searched with a named model until the next write.
+	storedMu sync.Mutex
+	stored   map[string][]string
+}
+
+type namedModel struct {
+	opts    ModelOptions
+	initMu  sync.Mutex
+	enc     Embedder
+	version string
+	owned   bool
+}
+
+// newModels registers the models of the embedding.models config and opts,
+// which take precedence.
+func newModels(cfg *config.Config, opts map[string]ModelOptions) (*models, error) {
+	m := &models{entries: make(map[string]*namedModel)}
+	if cfg != nil {
+		for name, mc := range cfg.Embedding.Models {
+			m.entries[strings.TrimSpace(name)] = &namedModel{opts: ModelOptions{Config: modelEncoderConfig(cfg, mc)}}
+		}
+	}
+	for name, mo := range opts {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("model names must not be empty")
+		}
+		entry := &namedModel{opts: mo}
+		if mo.Embedder != nil {
+			enc, err := withNormalization(mo.Embedder, mo.Config.Normalize)
+			if err != nil {
+				return nil, fmt.Errorf("model %s: %w", name, err)
+			}
+			entry.enc = enc
+			entry.version = firstNonEmpty(strings.TrimSpace(mo.Config.ModelVersion), name)
+		}
+		m.entries[name] = entry
+	}
+	return m, nil
+}
+
+// modelEncoderConfig returns the encoder config of a model of the
+// embedding.models config, to be merged onto the active one.
+func modelEncoderConfig(cfg *config.Config, mc config.ModelConfig) EncoderConfig {
+	return EncoderConfig{
+		ModelPath:         cfg.ResolvePath(mc.Model),
+		TokenizerPath:     cfg.ResolvePath(mc.Tokenizer),
+		MaxSequenceLength: mc.MaxSeqLen,
+		SparseHeadPath:    cfg.ResolvePath(mc.SparseHead),
+		Truncation:        mc.Truncation,
+		Normalize:         cloneStrings(mc.Normalize),
+		ModelVersion:      mc.ModelVersion,
+	}
+}
+
+// Models returns the names of the encoders registered with
+// EncoderOptions.Models and the embedding.models config, sorted.
+func (s *Service) Models() []string {
+	s.models.mu.RLock()
+	defer s.models.mu.RUnlock()
+	names := make([]string, 0, len(s.models.entries))
+	for name := range s.models.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// acquireNamedModel returns the encoder registered as name with its model
+// version and a function that must be called once the caller stops using it.
+func (s *Service) acquireNamedModel(name string) (Embedder, string, func(), error) {
+	m := s.models
+	m.mu.RLock()
+	if m.closed {
+		m.mu.RUnlock()
+		return nil, "", nil, ErrClosed
+	}
+	entry, ok := m.entries[name]
+	if !ok {
+		m.mu.RUnlock()
+		return nil, "", nil, fmt.Errorf("%w %q (registered: %s)", ErrUnknownModel, name, strings.Join(s.Models(), ", "))
+	}
+	entry.initMu.Lock()
+	defer entry.initMu.Unlock()
+	if entry.enc == nil {
+		cfg := mergeEncoderConfig(s.EncoderConfig(), entry.opts.Config)
+		enc, err := newEncoder(cfg)
+		if err != nil {
+			m.mu.RUnlock()
+			return nil, "", nil, withKind(ErrEncoder, fmt.Errorf("model %s: %w", name, err))
+		}
+		entry.enc, entry.version, entry.owned = enc, modelVersion(cfg), true
+	}
+	return entry.enc, entry.version, m.mu.RUnlock, nil
+}
+
+// queryEncoder returns the encoder that a search of table encodes its query
+// with: the active one, or the model registered as name, which must have
+// produced the stored embeddings of table.
+func (s *Service) queryEncoder(ctx context.Context, table, name string) (Embedder, func(), error) {
+	if name = strings.TrimSpace(name); name == "" {
+		return s.acquireEncoder()
+	}
+	enc, version, release, err := s.acquireNamedModel(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	stored, err := s.storedModels(ctx, table)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	for _, model := range stored {
+		if model != version {
+			release()
+			return nil, nil, fmt.Errorf("%w: %s stores embeddings of %s, model %s is %s", ErrModelMismatch, table, strings.Join(stored, ", "), name, version)
+		}
+	}
+	return enc, release, nil
+}
+
+// storedModels returns the models recorded with the embeddings of table.
+func (s *Service) storedModels(ctx context.Context, table string) ([]string, error) {
+	m := s.models
+	m.storedMu.Lock()
+	models, ok := m.stored[table]
+	m.storedMu.Unlock()
+	if ok {
+		return models, nil
+	}
+	models, err := store.VectorModels(ctx, s.reader, table)
+	if err != nil {
+		return nil, err
+	}
+	m.storedMu.Lock()
+	if m.stored == nil {
+		m.stored = make(map[string][]string)
+	}
+	m.stored[table] = models
+	m.storedMu.Unlock()
+	return models, nil
+}
+
+// forgetStored drops the cached models of the stored embeddings.
+func (m *models) forgetStored() {
+	m.storedMu.Lock()
+	m.stored = nil
+	m.storedMu.Unlock()
+}
+
+// close waits for the encodes in flight and closes the encoders the Service
+// created.
+func (m *models) close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	var err error
+	for _, entry := range m.entries {
+		if entry.owned && entry.enc != nil {
+			if cerr := entry.enc.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+		entry.enc = nil
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package csvsearch
+
+import (
+	"yashubustudio/csv-search/internal/embedding"
+	"yashubustudio/csv-search/internal/textnorm"
+)
+
+// normalizingEmbedder applies text normalization before delegating to the
+// wrapped embedder, so ingest-time and query-time inputs are treated alike.
+type normalizingEmbedder struct {
+	Embedder
+	norm *textnorm.Normalizer
+}
+
+var (
+	_ SparseEmbedder = normalizingEmbedder{}
+	_ TokenCounter   = normalizingEmbedder{}
+)
+
+// withNormalization wraps enc when steps are configured.
+func withNormalization(enc Embedder, steps []string) (Embedder, error) {
+	norm, err := textnorm.New(steps)
+	if err != nil {
+		return nil, err
+	}
+	if enc == nil || norm == nil {
+		return enc, nil
+	}
+	return normalizingEmbedder{Embedder: enc, norm: norm}, nil
+}
+
+func (e normalizingEmbedder) Encode(text string) ([]float32, error) {
+	return e.Embedder.Encode(e.norm.Apply(text))
+}
+
+func (e normalizingEmbedder) EncodeBatch(texts []string) ([][]float32, error) {
+	normalized := make([]string, len(texts))
+	for i, text := range texts {
+		normalized[i] = e.norm.Apply(text)
+	}
+	return e.Embedder.EncodeBatch(normalized)
+}
+
+func (e normalizingEmbedder) HasSparse() bool {
+	_, ok := embedding.Sparse(e.Embedder)
+	return ok
+}
+
+func (e normalizingEmbedder) EncodeHybrid(text string) ([]float32, map[int32]float32, error) {
+	sparse, ok := embedding.Sparse(e.Embedder)
+	if !ok {
+		return nil, nil, errNoSparse
+	}
+	return sparse.EncodeHybrid(e.norm.Apply(text))
+}
+
+func (e normalizingEmbedder) CountsTokens() bool {
+	_, ok := embedding.Tokens(e.Embedder)
+	return ok
+}
+
+func (e normalizingEmbedder) CountTokens(text string) (int, error) {
+	counter, ok := embedding.Tokens(e.Embedder)
+	if !ok {
+		return 0, errNoTokens
+	}
+	return counter.CountTokens(e.norm.Apply(text))
+}
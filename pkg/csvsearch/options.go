@@ -0,0 +1,121 @@
+package csvsearch
+
+import (
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"yashubustudio/csv-search/emb"
+)
+
+// Option configures a Service built by New. Options are applied in order, so
+// a later option overrides an earlier one that sets the same field.
+type Option func(*ServiceOptions)
+
+// New builds a Service from functional options. It is equivalent to
+// NewService with the ServiceOptions the options describe, and keeps working
+// as ServiceOptions gains fields.
+func New(opts ...Option) (*Service, error) {
+	var so ServiceOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&so)
+		}
+	}
+	return NewService(so)
+}
+
+// WithConfigFile loads the JSON configuration at path, which must exist.
+func WithConfigFile(path string) Option {
+	return func(o *ServiceOptions) {
+		o.Config = ConfigReference{Path: path, Required: true}
+	}
+}
+
+// WithOptionalConfigFile loads the JSON configuration at path when the file
+// exists.
+func WithOptionalConfigFile(path string) Option {
+	return func(o *ServiceOptions) {
+		o.Config = ConfigReference{Path: path}
+	}
+}
+
+// WithDatabasePath opens (and creates if needed) the SQLite database at path.
+func WithDatabasePath(path string) Option {
+	return func(o *ServiceOptions) {
+		o.Database.Path = path
+	}
+}
+
+// WithDB uses an already opened database handle, which the Service does not
+// close.
+func WithDB(db *sql.DB) Option {
+	return func(o *ServiceOptions) {
+		o.Database.Handle = db
+	}
+}
+
+// WithEmbedder uses e to encode texts instead of the ONNX encoder. The
+// Service does not close it.
+func WithEmbedder(e Embedder) Option {
+	return func(o *ServiceOptions) {
+		o.Encoder.Embedder = e
+	}
+}
+
+// WithModel registers a named encoder that searches can select with
+// SearchOptions.Model (see EncoderOptions.Models).
+func WithModel(name string, model ModelOptions) Option {
+	return func(o *ServiceOptions) {
+		if o.Encoder.Models == nil {
+			o.Encoder.Models = make(map[string]ModelOptions)
+		}
+		o.Encoder.Models[name] = model
+	}
+}
+
+// WithEncoder uses an already initialized ONNX encoder, which the Service
+// does not close.
+func WithEncoder(enc *emb.Encoder) Option {
+	return func(o *ServiceOptions) {
+		o.Encoder.Instance = enc
+	}
+}
+
+// WithEncoderConfig sets the assets of the lazily created ONNX encoder. Empty
+// fields fall back to the JSON configuration.
+func WithEncoderConfig(cfg EncoderConfig) Option {
+	return func(o *ServiceOptions) {
+		o.Encoder.Config = cfg
+	}
+}
+
+// WithQueryLog records searches in the query log, pruning entries older than
+// retention (zero uses query_log.retention_days from the config).
+func WithQueryLog(retention time.Duration) Option {
+	return func(o *ServiceOptions) {
+		o.QueryLog = QueryLogOptions{Enabled: true, Retention: retention}
+	}
+}
+
+// WithResultCache caches up to size search results (1024 when zero) for ttl
+// (see ResultCacheOptions).
+func WithResultCache(ttl time.Duration, size int) Option {
+	return func(o *ServiceOptions) {
+		o.ResultCache = ResultCacheOptions{TTL: ttl, Size: size}
+	}
+}
+
+// WithLogger sends the log messages of the Service to logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *ServiceOptions) {
+		o.Logger = logger
+	}
+}
+
+// WithMetrics reports telemetry to m (see ServiceOptions.Metrics).
+func WithMetrics(m Metrics) Option {
+	return func(o *ServiceOptions) {
+		o.Metrics = m
+	}
+}
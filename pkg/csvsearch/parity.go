@@ -0,0 +1,156 @@
+package csvsearch
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"yashubustudio/csv-search/internal/vector"
+)
+
+// defaultParityTexts are used when the database holds no text to sample.
+var defaultParityTexts = []string{
+	"渋谷で静かなWi-Fiカフェを探しています。",
+	"ノートPC作業に向いた落ち着いた喫茶店を知りたい。",
+	"染色工程で発生した色ムラの再加工を依頼します。",
+	"The quick brown fox jumps over the lazy dog.",
+}
+
+// ParityOptions configure a comparison between a reference encoder (usually
+// the fp32 model) and a candidate such as an int8-quantized export. Empty
+// fields in Reference and Candidate fall back to the active encoder config.
+type ParityOptions struct {
+	Reference EncoderConfig
+	Candidate EncoderConfig
+	// Texts to embed. When empty, up to Samples texts are taken from the
+	// dataset's stored records.
+	Texts   []string
+	Dataset string
+	Table   string
+	Samples int
+	// Threshold is the minimum acceptable cosine similarity between the two
+	// embeddings of every sample (defaults to 0.98).
+	Threshold float64
+}
+
+// ParitySample reports the agreement of both encoders for a single text.
+type ParitySample struct {
+	Text   string  `json:"text"`
+	Cosine float64 `json:"cosine"`
+}
+
+// ParityReport summarizes the cosine drift between two encoders.
+type ParityReport struct {
+	Samples    []ParitySample `json:"samples"`
+	MinCosine  float64        `json:"min_cosine"`
+	MeanCosine float64        `json:"mean_cosine"`
+	MaxDrift   float64        `json:"max_drift"`
+	Threshold  float64        `json:"threshold"`
+	Passed     bool           `json:"passed"`
+}
+
+// CompareEmbedders embeds texts with both embedders and reports how far the
+// candidate drifts from the reference.
+func CompareEmbedders(reference, candidate Embedder, texts []string, threshold float64) (ParityReport, error) {
+	if reference == nil || candidate == nil {
+		return ParityReport{}, fmt.Errorf("both embedders are required")
+	}
+	if len(texts) == 0 {
+		return ParityReport{}, fmt.Errorf("no texts to compare")
+	}
+	if threshold <= 0 {
+		threshold = 0.98
+	}
+	if rd, cd := reference.Dimension(), candidate.Dimension(); rd != cd {
+		return ParityReport{}, fmt.Errorf("dimension mismatch: reference %d, candidate %d", rd, cd)
+	}
+
+	report := ParityReport{Threshold: threshold, MinCosine: math.Inf(1)}
+	var sum float64
+	for _, text := range texts {
+		ref, err := reference.Encode(text)
+		if err != nil {
+			return ParityReport{}, fmt.Errorf("reference encode: %w", err)
+		}
+		got, err := candidate.Encode(text)
+		if err != nil {
+			return ParityReport{}, fmt.Errorf("candidate encode: %w", err)
+		}
+		cos := vector.Cosine(ref, got)
+		report.Samples = append(report.Samples, ParitySample{Text: text, Cosine: cos})
+		sum += cos
+		if cos < report.MinCosine {
+			report.MinCosine = cos
+		}
+	}
+	report.MeanCosine = sum / float64(len(texts))
+	report.MaxDrift = 1 - report.MinCosine
+	report.Passed = report.MinCosine >= threshold
+	return report, nil
+}
+
+// ParityCheck loads the reference and candidate encoders side by side and
+// compares their embeddings for a handful of texts, so that a quantized model
+// can be vetted before it replaces the fp32 one.
+func (s *Service) ParityCheck(ctx context.Context, opts ParityOptions) (ParityReport, error) {
+	if ctx == nil {
+		return ParityReport{}, fmt.Errorf("context must not be nil")
+	}
+
+	texts := cloneStrings(opts.Texts)
+	if len(texts) == 0 {
+		sampled, err := s.sampleTexts(ctx, opts.Dataset, opts.Table, firstPositive(opts.Samples, 16))
+		if err != nil {
+			return ParityReport{}, err
+		}
+		texts = sampled
+	}
+	if len(texts) == 0 {
+		texts = cloneStrings(defaultParityTexts)
+	}
+
+	base := s.EncoderConfig()
+	reference, err := newEncoder(mergeEncoderConfig(base, opts.Reference))
+	if err != nil {
+		return ParityReport{}, fmt.Errorf("reference encoder: %w", err)
+	}
+	defer reference.Close()
+	candidate, err := newEncoder(mergeEncoderConfig(base, opts.Candidate))
+	if err != nil {
+		return ParityReport{}, fmt.Errorf("candidate encoder: %w", err)
+	}
+	defer candidate.Close()
+
+	return CompareEmbedders(reference, candidate, texts, opts.Threshold)
+}
+
+// sampleTexts returns up to limit embedding texts stored for the dataset.
+func (s *Service) sampleTexts(ctx context.Context, datasetName, tableOverride string, limit int) ([]string, error) {
+	if s.db == nil {
+		return nil, nil
+	}
+	if err := s.ensureDatabase(ctx); err != nil {
+		return nil, err
+	}
+	name, dataset, _ := resolveDataset(s.Config(), datasetName)
+	table := resolveTable(name, dataset, tableOverride)
+
+	rows, err := s.db.QueryContext(ctx, `SELECT content FROM records_fts WHERE dataset = ? LIMIT ?`, table, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var texts []string
+	for rows.Next() {
+		var text string
+		if err := rows.Scan(&text); err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(text) != "" {
+			texts = append(texts, text)
+		}
+	}
+	return texts, rows.Err()
+}
@@ -0,0 +1,91 @@
+package csvsearch
+
+import (
+	"strings"
+	"testing"
+)
+
+type fakeEmbedder struct {
+	dim   int
+	shift float32
+}
+
+func (f fakeEmbedder) Encode(text string) ([]float32, error) {
+	vec := make([]float32, f.dim)
+	vec[0] = float32(len(text))
+	vec[1] = 1 + f.shift
+	return vec, nil
+}
+
+func (f fakeEmbedder) EncodeBatch(texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		out[i], _ = f.Encode(text)
+	}
+	return out, nil
+}
+
+func (f fakeEmbedder) Dimension() int { return f.dim }
+func (f fakeEmbedder) Close() error   { return nil }
+
+func TestCompareEmbedders(t *testing.T) {
+	texts := []string{"a", strings.Repeat("b", 4)}
+
+	report, err := CompareEmbedders(fakeEmbedder{dim: 2}, fakeEmbedder{dim: 2}, texts, 0)
+	if err != nil {
+		t.Fatalf("CompareEmbedders returned error: %v", err)
+	}
+	if !report.Passed || report.MinCosine < 0.9999 || report.Threshold != 0.98 {
+		t.Fatalf("identical embedders should pass: %+v", report)
+	}
+
+	report, err = CompareEmbedders(fakeEmbedder{dim: 2}, fakeEmbedder{dim: 2, shift: 5}, texts, 0.99)
+	if err != nil {
+		t.Fatalf("CompareEmbedders returned error: %v", err)
+	}
+	if report.Passed {
+		t.Fatalf("drifting embedder should fail: %+v", report)
+	}
+	if len(report.Samples) != len(texts) {
+		t.Fatalf("expected %d samples, got %d", len(texts), len(report.Samples))
+	}
+
+	if _, err := CompareEmbedders(fakeEmbedder{dim: 2}, fakeEmbedder{dim: 3}, texts, 0); err == nil {
+		t.Fatalf("expected dimension mismatch error")
+	}
+}
+
+func TestCompareModels(t *testing.T) {
+	texts := []string{"a", "bbbb", strings.Repeat("c", 9), strings.Repeat("d", 16)}
+
+	report, err := CompareModels(fakeEmbedder{dim: 2}, fakeEmbedder{dim: 2}, texts, 0)
+	if err != nil {
+		t.Fatalf("CompareModels returned error: %v", err)
+	}
+	if report.TopK != len(texts)-1 || report.SelfCosine == nil || report.SelfCosine.Min < 0.9999 {
+		t.Fatalf("unexpected report for identical models: %+v", report)
+	}
+	if report.TopKOverlap.Min != 1 || report.RankShift.Max != 0 || report.SimilarityDrift.Max > 1e-6 || report.ReembedRequired || report.RetuneThresholds {
+		t.Fatalf("identical models should not drift: %+v", report)
+	}
+
+	report, err = CompareModels(fakeEmbedder{dim: 2}, fakeEmbedder{dim: 2, shift: 5}, texts, 2)
+	if err != nil {
+		t.Fatalf("CompareModels returned error: %v", err)
+	}
+	if report.SimilarityDrift.Max == 0 || !report.RetuneThresholds || !report.ReembedRequired {
+		t.Fatalf("drifting model should call for re-embedding and re-tuning: %+v", report)
+	}
+
+	report, err = CompareModels(fakeEmbedder{dim: 2}, fakeEmbedder{dim: 3}, texts, 2)
+	if err != nil {
+		t.Fatalf("CompareModels returned error: %v", err)
+	}
+	if report.SelfCosine != nil || !report.ReembedRequired || report.CandidateDimension != 3 {
+		t.Fatalf("models of different dimensions should be compared by ranking only: %+v", report)
+	}
+
+	if _, err := CompareModels(fakeEmbedder{dim: 2}, fakeEmbedder{dim: 2}, texts[:2], 0); err == nil {
+		t.Fatalf("expected an error for too few texts")
+	}
+}
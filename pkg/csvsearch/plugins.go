@@ -0,0 +1,35 @@
+package csvsearch
+
+import (
+	intsearch "yashubustudio/csv-search/internal/search"
+)
+
+// FilterOperator reports whether the value of a metadata field passes a
+// custom filter operator given the value of the filter as arg.
+type FilterOperator func(value, arg string) bool
+
+// Scorer returns the score of a result of a semantic search, given the score
+// computed so far (similarity with the boosts and distance weights applied)
+// and the result with its fields and distance.
+type Scorer func(score float64, r Result) float64
+
+// RegisterFilterOperator adds a filter operator that filters use as
+// Filter{Op: name}, written "field@name=value" on the command line and in
+// the HTTP API. Operators are evaluated by SQLite like the built-in ones,
+// so they must be registered before NewService, typically from the init
+// function of a package imported by the binary. Records without the field
+// never match.
+func RegisterFilterOperator(name string, op FilterOperator) error {
+	return intsearch.RegisterFilterOperator(name, intsearch.FilterOperatorFunc(op))
+}
+
+// RegisterScorer adds a scorer that searches select with
+// SearchOptions.Scorer, e.g. to mix a popularity field into the ranking.
+func RegisterScorer(name string, scorer Scorer) error {
+	if scorer == nil {
+		return intsearch.RegisterScorer(name, nil)
+	}
+	return intsearch.RegisterScorer(name, func(score float64, r intsearch.Result) float64 {
+		return scorer(score, Result(r))
+	})
+}
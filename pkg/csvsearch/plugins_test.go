@@ -0,0 +1,92 @@
+package csvsearch
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func init() {
+	if err := RegisterFilterOperator("test_prefix", func(value, arg string) bool {
+		return strings.HasPrefix(value, arg)
+	}); err != nil {
+		panic(err)
+	}
+	if err := RegisterScorer("test_views", func(score float64, r Result) float64 {
+		views, _ := strconv.ParseFloat(r.Fields["views"], 64)
+		return score + views
+	}); err != nil {
+		panic(err)
+	}
+}
+
+func TestPlugins(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t, "id,title,views\n"+
+		"a,tokyo tower,1\n"+
+		"b,tokyo station,5\n"+
+		"c,osaka castle,9\n")
+	ids := func(results []Result) string {
+		var ids []string
+		for _, r := range results {
+			ids = append(ids, r.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	filter, err := ParseFilter("title@test_prefix=tokyo")
+	if err != nil {
+		t.Fatalf("ParseFilter: %v", err)
+	}
+	if filter != (Filter{Field: "title", Op: "test_prefix", Value: "tokyo"}) {
+		t.Fatalf("unexpected filter %+v", filter)
+	}
+	results, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Filters: []Filter{filter}})
+	if err != nil {
+		t.Fatalf("Search with a custom operator: %v", err)
+	}
+	if got := ids(results); got != "a,b" {
+		t.Fatalf("expected the titles starting with tokyo, got %s", got)
+	}
+
+	// The scorer adds the views, which outweigh the similarities.
+	results, err = svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "tokyo", Scorer: "test_views"})
+	if err != nil {
+		t.Fatalf("Search with a scorer: %v", err)
+	}
+	if got := ids(results); got != "c,b,a" {
+		t.Fatalf("expected the results by views, got %s", got)
+	}
+	if results[0].Score < 9 {
+		t.Fatalf("expected the rescored score, got %v", results[0].Score)
+	}
+
+	// Only registered names are operators; anything else stays part of the
+	// field name.
+	for expr, want := range map[string]Filter{
+		"user@domain=x":     {Field: "user@domain", Op: "=", Value: "x"},
+		"title@missing!=x":  {Field: "title@missing", Op: "!=", Value: "x"},
+		"a@b@test_prefix=x": {Field: "a@b", Op: "test_prefix", Value: "x"},
+	} {
+		filter, err := ParseFilter(expr)
+		if err != nil {
+			t.Fatalf("ParseFilter(%q): %v", expr, err)
+		}
+		if filter != want {
+			t.Fatalf("ParseFilter(%q) = %+v, want %+v", expr, filter, want)
+		}
+	}
+	if _, err := ParseFilter("title@test_prefix>x"); err == nil {
+		t.Fatalf("expected an error for a custom operator without =")
+	}
+	if _, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "tokyo", Scorer: "missing"}); err == nil {
+		t.Fatalf("expected an error for an unknown scorer")
+	}
+	if err := RegisterScorer("test_views", func(score float64, r Result) float64 { return score }); err == nil {
+		t.Fatalf("expected an error for a scorer registered twice")
+	}
+	if err := RegisterFilterOperator("Bad-Name", func(value, arg string) bool { return true }); err == nil {
+		t.Fatalf("expected an error for an invalid operator name")
+	}
+}
@@ -0,0 +1,92 @@
+package csvsearch
+
+import (
+	"context"
+	"time"
+
+	"yashubustudio/csv-search/internal/config"
+	"yashubustudio/csv-search/internal/querylog"
+	intsearch "yashubustudio/csv-search/internal/search"
+)
+
+// QueryLogOptions enable recording every search (query text, dataset,
+// filters, latency and the top result IDs/scores) in the query_log table.
+// They are combined with the "query_log" section of the configuration file.
+type QueryLogOptions struct {
+	Enabled bool
+	// Retention prunes entries older than this; zero uses
+	// query_log.retention_days from the config or keeps entries forever.
+	Retention time.Duration
+}
+
+// QueryReportOptions select the searches summarised by QueryReport.
+type QueryReportOptions struct {
+	// Since limits the report to searches logged after this time.
+	Since   time.Time
+	Dataset string
+	// Limit caps the top and zero-result query lists (20 when zero).
+	Limit int
+}
+
+// QueryReport summarises the query log: the most frequent queries, queries
+// without results and latency percentiles per dataset.
+type QueryReport = querylog.Report
+
+// QueryReport aggregates the logged searches. It reads whatever the query log
+// holds, even when logging is currently disabled.
+func (s *Service) QueryReport(ctx context.Context, opts QueryReportOptions) (QueryReport, error) {
+	if err := s.ready(ctx); err != nil {
+		return QueryReport{}, err
+	}
+	return querylog.BuildReport(ctx, s.db, querylog.ReportOptions{
+		Since:   opts.Since,
+		Dataset: opts.Dataset,
+		Limit:   opts.Limit,
+	})
+}
+
+func newQueryLogger(cfg *config.Config, s *Service, opts QueryLogOptions) (*querylog.Logger, error) {
+	enabled := opts.Enabled
+	retention := opts.Retention
+	if cfg != nil {
+		enabled = enabled || cfg.QueryLog.Enabled
+		if retention == 0 {
+			retention = time.Duration(cfg.QueryLog.RetentionDays) * 24 * time.Hour
+		}
+	}
+	if !enabled {
+		return nil, nil
+	}
+	return querylog.New(s.db, retention, s.log)
+}
+
+func (s *Service) logSearch(opts SearchOptions, table string, topK int, latency time.Duration, results []Result, err error) {
+	if s.queryLog == nil {
+		return
+	}
+	entry := querylog.Entry{
+		Source:  firstNonEmpty(opts.Source, "library"),
+		Dataset: table,
+		Query:   opts.Query,
+		TopK:    topK,
+		Latency: latency,
+		Results: len(results),
+	}
+	if len(opts.Filters) > 0 {
+		entry.Filters = make(map[string]string, len(opts.Filters))
+		for _, f := range opts.Filters {
+			entry.Filters[intsearch.Filter(f).Label()] = f.Value
+		}
+	}
+	for i, r := range results {
+		if i == querylog.MaxTopResults {
+			break
+		}
+		entry.TopIDs = append(entry.TopIDs, r.ID)
+		entry.TopScores = append(entry.TopScores, r.Score)
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	s.queryLog.Log(entry)
+}
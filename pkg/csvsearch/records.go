@@ -0,0 +1,95 @@
+package csvsearch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"yashubustudio/csv-search/internal/database"
+	"yashubustudio/csv-search/internal/store"
+)
+
+// ErrNotFound is returned by Get when the record does not exist.
+var ErrNotFound = store.ErrNotFound
+
+// Record is a stored row without its embedding.
+type Record struct {
+	Dataset string            `json:"dataset"`
+	ID      string            `json:"id"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	Lat     *float64          `json:"lat,omitempty"`
+	Lng     *float64          `json:"lng,omitempty"`
+}
+
+// Get returns a single record from the dataset (or its table override).
+func (s *Service) Get(ctx context.Context, dataset, id string) (Record, error) {
+	if ctx == nil {
+		return Record{}, fmt.Errorf("context must not be nil")
+	}
+	if s.db == nil {
+		return Record{}, fmt.Errorf("database handle is nil")
+	}
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return Record{}, fmt.Errorf("id is required")
+	}
+	if err := s.ensureDatabase(ctx); err != nil {
+		return Record{}, err
+	}
+
+	datasetName, datasetCfg, _ := resolveDataset(s.Config(), dataset)
+	rec, err := store.Get(ctx, s.db, resolveTable(datasetName, datasetCfg, ""), id)
+	if err != nil {
+		return Record{}, err
+	}
+	return Record(rec), nil
+}
+
+// Delete removes records by id, rewrites the vector pages they were on and
+// returns how many existed.
+func (s *Service) Delete(ctx context.Context, dataset string, ids []string) (int64, error) {
+	if ctx == nil {
+		return 0, fmt.Errorf("context must not be nil")
+	}
+	if s.db == nil {
+		return 0, fmt.Errorf("database handle is nil")
+	}
+	cleaned := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if trimmed := strings.TrimSpace(id); trimmed != "" {
+			cleaned = append(cleaned, trimmed)
+		}
+	}
+	if len(cleaned) == 0 {
+		return 0, fmt.Errorf("at least one id is required")
+	}
+	if err := s.ensureDatabase(ctx); err != nil {
+		return 0, err
+	}
+
+	datasetName, datasetCfg, _ := resolveDataset(s.Config(), dataset)
+	table := resolveTable(datasetName, datasetCfg, "")
+	defer s.invalidateResults(table)
+	deleted, err := store.DeleteIDs(ctx, s.db, table, cleaned)
+	if err != nil {
+		return 0, err
+	}
+	s.notifyChange(ctx, table, ChangeDeleted, deleted)
+	if len(deleted) > 0 {
+		if _, err := database.UpdateVectorPages(ctx, s.db, table); err != nil {
+			return int64(len(deleted)), err
+		}
+	}
+	return int64(len(deleted)), nil
+}
+
+// FindIDs returns the ids of the records whose metadata matches every filter
+// (the same equality semantics as search filters), in insertion order. Use it
+// to select records for Delete.
+func (s *Service) FindIDs(ctx context.Context, dataset string, filters []Filter) ([]string, error) {
+	if err := s.ready(ctx); err != nil {
+		return nil, err
+	}
+	datasetName, datasetCfg, _ := resolveDataset(s.Config(), dataset)
+	return s.engine.MatchingIDs(ctx, resolveTable(datasetName, datasetCfg, ""), toSearchFilters(filters))
+}
@@ -0,0 +1,204 @@
+package csvsearch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"yashubustudio/csv-search/internal/config"
+)
+
+// ConfigReload reports what ReloadConfig changed. Applied lists the settings
+// now in effect; RestartRequired lists changed settings that only take
+// effect after a restart (the running values are kept until then).
+type ConfigReload struct {
+	Applied         []string `json:"applied,omitempty"`
+	RestartRequired []string `json:"restart_required,omitempty"`
+}
+
+// Changed reports whether the configuration file differed from the running
+// configuration.
+func (r ConfigReload) Changed() bool {
+	return len(r.Applied) > 0 || len(r.RestartRequired) > 0
+}
+
+// ReloadConfig re-reads the configuration file the Service was created with
+// and applies the default dataset, dataset mappings and search settings to
+// subsequent calls. Changes to the database, embedding, query_log, answer
+// and tenants sections are reported as RestartRequired and not applied.
+// Webhooks apply to the changes made after the reload. On error the current
+// configuration stays in effect.
+func (s *Service) ReloadConfig() (ConfigReload, error) {
+	s.cfgMu.Lock()
+	defer s.cfgMu.Unlock()
+
+	next, err := loadConfig(s.cfgRef.Path, s.cfgRef.Required)
+	if err != nil {
+		return ConfigReload{}, err
+	}
+	prev := s.Config()
+	if next == nil {
+		if prev != nil {
+			return ConfigReload{}, fmt.Errorf("configuration file %s no longer exists", configFilePath(s.cfgRef))
+		}
+		return ConfigReload{}, nil
+	}
+
+	changes := diffConfig(prev, next)
+	// Keep the sections that are only read at startup so that Config()
+	// keeps describing the running state.
+	var running config.Config
+	if prev != nil {
+		running = *prev
+	}
+	next.Database = running.Database
+	next.Embedding = running.Embedding
+	next.QueryLog = running.QueryLog
+	next.Answer = running.Answer
+	next.Tenants = running.Tenants
+	s.cfg.Store(next)
+	s.invalidateResults()
+	return changes, nil
+}
+
+func diffConfig(prev, next *config.Config) ConfigReload {
+	var old config.Config
+	if prev != nil {
+		old = *prev
+	}
+	var changes ConfigReload
+	if old.DefaultDataset != next.DefaultDataset {
+		changes.Applied = append(changes.Applied, "default_dataset")
+	}
+	names := make(map[string]bool, len(old.Datasets)+len(next.Datasets))
+	for name := range old.Datasets {
+		names[name] = true
+	}
+	for name := range next.Datasets {
+		names[name] = true
+	}
+	var datasets []string
+	for name := range names {
+		before, hadBefore := old.Datasets[name]
+		after, hasAfter := next.Datasets[name]
+		if hadBefore != hasAfter || !reflect.DeepEqual(before, after) ||
+			!reflect.DeepEqual(old.DictionariesFor(name), next.DictionariesFor(name)) {
+			datasets = append(datasets, "datasets."+name)
+		}
+	}
+	sort.Strings(datasets)
+	changes.Applied = append(changes.Applied, datasets...)
+	if old.Search.DefaultTopK != next.Search.DefaultTopK {
+		changes.Applied = append(changes.Applied, "search.default_topk")
+	}
+	if old.Search.SparseWeight != next.Search.SparseWeight {
+		changes.Applied = append(changes.Applied, "search.sparse_weight")
+	}
+	if old.Search.Metric != next.Search.Metric {
+		changes.Applied = append(changes.Applied, "search.metric")
+	}
+	if old.Search.MinScore != next.Search.MinScore {
+		changes.Applied = append(changes.Applied, "search.min_score")
+	}
+	if old.Search.ScorePrecision != next.Search.ScorePrecision {
+		changes.Applied = append(changes.Applied, "search.score_precision")
+	}
+	if old.Search.ScoreNormalization != next.Search.ScoreNormalization {
+		changes.Applied = append(changes.Applied, "search.score_normalization")
+	}
+	if old.Search.StrictFilters != next.Search.StrictFilters {
+		changes.Applied = append(changes.Applied, "search.strict_filters")
+	}
+	if !reflect.DeepEqual(old.Search.FieldBoosts, next.Search.FieldBoosts) {
+		changes.Applied = append(changes.Applied, "search.field_boosts")
+	}
+	if !reflect.DeepEqual(old.Webhooks, next.Webhooks) {
+		changes.Applied = append(changes.Applied, "webhooks")
+	}
+	if !reflect.DeepEqual(old.Database, next.Database) {
+		changes.RestartRequired = append(changes.RestartRequired, "database")
+	}
+	if !reflect.DeepEqual(old.Embedding, next.Embedding) {
+		changes.RestartRequired = append(changes.RestartRequired, "embedding")
+	}
+	if !reflect.DeepEqual(old.QueryLog, next.QueryLog) {
+		changes.RestartRequired = append(changes.RestartRequired, "query_log")
+	}
+	if !reflect.DeepEqual(old.Answer, next.Answer) {
+		changes.RestartRequired = append(changes.RestartRequired, "answer")
+	}
+	if !reflect.DeepEqual(old.Tenants, next.Tenants) {
+		changes.RestartRequired = append(changes.RestartRequired, "tenants")
+	}
+	return changes
+}
+
+func configFilePath(ref ConfigReference) string {
+	return firstNonEmpty(strings.TrimSpace(ref.Path), "csv-search_config.json")
+}
+
+// watchConfig polls the configuration file, the files it includes and the
+// dictionary files of the datasets every interval and calls reload when a
+// modification time or size changes, until ctx is done.
+func (s *Service) watchConfig(ctx context.Context, interval time.Duration, reload func(trigger string)) {
+	path := configFilePath(s.cfgRef)
+	stamp := func() (string, bool) {
+		files := s.Config().Files()
+		if len(files) == 0 {
+			files = []string{path}
+		}
+		files = append(files[:len(files):len(files)], s.Config().DictionaryFiles()...)
+		var b strings.Builder
+		for _, file := range files {
+			info, err := os.Stat(file)
+			if err != nil {
+				if file == files[0] {
+					return "", false
+				}
+				fmt.Fprintf(&b, "%s missing\n", file)
+				continue
+			}
+			fmt.Fprintf(&b, "%s %d %d\n", file, info.ModTime().UnixNano(), info.Size())
+		}
+		return b.String(), true
+	}
+	last, _ := stamp()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current, ok := stamp()
+			if current == last {
+				continue
+			}
+			last = current
+			if !ok {
+				s.log.Warn("configuration file disappeared, keeping the current settings", "path", path)
+				continue
+			}
+			reload("watch")
+		}
+	}
+}
+
+// logConfigReload reports the outcome of a configuration reload.
+func (s *Service) logConfigReload(trigger string, changes ConfigReload, err error) {
+	switch {
+	case err != nil:
+		s.log.Error("config reload failed, keeping the current settings", "trigger", trigger, "err", err)
+	case !changes.Changed():
+		s.log.Info("config reloaded without changes", "trigger", trigger)
+	default:
+		s.log.Info("config reloaded", "trigger", trigger, "applied", changes.Applied)
+		if len(changes.RestartRequired) > 0 {
+			s.log.Warn("config changes require a restart to take effect", "sections", changes.RestartRequired)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package csvsearch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReloadConfig(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	write := func(content string) {
+		if err := os.WriteFile(cfgPath, []byte(content), 0o600); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+	}
+	write(`{
+  "database": {"path": "app.db"},
+  "embedding": {"model": "a.onnx"},
+  "default_dataset": "docs",
+  "datasets": {"docs": {"table": "docs_v1"}, "faq": {}},
+  "search": {"default_topk": 5}
+}`)
+
+	svc, err := NewService(ServiceOptions{
+		Config:  ConfigReference{Path: cfgPath, Required: true},
+		Encoder: EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+	api, err := svc.NewAPIServer(ServeOptions{SparseWeight: 0.25})
+	if err != nil {
+		t.Fatalf("NewAPIServer: %v", err)
+	}
+	if d := api.server.Defaults(); d.Dataset != "docs_v1" || d.Search.TopK != 5 || d.Search.SparseWeight != 0.25 {
+		t.Fatalf("unexpected initial defaults: %+v", d)
+	}
+
+	write(`{
+  "database": {"path": "app.db"},
+  "embedding": {"model": "b.onnx"},
+  "default_dataset": "docs",
+  "datasets": {"docs": {"table": "docs_v2"}, "faq": {}},
+  "search": {"default_topk": 8, "sparse_weight": 0.5}
+}`)
+	changes, err := api.ReloadConfig()
+	if err != nil {
+		t.Fatalf("ReloadConfig: %v", err)
+	}
+	want := ConfigReload{
+		Applied:         []string{"datasets.docs", "search.default_topk", "search.sparse_weight"},
+		RestartRequired: []string{"embedding"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+	// The serve option keeps precedence over the configured sparse weight.
+	if d := api.server.Defaults(); d.Dataset != "docs_v2" || d.Search.TopK != 8 || d.Search.SparseWeight != 0.25 {
+		t.Fatalf("unexpected reloaded defaults: %+v", d)
+	}
+	if model := svc.Config().Embedding.Model; model != "a.onnx" {
+		t.Fatalf("expected the running embedding settings to be kept, got %q", model)
+	}
+
+	write(`{"datasets": `)
+	if _, err := api.ReloadConfig(); err == nil {
+		t.Fatalf("expected an error for an invalid config")
+	}
+	if d := api.server.Defaults(); d.Dataset != "docs_v2" || d.Search.TopK != 8 {
+		t.Fatalf("expected a failed reload to keep the defaults, got %+v", d)
+	}
+}
@@ -0,0 +1,265 @@
+package csvsearch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"yashubustudio/csv-search/internal/database"
+	"yashubustudio/csv-search/internal/server"
+)
+
+// defaultReplicaInterval is how often a replica checks its source when
+// ServeOptions.ReplicaInterval is zero.
+const defaultReplicaInterval = time.Minute
+
+// ReplicaStatus reports the synchronization of a read replica with the
+// snapshots published by the instance that ingests (see
+// ServeOptions.ReplicaSource).
+type ReplicaStatus struct {
+	Source   string `json:"source"`
+	Interval string `json:"interval,omitempty"`
+	// Version identifies the snapshot in use: a checksum of the downloaded
+	// file for URLs, the size and modification time for files.
+	Version   string     `json:"version,omitempty"`
+	LastCheck *time.Time `json:"last_check,omitempty"`
+	LastSync  *time.Time `json:"last_sync,omitempty"`
+	// Syncs counts the snapshots applied since the process started.
+	Syncs int `json:"syncs"`
+	// Error is the failure of the last check, if any; the previous snapshot
+	// stays in use.
+	Error string `json:"error,omitempty"`
+}
+
+// replica keeps the synchronization state of a Service.
+type replica struct {
+	// syncMu serializes SyncReplica.
+	syncMu sync.Mutex
+
+	mu     sync.Mutex
+	status ReplicaStatus
+	// validators make the next download of a URL conditional. They are
+	// those of the snapshot in use, so that a snapshot that failed to apply
+	// is downloaded again.
+	validators snapshotValidators
+}
+
+// snapshotValidators are the cache validators of a snapshot served over
+// HTTP.
+type snapshotValidators struct {
+	etag         string
+	lastModified string
+}
+
+// ReplicaStatus reports the state of the replica, or nil when the Service
+// has not synchronized from a source.
+func (s *Service) ReplicaStatus() *ReplicaStatus {
+	s.replica.mu.Lock()
+	defer s.replica.mu.Unlock()
+	if s.replica.status.Source == "" {
+		return nil
+	}
+	status := s.replica.status
+	return &status
+}
+
+// SyncReplica replaces the database contents with the snapshot at source, a
+// database file written by Backup (optionally gzip-compressed) or an http(s)
+// URL serving one, when it changed since the last call. The snapshot is
+// verified before it is applied in a single transaction, so searches see
+// either the previous or the new contents. It reports whether a new snapshot
+// was applied.
+func (s *Service) SyncReplica(ctx context.Context, source string) (bool, error) {
+	if err := s.ready(ctx); err != nil {
+		return false, err
+	}
+	source = strings.TrimSpace(source)
+	if source == "" {
+		return false, fmt.Errorf("replica source must not be empty")
+	}
+	s.replica.syncMu.Lock()
+	defer s.replica.syncMu.Unlock()
+
+	s.replica.mu.Lock()
+	if s.replica.status.Source != source {
+		s.replica.status = ReplicaStatus{Source: source, Interval: s.replica.status.Interval}
+		s.replica.validators = snapshotValidators{}
+	}
+	prev := s.replica.status.Version
+	s.replica.mu.Unlock()
+
+	path, version, validators, err := s.fetchSnapshot(ctx, source, prev)
+	if path != "" {
+		defer os.Remove(path)
+	}
+	if err == nil && path != "" {
+		err = s.applySnapshot(ctx, path)
+	}
+
+	now := time.Now().UTC()
+	s.replica.mu.Lock()
+	defer s.replica.mu.Unlock()
+	s.replica.status.LastCheck = &now
+	s.replica.status.Error = ""
+	if err != nil {
+		s.replica.status.Error = err.Error()
+		return false, err
+	}
+	if validators != (snapshotValidators{}) {
+		s.replica.validators = validators
+	}
+	if path == "" {
+		return false, nil
+	}
+	s.replica.status.Version = version
+	s.replica.status.LastSync = &now
+	s.replica.status.Syncs++
+	return true, nil
+}
+
+// fetchSnapshot copies the snapshot at source to a temporary file, which the
+// caller removes, and returns it with its version and, for URLs, its
+// validators, which the caller keeps once the snapshot is applied. The path
+// is empty when the version is still prev.
+func (s *Service) fetchSnapshot(ctx context.Context, source, prev string) (string, string, snapshotValidators, error) {
+	if !isURL(source) {
+		info, err := os.Stat(source)
+		if err != nil {
+			return "", "", snapshotValidators{}, fmt.Errorf("replica source: %w", err)
+		}
+		version := fmt.Sprintf("%d-%d", info.Size(), info.ModTime().UnixNano())
+		if version == prev {
+			return "", "", snapshotValidators{}, nil
+		}
+		in, err := os.Open(source)
+		if err != nil {
+			return "", "", snapshotValidators{}, fmt.Errorf("replica source: %w", err)
+		}
+		defer in.Close()
+		path, _, err := saveSnapshot(in)
+		return path, version, snapshotValidators{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return "", "", snapshotValidators{}, err
+	}
+	s.replica.mu.Lock()
+	if prev != "" {
+		if etag := s.replica.validators.etag; etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := s.replica.validators.lastModified; lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+	s.replica.mu.Unlock()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", "", snapshotValidators{}, fmt.Errorf("download %s: %w", source, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return "", "", snapshotValidators{}, nil
+	case http.StatusOK:
+	default:
+		return "", "", snapshotValidators{}, fmt.Errorf("download %s: %s", source, resp.Status)
+	}
+	path, sum, err := saveSnapshot(resp.Body)
+	if err != nil {
+		return "", "", snapshotValidators{}, fmt.Errorf("download %s: %w", source, err)
+	}
+	validators := snapshotValidators{etag: resp.Header.Get("ETag"), lastModified: resp.Header.Get("Last-Modified")}
+	version := "sha256:" + sum
+	if version == prev {
+		// The server ignored the conditional request; the validators are
+		// those of the snapshot in use.
+		os.Remove(path)
+		return "", "", validators, nil
+	}
+	return path, version, validators, nil
+}
+
+// saveSnapshot writes r to a temporary file and returns its path and SHA-256
+// checksum.
+func saveSnapshot(r io.Reader) (string, string, error) {
+	file, err := os.CreateTemp("", "csv-search-replica-*.db")
+	if err != nil {
+		return "", "", err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, hash), r); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", "", err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", "", err
+	}
+	return file.Name(), hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// applySnapshot verifies the snapshot at path and restores it.
+func (s *Service) applySnapshot(ctx context.Context, path string) error {
+	compressed, err := isGzip(path)
+	if err != nil {
+		return err
+	}
+	if compressed {
+		raw := path + ".raw"
+		defer os.Remove(raw)
+		if err := gunzipFile(path, raw); err != nil {
+			return fmt.Errorf("decompress snapshot: %w", err)
+		}
+		path = raw
+	}
+	if err := database.QuickCheck(ctx, path); err != nil {
+		return fmt.Errorf("verify snapshot: %w", err)
+	}
+	// OpenReader may have created the snapshot's WAL index.
+	defer os.Remove(path + "-shm")
+	defer os.Remove(path + "-wal")
+	return s.Restore(ctx, path)
+}
+
+// runReplica synchronizes the database from source every interval until ctx
+// is cancelled. synced is called after every applied snapshot.
+func (s *Service) runReplica(ctx context.Context, source string, interval time.Duration, synced func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		changed, err := s.SyncReplica(ctx, source)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			s.log.Error("replica sync failed", "source", source, "err", err)
+		case changed:
+			s.log.Info("replica synchronized", "source", source, "version", s.ReplicaStatus().Version)
+			if synced != nil {
+				synced()
+			}
+		}
+	}
+}
+
+func (s *Service) serverReplica() *server.ReplicaStatus {
+	status := s.ReplicaStatus()
+	if status == nil {
+		return nil
+	}
+	out := server.ReplicaStatus(*status)
+	return &out
+}
@@ -0,0 +1,248 @@
+package csvsearch
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"yashubustudio/csv-search/internal/config"
+	"yashubustudio/csv-search/internal/schedule"
+	"yashubustudio/csv-search/internal/server"
+)
+
+// scheduleRecheck bounds how long the scheduler sleeps, so that schedules
+// added or changed by a configuration reload are picked up.
+const scheduleRecheck = time.Minute
+
+// ScheduleStatus reports the scheduled re-ingestion of a dataset (see
+// DatasetConfig.Schedule in the configuration).
+type ScheduleStatus struct {
+	Dataset  string `json:"dataset"`
+	Table    string `json:"table"`
+	Schedule string `json:"schedule"`
+	CSV      string `json:"csv"`
+	// Running is set while an ingest started by the schedule is in progress.
+	Running bool `json:"running"`
+	// NextRun is nil when no scheduler is running (see StartServer).
+	NextRun *time.Time `json:"next_run,omitempty"`
+	// Overlaps counts the runs skipped because the previous one had not
+	// finished.
+	Overlaps int          `json:"overlaps,omitempty"`
+	LastRun  *ScheduleRun `json:"last_run,omitempty"`
+}
+
+// ScheduleRun is the outcome of a scheduled ingest: Status is "succeeded" or
+// "failed", with Error.
+type ScheduleRun struct {
+	Status     string    `json:"status"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Upserted   int       `json:"upserted"`
+	Skipped    int       `json:"skipped"`
+	Removed    int       `json:"removed,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// scheduler keeps the state of the scheduled ingests of a Service.
+type scheduler struct {
+	mu      sync.Mutex
+	entries map[string]*scheduleEntry
+}
+
+type scheduleEntry struct {
+	expr     string
+	csv      string
+	schedule *schedule.Schedule
+	next     time.Time
+	running  bool
+	overlaps int
+	last     *ScheduleRun
+}
+
+// Schedules reports every dataset of the configuration with a schedule,
+// ordered by name.
+func (s *Service) Schedules() []ScheduleStatus {
+	cfg := s.Config()
+	if cfg == nil {
+		return nil
+	}
+	s.scheduler.mu.Lock()
+	defer s.scheduler.mu.Unlock()
+	var out []ScheduleStatus
+	for _, name := range scheduledDatasets(cfg) {
+		ds := cfg.Datasets[name]
+		status := ScheduleStatus{
+			Dataset:  name,
+			Table:    resolveTable(name, ds, ""),
+			Schedule: strings.TrimSpace(ds.Schedule),
+			CSV:      strings.TrimSpace(ds.CSV),
+		}
+		if entry, ok := s.scheduler.entries[name]; ok {
+			status.Running = entry.running
+			status.Overlaps = entry.overlaps
+			if !entry.next.IsZero() {
+				next := entry.next
+				status.NextRun = &next
+			}
+			if entry.last != nil {
+				last := *entry.last
+				status.LastRun = &last
+			}
+		}
+		out = append(out, status)
+	}
+	return out
+}
+
+// runSchedules re-ingests the datasets that have a schedule whenever it is
+// due, until ctx is cancelled, and then waits for the running ingests. A run
+// that comes due while the previous one of its dataset is still in progress
+// is skipped. ingested is called after every successful run.
+func (s *Service) runSchedules(ctx context.Context, ingested func()) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		now := time.Now()
+		due, wake := s.scheduler.plan(s.Config(), now, s.log)
+		for _, name := range due {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.runScheduled(ctx, name, ingested)
+			}()
+		}
+		timer.Reset(min(wake.Sub(now), scheduleRecheck))
+	}
+}
+
+// plan brings the entries in line with cfg and returns the datasets due at
+// now, marking them running, and when the next run is due.
+func (sc *scheduler) plan(cfg *config.Config, now time.Time, log *slog.Logger) ([]string, time.Time) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.entries == nil {
+		sc.entries = make(map[string]*scheduleEntry)
+	}
+	names := scheduledDatasets(cfg)
+	configured := make(map[string]bool, len(names))
+	var due []string
+	wake := now.Add(scheduleRecheck)
+	for _, name := range names {
+		configured[name] = true
+		ds := cfg.Datasets[name]
+		expr, csv := strings.TrimSpace(ds.Schedule), strings.TrimSpace(ds.CSV)
+		entry, ok := sc.entries[name]
+		if !ok || entry.expr != expr || entry.csv != csv {
+			parsed, err := schedule.Parse(expr)
+			if err != nil {
+				log.Warn("ignoring invalid schedule", "dataset", name, "err", err)
+				delete(sc.entries, name)
+				continue
+			}
+			if entry == nil {
+				entry = &scheduleEntry{}
+				sc.entries[name] = entry
+			}
+			entry.expr, entry.csv, entry.schedule = expr, csv, parsed
+			entry.next = parsed.Next(now)
+		}
+		if entry.next.IsZero() {
+			continue
+		}
+		if !now.Before(entry.next) {
+			if entry.running {
+				entry.overlaps++
+				log.Warn("skipping scheduled ingest: the previous run has not finished", "dataset", name)
+			} else {
+				entry.running = true
+				due = append(due, name)
+			}
+			entry.next = entry.schedule.Next(now)
+		}
+		if !entry.next.IsZero() && entry.next.Before(wake) {
+			wake = entry.next
+		}
+	}
+	for name, entry := range sc.entries {
+		// A running ingest keeps its entry until it finishes.
+		if !configured[name] && !entry.running {
+			delete(sc.entries, name)
+		}
+	}
+	return due, wake
+}
+
+// runScheduled ingests the configured CSV of a dataset and records the
+// outcome.
+func (s *Service) runScheduled(ctx context.Context, name string, ingested func()) {
+	run := ScheduleRun{StartedAt: time.Now().UTC()}
+	s.log.Info("scheduled ingest started", "dataset", name)
+	summary, err := s.Ingest(ctx, IngestOptions{Dataset: name})
+	run.FinishedAt = time.Now().UTC()
+	if err != nil {
+		run.Status = "failed"
+		run.Error = err.Error()
+		s.log.Error("scheduled ingest failed", "dataset", name, "err", err)
+	} else {
+		run.Status = "succeeded"
+		run.Upserted, run.Skipped, run.Removed = summary.Upserted, summary.Skipped, summary.Removed
+		s.log.Info("scheduled ingest finished", "dataset", name, "upserted", summary.Upserted, "skipped", summary.Skipped)
+	}
+
+	s.scheduler.mu.Lock()
+	if entry, ok := s.scheduler.entries[name]; ok {
+		entry.running = false
+		entry.last = &run
+	}
+	s.scheduler.mu.Unlock()
+	if err == nil && ingested != nil {
+		ingested()
+	}
+}
+
+// scheduledDatasets returns the names of the datasets of cfg with a
+// schedule, sorted.
+func scheduledDatasets(cfg *config.Config) []string {
+	if cfg == nil {
+		return nil
+	}
+	var names []string
+	for name, ds := range cfg.Datasets {
+		if strings.TrimSpace(ds.Schedule) != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Service) serverSchedules() []server.ScheduleStatus {
+	schedules := s.Schedules()
+	out := make([]server.ScheduleStatus, len(schedules))
+	for i, st := range schedules {
+		out[i] = server.ScheduleStatus{
+			Dataset:  st.Dataset,
+			Table:    st.Table,
+			Schedule: st.Schedule,
+			CSV:      st.CSV,
+			Running:  st.Running,
+			NextRun:  st.NextRun,
+			Overlaps: st.Overlaps,
+		}
+		if st.LastRun != nil {
+			last := server.ScheduleRun(*st.LastRun)
+			out[i].LastRun = &last
+		}
+	}
+	return out
+}
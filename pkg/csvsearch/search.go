@@ -4,16 +4,67 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
+	"yashubustudio/csv-search/internal/config"
 	intsearch "yashubustudio/csv-search/internal/search"
 )
 
-// Filter represents a metadata equality condition applied to search results.
+// Filter represents a metadata condition applied to search results. Op is
+// "=" (the default when empty), "!=", "<", "<=", ">", ">=" or the name of an
+// operator added with RegisterFilterOperator. Range
+// operators compare numerically when Value is a number and as text
+// otherwise. Filters are evaluated by SQLite, so only the vectors of
+// matching records are read; see DatasetConfig index_fields for indexing
+// frequently filtered fields.
 type Filter struct {
 	Field string
+	Op    string
 	Value string
 }
 
+// ParseFilter parses a filter expression such as "category=books" or
+// "price>=100". The value is kept as written.
+func ParseFilter(expr string) (Filter, error) {
+	f, err := intsearch.ParseFilter(expr)
+	return Filter(f), err
+}
+
+// Near restricts a search to the records that have coordinates and reports
+// their distance from a point in Result.DistanceKm.
+type Near struct {
+	Lat float64
+	Lng float64
+	// RadiusKm drops records farther than this from the point; zero keeps
+	// every record with coordinates.
+	RadiusKm float64
+	// Weight, when positive, adds Weight/(1+distance_km) to the score so that
+	// nearby records rank higher.
+	Weight float64
+	// GeoWeight, between 0 and 1, blends similarity and proximity into a
+	// single score: (1-GeoWeight)*score + GeoWeight*proximity, where
+	// proximity is 1-distance/RadiusKm within a radius and 1/(1+distance_km)
+	// without one. Weight is added after the blend, so without a radius the
+	// two count the same 1/(1+distance_km) term; set one or the other.
+	GeoWeight float64
+	// SortByDistance orders the results closest first instead of by score.
+	// Searches without a query are always ordered by distance.
+	SortByDistance bool
+}
+
+// ParsePoint parses a point written as "lat,lng", e.g. for Near.
+func ParsePoint(expr string) (lat, lng float64, err error) {
+	return intsearch.ParsePoint(expr)
+}
+
+func (n *Near) toSearch() *intsearch.Near {
+	if n == nil {
+		return nil
+	}
+	near := intsearch.Near(*n)
+	return &near
+}
+
 // Result mirrors the JSON structure returned by the HTTP API and search
 // subcommand.
 type Result struct {
@@ -23,6 +74,11 @@ type Result struct {
 	Score   float64           `json:"score"`
 	Lat     *float64          `json:"lat,omitempty"`
 	Lng     *float64          `json:"lng,omitempty"`
+	// DistanceKm is the distance from the point of SearchOptions.Near.
+	DistanceKm *float64 `json:"distance_km,omitempty"`
+	// Vector is the stored embedding, set when the search asked for it with
+	// IncludeVectors.
+	Vector []float32 `json:"vector,omitempty"`
 }
 
 // SearchOptions describe how to run a semantic search request against the
@@ -33,10 +89,56 @@ type SearchOptions struct {
 	Table   string
 	TopK    int
 	Filters []Filter
+	// IDs, when not empty, restricts the search to the records with these
+	// ids, e.g. the results of a previous search, so that a follow-up query
+	// only re-ranks within them. Ids that are not in the dataset are ignored.
+	IDs []string
+	// SparseWeight blends the bge-m3 lexical score into the cosine similarity
+	// when positive. Zero falls back to search.sparse_weight from the config;
+	// a negative value disables hybrid scoring.
+	SparseWeight float64
+	// Near, when set, keeps the records with coordinates within its radius
+	// and ranks or sorts them by their distance from its point.
+	Near *Near
+	// TieBreak orders results with equal scores (or distances): "id"
+	// ascending (the default when empty), "updated" for the most recently
+	// ingested records first, or "ingestion" for the order in which the
+	// records were first ingested. Clients paging through results by
+	// raising TopK get the same order on every call either way.
+	TieBreak string
+	// GroupBy collapses the results to the best GroupSize (1 when zero) per
+	// value of that field, e.g. one result per store chain, so that TopK
+	// results cover as many values as possible. Records without the field
+	// are not collapsed. It needs a query.
+	GroupBy   string
+	GroupSize int
+	// ScoreNormalization rescales the scores of the returned results: "raw"
+	// as computed, "minmax" to [0, 1] over the result set, or "softmax" so
+	// that they add up to 1. Empty falls back to search.score_normalization
+	// from the config. search.min_score applies to the raw scores.
+	ScoreNormalization string
+	// Scorer rescores the results with the scorer registered under that name
+	// (see RegisterScorer) before they are ordered. It needs a query.
+	Scorer string
+	// Source labels the search in the query log ("library" when empty).
+	Source string
+	// IncludeVectors returns the stored embedding of every result, e.g. for
+	// clustering or re-ranking without another query.
+	IncludeVectors bool
+	// Version searches a named version of the dataset (see
+	// IngestOptions.Version) instead of its live contents.
+	Version string
+	// Model encodes the query with the encoder registered under that name
+	// (see EncoderOptions.Models) instead of the active one. The stored
+	// embeddings of the dataset must all come from that model; otherwise the
+	// search fails with ErrModelMismatch.
+	Model string
 }
 
 // Search encodes the query with the ONNX encoder and performs cosine similarity
-// ranking against the stored vectors.
+// ranking against the stored vectors. Without a query it returns the records
+// passing opts.Filters in insertion order, or closest first with opts.Near,
+// which needs no encoder.
 func (s *Service) Search(ctx context.Context, opts SearchOptions) ([]Result, error) {
 	if ctx == nil {
 		return nil, fmt.Errorf("context must not be nil")
@@ -44,47 +146,287 @@ func (s *Service) Search(ctx context.Context, opts SearchOptions) ([]Result, err
 	if s.db == nil {
 		return nil, fmt.Errorf("database handle is nil")
 	}
-	if strings.TrimSpace(opts.Query) == "" {
-		return nil, fmt.Errorf("query is required")
+	if strings.TrimSpace(opts.Query) == "" && len(opts.Filters) == 0 && len(opts.IDs) == 0 && opts.Near == nil {
+		return nil, fmt.Errorf("query, filter, ids or near point is required")
+	}
+	if err := intsearch.ValidateTieBreak(opts.TieBreak); err != nil {
+		return nil, err
+	}
+	if err := validateGroup(opts.Query, opts.GroupBy, opts.GroupSize); err != nil {
+		return nil, err
+	}
+	if err := intsearch.ValidateScoreNormalization(opts.ScoreNormalization); err != nil {
+		return nil, err
 	}
 
 	if err := s.ensureDatabase(ctx); err != nil {
 		return nil, err
 	}
 
-	datasetName, dataset, _ := resolveDataset(s.cfg, opts.Dataset)
-	table := resolveTable(datasetName, dataset, opts.Table)
-	limit := firstPositive(opts.TopK, cfgSearchTopK(s.cfg), 10)
+	plan := planSearch(s.Config(), opts.Dataset, opts.Table, opts.TopK, opts.SparseWeight)
+	plan.normalization = firstNonEmpty(strings.TrimSpace(opts.ScoreNormalization), plan.normalization)
+	var err error
+	if plan.table, err = s.versionTable(ctx, plan.table, opts.Version); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	key := resultCacheKey("search", opts, plan)
+	if results, ok := s.cachedResults(key); ok {
+		s.logSearch(opts, plan.table, plan.limit, time.Since(start), results, nil)
+		return results, nil
+	}
+	results, err := s.hookedSearch(ctx, &opts, &plan, nil)
+	s.logSearch(opts, plan.table, plan.limit, time.Since(start), results, err)
+	if err == nil {
+		s.cacheResults(key, results)
+	}
+	return results, err
+}
+
+// hookedSearch runs a search through the registered hooks. vec, when
+// non-nil, is the query embedding computed by the caller for the query as
+// given; it is dropped when a hook rewrites the query.
+func (s *Service) hookedSearch(ctx context.Context, opts *SearchOptions, plan *searchPlan, vec []float32) (results []Result, err error) {
+	var timings intsearch.Timings
+	defer func(start time.Time) {
+		s.observeSearch("search", opts.Source, plan.table, &timings, time.Since(start), err)
+	}(time.Now())
 
-	enc, err := s.ensureEncoder()
+	query := opts.Query
+	if err := s.preSearch(ctx, opts, plan); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(opts.Query) == "" && len(opts.Filters) == 0 && len(opts.IDs) == 0 && opts.Near == nil {
+		return nil, fmt.Errorf("query, filter, ids or near point is required")
+	}
+	if opts.Query != query {
+		vec = nil
+	}
+	results, err = s.search(ctx, *opts, *plan, vec, &timings)
 	if err != nil {
 		return nil, err
 	}
+	return s.postSearch(ctx, *opts, *plan, results)
+}
 
-	filters := make([]intsearch.Filter, 0, len(opts.Filters))
-	for _, f := range opts.Filters {
-		field := strings.TrimSpace(f.Field)
-		if field == "" {
-			continue
+// searchPlan is a search resolved against the configuration.
+type searchPlan struct {
+	table        string
+	limit        int
+	sparseWeight float64
+	metric       string
+	minScore     float64
+	precision    int
+	// normalization is the score normalization of the dataset, or the one
+	// the search asked for.
+	normalization string
+	strict        bool
+	boosts        map[string]float64
+	dicts         config.Dictionaries
+	languages     map[string]intsearch.Language
+}
+
+func (p searchPlan) hybrid() bool { return p.sparseWeight > 0 }
+
+// planSearch resolves the table and settings of a search on dataset. The
+// given topK and sparse weight take precedence over the dataset's search
+// settings, which take precedence over the global ones.
+func planSearch(cfg *config.Config, dataset, table string, topK int, sparseWeight float64) searchPlan {
+	datasetName, datasetCfg, _ := resolveDataset(cfg, dataset)
+	settings := cfg.SearchFor(datasetCfg)
+	if sparseWeight == 0 {
+		sparseWeight = settings.SparseWeight
+	}
+	return searchPlan{
+		table:         resolveTable(datasetName, datasetCfg, table),
+		limit:         firstPositive(topK, settings.DefaultTopK, 10),
+		sparseWeight:  sparseWeight,
+		metric:        settings.Metric,
+		minScore:      settings.MinScore,
+		precision:     settings.ScorePrecision,
+		normalization: settings.ScoreNormalization,
+		strict:        settings.StrictFilters,
+		boosts:        settings.FieldBoosts,
+		dicts:         cfg.DictionariesFor(datasetName),
+		languages:     datasetCfg.Languages,
+	}
+}
+
+// search runs the query of opts as planned. vec, when non-nil, is the query
+// embedding computed by the caller.
+func (s *Service) search(ctx context.Context, opts SearchOptions, plan searchPlan, vec []float32, timings *intsearch.Timings) ([]Result, error) {
+	if err := s.checkFilters(ctx, plan, opts.Filters); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(opts.Query) == "" {
+		results, err := s.engine.FilterSearch(ctx, intsearch.FilterOptions{
+			Dataset:        plan.table,
+			TopK:           plan.limit,
+			Filters:        toSearchFilters(opts.Filters),
+			IDs:            opts.IDs,
+			Near:           opts.Near.toSearch(),
+			IncludeVectors: opts.IncludeVectors,
+			Logger:         s.log,
+		})
+		if err != nil {
+			return nil, err
 		}
-		filters = append(filters, intsearch.Filter{Field: field, Value: f.Value})
+		return convertResults(results), nil
 	}
 
-	results, err := intsearch.VectorSearch(ctx, s.db, enc, table, opts.Query, limit, filters)
+	enc, release, err := s.queryEncoder(ctx, plan.table, opts.Model)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
+
+	results, err := s.engine.VectorSearch(ctx, enc, intsearch.Options{
+		Dataset:            plan.table,
+		Query:              opts.Query,
+		TopK:               plan.limit,
+		Filters:            toSearchFilters(opts.Filters),
+		IDs:                opts.IDs,
+		SparseWeight:       plan.sparseWeight,
+		Metric:             plan.metric,
+		MinScore:           plan.minScore,
+		ScorePrecision:     plan.precision,
+		ScoreNormalization: plan.normalization,
+		TieBreak:           opts.TieBreak,
+		GroupBy:            opts.GroupBy,
+		GroupSize:          opts.GroupSize,
+		FieldBoosts:        plan.boosts,
+		TermBoosts:         plan.dicts.TermBoosts,
+		Scorer:             opts.Scorer,
+		Languages:          plan.languages,
+		Near:               opts.Near.toSearch(),
+		Vector:             vec,
+		Timings:            timings,
+		IncludeVectors:     opts.IncludeVectors,
+		Logger:             s.log,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return convertResults(results), nil
+}
+
+// validateGroup checks the grouping of a search for query: a group size
+// needs a field and grouping needs a query to score the results by.
+func validateGroup(query, field string, size int) error {
+	if err := intsearch.ValidateGroup(field, size); err != nil {
+		return err
+	}
+	if strings.TrimSpace(field) != "" && strings.TrimSpace(query) == "" {
+		return fmt.Errorf("group by requires a query")
+	}
+	return nil
+}
+
+// SimilarOptions describe a similar-by-ID search.
+type SimilarOptions struct {
+	// ID is the record whose stored embedding is used as the query; it is
+	// not included in the results.
+	ID      string
+	Dataset string
+	Table   string
+	TopK    int
+	Filters []Filter
+	// SparseWeight behaves like SearchOptions.SparseWeight, using the
+	// record's stored lexical weights.
+	SparseWeight float64
+	// TieBreak and IncludeVectors behave like those of SearchOptions.
+	TieBreak       string
+	IncludeVectors bool
+}
+
+// Similar returns the records closest to an existing record by comparing
+// stored embeddings, so no encoder is needed. It returns an error wrapping
+// ErrNotFound when the record has no embedding.
+func (s *Service) Similar(ctx context.Context, opts SimilarOptions) ([]Result, error) {
+	if err := s.ready(ctx); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(opts.ID) == "" {
+		return nil, fmt.Errorf("id is required")
+	}
+	if err := s.ensureDatabase(ctx); err != nil {
+		return nil, err
+	}
+
+	plan := planSearch(s.Config(), opts.Dataset, opts.Table, opts.TopK, opts.SparseWeight)
+	start := time.Now()
+	results, err := s.similar(ctx, opts, &plan)
+	s.observeSearch("similar", "", plan.table, nil, time.Since(start), err)
+	return results, err
+}
+
+func (s *Service) similar(ctx context.Context, opts SimilarOptions, plan *searchPlan) ([]Result, error) {
+	hooked := SearchOptions{Filters: opts.Filters}
+	if err := s.preSearch(ctx, &hooked, plan); err != nil {
+		return nil, err
+	}
+	if err := s.checkFilters(ctx, *plan, hooked.Filters); err != nil {
+		return nil, err
+	}
+	results, err := s.engine.Similar(ctx, intsearch.SimilarOptions{
+		Dataset:            plan.table,
+		ID:                 opts.ID,
+		TopK:               plan.limit,
+		Filters:            toSearchFilters(hooked.Filters),
+		SparseWeight:       plan.sparseWeight,
+		Metric:             plan.metric,
+		MinScore:           plan.minScore,
+		ScorePrecision:     plan.precision,
+		ScoreNormalization: plan.normalization,
+		TieBreak:           opts.TieBreak,
+		IncludeVectors:     opts.IncludeVectors,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.postSearch(ctx, hooked, *plan, convertResults(results))
+}
+
+// ErrUnknownField is returned by searches of a dataset with strict_filters
+// when a filter names a field that none of its records has. The error message
+// lists the valid fields.
+var ErrUnknownField = intsearch.ErrUnknownField
+
+// checkFilters rejects filters on fields the dataset does not have when the
+// plan is strict, with an error wrapping ErrUnknownField.
+func (s *Service) checkFilters(ctx context.Context, plan searchPlan, filters []Filter) error {
+	if !plan.strict || len(filters) == 0 {
+		return nil
+	}
+	return s.engine.CheckFilterFields(ctx, plan.table, toSearchFilters(filters))
+}
+
+func toSearchFilters(in []Filter) []intsearch.Filter {
+	filters := make([]intsearch.Filter, 0, len(in))
+	for _, f := range in {
+		field := strings.TrimSpace(f.Field)
+		if field == "" {
+			continue
+		}
+		filters = append(filters, intsearch.Filter{Field: field, Op: f.Op, Value: f.Value})
+	}
+	return filters
+}
 
+func convertResults(results []intsearch.Result) []Result {
 	converted := make([]Result, len(results))
 	for i, r := range results {
 		converted[i] = Result{
-			Dataset: r.Dataset,
-			ID:      r.ID,
-			Fields:  r.Fields,
-			Score:   r.Score,
-			Lat:     r.Lat,
-			Lng:     r.Lng,
+			Dataset:    r.Dataset,
+			ID:         r.ID,
+			Fields:     r.Fields,
+			Score:      r.Score,
+			Lat:        r.Lat,
+			Lng:        r.Lng,
+			DistanceKm: r.DistanceKm,
+			Vector:     r.Vector,
 		}
 	}
-	return converted, nil
+	return converted
 }
@@ -0,0 +1,1448 @@
+package csvsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestService returns a Service on a temporary database that encodes
+// with fakeEmbedder, applies opts after those defaults and holds rows, a CSV
+// with its header, as the dataset "docs": title is its text column, and lat
+// and lng its coordinates when the header has them. The Service is closed
+// when the test ends.
+func newTestService(t *testing.T, rows string, opts ...Option) *Service {
+	t.Helper()
+	dir := t.TempDir()
+	defaults := []Option{WithDatabasePath(filepath.Join(dir, "app.db")), WithEmbedder(fakeEmbedder{dim: 2})}
+	svc, err := New(append(defaults, opts...)...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { svc.Close() })
+	if rows == "" {
+		return svc
+	}
+	csvPath := filepath.Join(dir, "docs.csv")
+	if err := os.WriteFile(csvPath, []byte(rows), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	ingest := IngestOptions{Dataset: "docs", CSVPath: csvPath, TextColumns: []string{"title"}}
+	header, _, _ := strings.Cut(rows, "\n")
+	if columns := strings.Split(header, ","); slices.Contains(columns, "lat") && slices.Contains(columns, "lng") {
+		ingest.LatitudeColumn, ingest.LongitudeColumn = "lat", "lng"
+	}
+	if _, err := svc.Ingest(context.Background(), ingest); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	return svc
+}
+
+func TestSimilar(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t, "id,title,kind\n1,hello,a\n2,hi,a\n3,hellos,b\n4,x,a\n")
+
+	results, err := svc.Similar(ctx, SimilarOptions{Dataset: "docs", ID: "1", TopK: 2})
+	if err != nil {
+		t.Fatalf("Similar: %v", err)
+	}
+	if len(results) != 2 || results[0].ID != "3" || results[1].ID != "2" {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+
+	results, err = svc.Similar(ctx, SimilarOptions{Dataset: "docs", ID: "1", Filters: []Filter{{Field: "kind", Value: "a"}}})
+	if err != nil {
+		t.Fatalf("Similar with filter: %v", err)
+	}
+	if len(results) != 2 || results[0].ID != "2" {
+		t.Fatalf("unexpected filtered results: %+v", results)
+	}
+
+	if _, err := svc.Similar(ctx, SimilarOptions{Dataset: "docs", ID: "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestIncludeVectors(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t, "id,title\n1,hello\n2,hi\n")
+
+	results, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "hello"})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) != 2 || results[0].Vector != nil {
+		t.Fatalf("expected no vectors by default, got %+v", results)
+	}
+
+	results, err = svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "hello", IncludeVectors: true})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) != 2 || results[0].ID != "1" || !reflect.DeepEqual(results[0].Vector, []float32{5, 1}) {
+		t.Fatalf("expected the stored vectors, got %+v", results)
+	}
+
+	results, err = svc.Similar(ctx, SimilarOptions{Dataset: "docs", ID: "1", IncludeVectors: true})
+	if err != nil {
+		t.Fatalf("Similar: %v", err)
+	}
+	if len(results) != 1 || !reflect.DeepEqual(results[0].Vector, []float32{2, 1}) {
+		t.Fatalf("expected the stored vector of the neighbour, got %+v", results)
+	}
+}
+
+func TestKeywordSearch(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t, "id,title,kind\n1,tokyo tower,a\n2,tokyo skytree tokyo,b\n3,osaka castle,a\n")
+
+	ids := func(results []Result) []string {
+		out := make([]string, len(results))
+		for i, r := range results {
+			out[i] = r.ID
+		}
+		return out
+	}
+	for _, tc := range []struct {
+		opts KeywordSearchOptions
+		want []string
+	}{
+		{KeywordSearchOptions{Query: "Tokyo"}, []string{"2", "1"}},
+		{KeywordSearchOptions{Query: "tokyo tower"}, []string{"1"}},
+		{KeywordSearchOptions{Query: "tokyo", Filters: []Filter{{Field: "kind", Value: "a"}}}, []string{"1"}},
+		{KeywordSearchOptions{Query: "tokyo", Filters: []Filter{{Field: "kind", Value: "a"}, {Field: "missing", Value: ""}}}, []string{}},
+		{KeywordSearchOptions{Query: "tokyo", TopK: 1}, []string{"2"}},
+		// Operators are matched as plain terms.
+		{KeywordSearchOptions{Query: `tokyo OR "osaka`}, []string{}},
+	} {
+		tc.opts.Dataset = "docs"
+		results, err := svc.KeywordSearch(ctx, tc.opts)
+		if err != nil {
+			t.Fatalf("KeywordSearch(%q): %v", tc.opts.Query, err)
+		}
+		if got := ids(results); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("KeywordSearch(%q): got %v, want %v", tc.opts.Query, got, tc.want)
+		}
+	}
+
+	results, err := svc.KeywordSearch(ctx, KeywordSearchOptions{Dataset: "docs", Query: "castle", IncludeVectors: true})
+	if err != nil {
+		t.Fatalf("KeywordSearch: %v", err)
+	}
+	if len(results) != 1 || results[0].Score <= 0 || results[0].Fields["title"] != "osaka castle" || len(results[0].Vector) != 2 {
+		t.Fatalf("unexpected result: %+v", results)
+	}
+
+	for query, want := range map[string]string{
+		"tokyo castle":  "",
+		"Tokoy  castel": "tokyo castle",
+		"skytre towers": "skytree tower",
+		"osk tokyo":     "",
+		"tokyo 東京":      "",
+	} {
+		got, err := svc.Suggest(ctx, SuggestOptions{Dataset: "docs", Query: query})
+		if err != nil || got != want {
+			t.Fatalf("Suggest(%q) = %q (%v), want %q", query, got, err, want)
+		}
+	}
+}
+
+func TestSearchBatch(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t, "id,title,kind\n1,hello,a\n2,hi,a\n3,hellos,b\n")
+
+	queries, err := ParseBatchQueries(strings.NewReader("hello\n\n{\"id\":\"q2\",\"query\":\"hellos\",\"topk\":1,\"filters\":{\"kind\":\"a\"}}\nhi\n"))
+	if err != nil {
+		t.Fatalf("ParseBatchQueries: %v", err)
+	}
+	if len(queries) != 3 || queries[1].ID != "q2" || queries[1].Filters["kind"] != "a" {
+		t.Fatalf("unexpected queries: %+v", queries)
+	}
+	if _, err := ParseBatchQueries(strings.NewReader("ok\n{\"query\":\"x\",\"bogus\":1}\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected a line 2 error, got %v", err)
+	}
+
+	var got []BatchResult
+	summary, err := svc.SearchBatch(ctx, BatchSearchOptions{Queries: queries, Dataset: "docs", TopK: 2, BatchSize: 2}, func(r BatchResult) error {
+		got = append(got, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("SearchBatch: %v", err)
+	}
+	if summary.Queries != 3 || summary.Failed != 0 || len(got) != 3 {
+		t.Fatalf("unexpected summary %+v with %d results", summary, len(got))
+	}
+	if got[1].ID != "q2" || len(got[1].Results) != 1 || got[1].Results[0].Fields["kind"] != "a" {
+		t.Fatalf("per-query topk and filters not applied: %+v", got[1])
+	}
+	for i, q := range []string{"hello", "hi"} {
+		want, err := svc.Search(ctx, SearchOptions{Query: q, Dataset: "docs", TopK: 2})
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		r := got[2*i]
+		if r.Query != q || len(r.Results) != len(want) || r.Results[0].ID != want[0].ID || r.Results[0].Score != want[0].Score {
+			t.Fatalf("batch result for %q differs from Search: %+v vs %+v", q, r.Results, want)
+		}
+	}
+
+	if _, err := svc.SearchBatch(ctx, BatchSearchOptions{Queries: []BatchQuery{{Query: " "}}}, func(BatchResult) error { return nil }); err == nil {
+		t.Fatalf("expected an error for an empty query")
+	}
+}
+
+func TestPerDatasetSearchSettings(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "docs.csv")
+	if err := os.WriteFile(csvPath, []byte("id,title\n1,a\n2,bbb\n3,bbbbbbbbbb\n"), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	cfgPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(cfgPath, []byte(`{
+  "database": {"path": "app.db"},
+  "datasets": {
+    "docs": {"search": {"default_topk": 1, "metric": "dot", "min_score": 5}},
+    "plain": {}
+  },
+  "search": {"default_topk": 3}
+}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	svc, err := NewService(ServiceOptions{
+		Config:  ConfigReference{Path: cfgPath, Required: true},
+		Encoder: EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+	for _, dataset := range []string{"docs", "plain"} {
+		if _, err := svc.Ingest(ctx, IngestOptions{Dataset: dataset, CSVPath: csvPath, TextColumns: []string{"title"}}); err != nil {
+			t.Fatalf("Ingest %s: %v", dataset, err)
+		}
+	}
+
+	// Global settings: cosine similarity and three results.
+	results, err := svc.Search(ctx, SearchOptions{Query: "bb", Dataset: "plain"})
+	if err != nil {
+		t.Fatalf("Search plain: %v", err)
+	}
+	if len(results) != 3 || results[0].ID != "2" {
+		t.Fatalf("unexpected plain results: %+v", results)
+	}
+
+	// Dataset settings: dot product, one result by default.
+	results, err = svc.Search(ctx, SearchOptions{Query: "bb", Dataset: "docs"})
+	if err != nil {
+		t.Fatalf("Search docs: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "3" || results[0].Score != 21 {
+		t.Fatalf("unexpected docs results: %+v", results)
+	}
+	// An explicit topK wins; min_score still drops "a" (dot product 3).
+	results, err = svc.Search(ctx, SearchOptions{Query: "bb", Dataset: "docs", TopK: 5})
+	if err != nil {
+		t.Fatalf("Search docs topk: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected min_score to drop a result, got %+v", results)
+	}
+
+	defaults := svc.serverDefaults(ServeOptions{TopK: 7})
+	if got := defaults.Datasets["docs"]; got.Metric != "dot" || got.MinScore != 5 || got.TopK != 0 {
+		t.Fatalf("unexpected server overrides for docs (the --topk option should win): %+v", got)
+	}
+	if _, ok := defaults.Datasets["plain"]; ok || defaults.Search.TopK != 7 || defaults.Search.Metric != "" {
+		t.Fatalf("unexpected server defaults: %+v", defaults)
+	}
+}
+
+func TestSearchHooks(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "docs.csv")
+	if err := os.WriteFile(csvPath, []byte("id,title,kind,owner\n1,hello,a,ann\n2,hi,a,bob\n3,hellos,b,cy\n4,draft,a,dee\n"), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+
+	svc, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "app.db")},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+
+	svc.AddIngestRowHook(func(_ context.Context, row *IngestRow) (bool, error) {
+		row.Metadata["source"] = row.Dataset
+		return row.ID != "4", nil
+	})
+	summary, err := svc.Ingest(ctx, IngestOptions{Dataset: "docs", CSVPath: csvPath, TextColumns: []string{"title"}})
+	if err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	if summary.Upserted != 3 || summary.Dropped != 1 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	svc.AddPreSearchHook(func(_ context.Context, req *SearchRequest) error {
+		if req.Query == "forbidden" {
+			return errors.New("query rejected")
+		}
+		req.Filters = append(req.Filters, Filter{Field: "kind", Value: "a"})
+		return nil
+	})
+	svc.AddPostSearchHook(func(_ context.Context, _ SearchRequest, results []Result) ([]Result, error) {
+		for _, r := range results {
+			delete(r.Fields, "owner")
+		}
+		return results, nil
+	})
+
+	results, err := svc.Search(ctx, SearchOptions{Query: "hello", Dataset: "docs"})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) != 2 || results[0].ID != "1" || results[1].ID != "2" {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	for _, r := range results {
+		if _, ok := r.Fields["owner"]; ok || r.Fields["source"] != "docs" {
+			t.Fatalf("unexpected fields: %+v", r.Fields)
+		}
+	}
+
+	if _, err := svc.Search(ctx, SearchOptions{Query: "forbidden", Dataset: "docs"}); err == nil || !strings.Contains(err.Error(), "query rejected") {
+		t.Fatalf("expected the pre-search hook error, got %v", err)
+	}
+
+	similar, err := svc.Similar(ctx, SimilarOptions{Dataset: "docs", ID: "1"})
+	if err != nil {
+		t.Fatalf("Similar: %v", err)
+	}
+	if len(similar) != 1 || similar[0].ID != "2" || similar[0].Fields["owner"] != "" {
+		t.Fatalf("unexpected similar results: %+v", similar)
+	}
+}
+
+func TestServiceLogger(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "docs.csv")
+	if err := os.WriteFile(csvPath, []byte("id,title\n1,hello\n"), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+
+	var buf bytes.Buffer
+	svc, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "app.db")},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+		Logger:   slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+
+	if _, err := svc.Ingest(ctx, IngestOptions{Dataset: "docs", CSVPath: csvPath}); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	if _, err := svc.Search(ctx, SearchOptions{Query: "hello", Dataset: "docs"}); err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	for _, msg := range []string{`msg="ingest row upserted"`, `msg="vector search"`} {
+		if !strings.Contains(buf.String(), msg) {
+			t.Fatalf("expected %s in the injected logger, got %q", msg, buf.String())
+		}
+	}
+}
+
+type recordedMetrics struct {
+	mu     sync.Mutex
+	counts map[string]float64
+	times  []string
+}
+
+func (m *recordedMetrics) Count(name string, delta float64, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counts[name+"/"+labels["result"]] += delta
+}
+
+func (m *recordedMetrics) Time(name string, _ time.Duration, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.times = append(m.times, strings.TrimRight(name+" "+labels["dataset"]+" "+labels["op"]+" "+labels["status"], " "))
+}
+
+func TestServiceMetricsCallbacks(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "docs.csv")
+	if err := os.WriteFile(csvPath, []byte("id,title\n1,hello\n2,hi\n"), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+
+	rec := &recordedMetrics{counts: make(map[string]float64)}
+	svc, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "app.db")},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+		Metrics:  rec,
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+
+	if _, err := svc.Ingest(ctx, IngestOptions{Dataset: "docs", CSVPath: csvPath}); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	if _, err := svc.Search(ctx, SearchOptions{Query: "hello", Dataset: "docs"}); err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if _, err := svc.Similar(ctx, SimilarOptions{Dataset: "docs", ID: "missing"}); err == nil {
+		t.Fatalf("expected Similar to fail for a missing record")
+	}
+
+	if rec.counts[MetricIngestRows+"/upserted"] != 2 || rec.counts[MetricIngestRows+"/skipped"] != 0 {
+		t.Fatalf("unexpected counters: %v", rec.counts)
+	}
+	want := []string{
+		MetricIngestBatch + " docs",
+		MetricEncode + " docs",
+		MetricScan + " docs",
+		MetricRequest + " docs search ok",
+		MetricRequest + " docs similar error",
+	}
+	if strings.Join(rec.times, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("timers = %q, want %q", rec.times, want)
+	}
+}
+
+func TestFilterOperators(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(cfgPath, []byte(`{"datasets": {"items": {"text_columns": ["name"], "index_fields": ["category"]}}}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	csvPath := filepath.Join(dir, "items.csv")
+	csv := "id,name,category,price\n1,pen,office,120\n2,ink,office,80\n3,mug,kitchen,1500\n4,cup,kitchen,n/a\n"
+	if err := os.WriteFile(csvPath, []byte(csv), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	svc, err := NewService(ServiceOptions{
+		Config:   ConfigReference{Path: cfgPath, Required: true},
+		Database: DatabaseOptions{Path: filepath.Join(dir, "app.db")},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+	if _, err := svc.Ingest(ctx, IngestOptions{Dataset: "items", CSVPath: csvPath}); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+
+	parse := func(exprs ...string) []Filter {
+		filters := make([]Filter, len(exprs))
+		for i, expr := range exprs {
+			if filters[i], err = ParseFilter(expr); err != nil {
+				t.Fatalf("ParseFilter(%q): %v", expr, err)
+			}
+		}
+		return filters
+	}
+	for _, tc := range []struct {
+		filters []string
+		want    []string
+	}{
+		{[]string{"category=office"}, []string{"1", "2"}},
+		{[]string{"category!=office"}, []string{"3", "4"}},
+		// Numeric values compare as numbers, not as text ("80" > "120").
+		{[]string{"price>=100"}, []string{"1", "3"}},
+		{[]string{"price<100"}, []string{"2", "4"}},
+		{[]string{"category=kitchen", "price>1000"}, []string{"3"}},
+		{[]string{"category<l"}, []string{"3", "4"}},
+		{[]string{"missing!=x"}, nil},
+	} {
+		ids, err := svc.FindIDs(ctx, "items", parse(tc.filters...))
+		if err != nil {
+			t.Fatalf("FindIDs(%v): %v", tc.filters, err)
+		}
+		if !reflect.DeepEqual(ids, tc.want) {
+			t.Fatalf("FindIDs(%v): got %v, want %v", tc.filters, ids, tc.want)
+		}
+		results, err := svc.Search(ctx, SearchOptions{Dataset: "items", Query: "pen", Filters: parse(tc.filters...)})
+		if err != nil {
+			t.Fatalf("Search(%v): %v", tc.filters, err)
+		}
+		if len(results) != len(tc.want) {
+			t.Fatalf("Search(%v): got %d results, want %d", tc.filters, len(results), len(tc.want))
+		}
+	}
+
+	for _, expr := range []string{"category", "=x", "price!100"} {
+		if _, err := ParseFilter(expr); err == nil {
+			t.Fatalf("ParseFilter(%q): expected an error", expr)
+		}
+	}
+	if _, err := svc.FindIDs(ctx, "items", []Filter{{Field: `a"b`, Value: "x"}}); err == nil {
+		t.Fatalf("expected an error for a field with a double quote")
+	}
+
+	var plan strings.Builder
+	rows, err := svc.DB().QueryContext(ctx, `EXPLAIN QUERY PLAN SELECT id FROM records WHERE dataset = ? AND json_extract(data, '$."category"') = ?`, "items", "office")
+	if err != nil {
+		t.Fatalf("explain: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			t.Fatalf("scan plan: %v", err)
+		}
+		plan.WriteString(detail)
+	}
+	if !strings.Contains(plan.String(), "idx_records_field_category") {
+		t.Fatalf("expected the filter to use the field index, got plan %q", plan.String())
+	}
+}
+
+func TestResultCache(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "docs.csv")
+	if err := os.WriteFile(csvPath, []byte("id,title,kind\n1,hello,a\n2,hi,b\n"), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	svc, err := New(
+		WithDatabasePath(filepath.Join(dir, "app.db")),
+		WithEmbedder(fakeEmbedder{dim: 2}),
+		WithResultCache(time.Minute, 8),
+	)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer svc.Close()
+	if _, err := svc.Ingest(ctx, IngestOptions{Dataset: "docs", CSVPath: csvPath, TextColumns: []string{"title"}}); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+
+	var searches int
+	svc.AddPostSearchHook(func(_ context.Context, _ SearchRequest, results []Result) ([]Result, error) {
+		searches++
+		return results, nil
+	})
+	search := func(opts SearchOptions) []Result {
+		t.Helper()
+		opts.Dataset = "docs"
+		results, err := svc.Search(ctx, opts)
+		if err != nil {
+			t.Fatalf("Search(%q): %v", opts.Query, err)
+		}
+		return results
+	}
+
+	first := search(SearchOptions{Query: "hello"})
+	if again := search(SearchOptions{Query: "hello"}); searches != 1 || !reflect.DeepEqual(again, first) {
+		t.Fatalf("expected a cached result after 1 search, ran %d: %+v", searches, again)
+	}
+	search(SearchOptions{Query: "hello", TopK: 1})
+	search(SearchOptions{Query: "hello", Filters: []Filter{{Field: "kind", Value: "a"}}})
+	if searches != 3 {
+		t.Fatalf("different topK or filters must not hit the cache, ran %d searches", searches)
+	}
+
+	if _, err := svc.Delete(ctx, "docs", []string{"2"}); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if results := search(SearchOptions{Query: "hello"}); searches != 4 || len(results) != 1 {
+		t.Fatalf("expected a fresh search after Delete, ran %d: %+v", searches, results)
+	}
+	if _, err := svc.Ingest(ctx, IngestOptions{Dataset: "docs", CSVPath: csvPath, TextColumns: []string{"title"}}); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	if results := search(SearchOptions{Query: "hello"}); searches != 5 || len(results) != 2 {
+		t.Fatalf("expected a fresh search after Ingest, ran %d: %+v", searches, results)
+	}
+}
+
+func TestDeleteUpdatesVectorPages(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t, "id,title\n1,hello\n2,hi\n3,hellos\n")
+	if _, err := svc.Delete(ctx, "docs", []string{"2"}); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	var stale int
+	if err := svc.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM records_vec_pages_stale`).Scan(&stale); err != nil || stale != 0 {
+		t.Fatalf("expected Delete to leave no stale pages, got %d (%v)", stale, err)
+	}
+	var ids string
+	if err := svc.db.QueryRowContext(ctx, `SELECT ids FROM records_vec_pages WHERE dataset = 'docs'`).Scan(&ids); err != nil || strings.Contains(ids, `"2"`) {
+		t.Fatalf("expected the deleted record to leave its page, got %s (%v)", ids, err)
+	}
+}
+
+func TestSearchVectorPages(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "docs.csv")
+	if err := os.WriteFile(csvPath, []byte("id,title,lat,lng\n1,hello,35.6,139.7\n2,hi,,\n3,hellos,34.7,135.5\n4,x,,\n"), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	svc, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "app.db")},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+	if _, err := svc.Ingest(ctx, IngestOptions{Dataset: "docs", CSVPath: csvPath, TextColumns: []string{"title"}, LatitudeColumn: "lat", LongitudeColumn: "lng"}); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	var pages int
+	if err := svc.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM records_vec_pages WHERE dataset = 'docs'`).Scan(&pages); err != nil || pages != 1 {
+		t.Fatalf("expected ingest to build one vector page, got %d (%v)", pages, err)
+	}
+
+	opts := SearchOptions{Dataset: "docs", Query: "hello", TopK: 3, IncludeVectors: true}
+	paged, err := svc.Search(ctx, opts)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	similar, err := svc.Similar(ctx, SimilarOptions{Dataset: "docs", ID: "1"})
+	if err != nil {
+		t.Fatalf("Similar: %v", err)
+	}
+
+	// Without pages the same searches scan the rows.
+	if _, err := svc.db.ExecContext(ctx, `DELETE FROM records_vec_pages`); err != nil {
+		t.Fatalf("drop pages: %v", err)
+	}
+	svc.invalidateResults()
+	scanned, err := svc.Search(ctx, opts)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(paged) != 3 || paged[0].Lat == nil || !reflect.DeepEqual(paged, scanned) {
+		t.Fatalf("paged results differ from scanned ones:\n%+v\n%+v", paged, scanned)
+	}
+	similarScanned, err := svc.Similar(ctx, SimilarOptions{Dataset: "docs", ID: "1"})
+	if err != nil {
+		t.Fatalf("Similar: %v", err)
+	}
+	if !reflect.DeepEqual(similar, similarScanned) {
+		t.Fatalf("paged similar results differ from scanned ones:\n%+v\n%+v", similar, similarScanned)
+	}
+}
+
+func TestSearchWithoutEncoder(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "app.db")
+	csvPath := filepath.Join(dir, "docs.csv")
+	if err := os.WriteFile(csvPath, []byte("id,title,kind\n1,hello world,a\n2,hi,b\n3,hello,a\n"), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	svc, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: dbPath},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	if _, err := svc.Ingest(ctx, IngestOptions{Dataset: "docs", CSVPath: csvPath, TextColumns: []string{"title"}}); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	svc.Close()
+
+	// No model assets: searches that need no encoder keep working.
+	svc, err = NewService(ServiceOptions{Database: DatabaseOptions{Path: dbPath}})
+	if err != nil {
+		t.Fatalf("NewService without encoder: %v", err)
+	}
+	defer svc.Close()
+	if _, err := svc.NewAPIServer(ServeOptions{}); err != nil {
+		t.Fatalf("NewAPIServer without encoder: %v", err)
+	}
+
+	results, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Filters: []Filter{{Field: "kind", Value: "a"}}})
+	if err != nil {
+		t.Fatalf("filter-only Search: %v", err)
+	}
+	if len(results) != 2 || results[0].ID != "1" || results[1].ID != "3" {
+		t.Fatalf("unexpected filter results: %+v", results)
+	}
+	results, err = svc.KeywordSearch(ctx, KeywordSearchOptions{Dataset: "docs", Query: "hello"})
+	if err != nil {
+		t.Fatalf("KeywordSearch: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("unexpected keyword results: %+v", results)
+	}
+
+	if _, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "hello"}); !errors.Is(err, ErrEncoder) {
+		t.Fatalf("expected ErrEncoder for a vector search, got %v", err)
+	}
+	if _, err := svc.Search(ctx, SearchOptions{Dataset: "docs"}); err == nil {
+		t.Fatalf("expected an error without query and filters")
+	}
+}
+
+func TestSearchDuringWriteTransaction(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t, "id,title\n1,hello\n2,hi\n")
+
+	// The transaction holds the only writer connection, as an ingest does.
+	tx, err := svc.db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM records WHERE dataset = 'docs'`); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	searchCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	results, err := svc.Search(searchCtx, SearchOptions{Dataset: "docs", Query: "hello"})
+	if err != nil {
+		t.Fatalf("Search during a write transaction: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected the committed records, got %+v", results)
+	}
+}
+
+func TestSearchNear(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "spots.csv")
+	// Tokyo Station, Shinjuku (about 6 km away), Yokohama (about 27 km) and a
+	// record without coordinates.
+	data := "id,title,lat,lng\n" +
+		"tokyo,hello,35.6812,139.7671\n" +
+		"shinjuku,hello there,35.6896,139.7006\n" +
+		"yokohama,hello,35.4437,139.6380\n" +
+		"nowhere,hello,,\n"
+	if err := os.WriteFile(csvPath, []byte(data), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	svc, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "app.db")},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+	if _, err := svc.Ingest(ctx, IngestOptions{Dataset: "spots", CSVPath: csvPath, TextColumns: []string{"title"},
+		LatitudeColumn: "lat", LongitudeColumn: "lng"}); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	ids := func(results []Result) string {
+		var ids []string
+		for _, r := range results {
+			ids = append(ids, r.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	near := &Near{Lat: 35.6812, Lng: 139.7671, RadiusKm: 10, SortByDistance: true}
+	results, err := svc.Search(ctx, SearchOptions{Dataset: "spots", Query: "hello", Near: near})
+	if err != nil {
+		t.Fatalf("Search near: %v", err)
+	}
+	if got := ids(results); got != "tokyo,shinjuku" {
+		t.Fatalf("expected the records within 10 km closest first, got %s", got)
+	}
+	if d := *results[1].DistanceKm; d < 5.5 || d > 6.5 {
+		t.Fatalf("unexpected distance to Shinjuku: %v", d)
+	}
+
+	// Without a query the records come closest first, with no radius limit.
+	results, err = svc.Search(ctx, SearchOptions{Dataset: "spots", Near: &Near{Lat: 35.45, Lng: 139.64}})
+	if err != nil {
+		t.Fatalf("Search near without query: %v", err)
+	}
+	if got := ids(results); got != "yokohama,shinjuku,tokyo" {
+		t.Fatalf("unexpected order by distance: %s", got)
+	}
+
+	// A large weight lets distance outrank similarity.
+	results, err = svc.Search(ctx, SearchOptions{Dataset: "spots", Query: "hello", Near: &Near{Lat: 35.45, Lng: 139.64, Weight: 100}})
+	if err != nil {
+		t.Fatalf("Search with distance weight: %v", err)
+	}
+	if len(results) != 3 || results[0].ID != "yokohama" {
+		t.Fatalf("expected the blended score to favour Yokohama, got %s", ids(results))
+	}
+
+	if _, err := svc.Search(ctx, SearchOptions{Dataset: "spots", Near: &Near{Lat: 95}}); err == nil {
+		t.Fatalf("expected an error for an invalid latitude")
+	}
+}
+
+func TestSearchGeoWeight(t *testing.T) {
+	ctx := context.Background()
+	// Tokyo and Yokohama match the query exactly; Shinjuku does not.
+	svc := newTestService(t, "id,title,lat,lng\n"+
+		"tokyo,hello,35.6812,139.7671\n"+
+		"shinjuku,hello there,35.6896,139.7006\n"+
+		"yokohama,hello,35.4437,139.6380\n")
+	ids := func(results []Result) string {
+		var ids []string
+		for _, r := range results {
+			ids = append(ids, r.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	// Within a radius the proximity is 1-distance/radius.
+	results, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "hello", Near: &Near{Lat: 35.45, Lng: 139.64, RadiusKm: 30, GeoWeight: 0.5}})
+	if err != nil {
+		t.Fatalf("Search with geo weight: %v", err)
+	}
+	if got := ids(results); got != "yokohama,shinjuku,tokyo" {
+		t.Fatalf("expected the records by proximity, got %s", got)
+	}
+	for _, r := range []Result{results[0], results[2]} {
+		want := 0.5*1 + 0.5*(1-*r.DistanceKm/30)
+		if math.Abs(r.Score-want) > 1e-3 {
+			t.Fatalf("unexpected blended score of %s: got %v, want %v", r.ID, r.Score, want)
+		}
+	}
+
+	// Without a radius the proximity is 1/(1+distance_km), the same term the
+	// distance weight adds on top of the blended score.
+	results, err = svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "hello", Near: &Near{Lat: 35.45, Lng: 139.64, GeoWeight: 0.5, Weight: 1}})
+	if err != nil {
+		t.Fatalf("Search with geo and distance weights: %v", err)
+	}
+	for _, r := range results {
+		if r.ID == "shinjuku" {
+			continue
+		}
+		want := 0.5*1 + 0.5/(1+*r.DistanceKm) + 1/(1+*r.DistanceKm)
+		if math.Abs(r.Score-want) > 1e-3 {
+			t.Fatalf("unexpected combined score of %s: got %v, want %v", r.ID, r.Score, want)
+		}
+	}
+
+	if _, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "hello", Near: &Near{Lat: 35.45, Lng: 139.64, GeoWeight: 1.5}}); err == nil {
+		t.Fatalf("expected an error for a geo weight above 1")
+	}
+}
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestScoresGolden pins the scores of every metric, rounded by
+// score_precision, so that changes to scoring or storage that alter result
+// sets are caught. Run with -update to accept intended changes.
+func TestScoresGolden(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "docs.csv")
+	data := "id,title\n1,a\n2,hello\n3,hello world\n4,hi\n5,a much longer title\n6,olleh\n"
+	if err := os.WriteFile(csvPath, []byte(data), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	cfgPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(cfgPath, []byte(`{
+  "database": {"path": "app.db"},
+  "datasets": {
+    "cosine": {},
+    "dot": {"search": {"metric": "dot"}},
+    "euclidean": {"search": {"metric": "euclidean", "score_precision": 3}}
+  },
+  "search": {"score_precision": 6}
+}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	svc, err := NewService(ServiceOptions{
+		Config:  ConfigReference{Path: cfgPath, Required: true},
+		Encoder: EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+
+	type scored struct {
+		ID    string  `json:"id"`
+		Score float64 `json:"score"`
+	}
+	got := map[string][]scored{}
+	for _, dataset := range []string{"cosine", "dot", "euclidean"} {
+		if _, err := svc.Ingest(ctx, IngestOptions{Dataset: dataset, CSVPath: csvPath, TextColumns: []string{"title"}}); err != nil {
+			t.Fatalf("Ingest %s: %v", dataset, err)
+		}
+		var first []Result
+		// The paged scan and the row scan must agree, as must repeated runs.
+		for run := 0; run < 3; run++ {
+			if run == 2 {
+				if _, err := svc.db.ExecContext(ctx, `DELETE FROM records_vec_pages`); err != nil {
+					t.Fatalf("drop pages: %v", err)
+				}
+			}
+			svc.invalidateResults()
+			results, err := svc.Search(ctx, SearchOptions{Dataset: dataset, Query: "hello", TopK: 10})
+			if err != nil {
+				t.Fatalf("Search %s: %v", dataset, err)
+			}
+			if run == 0 {
+				first = results
+			} else if !reflect.DeepEqual(first, results) {
+				t.Fatalf("%s: run %d differs:\n%+v\n%+v", dataset, run, first, results)
+			}
+		}
+		for _, r := range first {
+			got[dataset] = append(got[dataset], scored{ID: r.ID, Score: r.Score})
+		}
+	}
+
+	encoded, err := json.MarshalIndent(got, "", "  ")
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	encoded = append(encoded, '\n')
+	golden := filepath.Join("testdata", "scores.golden.json")
+	if *updateGolden {
+		if err := os.WriteFile(golden, encoded, 0o644); err != nil {
+			t.Fatalf("update golden file: %v", err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("read golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(encoded, want) {
+		t.Fatalf("scores differ from %s (run with -update if intended):\n%s", golden, encoded)
+	}
+}
+
+func TestStrictFilters(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "docs.csv")
+	if err := os.WriteFile(csvPath, []byte("id,title,category\n1,hello,cafe\n2,hi,bar\n"), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	cfgPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(cfgPath, []byte(`{
+  "database": {"path": "app.db"},
+  "datasets": {"docs": {"search": {"strict_filters": true}}}
+}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	svc, err := NewService(ServiceOptions{
+		Config:  ConfigReference{Path: cfgPath, Required: true},
+		Encoder: EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+	if _, err := svc.Ingest(ctx, IngestOptions{Dataset: "docs", CSVPath: csvPath, TextColumns: []string{"title"}}); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+
+	_, err = svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "hello", Filters: []Filter{{Field: "catagory", Value: "cafe"}}})
+	if !errors.Is(err, ErrUnknownField) || !strings.Contains(err.Error(), "valid fields: category, id, title") {
+		t.Fatalf("expected an unknown field error listing the fields, got %v", err)
+	}
+	if _, err := svc.KeywordSearch(ctx, KeywordSearchOptions{Dataset: "docs", Query: "hello", Filters: []Filter{{Field: "catagory", Value: "cafe"}}}); !errors.Is(err, ErrUnknownField) {
+		t.Fatalf("expected keyword searches to be checked as well, got %v", err)
+	}
+	results, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Filters: []Filter{{Field: "category", Value: "cafe"}}})
+	if err != nil || len(results) != 1 {
+		t.Fatalf("expected one result for a known field, got %+v (%v)", results, err)
+	}
+
+	// Fields added by a later ingest are known right away.
+	if err := os.WriteFile(csvPath, []byte("id,title,category,price\n3,hey,cafe,100\n"), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	if _, err := svc.Ingest(ctx, IngestOptions{Dataset: "docs", CSVPath: csvPath, TextColumns: []string{"title"}}); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	if results, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Filters: []Filter{{Field: "price", Op: ">", Value: "50"}}}); err != nil || len(results) != 1 {
+		t.Fatalf("expected the new field to be accepted, got %+v (%v)", results, err)
+	}
+}
+
+func TestTieBreak(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "docs.csv")
+	svc, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "app.db")},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+	ingest := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(csvPath, []byte(data), 0o600); err != nil {
+			t.Fatalf("write csv: %v", err)
+		}
+		if _, err := svc.Ingest(ctx, IngestOptions{Dataset: "docs", CSVPath: csvPath, TextColumns: []string{"title"}, MetadataColumns: []string{"kind"}}); err != nil {
+			t.Fatalf("Ingest: %v", err)
+		}
+	}
+	ingest("id,title,kind\nb,tea,x\na,tea,x\nc,tea,x\n")
+	time.Sleep(5 * time.Millisecond)
+	ingest("id,title,kind\nc,tea,y\n")
+
+	ids := func(results []Result, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+		out := make([]string, len(results))
+		for i, r := range results {
+			out[i] = r.ID
+		}
+		return strings.Join(out, ",")
+	}
+	for _, tc := range []struct{ tieBreak, want string }{
+		{"", "a,b,c"},
+		{"id", "a,b,c"},
+		{"ingestion", "b,a,c"},
+		{"updated", "c,"},
+	} {
+		search := ids(svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "tea", TieBreak: tc.tieBreak}))
+		keyword := ids(svc.KeywordSearch(ctx, KeywordSearchOptions{Dataset: "docs", Query: "tea", TieBreak: tc.tieBreak}))
+		for name, got := range map[string]string{"search": search, "keyword": keyword} {
+			// a and b were written by the same ingest, possibly within the
+			// same millisecond, so only the first of "updated" is fixed.
+			if !strings.HasPrefix(got, tc.want) {
+				t.Fatalf("%s with tie break %q: expected %s, got %s", name, tc.tieBreak, tc.want, got)
+			}
+		}
+	}
+	if got := ids(svc.Similar(ctx, SimilarOptions{Dataset: "docs", ID: "a", TieBreak: "ingestion"})); got != "b,c" {
+		t.Fatalf("similar with ingestion tie break: expected b,c, got %s", got)
+	}
+	if _, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "tea", TieBreak: "newest"}); err == nil {
+		t.Fatal("expected an unknown tie break to be rejected")
+	}
+}
+
+func TestGroupBy(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "stores.csv")
+	if err := os.WriteFile(csvPath, []byte("id,title,chain\na,tea,x\nb,tea,x\nc,tea,y\nd,tea,y\ne,tea,\nf,tea,\n"), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	svc, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "app.db")},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+	if _, err := svc.Ingest(ctx, IngestOptions{Dataset: "stores", CSVPath: csvPath, TextColumns: []string{"title"}, MetadataColumns: []string{"chain"}}); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+
+	ids := func(results []Result, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+		out := make([]string, len(results))
+		for i, r := range results {
+			out[i] = r.ID
+		}
+		return strings.Join(out, ",")
+	}
+	// Every record scores the same, so ties order them by id.
+	for _, tc := range []struct {
+		topK, size int
+		want       string
+	}{
+		{0, 0, "a,c,e,f"},
+		{0, 2, "a,b,c,d,e,f"},
+		{2, 1, "a,c"},
+	} {
+		search := ids(svc.Search(ctx, SearchOptions{Dataset: "stores", Query: "tea", TopK: tc.topK, GroupBy: "chain", GroupSize: tc.size}))
+		keyword := ids(svc.KeywordSearch(ctx, KeywordSearchOptions{Dataset: "stores", Query: "tea", TopK: tc.topK, GroupBy: "chain", GroupSize: tc.size}))
+		for name, got := range map[string]string{"search": search, "keyword": keyword} {
+			if got != tc.want {
+				t.Fatalf("%s grouped by chain (topk %d, size %d): expected %s, got %s", name, tc.topK, tc.size, tc.want, got)
+			}
+		}
+	}
+	if _, err := svc.Search(ctx, SearchOptions{Dataset: "stores", Filters: []Filter{{Field: "chain", Value: "x"}}, GroupBy: "chain"}); err == nil {
+		t.Fatal("expected grouping without a query to be rejected")
+	}
+	if _, err := svc.Search(ctx, SearchOptions{Dataset: "stores", Query: "tea", GroupSize: 2}); err == nil {
+		t.Fatal("expected a group size without a field to be rejected")
+	}
+}
+
+func TestScoreNormalization(t *testing.T) {
+	ctx := context.Background()
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(cfgPath, []byte(`{"datasets": {"docs": {"search": {"score_normalization": "minmax"}}}}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	svc := newTestService(t, "id,title\na,tea\nb,green tea\nc,x\n", WithConfigFile(cfgPath))
+
+	scores := func(mode string) []float64 {
+		t.Helper()
+		results, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "tea", ScoreNormalization: mode})
+		if err != nil {
+			t.Fatalf("search (%q): %v", mode, err)
+		}
+		if len(results) != 3 || results[0].ID != "a" {
+			t.Fatalf("search (%q): expected a first of three results, got %+v", mode, results)
+		}
+		out := make([]float64, len(results))
+		for i, r := range results {
+			out[i] = r.Score
+		}
+		return out
+	}
+	raw := scores("raw")
+	if math.Abs(raw[0]-1) > 1e-6 || raw[2] <= 0 {
+		t.Fatalf("expected raw cosine scores, got %v", raw)
+	}
+	// The dataset normalizes by min-max unless the search asks otherwise.
+	if got := scores(""); got[0] != 1 || got[2] != 0 || got[1] <= 0 || got[1] >= 1 {
+		t.Fatalf("expected min-max scores from 1 to 0, got %v", got)
+	}
+	soft := scores("softmax")
+	if sum := soft[0] + soft[1] + soft[2]; math.Abs(sum-1) > 1e-9 || soft[0] <= soft[1] || soft[1] <= soft[2] {
+		t.Fatalf("expected decreasing softmax scores adding up to 1, got %v", soft)
+	}
+	results, err := svc.KeywordSearch(ctx, KeywordSearchOptions{Dataset: "docs", Query: "tea"})
+	if err != nil || len(results) != 2 || results[0].Score != 1 || results[1].Score != 0 {
+		t.Fatalf("expected min-max keyword scores, got %+v (%v)", results, err)
+	}
+	if _, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "tea", ScoreNormalization: "zscore"}); err == nil {
+		t.Fatal("expected an unknown score normalization to be rejected")
+	}
+}
+
+func TestSearchWithinIDs(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t, "id,title\na,tea\nb,green tea\nc,black tea\nd,coffee\n", WithResultCache(time.Minute, 0))
+
+	ids := func(results []Result, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+		out := make([]string, len(results))
+		for i, r := range results {
+			out[i] = r.ID
+		}
+		sort.Strings(out)
+		return strings.Join(out, ",")
+	}
+	within := []string{"c", "d", "missing"}
+	for name, got := range map[string]string{
+		"search":  ids(svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "tea", IDs: within})),
+		"filter":  ids(svc.Search(ctx, SearchOptions{Dataset: "docs", IDs: within})),
+		"keyword": ids(svc.KeywordSearch(ctx, KeywordSearchOptions{Dataset: "docs", Query: "tea", IDs: within})),
+	} {
+		want := "c,d"
+		if name == "keyword" {
+			want = "c"
+		}
+		if got != want {
+			t.Fatalf("%s within %v: expected %s, got %s", name, within, want, got)
+		}
+	}
+	// The restriction is part of the cache key.
+	if got := ids(svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "tea"})); got != "a,b,c,d" {
+		t.Fatalf("expected an unrestricted search to see every record, got %s", got)
+	}
+}
+
+func TestSearchModel(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "docs.csv")
+	if err := os.WriteFile(csvPath, []byte("id,title\na,tea\n"), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	svc, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "app.db")},
+		Encoder: EncoderOptions{
+			Embedder: fakeEmbedder{dim: 2},
+			Config:   EncoderConfig{ModelVersion: "v1"},
+			Models: map[string]ModelOptions{
+				"same": {Embedder: fakeEmbedder{dim: 2}, Config: EncoderConfig{ModelVersion: "v1"}},
+				"next": {Embedder: fakeEmbedder{dim: 2, shift: 1}, Config: EncoderConfig{ModelVersion: "v2"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+	for _, dataset := range []string{"docs", "migrated"} {
+		if _, err := svc.Ingest(ctx, IngestOptions{Dataset: dataset, CSVPath: csvPath, TextColumns: []string{"title"}}); err != nil {
+			t.Fatalf("Ingest %s: %v", dataset, err)
+		}
+	}
+	// Stand in for a dataset re-embedded with the next model.
+	if _, err := svc.db.ExecContext(ctx, `UPDATE records_vec SET model = 'v2' WHERE dataset = 'migrated'`); err != nil {
+		t.Fatalf("update model: %v", err)
+	}
+
+	if got := strings.Join(svc.Models(), ","); got != "next,same" {
+		t.Fatalf("Models = %s", got)
+	}
+	score := func(dataset, model string) float64 {
+		t.Helper()
+		results, err := svc.Search(ctx, SearchOptions{Dataset: dataset, Query: "tea", Model: model})
+		if err != nil || len(results) != 1 {
+			t.Fatalf("search %s with model %q: %+v, %v", dataset, model, results, err)
+		}
+		return results[0].Score
+	}
+	if s := score("docs", "same"); s < 0.9999 {
+		t.Fatalf("expected the same model to match the stored embedding, got %v", s)
+	}
+	if s := score("migrated", "next"); s > 0.99 {
+		t.Fatalf("expected the query to be encoded by the next model, got %v", s)
+	}
+	if _, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "tea", Model: "next"}); !errors.Is(err, ErrModelMismatch) {
+		t.Fatalf("expected ErrModelMismatch, got %v", err)
+	}
+	if _, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "tea", Model: "missing"}); !errors.Is(err, ErrUnknownModel) {
+		t.Fatalf("expected ErrUnknownModel, got %v", err)
+	}
+}
+
+func TestFeedbackTuning(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "docs.csv")
+	// Both titles have the same length, so the fake embedder scores them
+	// alike and only the field boosts tell them apart.
+	if err := os.WriteFile(csvPath, []byte("id,title,category\n1,green tea,apple\n2,apple pie,dessert\n"), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	cfgPath := filepath.Join(dir, "config.json")
+	writeConfig := func(search string) {
+		t.Helper()
+		if err := os.WriteFile(cfgPath, []byte(`{
+  "database": {"path": "app.db"},
+  "datasets": {"docs": {"search": `+search+`}}
+}`), 0o600); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+	}
+	writeConfig(`{}`)
+	svc, err := NewService(ServiceOptions{
+		Config:  ConfigReference{Path: cfgPath, Required: true},
+		Encoder: EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+	if _, err := svc.Ingest(ctx, IngestOptions{Dataset: "docs", CSVPath: csvPath, TextColumns: []string{"title"}}); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+
+	results, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "apple"})
+	if err != nil || len(results) != 2 || results[0].ID != "1" {
+		t.Fatalf("expected the tie to go to id 1 before tuning, got %+v (%v)", results, err)
+	}
+
+	if err := svc.RecordFeedback(ctx, FeedbackOptions{Dataset: "docs", Query: "apple", ID: "2", Position: 2, Shown: []string{"1", "2"}}); err != nil {
+		t.Fatalf("RecordFeedback: %v", err)
+	}
+	// Without the results shown there is nothing to compare against.
+	if err := svc.RecordFeedback(ctx, FeedbackOptions{Dataset: "docs", Query: "apple", ID: "2"}); err != nil {
+		t.Fatalf("RecordFeedback: %v", err)
+	}
+	if err := svc.RecordFeedback(ctx, FeedbackOptions{Dataset: "docs", Query: "apple"}); err == nil {
+		t.Fatal("expected feedback without an id to be rejected")
+	}
+
+	fit, err := svc.TuneBoosts(ctx, TuneOptions{Dataset: "docs"})
+	if err != nil {
+		t.Fatalf("TuneBoosts: %v", err)
+	}
+	if fit.Dataset != "docs" || fit.Feedback != 2 || fit.Used != 1 || len(fit.FieldBoosts) != 1 || fit.FieldBoosts["title"] != 0.2 {
+		t.Fatalf("expected a title boost from one usable feedback, got %+v", fit)
+	}
+
+	writeConfig(`{"field_boosts": {"title": 0.2}}`)
+	if _, err := svc.ReloadConfig(); err != nil {
+		t.Fatalf("ReloadConfig: %v", err)
+	}
+	results, err = svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "apple"})
+	if err != nil || len(results) != 2 || results[0].ID != "2" || results[0].Score-results[1].Score < 0.19 {
+		t.Fatalf("expected the boosted title match first, got %+v (%v)", results, err)
+	}
+}
+
+func TestDatasetDictionaries(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "docs.csv")
+	// Both titles have the same length, so the fake embedder scores them
+	// alike and only the term boosts tell them apart.
+	if err := os.WriteFile(csvPath, []byte("id,title,category\n1,green tea,regular\n2,black tea,organic\n"), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "stop.txt"), []byte("the\nof\n"), 0o600); err != nil {
+		t.Fatalf("write stopwords: %v", err)
+	}
+	boostPath := filepath.Join(dir, "boost.txt")
+	if err := os.WriteFile(boostPath, []byte("organic 2\n"), 0o600); err != nil {
+		t.Fatalf("write term boosts: %v", err)
+	}
+	cfgPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(cfgPath, []byte(`{
+  "database": {"path": "app.db"},
+  "datasets": {"docs": {"stopwords": "stop.txt", "term_boosts": "boost.txt"}}
+}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	svc, err := NewService(ServiceOptions{
+		Config:  ConfigReference{Path: cfgPath, Required: true},
+		Encoder: EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+	if _, err := svc.Ingest(ctx, IngestOptions{Dataset: "docs", CSVPath: csvPath, TextColumns: []string{"title"}}); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+
+	results, err := svc.KeywordSearch(ctx, KeywordSearchOptions{Dataset: "docs", Query: "The tea"})
+	if err != nil || len(results) != 2 {
+		t.Fatalf("expected the stopword to be dropped before matching, got %+v (%v)", results, err)
+	}
+	if results, err := svc.KeywordSearch(ctx, KeywordSearchOptions{Dataset: "docs", Query: "the of"}); err != nil || len(results) != 0 {
+		t.Fatalf("expected a query of stopwords to match nothing, got %+v (%v)", results, err)
+	}
+
+	results, err = svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "organic tea"})
+	if err != nil || len(results) != 2 || results[0].ID != "2" || math.Abs(results[0].Score-2*results[1].Score) > 1e-9 {
+		t.Fatalf("expected the organic record boosted twofold, got %+v (%v)", results, err)
+	}
+	results, err = svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "green tea"})
+	if err != nil || results[0].ID != "1" || results[0].Score != results[1].Score {
+		t.Fatalf("expected no boost without the term in the query, got %+v (%v)", results, err)
+	}
+
+	// Dictionary files are re-read with the configuration.
+	if err := os.WriteFile(boostPath, []byte("organic 1\n"), 0o600); err != nil {
+		t.Fatalf("write term boosts: %v", err)
+	}
+	changes, err := svc.ReloadConfig()
+	if err != nil || strings.Join(changes.Applied, ",") != "datasets.docs" {
+		t.Fatalf("expected the dataset to be reported as changed, got %+v (%v)", changes, err)
+	}
+	results, err = svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "organic tea"})
+	if err != nil || results[0].ID != "1" {
+		t.Fatalf("expected the boost to be gone after the reload, got %+v (%v)", results, err)
+	}
+}
+
+func TestLanguageRouting(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "docs.csv")
+	if err := os.WriteFile(csvPath, []byte("id,title\n1,東京都の天気\n2,weather in Tokyo\n3,大阪府の天気\n"), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	cfgPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(cfgPath, []byte(`{
+  "database": {"path": "app.db"},
+  "datasets": {"docs": {"languages": {"ja": {"fts_tokenizer": "trigram", "query_prefix": "query: "}}}}
+}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	svc, err := NewService(ServiceOptions{
+		Config:  ConfigReference{Path: cfgPath, Required: true},
+		Encoder: EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer svc.Close()
+	if _, err := svc.Ingest(ctx, IngestOptions{Dataset: "docs", CSVPath: csvPath, TextColumns: []string{"title"}}); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+
+	ids := func(query string) string {
+		t.Helper()
+		results, err := svc.KeywordSearch(ctx, KeywordSearchOptions{Dataset: "docs", Query: query})
+		if err != nil {
+			t.Fatalf("KeywordSearch(%q): %v", query, err)
+		}
+		var out []string
+		for _, r := range results {
+			out = append(out, r.ID)
+		}
+		return strings.Join(out, ",")
+	}
+	// The default tokenizer keeps 東京都の天気 as one token; the trigram
+	// index matches words inside it, and words under three characters as
+	// substrings.
+	if got := ids("東京都"); got != "1" {
+		t.Fatalf("expected the Japanese query to match inside the text, got %q", got)
+	}
+	if got := ids("天気"); got != "1,3" {
+		t.Fatalf("expected the two-character query to match as a substring, got %q", got)
+	}
+	if got := ids("Tokyo"); got != "2" {
+		t.Fatalf("expected the English query to use the default index, got %q", got)
+	}
+
+	// Changing the records makes the index stale until it is rebuilt.
+	if _, err := svc.Delete(ctx, "docs", []string{"3"}); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if got := ids("東京都"); got != "" {
+		t.Fatalf("expected the stale trigram index to be skipped, got %q", got)
+	}
+	summary, err := svc.Reindex(ctx, ReindexOptions{FTS: true})
+	if err != nil || summary.TrigramRows != 2 {
+		t.Fatalf("expected reindex to rebuild the trigram index, got %+v (%v)", summary, err)
+	}
+	if got := ids("東京都"); got != "1" {
+		t.Fatalf("expected the rebuilt trigram index to be used, got %q", got)
+	}
+
+	results, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "東京都の天気"})
+	if err != nil || len(results) != 2 {
+		t.Fatalf("expected the routed vector search to succeed, got %+v (%v)", results, err)
+	}
+}
@@ -3,10 +3,16 @@ package csvsearch
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"reflect"
+	"sort"
 	"strings"
 	"time"
 
+	"yashubustudio/csv-search/internal/config"
+	"yashubustudio/csv-search/internal/embedding"
 	"yashubustudio/csv-search/internal/server"
 )
 
@@ -16,15 +22,81 @@ type ServeOptions struct {
 	Dataset         string
 	Table           string
 	TopK            int
+	SparseWeight    float64
 	RequestTimeout  time.Duration
 	ShutdownTimeout time.Duration
 	AutoIngest      *bool
+	// AdminToken protects the /admin endpoints (such as model reloads), and
+	// the gRPC Ingest and Delete, with a bearer token. Without it they only
+	// accept loopback clients.
+	AdminToken string
+	// GRPCAddress additionally serves the gRPC API on this address when set.
+	GRPCAddress string
+	// RateLimit throttles HTTP clients; requests over the limit receive 429
+	// with a Retry-After header.
+	RateLimit RateLimitOptions
+	// TLSCertFile and TLSKeyFile enable HTTPS (and TLS for gRPC). Rotated
+	// certificate files are reloaded automatically.
+	TLSCertFile string
+	TLSKeyFile  string
+	// MaxUploadBytes caps CSV uploads to POST /ingest (256 MiB when zero).
+	MaxUploadBytes int64
+	// DisableUI turns off the embedded search page served at "/".
+	DisableUI bool
+	// AccessLogFormat enables per-request access logs with the search
+	// latency breakdown: "common" (Common Log Format plus timings) or "json".
+	// Empty disables access logging.
+	AccessLogFormat string
+	// AccessLog receives the access log lines (os.Stdout when nil).
+	AccessLog io.Writer
+	// MaxInFlight caps concurrently executing HTTP requests (unlimited when
+	// zero). Up to MaxQueue more wait for a free slot; the rest receive 503.
+	MaxInFlight int
+	MaxQueue    int
+	// CacheTTL caches serialized responses of identical HTTP searches for
+	// this long (disabled when zero); CacheSize bounds the entries (1024 when
+	// zero). The cache is cleared after ingests, re-embeds and model reloads.
+	CacheTTL  time.Duration
+	CacheSize int
+	// WatchConfig polls the configuration file at this interval while
+	// serving and applies changed search defaults and dataset mappings
+	// without a restart (see ReloadConfig). Zero disables polling.
+	WatchConfig time.Duration
+	// ReloadConfig triggers the same reload on demand, for example when the
+	// process receives SIGHUP. StartServer only.
+	ReloadConfig <-chan struct{}
+	// DisableSchedules keeps StartServer from re-ingesting the datasets that
+	// have a schedule in the configuration.
+	DisableSchedules bool
+	// ReplicaSource turns the server into a read replica of the instance
+	// that ingests: StartServer synchronizes the database from this snapshot
+	// (a file written by Backup or an http(s) URL serving one) before
+	// serving and every ReplicaInterval (a minute when zero) afterwards (see
+	// SyncReplica). Replicas neither ingest nor record feedback, since the
+	// next snapshot would discard the changes.
+	ReplicaSource   string
+	ReplicaInterval time.Duration
+}
+
+// RateLimitOptions configure token-bucket rate limiting. Rates are requests
+// per second; zero disables the corresponding limit and a zero burst defaults
+// to the rate rounded up.
+type RateLimitOptions struct {
+	// RequestsPerSecond and Burst apply to all clients combined.
+	RequestsPerSecond float64
+	Burst             int
+	// PerClientRequestsPerSecond and PerClientBurst apply to each client,
+	// identified by its API key (X-API-Key or bearer token) or IP address.
+	PerClientRequestsPerSecond float64
+	PerClientBurst             int
 }
 
 // APIServer wraps the internal server.Server to provide a stable API surface for
 // applications embedding csv-search.
 type APIServer struct {
 	server *server.Server
+	svc    *Service
+	opts   ServeOptions
 }
 
 // Handler exposes the HTTP handler so that callers can mount it on an existing
@@ -44,6 +116,21 @@ func (s *APIServer) Serve(ctx context.Context) error {
 	return s.server.Serve(ctx)
 }
 
+// ReloadConfig re-reads the Service configuration (see Service.ReloadConfig)
+// and applies the resulting search defaults to the running server. Options
+// passed to NewAPIServer keep precedence over the configuration.
+func (s *APIServer) ReloadConfig() (ConfigReload, error) {
+	if s == nil || s.server == nil {
+		return ConfigReload{}, fmt.Errorf("server is nil")
+	}
+	changes, err := s.svc.ReloadConfig()
+	if err != nil {
+		return ConfigReload{}, err
+	}
+	s.server.SetDefaults(s.svc.serverDefaults(s.opts))
+	return changes, nil
+}
+
 // NewAPIServer prepares the HTTP API server using the provided options. The
 // caller is responsible for ensuring the database schema exists (use
 // InitDatabase) and ingesting data before serving traffic.
@@ -56,9 +143,7 @@ func (s *Service) NewAPIServer(opts ServeOptions) (*APIServer, error) {
 		return nil, err
 	}
 
-	datasetName, datasetCfg, _ := resolveDataset(s.cfg, opts.Dataset)
-	table := resolveTable(datasetName, datasetCfg, opts.Table)
-	defaultTopK := firstPositive(opts.TopK, cfgSearchTopK(s.cfg), 10)
+	defaults := s.serverDefaults(opts)
 
 	reqTimeout := opts.RequestTimeout
 	if reqTimeout <= 0 {
@@ -71,24 +156,192 @@ func (s *Service) NewAPIServer(opts ServeOptions) (*APIServer, error) {
 
 	addr := firstNonEmpty(strings.TrimSpace(opts.Address), ":8080")
 
-	enc, err := s.ensureEncoder()
-	if err != nil {
+	if err := s.ensureEncoderAtStart(); err != nil {
 		return nil, err
 	}
 
 	cfg := server.Config{
-		Addr:            addr,
-		Dataset:         table,
-		DefaultTopK:     defaultTopK,
-		RequestTimeout:  reqTimeout,
-		ShutdownTimeout: shutdownTimeout,
+		Addr:               addr,
+		Dataset:            defaults.Dataset,
+		DefaultTopK:        defaults.Search.TopK,
+		SparseWeight:       defaults.Search.SparseWeight,
+		Metric:             defaults.Search.Metric,
+		MinScore:           defaults.Search.MinScore,
+		ScorePrecision:     defaults.Search.ScorePrecision,
+		ScoreNormalization: defaults.Search.ScoreNormalization,
+		StrictFilters:      defaults.Search.StrictFilters,
+		FieldBoosts:        defaults.Search.FieldBoosts,
+		DatasetDefaults:    defaults.Datasets,
+		DatasetCaches:      defaults.Caches,
+		RequestTimeout:     reqTimeout,
+		ShutdownTimeout:    shutdownTimeout,
+		AdminToken:         strings.TrimSpace(opts.AdminToken),
+		ReloadModel:        s.reloadModel,
+		Ingest:             s.ingestUpload,
+		Maintenance:        serverMaintenance{s},
+		Engine:             s.engine,
+		Datasets:           s.serverDatasets,
+		Embed:              s.serverEmbed,
+		Feedback:           s.serverFeedback,
+		Schedules:          s.serverSchedules,
+		DatasetVersion:     s.versionTable,
+		Model:              s.serverModel,
+		Version:            func() server.VersionInfo { return server.VersionInfo(s.VersionInfo()) },
+		RateLimit: server.RateLimit{
+			Rate:        opts.RateLimit.RequestsPerSecond,
+			Burst:       opts.RateLimit.Burst,
+			ClientRate:  opts.RateLimit.PerClientRequestsPerSecond,
+			ClientBurst: opts.RateLimit.PerClientBurst,
+		},
+		TLSCertFile:    opts.TLSCertFile,
+		TLSKeyFile:     opts.TLSKeyFile,
+		Metrics:        s.metrics.registry,
+		QueryLog:       s.queryLog,
+		MaxUploadBytes: opts.MaxUploadBytes,
+		DisableUI:      opts.DisableUI,
+		MaxInFlight:    opts.MaxInFlight,
+		MaxQueue:       opts.MaxQueue,
+		CacheTTL:       opts.CacheTTL,
+		CacheSize:      opts.CacheSize,
+		Logger:         s.log,
+		BeforeSearch:   s.serverBeforeSearch,
+		AfterSearch:    s.serverAfterSearch,
+		ObserveSearch:  s.serverObserveSearch,
+	}
+	cfg.Tenants = serverTenants(s.Config())
+	if strings.TrimSpace(opts.ReplicaSource) != "" {
+		cfg.Ingest = nil
+		cfg.Feedback = nil
+		cfg.Replica = s.serverReplica
+	}
+	if s.answerConfigured() {
+		cfg.Answer = s.serverAnswer
+		cfg.AnswerTopK = s.Config().Answer.TopK
+	}
+	if format := strings.TrimSpace(opts.AccessLogFormat); format != "" {
+		cfg.AccessLogFormat = format
+		cfg.AccessLog = opts.AccessLog
+		if cfg.AccessLog == nil {
+			cfg.AccessLog = os.Stdout
+		}
 	}
 
-	srv, err := server.New(s.db, enc, cfg)
+	encoders := func() (embedding.Embedder, func(), error) {
+		return s.acquireEncoder()
+	}
+	srv, err := server.New(s.db, encoders, cfg)
 	if err != nil {
 		return nil, err
 	}
-	return &APIServer{server: srv}, nil
+	s.onInvalidate(srv.PurgeDatasetCaches)
+	return &APIServer{server: srv, svc: s, opts: opts}, nil
+}
+
+// serverTenants maps the tenants of cfg to the server's, with their datasets
+// resolved to tables, which is what HTTP clients pass as the dataset.
+func serverTenants(cfg *config.Config) []server.Tenant {
+	if cfg == nil || len(cfg.Tenants) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(cfg.Tenants))
+	for name := range cfg.Tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tenants := make([]server.Tenant, 0, len(names))
+	for _, name := range names {
+		tc := cfg.Tenants[name]
+		tenant := server.Tenant{
+			Name:    name,
+			APIKeys: tc.APIKeys,
+			TopK:    tc.DefaultTopK,
+			MaxTopK: tc.MaxTopK,
+			Rate:    tc.RequestsPerSecond,
+			Burst:   tc.Burst,
+		}
+		for _, dataset := range tc.Datasets {
+			dataset = strings.TrimSpace(dataset)
+			tenant.Datasets = append(tenant.Datasets, resolveTable(dataset, cfg.Datasets[dataset], ""))
+		}
+		if dataset := strings.TrimSpace(tc.DefaultDataset); dataset != "" {
+			tenant.Dataset = resolveTable(dataset, cfg.Datasets[dataset], "")
+		}
+		tenants = append(tenants, tenant)
+	}
+	return tenants
+}
+
+// serverDefaults resolves the search defaults of the HTTP server: the options
+// first, then the current configuration.
+func (s *Service) serverDefaults(opts ServeOptions) server.Defaults {
+	cfg := s.Config()
+	datasetName, datasetCfg, _ := resolveDataset(cfg, opts.Dataset)
+	var global config.SearchConfig
+	if cfg != nil {
+		global = cfg.Search
+	}
+	sparseWeight := opts.SparseWeight
+	if sparseWeight == 0 {
+		sparseWeight = global.SparseWeight
+	}
+	defaults := server.Defaults{
+		Dataset: resolveTable(datasetName, datasetCfg, opts.Table),
+		Search: server.SearchDefaults{
+			TopK:               firstPositive(opts.TopK, global.DefaultTopK, 10),
+			SparseWeight:       sparseWeight,
+			Metric:             global.Metric,
+			MinScore:           global.MinScore,
+			ScorePrecision:     global.ScorePrecision,
+			ScoreNormalization: global.ScoreNormalization,
+			StrictFilters:      global.StrictFilters,
+			FieldBoosts:        global.FieldBoosts,
+		},
+	}
+	if cfg == nil {
+		return defaults
+	}
+	// Per-dataset settings are keyed by table, which is what HTTP clients
+	// pass as the dataset. Settings given as options stay in force.
+	for name, ds := range cfg.Datasets {
+		if ds.Cache != nil {
+			if defaults.Caches == nil {
+				defaults.Caches = make(map[string]server.DatasetCache)
+			}
+			defaults.Caches[resolveTable(name, ds, "")] = server.DatasetCache{
+				TTL:          time.Duration(ds.Cache.TTLSeconds) * time.Second,
+				Size:         ds.Cache.MaxEntries,
+				BypassHeader: strings.TrimSpace(ds.Cache.BypassHeader),
+			}
+		}
+		override := ds.Search
+		dicts := cfg.DictionariesFor(name)
+		if reflect.DeepEqual(override, config.SearchConfig{}) && dicts.Stopwords == nil && dicts.TermBoosts == nil && len(ds.Languages) == 0 {
+			continue
+		}
+		if opts.TopK > 0 {
+			override.DefaultTopK = 0
+		}
+		if opts.SparseWeight != 0 {
+			override.SparseWeight = 0
+		}
+		if defaults.Datasets == nil {
+			defaults.Datasets = make(map[string]server.SearchDefaults)
+		}
+		defaults.Datasets[resolveTable(name, ds, "")] = server.SearchDefaults{
+			TopK:               override.DefaultTopK,
+			SparseWeight:       override.SparseWeight,
+			Metric:             override.Metric,
+			MinScore:           override.MinScore,
+			ScorePrecision:     override.ScorePrecision,
+			ScoreNormalization: override.ScoreNormalization,
+			StrictFilters:      override.StrictFilters,
+			FieldBoosts:        override.FieldBoosts,
+			Stopwords:          dicts.Stopwords,
+			TermBoosts:         dicts.TermBoosts,
+			Languages:          ds.Languages,
+		}
+	}
+	return defaults
 }
 
 // StartServer optionally ingests data from the configuration and starts the HTTP
@@ -97,35 +350,284 @@ func (s *Service) StartServer(ctx context.Context, opts ServeOptions) error {
 	if ctx == nil {
 		return fmt.Errorf("context must not be nil")
 	}
+	// The gRPC API has no notion of tenants and would bypass their isolation.
+	if cfg := s.Config(); cfg != nil && len(cfg.Tenants) > 0 && strings.TrimSpace(opts.GRPCAddress) != "" {
+		return fmt.Errorf("the gRPC API cannot be served when tenants are configured")
+	}
 
 	if err := s.ensureDatabase(ctx); err != nil {
 		return err
 	}
 
-	datasetName, datasetCfg, hasDataset := resolveDataset(s.cfg, opts.Dataset)
+	datasetName, datasetCfg, hasDataset := resolveDataset(s.Config(), opts.Dataset)
 	table := resolveTable(datasetName, datasetCfg, opts.Table)
 
+	replicaSource := strings.TrimSpace(opts.ReplicaSource)
+	replicaInterval := opts.ReplicaInterval
+	if replicaInterval <= 0 {
+		replicaInterval = defaultReplicaInterval
+	}
+	if replicaSource != "" {
+		s.replica.mu.Lock()
+		s.replica.status.Interval = replicaInterval.String()
+		s.replica.mu.Unlock()
+		if _, err := s.SyncReplica(ctx, replicaSource); err != nil {
+			return fmt.Errorf("replica sync: %w", err)
+		}
+		s.log.Info("replica synchronized", "source", replicaSource, "version", s.ReplicaStatus().Version)
+	}
+
 	autoIngest := true
 	if opts.AutoIngest != nil {
 		autoIngest = *opts.AutoIngest
 	}
 
-	if autoIngest && hasDataset && strings.TrimSpace(datasetCfg.CSV) != "" {
+	if autoIngest && replicaSource == "" && hasDataset && strings.TrimSpace(datasetCfg.CSV) != "" {
 		if _, err := s.Ingest(ctx, IngestOptions{Dataset: datasetName, Table: table}); err != nil {
 			return err
 		}
 	}
 
+	// Pass the dataset and table as given so that the server follows the
+	// default dataset and mappings of a reloaded configuration.
 	apiServer, err := s.NewAPIServer(ServeOptions{
 		Address:         opts.Address,
-		Dataset:         datasetName,
-		Table:           table,
+		Dataset:         opts.Dataset,
+		Table:           opts.Table,
 		TopK:            opts.TopK,
+		SparseWeight:    opts.SparseWeight,
 		RequestTimeout:  opts.RequestTimeout,
 		ShutdownTimeout: opts.ShutdownTimeout,
+		AdminToken:      opts.AdminToken,
+		RateLimit:       opts.RateLimit,
+		TLSCertFile:     opts.TLSCertFile,
+		TLSKeyFile:      opts.TLSKeyFile,
+		MaxUploadBytes:  opts.MaxUploadBytes,
+		DisableUI:       opts.DisableUI,
+		AccessLogFormat: opts.AccessLogFormat,
+		AccessLog:       opts.AccessLog,
+		MaxInFlight:     opts.MaxInFlight,
+		MaxQueue:        opts.MaxQueue,
+		CacheTTL:        opts.CacheTTL,
+		CacheSize:       opts.CacheSize,
+		ReplicaSource:   replicaSource,
 	})
 	if err != nil {
 		return err
 	}
-	return apiServer.Serve(ctx)
+	reloadCtx, stopReload := context.WithCancel(ctx)
+	defer stopReload()
+	if replicaSource != "" {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			s.runReplica(reloadCtx, replicaSource, replicaInterval, apiServer.server.PurgeCache)
+		}()
+		defer func() {
+			stopReload()
+			<-done
+		}()
+	}
+	if !opts.DisableSchedules && replicaSource == "" {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			s.runSchedules(reloadCtx, apiServer.server.PurgeCache)
+		}()
+		// Let running ingests finish before the Service can be closed.
+		defer func() {
+			stopReload()
+			<-done
+		}()
+	}
+	reload := func(trigger string) {
+		changes, err := apiServer.ReloadConfig()
+		s.logConfigReload(trigger, changes, err)
+	}
+	if opts.WatchConfig > 0 {
+		go s.watchConfig(reloadCtx, opts.WatchConfig, reload)
+	}
+	if opts.ReloadConfig != nil {
+		go func() {
+			for {
+				select {
+				case <-reloadCtx.Done():
+					return
+				case <-opts.ReloadConfig:
+					reload("manual")
+				}
+			}
+		}()
+	}
+
+	if strings.TrimSpace(opts.GRPCAddress) == "" {
+		return apiServer.Serve(ctx)
+	}
+
+	grpcServer, err := s.NewGRPCServer(GRPCOptions{
+		Address:         opts.GRPCAddress,
+		Dataset:         opts.Dataset,
+		TopK:            opts.TopK,
+		RequestTimeout:  opts.RequestTimeout,
+		ShutdownTimeout: opts.ShutdownTimeout,
+		AdminToken:      opts.AdminToken,
+		TLSCertFile:     opts.TLSCertFile,
+		TLSKeyFile:      opts.TLSKeyFile,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Run both listeners until the context is cancelled or either of them
+	// fails, in which case the other one is shut down as well.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errCh := make(chan error, 2)
+	go func() { errCh <- apiServer.Serve(ctx) }()
+	go func() { errCh <- grpcServer.Serve(ctx) }()
+
+	var firstErr error
+	for i := 0; i < 2; i++ {
+		if err := <-errCh; err != nil && firstErr == nil {
+			firstErr = err
+		}
+		cancel()
+	}
+	return firstErr
+}
+
+func (s *Service) reloadModel(ctx context.Context, req server.ReloadRequest) (server.ReloadRequest, error) {
+	err := s.ReloadEncoder(ctx, EncoderConfig{
+		OrtLibrary:        req.OrtLibrary,
+		ModelPath:         req.ModelPath,
+		TokenizerPath:     req.TokenizerPath,
+		MaxSequenceLength: req.MaxSeqLen,
+		SparseHeadPath:    req.SparseHead,
+		Truncation:        req.Truncation,
+		Normalize:         req.Normalize,
+	})
+	if err != nil {
+		return server.ReloadRequest{}, err
+	}
+	return encoderView(s.EncoderConfig()), nil
+}
+
+// encoderView reports an encoder configuration in the JSON shape used by the
+// admin endpoints.
+func encoderView(cfg EncoderConfig) server.ReloadRequest {
+	return server.ReloadRequest{
+		OrtLibrary:    cfg.OrtLibrary,
+		ModelPath:     cfg.ModelPath,
+		TokenizerPath: cfg.TokenizerPath,
+		MaxSeqLen:     cfg.MaxSequenceLength,
+		SparseHead:    cfg.SparseHeadPath,
+		Truncation:    cfg.Truncation,
+		Normalize:     cfg.Normalize,
+	}
+}
+
+func (s *Service) serverEmbed(ctx context.Context, req server.EmbedRequest) ([]server.Embedding, error) {
+	embeddings, err := s.Embed(ctx, EmbedOptions{Texts: req.Texts, Sparse: req.Sparse})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]server.Embedding, len(embeddings))
+	for i, e := range embeddings {
+		out[i] = server.Embedding(e)
+	}
+	return out, nil
+}
+
+// serverModel hands the HTTP server the encoder of a search of table that
+// names a registered model.
+func (s *Service) serverModel(ctx context.Context, table, name string) (embedding.Embedder, func(), error) {
+	return s.queryEncoder(ctx, table, name)
+}
+
+func (s *Service) serverDatasets(ctx context.Context) ([]server.DatasetInfo, error) {
+	datasets, err := s.Datasets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]server.DatasetInfo, len(datasets))
+	for i, ds := range datasets {
+		out[i] = server.DatasetInfo(ds)
+	}
+	return out, nil
+}
+
+func (s *Service) ingestUpload(ctx context.Context, req server.IngestRequest) (server.IngestResult, error) {
+	summary, err := s.Ingest(ctx, IngestOptions{
+		Dataset:         req.Dataset,
+		Table:           req.Table,
+		CSVPath:         req.CSVPath,
+		BatchSize:       req.BatchSize,
+		IDColumn:        req.IDColumn,
+		TextColumns:     req.TextColumns,
+		MetadataColumns: req.MetadataColumns,
+		LatitudeColumn:  req.LatColumn,
+		LongitudeColumn: req.LngColumn,
+		Sparse:          req.Sparse,
+		Duplicates:      req.Duplicates,
+	})
+	if err != nil {
+		return server.IngestResult{}, err
+	}
+	return server.IngestResult{
+		Dataset:    summary.Dataset,
+		Table:      summary.Table,
+		Upserted:   summary.Upserted,
+		Skipped:    summary.Skipped,
+		Dropped:    summary.Dropped,
+		Duplicates: summary.DuplicateRows,
+	}, nil
+}
+
+// serverMaintenance adapts the Service maintenance operations to the
+// server.Maintenance interface.
+type serverMaintenance struct{ s *Service }
+
+func (m serverMaintenance) Reindex(ctx context.Context, req server.ReindexRequest) (server.ReindexResult, error) {
+	summary, err := m.s.Reindex(ctx, ReindexOptions{FTS: req.FTS, RTree: req.RTree, Pages: req.Pages, Vectors: req.Vectors})
+	if err != nil {
+		return server.ReindexResult{}, err
+	}
+	result := server.ReindexResult{RTreeRows: summary.RTreeRows, FTSRemoved: summary.FTSRemoved, FTSAdded: summary.FTSAdded, VectorPages: summary.VectorPages, TrigramRows: summary.TrigramRows}
+	if summary.Vectors != nil {
+		result.Vectors = summary.Vectors
+	}
+	return result, nil
+}
+
+func (m serverMaintenance) Reembed(ctx context.Context, req server.ReembedRequest) (int, error) {
+	summary, err := m.s.Reembed(ctx, ReembedOptions{
+		Dataset:   req.Dataset,
+		BatchSize: req.BatchSize,
+		Sparse:    req.Sparse,
+		StaleOnly: req.StaleOnly,
+	})
+	return summary.Records, err
+}
+
+func (m serverMaintenance) Compact(ctx context.Context) (int64, int64, error) {
+	summary, err := m.s.Compact(ctx)
+	return summary.BytesBefore, summary.BytesAfter, err
+}
+
+func (m serverMaintenance) Backup(ctx context.Context, path string) (string, int64, error) {
+	summary, err := m.s.Backup(ctx, BackupOptions{Path: path})
+	return summary.Path, summary.Bytes, err
+}
+
+func (m serverMaintenance) Settings() any {
+	settings := map[string]any{
+		"database_path": m.s.DatabasePath(),
+		"encoder":       encoderView(m.s.EncoderConfig()),
+	}
+	if cfg, err := m.s.EffectiveConfig(); err != nil {
+		settings["config_error"] = err.Error()
+	} else {
+		settings["config"] = cfg
+	}
+	return settings
 }
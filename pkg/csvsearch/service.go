@@ -1,14 +1,21 @@
 package csvsearch
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"log/slog"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"yashubustudio/csv-search/emb"
+	"yashubustudio/csv-search/internal/cache"
 	"yashubustudio/csv-search/internal/config"
 	"yashubustudio/csv-search/internal/database"
+	"yashubustudio/csv-search/internal/querylog"
+	intsearch "yashubustudio/csv-search/internal/search"
 )
 
 // ConfigReference describes how to load an optional JSON configuration file.
@@ -22,6 +29,10 @@ type ConfigReference struct {
 type DatabaseOptions struct {
 	Path   string
 	Handle *sql.DB
+	// Readers bounds the read-only connections that serve searches next to
+	// the single writer connection (one per CPU when zero). A caller-supplied
+	// Handle serves searches itself.
+	Readers int
 }
 
 // EncoderConfig lists the assets required to initialize the ONNX encoder.
@@ -30,13 +41,31 @@ type EncoderConfig struct {
 	ModelPath         string
 	TokenizerPath     string
 	MaxSequenceLength int
+	// SparseHeadPath enables bge-m3 lexical weights (see emb.Config).
+	SparseHeadPath string
+	// Truncation is "head", "tail" or "middle" (see emb.Config).
+	Truncation string
+	// Normalize lists text normalization steps applied before encoding:
+	// "nfkc", "width" (full-width → half-width) and "space" (collapse
+	// whitespace). It also applies to injected embedders.
+	Normalize []string
+	// ModelVersion identifies the model in stored embeddings so that
+	// Reembed can find vectors produced by another model. It defaults to the
+	// model file name; set it for injected embedders or to distinguish
+	// exports that share a file name.
+	ModelVersion string
 }
 
 // EncoderOptions lets callers pass a pre-configured encoder or request the
 // library to lazily create one from EncoderConfig or the JSON configuration.
+// Embedder takes precedence over Instance; neither is closed by the Service.
 type EncoderOptions struct {
+	Embedder Embedder
 	Instance *emb.Encoder
 	Config   EncoderConfig
+	// Models register further encoders by name for SearchOptions.Model, in
+	// addition to those of the embedding.models config.
+	Models map[string]ModelOptions
 }
 
 // ServiceOptions groups the dependencies required to build a Service.
@@ -44,22 +73,62 @@ type ServiceOptions struct {
 	Config   ConfigReference
 	Database DatabaseOptions
 	Encoder  EncoderOptions
+	QueryLog QueryLogOptions
+	// ResultCache enables the in-process cache of search results.
+	ResultCache ResultCacheOptions
+	// Logger receives the log messages of the Service and the servers and
+	// background work it starts (slog.Default() when nil).
+	Logger *slog.Logger
+	// Metrics, when set, receives encode, scan, request and ingest
+	// telemetry, including the searches of the servers built from the
+	// Service.
+	Metrics Metrics
 }
 
 // Service exposes high level helpers that can be embedded into another Go
 // application. The struct owns the database and encoder resources when it
 // creates them and will release them on Close.
+//
+// A Service is safe for concurrent use: the schema and the encoder are
+// initialized once even when the first calls race, and Close may run while
+// other calls are in flight. Close waits for running encodes before it
+// releases the encoder; calls made afterwards fail with ErrClosed.
 type Service struct {
-	cfg          *config.Config
+	cfg          atomic.Pointer[config.Config] // swapped by ReloadConfig
+	cfgRef       ConfigReference
+	cfgMu        sync.Mutex // serializes ReloadConfig
 	db           *sql.DB
+	reader       *sql.DB // read-only pool behind engine; db when the handle was supplied
 	dbPath       string
 	closeDB      bool
-	encoder      *emb.Encoder
+	engine       *intsearch.Engine // caches the prepared search statements
+	results      *cache.LRU[[]Result]
+	encMu        sync.RWMutex // guards encoder/closeEncoder/encoderCfg; readers hold it while encoding
+	encoder      Embedder
 	closeEncoder bool
 	encoderCfg   EncoderConfig
+	reloadMu     sync.Mutex
+	models       *models
 
 	dbReadyMu sync.RWMutex
 	dbReady   bool
+	dbInitMu  sync.Mutex // serializes the lazy schema initialization
+
+	closed    atomic.Bool
+	closeOnce sync.Once
+	closeErr  error
+
+	metrics   *serviceMetrics
+	telemetry Metrics
+	queryLog  *querylog.Logger
+	log       *slog.Logger
+
+	hooksMu sync.RWMutex
+	hooks   serviceHooks
+
+	scheduler scheduler
+	replica   replica
+	webhooks  webhookQueue
 }
 
 // NewService loads the optional JSON configuration file, opens the database (if
@@ -74,45 +143,102 @@ func NewService(opts ServiceOptions) (*Service, error) {
 	if err != nil {
 		return nil, err
 	}
+	reader := db
+	if closeDB {
+		if reader, err = database.OpenReader(dbPath, opts.Database.Readers); err != nil {
+			db.Close()
+			return nil, withKind(ErrDatabase, err)
+		}
+	}
 
 	svc := &Service{
-		cfg:          cfg,
-		db:           db,
-		dbPath:       dbPath,
-		closeDB:      closeDB,
-		encoder:      opts.Encoder.Instance,
-		closeEncoder: opts.Encoder.Instance == nil && (opts.Encoder.Config != EncoderConfig{}),
+		cfgRef:    opts.Config,
+		db:        db,
+		reader:    reader,
+		dbPath:    dbPath,
+		closeDB:   closeDB,
+		engine:    intsearch.NewEngine(reader),
+		results:   cache.New[[]Result](opts.ResultCache.TTL, opts.ResultCache.Size),
+		encoder:   opts.Encoder.Embedder,
+		log:       opts.Logger,
+		telemetry: opts.Metrics,
+	}
+	if svc.log == nil {
+		svc.log = slog.Default()
+	}
+	svc.cfg.Store(cfg)
+	svc.metrics = newServiceMetrics(svc)
+	if svc.queryLog, err = newQueryLogger(cfg, svc, opts.QueryLog); err != nil {
+		svc.closeDatabase()
+		return nil, err
+	}
+	if svc.encoder == nil && opts.Encoder.Instance != nil {
+		svc.encoder = WrapEncoder(opts.Encoder.Instance)
 	}
 
 	svc.encoderCfg = resolveEncoderConfig(cfg, opts.Encoder.Config)
-	if svc.encoder != nil {
-		svc.closeEncoder = false
+	if svc.encoder, err = withNormalization(svc.encoder, svc.encoderCfg.Normalize); err != nil {
+		svc.closeDatabase()
+		return nil, err
+	}
+	if svc.models, err = newModels(cfg, opts.Encoder.Models); err != nil {
+		svc.closeDatabase()
+		return nil, err
 	}
 
 	return svc, nil
 }
 
 // Close releases any resources that were created by the Service instance.
+// It is safe to call more than once and concurrently with other methods.
 func (s *Service) Close() error {
-	var firstErr error
-	if s.closeEncoder && s.encoder != nil {
-		s.encoder.Close()
+	s.closeOnce.Do(func() {
+		s.closed.Store(true)
+		s.setDatabaseReady(false)
+		s.webhooks.close()
+		// Flush pending query log entries while the database is still open.
+		if err := s.queryLog.Close(); err != nil {
+			s.closeErr = err
+		}
+		// Taking the write lock waits for the encodes in flight.
+		s.encMu.Lock()
+		if s.closeEncoder && s.encoder != nil {
+			if err := s.encoder.Close(); err != nil {
+				s.closeErr = err
+			}
+		}
 		s.encoder = nil
-	}
-	if s.closeDB && s.db != nil {
-		if err := s.db.Close(); err != nil && firstErr == nil {
-			firstErr = err
+		s.closeEncoder = false
+		s.encMu.Unlock()
+		if err := s.models.close(); err != nil && s.closeErr == nil {
+			s.closeErr = err
 		}
-		s.db = nil
-		s.dbPath = ""
-		s.setDatabaseReady(false)
+		if err := s.engine.Close(); err != nil && s.closeErr == nil {
+			s.closeErr = err
+		}
+		if err := s.closeDatabase(); err != nil && s.closeErr == nil {
+			s.closeErr = err
+		}
+	})
+	return s.closeErr
+}
+
+// closeDatabase closes the database handles opened by NewService.
+func (s *Service) closeDatabase() error {
+	if !s.closeDB {
+		return nil
+	}
+	err := s.reader.Close()
+	if cerr := s.db.Close(); cerr != nil {
+		err = cerr
 	}
-	return firstErr
+	return err
 }
 
-// Config returns the loaded configuration (if any).
+// Config returns the loaded configuration (if any). The returned value is
+// replaced, not modified, by ReloadConfig.
 func (s *Service) Config() *config.Config {
-	return s.cfg
+	return s.cfg.Load()
 }
 
 // DB exposes the underlying database handle.
@@ -126,12 +252,77 @@ func (s *Service) DatabasePath() string {
 	return s.dbPath
 }
 
-// Encoder returns the lazily created encoder instance, initializing it if
-// necessary.
-func (s *Service) Encoder() (*emb.Encoder, error) {
+// Encoder returns the lazily created embedder, initializing the ONNX encoder if
+// necessary. The instance may be retired by ReloadEncoder; long-lived callers
+// should go through the Service methods instead of caching it.
+func (s *Service) Encoder() (Embedder, error) {
 	return s.ensureEncoder()
 }
 
+// EncoderConfig returns the asset paths of the active encoder configuration.
+func (s *Service) EncoderConfig() EncoderConfig {
+	s.encMu.RLock()
+	defer s.encMu.RUnlock()
+	return s.encoderCfg
+}
+
+// ModelVersion returns the identifier stored with new embeddings: the
+// configured ModelVersion or the model file name ("" when unknown).
+func (s *Service) ModelVersion() string {
+	return modelVersion(s.EncoderConfig())
+}
+
+func modelVersion(cfg EncoderConfig) string {
+	if v := strings.TrimSpace(cfg.ModelVersion); v != "" {
+		return v
+	}
+	if cfg.ModelPath == "" {
+		return ""
+	}
+	return filepath.Base(cfg.ModelPath)
+}
+
+// ReloadEncoder initializes a new encoder from cfg and swaps it in atomically.
+// Empty fields in cfg keep their current values. The previous encoder keeps
+// serving requests until the replacement is ready; the swap then waits for the
+// in-flight encodes to finish before the old instance is closed. On failure the
+// active encoder is left untouched.
+func (s *Service) ReloadEncoder(ctx context.Context, cfg EncoderConfig) error {
+	if ctx == nil {
+		return fmt.Errorf("context must not be nil")
+	}
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	next := mergeEncoderConfig(s.EncoderConfig(), cfg)
+	enc, err := newEncoder(next)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		enc.Close()
+		return err
+	}
+
+	s.encMu.Lock()
+	if s.closed.Load() {
+		s.encMu.Unlock()
+		enc.Close()
+		return ErrClosed
+	}
+	old, closeOld := s.encoder, s.closeEncoder
+	s.encoder = enc
+	s.closeEncoder = true
+	s.encoderCfg = next
+	s.encMu.Unlock()
+	s.invalidateResults()
+
+	if closeOld && old != nil {
+		return old.Close()
+	}
+	return nil
+}
+
 func prepareDatabase(cfg *config.Config, opts DatabaseOptions) (*sql.DB, string, bool, error) {
 	if opts.Handle != nil {
 		return opts.Handle, strings.TrimSpace(opts.Path), false, nil
@@ -142,7 +333,7 @@ func prepareDatabase(cfg *config.Config, opts DatabaseOptions) (*sql.DB, string,
 	}
 	db, err := database.Open(path)
 	if err != nil {
-		return nil, path, false, err
+		return nil, path, false, withKind(ErrDatabase, err)
 	}
 	return db, path, true, nil
 }
@@ -154,48 +345,145 @@ func resolveEncoderConfig(cfg *config.Config, opts EncoderConfig) EncoderConfig
 		resolved.ModelPath = cfg.ResolvePath(cfg.Embedding.Model)
 		resolved.TokenizerPath = cfg.ResolvePath(cfg.Embedding.Tokenizer)
 		resolved.MaxSequenceLength = cfg.Embedding.MaxSeqLen
+		resolved.SparseHeadPath = cfg.ResolvePath(cfg.Embedding.SparseHead)
+		resolved.Truncation = cfg.Embedding.Truncation
+		resolved.Normalize = cloneStrings(cfg.Embedding.Normalize)
+		resolved.ModelVersion = cfg.Embedding.ModelVersion
 	}
 
-	if opts.OrtLibrary != "" {
-		resolved.OrtLibrary = opts.OrtLibrary
+	return mergeEncoderConfig(resolved, opts)
+}
+
+// mergeEncoderConfig overlays the non-empty fields of override onto base.
+func mergeEncoderConfig(base, override EncoderConfig) EncoderConfig {
+	if override.OrtLibrary != "" {
+		base.OrtLibrary = override.OrtLibrary
 	}
-	if opts.ModelPath != "" {
-		resolved.ModelPath = opts.ModelPath
+	if override.ModelPath != "" {
+		if override.ModelPath != base.ModelPath {
+			// A different model invalidates the configured version.
+			base.ModelVersion = ""
+		}
+		base.ModelPath = override.ModelPath
 	}
-	if opts.TokenizerPath != "" {
-		resolved.TokenizerPath = opts.TokenizerPath
+	if override.TokenizerPath != "" {
+		base.TokenizerPath = override.TokenizerPath
 	}
-	if opts.MaxSequenceLength > 0 {
-		resolved.MaxSequenceLength = opts.MaxSequenceLength
+	if override.MaxSequenceLength > 0 {
+		base.MaxSequenceLength = override.MaxSequenceLength
 	}
+	if override.SparseHeadPath != "" {
+		base.SparseHeadPath = override.SparseHeadPath
+	}
+	if override.Truncation != "" {
+		base.Truncation = override.Truncation
+	}
+	if len(override.Normalize) > 0 {
+		base.Normalize = cloneStrings(override.Normalize)
+	}
+	if override.ModelVersion != "" {
+		base.ModelVersion = override.ModelVersion
+	}
+	return base
+}
 
-	return resolved
+// encoderConfigured reports whether the Service holds an encoder or the
+// asset paths needed to create one.
+func (s *Service) encoderConfigured() bool {
+	s.encMu.RLock()
+	defer s.encMu.RUnlock()
+	cfg := s.encoderCfg
+	return s.encoder != nil || (cfg.OrtLibrary != "" && cfg.ModelPath != "" && cfg.TokenizerPath != "")
 }
 
-func (s *Service) ensureEncoder() (*emb.Encoder, error) {
+// ensureEncoderAtStart initializes the encoder of a server about to start so
+// that configuration errors surface before it listens. Without model assets
+// the server still starts, serving the searches that need no encoder.
+func (s *Service) ensureEncoderAtStart() error {
+	if !s.encoderConfigured() {
+		s.log.Warn("encoder is not configured; only keyword and filter searches are available")
+		return nil
+	}
+	_, err := s.ensureEncoder()
+	return err
+}
+
+func (s *Service) ensureEncoder() (Embedder, error) {
+	s.encMu.RLock()
+	enc := s.encoder
+	s.encMu.RUnlock()
+	if enc != nil {
+		return enc, nil
+	}
+
+	s.encMu.Lock()
+	defer s.encMu.Unlock()
+	if s.closed.Load() {
+		return nil, ErrClosed
+	}
 	if s.encoder != nil {
 		return s.encoder, nil
 	}
+	enc, err := newEncoder(s.encoderCfg)
+	if err != nil {
+		return nil, withKind(ErrEncoder, err)
+	}
 
-	cfg := s.encoderCfg
+	s.encoder = enc
+	s.closeEncoder = true
+	return enc, nil
+}
+
+// acquireModel is acquireEncoder that also reports the model version of the
+// returned encoder.
+func (s *Service) acquireModel() (Embedder, string, func(), error) {
+	enc, release, err := s.acquireEncoder()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	// The read lock taken by acquireEncoder keeps encoderCfg consistent with enc.
+	return enc, modelVersion(s.encoderCfg), release, nil
+}
+
+// acquireEncoder returns the active encoder together with a release function
+// that must be called once the caller stops using it. While held, ReloadEncoder
+// will not close the instance.
+func (s *Service) acquireEncoder() (Embedder, func(), error) {
+	if _, err := s.ensureEncoder(); err != nil {
+		return nil, nil, err
+	}
+	s.encMu.RLock()
+	if s.encoder == nil {
+		s.encMu.RUnlock()
+		return nil, nil, ErrClosed
+	}
+	return s.encoder, s.encMu.RUnlock, nil
+}
+
+func newEncoder(cfg EncoderConfig) (Embedder, error) {
 	if cfg.OrtLibrary == "" || cfg.ModelPath == "" || cfg.TokenizerPath == "" {
 		return nil, fmt.Errorf("encoder configuration is incomplete")
 	}
 
 	enc := &emb.Encoder{}
 	encoderCfg := emb.Config{
-		OrtDLL:        cfg.OrtLibrary,
-		ModelPath:     cfg.ModelPath,
-		TokenizerPath: cfg.TokenizerPath,
-		MaxSeqLen:     cfg.MaxSequenceLength,
+		OrtDLL:         cfg.OrtLibrary,
+		ModelPath:      cfg.ModelPath,
+		TokenizerPath:  cfg.TokenizerPath,
+		MaxSeqLen:      cfg.MaxSequenceLength,
+		SparseHeadPath: cfg.SparseHeadPath,
+		Truncation:     cfg.Truncation,
 	}
 	if err := enc.Init(encoderCfg); err != nil {
+		enc.Close()
 		return nil, err
 	}
-
-	s.encoder = enc
-	s.closeEncoder = true
-	return enc, nil
+	wrapped, err := withNormalization(WrapEncoder(enc), cfg.Normalize)
+	if err != nil {
+		enc.Close()
+		return nil, err
+	}
+	return wrapped, nil
 }
 
 func (s *Service) setDatabaseReady(ready bool) {
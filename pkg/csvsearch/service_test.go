@@ -0,0 +1,130 @@
+package csvsearch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestServiceConcurrentUse(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	var csv strings.Builder
+	csv.WriteString("id,title\n")
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&csv, "%d,%s\n", i, strings.Repeat("a", i+1))
+	}
+	csvPath := filepath.Join(dir, "docs.csv")
+	if err := os.WriteFile(csvPath, []byte(csv.String()), 0o600); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+
+	svc, err := NewService(ServiceOptions{
+		Database: DatabaseOptions{Path: filepath.Join(dir, "app.db")},
+		Encoder:  EncoderOptions{Embedder: fakeEmbedder{dim: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	// The first calls race on the lazy schema initialization.
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "aaa"}); err != nil && !errors.Is(err, ErrNotFound) {
+				errs <- fmt.Errorf("Search: %w", err)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := svc.Ingest(ctx, IngestOptions{Dataset: "docs", CSVPath: csvPath, TextColumns: []string{"title"}}); err != nil {
+			errs <- fmt.Errorf("Ingest: %w", err)
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if t.Failed() {
+		t.FailNow()
+	}
+
+	// Close while searches are running: each search either completes or
+	// fails, and none panics on released resources.
+	start := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for j := 0; j < 20; j++ {
+				svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "aaa"})
+				svc.Similar(ctx, SimilarOptions{Dataset: "docs", ID: "3"})
+			}
+		}()
+	}
+	wg.Add(2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer wg.Done()
+			<-start
+			if err := svc.Close(); err != nil {
+				t.Errorf("Close: %v", err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if _, err := svc.Search(ctx, SearchOptions{Dataset: "docs", Query: "aaa"}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed after Close, got %v", err)
+	}
+	if err := svc.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+}
+
+func TestNewWithOptions(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(cfgPath, []byte(`{"database": {"path": "from-config.db"}, "default_dataset": "docs", "datasets": {"docs": {}}}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	dbPath := filepath.Join(dir, "app.db")
+	embedder := fakeEmbedder{dim: 2}
+
+	svc, err := New(
+		WithConfigFile(cfgPath),
+		WithDatabasePath(dbPath),
+		WithEmbedder(embedder),
+		WithQueryLog(0),
+	)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer svc.Close()
+	if got := svc.DatabasePath(); got != dbPath {
+		t.Fatalf("expected the database path option to win over the config, got %q", got)
+	}
+	if svc.Config().DefaultDataset != "docs" {
+		t.Fatalf("expected the config file to be loaded, got %+v", svc.Config())
+	}
+	if enc, err := svc.Encoder(); err != nil || enc == nil {
+		t.Fatalf("expected the injected embedder, got %v, %v", enc, err)
+	}
+
+	if _, err := New(WithConfigFile(filepath.Join(dir, "missing.json"))); !errors.Is(err, ErrConfig) {
+		t.Fatalf("expected ErrConfig for a missing config file, got %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package csvsearch
+
+import (
+	"context"
+
+	"yashubustudio/csv-search/internal/database"
+)
+
+// Stats summarises the database backing the Service.
+type Stats struct {
+	DatabasePath  string        `json:"database_path"`
+	SizeBytes     int64         `json:"size_bytes"`
+	SchemaVersion int           `json:"schema_version"`
+	Datasets      []DatasetInfo `json:"datasets"`
+}
+
+// Stats reports the database size, schema version and the per-dataset record,
+// vector, full-text and spatial index counts.
+func (s *Service) Stats(ctx context.Context) (Stats, error) {
+	if err := s.ready(ctx); err != nil {
+		return Stats{}, err
+	}
+	size, err := database.Size(ctx, s.db)
+	if err != nil {
+		return Stats{}, err
+	}
+	version, err := database.Version(ctx, s.db)
+	if err != nil {
+		return Stats{}, err
+	}
+	datasets, err := s.Datasets(ctx)
+	if err != nil {
+		return Stats{}, err
+	}
+	if datasets == nil {
+		datasets = []DatasetInfo{}
+	}
+	return Stats{
+		DatabasePath:  s.dbPath,
+		SizeBytes:     size,
+		SchemaVersion: version,
+		Datasets:      datasets,
+	}, nil
+}
@@ -0,0 +1,225 @@
+package csvsearch
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"yashubustudio/csv-search/internal/ingest"
+	"yashubustudio/csv-search/internal/store"
+	"yashubustudio/csv-search/internal/vector"
+)
+
+// Vector interchange formats accepted by ExportVectors and ImportVectors.
+// Both store the vectors in the order of an IDs file with one record ID per
+// line.
+const (
+	// VectorsNPY is a NumPy .npy float32 matrix with one row per record
+	// (float64 is accepted on import).
+	VectorsNPY = "npy"
+	// VectorsFvecs is the .fvecs format of Faiss and the ANN benchmarks.
+	VectorsFvecs = "fvecs"
+)
+
+// VectorFormat returns the interchange format suggested by the extension of
+// path: VectorsFvecs for .fvecs, VectorsNPY otherwise.
+func VectorFormat(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".fvecs") {
+		return VectorsFvecs
+	}
+	return VectorsNPY
+}
+
+// VectorExportOptions select the dataset whose embeddings ExportVectors
+// writes. Format defaults to VectorsNPY.
+type VectorExportOptions struct {
+	Dataset string
+	Table   string
+	Format  string
+}
+
+// VectorImportOptions control ImportVectors. Format defaults to VectorsNPY.
+// Model is stored with the vectors (the Service's model version when
+// empty); give the name of the external model so that Reembed with
+// StaleOnly can tell the vectors apart.
+type VectorImportOptions struct {
+	Dataset string
+	Table   string
+	Format  string
+	Model   string
+}
+
+// VectorSummary reports what ExportVectors or ImportVectors transferred.
+type VectorSummary struct {
+	Dataset   string `json:"dataset"`
+	Table     string `json:"table"`
+	Format    string `json:"format"`
+	Vectors   int    `json:"vectors"`
+	Dimension int    `json:"dimension"`
+	// Missing counts the imported IDs without a stored record.
+	Missing int `json:"missing,omitempty"`
+}
+
+// ExportVectors writes the dense embeddings of a dataset to vectors in an
+// interchange format and their record IDs, one per line, to ids, so that
+// other pipelines can build their own indexes. Records without an embedding
+// are left out.
+func (s *Service) ExportVectors(ctx context.Context, vectors, ids io.Writer, opts VectorExportOptions) (VectorSummary, error) {
+	if vectors == nil || ids == nil {
+		return VectorSummary{}, fmt.Errorf("writer is nil")
+	}
+	if err := s.ready(ctx); err != nil {
+		return VectorSummary{}, err
+	}
+	format, err := vectorFormat(opts.Format)
+	if err != nil {
+		return VectorSummary{}, err
+	}
+	datasetName, datasetCfg, _ := resolveDataset(s.Config(), opts.Dataset)
+	table := resolveTable(datasetName, datasetCfg, opts.Table)
+	summary := VectorSummary{Dataset: datasetName, Table: table, Format: format}
+
+	count, dims, err := store.VectorDimensions(ctx, s.db, table)
+	if err != nil {
+		return VectorSummary{}, err
+	}
+	switch {
+	case count == 0:
+		return VectorSummary{}, fmt.Errorf("dataset %s has no embeddings", table)
+	case len(dims) > 1:
+		return VectorSummary{}, fmt.Errorf("dataset %s holds embeddings of dimensions %v; re-embed it first", table, dims)
+	}
+	summary.Dimension = dims[0]
+	if format == VectorsNPY {
+		if err := vector.WriteNPYHeader(vectors, count, summary.Dimension); err != nil {
+			return VectorSummary{}, err
+		}
+	}
+
+	buf := vector.GetBytes()
+	defer vector.PutBytes(buf)
+	err = store.EachVector(ctx, s.db, table, func(id string, embedding []float32) error {
+		if strings.ContainsAny(id, "\r\n") {
+			return fmt.Errorf("record id %q contains a line break", id)
+		}
+		if len(embedding) != summary.Dimension {
+			return fmt.Errorf("embedding of %s changed dimension during the export", id)
+		}
+		summary.Vectors++
+		if format == VectorsFvecs {
+			if err := vector.WriteFvec(vectors, embedding); err != nil {
+				return err
+			}
+		} else {
+			if summary.Vectors > count {
+				return fmt.Errorf("dataset %s changed during the export", table)
+			}
+			*buf = vector.SerializeInto((*buf)[:0], embedding)
+			if _, err := vectors.Write(*buf); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(ids, id+"\n")
+		return err
+	})
+	if err != nil {
+		return VectorSummary{}, err
+	}
+	if format == VectorsNPY && summary.Vectors != count {
+		return VectorSummary{}, fmt.Errorf("dataset %s changed during the export", table)
+	}
+	return summary, nil
+}
+
+// ImportVectors replaces the embeddings of stored records with externally
+// computed vectors, read from vectors in an interchange format together with
+// their record IDs, one per line, from ids. The records themselves come from
+// Ingest or Import; IDs without a record are counted as Missing and skipped.
+// The vectors must have the dimension of the model that encodes queries and
+// of the dataset's other embeddings. The import is a single transaction.
+func (s *Service) ImportVectors(ctx context.Context, vectors, ids io.Reader, opts VectorImportOptions) (VectorSummary, error) {
+	if vectors == nil || ids == nil {
+		return VectorSummary{}, fmt.Errorf("reader is nil")
+	}
+	if err := s.ready(ctx); err != nil {
+		return VectorSummary{}, err
+	}
+	format, err := vectorFormat(opts.Format)
+	if err != nil {
+		return VectorSummary{}, err
+	}
+	datasetName, datasetCfg, _ := resolveDataset(s.Config(), opts.Dataset)
+	table := resolveTable(datasetName, datasetCfg, opts.Table)
+
+	readVector := func() ([]float32, error) { return vector.ReadFvec(vectors) }
+	if format == VectorsNPY {
+		npy, err := vector.NewNPYReader(vectors)
+		if err != nil {
+			return VectorSummary{}, err
+		}
+		readVector = npy.Next
+	}
+	lines := bufio.NewScanner(ids)
+	lines.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	next := func() (string, []float32, error) {
+		embedding, err := readVector()
+		if errors.Is(err, io.EOF) {
+			if lines.Scan() {
+				return "", nil, fmt.Errorf("the ids file has more lines than there are vectors")
+			}
+			if err := lines.Err(); err != nil {
+				return "", nil, err
+			}
+			return "", nil, io.EOF
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		if !lines.Scan() {
+			if err := lines.Err(); err != nil {
+				return "", nil, err
+			}
+			return "", nil, fmt.Errorf("the ids file has fewer lines than there are vectors")
+		}
+		id := strings.TrimSpace(lines.Text())
+		if id == "" {
+			return "", nil, fmt.Errorf("empty id")
+		}
+		return id, embedding, nil
+	}
+
+	importOpts := ingest.VectorImportOptions{
+		Dataset: table,
+		Model:   firstNonEmpty(strings.TrimSpace(opts.Model), s.ModelVersion()),
+	}
+	if report := s.embeddingReporter(ctx); report != nil {
+		importOpts.OnChange = func(ids []string) { report(table, ids) }
+	}
+	defer s.invalidateResults(table)
+	stats, err := ingest.ImportVectors(ctx, s.db, importOpts, next)
+	if err != nil {
+		return VectorSummary{}, err
+	}
+	return VectorSummary{
+		Dataset:   datasetName,
+		Table:     table,
+		Format:    format,
+		Vectors:   stats.Imported,
+		Dimension: stats.Dimension,
+		Missing:   stats.Missing,
+	}, nil
+}
+
+func vectorFormat(format string) (string, error) {
+	switch format = strings.ToLower(strings.TrimSpace(format)); format {
+	case "":
+		return VectorsNPY, nil
+	case VectorsNPY, VectorsFvecs:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown vector format %q (want %q or %q)", format, VectorsNPY, VectorsFvecs)
+}
@@ -0,0 +1,93 @@
+package csvsearch
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	"yashubustudio/csv-search/emb"
+)
+
+// Build metadata, set at link time:
+//
+//	go build -ldflags "-X yashubustudio/csv-search/pkg/csvsearch.Version=v1.2.0 \
+//	  -X yashubustudio/csv-search/pkg/csvsearch.Commit=$(git rev-parse HEAD) \
+//	  -X yashubustudio/csv-search/pkg/csvsearch.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Commit and BuildDate fall back to the VCS information recorded by the Go
+// toolchain when left empty.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// VersionInfo describes the running binary and the ONNX Runtime library it
+// uses. OnnxRuntime is empty when the library could not be loaded;
+// OnnxRuntimeError then says why.
+type VersionInfo struct {
+	Version          string `json:"version"`
+	Commit           string `json:"commit,omitempty"`
+	BuildDate        string `json:"build_date,omitempty"`
+	GoVersion        string `json:"go_version"`
+	Platform         string `json:"platform"`
+	OnnxRuntime      string `json:"onnx_runtime,omitempty"`
+	OnnxRuntimeError string `json:"onnx_runtime_error,omitempty"`
+}
+
+// BuildInfo returns the build metadata without probing ONNX Runtime.
+func BuildInfo() VersionInfo {
+	info := VersionInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		modified := false
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Commit = firstNonEmpty(info.Commit, setting.Value)
+			case "vcs.time":
+				info.BuildDate = firstNonEmpty(info.BuildDate, setting.Value)
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+		if Commit == "" && modified && info.Commit != "" {
+			info.Commit += "-dirty"
+		}
+	}
+	return info
+}
+
+// DescribeVersion returns BuildInfo together with the version of the ONNX
+// Runtime library configured by opts (flags or the JSON configuration).
+func DescribeVersion(opts ServiceOptions) VersionInfo {
+	info := BuildInfo()
+	cfg, err := loadConfig(opts.Config.Path, opts.Config.Required)
+	if err != nil {
+		info.OnnxRuntimeError = err.Error()
+		return info
+	}
+	info.setRuntimeVersion(resolveEncoderConfig(cfg, opts.Encoder.Config).OrtLibrary)
+	return info
+}
+
+// VersionInfo returns BuildInfo together with the version of the ONNX
+// Runtime library used by the Service's encoder.
+func (s *Service) VersionInfo() VersionInfo {
+	info := BuildInfo()
+	info.setRuntimeVersion(s.EncoderConfig().OrtLibrary)
+	return info
+}
+
+func (info *VersionInfo) setRuntimeVersion(ortLibrary string) {
+	version, err := emb.RuntimeVersion(ortLibrary)
+	if err != nil {
+		info.OnnxRuntimeError = err.Error()
+		return
+	}
+	info.OnnxRuntime = version
+}
@@ -0,0 +1,195 @@
+package csvsearch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"yashubustudio/csv-search/internal/database"
+	intsearch "yashubustudio/csv-search/internal/search"
+	"yashubustudio/csv-search/internal/store"
+)
+
+// ErrVersionNotFound is returned for a dataset version that was never
+// ingested or was deleted.
+var ErrVersionNotFound = store.ErrVersionNotFound
+
+// DatasetVersion describes a named version of a dataset. The live version
+// is the one searched by default; the others are searched with
+// SearchOptions.Version until PromoteVersion makes one of them live.
+type DatasetVersion struct {
+	Dataset string `json:"dataset"`
+	Table   string `json:"table"`
+	Version string `json:"version"`
+	// Records counts the records stored for the version.
+	Records  int64      `json:"records"`
+	Created  time.Time  `json:"created"`
+	Promoted *time.Time `json:"promoted,omitempty"`
+	Live     bool       `json:"live"`
+}
+
+// Versions lists the versions of a dataset, oldest first.
+func (s *Service) Versions(ctx context.Context, dataset string) ([]DatasetVersion, error) {
+	if err := s.ready(ctx); err != nil {
+		return nil, err
+	}
+	datasetName, datasetCfg, _ := resolveDataset(s.Config(), dataset)
+	table := resolveTable(datasetName, datasetCfg, "")
+	versions, err := store.Versions(ctx, s.db, table)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := store.Datasets(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+	rows := make(map[string]int64, len(stats))
+	for _, st := range stats {
+		rows[st.Dataset] = st.Rows
+	}
+	out := make([]DatasetVersion, 0, len(versions))
+	for _, v := range versions {
+		dv := DatasetVersion{
+			Dataset: datasetName,
+			Table:   versionTable(table, v),
+			Version: v.Version,
+			Created: v.Created,
+			Live:    v.Live,
+		}
+		dv.Records = rows[dv.Table]
+		if !v.Promoted.IsZero() {
+			promoted := v.Promoted
+			dv.Promoted = &promoted
+		}
+		out = append(out, dv)
+	}
+	return out, nil
+}
+
+// PromoteVersion makes a version the live contents of a dataset, so that
+// searches without a version see it. The swap is a single transaction; the
+// contents it replaces stay available as the version that was live before,
+// or as "previous" when they were not ingested as a version, so that
+// promoting that version rolls the change back. Change hooks and webhooks
+// are notified with a ChangeReset of the dataset.
+func (s *Service) PromoteVersion(ctx context.Context, dataset, version string) (DatasetVersion, error) {
+	if err := s.ready(ctx); err != nil {
+		return DatasetVersion{}, err
+	}
+	version = strings.TrimSpace(version)
+	datasetName, datasetCfg, _ := resolveDataset(s.Config(), dataset)
+	table := resolveTable(datasetName, datasetCfg, "")
+
+	defer s.invalidateResults(table)
+	retired, err := store.PromoteVersion(ctx, s.db, table, version)
+	if err != nil {
+		return DatasetVersion{}, err
+	}
+	if retired != "" {
+		for _, name := range []string{table, store.VersionTable(table, retired)} {
+			if err := s.rebuildIndexes(ctx, name, datasetCfg.Languages); err != nil {
+				return DatasetVersion{}, err
+			}
+		}
+		s.log.Info("dataset version promoted", "dataset", table, "version", version, "retired", retired)
+		s.notifyChange(ctx, table, ChangeReset, nil)
+	}
+	return s.findVersion(ctx, datasetName, version)
+}
+
+// DeleteVersion deletes a version of a dataset other than the live one,
+// with its records.
+func (s *Service) DeleteVersion(ctx context.Context, dataset, version string) error {
+	if err := s.ready(ctx); err != nil {
+		return err
+	}
+	datasetName, datasetCfg, _ := resolveDataset(s.Config(), dataset)
+	table := resolveTable(datasetName, datasetCfg, "")
+	removed, err := store.DeleteVersion(ctx, s.db, table, strings.TrimSpace(version))
+	if err != nil {
+		return err
+	}
+	s.invalidateResults(table)
+	s.log.Info("dataset version deleted", "dataset", table, "version", version, "records", removed)
+	return nil
+}
+
+// findVersion returns the version of a dataset called version.
+func (s *Service) findVersion(ctx context.Context, dataset, version string) (DatasetVersion, error) {
+	versions, err := s.Versions(ctx, dataset)
+	if err != nil {
+		return DatasetVersion{}, err
+	}
+	for _, v := range versions {
+		if v.Version == version {
+			return v, nil
+		}
+	}
+	return DatasetVersion{}, fmt.Errorf("%s@%s: %w", dataset, version, ErrVersionNotFound)
+}
+
+// versionTable returns the table that holds the records of version of
+// table, which is table itself for the live version. An empty version
+// means table.
+func (s *Service) versionTable(ctx context.Context, table, version string) (string, error) {
+	if version = strings.TrimSpace(version); version == "" {
+		return table, nil
+	}
+	v, err := store.GetVersion(ctx, s.reader, table, version)
+	if err != nil {
+		return "", err
+	}
+	return versionTable(table, v), nil
+}
+
+func versionTable(table string, v store.Version) string {
+	if v.Live {
+		return table
+	}
+	return store.VersionTable(table, v.Version)
+}
+
+// prepareVersion readies the table that an ingest into version of table
+// writes to. A new version starts as a copy of the live contents, so that
+// only the rows that changed are embedded again.
+func (s *Service) prepareVersion(ctx context.Context, table, version string) (string, error) {
+	if err := store.ValidateVersion(version); err != nil {
+		return "", err
+	}
+	v, err := store.GetVersion(ctx, s.db, table, version)
+	if err == nil {
+		return versionTable(table, v), nil
+	}
+	if !errors.Is(err, ErrVersionNotFound) {
+		return "", err
+	}
+	if version == store.RetiredVersion {
+		return "", fmt.Errorf("version name %q is reserved for the contents replaced by a promotion", version)
+	}
+	target := store.VersionTable(table, version)
+	copied, err := store.CopyDataset(ctx, s.db, table, target)
+	if err != nil {
+		return "", err
+	}
+	if _, err := database.BuildVectorPages(ctx, s.db, target); err != nil {
+		return "", err
+	}
+	s.log.Debug("dataset version created", "dataset", table, "version", version, "records", copied)
+	return target, nil
+}
+
+// rebuildIndexes rewrites the stale vector pages of table and, when its
+// dataset searches with the trigram tokenizer, rebuilds its trigram index.
+func (s *Service) rebuildIndexes(ctx context.Context, table string, languages map[string]intsearch.Language) error {
+	if _, err := database.UpdateVectorPages(ctx, s.db, table); err != nil {
+		return err
+	}
+	if intsearch.UsesTrigram(languages) {
+		if _, err := database.BuildTrigramIndex(ctx, s.db, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
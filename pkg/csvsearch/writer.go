@@ -0,0 +1,190 @@
+package csvsearch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"yashubustudio/csv-search/internal/database"
+	"yashubustudio/csv-search/internal/ingest"
+	intsearch "yashubustudio/csv-search/internal/search"
+)
+
+// Document is a record added through a Writer. Text holds the values that
+// are embedded and indexed for full-text search; Metadata becomes the
+// record's stored fields. A document with a precomputed Embedding (and
+// optionally its Sparse weights and the Model that produced them) is stored
+// without encoding its text, even when its content is unchanged.
+type Document struct {
+	ID        string
+	Text      []string
+	Metadata  map[string]string
+	Lat       *float64
+	Lng       *float64
+	Embedding []float32
+	Sparse    map[int32]float32
+	Model     string
+}
+
+// Writer streams documents into a dataset without going through a CSV file.
+// Documents are buffered and written batch_size at a time (1000 by default)
+// in one transaction, the way Ingest writes CSV rows: unchanged documents are
+// skipped and the others are embedded and upserted. A Writer is not safe for
+// concurrent use.
+type Writer struct {
+	s       *Service
+	ctx     context.Context
+	opts    ingest.Options
+	pending []ingest.Row
+	stats   ingest.Stats
+	summary IngestSummary
+	start   time.Time
+	closed  bool
+	// trigram is set when the dataset's languages search its trigram index.
+	trigram bool
+}
+
+// NewWriter returns a Writer for dataset (the default dataset when empty).
+// The dataset's batch_size and sparse settings and the ingest-row hooks
+// apply. ctx is used by every call of the Writer. Close must be called to
+// write the last documents.
+func (s *Service) NewWriter(ctx context.Context, dataset string) (*Writer, error) {
+	if err := s.ready(ctx); err != nil {
+		return nil, err
+	}
+	datasetName, ds, _ := resolveDataset(s.Config(), dataset)
+	table := resolveTable(datasetName, ds, "")
+	batchSize := firstPositive(ds.BatchSize, 1000)
+
+	w := &Writer{
+		s:   s,
+		ctx: ctx,
+		summary: IngestSummary{
+			Dataset:   datasetName,
+			Table:     table,
+			BatchSize: batchSize,
+			Sparse:    ds.Sparse,
+		},
+		start:   time.Now(),
+		trigram: intsearch.UsesTrigram(ds.Languages),
+	}
+	w.opts = ingest.Options{
+		Dataset:   table,
+		Sparse:    ds.Sparse,
+		Stats:     &w.stats,
+		Transform: s.ingestTransform(table),
+		Logger:    s.log,
+		OnCommit:  s.observeIngestBatch(table),
+		OnChange:  s.changeReporter(ctx, table),
+	}
+	return w, nil
+}
+
+// Add queues doc and writes the batch once it is full.
+func (w *Writer) Add(doc Document) error {
+	if w.closed {
+		return fmt.Errorf("writer is closed")
+	}
+	if strings.TrimSpace(doc.ID) == "" {
+		return fmt.Errorf("document id is required")
+	}
+	w.pending = append(w.pending, ingest.Row{
+		ID:        doc.ID,
+		Text:      doc.Text,
+		Metadata:  doc.Metadata,
+		Lat:       doc.Lat,
+		Lng:       doc.Lng,
+		Embedding: doc.Embedding,
+		Sparse:    doc.Sparse,
+		Model:     doc.Model,
+	})
+	if len(w.pending) >= w.summary.BatchSize {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Flush writes the queued documents. A failed batch is rolled back and
+// discarded; the Writer stays usable. The encoder is only loaded when a
+// document has no precomputed embedding.
+func (w *Writer) Flush() error {
+	if w.closed {
+		return fmt.Errorf("writer is closed")
+	}
+	if len(w.pending) == 0 {
+		return nil
+	}
+	rows := w.pending
+	w.pending = nil
+	opts := w.opts
+	var enc Embedder
+	// Ingest-row hooks may add text to a document without an embedding, so
+	// the encoder is loaded whenever they are registered.
+	if w.opts.Transform != nil || needsEncoder(rows) {
+		var release func()
+		var err error
+		enc, opts.Model, release, err = w.s.acquireModel()
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+	defer w.s.invalidateResults(w.summary.Table)
+	return ingest.Write(w.ctx, w.s.db, enc, opts, rows)
+}
+
+// needsEncoder reports whether a row has text but no precomputed embedding.
+func needsEncoder(rows []ingest.Row) bool {
+	for _, row := range rows {
+		if row.Embedding != nil {
+			continue
+		}
+		for _, part := range row.Text {
+			if strings.TrimSpace(part) != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Close writes the queued documents, rewrites the vector pages they made
+// stale (and the trigram index) of the dataset and releases the Writer.
+// Calling it again does nothing.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	err := w.Flush()
+	if w.stats.Upserted > 0 {
+		// The batches are committed one by one; the stale vector pages are
+		// only rewritten once, for the whole stream.
+		if _, pageErr := database.UpdateVectorPages(w.ctx, w.s.db, w.summary.Table); pageErr != nil && err == nil {
+			err = pageErr
+		}
+		if w.trigram {
+			if _, indexErr := database.BuildTrigramIndex(w.ctx, w.s.db, w.summary.Table); indexErr != nil && err == nil {
+				err = indexErr
+			}
+		}
+	}
+	w.closed = true
+	w.summary.Duration = time.Since(w.start)
+	w.s.metrics.observeIngest(w.summary.Table, w.stats.Upserted, w.stats.Skipped, w.summary.Duration)
+	w.s.observeIngestRows(w.summary.Table, w.stats)
+	return err
+}
+
+// Summary reports the documents written so far; Upserted, Skipped and
+// Dropped count them as for Ingest.
+func (w *Writer) Summary() IngestSummary {
+	summary := w.summary
+	summary.Upserted = w.stats.Upserted
+	summary.Skipped = w.stats.Skipped
+	summary.Dropped = w.stats.Dropped
+	if !w.closed {
+		summary.Duration = time.Since(w.start)
+	}
+	return summary
+}
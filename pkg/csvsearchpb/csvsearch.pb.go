@@ -0,0 +1,928 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v5.28.3
+// source: csvsearch/v1/csvsearch.proto
+
+package csvsearchpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Filter struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Field         string                 `protobuf:"bytes,1,opt,name=field,proto3" json:"field,omitempty"`
+	Value         string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Filter) Reset() {
+	*x = Filter{}
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Filter) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Filter) ProtoMessage() {}
+
+func (x *Filter) ProtoReflect() protoreflect.Message {
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Filter.ProtoReflect.Descriptor instead.
+func (*Filter) Descriptor() ([]byte, []int) {
+	return file_csvsearch_v1_csvsearch_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Filter) GetField() string {
+	if x != nil {
+		return x.Field
+	}
+	return ""
+}
+
+func (x *Filter) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+type SearchRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Query   string                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	Dataset string                 `protobuf:"bytes,2,opt,name=dataset,proto3" json:"dataset,omitempty"`
+	TopK    int32                  `protobuf:"varint,3,opt,name=top_k,json=topK,proto3" json:"top_k,omitempty"`
+	Filters []*Filter              `protobuf:"bytes,4,rep,name=filters,proto3" json:"filters,omitempty"`
+	// Weight of the bge-m3 lexical score; unset uses the server default.
+	SparseWeight  *float64 `protobuf:"fixed64,5,opt,name=sparse_weight,json=sparseWeight,proto3,oneof" json:"sparse_weight,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchRequest) Reset() {
+	*x = SearchRequest{}
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchRequest) ProtoMessage() {}
+
+func (x *SearchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchRequest.ProtoReflect.Descriptor instead.
+func (*SearchRequest) Descriptor() ([]byte, []int) {
+	return file_csvsearch_v1_csvsearch_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SearchRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetDataset() string {
+	if x != nil {
+		return x.Dataset
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetTopK() int32 {
+	if x != nil {
+		return x.TopK
+	}
+	return 0
+}
+
+func (x *SearchRequest) GetFilters() []*Filter {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+func (x *SearchRequest) GetSparseWeight() float64 {
+	if x != nil && x.SparseWeight != nil {
+		return *x.SparseWeight
+	}
+	return 0
+}
+
+type SearchResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Dataset       string                 `protobuf:"bytes,1,opt,name=dataset,proto3" json:"dataset,omitempty"`
+	Id            string                 `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	Fields        map[string]string      `protobuf:"bytes,3,rep,name=fields,proto3" json:"fields,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Score         float64                `protobuf:"fixed64,4,opt,name=score,proto3" json:"score,omitempty"`
+	Lat           *float64               `protobuf:"fixed64,5,opt,name=lat,proto3,oneof" json:"lat,omitempty"`
+	Lng           *float64               `protobuf:"fixed64,6,opt,name=lng,proto3,oneof" json:"lng,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchResult) Reset() {
+	*x = SearchResult{}
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchResult) ProtoMessage() {}
+
+func (x *SearchResult) ProtoReflect() protoreflect.Message {
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchResult.ProtoReflect.Descriptor instead.
+func (*SearchResult) Descriptor() ([]byte, []int) {
+	return file_csvsearch_v1_csvsearch_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SearchResult) GetDataset() string {
+	if x != nil {
+		return x.Dataset
+	}
+	return ""
+}
+
+func (x *SearchResult) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *SearchResult) GetFields() map[string]string {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+func (x *SearchResult) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+func (x *SearchResult) GetLat() float64 {
+	if x != nil && x.Lat != nil {
+		return *x.Lat
+	}
+	return 0
+}
+
+func (x *SearchResult) GetLng() float64 {
+	if x != nil && x.Lng != nil {
+		return *x.Lng
+	}
+	return 0
+}
+
+type SearchResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*SearchResult        `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchResponse) Reset() {
+	*x = SearchResponse{}
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchResponse) ProtoMessage() {}
+
+func (x *SearchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchResponse.ProtoReflect.Descriptor instead.
+func (*SearchResponse) Descriptor() ([]byte, []int) {
+	return file_csvsearch_v1_csvsearch_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SearchResponse) GetResults() []*SearchResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type IngestRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Dataset string                 `protobuf:"bytes,1,opt,name=dataset,proto3" json:"dataset,omitempty"`
+	Table   string                 `protobuf:"bytes,2,opt,name=table,proto3" json:"table,omitempty"`
+	// Path of the CSV file configured for the dataset on the server; other
+	// paths are rejected. Ignored when csv_data is set.
+	CsvPath string `protobuf:"bytes,3,opt,name=csv_path,json=csvPath,proto3" json:"csv_path,omitempty"`
+	// Inline CSV content.
+	CsvData         []byte   `protobuf:"bytes,4,opt,name=csv_data,json=csvData,proto3" json:"csv_data,omitempty"`
+	BatchSize       int32    `protobuf:"varint,5,opt,name=batch_size,json=batchSize,proto3" json:"batch_size,omitempty"`
+	IdColumn        string   `protobuf:"bytes,6,opt,name=id_column,json=idColumn,proto3" json:"id_column,omitempty"`
+	TextColumns     []string `protobuf:"bytes,7,rep,name=text_columns,json=textColumns,proto3" json:"text_columns,omitempty"`
+	MetadataColumns []string `protobuf:"bytes,8,rep,name=metadata_columns,json=metadataColumns,proto3" json:"metadata_columns,omitempty"`
+	LatitudeColumn  string   `protobuf:"bytes,9,opt,name=latitude_column,json=latitudeColumn,proto3" json:"latitude_column,omitempty"`
+	LongitudeColumn string   `protobuf:"bytes,10,opt,name=longitude_column,json=longitudeColumn,proto3" json:"longitude_column,omitempty"`
+	Sparse          bool     `protobuf:"varint,11,opt,name=sparse,proto3" json:"sparse,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *IngestRequest) Reset() {
+	*x = IngestRequest{}
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestRequest) ProtoMessage() {}
+
+func (x *IngestRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestRequest.ProtoReflect.Descriptor instead.
+func (*IngestRequest) Descriptor() ([]byte, []int) {
+	return file_csvsearch_v1_csvsearch_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *IngestRequest) GetDataset() string {
+	if x != nil {
+		return x.Dataset
+	}
+	return ""
+}
+
+func (x *IngestRequest) GetTable() string {
+	if x != nil {
+		return x.Table
+	}
+	return ""
+}
+
+func (x *IngestRequest) GetCsvPath() string {
+	if x != nil {
+		return x.CsvPath
+	}
+	return ""
+}
+
+func (x *IngestRequest) GetCsvData() []byte {
+	if x != nil {
+		return x.CsvData
+	}
+	return nil
+}
+
+func (x *IngestRequest) GetBatchSize() int32 {
+	if x != nil {
+		return x.BatchSize
+	}
+	return 0
+}
+
+func (x *IngestRequest) GetIdColumn() string {
+	if x != nil {
+		return x.IdColumn
+	}
+	return ""
+}
+
+func (x *IngestRequest) GetTextColumns() []string {
+	if x != nil {
+		return x.TextColumns
+	}
+	return nil
+}
+
+func (x *IngestRequest) GetMetadataColumns() []string {
+	if x != nil {
+		return x.MetadataColumns
+	}
+	return nil
+}
+
+func (x *IngestRequest) GetLatitudeColumn() string {
+	if x != nil {
+		return x.LatitudeColumn
+	}
+	return ""
+}
+
+func (x *IngestRequest) GetLongitudeColumn() string {
+	if x != nil {
+		return x.LongitudeColumn
+	}
+	return ""
+}
+
+func (x *IngestRequest) GetSparse() bool {
+	if x != nil {
+		return x.Sparse
+	}
+	return false
+}
+
+type IngestResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Dataset       string                 `protobuf:"bytes,1,opt,name=dataset,proto3" json:"dataset,omitempty"`
+	Table         string                 `protobuf:"bytes,2,opt,name=table,proto3" json:"table,omitempty"`
+	CsvPath       string                 `protobuf:"bytes,3,opt,name=csv_path,json=csvPath,proto3" json:"csv_path,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IngestResponse) Reset() {
+	*x = IngestResponse{}
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestResponse) ProtoMessage() {}
+
+func (x *IngestResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestResponse.ProtoReflect.Descriptor instead.
+func (*IngestResponse) Descriptor() ([]byte, []int) {
+	return file_csvsearch_v1_csvsearch_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *IngestResponse) GetDataset() string {
+	if x != nil {
+		return x.Dataset
+	}
+	return ""
+}
+
+func (x *IngestResponse) GetTable() string {
+	if x != nil {
+		return x.Table
+	}
+	return ""
+}
+
+func (x *IngestResponse) GetCsvPath() string {
+	if x != nil {
+		return x.CsvPath
+	}
+	return ""
+}
+
+type GetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Dataset       string                 `protobuf:"bytes,1,opt,name=dataset,proto3" json:"dataset,omitempty"`
+	Id            string                 `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRequest) Reset() {
+	*x = GetRequest{}
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRequest) ProtoMessage() {}
+
+func (x *GetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRequest.ProtoReflect.Descriptor instead.
+func (*GetRequest) Descriptor() ([]byte, []int) {
+	return file_csvsearch_v1_csvsearch_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GetRequest) GetDataset() string {
+	if x != nil {
+		return x.Dataset
+	}
+	return ""
+}
+
+func (x *GetRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type Record struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Dataset       string                 `protobuf:"bytes,1,opt,name=dataset,proto3" json:"dataset,omitempty"`
+	Id            string                 `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	Fields        map[string]string      `protobuf:"bytes,3,rep,name=fields,proto3" json:"fields,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Lat           *float64               `protobuf:"fixed64,4,opt,name=lat,proto3,oneof" json:"lat,omitempty"`
+	Lng           *float64               `protobuf:"fixed64,5,opt,name=lng,proto3,oneof" json:"lng,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Record) Reset() {
+	*x = Record{}
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Record) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Record) ProtoMessage() {}
+
+func (x *Record) ProtoReflect() protoreflect.Message {
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Record.ProtoReflect.Descriptor instead.
+func (*Record) Descriptor() ([]byte, []int) {
+	return file_csvsearch_v1_csvsearch_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Record) GetDataset() string {
+	if x != nil {
+		return x.Dataset
+	}
+	return ""
+}
+
+func (x *Record) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Record) GetFields() map[string]string {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+func (x *Record) GetLat() float64 {
+	if x != nil && x.Lat != nil {
+		return *x.Lat
+	}
+	return 0
+}
+
+func (x *Record) GetLng() float64 {
+	if x != nil && x.Lng != nil {
+		return *x.Lng
+	}
+	return 0
+}
+
+type DeleteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Dataset       string                 `protobuf:"bytes,1,opt,name=dataset,proto3" json:"dataset,omitempty"`
+	Ids           []string               `protobuf:"bytes,2,rep,name=ids,proto3" json:"ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteRequest) Reset() {
+	*x = DeleteRequest{}
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRequest) ProtoMessage() {}
+
+func (x *DeleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRequest.ProtoReflect.Descriptor instead.
+func (*DeleteRequest) Descriptor() ([]byte, []int) {
+	return file_csvsearch_v1_csvsearch_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *DeleteRequest) GetDataset() string {
+	if x != nil {
+		return x.Dataset
+	}
+	return ""
+}
+
+func (x *DeleteRequest) GetIds() []string {
+	if x != nil {
+		return x.Ids
+	}
+	return nil
+}
+
+type DeleteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Deleted       int64                  `protobuf:"varint,1,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteResponse) Reset() {
+	*x = DeleteResponse{}
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteResponse) ProtoMessage() {}
+
+func (x *DeleteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteResponse.ProtoReflect.Descriptor instead.
+func (*DeleteResponse) Descriptor() ([]byte, []int) {
+	return file_csvsearch_v1_csvsearch_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *DeleteResponse) GetDeleted() int64 {
+	if x != nil {
+		return x.Deleted
+	}
+	return 0
+}
+
+type HealthRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HealthRequest) Reset() {
+	*x = HealthRequest{}
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HealthRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HealthRequest) ProtoMessage() {}
+
+func (x *HealthRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HealthRequest.ProtoReflect.Descriptor instead.
+func (*HealthRequest) Descriptor() ([]byte, []int) {
+	return file_csvsearch_v1_csvsearch_proto_rawDescGZIP(), []int{10}
+}
+
+type HealthResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Status        string                 `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HealthResponse) Reset() {
+	*x = HealthResponse{}
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HealthResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HealthResponse) ProtoMessage() {}
+
+func (x *HealthResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_csvsearch_v1_csvsearch_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HealthResponse.ProtoReflect.Descriptor instead.
+func (*HealthResponse) Descriptor() ([]byte, []int) {
+	return file_csvsearch_v1_csvsearch_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *HealthResponse) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+var File_csvsearch_v1_csvsearch_proto protoreflect.FileDescriptor
+
+const file_csvsearch_v1_csvsearch_proto_rawDesc = "" +
+	"\n" +
+	"\x1ccsvsearch/v1/csvsearch.proto\x12\fcsvsearch.v1\"4\n" +
+	"\x06Filter\x12\x14\n" +
+	"\x05field\x18\x01 \x01(\tR\x05field\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\"\xc0\x01\n" +
+	"\rSearchRequest\x12\x14\n" +
+	"\x05query\x18\x01 \x01(\tR\x05query\x12\x18\n" +
+	"\adataset\x18\x02 \x01(\tR\adataset\x12\x13\n" +
+	"\x05top_k\x18\x03 \x01(\x05R\x04topK\x12.\n" +
+	"\afilters\x18\x04 \x03(\v2\x14.csvsearch.v1.FilterR\afilters\x12(\n" +
+	"\rsparse_weight\x18\x05 \x01(\x01H\x00R\fsparseWeight\x88\x01\x01B\x10\n" +
+	"\x0e_sparse_weight\"\x87\x02\n" +
+	"\fSearchResult\x12\x18\n" +
+	"\adataset\x18\x01 \x01(\tR\adataset\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x12>\n" +
+	"\x06fields\x18\x03 \x03(\v2&.csvsearch.v1.SearchResult.FieldsEntryR\x06fields\x12\x14\n" +
+	"\x05score\x18\x04 \x01(\x01R\x05score\x12\x15\n" +
+	"\x03lat\x18\x05 \x01(\x01H\x00R\x03lat\x88\x01\x01\x12\x15\n" +
+	"\x03lng\x18\x06 \x01(\x01H\x01R\x03lng\x88\x01\x01\x1a9\n" +
+	"\vFieldsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01B\x06\n" +
+	"\x04_latB\x06\n" +
+	"\x04_lng\"F\n" +
+	"\x0eSearchResponse\x124\n" +
+	"\aresults\x18\x01 \x03(\v2\x1a.csvsearch.v1.SearchResultR\aresults\"\xeb\x02\n" +
+	"\rIngestRequest\x12\x18\n" +
+	"\adataset\x18\x01 \x01(\tR\adataset\x12\x14\n" +
+	"\x05table\x18\x02 \x01(\tR\x05table\x12\x19\n" +
+	"\bcsv_path\x18\x03 \x01(\tR\acsvPath\x12\x19\n" +
+	"\bcsv_data\x18\x04 \x01(\fR\acsvData\x12\x1d\n" +
+	"\n" +
+	"batch_size\x18\x05 \x01(\x05R\tbatchSize\x12\x1b\n" +
+	"\tid_column\x18\x06 \x01(\tR\bidColumn\x12!\n" +
+	"\ftext_columns\x18\a \x03(\tR\vtextColumns\x12)\n" +
+	"\x10metadata_columns\x18\b \x03(\tR\x0fmetadataColumns\x12'\n" +
+	"\x0flatitude_column\x18\t \x01(\tR\x0elatitudeColumn\x12)\n" +
+	"\x10longitude_column\x18\n" +
+	" \x01(\tR\x0flongitudeColumn\x12\x16\n" +
+	"\x06sparse\x18\v \x01(\bR\x06sparse\"[\n" +
+	"\x0eIngestResponse\x12\x18\n" +
+	"\adataset\x18\x01 \x01(\tR\adataset\x12\x14\n" +
+	"\x05table\x18\x02 \x01(\tR\x05table\x12\x19\n" +
+	"\bcsv_path\x18\x03 \x01(\tR\acsvPath\"6\n" +
+	"\n" +
+	"GetRequest\x12\x18\n" +
+	"\adataset\x18\x01 \x01(\tR\adataset\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\"\xe5\x01\n" +
+	"\x06Record\x12\x18\n" +
+	"\adataset\x18\x01 \x01(\tR\adataset\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x128\n" +
+	"\x06fields\x18\x03 \x03(\v2 .csvsearch.v1.Record.FieldsEntryR\x06fields\x12\x15\n" +
+	"\x03lat\x18\x04 \x01(\x01H\x00R\x03lat\x88\x01\x01\x12\x15\n" +
+	"\x03lng\x18\x05 \x01(\x01H\x01R\x03lng\x88\x01\x01\x1a9\n" +
+	"\vFieldsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01B\x06\n" +
+	"\x04_latB\x06\n" +
+	"\x04_lng\";\n" +
+	"\rDeleteRequest\x12\x18\n" +
+	"\adataset\x18\x01 \x01(\tR\adataset\x12\x10\n" +
+	"\x03ids\x18\x02 \x03(\tR\x03ids\"*\n" +
+	"\x0eDeleteResponse\x12\x18\n" +
+	"\adeleted\x18\x01 \x01(\x03R\adeleted\"\x0f\n" +
+	"\rHealthRequest\"(\n" +
+	"\x0eHealthResponse\x12\x16\n" +
+	"\x06status\x18\x01 \x01(\tR\x06status2\xa1\x03\n" +
+	"\tCSVSearch\x12C\n" +
+	"\x06Search\x12\x1b.csvsearch.v1.SearchRequest\x1a\x1c.csvsearch.v1.SearchResponse\x12I\n" +
+	"\fSearchStream\x12\x1b.csvsearch.v1.SearchRequest\x1a\x1a.csvsearch.v1.SearchResult0\x01\x12C\n" +
+	"\x06Ingest\x12\x1b.csvsearch.v1.IngestRequest\x1a\x1c.csvsearch.v1.IngestResponse\x125\n" +
+	"\x03Get\x12\x18.csvsearch.v1.GetRequest\x1a\x14.csvsearch.v1.Record\x12C\n" +
+	"\x06Delete\x12\x1b.csvsearch.v1.DeleteRequest\x1a\x1c.csvsearch.v1.DeleteResponse\x12C\n" +
+	"\x06Health\x12\x1b.csvsearch.v1.HealthRequest\x1a\x1c.csvsearch.v1.HealthResponseB*Z(yashubustudio/csv-search/pkg/csvsearchpbb\x06proto3"
+
+var (
+	file_csvsearch_v1_csvsearch_proto_rawDescOnce sync.Once
+	file_csvsearch_v1_csvsearch_proto_rawDescData []byte
+)
+
+func file_csvsearch_v1_csvsearch_proto_rawDescGZIP() []byte {
+	file_csvsearch_v1_csvsearch_proto_rawDescOnce.Do(func() {
+		file_csvsearch_v1_csvsearch_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_csvsearch_v1_csvsearch_proto_rawDesc), len(file_csvsearch_v1_csvsearch_proto_rawDesc)))
+	})
+	return file_csvsearch_v1_csvsearch_proto_rawDescData
+}
+
+var file_csvsearch_v1_csvsearch_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_csvsearch_v1_csvsearch_proto_goTypes = []any{
+	(*Filter)(nil),         // 0: csvsearch.v1.Filter
+	(*SearchRequest)(nil),  // 1: csvsearch.v1.SearchRequest
+	(*SearchResult)(nil),   // 2: csvsearch.v1.SearchResult
+	(*SearchResponse)(nil), // 3: csvsearch.v1.SearchResponse
+	(*IngestRequest)(nil),  // 4: csvsearch.v1.IngestRequest
+	(*IngestResponse)(nil), // 5: csvsearch.v1.IngestResponse
+	(*GetRequest)(nil),     // 6: csvsearch.v1.GetRequest
+	(*Record)(nil),         // 7: csvsearch.v1.Record
+	(*DeleteRequest)(nil),  // 8: csvsearch.v1.DeleteRequest
+	(*DeleteResponse)(nil), // 9: csvsearch.v1.DeleteResponse
+	(*HealthRequest)(nil),  // 10: csvsearch.v1.HealthRequest
+	(*HealthResponse)(nil), // 11: csvsearch.v1.HealthResponse
+	nil,                    // 12: csvsearch.v1.SearchResult.FieldsEntry
+	nil,                    // 13: csvsearch.v1.Record.FieldsEntry
+}
+var file_csvsearch_v1_csvsearch_proto_depIdxs = []int32{
+	0,  // 0: csvsearch.v1.SearchRequest.filters:type_name -> csvsearch.v1.Filter
+	12, // 1: csvsearch.v1.SearchResult.fields:type_name -> csvsearch.v1.SearchResult.FieldsEntry
+	2,  // 2: csvsearch.v1.SearchResponse.results:type_name -> csvsearch.v1.SearchResult
+	13, // 3: csvsearch.v1.Record.fields:type_name -> csvsearch.v1.Record.FieldsEntry
+	1,  // 4: csvsearch.v1.CSVSearch.Search:input_type -> csvsearch.v1.SearchRequest
+	1,  // 5: csvsearch.v1.CSVSearch.SearchStream:input_type -> csvsearch.v1.SearchRequest
+	4,  // 6: csvsearch.v1.CSVSearch.Ingest:input_type -> csvsearch.v1.IngestRequest
+	6,  // 7: csvsearch.v1.CSVSearch.Get:input_type -> csvsearch.v1.GetRequest
+	8,  // 8: csvsearch.v1.CSVSearch.Delete:input_type -> csvsearch.v1.DeleteRequest
+	10, // 9: csvsearch.v1.CSVSearch.Health:input_type -> csvsearch.v1.HealthRequest
+	3,  // 10: csvsearch.v1.CSVSearch.Search:output_type -> csvsearch.v1.SearchResponse
+	2,  // 11: csvsearch.v1.CSVSearch.SearchStream:output_type -> csvsearch.v1.SearchResult
+	5,  // 12: csvsearch.v1.CSVSearch.Ingest:output_type -> csvsearch.v1.IngestResponse
+	7,  // 13: csvsearch.v1.CSVSearch.Get:output_type -> csvsearch.v1.Record
+	9,  // 14: csvsearch.v1.CSVSearch.Delete:output_type -> csvsearch.v1.DeleteResponse
+	11, // 15: csvsearch.v1.CSVSearch.Health:output_type -> csvsearch.v1.HealthResponse
+	10, // [10:16] is the sub-list for method output_type
+	4,  // [4:10] is the sub-list for method input_type
+	4,  // [4:4] is the sub-list for extension type_name
+	4,  // [4:4] is the sub-list for extension extendee
+	0,  // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_csvsearch_v1_csvsearch_proto_init() }
+func file_csvsearch_v1_csvsearch_proto_init() {
+	if File_csvsearch_v1_csvsearch_proto != nil {
+		return
+	}
+	file_csvsearch_v1_csvsearch_proto_msgTypes[1].OneofWrappers = []any{}
+	file_csvsearch_v1_csvsearch_proto_msgTypes[2].OneofWrappers = []any{}
+	file_csvsearch_v1_csvsearch_proto_msgTypes[7].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_csvsearch_v1_csvsearch_proto_rawDesc), len(file_csvsearch_v1_csvsearch_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   14,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_csvsearch_v1_csvsearch_proto_goTypes,
+		DependencyIndexes: file_csvsearch_v1_csvsearch_proto_depIdxs,
+		MessageInfos:      file_csvsearch_v1_csvsearch_proto_msgTypes,
+	}.Build()
+	File_csvsearch_v1_csvsearch_proto = out.File
+	file_csvsearch_v1_csvsearch_proto_goTypes = nil
+	file_csvsearch_v1_csvsearch_proto_depIdxs = nil
+}
@@ -0,0 +1,6 @@
+// Package csvsearchpb contains the generated protobuf messages and gRPC
+// client/server stubs for the csv-search API defined in
+// proto/csvsearch/v1/csvsearch.proto.
+package csvsearchpb
+
+//go:generate protoc -I ../../proto --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative csvsearch/v1/csvsearch.proto